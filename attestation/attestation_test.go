@@ -0,0 +1,203 @@
+package attestation_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+	"github.com/stretchr/testify/require"
+)
+
+// startAttester serves an attester over an in-memory connection and returns
+// the verifier side of it.
+func startAttester(t *testing.T, optionalCfg ...attestation.AttesterConfig) *attestation.Client {
+	thetpm := testutil.OpenSimulator(t)
+
+	attester, err := attestation.NewAttester(thetpm, optionalCfg...)
+	require.NoError(t, err)
+
+	verifierConn, attesterConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- attester.ServeConn(attesterConn)
+	}()
+	t.Cleanup(func() {
+		verifierConn.Close()
+		require.NoError(t, <-done)
+		require.NoError(t, attester.Close())
+	})
+	return attestation.NewClient(verifierConn)
+}
+
+func TestVerify(t *testing.T) {
+	client := startAttester(t)
+
+	result, err := attestation.Verify(client, tpm2.TPMAlgSHA256, []uint{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	require.NoError(t, err)
+	require.Len(t, result.Quote.Values, 10)
+	require.Equal(t, uint(9), result.Quote.Values[9].Index)
+}
+
+func TestVerify_IgnoredSelection(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		rewrite func(req *attestation.QuoteRequest)
+	}{
+		{"other PCRs", func(req *attestation.QuoteRequest) { req.PCRs = []uint{0} }},
+		{"no PCRs", func(req *attestation.QuoteRequest) { req.PCRs = nil }},
+		{"other bank", func(req *attestation.QuoteRequest) { req.Bank = tpmjson.AlgID(tpm2.TPMAlgSHA1) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := startDishonestAttester(t, tt.rewrite)
+			_, err := attestation.Verify(client, tpm2.TPMAlgSHA256, []uint{7, 0, 1})
+			require.ErrorIs(t, err, attestation.ErrQuoteMismatch)
+		})
+	}
+}
+
+// startDishonestAttester is startAttester, with an attester quoting the
+// selection set by rewrite rather than the one requested.
+func startDishonestAttester(t *testing.T, rewrite func(req *attestation.QuoteRequest)) *attestation.Client {
+	thetpm := testutil.OpenSimulator(t)
+
+	attester, err := attestation.NewAttester(thetpm)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, attester.Close()) })
+
+	verifierConn, attesterConn := net.Pipe()
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		verifierConn.Close()
+		<-done
+	})
+	go func() {
+		defer close(done)
+		dec := json.NewDecoder(attesterConn)
+		enc := json.NewEncoder(attesterConn)
+		for {
+			var req attestation.Request
+			if err := dec.Decode(&req); err != nil {
+				return
+			}
+			var rsp attestation.Response
+			var err error
+			switch req.Type {
+			case attestation.MessageParams:
+				rsp.Params, err = attester.Params()
+			case attestation.MessageActivate:
+				rsp.Activation, err = attester.ActivateCredential(req.Challenge)
+			case attestation.MessageQuote:
+				rewrite(req.Quote)
+				rsp.Quote, err = attester.Quote(req.Quote)
+			}
+			if err != nil {
+				rsp = attestation.Response{Error: err.Error()}
+			}
+			if enc.Encode(&rsp) != nil {
+				return
+			}
+		}
+	}()
+	return attestation.NewClient(verifierConn)
+}
+
+func TestActivateCredential_WrongName(t *testing.T) {
+	client := startAttester(t)
+
+	params, err := client.Params()
+	require.NoError(t, err)
+	ek, _, err := attestation.ParseParams(params)
+	require.NoError(t, err)
+
+	// Bind the credential to an object which is not loaded in the TPM.
+	wrongName := append([]byte(nil), params.AKName...)
+	wrongName[len(wrongName)-1] ^= 0xff
+	ch, err := attestation.NewCredentialChallenge(ek, wrongName, []byte("secret"))
+	require.NoError(t, err)
+
+	_, err = client.Activate(ch)
+	require.Error(t, err)
+}
+
+func TestAttester_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := startAttester(t, attestation.AttesterConfig{Logger: logger})
+
+	params, err := client.Params()
+	require.NoError(t, err)
+	ek, _, err := attestation.ParseParams(params)
+	require.NoError(t, err)
+	ch, err := attestation.NewCredentialChallenge(ek, []byte("wrong name"), []byte("secret"))
+	require.NoError(t, err)
+	_, err = client.Activate(ch)
+	require.Error(t, err)
+
+	logs := buf.String()
+	require.Contains(t, logs, `msg="tpm command" op=attest command=CreatePrimary`)
+	require.Contains(t, logs, `level=INFO msg="attestation request" type=params`)
+	var activate string
+	for _, line := range strings.Split(logs, "\n") {
+		if strings.Contains(line, "type=activate") {
+			activate = line
+		}
+	}
+	require.Contains(t, activate, `level=WARN msg="attestation request" type=activate`)
+	require.Contains(t, activate, "error=")
+}
+
+func TestParseParams_TamperedName(t *testing.T) {
+	client := startAttester(t)
+
+	params, err := client.Params()
+	require.NoError(t, err)
+	params.AKName[len(params.AKName)-1] ^= 0xff
+
+	_, _, err = attestation.ParseParams(params)
+	require.ErrorIs(t, err, attestation.ErrInvalidAK)
+}
+
+func TestVerifyQuote(t *testing.T) {
+	client := startAttester(t)
+
+	params, err := client.Params()
+	require.NoError(t, err)
+	_, ak, err := attestation.ParseParams(params)
+	require.NoError(t, err)
+
+	nonce := []byte("fresh nonce")
+	pcrs := []uint{7}
+
+	t.Run("valid", func(t *testing.T) {
+		q, err := client.Quote(&attestation.QuoteRequest{Nonce: nonce, Bank: tpmjson.AlgID(tpm2.TPMAlgSHA256), PCRs: pcrs})
+		require.NoError(t, err)
+		require.NoError(t, attestation.VerifyQuote(ak, nonce, q))
+	})
+
+	t.Run("stale nonce", func(t *testing.T) {
+		q, err := client.Quote(&attestation.QuoteRequest{Nonce: nonce, Bank: tpmjson.AlgID(tpm2.TPMAlgSHA256), PCRs: pcrs})
+		require.NoError(t, err)
+		require.ErrorIs(t, attestation.VerifyQuote(ak, []byte("another nonce"), q), attestation.ErrQuoteMismatch)
+	})
+
+	t.Run("forged PCR value", func(t *testing.T) {
+		q, err := client.Quote(&attestation.QuoteRequest{Nonce: nonce, Bank: tpmjson.AlgID(tpm2.TPMAlgSHA256), PCRs: pcrs})
+		require.NoError(t, err)
+		q.Values[0].Digest[0] ^= 0xff
+		require.ErrorIs(t, attestation.VerifyQuote(ak, nonce, q), attestation.ErrQuoteMismatch)
+	})
+
+	t.Run("tampered quote", func(t *testing.T) {
+		q, err := client.Quote(&attestation.QuoteRequest{Nonce: nonce, Bank: tpmjson.AlgID(tpm2.TPMAlgSHA256), PCRs: pcrs})
+		require.NoError(t, err)
+		q.Quoted[len(q.Quoted)-1] ^= 0xff
+		require.Error(t, attestation.VerifyQuote(ak, nonce, q))
+	})
+}
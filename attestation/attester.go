@@ -0,0 +1,228 @@
+package attestation
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/credential"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+	"github.com/loicsikidi/tpm-stuff/metrics"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/loicsikidi/tpm-stuff/provision"
+)
+
+// AKTemplate is the template of the Attestation Key created by the attester:
+// a restricted RSA-2048 signing key using RSASSA with SHA-256.
+var AKTemplate = provision.AKTemplate
+
+// AttesterConfig holds configuration for [NewAttester].
+type AttesterConfig struct {
+	// Logger logs the commands sent to the TPM (see metrics.Logger) and an
+	// "attestation request" event per verifier request served, with the
+	// attributes type, duration and, for failed requests, error.
+	//
+	// Default: nil, no logging.
+	Logger *slog.Logger
+}
+
+// CheckAndSetDefault validates and sets default values for AttesterConfig.
+func (c *AttesterConfig) CheckAndSetDefault() error {
+	return nil
+}
+
+// Attester answers verifier requests using the EK and AK of a TPM.
+type Attester struct {
+	tpm    transport.TPM
+	ek     tpmutil.Handle
+	ekCert []byte
+	ak     tpmutil.HandleCloser
+	logger *slog.Logger
+}
+
+// NewAttester uses the RSA EK persisted at provision.EKHandle, provisioned on
+// first use, along with its certificate if the TPM holds one, and creates the
+// AK (owner hierarchy).
+// The caller must call Close() to flush the AK.
+func NewAttester(tpm transport.TPM, optionalCfg ...AttesterConfig) (*Attester, error) {
+	var cfg AttesterConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	tpm = metrics.WithLogger(tpm, cfg.Logger, "attest")
+	ek, err := provision.EnsureEK(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision EK: %w", err)
+	}
+	ak, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		InPublic: AKTemplate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AK: %w", err)
+	}
+	a := &Attester{tpm: tpm, ek: ek, ak: ak, logger: cfg.Logger}
+	// TPMs without EK certificate, e.g. simulators, are attested without.
+	if cert, err := ekcert.Read(tpm, tpm2.TPMAlgRSA); err == nil {
+		a.ekCert = cert.Raw
+	}
+	return a, nil
+}
+
+// Close flushes the AK. The persistent EK is kept.
+func (a *Attester) Close() error {
+	return a.ak.Close()
+}
+
+// Params returns the EK and AK public areas, and the EK certificate.
+func (a *Attester) Params() (*Params, error) {
+	return &Params{
+		EKPublic:      tpm2.Marshal(a.ek.Public()),
+		AKPublic:      tpm2.Marshal(a.ak.Public()),
+		AKName:        a.ak.Name().Buffer,
+		EKCertificate: a.ekCert,
+	}, nil
+}
+
+// ActivateCredential decrypts a credential challenge with the EK.
+// The TPM only releases the secret if the challenge names the AK.
+func (a *Attester) ActivateCredential(ch *CredentialChallenge) (*ActivationResult, error) {
+	secret, err := credential.Activate(a.tpm, a.ek, a.ak, &credential.Challenge{
+		CredentialBlob:  ch.CredentialBlob,
+		EncryptedSecret: ch.EncryptedSecret,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ActivationResult{Secret: secret}, nil
+}
+
+// Quote signs the requested PCRs and the verifier nonce with the AK.
+func (a *Attester) Quote(req *QuoteRequest) (*QuoteResult, error) {
+	rsp, err := tpm2.Quote{
+		SignHandle:     tpmutil.ToAuthHandle(a.ak),
+		QualifyingData: tpm2.TPM2BData{Buffer: req.Nonce},
+		InScheme:       tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		PCRSelect:      pcr.Selection(tpm2.TPMAlgID(req.Bank), req.PCRs...),
+	}.Execute(a.tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quote: %w", err)
+	}
+	quoted, err := rsp.Quoted.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	bank, err := pcr.Read(a.tpm, tpm2.TPMAlgID(req.Bank), req.PCRs...)
+	if err != nil {
+		return nil, err
+	}
+	var values []PCRValue
+	for _, idx := range bank.Indexes() {
+		values = append(values, PCRValue{Index: idx, Digest: bank.Values[idx]})
+	}
+
+	return &QuoteResult{
+		Quoted:    tpm2.Marshal(quoted),
+		Signature: tpm2.Marshal(rsp.Signature),
+		Bank:      req.Bank,
+		Values:    values,
+	}, nil
+}
+
+// Serve accepts connections on l and answers requests until l is closed.
+// Connections are handled one at a time since the TPM transport is not safe
+// for concurrent use.
+func (a *Attester) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		err = a.ServeConn(conn)
+		_ = conn.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ServeConn answers requests read from conn until the peer closes it.
+func (a *Attester) ServeConn(conn io.ReadWriter) error {
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+	for {
+		var req Request
+		if err := dec.Decode(&req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to decode request: %w", err)
+		}
+		if err := enc.Encode(a.handle(&req)); err != nil {
+			return fmt.Errorf("failed to encode response: %w", err)
+		}
+	}
+}
+
+func (a *Attester) handle(req *Request) *Response {
+	var (
+		rsp   Response
+		err   error
+		start = time.Now()
+	)
+	defer func() { a.logRequest(req, time.Since(start), err) }()
+	switch req.Type {
+	case MessageParams:
+		rsp.Params, err = a.Params()
+	case MessageActivate:
+		if req.Challenge == nil {
+			err = errors.New("missing credential challenge")
+			break
+		}
+		rsp.Activation, err = a.ActivateCredential(req.Challenge)
+	case MessageQuote:
+		if req.Quote == nil {
+			err = errors.New("missing quote request")
+			break
+		}
+		rsp.Quote, err = a.Quote(req.Quote)
+	default:
+		err = fmt.Errorf("unknown message type %q", req.Type)
+	}
+	if err != nil {
+		return &Response{Error: err.Error()}
+	}
+	return &rsp
+}
+
+// logRequest logs a request served by the attester, if it has a logger.
+func (a *Attester) logRequest(req *Request, d time.Duration, err error) {
+	if a.logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("type", string(req.Type)),
+		slog.Duration("duration", d),
+	}
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	a.logger.LogAttrs(context.Background(), level, "attestation request", attrs...)
+}
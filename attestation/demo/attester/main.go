@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/attestation/service"
+	"github.com/loicsikidi/tpm-stuff/handles"
+	"github.com/loicsikidi/tpm-stuff/internal/tpmopen"
+)
+
+var (
+	tpmPath = flag.String("tpm-path", tpmopen.Simulator, "Path to the TPM device")
+	listen  = flag.String("listen", "127.0.0.1:8443", "Address the attester listens on")
+	// verifier selects the HTTP verifier of cmd/attest-verifier: the attester
+	// enrolls and sends a quote to it instead of waiting for verifiers.
+	verifier = flag.String("verifier", "", "URL of an attest-verifier service to enroll and attest to, e.g. http://127.0.0.1:8080")
+	verbose  = flag.Bool("verbose", false, "Log every command sent to the TPM")
+	jsonLogs = flag.Bool("json", false, "Log in JSON instead of text")
+)
+
+// logger logs the steps of the demo and, with -verbose, the TPM commands.
+var logger *slog.Logger
+
+// fatal logs msg along with err and exits.
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if *verbose {
+		opts.Level = slog.LevelDebug
+	}
+	if *jsonLogs {
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	} else {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, opts))
+	}
+
+	logger.Info("remote attestation demo: attester")
+
+	tpm, err := tpmopen.Open(*tpmPath)
+	if err != nil {
+		fatal("can't open TPM", err)
+	}
+	defer tpm.Close()
+	// The tracker reports the handles leaked while serving verifiers.
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: func(format string, args ...any) {
+		logger.Warn("leaked handle", "detail", fmt.Sprintf(format, args...))
+	}})
+	defer tracker.Close()
+
+	logger.Info("step 1: creating EK and AK")
+	attester, err := attestation.NewAttester(tpm, attestation.AttesterConfig{Logger: logger})
+	if err != nil {
+		fatal("can't create attestation keys", err)
+	}
+	defer attester.Close()
+	logger.Info("EK and AK created")
+
+	if *verifier != "" {
+		attest(attester)
+		return
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fatal("can't listen", err)
+	}
+	defer l.Close()
+
+	logger.Info("step 2: waiting for verifiers (Ctrl+C to stop)", "addr", l.Addr().String())
+	if err := attester.Serve(l); err != nil {
+		fatal("serve failed", err)
+	}
+}
+
+// attest enrolls the device to the verifier service and sends it a quote.
+func attest(attester *attestation.Attester) {
+	client := service.NewClient(*verifier, nil)
+
+	logger.Info("step 2: enrolling (credential activation)", "verifier", *verifier)
+	id, err := client.Enroll(attester)
+	if err != nil {
+		fatal("enrollment failed", err)
+	}
+	logger.Info("enrolled", "device", id)
+
+	logger.Info("step 3: quoting the PCRs requested by the verifier")
+	values, err := client.Attest(attester, id)
+	if err != nil {
+		fatal("attestation failed", err)
+	}
+	for _, v := range values {
+		logger.Info("quoted PCR", "index", v.Index, "digest", fmt.Sprintf("%x", v.Digest))
+	}
+	logger.Info("attestation succeeded")
+}
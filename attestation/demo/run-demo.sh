@@ -0,0 +1,60 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+# Colors for output
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+BLUE='\033[0;34m'
+NC='\033[0m' # No Color
+
+echo -e "${BLUE}======================================${NC}"
+echo -e "${BLUE}TPM Remote Attestation Demo${NC}"
+echo -e "${BLUE}======================================${NC}"
+echo ""
+
+if ! command -v swtpm &> /dev/null; then
+    echo -e "${RED}Error: swtpm is not installed${NC}"
+    echo "Please install: swtpm (apt install swtpm or brew install swtpm)"
+    exit 1
+fi
+
+DEMO_DIR="$(cd "$(dirname "$0")" && pwd)"
+TMPDIR="/tmp/tpm-attest-demo-$$"
+
+cleanup() {
+    echo ""
+    echo "Cleaning up..."
+    if [ -n "${ATTESTER_PID:-}" ]; then
+        kill "$ATTESTER_PID" 2>/dev/null || true
+    fi
+    if [ -n "${SWTPM_PID:-}" ]; then
+        kill "$SWTPM_PID" 2>/dev/null || true
+    fi
+    rm -rf "$TMPDIR"
+}
+
+trap cleanup EXIT INT TERM
+
+mkdir -p "$TMPDIR"
+
+echo -e "${GREEN}Step 1: Starting swtpm simulator on TCP port 2321...${NC}"
+swtpm socket \
+    --tpmstate dir="$TMPDIR" \
+    --tpm2 \
+    --server type=tcp,port=2321 \
+    --ctrl type=tcp,port=2322 \
+    --flags not-need-init,startup-clear \
+    --log level=0 &
+SWTPM_PID=$!
+sleep 2
+
+echo -e "${GREEN}Step 2: Building demo binaries...${NC}"
+(cd "$DEMO_DIR" && go build -o "$TMPDIR/attester" ./attester && go build -o "$TMPDIR/verifier" ./verifier)
+
+echo -e "${GREEN}Step 3: Starting attester...${NC}"
+"$TMPDIR/attester" -tpm-path="127.0.0.1:2321" -listen="127.0.0.1:8443" &
+ATTESTER_PID=$!
+sleep 2
+
+echo -e "${GREEN}Step 4: Running verifier...${NC}"
+"$TMPDIR/verifier" -addr="127.0.0.1:8443"
@@ -0,0 +1,174 @@
+package enrollment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryDB is a [DB] kept in memory.
+type MemoryDB struct {
+	mu      sync.Mutex
+	devices devices
+}
+
+// NewMemoryDB returns an empty MemoryDB.
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{devices: make(devices)}
+}
+
+// Allow implements [DB].
+func (db *MemoryDB) Allow(fingerprint, identity string) error {
+	fingerprint = normalize(fingerprint)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.devices.allow(fingerprint, identity, time.Now())
+	return nil
+}
+
+// Revoke implements [DB].
+func (db *MemoryDB) Revoke(fingerprint string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.devices.revoke(normalize(fingerprint), time.Now())
+}
+
+// Get implements [DB].
+func (db *MemoryDB) Get(fingerprint string) (*Device, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.devices.get(normalize(fingerprint))
+}
+
+// AddAK implements [DB].
+func (db *MemoryDB) AddAK(fingerprint string, akPublic []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.devices.addAK(normalize(fingerprint), akPublic)
+}
+
+// FileDB is a [DB] kept in a JSON file: an array of [Device], which the
+// operator may review or edit while the verifier runs. The file is read
+// at each call and replaced atomically at each change.
+type FileDB struct {
+	path string
+	mu   sync.Mutex
+}
+
+// OpenFileDB returns the FileDB of path, created empty if it doesn't exist.
+func OpenFileDB(path string) (*FileDB, error) {
+	db := &FileDB{path: path}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := db.write(make(devices)); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open allow-list: %w", err)
+	}
+	return db, nil
+}
+
+// Allow implements [DB].
+func (db *FileDB) Allow(fingerprint, identity string) error {
+	return db.update(func(ds devices) error {
+		ds.allow(normalize(fingerprint), identity, time.Now())
+		return nil
+	})
+}
+
+// Revoke implements [DB].
+func (db *FileDB) Revoke(fingerprint string) error {
+	return db.update(func(ds devices) error {
+		return ds.revoke(normalize(fingerprint), time.Now())
+	})
+}
+
+// Get implements [DB].
+func (db *FileDB) Get(fingerprint string) (*Device, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	ds, err := db.read()
+	if err != nil {
+		return nil, err
+	}
+	return ds.get(normalize(fingerprint))
+}
+
+// AddAK implements [DB].
+func (db *FileDB) AddAK(fingerprint string, akPublic []byte) error {
+	return db.update(func(ds devices) error {
+		return ds.addAK(normalize(fingerprint), akPublic)
+	})
+}
+
+// update applies fn to the devices of the file, and writes them back unless
+// fn fails.
+func (db *FileDB) update(fn func(devices) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	ds, err := db.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(ds); err != nil {
+		return err
+	}
+	return db.write(ds)
+}
+
+func (db *FileDB) read() (devices, error) {
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allow-list: %w", err)
+	}
+	var list []*Device
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode allow-list %s: %w", db.path, err)
+	}
+	ds := make(devices, len(list))
+	for _, d := range list {
+		d.Fingerprint = normalize(d.Fingerprint)
+		ds[d.Fingerprint] = d
+	}
+	return ds, nil
+}
+
+func (db *FileDB) write(ds devices) error {
+	list := make([]*Device, 0, len(ds))
+	for _, d := range ds {
+		list = append(list, d)
+	}
+	slices.SortFunc(list, func(a, b *Device) int { return strings.Compare(a.Fingerprint, b.Fingerprint) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write allow-list: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write allow-list: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write allow-list: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), db.path); err != nil {
+		return fmt.Errorf("failed to write allow-list: %w", err)
+	}
+	return nil
+}
+
+// normalize returns fingerprint in lowercase hex, without the colons of
+// the notation of most certificate tools.
+func normalize(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
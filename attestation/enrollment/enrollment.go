@@ -0,0 +1,128 @@
+// Package enrollment keeps the allow-list of the devices a verifier accepts:
+// each device is identified by the fingerprint of its EK certificate, mapped
+// to an identity chosen by the operator (e.g. an asset tag or a hostname)
+// and to the AKs it enrolled. Devices missing from the list, or revoked,
+// can't enroll nor be attested.
+//
+// The list is kept in a [DB]: [MemoryDB], or [FileDB] for a JSON file
+// shared with the tools of the operator.
+package enrollment
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrUnknownDevice is returned for devices missing from the allow-list.
+	ErrUnknownDevice = errors.New("device isn't allow-listed")
+	// ErrRevoked is returned for revoked devices.
+	ErrRevoked = errors.New("device is revoked")
+)
+
+// Device is an allow-listed device.
+type Device struct {
+	// Fingerprint is the fingerprint of the EK certificate of the device
+	// (see [Fingerprint]).
+	Fingerprint string `json:"fingerprint"`
+	// Identity is the identity of the device, chosen by the operator.
+	Identity string `json:"identity"`
+	// AKs are the marshaled TPMT_PUBLIC of the AKs enrolled by the device.
+	AKs [][]byte `json:"aks,omitempty"`
+	// AllowedAt is the time the device was allow-listed.
+	AllowedAt time.Time `json:"allowed_at"`
+	// RevokedAt is the time the device was revoked, if it was.
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Check returns [ErrRevoked] if d is revoked.
+func (d *Device) Check() error {
+	if d.RevokedAt != nil {
+		return ErrRevoked
+	}
+	return nil
+}
+
+// HasAK reports whether akPublic, a marshaled TPMT_PUBLIC, is enrolled by d.
+func (d *Device) HasAK(akPublic []byte) bool {
+	for _, ak := range d.AKs {
+		if bytes.Equal(ak, akPublic) {
+			return true
+		}
+	}
+	return false
+}
+
+// DB is the allow-list of the devices. Implementations must be safe for
+// concurrent use.
+type DB interface {
+	// Allow adds the device of the EK certificate fingerprint to the
+	// allow-list with identity. Allowing an allow-listed device updates its
+	// identity, and a revoked device is reinstated without its AKs.
+	Allow(fingerprint, identity string) error
+	// Revoke revokes the device fingerprint, or returns [ErrUnknownDevice].
+	Revoke(fingerprint string) error
+	// Get returns the device fingerprint, or [ErrUnknownDevice].
+	Get(fingerprint string) (*Device, error)
+	// AddAK records akPublic as an AK enrolled by the device fingerprint.
+	// It returns [ErrUnknownDevice] or [ErrRevoked] for devices which can't
+	// enroll.
+	AddAK(fingerprint string, akPublic []byte) error
+}
+
+// Fingerprint returns the fingerprint of an EK certificate: the hex encoded
+// SHA-256 digest of its DER encoding.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// devices holds the allow-list, shared by the implementations of DB.
+type devices map[string]*Device
+
+func (ds devices) allow(fingerprint, identity string, now time.Time) {
+	if d, ok := ds[fingerprint]; ok && d.RevokedAt == nil {
+		d.Identity = identity
+		return
+	}
+	ds[fingerprint] = &Device{Fingerprint: fingerprint, Identity: identity, AllowedAt: now}
+}
+
+func (ds devices) revoke(fingerprint string, now time.Time) error {
+	d, ok := ds[fingerprint]
+	if !ok {
+		return ErrUnknownDevice
+	}
+	if d.RevokedAt == nil {
+		d.RevokedAt = &now
+	}
+	return nil
+}
+
+func (ds devices) get(fingerprint string) (*Device, error) {
+	d, ok := ds[fingerprint]
+	if !ok {
+		return nil, ErrUnknownDevice
+	}
+	c := *d
+	c.AKs = append([][]byte(nil), d.AKs...)
+	return &c, nil
+}
+
+func (ds devices) addAK(fingerprint string, akPublic []byte) error {
+	d, ok := ds[fingerprint]
+	if !ok {
+		return ErrUnknownDevice
+	}
+	if err := d.Check(); err != nil {
+		return err
+	}
+	if !d.HasAK(akPublic) {
+		d.AKs = append(d.AKs, bytes.Clone(akPublic))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package enrollment_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/loicsikidi/tpm-stuff/attestation/enrollment"
+	"github.com/stretchr/testify/require"
+)
+
+const fingerprint = "5f4dcc3b5aa765d61d8327deb882cf995f4dcc3b5aa765d61d8327deb882cf99"
+
+func dbs(t *testing.T) map[string]enrollment.DB {
+	fileDB, err := enrollment.OpenFileDB(filepath.Join(t.TempDir(), "allowlist.json"))
+	require.NoError(t, err)
+	return map[string]enrollment.DB{
+		"memory": enrollment.NewMemoryDB(),
+		"file":   fileDB,
+	}
+}
+
+func TestDB(t *testing.T) {
+	for name, db := range dbs(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := db.Get(fingerprint)
+			require.ErrorIs(t, err, enrollment.ErrUnknownDevice)
+			require.ErrorIs(t, db.AddAK(fingerprint, []byte("ak")), enrollment.ErrUnknownDevice)
+			require.ErrorIs(t, db.Revoke(fingerprint), enrollment.ErrUnknownDevice)
+
+			require.NoError(t, db.Allow(fingerprint, "host-1"))
+			require.NoError(t, db.AddAK(fingerprint, []byte("ak")))
+			require.NoError(t, db.AddAK(fingerprint, []byte("ak")))
+			// Fingerprints are accepted in the notation of certificate tools.
+			require.NoError(t, db.Allow("5F:4D:CC:3B:5A:A7:65:D6:1D:83:27:DE:B8:82:CF:99:5F:4D:CC:3B:5A:A7:65:D6:1D:83:27:DE:B8:82:CF:99", "host-2"))
+
+			d, err := db.Get(fingerprint)
+			require.NoError(t, err)
+			require.Equal(t, fingerprint, d.Fingerprint)
+			require.Equal(t, "host-2", d.Identity)
+			require.Equal(t, [][]byte{[]byte("ak")}, d.AKs)
+			require.True(t, d.HasAK([]byte("ak")))
+			require.NoError(t, d.Check())
+
+			require.NoError(t, db.Revoke(fingerprint))
+			d, err = db.Get(fingerprint)
+			require.NoError(t, err)
+			require.ErrorIs(t, d.Check(), enrollment.ErrRevoked)
+			require.ErrorIs(t, db.AddAK(fingerprint, []byte("ak")), enrollment.ErrRevoked)
+
+			// Reinstated devices enroll their AKs again.
+			require.NoError(t, db.Allow(fingerprint, "host-2"))
+			d, err = db.Get(fingerprint)
+			require.NoError(t, err)
+			require.NoError(t, d.Check())
+			require.False(t, d.HasAK([]byte("ak")))
+		})
+	}
+}
+
+func TestFileDB_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+	db, err := enrollment.OpenFileDB(path)
+	require.NoError(t, err)
+	require.NoError(t, db.Allow(fingerprint, "host-1"))
+
+	db, err = enrollment.OpenFileDB(path)
+	require.NoError(t, err)
+	d, err := db.Get(fingerprint)
+	require.NoError(t, err)
+	require.Equal(t, "host-1", d.Identity)
+
+	// Edits of the operator are seen by the next call.
+	require.NoError(t, os.WriteFile(path, []byte("[]"), 0o600))
+	_, err = db.Get(fingerprint)
+	require.ErrorIs(t, err, enrollment.ErrUnknownDevice)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = db.Get(fingerprint)
+	require.Error(t, err)
+}
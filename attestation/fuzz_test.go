@@ -0,0 +1,63 @@
+package attestation_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+)
+
+// FuzzParseParams checks that parsing untrusted attestation parameters
+// doesn't panic.
+func FuzzParseParams(f *testing.F) {
+	ak := testutil.NewSoftwareAK(f)
+	f.Add(tpm2.Marshal(tpm2.RSAEKTemplate), tpm2.Marshal(ak.Public), ak.Name(f))
+	f.Add(tpm2.Marshal(tpm2.ECCEKTemplate), tpm2.Marshal(ak.Public), []byte{0x00, 0x0b})
+
+	f.Fuzz(func(t *testing.T, ekPublic, akPublic, akName []byte) {
+		attestation.ParseParams(&attestation.Params{ //nolint:errcheck
+			EKPublic: ekPublic,
+			AKPublic: akPublic,
+			AKName:   akName,
+		})
+	})
+}
+
+// FuzzVerifyQuote checks that verifying an untrusted quote doesn't panic.
+// The quote is signed by the AK, so that the target reaches the parsing of
+// the attestation structure.
+func FuzzVerifyQuote(f *testing.F) {
+	ak := testutil.NewSoftwareAK(f)
+	nonce := []byte("fuzzing nonce")
+
+	digest := make([]byte, sha256.Size)
+	composite := sha256.Sum256(append(digest, digest...))
+	quoted := tpm2.Marshal(tpm2.TPMSAttest{
+		Magic:     tpm2.TPMGeneratedValue,
+		Type:      tpm2.TPMSTAttestQuote,
+		ExtraData: tpm2.TPM2BData{Buffer: nonce},
+		Attested: tpm2.NewTPMUAttest(tpm2.TPMSTAttestQuote, &tpm2.TPMSQuoteInfo{
+			PCRSelect: pcr.Selection(tpm2.TPMAlgSHA256, 0, 7),
+			PCRDigest: tpm2.TPM2BDigest{Buffer: composite[:]},
+		}),
+	})
+	f.Add(quoted, []byte{0, 7}, digest)
+	f.Add(quoted, []byte{0}, digest)
+	f.Add(quoted[:len(quoted)/2], []byte{}, []byte{})
+
+	f.Fuzz(func(t *testing.T, quoted, indexes, digest []byte) {
+		q := &attestation.QuoteResult{
+			Quoted:    quoted,
+			Signature: ak.Sign(t, quoted),
+			Bank:      tpmjson.AlgID(tpm2.TPMAlgSHA256),
+		}
+		for _, i := range indexes {
+			q.Values = append(q.Values, attestation.PCRValue{Index: uint(i), Digest: digest})
+		}
+		attestation.VerifyQuote(&ak.Public, nonce, q) //nolint:errcheck
+	})
+}
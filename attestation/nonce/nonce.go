@@ -0,0 +1,223 @@
+// Package nonce manages the freshness of the quotes received by a verifier:
+// each nonce is issued to a subject (e.g. a device ID) for an expected PCR
+// policy, is valid for a limited time and is consumed by the first quote
+// presenting it, so that quotes can't be replayed.
+//
+// The nonces are kept in a [Store]: [MemoryStore] for a single verifier
+// process, [FileStore] to share them between processes or keep them across
+// restarts.
+package nonce
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+)
+
+// maxSize is the maximum size of a nonce: the size of TPM2B_DATA on most
+// TPMs, the largest digest of their hash algorithms.
+const maxSize = 64
+
+var (
+	// ErrUnknown is returned for nonces which weren't issued, or were
+	// already consumed.
+	ErrUnknown = errors.New("unknown nonce")
+	// ErrExpired is returned for nonces presented after their expiration.
+	ErrExpired = errors.New("expired nonce")
+	// ErrSubjectMismatch is returned for nonces presented by another subject
+	// than the one they were issued to.
+	ErrSubjectMismatch = errors.New("nonce issued to another subject")
+	// ErrPolicyMismatch is returned for quotes which don't satisfy the PCR
+	// policy of their nonce.
+	ErrPolicyMismatch = errors.New("quote doesn't match the PCR policy of the nonce")
+)
+
+// Policy is the PCR policy a nonce is issued for.
+type Policy struct {
+	// Bank is the PCR bank to quote.
+	Bank tpmjson.AlgID `json:"bank"`
+	// PCRs are the indexes of the PCRs to quote, in ascending order.
+	PCRs []uint `json:"pcrs"`
+	// Values are the expected values of some of PCRs, if any.
+	Values []attestation.PCRValue `json:"values,omitempty"`
+}
+
+// check returns [ErrPolicyMismatch] if q doesn't report exactly the PCRs of
+// p, with their expected values.
+func (p *Policy) check(q *attestation.QuoteResult) error {
+	if q.Bank != p.Bank {
+		return fmt.Errorf("%w: PCR bank %v, expected %v", ErrPolicyMismatch, q.Bank, p.Bank)
+	}
+	var reported []uint
+	for _, v := range q.Values {
+		reported = append(reported, v.Index)
+	}
+	if !slices.Equal(reported, p.PCRs) {
+		return fmt.Errorf("%w: PCRs %v, expected %v", ErrPolicyMismatch, reported, p.PCRs)
+	}
+	for _, want := range p.Values {
+		i := slices.IndexFunc(q.Values, func(v attestation.PCRValue) bool { return v.Index == want.Index })
+		if i < 0 || !bytes.Equal(q.Values[i].Digest, want.Digest) {
+			return fmt.Errorf("%w: PCR %d value", ErrPolicyMismatch, want.Index)
+		}
+	}
+	return nil
+}
+
+// Nonce is an issued nonce.
+type Nonce struct {
+	// Value is the nonce, the qualifying data of the quote.
+	Value []byte `json:"value"`
+	// Subject is the subject the nonce is issued to.
+	Subject string `json:"subject"`
+	// Policy is the PCR policy the quote must satisfy.
+	Policy Policy `json:"policy"`
+	// Expires is the time after which the nonce isn't valid anymore.
+	Expires time.Time `json:"expires"`
+}
+
+// Store keeps the issued nonces. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Add records n.
+	Add(n *Nonce) error
+	// Take removes and returns the nonce of value, or returns [ErrUnknown]:
+	// when called concurrently with the same value, at most one call
+	// returns the nonce.
+	Take(value []byte) (*Nonce, error)
+	// Purge removes the nonces expired at now.
+	Purge(now time.Time) error
+}
+
+// ManagerConfig holds configuration for [NewManager].
+type ManagerConfig struct {
+	// Store keeps the issued nonces.
+	//
+	// Default: a [MemoryStore].
+	Store Store
+	// TTL is how long a nonce is valid.
+	//
+	// Default: 1 minute.
+	TTL time.Duration
+	// Size is the size of the nonces, in bytes.
+	//
+	// Default: 32.
+	Size int
+}
+
+// CheckAndSetDefault validates and sets default values for ManagerConfig.
+func (c *ManagerConfig) CheckAndSetDefault() error {
+	if c.Store == nil {
+		c.Store = NewMemoryStore()
+	}
+	if c.TTL == 0 {
+		c.TTL = time.Minute
+	}
+	if c.TTL < 0 {
+		return errors.New("invalid TTL: must be positive")
+	}
+	if c.Size == 0 {
+		c.Size = 32
+	}
+	if c.Size < 16 || c.Size > maxSize {
+		return fmt.Errorf("invalid size: must be between 16 and %d bytes", maxSize)
+	}
+	return nil
+}
+
+// Manager issues nonces and verifies the quotes answering them.
+type Manager struct {
+	cfg ManagerConfig
+	now func() time.Time
+}
+
+// NewManager returns a Manager.
+//
+// Example:
+//
+//	nonces, err := nonce.NewManager()
+//	if err != nil {
+//	    return err
+//	}
+//	n, err := nonces.Issue(deviceID, nonce.Policy{Bank: tpmjson.AlgID(tpm2.TPMAlgSHA256), PCRs: []uint{7}})
+//	// ... send n.Value to the device, receive quote ...
+//	if _, err := nonces.Verify(deviceID, akPub, quote); err != nil {
+//	    return err
+//	}
+func NewManager(optionalCfg ...ManagerConfig) (*Manager, error) {
+	var cfg ManagerConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &Manager{cfg: cfg, now: time.Now}, nil
+}
+
+// Issue returns a fresh nonce for subject, whose quote must satisfy policy.
+// The expired nonces of the store are purged first.
+func (m *Manager) Issue(subject string, policy Policy) (*Nonce, error) {
+	if !slices.IsSorted(policy.PCRs) || len(slices.Compact(slices.Clone(policy.PCRs))) != len(policy.PCRs) {
+		return nil, errors.New("invalid policy: PCRs must be in strictly ascending order")
+	}
+	if len(policy.PCRs) > 0 && policy.PCRs[len(policy.PCRs)-1] >= pcr.Count {
+		return nil, fmt.Errorf("invalid policy: PCR index %d", policy.PCRs[len(policy.PCRs)-1])
+	}
+	now := m.now()
+	if err := m.cfg.Store.Purge(now); err != nil {
+		return nil, fmt.Errorf("failed to purge expired nonces: %w", err)
+	}
+	value := make([]byte, m.cfg.Size)
+	if _, err := rand.Read(value); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	n := &Nonce{Value: value, Subject: subject, Policy: policy, Expires: now.Add(m.cfg.TTL)}
+	if err := m.cfg.Store.Add(n); err != nil {
+		return nil, fmt.Errorf("failed to store nonce: %w", err)
+	}
+	return n, nil
+}
+
+// Verify consumes the nonce of q and checks that it was issued to subject,
+// hasn't expired, and that q is a valid quote by akPub satisfying its policy.
+//
+// The nonce is consumed by any quote carrying it, even invalid: a nonce is
+// presented only once.
+func (m *Manager) Verify(subject string, akPub *tpm2.TPMTPublic, q *attestation.QuoteResult) (*Nonce, error) {
+	// The nonce is read before the signature is checked, only to look it up:
+	// VerifyQuote checks it afterwards.
+	attest, err := tpm2.Unmarshal[tpm2.TPMSAttest](q.Quoted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse quote: %w", err)
+	}
+	value := attest.ExtraData.Buffer
+	if len(value) == 0 || len(value) > maxSize {
+		return nil, ErrUnknown
+	}
+	n, err := m.cfg.Store.Take(value)
+	if err != nil {
+		return nil, err
+	}
+	if !m.now().Before(n.Expires) {
+		return nil, ErrExpired
+	}
+	if n.Subject != subject {
+		return nil, ErrSubjectMismatch
+	}
+	if err := n.Policy.check(q); err != nil {
+		return nil, err
+	}
+	if err := attestation.VerifyQuote(akPub, n.Value, q); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
@@ -0,0 +1,180 @@
+package nonce_test
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/attestation/nonce"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+	"github.com/stretchr/testify/require"
+)
+
+var sha256Bank = tpmjson.AlgID(tpm2.TPMAlgSHA256)
+
+// quote returns a quote of values with qualifying data n, signed by ak.
+func quote(t *testing.T, ak *testutil.SoftwareAK, n []byte, values ...attestation.PCRValue) *attestation.QuoteResult {
+	var indexes []uint
+	composite := sha256.New()
+	for _, v := range values {
+		indexes = append(indexes, v.Index)
+		composite.Write(v.Digest)
+	}
+	quoted := tpm2.Marshal(tpm2.TPMSAttest{
+		Magic:     tpm2.TPMGeneratedValue,
+		Type:      tpm2.TPMSTAttestQuote,
+		ExtraData: tpm2.TPM2BData{Buffer: n},
+		Attested: tpm2.NewTPMUAttest(tpm2.TPMSTAttestQuote, &tpm2.TPMSQuoteInfo{
+			PCRSelect: pcr.Selection(tpm2.TPMAlgSHA256, indexes...),
+			PCRDigest: tpm2.TPM2BDigest{Buffer: composite.Sum(nil)},
+		}),
+	})
+	return &attestation.QuoteResult{
+		Quoted:    quoted,
+		Signature: ak.Sign(t, quoted),
+		Bank:      sha256Bank,
+		Values:    values,
+	}
+}
+
+func pcrValue(index uint, b byte) attestation.PCRValue {
+	digest := make([]byte, sha256.Size)
+	digest[0] = b
+	return attestation.PCRValue{Index: index, Digest: digest}
+}
+
+func stores(t *testing.T) map[string]nonce.Store {
+	fileStore, err := nonce.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	return map[string]nonce.Store{
+		"memory": nonce.NewMemoryStore(),
+		"file":   fileStore,
+	}
+}
+
+func TestManager(t *testing.T) {
+	ak := testutil.NewSoftwareAK(t)
+	policy := nonce.Policy{Bank: sha256Bank, PCRs: []uint{0, 7}, Values: []attestation.PCRValue{pcrValue(7, 1)}}
+	values := []attestation.PCRValue{pcrValue(0, 0), pcrValue(7, 1)}
+
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			m, err := nonce.NewManager(nonce.ManagerConfig{Store: store})
+			require.NoError(t, err)
+
+			t.Run("valid", func(t *testing.T) {
+				n, err := m.Issue("device", policy)
+				require.NoError(t, err)
+				require.Len(t, n.Value, 32)
+				q := quote(t, ak, n.Value, values...)
+
+				got, err := m.Verify("device", &ak.Public, q)
+				require.NoError(t, err)
+				require.Equal(t, n.Value, got.Value)
+
+				_, err = m.Verify("device", &ak.Public, q)
+				require.ErrorIs(t, err, nonce.ErrUnknown, "replay")
+			})
+
+			t.Run("unknown", func(t *testing.T) {
+				_, err := m.Verify("device", &ak.Public, quote(t, ak, []byte("guessed"), values...))
+				require.ErrorIs(t, err, nonce.ErrUnknown)
+			})
+
+			t.Run("other subject", func(t *testing.T) {
+				n, err := m.Issue("device", policy)
+				require.NoError(t, err)
+				_, err = m.Verify("other", &ak.Public, quote(t, ak, n.Value, values...))
+				require.ErrorIs(t, err, nonce.ErrSubjectMismatch)
+			})
+
+			for name, values := range map[string][]attestation.PCRValue{
+				"missing PCR": {pcrValue(7, 1)},
+				"extra PCR":   {pcrValue(0, 0), pcrValue(4, 0), pcrValue(7, 1)},
+				"PCR value":   {pcrValue(0, 0), pcrValue(7, 2)},
+			} {
+				t.Run(name, func(t *testing.T) {
+					n, err := m.Issue("device", policy)
+					require.NoError(t, err)
+					_, err = m.Verify("device", &ak.Public, quote(t, ak, n.Value, values...))
+					require.ErrorIs(t, err, nonce.ErrPolicyMismatch)
+				})
+			}
+
+			t.Run("invalid signature", func(t *testing.T) {
+				n, err := m.Issue("device", policy)
+				require.NoError(t, err)
+				_, err = m.Verify("device", &testutil.NewSoftwareAK(t).Public, quote(t, ak, n.Value, values...))
+				require.Error(t, err)
+				// The nonce is consumed all the same.
+				_, err = m.Verify("device", &ak.Public, quote(t, ak, n.Value, values...))
+				require.ErrorIs(t, err, nonce.ErrUnknown)
+			})
+		})
+	}
+}
+
+func TestManager_Expired(t *testing.T) {
+	ak := testutil.NewSoftwareAK(t)
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			m, err := nonce.NewManager(nonce.ManagerConfig{Store: store, TTL: time.Nanosecond})
+			require.NoError(t, err)
+			n, err := m.Issue("device", nonce.Policy{Bank: sha256Bank, PCRs: []uint{0}})
+			require.NoError(t, err)
+			time.Sleep(time.Millisecond)
+
+			_, err = m.Verify("device", &ak.Public, quote(t, ak, n.Value, pcrValue(0, 0)))
+			require.ErrorIs(t, err, nonce.ErrExpired)
+
+			// Expired nonces are purged by the next Issue.
+			n, err = m.Issue("device", nonce.Policy{Bank: sha256Bank, PCRs: []uint{0}})
+			require.NoError(t, err)
+			time.Sleep(time.Millisecond)
+			_, err = m.Issue("device", nonce.Policy{Bank: sha256Bank, PCRs: []uint{0}})
+			require.NoError(t, err)
+			_, err = store.Take(n.Value)
+			require.ErrorIs(t, err, nonce.ErrUnknown)
+		})
+	}
+}
+
+func TestManager_InvalidPolicy(t *testing.T) {
+	m, err := nonce.NewManager()
+	require.NoError(t, err)
+	for _, pcrs := range [][]uint{{7, 0}, {0, 0}, {pcr.Count}} {
+		_, err := m.Issue("device", nonce.Policy{Bank: sha256Bank, PCRs: pcrs})
+		require.Error(t, err, pcrs)
+	}
+}
+
+func TestStore_TakeOnce(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			n := &nonce.Nonce{Value: []byte("0123456789abcdef"), Expires: time.Now().Add(time.Minute)}
+			require.NoError(t, store.Add(n))
+
+			var (
+				wg    sync.WaitGroup
+				taken atomic.Int32
+			)
+			for range 16 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := store.Take(n.Value); err == nil {
+						taken.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			require.Equal(t, int32(1), taken.Load())
+		})
+	}
+}
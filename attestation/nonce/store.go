@@ -0,0 +1,146 @@
+package nonce
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a [Store] keeping the nonces in memory.
+type MemoryStore struct {
+	mu     sync.Mutex
+	nonces map[string]Nonce
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{nonces: make(map[string]Nonce)}
+}
+
+// Add implements [Store].
+func (s *MemoryStore) Add(n *Nonce) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nonces[string(n.Value)] = *n
+	return nil
+}
+
+// Take implements [Store].
+func (s *MemoryStore) Take(value []byte) (*Nonce, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.nonces[string(value)]
+	if !ok {
+		return nil, ErrUnknown
+	}
+	delete(s.nonces, string(value))
+	return &n, nil
+}
+
+// Purge implements [Store].
+func (s *MemoryStore) Purge(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, n := range s.nonces {
+		if !now.Before(n.Expires) {
+			delete(s.nonces, k)
+		}
+	}
+	return nil
+}
+
+// FileStore is a [Store] keeping each nonce in a JSON file named after its
+// value in a directory. A nonce is consumed by removing its file, so that it
+// is used only once even by verifiers running in several processes.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore using dir, created if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Add implements [Store].
+func (s *FileStore) Add(n *Nonce) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	// Written under a temporary name first: Take must never read a partial
+	// file.
+	path := s.path(n.Value)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write nonce: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write nonce: %w", err)
+	}
+	return nil
+}
+
+// Take implements [Store].
+func (s *FileStore) Take(value []byte) (*Nonce, error) {
+	path := s.path(value)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUnknown
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nonce: %w", err)
+	}
+	// Only the caller which removes the file gets the nonce.
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUnknown
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to consume nonce: %w", err)
+	}
+	var n Nonce
+	if err := json.Unmarshal(data, &n); err != nil {
+		return nil, fmt.Errorf("failed to decode nonce: %w", err)
+	}
+	return &n, nil
+}
+
+// Purge implements [Store].
+func (s *FileStore) Purge(now time.Time) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list nonces: %w", err)
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(s.dir, e.Name())
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // consumed meanwhile
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read nonce: %w", err)
+		}
+		var n Nonce
+		if json.Unmarshal(data, &n) != nil || !now.Before(n.Expires) {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove expired nonce: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) path(value []byte) string {
+	return filepath.Join(s.dir, hex.EncodeToString(value)+".json")
+}
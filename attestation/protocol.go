@@ -0,0 +1,104 @@
+// Package attestation implements a minimal remote-attestation protocol between
+// an attester (the device owning the TPM) and a verifier (a remote party).
+//
+// The protocol runs over any stream connection (typically TCP) and exchanges
+// newline-delimited JSON messages. TPM structures are carried in their TPM
+// wire format (tpm2.Marshal), which encoding/json renders as base64, and
+// algorithms by name (see the tpmjson package).
+//
+// Flow:
+//  1. The verifier asks for the attestation parameters (EK and AK public areas).
+//  2. The verifier builds a credential challenge bound to the AK Name and
+//     encrypted to the EK (MakeCredential, done in software). Only a TPM
+//     holding both keys can recover the secret via ActivateCredential.
+//  3. The verifier sends a fresh nonce and receives a quote signed by the AK,
+//     along with the PCR values it covers.
+package attestation
+
+import (
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+)
+
+// MessageType identifies the kind of request sent by the verifier.
+type MessageType string
+
+const (
+	// MessageParams requests the EK and AK public areas.
+	MessageParams MessageType = "params"
+	// MessageActivate sends a credential challenge to be decrypted by the TPM.
+	MessageActivate MessageType = "activate"
+	// MessageQuote requests a quote over the selected PCRs.
+	MessageQuote MessageType = "quote"
+)
+
+// Request is a message sent by the verifier to the attester.
+type Request struct {
+	Type MessageType `json:"type"`
+	// Challenge is set when Type is [MessageActivate].
+	Challenge *CredentialChallenge `json:"challenge,omitempty"`
+	// Quote is set when Type is [MessageQuote].
+	Quote *QuoteRequest `json:"quote,omitempty"`
+}
+
+// Response is a message sent by the attester to the verifier.
+// Exactly one of the payload fields is set, unless Error is not empty.
+type Response struct {
+	Error      string            `json:"error,omitempty"`
+	Params     *Params           `json:"params,omitempty"`
+	Activation *ActivationResult `json:"activation,omitempty"`
+	Quote      *QuoteResult      `json:"quote,omitempty"`
+}
+
+// Params contains the public material the verifier needs to challenge the attester.
+type Params struct {
+	// EKPublic is the marshaled TPMT_PUBLIC of the Endorsement Key.
+	EKPublic []byte `json:"ek_public"`
+	// AKPublic is the marshaled TPMT_PUBLIC of the Attestation Key.
+	AKPublic []byte `json:"ak_public"`
+	// AKName is the Name of the Attestation Key as reported by the TPM.
+	AKName []byte `json:"ak_name"`
+	// EKCertificate is the DER certificate of the Endorsement Key, if the
+	// TPM holds one.
+	EKCertificate []byte `json:"ek_certificate,omitempty"`
+}
+
+// CredentialChallenge is the output of MakeCredential.
+type CredentialChallenge struct {
+	// CredentialBlob is the TPM2B_ID_OBJECT contents.
+	CredentialBlob []byte `json:"credential_blob"`
+	// EncryptedSecret is the TPM2B_ENCRYPTED_SECRET contents.
+	EncryptedSecret []byte `json:"encrypted_secret"`
+}
+
+// ActivationResult is the secret recovered by ActivateCredential.
+type ActivationResult struct {
+	Secret []byte `json:"secret"`
+}
+
+// QuoteRequest asks the attester to quote a set of PCRs.
+type QuoteRequest struct {
+	// Nonce is the qualifying data included in the quote to prove freshness.
+	Nonce []byte `json:"nonce"`
+	// Bank is the PCR bank to quote.
+	Bank tpmjson.AlgID `json:"bank"`
+	// PCRs is the list of PCR indexes to quote.
+	PCRs []uint `json:"pcrs"`
+}
+
+// PCRValue is the digest of a single PCR.
+type PCRValue struct {
+	Index  uint   `json:"index"`
+	Digest []byte `json:"digest"`
+}
+
+// QuoteResult is a quote produced by the attester.
+type QuoteResult struct {
+	// Quoted is the marshaled TPMS_ATTEST structure which has been signed.
+	Quoted []byte `json:"quoted"`
+	// Signature is the marshaled TPMT_SIGNATURE over Quoted.
+	Signature []byte `json:"signature"`
+	// Bank is the PCR bank of Values.
+	Bank tpmjson.AlgID `json:"bank"`
+	// Values are the PCR values covered by the quote, in ascending index order.
+	Values []PCRValue `json:"values"`
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/loicsikidi/tpm-stuff/attestation"
+)
+
+// Attester is the TPM side of the protocol, implemented by
+// [attestation.Attester].
+type Attester interface {
+	Params() (*attestation.Params, error)
+	ActivateCredential(ch *attestation.CredentialChallenge) (*attestation.ActivationResult, error)
+	Quote(req *attestation.QuoteRequest) (*attestation.QuoteResult, error)
+}
+
+// Client runs the exchanges of an attester with the service.
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+// NewClient returns a Client of the service at url, e.g.
+// "http://127.0.0.1:8080", sending its requests with hc, or
+// [http.DefaultClient] when nil.
+func NewClient(url string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{url: strings.TrimSuffix(url, "/"), http: hc}
+}
+
+// Enroll enrolls the device of a and returns its ID.
+//
+// Example:
+//
+//	client := service.NewClient("http://127.0.0.1:8080", nil)
+//	id, err := client.Enroll(attester)
+//	if err != nil {
+//	    return err
+//	}
+//	values, err := client.Attest(attester, id)
+func (c *Client) Enroll(a Attester) (string, error) {
+	params, err := a.Params()
+	if err != nil {
+		return "", err
+	}
+	var started EnrollResponse
+	if err := c.post("/enroll", &EnrollRequest{Params: params}, &started); err != nil {
+		return "", err
+	}
+	if started.Challenge == nil {
+		return "", errors.New("empty enrollment challenge")
+	}
+	activation, err := a.ActivateCredential(started.Challenge)
+	if err != nil {
+		return "", err
+	}
+	var completed EnrollResponse
+	if err := c.post("/enroll", &EnrollRequest{DeviceID: started.DeviceID, Activation: activation}, &completed); err != nil {
+		return "", err
+	}
+	return completed.DeviceID, nil
+}
+
+// Attest quotes the PCRs requested by the service with a fresh nonce, and
+// returns the PCR values verified by the service.
+func (c *Client) Attest(a Attester, deviceID string) ([]attestation.PCRValue, error) {
+	var req attestation.QuoteRequest
+	if err := c.post("/challenge", &ChallengeRequest{DeviceID: deviceID}, &req); err != nil {
+		return nil, err
+	}
+	q, err := a.Quote(&req)
+	if err != nil {
+		return nil, err
+	}
+	var rsp QuoteResponse
+	if err := c.post("/quote", &QuoteRequest{DeviceID: deviceID, Quote: q}, &rsp); err != nil {
+		return nil, err
+	}
+	return rsp.Values, nil
+}
+
+// post sends req to path and decodes the response into rsp.
+func (c *Client) post(path string, req, rsp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := c.http.Post(c.url+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send %s request: %w", path, err)
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", path, err)
+	}
+	if r.StatusCode != http.StatusOK {
+		var e errorResponse
+		if json.Unmarshal(data, &e) != nil || e.Error == "" {
+			e.Error = r.Status
+		}
+		return fmt.Errorf("verifier failed %s request: %s", path, e.Error)
+	}
+	if err := json.Unmarshal(data, rsp); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,503 @@
+// Package service implements the verifier side of the remote-attestation
+// protocol of the attestation package as an HTTP service, for attesters
+// reaching the verifier rather than the other way around:
+//
+//  1. POST /enroll with the attestation parameters: the service answers a
+//     credential challenge encrypted to the EK and bound to the AK Name.
+//  2. POST /enroll with the secret recovered by ActivateCredential: the
+//     device, identified by the Name of its EK, is enrolled along with its AK
+//     in a [Store].
+//  3. POST /challenge: the service answers a fresh nonce and the PCRs to
+//     quote.
+//  4. POST /quote with the quote: the service verifies it with the enrolled
+//     AK against the nonce of the challenge, which is used only once (see
+//     the nonce package).
+//
+// With [Config.Enrollments], only the devices whose EK certificate is
+// allow-listed can enroll, and their quotes are rejected once revoked.
+//
+// Requests and responses are JSON, using the types of the attestation
+// package. Errors are answered as {"error": "<message>"}.
+//
+// [Client] runs the attester side of the exchanges.
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/attestation/enrollment"
+	"github.com/loicsikidi/tpm-stuff/attestation/nonce"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+	"github.com/loicsikidi/tpm-stuff/names"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+)
+
+// maxRequestSize is the maximum size of a request body.
+const maxRequestSize = 64 << 10
+
+var (
+	// ErrNoEnrollment is returned when the secret of a credential challenge
+	// is sent for a device without enrollment in progress, or after the
+	// challenge expired.
+	ErrNoEnrollment = errors.New("no enrollment in progress")
+
+	// errUntrustedEK is returned for EK certificates which don't certify the
+	// EK or don't chain up to the EK roots.
+	errUntrustedEK = errors.New("untrusted EK certificate")
+)
+
+// EnrollRequest is the body of POST /enroll: either Params to start the
+// enrollment, or DeviceID and Activation to complete it.
+type EnrollRequest struct {
+	Params     *attestation.Params           `json:"params,omitempty"`
+	DeviceID   string                        `json:"device_id,omitempty"`
+	Activation *attestation.ActivationResult `json:"activation,omitempty"`
+}
+
+// EnrollResponse is the response to POST /enroll. Challenge is set when the
+// enrollment starts.
+type EnrollResponse struct {
+	DeviceID  string                           `json:"device_id"`
+	Challenge *attestation.CredentialChallenge `json:"challenge,omitempty"`
+}
+
+// ChallengeRequest is the body of POST /challenge. The response is an
+// [attestation.QuoteRequest].
+type ChallengeRequest struct {
+	DeviceID string `json:"device_id"`
+}
+
+// QuoteRequest is the body of POST /quote.
+type QuoteRequest struct {
+	DeviceID string                   `json:"device_id"`
+	Quote    *attestation.QuoteResult `json:"quote"`
+}
+
+// QuoteResponse is the response to POST /quote: the verified PCR values.
+type QuoteResponse struct {
+	DeviceID string                 `json:"device_id"`
+	Values   []attestation.PCRValue `json:"values"`
+}
+
+// errorResponse is the body of the responses to failed requests.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Config holds configuration for [New].
+type Config struct {
+	// Store persists the enrolled devices.
+	//
+	// Default: a [MemoryStore].
+	Store Store
+	// Nonces keeps the nonces of the challenges.
+	//
+	// Default: a nonce.MemoryStore.
+	Nonces nonce.Store
+	// Bank is the PCR bank quoted by the devices.
+	//
+	// Default: tpm2.TPMAlgSHA256.
+	Bank tpm2.TPMAlgID
+	// PCRs are the indexes of the PCRs quoted by the devices.
+	//
+	// Default: 0 to 7, the PCRs of the firmware and boot loader.
+	PCRs []uint
+	// TTL is how long credential challenges and quote nonces are valid.
+	//
+	// Default: 1 minute.
+	TTL time.Duration
+	// Enrollments is the allow-list of the devices: when set, a device must
+	// send its EK certificate to enroll, which must be allow-listed and not
+	// revoked, and its quotes are rejected once it is revoked.
+	//
+	// Default: nil, any TPM can enroll.
+	Enrollments enrollment.DB
+	// EKRoots are the roots of the TPM manufacturers, verifying the chain of
+	// the EK certificates along with Enrollments.
+	//
+	// Default: nil, only the fingerprint of the EK certificates is checked.
+	EKRoots *x509.CertPool
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	if c.Store == nil {
+		c.Store = NewMemoryStore()
+	}
+	if c.Nonces == nil {
+		c.Nonces = nonce.NewMemoryStore()
+	}
+	if c.Bank == 0 {
+		c.Bank = tpm2.TPMAlgSHA256
+	}
+	if len(c.PCRs) == 0 {
+		c.PCRs = []uint{0, 1, 2, 3, 4, 5, 6, 7}
+	}
+	c.PCRs = slices.Compact(slices.Sorted(slices.Values(c.PCRs)))
+	if c.PCRs[len(c.PCRs)-1] >= pcr.Count {
+		return fmt.Errorf("invalid PCR index %d", c.PCRs[len(c.PCRs)-1])
+	}
+	if c.TTL == 0 {
+		c.TTL = time.Minute
+	}
+	if c.TTL < 0 {
+		return errors.New("invalid TTL: must be positive")
+	}
+	return nil
+}
+
+// Server is the verifier service, an [http.Handler]. It is safe for
+// concurrent use.
+type Server struct {
+	cfg    Config
+	mux    *http.ServeMux
+	now    func() time.Time
+	nonces *nonce.Manager
+
+	mu      sync.Mutex
+	pending map[string]*pendingEnrollment
+}
+
+// pendingEnrollment is an enrollment waiting for the secret of its credential
+// challenge.
+type pendingEnrollment struct {
+	ekPublic, akPublic []byte
+	ekFingerprint      string
+	secret             []byte
+	expires            time.Time
+}
+
+// New returns a Server.
+//
+// Example:
+//
+//	store, err := service.NewFileStore("/var/lib/attest-verifier")
+//	if err != nil {
+//	    return err
+//	}
+//	srv, err := service.New(service.Config{Store: store})
+//	if err != nil {
+//	    return err
+//	}
+//	http.ListenAndServe(":8080", srv)
+func New(optionalCfg ...Config) (*Server, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	nonces, err := nonce.NewManager(nonce.ManagerConfig{Store: cfg.Nonces, TTL: cfg.TTL})
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		cfg:     cfg,
+		mux:     http.NewServeMux(),
+		now:     time.Now,
+		nonces:  nonces,
+		pending: make(map[string]*pendingEnrollment),
+	}
+	s.mux.HandleFunc("POST /enroll", s.enroll)
+	s.mux.HandleFunc("POST /challenge", s.challenge)
+	s.mux.HandleFunc("POST /quote", s.quote)
+	return s, nil
+}
+
+// ServeHTTP implements [http.Handler].
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) enroll(w http.ResponseWriter, r *http.Request) {
+	var req EnrollRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	switch {
+	case req.Params != nil:
+		s.startEnrollment(w, req.Params)
+	case req.Activation != nil:
+		s.completeEnrollment(w, req.DeviceID, req.Activation)
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("missing params or activation"))
+	}
+}
+
+// startEnrollment answers a credential challenge for the AK of params.
+func (s *Server) startEnrollment(w http.ResponseWriter, params *attestation.Params) {
+	ek, ak, err := attestation.ParseParams(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id, err := deviceID(ek)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var fingerprint string
+	if s.cfg.Enrollments != nil {
+		if fingerprint, err = s.allowed(params.EKCertificate, ek); err != nil {
+			writeEnrollmentError(w, err)
+			return
+		}
+	}
+	secret, err := random()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ch, err := attestation.NewCredentialChallenge(ek, params.AKName, secret)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.purge()
+	s.pending[id] = &pendingEnrollment{
+		ekPublic:      tpm2.Marshal(ek),
+		akPublic:      tpm2.Marshal(ak),
+		ekFingerprint: fingerprint,
+		secret:        secret,
+		expires:       s.now().Add(s.cfg.TTL),
+	}
+	s.mu.Unlock()
+	writeJSON(w, &EnrollResponse{DeviceID: id, Challenge: ch})
+}
+
+// completeEnrollment enrolls the device id if activation holds the secret of
+// its credential challenge.
+func (s *Server) completeEnrollment(w http.ResponseWriter, id string, activation *attestation.ActivationResult) {
+	s.mu.Lock()
+	e, ok := s.pending[id]
+	delete(s.pending, id)
+	s.mu.Unlock()
+	if !ok || !s.now().Before(e.expires) {
+		writeError(w, http.StatusForbidden, ErrNoEnrollment)
+		return
+	}
+	if subtle.ConstantTimeCompare(activation.Secret, e.secret) != 1 {
+		writeError(w, http.StatusForbidden, attestation.ErrActivationFailed)
+		return
+	}
+	if e.ekFingerprint != "" {
+		if err := s.cfg.Enrollments.AddAK(e.ekFingerprint, e.akPublic); err != nil {
+			writeEnrollmentError(w, err)
+			return
+		}
+	}
+	if err := s.cfg.Store.Save(&Device{
+		ID:            id,
+		EKPublic:      e.ekPublic,
+		AKPublic:      e.akPublic,
+		EKFingerprint: e.ekFingerprint,
+		EnrolledAt:    s.now(),
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to save device: %w", err))
+		return
+	}
+	writeJSON(w, &EnrollResponse{DeviceID: id})
+}
+
+func (s *Server) challenge(w http.ResponseWriter, r *http.Request) {
+	var req ChallengeRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	d, err := s.cfg.Store.Load(req.DeviceID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if err := s.check(d); err != nil {
+		writeEnrollmentError(w, err)
+		return
+	}
+	n, err := s.nonces.Issue(req.DeviceID, nonce.Policy{Bank: tpmjson.AlgID(s.cfg.Bank), PCRs: s.cfg.PCRs})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, &attestation.QuoteRequest{
+		Nonce: n.Value,
+		Bank:  n.Policy.Bank,
+		PCRs:  n.Policy.PCRs,
+	})
+}
+
+func (s *Server) quote(w http.ResponseWriter, r *http.Request) {
+	var req QuoteRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Quote == nil {
+		writeError(w, http.StatusBadRequest, errors.New("missing quote"))
+		return
+	}
+	d, err := s.cfg.Store.Load(req.DeviceID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if err := s.check(d); err != nil {
+		writeEnrollmentError(w, err)
+		return
+	}
+	ak, err := tpm2.Unmarshal[tpm2.TPMTPublic](d.AKPublic)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("invalid AK of device %s: %w", d.ID, err))
+		return
+	}
+	if _, err := s.nonces.Verify(d.ID, ak, req.Quote); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	writeJSON(w, &QuoteResponse{DeviceID: d.ID, Values: req.Quote.Values})
+}
+
+// allowed returns the fingerprint of the EK certificate der if it certifies
+// ek, chains up to the EK roots if any, and its device is allow-listed and
+// not revoked.
+func (s *Server) allowed(der []byte, ek *tpm2.TPMTPublic) (string, error) {
+	if der == nil {
+		return "", fmt.Errorf("%w: missing EK certificate", enrollment.ErrUnknownDevice)
+	}
+	cert, err := ekcert.Parse(der)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errUntrustedEK, err)
+	}
+	if err := ekcert.VerifyPublic(cert, *ek); err != nil {
+		return "", fmt.Errorf("%w: %v", errUntrustedEK, err)
+	}
+	if s.cfg.EKRoots != nil {
+		if _, err := ekcert.VerifyChain(cert, s.cfg.EKRoots, nil); err != nil {
+			return "", fmt.Errorf("%w: %v", errUntrustedEK, err)
+		}
+	}
+	fingerprint := enrollment.Fingerprint(cert)
+	device, err := s.cfg.Enrollments.Get(fingerprint)
+	if err != nil {
+		return "", err
+	}
+	if err := device.Check(); err != nil {
+		return "", err
+	}
+	return fingerprint, nil
+}
+
+// check returns an error if the allow-list doesn't allow d to be attested
+// anymore: its device was revoked, or reinstated since it enrolled d.
+func (s *Server) check(d *Device) error {
+	if s.cfg.Enrollments == nil {
+		return nil
+	}
+	if d.EKFingerprint == "" {
+		return fmt.Errorf("%w: enrolled without EK certificate", enrollment.ErrUnknownDevice)
+	}
+	device, err := s.cfg.Enrollments.Get(d.EKFingerprint)
+	if err != nil {
+		return err
+	}
+	if err := device.Check(); err != nil {
+		return err
+	}
+	if !device.HasAK(d.AKPublic) {
+		return fmt.Errorf("%w: AK isn't enrolled", enrollment.ErrUnknownDevice)
+	}
+	return nil
+}
+
+// purge forgets the expired enrollments. s.mu must be held.
+func (s *Server) purge() {
+	now := s.now()
+	for id, e := range s.pending {
+		if !now.Before(e.expires) {
+			delete(s.pending, id)
+		}
+	}
+}
+
+// deviceID returns the ID of the device of ek: the hex encoded Name of ek.
+func deviceID(ek *tpm2.TPMTPublic) (string, error) {
+	name, err := names.Compute(*ek)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute EK name: %w", err)
+	}
+	return hex.EncodeToString(name.Buffer), nil
+}
+
+// validID reports whether id is shaped like the IDs returned by deviceID: a
+// hash algorithm and a digest of at most 64 bytes, in lowercase hex.
+func validID(id string) bool {
+	if len(id) < 4 || len(id) > 2*(2+64) {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func random() ([]byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate random: %w", err)
+	}
+	return b, nil
+}
+
+// decode decodes the JSON body of r into v, or answers an error and returns
+// false.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) //nolint:errcheck
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&errorResponse{Error: err.Error()}) //nolint:errcheck
+}
+
+// writeEnrollmentError answers the errors of the allow-list checks.
+func writeEnrollmentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, enrollment.ErrUnknownDevice) || errors.Is(err, enrollment.ErrRevoked) || errors.Is(err, errUntrustedEK) {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrUnknownDevice) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
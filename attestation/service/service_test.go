@@ -0,0 +1,287 @@
+package service_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/attestation/enrollment"
+	"github.com/loicsikidi/tpm-stuff/attestation/service"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+	"github.com/stretchr/testify/require"
+)
+
+// newAttester returns an attester on a fresh simulator.
+func newAttester(t *testing.T) *attestation.Attester {
+	attester, err := attestation.NewAttester(testutil.OpenSimulator(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, attester.Close()) })
+	return attester
+}
+
+// startServer serves a verifier configured with cfg and returns its URL.
+func startServer(t *testing.T, cfg service.Config) string {
+	srv, err := service.New(cfg)
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// recorder is an attester keeping its last quote.
+type recorder struct {
+	service.Attester
+	quote *attestation.QuoteResult
+}
+
+func (r *recorder) Quote(req *attestation.QuoteRequest) (*attestation.QuoteResult, error) {
+	q, err := r.Attester.Quote(req)
+	r.quote = q
+	return q, err
+}
+
+// wrongSecret is an attester failing credential activation.
+type wrongSecret struct {
+	service.Attester
+}
+
+func (wrongSecret) ActivateCredential(*attestation.CredentialChallenge) (*attestation.ActivationResult, error) {
+	return &attestation.ActivationResult{Secret: make([]byte, 32)}, nil
+}
+
+func TestEnrollAndAttest(t *testing.T) {
+	attester := newAttester(t)
+	fileStore, err := service.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	for name, store := range map[string]service.Store{
+		"memory": service.NewMemoryStore(),
+		"file":   fileStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := service.NewClient(startServer(t, service.Config{Store: store, PCRs: []uint{7, 0}}), nil)
+
+			id, err := client.Enroll(attester)
+			require.NoError(t, err)
+			device, err := store.Load(id)
+			require.NoError(t, err)
+			params, err := attester.Params()
+			require.NoError(t, err)
+			require.Equal(t, params.EKPublic, device.EKPublic)
+			require.Equal(t, params.AKPublic, device.AKPublic)
+
+			values, err := client.Attest(attester, id)
+			require.NoError(t, err)
+			require.Len(t, values, 2)
+			require.Equal(t, uint(0), values[0].Index)
+			require.Equal(t, uint(7), values[1].Index)
+		})
+	}
+}
+
+func TestQuote_Replay(t *testing.T) {
+	url := startServer(t, service.Config{})
+	client := service.NewClient(url, nil)
+	attester := &recorder{Attester: newAttester(t)}
+
+	id, err := client.Enroll(attester)
+	require.NoError(t, err)
+	_, err = client.Attest(attester, id)
+	require.NoError(t, err)
+
+	body, err := json.Marshal(&service.QuoteRequest{DeviceID: id, Quote: attester.quote})
+	require.NoError(t, err)
+	rsp, err := http.Post(url+"/quote", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusForbidden, rsp.StatusCode)
+}
+
+func TestErrors(t *testing.T) {
+	attester := newAttester(t)
+
+	t.Run("wrong secret", func(t *testing.T) {
+		client := service.NewClient(startServer(t, service.Config{}), nil)
+		_, err := client.Enroll(wrongSecret{attester})
+		require.ErrorContains(t, err, attestation.ErrActivationFailed.Error())
+	})
+
+	t.Run("expired enrollment", func(t *testing.T) {
+		client := service.NewClient(startServer(t, service.Config{TTL: time.Nanosecond}), nil)
+		_, err := client.Enroll(attester)
+		require.ErrorContains(t, err, service.ErrNoEnrollment.Error())
+	})
+
+	t.Run("unknown device", func(t *testing.T) {
+		client := service.NewClient(startServer(t, service.Config{}), nil)
+		_, err := client.Attest(attester, "000b00")
+		require.ErrorContains(t, err, service.ErrUnknownDevice.Error())
+	})
+
+	t.Run("no challenge", func(t *testing.T) {
+		url := startServer(t, service.Config{})
+		id, err := service.NewClient(url, nil).Enroll(attester)
+		require.NoError(t, err)
+
+		q, err := attester.Quote(&attestation.QuoteRequest{
+			Nonce: []byte("guessed"),
+			Bank:  tpmjson.AlgID(tpm2.TPMAlgSHA256),
+			PCRs:  []uint{0, 1, 2, 3, 4, 5, 6, 7},
+		})
+		require.NoError(t, err)
+		body, err := json.Marshal(&service.QuoteRequest{DeviceID: id, Quote: q})
+		require.NoError(t, err)
+		rsp, err := http.Post(url+"/quote", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+		require.Equal(t, http.StatusForbidden, rsp.StatusCode)
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := service.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	device := &service.Device{ID: "000b0102", EKPublic: []byte{1}, AKPublic: []byte{2}, EnrolledAt: time.Unix(1, 0).UTC()}
+	require.NoError(t, store.Save(device))
+	got, err := store.Load(device.ID)
+	require.NoError(t, err)
+	require.Equal(t, device, got)
+
+	for _, id := range []string{"000b0103", "../000b0102", "000B0102", ""} {
+		_, err := store.Load(id)
+		require.ErrorIs(t, err, service.ErrUnknownDevice, id)
+	}
+}
+
+// withEKCert is an attester sending an EK certificate.
+type withEKCert struct {
+	service.Attester
+	cert []byte
+}
+
+func (a *withEKCert) Params() (*attestation.Params, error) {
+	params, err := a.Attester.Params()
+	if err != nil {
+		return nil, err
+	}
+	params.EKCertificate = a.cert
+	return params, nil
+}
+
+// issueEKCert returns attester sending an EK certificate issued by a test CA
+// to its EK, along with the CA.
+func issueEKCert(t *testing.T, attester service.Attester) (*withEKCert, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test TPM Manufacturer Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, key.Public(), key)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	params, err := attester.Params()
+	require.NoError(t, err)
+	ek, err := tpm2.Unmarshal[tpm2.TPMTPublic](params.EKPublic)
+	require.NoError(t, err)
+	ekKey, err := tpmcrypto.PublicKey(ek)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment,
+	}, ca, ekKey, key)
+	require.NoError(t, err)
+	return &withEKCert{Attester: attester, cert: der}, ca
+}
+
+func TestAllowList(t *testing.T) {
+	attester, ca := issueEKCert(t, newAttester(t))
+	cert, err := x509.ParseCertificate(attester.cert)
+	require.NoError(t, err)
+	fingerprint := enrollment.Fingerprint(cert)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	t.Run("allowed", func(t *testing.T) {
+		db := enrollment.NewMemoryDB()
+		require.NoError(t, db.Allow(fingerprint, "host-1"))
+		store := service.NewMemoryStore()
+		client := service.NewClient(startServer(t, service.Config{Store: store, Enrollments: db, EKRoots: roots}), nil)
+
+		id, err := client.Enroll(attester)
+		require.NoError(t, err)
+		device, err := store.Load(id)
+		require.NoError(t, err)
+		require.Equal(t, fingerprint, device.EKFingerprint)
+		got, err := db.Get(fingerprint)
+		require.NoError(t, err)
+		require.True(t, got.HasAK(device.AKPublic))
+
+		_, err = client.Attest(attester, id)
+		require.NoError(t, err)
+
+		// Revoked devices can't be attested anymore, nor enroll again.
+		require.NoError(t, db.Revoke(fingerprint))
+		_, err = client.Attest(attester, id)
+		require.ErrorContains(t, err, enrollment.ErrRevoked.Error())
+		_, err = client.Enroll(attester)
+		require.ErrorContains(t, err, enrollment.ErrRevoked.Error())
+
+		// Reinstated devices must enroll their AK again.
+		require.NoError(t, db.Allow(fingerprint, "host-1"))
+		_, err = client.Attest(attester, id)
+		require.ErrorContains(t, err, enrollment.ErrUnknownDevice.Error())
+		id, err = client.Enroll(attester)
+		require.NoError(t, err)
+		_, err = client.Attest(attester, id)
+		require.NoError(t, err)
+	})
+
+	for name, tc := range map[string]struct {
+		attester service.Attester
+		roots    *x509.CertPool
+		err      string
+	}{
+		"not allow-listed": {attester: attester, err: enrollment.ErrUnknownDevice.Error()},
+		"no certificate":   {attester: attester.Attester, err: enrollment.ErrUnknownDevice.Error()},
+		"untrusted root":   {attester: attester, roots: x509.NewCertPool(), err: "untrusted EK certificate"},
+		"other EK": {
+			attester: &withEKCert{Attester: newAttester(t), cert: attester.cert},
+			err:      ekcert.ErrKeyMismatch.Error(),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			db := enrollment.NewMemoryDB()
+			if name != "not allow-listed" {
+				require.NoError(t, db.Allow(fingerprint, "host-1"))
+			}
+			client := service.NewClient(startServer(t, service.Config{Enrollments: db, EKRoots: tc.roots}), nil)
+			_, err := client.Enroll(tc.attester)
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
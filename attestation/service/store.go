@@ -0,0 +1,142 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrUnknownDevice is returned by [Store.Load] for devices which aren't
+// enrolled.
+var ErrUnknownDevice = errors.New("unknown device")
+
+// Device is an enrolled device: its EK, and the AK proven to reside in the
+// same TPM by credential activation.
+type Device struct {
+	// ID identifies the device: the hex encoded Name of its EK.
+	ID string `json:"id"`
+	// EKPublic is the marshaled TPMT_PUBLIC of the Endorsement Key.
+	EKPublic []byte `json:"ek_public"`
+	// AKPublic is the marshaled TPMT_PUBLIC of the Attestation Key.
+	AKPublic []byte `json:"ak_public"`
+	// EKFingerprint is the fingerprint of the EK certificate of the device,
+	// when the service checks an allow-list (see [Config.Enrollments]).
+	EKFingerprint string `json:"ek_fingerprint,omitempty"`
+	// EnrolledAt is the time of the enrollment.
+	EnrolledAt time.Time `json:"enrolled_at"`
+}
+
+// Store persists the enrolled devices. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Save stores d, replacing the device with the same ID if any.
+	Save(d *Device) error
+	// Load returns the device id, or [ErrUnknownDevice].
+	Load(id string) (*Device, error)
+}
+
+// MemoryStore is a [Store] keeping the devices in memory: they are lost when
+// the service restarts.
+type MemoryStore struct {
+	mu      sync.Mutex
+	devices map[string]Device
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{devices: make(map[string]Device)}
+}
+
+// Save implements [Store].
+func (s *MemoryStore) Save(d *Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices[d.ID] = *d
+	return nil
+}
+
+// Load implements [Store].
+func (s *MemoryStore) Load(id string) (*Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[id]
+	if !ok {
+		return nil, ErrUnknownDevice
+	}
+	return &d, nil
+}
+
+// FileStore is a [Store] keeping each device in a JSON file named after its
+// ID in a directory.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore returns a FileStore using dir, created if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Save implements [Store]. The file is replaced atomically.
+func (s *FileStore) Save(d *Device) error {
+	path, err := s.path(d.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write device: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write device: %w", err)
+	}
+	return nil
+}
+
+// Load implements [Store].
+func (s *FileStore) Load(id string) (*Device, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	data, err := os.ReadFile(path)
+	s.mu.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUnknownDevice
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device: %w", err)
+	}
+	var d Device
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("failed to decode device %s: %w", id, err)
+	}
+	return &d, nil
+}
+
+// path returns the file of the device id, which comes from the requests:
+// only IDs shaped like the ones the service assigns are accepted.
+func (s *FileStore) path(id string) (string, error) {
+	if !validID(id) {
+		return "", ErrUnknownDevice
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
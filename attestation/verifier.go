@@ -0,0 +1,262 @@
+package attestation
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/credential"
+	"github.com/loicsikidi/tpm-stuff/names"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+)
+
+var (
+	// ErrActivationFailed is returned when the attester does not return the
+	// secret embedded in the credential challenge.
+	ErrActivationFailed = errors.New("credential activation failed")
+	// ErrInvalidAK is returned when the AK does not have the attributes of an attestation key.
+	ErrInvalidAK = errors.New("invalid attestation key")
+	// ErrQuoteMismatch is returned when the quote does not match the expected nonce or PCR values.
+	ErrQuoteMismatch = errors.New("quote does not match")
+)
+
+// Client sends verifier requests to an attester over conn.
+type Client struct {
+	enc *json.Encoder
+	dec *json.Decoder
+}
+
+// NewClient returns a Client using conn (typically a TCP connection).
+func NewClient(conn io.ReadWriter) *Client {
+	return &Client{
+		enc: json.NewEncoder(conn),
+		dec: json.NewDecoder(bufio.NewReader(conn)),
+	}
+}
+
+func (c *Client) roundTrip(req *Request) (*Response, error) {
+	if err := c.enc.Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send %s request: %w", req.Type, err)
+	}
+	var rsp Response
+	if err := c.dec.Decode(&rsp); err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", req.Type, err)
+	}
+	if rsp.Error != "" {
+		return nil, fmt.Errorf("attester failed %s request: %s", req.Type, rsp.Error)
+	}
+	return &rsp, nil
+}
+
+// Params requests the attestation parameters.
+func (c *Client) Params() (*Params, error) {
+	rsp, err := c.roundTrip(&Request{Type: MessageParams})
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Params == nil {
+		return nil, errors.New("empty params response")
+	}
+	return rsp.Params, nil
+}
+
+// Activate sends a credential challenge and returns the recovered secret.
+func (c *Client) Activate(ch *CredentialChallenge) (*ActivationResult, error) {
+	rsp, err := c.roundTrip(&Request{Type: MessageActivate, Challenge: ch})
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Activation == nil {
+		return nil, errors.New("empty activation response")
+	}
+	return rsp.Activation, nil
+}
+
+// Quote requests a quote.
+func (c *Client) Quote(req *QuoteRequest) (*QuoteResult, error) {
+	rsp, err := c.roundTrip(&Request{Type: MessageQuote, Quote: req})
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Quote == nil {
+		return nil, errors.New("empty quote response")
+	}
+	return rsp.Quote, nil
+}
+
+// ParseParams decodes the EK and AK public areas and checks that the AK is a
+// restricted signing key whose Name matches its public area.
+func ParseParams(p *Params) (ek, ak *tpm2.TPMTPublic, err error) {
+	ek, err = tpm2.Unmarshal[tpm2.TPMTPublic](p.EKPublic)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse EK public: %w", err)
+	}
+	ak, err = tpm2.Unmarshal[tpm2.TPMTPublic](p.AKPublic)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse AK public: %w", err)
+	}
+
+	attrs := ak.ObjectAttributes
+	if !attrs.Restricted || !attrs.SignEncrypt || attrs.Decrypt || !attrs.FixedTPM || !attrs.FixedParent || !attrs.SensitiveDataOrigin {
+		return nil, nil, fmt.Errorf("%w: must be a restricted signing key bound to the TPM", ErrInvalidAK)
+	}
+	if err := tpmcrypto.ValidatePublicKey(*ak); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidAK, err)
+	}
+	if err := names.Verify(p.AKName, *ak); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidAK, err)
+	}
+	return ek, ak, nil
+}
+
+// NewCredentialChallenge encrypts secret to the EK so that it can only be
+// recovered by a TPM where an object named akName is loaded.
+// This is the software equivalent of TPM2_MakeCredential.
+func NewCredentialChallenge(ekPub *tpm2.TPMTPublic, akName []byte, secret []byte) (*CredentialChallenge, error) {
+	ch, err := credential.Make(ekPub, akName, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &CredentialChallenge{
+		CredentialBlob:  ch.CredentialBlob,
+		EncryptedSecret: ch.EncryptedSecret,
+	}, nil
+}
+
+// VerifyQuote checks that q is signed by akPub, carries nonce and covers
+// exactly the PCR values it reports.
+func VerifyQuote(akPub *tpm2.TPMTPublic, nonce []byte, q *QuoteResult) error {
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](q.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to parse signature: %w", err)
+	}
+	if err := tpmcrypto.VerifySignatureFromPublic(*akPub, *sig, q.Quoted); err != nil {
+		return fmt.Errorf("invalid quote signature: %w", err)
+	}
+
+	attest, err := tpm2.Unmarshal[tpm2.TPMSAttest](q.Quoted)
+	if err != nil {
+		return fmt.Errorf("failed to parse quote: %w", err)
+	}
+	if attest.Magic != tpm2.TPMGeneratedValue || attest.Type != tpm2.TPMSTAttestQuote {
+		return fmt.Errorf("%w: not a TPM generated quote", ErrQuoteMismatch)
+	}
+	if subtle.ConstantTimeCompare(attest.ExtraData.Buffer, nonce) != 1 {
+		return fmt.Errorf("%w: nonce", ErrQuoteMismatch)
+	}
+	info, err := attest.Attested.Quote()
+	if err != nil {
+		return fmt.Errorf("failed to parse quote info: %w", err)
+	}
+
+	var quoted []uint
+	for _, s := range info.PCRSelect.PCRSelections {
+		if s.Hash != tpm2.TPMAlgID(q.Bank) {
+			return fmt.Errorf("%w: unexpected PCR bank %v", ErrQuoteMismatch, s.Hash)
+		}
+		quoted = append(quoted, tpmutil.PCRSelectToPCRs(s.PCRSelect)...)
+	}
+	var reported []uint
+	for _, v := range q.Values {
+		reported = append(reported, v.Index)
+	}
+	if !slices.Equal(quoted, reported) {
+		return fmt.Errorf("%w: quoted PCRs %v, reported PCRs %v", ErrQuoteMismatch, quoted, reported)
+	}
+
+	hash, err := tpmcrypto.GetSigHashFromPublic(*akPub)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	for _, v := range q.Values {
+		h.Write(v.Digest)
+	}
+	if !bytes.Equal(h.Sum(nil), info.PCRDigest.Buffer) {
+		return fmt.Errorf("%w: PCR digest", ErrQuoteMismatch)
+	}
+	return nil
+}
+
+// Result is the outcome of a successful [Verify].
+type Result struct {
+	EKPublic *tpm2.TPMTPublic
+	AKPublic *tpm2.TPMTPublic
+	Quote    *QuoteResult
+}
+
+// Verify runs the complete verifier side of the protocol:
+// it checks the AK, proves it lives in the same TPM as the EK via credential
+// activation, then requests and validates a quote over pcrs with a fresh nonce.
+//
+// Note: the EK public is trusted as-is; checking it against the EK certificate
+// is left to the caller.
+func Verify(c *Client, bank tpm2.TPMAlgID, pcrs []uint) (*Result, error) {
+	params, err := c.Params()
+	if err != nil {
+		return nil, err
+	}
+	ek, ak, err := ParseParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	ch, err := NewCredentialChallenge(ek, params.AKName, secret)
+	if err != nil {
+		return nil, err
+	}
+	activation, err := c.Activate(ch)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(activation.Secret, secret) != 1 {
+		return nil, ErrActivationFailed
+	}
+
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	q, err := c.Quote(&QuoteRequest{Nonce: nonce, Bank: tpmjson.AlgID(bank), PCRs: pcrs})
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyQuote(ak, nonce, q); err != nil {
+		return nil, err
+	}
+	if err := checkSelection(q, bank, pcrs); err != nil {
+		return nil, err
+	}
+	return &Result{EKPublic: ek, AKPublic: ak, Quote: q}, nil
+}
+
+// checkSelection checks that q covers exactly the pcrs of bank, as requested
+// from the attester. It must follow [VerifyQuote], which checks that the bank
+// and PCRs reported by q are those signed.
+func checkSelection(q *QuoteResult, bank tpm2.TPMAlgID, pcrs []uint) error {
+	if tpm2.TPMAlgID(q.Bank) != bank {
+		return fmt.Errorf("%w: quoted PCR bank %v, requested %v", ErrQuoteMismatch, tpm2.TPMAlgID(q.Bank), bank)
+	}
+	quoted := make([]uint, 0, len(q.Values))
+	for _, v := range q.Values {
+		quoted = append(quoted, v.Index)
+	}
+	requested := slices.Compact(slices.Sorted(slices.Values(pcrs)))
+	if !slices.Equal(quoted, requested) {
+		return fmt.Errorf("%w: quoted PCRs %v, requested PCRs %v", ErrQuoteMismatch, quoted, requested)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// Package audit drives the command audit of the TPM: the TPM extends an
+// audit digest with the parameters of every successful command whose code is
+// selected for audit (TPM2_SetCommandCodeAuditStatus), and signs it on
+// request (TPM2_GetCommandAuditDigest).
+//
+// Comparing the signed digest with the one computed from a log of the
+// commands sent (see [Recorder]) proves that exactly these commands, with
+// these parameters and in this order, were executed by the TPM: e.g. that
+// nobody changed a hierarchy password or defined an NV index behind the back
+// of the administration tool.
+//
+// go-tpm implements neither command, so both are marshaled by this package
+// and authorized with password sessions.
+package audit
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+)
+
+// ErrDigestMismatch is returned by [Verify] when the signed audit does not
+// match the expected command history.
+var ErrDigestMismatch = errors.New("audit digest mismatch")
+
+// Config holds configuration for [Enable] and [Disable].
+type Config struct {
+	// Hash is the audit digest algorithm. Changing it clears the audit
+	// digest.
+	//
+	// Default: tpm2.TPMAlgSHA256.
+	Hash tpm2.TPMIAlgHash
+	// OwnerAuth authorizes the owner hierarchy.
+	//
+	// Default: empty password.
+	OwnerAuth []byte
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	if c.Hash == 0 {
+		c.Hash = tpm2.TPMAlgSHA256
+	}
+	if _, err := c.Hash.Hash(); err != nil {
+		return fmt.Errorf("unsupported audit hash: %w", err)
+	}
+	return nil
+}
+
+// Enable selects ccs for audit, using the hash of cfg.
+//
+// Note: TPM2_SetCommandCodeAuditStatus is always audited by the TPM, so
+// enabling the audit extends the digest. Call [Digest] afterwards to start
+// from a clean audit digest.
+//
+// Example:
+//
+//	err := audit.Enable(tpm, []tpm2.TPMCC{tpm2.TPMCCNVDefineSpace, tpm2.TPMCCHierarchyChangeAuth})
+func Enable(tpm transport.TPM, ccs []tpm2.TPMCC, optionalCfg ...Config) error {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	// The algorithm and the command list can't change in the same command.
+	if err := setCommandCodeAuditStatus(tpm, cfg.OwnerAuth, cfg.Hash, nil, nil); err != nil {
+		return fmt.Errorf("failed to set audit hash: %w", err)
+	}
+	if err := setCommandCodeAuditStatus(tpm, cfg.OwnerAuth, tpm2.TPMAlgNull, ccs, nil); err != nil {
+		return fmt.Errorf("failed to enable command audit: %w", err)
+	}
+	return nil
+}
+
+// Disable removes ccs from the audited commands. The Hash of cfg is unused.
+func Disable(tpm transport.TPM, ccs []tpm2.TPMCC, optionalCfg ...Config) error {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := setCommandCodeAuditStatus(tpm, cfg.OwnerAuth, tpm2.TPMAlgNull, nil, ccs); err != nil {
+		return fmt.Errorf("failed to disable command audit: %w", err)
+	}
+	return nil
+}
+
+// Attestation is a signed TPMS_ATTEST of type TPM_ST_ATTEST_COMMAND_AUDIT.
+type Attestation struct {
+	// Attest is the marshaled TPMS_ATTEST.
+	Attest []byte `json:"attest"`
+	// Signature is the marshaled TPMT_SIGNATURE over Attest.
+	Signature []byte `json:"signature"`
+}
+
+// DigestConfig holds configuration for [Digest].
+type DigestConfig struct {
+	// EndorsementAuth authorizes the endorsement hierarchy, the privacy
+	// administrator of the audit.
+	//
+	// Default: empty password.
+	EndorsementAuth []byte
+	// SignerAuth authorizes the signing key.
+	//
+	// Default: empty password.
+	SignerAuth []byte
+}
+
+// CheckAndSetDefault validates and sets default values for DigestConfig.
+func (c *DigestConfig) CheckAndSetDefault() error {
+	return nil
+}
+
+// Digest returns the audit digest and the digest of the audited command
+// codes, signed by signer along with nonce. The TPM then clears its audit
+// digest: the next audited command starts a new one and increments the audit
+// counter.
+//
+// signer must be a signing key using its own scheme, e.g. an AK
+// (attestation.AKTemplate).
+func Digest(tpm transport.TPM, signer tpmutil.Handle, nonce []byte, optionalCfg ...DigestConfig) (*Attestation, error) {
+	var cfg DigestConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if signer == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+
+	var params []byte
+	params = binary.BigEndian.AppendUint16(params, uint16(len(nonce)))
+	params = append(params, nonce...)
+	params = binary.BigEndian.AppendUint16(params, uint16(tpm2.TPMAlgNull)) // inScheme
+	rsp, err := execute(tpm, tpm2.TPMCCGetCommandAuditDigest,
+		[]tpm2.TPMHandle{tpm2.TPMRHEndorsement, signer.Handle()},
+		[][]byte{cfg.EndorsementAuth, cfg.SignerAuth}, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command audit digest: %w", err)
+	}
+
+	// TPM2B_ATTEST followed by TPMT_SIGNATURE.
+	if len(rsp) < 2 || len(rsp) < 2+int(binary.BigEndian.Uint16(rsp)) {
+		return nil, fmt.Errorf("failed to get command audit digest: short response")
+	}
+	n := 2 + int(binary.BigEndian.Uint16(rsp))
+	return &Attestation{
+		Attest:    bytes.Clone(rsp[2:n]),
+		Signature: bytes.Clone(rsp[n:]),
+	}, nil
+}
+
+// Verify checks that a is signed by signerPub, carries nonce and reports the
+// audit digest and audited commands of log. It returns the verified audit
+// information, whose AuditCounter tells apart the successive audit digests.
+func Verify(signerPub *tpm2.TPMTPublic, nonce []byte, a *Attestation, log *Log) (*tpm2.TPMSCommandAuditInfo, error) {
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](a.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %w", err)
+	}
+	if err := tpmcrypto.VerifySignatureFromPublic(*signerPub, *sig, a.Attest); err != nil {
+		return nil, fmt.Errorf("invalid audit signature: %w", err)
+	}
+	attest, err := tpm2.Unmarshal[tpm2.TPMSAttest](a.Attest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attestation: %w", err)
+	}
+	if attest.Magic != tpm2.TPMGeneratedValue || attest.Type != tpm2.TPMSTAttestCommandAudit {
+		return nil, fmt.Errorf("%w: not a TPM generated command audit", ErrDigestMismatch)
+	}
+	if subtle.ConstantTimeCompare(attest.ExtraData.Buffer, nonce) != 1 {
+		return nil, fmt.Errorf("%w: nonce", ErrDigestMismatch)
+	}
+	info, err := attest.Attested.CommandAudit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse command audit info: %w", err)
+	}
+
+	if info.DigestAlg != tpm2.TPMAlgID(log.Hash) {
+		return nil, fmt.Errorf("%w: audit hash 0x%x, expected 0x%x", ErrDigestMismatch, info.DigestAlg, log.Hash)
+	}
+	commandDigest, err := log.CommandDigest()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(info.CommandDigest.Buffer, commandDigest) {
+		return nil, fmt.Errorf("%w: audited command codes", ErrDigestMismatch)
+	}
+	if !bytes.Equal(info.AuditDigest.Buffer, log.Digest) {
+		return nil, fmt.Errorf("%w: audit digest %x, expected %x", ErrDigestMismatch, info.AuditDigest.Buffer, log.Digest)
+	}
+	return info, nil
+}
+
+// setCommandCodeAuditStatus runs TPM2_SetCommandCodeAuditStatus, authorized
+// by the owner hierarchy.
+func setCommandCodeAuditStatus(tpm transport.TPM, ownerAuth []byte, alg tpm2.TPMIAlgHash, setList, clearList []tpm2.TPMCC) error {
+	var params []byte
+	params = binary.BigEndian.AppendUint16(params, uint16(alg))
+	for _, list := range [][]tpm2.TPMCC{setList, clearList} {
+		params = binary.BigEndian.AppendUint32(params, uint32(len(list)))
+		for _, cc := range list {
+			params = binary.BigEndian.AppendUint32(params, uint32(cc))
+		}
+	}
+	_, err := execute(tpm, tpm2.TPMCCSetCommandCodeAuditStatus,
+		[]tpm2.TPMHandle{tpm2.TPMRHOwner}, [][]byte{ownerAuth}, params)
+	return err
+}
+
+// execute sends a command whose handles are all authorized by password
+// sessions, one per handle, and returns the response parameters.
+func execute(tpm transport.TPM, cc tpm2.TPMCC, handles []tpm2.TPMHandle, auths [][]byte, params []byte) ([]byte, error) {
+	var authArea []byte
+	for _, auth := range auths {
+		// TPMS_AUTH_COMMAND of a password session.
+		authArea = binary.BigEndian.AppendUint32(authArea, uint32(tpm2.TPMRSPW))
+		authArea = binary.BigEndian.AppendUint16(authArea, 0) // nonceCaller
+		authArea = append(authArea, 0)                        // sessionAttributes
+		authArea = binary.BigEndian.AppendUint16(authArea, uint16(len(auth)))
+		authArea = append(authArea, auth...)
+	}
+
+	var body []byte
+	for _, h := range handles {
+		body = binary.BigEndian.AppendUint32(body, uint32(h))
+	}
+	body = binary.BigEndian.AppendUint32(body, uint32(len(authArea)))
+	body = append(body, authArea...)
+	body = append(body, params...)
+
+	var cmd []byte
+	cmd = binary.BigEndian.AppendUint16(cmd, uint16(tpm2.TPMSTSessions))
+	cmd = binary.BigEndian.AppendUint32(cmd, uint32(10+len(body)))
+	cmd = binary.BigEndian.AppendUint32(cmd, uint32(cc))
+	cmd = append(cmd, body...)
+
+	rsp, err := tpm.Send(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(rsp) < 10 {
+		return nil, fmt.Errorf("short response (%d bytes)", len(rsp))
+	}
+	if rc := tpm2.TPMRC(binary.BigEndian.Uint32(rsp[6:10])); rc != tpm2.TPMRCSuccess {
+		return nil, rc
+	}
+	// Response with sessions: parameterSize, then the parameters.
+	if len(rsp) < 14 || len(rsp) < 14+int(binary.BigEndian.Uint32(rsp[10:14])) {
+		return nil, fmt.Errorf("short response (%d bytes)", len(rsp))
+	}
+	return rsp[14 : 14+int(binary.BigEndian.Uint32(rsp[10:14]))], nil
+}
+
+// auditedCodes returns the command codes audited by the TPM once ccs are
+// selected, in ascending order: TPM2_SetCommandCodeAuditStatus is always
+// audited.
+func auditedCodes(ccs []tpm2.TPMCC) []tpm2.TPMCC {
+	codes := append(slices.Clone(ccs), tpm2.TPMCCSetCommandCodeAuditStatus)
+	slices.Sort(codes)
+	return slices.Compact(codes)
+}
@@ -0,0 +1,93 @@
+package audit_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/audit"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandAudit(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	ak, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: attestation.AKTemplate})
+	require.NoError(t, err)
+	defer ak.Close()
+
+	ccs := []tpm2.TPMCC{tpm2.TPMCCNVDefineSpace, tpm2.TPMCCNVWrite}
+	require.NoError(t, audit.Enable(thetpm, ccs))
+	// Start from a clean audit digest.
+	_, err = audit.Digest(thetpm, ak, nil)
+	require.NoError(t, err)
+
+	rec := audit.NewRecorder(thetpm, tpm2.TPMAlgSHA256, ccs)
+	att, err := audit.Digest(thetpm, ak, nil)
+	require.NoError(t, err)
+	_, err = audit.Verify(ak.Public(), nil, att, rec.Log())
+	require.NoError(t, err, "nothing audited yet")
+	index := tpm2.TPMHandle(0x01500200)
+	def := tpm2.NVDefineSpace{
+		AuthHandle: tpm2.TPMRHOwner,
+		PublicInfo: tpm2.New2B(tpm2.TPMSNVPublic{
+			NVIndex: index,
+			NameAlg: tpm2.TPMAlgSHA256,
+			Attributes: tpm2.TPMANV{
+				OwnerWrite: true,
+				OwnerRead:  true,
+				NT:         tpm2.TPMNTOrdinary,
+			},
+			DataSize: 8,
+		}),
+	}
+	_, err = def.Execute(rec)
+	require.NoError(t, err)
+	defer tpm2.NVUndefineSpace{AuthHandle: tpm2.TPMRHOwner, NVIndex: tpm2.NamedHandle{Handle: index}}.Execute(thetpm) //nolint:errcheck
+	// Commands which aren't audited don't change the digest.
+	_, err = tpm2.GetRandom{BytesRequested: 8}.Execute(rec)
+	require.NoError(t, err)
+	pub, err := tpm2.NVReadPublic{NVIndex: index}.Execute(thetpm)
+	require.NoError(t, err)
+	_, err = tpm2.NVWrite{
+		AuthHandle: tpm2.TPMRHOwner,
+		NVIndex:    tpm2.NamedHandle{Handle: index, Name: pub.NVName},
+		Data:       tpm2.TPM2BMaxNVBuffer{Buffer: []byte("config")},
+	}.Execute(rec)
+	require.NoError(t, err)
+	// Failed commands aren't audited either.
+	_, err = def.Execute(rec)
+	require.ErrorIs(t, err, tpm2.TPMRCNVDefined)
+
+	log := rec.Log()
+	require.Equal(t, []tpm2.TPMCC{tpm2.TPMCCNVDefineSpace, tpm2.TPMCCNVWrite}, log.Commands)
+
+	nonce := []byte("verifier nonce")
+	att, err = audit.Digest(thetpm, ak, nonce)
+	require.NoError(t, err)
+	info, err := audit.Verify(ak.Public(), nonce, att, log)
+	require.NoError(t, err)
+
+	// A command sent behind the back of the recorder shows up.
+	_, err = audit.Digest(thetpm, ak, nil)
+	require.NoError(t, err)
+	rec.Reset()
+	_, err = tpm2.NVWrite{
+		AuthHandle: tpm2.TPMRHOwner,
+		NVIndex:    tpm2.NamedHandle{Handle: index, Name: pub.NVName},
+		Data:       tpm2.TPM2BMaxNVBuffer{Buffer: []byte("evil")},
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	att, err = audit.Digest(thetpm, ak, nonce)
+	require.NoError(t, err)
+	_, err = audit.Verify(ak.Public(), nonce, att, rec.Log())
+	require.ErrorIs(t, err, audit.ErrDigestMismatch)
+
+	_, err = audit.Verify(ak.Public(), []byte("other nonce"), att, rec.Log())
+	require.ErrorIs(t, err, audit.ErrDigestMismatch)
+	require.NotZero(t, info.AuditCounter)
+
+	require.NoError(t, audit.Disable(thetpm, ccs))
+}
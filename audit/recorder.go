@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/decode"
+)
+
+// Log is the command history expected in an audit digest.
+type Log struct {
+	// Hash is the audit digest algorithm.
+	Hash tpm2.TPMIAlgHash
+	// Audited are the command codes selected for audit.
+	Audited []tpm2.TPMCC
+	// Commands are the audited commands executed, in order.
+	Commands []tpm2.TPMCC
+	// Digest is the expected audit digest: H(digest || cpHash || rpHash)
+	// folded over Commands, starting from zeros. It is empty when no command
+	// was audited.
+	Digest []byte
+}
+
+// CommandDigest returns the digest of the audited command codes reported by
+// the TPM: the hash of the codes in ascending order.
+func (l *Log) CommandDigest() ([]byte, error) {
+	ha, err := l.Hash.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported audit hash: %w", err)
+	}
+	h := ha.New()
+	for _, cc := range auditedCodes(l.Audited) {
+		binary.Write(h, binary.BigEndian, cc) //nolint:errcheck
+	}
+	return h.Sum(nil), nil
+}
+
+// Recorder is a transport computing the audit digest expected from the
+// commands sent through it, to be compared with the one signed by the TPM
+// (see [Verify]). It must see every audited command from the moment the TPM
+// audit digest is cleared by [Digest]. It is safe for concurrent use.
+//
+// The cpHash of a command covers the Names of its handles: the Recorder reads
+// them (TPM2_ReadPublic, TPM2_NV_ReadPublic) before sending the command, so
+// these two commands must not be audited.
+//
+// Example:
+//
+//	if _, err := audit.Digest(tpm, ak, nil); err != nil { // clean digest
+//	    return err
+//	}
+//	rec := audit.NewRecorder(tpm, tpm2.TPMAlgSHA256, ccs)
+//	// ... administrative commands sent to rec ...
+//	att, err := audit.Digest(tpm, ak, nonce)
+//	...
+//	info, err := audit.Verify(akPub, nonce, att, rec.Log())
+type Recorder struct {
+	tpm transport.TPM
+	mu  sync.Mutex
+	log Log
+}
+
+// NewRecorder returns a Recorder of the commands ccs, audited with hash.
+func NewRecorder(tpm transport.TPM, hash tpm2.TPMIAlgHash, ccs []tpm2.TPMCC) *Recorder {
+	return &Recorder{
+		tpm: tpm,
+		log: Log{Hash: hash, Audited: auditedCodes(ccs)},
+	}
+}
+
+// Log returns a copy of the log recorded so far.
+func (r *Recorder) Log() *Log {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Log{
+		Hash:     r.log.Hash,
+		Audited:  slices.Clone(r.log.Audited),
+		Commands: slices.Clone(r.log.Commands),
+		Digest:   slices.Clone(r.log.Digest),
+	}
+}
+
+// Reset clears the log, after the TPM audit digest was cleared by [Digest].
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log.Commands, r.log.Digest = nil, nil
+}
+
+// Send implements transport.TPM.
+func (r *Recorder) Send(cmd []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parsed, err := decode.ParseCommand(cmd)
+	if err != nil || !slices.Contains(r.log.Audited, parsed.CommandCode()) {
+		return r.tpm.Send(cmd)
+	}
+	if _, _, ok := decode.HandleCounts(parsed.CommandCode()); !ok {
+		return nil, fmt.Errorf("can't record %s: unknown handle area", decode.CommandName(parsed.CommandCode()))
+	}
+	cpHash, err := r.cpHash(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute cpHash of %s: %w", decode.CommandName(parsed.CommandCode()), err)
+	}
+	rsp, err := r.tpm.Send(cmd)
+	if err != nil {
+		return nil, err
+	}
+	parsedRsp, err := decode.ParseResponse(parsed.CommandCode(), rsp)
+	if err != nil || parsedRsp.ResponseCode() != tpm2.TPMRCSuccess {
+		return rsp, nil
+	}
+	if err := r.extend(parsed.CommandCode(), cpHash, parsedRsp.Parameters); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// cpHash computes H(commandCode || names || parameters).
+func (r *Recorder) cpHash(cmd *decode.Command) ([]byte, error) {
+	ha, err := r.log.Hash.Hash()
+	if err != nil {
+		return nil, err
+	}
+	h := ha.New()
+	binary.Write(h, binary.BigEndian, cmd.CommandCode()) //nolint:errcheck
+	for _, handle := range cmd.Handles {
+		name, err := r.name(handle)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(name)
+	}
+	h.Write(cmd.Parameters)
+	return h.Sum(nil), nil
+}
+
+// name returns the Name of handle: its public area digest for objects and NV
+// indexes, the handle itself for other entities.
+func (r *Recorder) name(handle tpm2.TPMHandle) ([]byte, error) {
+	switch tpm2.TPMHT(handle >> 24) {
+	case tpm2.TPMHTTransient, tpm2.TPMHTPersistent:
+		rsp, err := tpm2.ReadPublic{ObjectHandle: handle}.Execute(r.tpm)
+		if err != nil {
+			return nil, err
+		}
+		return rsp.Name.Buffer, nil
+	case tpm2.TPMHTNVIndex:
+		rsp, err := tpm2.NVReadPublic{NVIndex: handle}.Execute(r.tpm)
+		if err != nil {
+			return nil, err
+		}
+		return rsp.NVName.Buffer, nil
+	default:
+		return binary.BigEndian.AppendUint32(nil, uint32(handle)), nil
+	}
+}
+
+// extend folds a successful command in the expected audit digest.
+func (r *Recorder) extend(cc tpm2.TPMCC, cpHash, rspParams []byte) error {
+	ha, err := r.log.Hash.Hash()
+	if err != nil {
+		return err
+	}
+	// rpHash = H(responseCode || commandCode || parameters)
+	h := ha.New()
+	binary.Write(h, binary.BigEndian, tpm2.TPMRCSuccess) //nolint:errcheck
+	binary.Write(h, binary.BigEndian, cc)                //nolint:errcheck
+	h.Write(rspParams)
+	rpHash := h.Sum(nil)
+
+	if r.log.Digest == nil {
+		r.log.Digest = make([]byte, ha.Size())
+	}
+	h = ha.New()
+	h.Write(r.log.Digest)
+	h.Write(cpHash)
+	h.Write(rpHash)
+	r.log.Digest = h.Sum(nil)
+	r.log.Commands = append(r.log.Commands, cc)
+	return nil
+}
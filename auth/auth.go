@@ -0,0 +1,157 @@
+// Package auth rotates the authorization values of objects and NV indexes
+// without exposing the new values on the bus.
+package auth
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+)
+
+// RotateObjectAuth replaces the authorization value of the loaded object
+// handle, currently oldAuth, with newAuth, and returns the new private area
+// of the object.
+//
+// TPM2_ObjectChangeAuth doesn't modify the loaded object nor its stored
+// blob: the object must be loaded again from the returned private area, and
+// the old blob, which still works with oldAuth, destroyed. The object must
+// not require a policy for the ADMIN role (adminWithPolicy).
+//
+// The command is authorized with an HMAC session salted with parent, which
+// must be a decryption key such as the SRK, and encrypting newAuth: even an
+// empty oldAuth doesn't expose newAuth.
+//
+// Example:
+//
+//	private, err := auth.RotateObjectAuth(tpm, key, srk, oldAuth, newAuth)
+//	if err != nil {
+//	    return err
+//	}
+//	// Replace the stored blob of key with private, then load it again.
+func RotateObjectAuth(tpm transport.TPM, handle, parent tpmutil.Handle, oldAuth, newAuth []byte) (*tpm2.TPM2BPrivate, error) {
+	if !parent.HasPublic() {
+		return nil, fmt.Errorf("parent 0x%x has no public area", parent.Handle())
+	}
+	rsp, err := tpm2.ObjectChangeAuth{
+		ObjectHandle: tpm2.AuthHandle{
+			Handle: handle.Handle(),
+			Name:   handle.Name(),
+			Auth: tpm2.HMAC(tpm2.TPMAlgSHA256, 16,
+				tpm2.Auth(oldAuth),
+				tpm2.Salted(parent.Handle(), *parent.Public()),
+				tpm2.AESEncryption(128, tpm2.EncryptIn)),
+		},
+		ParentHandle: tpm2.NamedHandle{
+			Handle: parent.Handle(),
+			Name:   parent.Name(),
+		},
+		NewAuth: tpm2.TPM2BAuth{Buffer: newAuth},
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to change object auth: %w", err)
+	}
+	return &rsp.OutPrivate, nil
+}
+
+// NVChangeAuthPolicy returns the policy digest an NV index must be defined
+// with (see [nv.DefineConfig]) for [RotateNVAuth]: TPM2_NV_ChangeAuth
+// requires the ADMIN role, which for an NV index is always given by a policy.
+// The policy is PolicyCommandCode(TPM_CC_NV_ChangeAuth) then PolicyAuthValue:
+// only the holder of the current authorization value may change it.
+func NVChangeAuthPolicy() ([]byte, error) {
+	calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+	if err != nil {
+		return nil, err
+	}
+	if err := (tpm2.PolicyCommandCode{Code: tpm2.TPMCCNVChangeAuth}).Update(calc); err != nil {
+		return nil, err
+	}
+	if err := (tpm2.PolicyAuthValue{}).Update(calc); err != nil {
+		return nil, err
+	}
+	return calc.Hash().Digest, nil
+}
+
+// RotateNVAuth replaces the authorization value of the NV index idx,
+// currently oldAuth, with newAuth. The index must be defined with the policy
+// of [NVChangeAuthPolicy].
+//
+// The command is authorized with a policy session salted with saltKey, a
+// loaded decryption key such as the SRK or the EK, and encrypting newAuth.
+func RotateNVAuth(tpm transport.TPM, idx *nv.Index, saltKey tpmutil.Handle, oldAuth, newAuth []byte) error {
+	if !saltKey.HasPublic() {
+		return fmt.Errorf("salt key 0x%x has no public area", saltKey.Handle())
+	}
+	sess, closer, err := tpm2.PolicySession(tpm, tpm2.TPMAlgSHA256, 16,
+		tpm2.Auth(oldAuth),
+		tpm2.Salted(saltKey.Handle(), *saltKey.Public()),
+		tpm2.AESEncryption(128, tpm2.EncryptIn))
+	if err != nil {
+		return fmt.Errorf("failed to start policy session: %w", err)
+	}
+	defer closer() //nolint:errcheck
+
+	if _, err := (tpm2.PolicyCommandCode{
+		PolicySession: sess.Handle(),
+		Code:          tpm2.TPMCCNVChangeAuth,
+	}).Execute(tpm); err != nil {
+		return fmt.Errorf("failed to run PolicyCommandCode: %w", err)
+	}
+	if _, err := (tpm2.PolicyAuthValue{PolicySession: sess.Handle()}).Execute(tpm); err != nil {
+		return fmt.Errorf("failed to run PolicyAuthValue: %w", err)
+	}
+	if err := nvChangeAuth(tpm, idx, sess, newAuth); err != nil {
+		return fmt.Errorf("failed to change NV auth: %w", err)
+	}
+	return nil
+}
+
+// nvChangeAuth runs TPM2_NV_ChangeAuth, which go-tpm doesn't implement,
+// authorized by sess. go-tpm only applies sessions to the commands it
+// defines, so sess is driven here through its exported methods.
+//
+// The response HMAC isn't validated: the TPM computes it with newAuth, set
+// by the command itself, while sess only knows the old value.
+func nvChangeAuth(tpm transport.TPM, idx *nv.Index, sess tpm2.Session, newAuth []byte) error {
+	if err := sess.NewNonceCaller(); err != nil {
+		return err
+	}
+	// The first parameter, a TPM2B, is encrypted without its size.
+	params := tpm2.Marshal(tpm2.TPM2BAuth{Buffer: newAuth})
+	if err := sess.Encrypt(params[2:]); err != nil {
+		return fmt.Errorf("failed to encrypt parameter: %w", err)
+	}
+	authCmd, err := sess.Authorize(tpm2.TPMCCNVChangeAuth, params, nil, []tpm2.TPM2BName{idx.Name}, 0)
+	if err != nil {
+		return err
+	}
+	authArea := tpm2.Marshal(authCmd)
+
+	var body []byte
+	body = binary.BigEndian.AppendUint32(body, uint32(idx.Handle)) // nvIndex
+	body = binary.BigEndian.AppendUint32(body, uint32(len(authArea)))
+	body = append(body, authArea...)
+	body = append(body, params...)
+
+	var cmd []byte
+	cmd = binary.BigEndian.AppendUint16(cmd, uint16(tpm2.TPMSTSessions))
+	cmd = binary.BigEndian.AppendUint32(cmd, uint32(10+len(body)))
+	cmd = binary.BigEndian.AppendUint32(cmd, uint32(tpm2.TPMCCNVChangeAuth))
+	cmd = append(cmd, body...)
+
+	rsp, err := tpm.Send(cmd)
+	if err != nil {
+		return err
+	}
+	if len(rsp) < 10 {
+		return fmt.Errorf("short response (%d bytes)", len(rsp))
+	}
+	if rc := tpm2.TPMRC(binary.BigEndian.Uint32(rsp[6:10])); rc != tpm2.TPMRCSuccess {
+		return rc
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package auth_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/auth"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateObjectAuth(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	srk := testutil.NewFixtures(t, thetpm).SRK(t)
+
+	oldAuth, newAuth := []byte("old-password"), []byte("new-password")
+	key, err := tpmutil.Create(thetpm, tpmutil.CreateConfig{
+		ParentHandle: srk,
+		InPublic:     tpmutil.ECCSRKTemplate,
+		UserAuth:     oldAuth,
+	})
+	require.NoError(t, err)
+	defer key.Close()
+
+	rec := sniffer.New(thetpm)
+	private, err := auth.RotateObjectAuth(rec, key, srk, oldAuth, newAuth)
+	require.NoError(t, err)
+	for _, cmd := range rec.Commands() {
+		require.False(t, bytes.Contains(cmd, newAuth))
+	}
+
+	rotated, err := tpmutil.Load(thetpm, tpmutil.LoadConfig{
+		ParentHandle: srk,
+		InPrivate:    *private,
+		InPublic:     tpm2.New2B(*key.Public()),
+	})
+	require.NoError(t, err)
+	defer rotated.Close()
+
+	create := func(parent tpmutil.Handle, auth []byte) error {
+		child, err := tpmutil.Create(thetpm, tpmutil.CreateConfig{
+			ParentHandle: parent,
+			ParentAuth:   tpm2.PasswordAuth(auth),
+			InPublic:     tpmutil.ECCSRKTemplate,
+		})
+		if err != nil {
+			return err
+		}
+		return child.Close()
+	}
+	require.NoError(t, create(rotated, newAuth))
+	require.Error(t, create(rotated, oldAuth))
+
+	_, err = auth.RotateObjectAuth(thetpm, key, srk, []byte("wrong"), newAuth)
+	require.ErrorIs(t, err, tpm2.TPMRCBadAuth)
+}
+
+func TestRotateNVAuth(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	srk := testutil.NewFixtures(t, thetpm).SRK(t)
+
+	policy, err := auth.NVChangeAuthPolicy()
+	require.NoError(t, err)
+	oldAuth, newAuth := []byte("old-password"), []byte("new-password")
+	idx, err := nv.Define(thetpm, nv.DefineConfig{
+		Index:      0x01500110,
+		Size:       4,
+		Auth:       oldAuth,
+		AuthPolicy: policy,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, nv.Undefine(thetpm, idx))
+	})
+
+	rec := sniffer.New(thetpm)
+	require.NoError(t, auth.RotateNVAuth(rec, idx, srk, oldAuth, newAuth))
+	for _, cmd := range rec.Commands() {
+		require.False(t, bytes.Contains(cmd, newAuth))
+	}
+
+	require.NoError(t, nv.Write(thetpm, idx, []byte("data"), tpm2.PasswordAuth(newAuth)))
+	require.Error(t, nv.Write(thetpm, idx, []byte("data"), tpm2.PasswordAuth(oldAuth)))
+
+	require.Error(t, auth.RotateNVAuth(thetpm, idx, srk, oldAuth, newAuth), "oldAuth is no longer valid")
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/google/go-tpm/tpm2"
 	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/hierarchy"
 	"github.com/loicsikidi/tpm-stuff/internal/testutil"
 )
 
@@ -13,13 +14,7 @@ func TestHierarchyAuth(t *testing.T) {
 	thetpm := testutil.OpenSimulator(t)
 
 	authPwd := []byte("mysecret")
-	hca := tpm2.HierarchyChangeAuth{
-		AuthHandle: tpm2.TPMRHOwner,
-		NewAuth: tpm2.TPM2BAuth{
-			Buffer: authPwd,
-		},
-	}
-	if _, err := hca.Execute(thetpm); err != nil {
+	if err := hierarchy.ChangeAuth(thetpm, tpm2.TPMRHOwner, nil, authPwd); err != nil {
 		t.Errorf("failed HierarchyChangeAuth: %v", err)
 	}
 
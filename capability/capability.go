@@ -0,0 +1,351 @@
+// Package capability provides typed queries of the TPM capabilities
+// (TPM2_GetCapability): supported algorithms, curves and commands, loaded
+// handles and the fixed properties bounding buffers and key sizes, so that
+// callers adapt to the TPM instead of assuming its limits.
+package capability
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrPropertyNotReported is returned when the TPM doesn't report a property.
+var ErrPropertyNotReported = errors.New("property not reported by the TPM")
+
+// maxCount is the count requested by each GetCapability call; the TPM
+// returns at most what fits in its capability buffer and sets moreData.
+const maxCount = 0xff
+
+// ccFirst is TPM_CC_FIRST, the first command code of the specification.
+const ccFirst = 0x11f
+
+// Algorithms returns the algorithms implemented by the TPM and their
+// attributes.
+func Algorithms(tpm transport.TPM) ([]tpm2.TPMSAlgProperty, error) {
+	var algs []tpm2.TPMSAlgProperty
+	next := uint32(0)
+	for {
+		rsp, err := getCapability(tpm, tpm2.TPMCapAlgs, next)
+		if err != nil {
+			return nil, err
+		}
+		list, err := rsp.CapabilityData.Data.Algorithms()
+		if err != nil {
+			return nil, err
+		}
+		algs = append(algs, list.AlgProperties...)
+		if !rsp.MoreData || len(list.AlgProperties) == 0 {
+			return algs, nil
+		}
+		next = uint32(list.AlgProperties[len(list.AlgProperties)-1].Alg) + 1
+	}
+}
+
+// SupportsAlgorithm reports whether the TPM implements alg.
+func SupportsAlgorithm(tpm transport.TPM, alg tpm2.TPMAlgID) (bool, error) {
+	algs, err := Algorithms(tpm)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range algs {
+		if a.Alg == alg {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ECCCurves returns the ECC curves implemented by the TPM.
+func ECCCurves(tpm transport.TPM) ([]tpm2.TPMECCCurve, error) {
+	var curves []tpm2.TPMECCCurve
+	next := uint32(0)
+	for {
+		rsp, err := getCapability(tpm, tpm2.TPMCapECCCurves, next)
+		if err != nil {
+			return nil, err
+		}
+		list, err := rsp.CapabilityData.Data.ECCCurves()
+		if err != nil {
+			return nil, err
+		}
+		curves = append(curves, list.ECCCurves...)
+		if !rsp.MoreData || len(list.ECCCurves) == 0 {
+			return curves, nil
+		}
+		next = uint32(list.ECCCurves[len(list.ECCCurves)-1]) + 1
+	}
+}
+
+// Commands returns the command codes implemented by the TPM.
+func Commands(tpm transport.TPM) ([]tpm2.TPMCC, error) {
+	var commands []tpm2.TPMCC
+	next := uint32(ccFirst)
+	for {
+		rsp, err := getCapability(tpm, tpm2.TPMCapCommands, next)
+		if err != nil {
+			return nil, err
+		}
+		list, err := rsp.CapabilityData.Data.Command()
+		if err != nil {
+			return nil, err
+		}
+		for _, attrs := range list.CommandAttributes {
+			cc := tpm2.TPMCC(attrs.CommandIndex)
+			if attrs.V {
+				// Vendor-specific command codes have the V bit set.
+				cc |= 1 << 29
+			}
+			commands = append(commands, cc)
+		}
+		if !rsp.MoreData || len(list.CommandAttributes) == 0 {
+			return commands, nil
+		}
+		next = uint32(commands[len(commands)-1]) + 1
+	}
+}
+
+// SupportsCommand reports whether the TPM implements cc.
+func SupportsCommand(tpm transport.TPM, cc tpm2.TPMCC) (bool, error) {
+	commands, err := Commands(tpm)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range commands {
+		if c == cc {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Handles returns the handles of type ht in use, in ascending order: e.g.
+// NV indices (TPM_HT_NV_INDEX), loaded sessions (TPM_HT_HMAC_SESSION, both
+// HMAC and policy ones), saved sessions (TPM_HT_POLICY_SESSION), transient
+// or persistent objects.
+func Handles(tpm transport.TPM, ht tpm2.TPMHT) ([]tpm2.TPMHandle, error) {
+	var handles []tpm2.TPMHandle
+	next := uint32(ht) << 24
+	for {
+		rsp, err := getCapability(tpm, tpm2.TPMCapHandles, next)
+		if err != nil {
+			return nil, err
+		}
+		list, err := rsp.CapabilityData.Data.Handles()
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range list.Handle {
+			if !sameType(ht, h) {
+				// GetCapability continues with the following handle types.
+				return handles, nil
+			}
+			handles = append(handles, h)
+		}
+		if !rsp.MoreData || len(list.Handle) == 0 {
+			return handles, nil
+		}
+		next = uint32(list.Handle[len(list.Handle)-1]) + 1
+	}
+}
+
+// sameType reports whether h belongs to the list of handles of type ht.
+func sameType(ht tpm2.TPMHT, h tpm2.TPMHandle) bool {
+	t := tpm2.TPMHT(h >> 24)
+	if ht == tpm2.TPMHTHMACSession {
+		// The list of loaded sessions holds policy sessions as well.
+		return t == tpm2.TPMHTHMACSession || t == tpm2.TPMHTPolicySession
+	}
+	return t == ht
+}
+
+// NVIndices returns the NV indices defined, in ascending order.
+func NVIndices(tpm transport.TPM) ([]tpm2.TPMHandle, error) {
+	return Handles(tpm, tpm2.TPMHTNVIndex)
+}
+
+// Property returns the value of the TPM property prop.
+func Property(tpm transport.TPM, prop tpm2.TPMPT) (uint32, error) {
+	rsp, err := tpm2.GetCapability{
+		Capability:    tpm2.TPMCapTPMProperties,
+		Property:      uint32(prop),
+		PropertyCount: 1,
+	}.Execute(tpm)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get property 0x%x: %w", prop, err)
+	}
+	props, err := rsp.CapabilityData.Data.TPMProperties()
+	if err != nil {
+		return 0, err
+	}
+	if len(props.TPMProperty) == 0 || props.TPMProperty[0].Property != prop {
+		return 0, fmt.Errorf("%w: 0x%x", ErrPropertyNotReported, prop)
+	}
+	return props.TPMProperty[0].Value, nil
+}
+
+// Properties returns the TPM properties from first to last included, the
+// ones unknown to the TPM being omitted.
+func Properties(tpm transport.TPM, first, last tpm2.TPMPT) (map[tpm2.TPMPT]uint32, error) {
+	props := make(map[tpm2.TPMPT]uint32)
+	next := first
+	for next <= last {
+		rsp, err := tpm2.GetCapability{
+			Capability:    tpm2.TPMCapTPMProperties,
+			Property:      uint32(next),
+			PropertyCount: uint32(last-next) + 1,
+		}.Execute(tpm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get properties from 0x%x: %w", next, err)
+		}
+		list, err := rsp.CapabilityData.Data.TPMProperties()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range list.TPMProperty {
+			if p.Property <= last {
+				props[p.Property] = p.Value
+			}
+		}
+		if !rsp.MoreData || len(list.TPMProperty) == 0 {
+			break
+		}
+		next = list.TPMProperty[len(list.TPMProperty)-1].Property + 1
+	}
+	return props, nil
+}
+
+// Fixed holds the main fixed properties of a TPM (TPM_PT_FIXED group).
+type Fixed struct {
+	// Manufacturer is the vendor ID, e.g. "IFX" or "IBM".
+	Manufacturer string
+	// VendorString is the vendor-defined description of the TPM.
+	VendorString string
+	// FirmwareVersion is the vendor-defined firmware version, as the four
+	// 16-bit halves of TPM_PT_FIRMWARE_VERSION_1 and _2.
+	FirmwareVersion [4]uint16
+	// Family is the specification family, e.g. "2.0".
+	Family string
+	// Revision is the specification revision times 100, e.g. 159.
+	Revision uint32
+	// InputBuffer is the maximum size of a TPM2B_MAX_BUFFER parameter.
+	InputBuffer uint32
+	// NVBufferMax is the maximum data size of one NV read or write.
+	NVBufferMax uint32
+	// MaxDigest is the size of the largest digest produced by the TPM.
+	MaxDigest uint32
+	// MaxCommandSize and MaxResponseSize bound the messages size.
+	MaxCommandSize  uint32
+	MaxResponseSize uint32
+	// HRTransientMin is the minimum number of transient objects which can
+	// be loaded at once.
+	HRTransientMin uint32
+	// HRLoadedMin is the minimum number of sessions which can be loaded at
+	// once.
+	HRLoadedMin uint32
+	// ActiveSessionsMax is the maximum number of loaded and saved sessions.
+	ActiveSessionsMax uint32
+	// PCRCount is the number of PCRs.
+	PCRCount uint32
+	// NVIndexMax is the maximum size of an NV index data area.
+	NVIndexMax uint32
+}
+
+// FirmwareVersionString returns the firmware version in dotted form.
+func (f Fixed) FirmwareVersionString() string {
+	return fmt.Sprintf("%d.%d.%d.%d", f.FirmwareVersion[0], f.FirmwareVersion[1], f.FirmwareVersion[2], f.FirmwareVersion[3])
+}
+
+// FixedProperties returns the fixed properties of the TPM.
+func FixedProperties(tpm transport.TPM) (*Fixed, error) {
+	props, err := Properties(tpm, tpm2.TPMPTFamilyIndicator, tpm2.TPMPTMaxCapBuffer)
+	if err != nil {
+		return nil, err
+	}
+	fw1, fw2 := props[tpm2.TPMPTFirmwareVersion1], props[tpm2.TPMPTFirmwareVersion2]
+	return &Fixed{
+		Manufacturer: ascii(props[tpm2.TPMPTManufacturer]),
+		VendorString: ascii(props[tpm2.TPMPTVendorString1], props[tpm2.TPMPTVendorString2],
+			props[tpm2.TPMPTVendorString3], props[tpm2.TPMPTVendorString4]),
+		FirmwareVersion:   [4]uint16{uint16(fw1 >> 16), uint16(fw1), uint16(fw2 >> 16), uint16(fw2)},
+		Family:            ascii(props[tpm2.TPMPTFamilyIndicator]),
+		Revision:          props[tpm2.TPMPTRevision],
+		InputBuffer:       props[tpm2.TPMPTInputBuffer],
+		NVBufferMax:       props[tpm2.TPMPTNVBufferMax],
+		MaxDigest:         props[tpm2.TPMPTMaxDigest],
+		MaxCommandSize:    props[tpm2.TPMPTMaxCommandSize],
+		MaxResponseSize:   props[tpm2.TPMPTMaxResponseSize],
+		HRTransientMin:    props[tpm2.TPMPTHRTransientMin],
+		HRLoadedMin:       props[tpm2.TPMPTHRLoadedMin],
+		ActiveSessionsMax: props[tpm2.TPMPTActiveSessionsMax],
+		PCRCount:          props[tpm2.TPMPTPCRCount],
+		NVIndexMax:        props[tpm2.TPMPTNVIndexMax],
+	}, nil
+}
+
+// ascii decodes properties holding 4 ASCII characters each, padded with NUL
+// or spaces.
+func ascii(values ...uint32) string {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return strings.TrimRight(strings.ReplaceAll(string(b), "\x00", ""), " ")
+}
+
+// SupportsAES reports whether the TPM implements AES with keyBits (128, 192
+// or 256) in CFB mode, the mode of parameter encryption.
+func SupportsAES(tpm transport.TPM, keyBits uint16) (bool, error) {
+	_, err := tpm2.TestParms{
+		Parameters: tpm2.TPMTPublicParms{
+			Type: tpm2.TPMAlgSymCipher,
+			Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgSymCipher, &tpm2.TPMSSymCipherParms{
+				Sym: tpm2.TPMTSymDefObject{
+					Algorithm: tpm2.TPMAlgAES,
+					KeyBits:   tpm2.NewTPMUSymKeyBits(tpm2.TPMAlgAES, tpm2.TPMKeyBits(keyBits)),
+					Mode:      tpm2.NewTPMUSymMode(tpm2.TPMAlgAES, tpm2.TPMAlgCFB),
+				},
+			}),
+		},
+	}.Execute(tpm)
+	if err == nil {
+		return true, nil
+	}
+	// The TPM rejects unsupported parameters with an error code.
+	var rc tpm2.TPMRC
+	if errors.As(err, &rc) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to test AES-%d parameters: %w", keyBits, err)
+}
+
+// MaxAESKeyBits returns the largest AES key size supported in CFB mode,
+// suitable for parameter encryption (see [tpm2.AESEncryption]).
+func MaxAESKeyBits(tpm transport.TPM) (uint16, error) {
+	for _, bits := range []uint16{256, 192, 128} {
+		ok, err := SupportsAES(tpm, bits)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return bits, nil
+		}
+	}
+	return 0, fmt.Errorf("AES in CFB mode not supported")
+}
+
+func getCapability(tpm transport.TPM, capability tpm2.TPMCap, property uint32) (*tpm2.GetCapabilityResponse, error) {
+	rsp, err := tpm2.GetCapability{
+		Capability:    capability,
+		Property:      property,
+		PropertyCount: maxCount,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get capability 0x%x: %w", capability, err)
+	}
+	return rsp, nil
+}
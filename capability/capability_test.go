@@ -0,0 +1,121 @@
+package capability_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/capability"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlgorithms(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	algs, err := capability.Algorithms(thetpm)
+	require.NoError(t, err)
+	require.NotEmpty(t, algs)
+	for _, a := range algs {
+		if a.Alg == tpm2.TPMAlgSHA256 {
+			require.True(t, a.AlgProperties.Hash)
+		}
+	}
+
+	ok, err := capability.SupportsAlgorithm(thetpm, tpm2.TPMAlgECC)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = capability.SupportsAlgorithm(thetpm, tpm2.TPMAlgID(0x7fff))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestECCCurves(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	curves, err := capability.ECCCurves(thetpm)
+	require.NoError(t, err)
+	require.Contains(t, curves, tpm2.TPMECCNistP256)
+}
+
+func TestCommands(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	commands, err := capability.Commands(thetpm)
+	require.NoError(t, err)
+	// More than one GetCapability page.
+	require.Greater(t, len(commands), 100)
+	require.Contains(t, commands, tpm2.TPMCCCreatePrimary)
+	require.Contains(t, commands, tpm2.TPMCCPolicySecret)
+
+	ok, err := capability.SupportsCommand(thetpm, tpm2.TPMCCGetRandom)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = capability.SupportsCommand(thetpm, tpm2.TPMCC(0x1ff))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestHandles(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	defer srk.Close()
+	sess, closer, err := tpm2.PolicySession(thetpm, tpm2.TPMAlgSHA256, 16)
+	require.NoError(t, err)
+	defer closer()
+
+	transient, err := capability.Handles(thetpm, tpm2.TPMHTTransient)
+	require.NoError(t, err)
+	require.Equal(t, []tpm2.TPMHandle{srk.Handle()}, transient)
+
+	loaded, err := capability.Handles(thetpm, tpm2.TPMHTHMACSession)
+	require.NoError(t, err)
+	require.Equal(t, []tpm2.TPMHandle{sess.Handle()}, loaded)
+
+	idx, err := nv.Define(thetpm, nv.DefineConfig{Index: 0x01500000, Size: 8})
+	require.NoError(t, err)
+	defer nv.Undefine(thetpm, idx)
+
+	indices, err := capability.NVIndices(thetpm)
+	require.NoError(t, err)
+	require.Contains(t, indices, tpm2.TPMHandle(0x01500000))
+}
+
+func TestFixedProperties(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	fixed, err := capability.FixedProperties(thetpm)
+	require.NoError(t, err)
+	require.Equal(t, "2.0", fixed.Family)
+	require.NotEmpty(t, fixed.Manufacturer)
+	require.NotZero(t, fixed.Revision)
+	require.NotZero(t, fixed.NVBufferMax)
+	require.NotZero(t, fixed.HRTransientMin)
+	require.Regexp(t, `^\d+\.\d+\.\d+\.\d+$`, fixed.FirmwareVersionString())
+	t.Logf("%s %q firmware %s, NV buffer %d bytes", fixed.Manufacturer, fixed.VendorString, fixed.FirmwareVersionString(), fixed.NVBufferMax)
+
+	v, err := capability.Property(thetpm, tpm2.TPMPTNVBufferMax)
+	require.NoError(t, err)
+	require.Equal(t, fixed.NVBufferMax, v)
+
+	_, err = capability.Property(thetpm, tpm2.TPMPT(0x1ff))
+	require.ErrorIs(t, err, capability.ErrPropertyNotReported)
+}
+
+func TestMaxAESKeyBits(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	ok, err := capability.SupportsAES(thetpm, 128)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = capability.SupportsAES(thetpm, 64)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	bits, err := capability.MaxAESKeyBits(thetpm)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, bits, uint16(128))
+}
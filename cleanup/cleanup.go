@@ -0,0 +1,192 @@
+// Package cleanup removes what crashed demos and tests leave behind in a TPM:
+// transient objects and sessions still loaded, and the persistent objects and
+// NV indexes defined in the handle ranges used by the packages of this module.
+//
+// The packages of this module don't tag the entities they create otherwise
+// than by their handles: by convention, NV indexes are defined in [NVRange]
+// (e.g. provision.RollbackCounterIndex) and persistent objects other than
+// the well-known SRKs and EKs in [persist.OwnerRange] (e.g.
+// provision.AKHandle). Entities of other software in these ranges are
+// removed as well: use [Config.DryRun] first on a TPM which isn't dedicated
+// to development.
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/capability"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/persist"
+)
+
+// NVRange is the range of the NV indexes defined by the packages, demos and
+// tests of this module.
+var NVRange = persist.Range{First: 0x01500000, Last: 0x015FFFFF}
+
+// Config holds configuration for [Clean].
+type Config struct {
+	// NVIndexes is the range of the NV indexes to undefine.
+	//
+	// Default: [NVRange].
+	NVIndexes persist.Range
+	// Persistent is the range of the persistent objects to evict.
+	//
+	// Default: [persist.OwnerRange].
+	Persistent persist.Range
+	// OwnerAuth is the authorization session for the owner hierarchy, which
+	// authorizes the removal of NV indexes and persistent objects.
+	//
+	// Default: [tpmutil.NoAuth].
+	OwnerAuth tpm2.Session
+	// DryRun reports the entities which would be removed, without removing
+	// them.
+	//
+	// Default: false.
+	DryRun bool
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	if c.NVIndexes == (persist.Range{}) {
+		c.NVIndexes = NVRange
+	}
+	if c.Persistent == (persist.Range{}) {
+		c.Persistent = persist.OwnerRange
+	}
+	if tpm2.TPMHT(c.NVIndexes.First>>24) != tpm2.TPMHTNVIndex || tpm2.TPMHT(c.NVIndexes.Last>>24) != tpm2.TPMHTNVIndex {
+		return fmt.Errorf("invalid NV index range [0x%x, 0x%x]", c.NVIndexes.First, c.NVIndexes.Last)
+	}
+	if persist.PlatformRange.Contains(c.Persistent.First) || persist.PlatformRange.Contains(c.Persistent.Last) ||
+		tpm2.TPMHT(c.Persistent.First>>24) != tpm2.TPMHTPersistent || tpm2.TPMHT(c.Persistent.Last>>24) != tpm2.TPMHTPersistent {
+		return fmt.Errorf("invalid persistent range [0x%x, 0x%x]", c.Persistent.First, c.Persistent.Last)
+	}
+	if c.OwnerAuth == nil {
+		c.OwnerAuth = tpmutil.NoAuth
+	}
+	return nil
+}
+
+// Report lists the entities removed by [Clean], or which would be removed
+// with [Config.DryRun].
+type Report struct {
+	Transient  []tpm2.TPMHandle `json:"transient,omitempty"`
+	Sessions   []tpm2.TPMHandle `json:"sessions,omitempty"`
+	Persistent []tpm2.TPMHandle `json:"persistent,omitempty"`
+	NVIndexes  []tpm2.TPMHandle `json:"nv_indexes,omitempty"`
+	// Skipped are the NV indexes of the range which can't be undefined with
+	// owner authorization: the ones defined by the platform
+	// (TPMA_NV_PLATFORMCREATE) or deleted by policy (TPMA_NV_POLICY_DELETE).
+	Skipped []tpm2.TPMHandle `json:"skipped,omitempty"`
+}
+
+// Clean flushes the transient objects and the sessions loaded in the TPM,
+// evicts the persistent objects and undefines the NV indexes of the ranges of
+// the configuration.
+//
+// Every entity is tried even if some fail: the returned report lists the
+// ones removed, along with the joined errors.
+//
+// Note: behind a resource manager, such as /dev/tpmrm0, the transient
+// objects and sessions of other connections are neither listed nor flushed.
+//
+// Example, after a crashed test run against a development TPM:
+//
+//	report, err := cleanup.Clean(tpm, cleanup.Config{DryRun: true})
+//	if err != nil {
+//	    return err
+//	}
+//	fmt.Printf("would remove %d NV indexes\n", len(report.NVIndexes))
+func Clean(tpm transport.TPM, optionalCfg ...Config) (*Report, error) {
+	cfg := Config{}
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	var errs []error
+	flush := func(ht tpm2.TPMHT, removed *[]tpm2.TPMHandle) {
+		handles, err := capability.Handles(tpm, ht)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		for _, h := range handles {
+			if !cfg.DryRun {
+				if _, err := (tpm2.FlushContext{FlushHandle: h}).Execute(tpm); err != nil {
+					errs = append(errs, fmt.Errorf("failed to flush 0x%x: %w", h, err))
+					continue
+				}
+			}
+			*removed = append(*removed, h)
+		}
+	}
+	flush(tpm2.TPMHTTransient, &report.Transient)
+	// The list of loaded sessions holds both HMAC and policy sessions.
+	flush(tpm2.TPMHTHMACSession, &report.Sessions)
+
+	persistent, err := persist.ListPersistent(tpm)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, h := range persistent {
+		if !cfg.Persistent.Contains(h) {
+			continue
+		}
+		if !cfg.DryRun {
+			if err := persist.Evict(tpm, h, cfg.OwnerAuth); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		report.Persistent = append(report.Persistent, h)
+	}
+
+	indexes, err := capability.NVIndices(tpm)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, h := range indexes {
+		if !cfg.NVIndexes.Contains(h) {
+			continue
+		}
+		removed, err := undefine(tpm, h, cfg)
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case removed:
+			report.NVIndexes = append(report.NVIndexes, h)
+		default:
+			report.Skipped = append(report.Skipped, h)
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// undefine undefines the NV index h, unless owner authorization can't.
+func undefine(tpm transport.TPM, h tpm2.TPMHandle, cfg Config) (bool, error) {
+	public, err := nv.ReadPublic(tpm, h)
+	if err != nil {
+		return false, err
+	}
+	if public.Attributes.PlatformCreate || public.Attributes.PolicyDelete {
+		return false, nil
+	}
+	if cfg.DryRun {
+		return true, nil
+	}
+	idx, err := nv.Open(tpm, h)
+	if err != nil {
+		return false, err
+	}
+	if err := nv.Undefine(tpm, idx, cfg.OwnerAuth); err != nil {
+		return false, fmt.Errorf("0x%x: %w", h, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,76 @@
+package cleanup_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/capability"
+	"github.com/loicsikidi/tpm-stuff/cleanup"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/persist"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClean(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	// What a crashed demo leaves: a transient key, a session, a persisted
+	// key and NV indexes.
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	_, err = persist.Persist(thetpm, srk, 0x81020010)
+	require.NoError(t, err)
+	_, err = persist.Persist(thetpm, srk, persist.ECCSRKHandle)
+	require.NoError(t, err)
+	sess, err := tpm2.StartAuthSession{
+		TPMKey:      tpm2.TPMRHNull,
+		Bind:        tpm2.TPMRHNull,
+		SessionType: tpm2.TPMSEHMAC,
+		Symmetric:   tpm2.TPMTSymDef{Algorithm: tpm2.TPMAlgNull},
+		AuthHash:    tpm2.TPMAlgSHA256,
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	_, err = nv.Define(thetpm, nv.DefineConfig{Index: 0x01500000, Size: 8})
+	require.NoError(t, err)
+	_, err = nv.Define(thetpm, nv.DefineConfig{Index: 0x01000000, Size: 8})
+	require.NoError(t, err)
+
+	report, err := cleanup.Clean(thetpm, cleanup.Config{DryRun: true})
+	require.NoError(t, err)
+	want := &cleanup.Report{
+		Transient:  []tpm2.TPMHandle{srk.Handle()},
+		Sessions:   []tpm2.TPMHandle{sess.SessionHandle},
+		Persistent: []tpm2.TPMHandle{0x81020010},
+		NVIndexes:  []tpm2.TPMHandle{0x01500000},
+	}
+	require.Equal(t, want, report)
+	indexes, err := capability.NVIndices(thetpm)
+	require.NoError(t, err)
+	require.Contains(t, indexes, tpm2.TPMHandle(0x01500000), "nothing is removed on dry run")
+
+	report, err = cleanup.Clean(thetpm)
+	require.NoError(t, err)
+	require.Equal(t, want, report)
+
+	// Only the entities out of the ranges are left.
+	report, err = cleanup.Clean(thetpm, cleanup.Config{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, &cleanup.Report{}, report)
+	persistent, err := persist.ListPersistent(thetpm)
+	require.NoError(t, err)
+	require.Equal(t, []tpm2.TPMHandle{persist.ECCSRKHandle}, persistent)
+	indexes, err = capability.NVIndices(thetpm)
+	require.NoError(t, err)
+	require.Equal(t, []tpm2.TPMHandle{0x01000000}, indexes)
+}
+
+func TestClean_InvalidConfig(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	_, err := cleanup.Clean(thetpm, cleanup.Config{NVIndexes: persist.OwnerRange})
+	require.Error(t, err)
+	_, err = cleanup.Clean(thetpm, cleanup.Config{Persistent: persist.PlatformRange})
+	require.Error(t, err)
+}
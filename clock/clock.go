@@ -0,0 +1,106 @@
+// Package clock reads the time of the TPM (TPM2_ReadClock) and moves its
+// clock forward (TPM2_ClockSet).
+//
+// The TPM keeps two times, both in milliseconds and only running while it is
+// powered: Time, since the last TPM Reset or Restart, and Clock, since the
+// last TPM2_Clear, which never goes backwards. Along with the reset and
+// restart counts, they bind policies to a time window or to a boot (see
+// policy.CounterTimer) and date attestations (see [FromClockInfo]).
+package clock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/rawcmd"
+)
+
+// maxClock is the highest value TPM2_ClockSet accepts, in milliseconds.
+const maxClock = 0xFFFF000000000000
+
+// Info is the time of the TPM, decoded from TPMS_TIME_INFO.
+type Info struct {
+	// Time is the time the TPM was powered since its last TPM Reset or
+	// Restart.
+	Time time.Duration `json:"time"`
+	// Clock is the time the TPM was powered since its last TPM2_Clear, moved
+	// forward by [Advance].
+	Clock time.Duration `json:"clock"`
+	// ResetCount is the number of TPM Resets (reboots) since the last
+	// TPM2_Clear.
+	ResetCount uint32 `json:"reset_count"`
+	// RestartCount is the number of TPM Restarts and Resumes (e.g. resumes
+	// from hibernation) since the last TPM Reset.
+	RestartCount uint32 `json:"restart_count"`
+	// Safe reports that the TPM never reported a Clock greater than this
+	// one: it is false after an unorderly shutdown, until Clock is saved
+	// again.
+	Safe bool `json:"safe"`
+}
+
+// Read reads the time of the TPM.
+//
+// Example, to seal a secret until the next reboot:
+//
+//	now, err := clock.Read(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	cond := policy.ResetCountBelow(now.ResetCount + 1)
+func Read(tpm transport.TPM) (*Info, error) {
+	rsp, err := tpm2.ReadClock{}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clock: %w", err)
+	}
+	info := FromClockInfo(rsp.CurrentTime.ClockInfo)
+	info.Time = time.Duration(rsp.CurrentTime.Time) * time.Millisecond
+	return &info, nil
+}
+
+// FromClockInfo decodes ci, e.g. the clock info of the TPMS_ATTEST signed by
+// a quote or a certification, which has no Time.
+func FromClockInfo(ci tpm2.TPMSClockInfo) Info {
+	return Info{
+		Clock:        time.Duration(ci.Clock) * time.Millisecond,
+		ResetCount:   ci.ResetCount,
+		RestartCount: ci.RestartCount,
+		Safe:         ci.Safe,
+	}
+}
+
+// SameBoot reports whether i and other were read without TPM Reset, Restart
+// or Resume in between, e.g. to check that an attestation was produced since
+// the TPM last booted.
+func (i Info) SameBoot(other Info) bool {
+	return i.ResetCount == other.ResetCount && i.RestartCount == other.RestartCount
+}
+
+// Advance moves the clock of the TPM forward by d (TPM2_ClockSet) and
+// returns its new time. The owner hierarchy authorizes the command with
+// ownerAuth, through a password session (see rawcmd.Execute).
+//
+// The clock can't be moved back afterwards, except by TPM2_Clear: Advance is
+// meant for simulators, e.g. to expire the policies of
+// policy.ClockBefore in tests, not for TPMs in use.
+func Advance(tpm transport.TPM, d time.Duration, ownerAuth []byte) (*Info, error) {
+	if d < 0 {
+		return nil, errors.New("the clock can only move forward")
+	}
+	now, err := Read(tpm)
+	if err != nil {
+		return nil, err
+	}
+	clock := uint64(now.Clock.Milliseconds()) + uint64(d.Milliseconds())
+	if clock > maxClock {
+		return nil, fmt.Errorf("clock 0x%x exceeds the maximum 0x%x", clock, uint64(maxClock))
+	}
+	params := binary.BigEndian.AppendUint64(nil, clock)
+	if err := rawcmd.Execute(tpm, tpm2.TPMCCClockSet, []tpm2.TPMHandle{tpm2.TPMRHOwner}, ownerAuth, params); err != nil {
+		return nil, fmt.Errorf("failed to set clock: %w", err)
+	}
+	return Read(tpm)
+}
@@ -0,0 +1,70 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/clock"
+	"github.com/loicsikidi/tpm-stuff/hierarchy"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRead(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	rsp, err := tpm2.ReadClock{}.Execute(thetpm)
+	require.NoError(t, err)
+	info, err := clock.Read(thetpm)
+	require.NoError(t, err)
+
+	want := rsp.CurrentTime.ClockInfo
+	require.GreaterOrEqual(t, info.Clock, time.Duration(want.Clock)*time.Millisecond)
+	require.GreaterOrEqual(t, info.Time, time.Duration(rsp.CurrentTime.Time)*time.Millisecond)
+	require.Equal(t, want.ResetCount, info.ResetCount)
+	require.Equal(t, want.RestartCount, info.RestartCount)
+	require.True(t, info.SameBoot(clock.FromClockInfo(want)))
+}
+
+func TestRead_PowerCycle(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	before, err := clock.Read(thetpm)
+	require.NoError(t, err)
+	testutil.PowerCycle(t, thetpm, testutil.CycleResume)
+	after, err := clock.Read(thetpm)
+	require.NoError(t, err)
+
+	require.False(t, after.SameBoot(*before))
+	require.Equal(t, before.ResetCount, after.ResetCount)
+	require.Equal(t, before.RestartCount+1, after.RestartCount)
+}
+
+func TestAdvance(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	before, err := clock.Read(thetpm)
+	require.NoError(t, err)
+	after, err := clock.Advance(thetpm, time.Hour, nil)
+	require.NoError(t, err)
+
+	require.GreaterOrEqual(t, after.Clock, before.Clock+time.Hour)
+	// Time isn't moved by TPM2_ClockSet.
+	require.Less(t, after.Time, before.Time+time.Hour)
+	require.True(t, after.SameBoot(*before))
+
+	_, err = clock.Advance(thetpm, -time.Second, nil)
+	require.ErrorContains(t, err, "only move forward")
+}
+
+func TestAdvance_OwnerAuth(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	testutil.Isolate(t, thetpm)
+	require.NoError(t, hierarchy.ChangeAuth(thetpm, tpm2.TPMRHOwner, nil, []byte("owner")))
+
+	_, err := clock.Advance(thetpm, time.Minute, nil)
+	require.ErrorIs(t, err, tpm2.TPMRCBadAuth)
+	_, err = clock.Advance(thetpm, time.Minute, []byte("owner"))
+	require.NoError(t, err)
+}
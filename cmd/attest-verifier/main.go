@@ -0,0 +1,185 @@
+// Command attest-verifier runs the verifier side of the remote-attestation
+// protocol as an HTTP service (see the attestation/service package): devices
+// enroll their EK and AK on POST /enroll, then prove the state of their PCRs
+// with quotes over fresh nonces on POST /challenge and POST /quote.
+//
+// Usage:
+//
+//	attest-verifier [-listen 127.0.0.1:8080] [-store dir] [-nonces dir] [-pcrs 0,1,...,7] [-ttl 1m] [-allowlist file [-ek-roots pem]]
+//	attest-verifier -allowlist file allow <ek-cert> <identity>
+//	attest-verifier -allowlist file revoke <fingerprint>
+//
+// Without -store, the enrolled devices are kept in memory and lost when the
+// service stops. Without -nonces, the nonces of the challenges are kept in
+// memory: with a directory, they are shared by the instances of the service
+// using it, each nonce being accepted only once.
+//
+// With -allowlist, only the devices whose EK certificate is in the JSON
+// allow-list can enroll (see the attestation/enrollment package), and the
+// chain of the EK certificates is verified up to the roots of -ek-roots if
+// set. The allow and revoke commands edit the allow-list, which the running
+// service reads at each request: revoking a device rejects its next quotes.
+//
+// The attester demo talks to it with its -verifier flag:
+//
+//	attester -tpm-path 127.0.0.1:2321 -verifier http://127.0.0.1:8080
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loicsikidi/tpm-stuff/attestation/enrollment"
+	"github.com/loicsikidi/tpm-stuff/attestation/nonce"
+	"github.com/loicsikidi/tpm-stuff/attestation/service"
+)
+
+var (
+	listen = flag.String("listen", "127.0.0.1:8080", "Address the service listens on")
+	store  = flag.String("store", "", "Directory of the enrolled devices (default: in memory)")
+	nonces = flag.String("nonces", "", "Directory of the nonces of the challenges (default: in memory)")
+	pcrs   = flag.String("pcrs", "0,1,2,3,4,5,6,7", "Comma-separated list of SHA-256 PCRs to quote")
+	ttl    = flag.Duration("ttl", time.Minute, "Validity of the credential challenges and quote nonces")
+
+	allowlist = flag.String("allowlist", "", "JSON allow-list of the EK certificates (default: any TPM can enroll)")
+	ekRoots   = flag.String("ek-roots", "", "PEM file of the roots of the EK certificates (default: chains aren't verified)")
+)
+
+func parsePCRs(s string) ([]uint, error) {
+	var out []uint
+	for _, f := range strings.Split(s, ",") {
+		idx, err := strconv.ParseUint(strings.TrimSpace(f), 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, uint(idx))
+	}
+	return out, nil
+}
+
+// readCertificate reads a PEM or DER certificate.
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	return x509.ParseCertificate(data)
+}
+
+// edit runs the allow and revoke commands on the allow-list.
+func edit(args []string) {
+	if *allowlist == "" {
+		log.Fatalf("%s requires -allowlist", args[0])
+	}
+	db, err := enrollment.OpenFileDB(*allowlist)
+	if err != nil {
+		log.Fatalf("can't open allow-list: %v", err)
+	}
+	switch {
+	case args[0] == "allow" && len(args) == 3:
+		cert, err := readCertificate(args[1])
+		if err != nil {
+			log.Fatalf("can't read EK certificate: %v", err)
+		}
+		fingerprint := enrollment.Fingerprint(cert)
+		if err := db.Allow(fingerprint, args[2]); err != nil {
+			log.Fatalf("can't allow device: %v", err)
+		}
+		fmt.Printf("Allowed %s as %s\n", fingerprint, args[2])
+	case args[0] == "revoke" && len(args) == 2:
+		if err := db.Revoke(args[1]); err != nil {
+			log.Fatalf("can't revoke device: %v", err)
+		}
+		fmt.Printf("Revoked %s\n", args[1])
+	default:
+		log.Fatalf("usage: attest-verifier -allowlist file allow <ek-cert> <identity> | revoke <fingerprint>")
+	}
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() > 0 {
+		edit(flag.Args())
+		return
+	}
+
+	selection, err := parsePCRs(*pcrs)
+	if err != nil {
+		log.Fatalf("invalid -pcrs value: %v", err)
+	}
+	cfg := service.Config{PCRs: selection, TTL: *ttl}
+	if *store != "" {
+		if cfg.Store, err = service.NewFileStore(*store); err != nil {
+			log.Fatalf("can't open store: %v", err)
+		}
+	}
+	if *nonces != "" {
+		if cfg.Nonces, err = nonce.NewFileStore(*nonces); err != nil {
+			log.Fatalf("can't open nonce store: %v", err)
+		}
+	}
+	if *allowlist != "" {
+		if cfg.Enrollments, err = enrollment.OpenFileDB(*allowlist); err != nil {
+			log.Fatalf("can't open allow-list: %v", err)
+		}
+	}
+	if *ekRoots != "" {
+		data, err := os.ReadFile(*ekRoots)
+		if err != nil {
+			log.Fatalf("can't read EK roots: %v", err)
+		}
+		cfg.EKRoots = x509.NewCertPool()
+		if !cfg.EKRoots.AppendCertsFromPEM(data) {
+			log.Fatalf("no certificate in %s", *ekRoots)
+		}
+	}
+	srv, err := service.New(cfg)
+	if err != nil {
+		log.Fatalf("can't create service: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           logRequests(srv),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+	log.Printf("Verifier listening on %s", *listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("serve failed: %v", err)
+	}
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs each request along with its status and duration.
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		log.Printf("%s %s from %s: %d (%s)", r.Method, r.URL.Path, r.RemoteAddr, sw.status, time.Since(start))
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/templates"
+)
+
+// benchTemplate is the key created by each iteration of session-bench, as in
+// the secure_connection benchmarks.
+var benchTemplate = templates.ECCSigner()
+
+func runSessionBench(c *cli, args []string) error {
+	fs := c.flagSet("session-bench")
+	tpmOpts := tpmFlags(fs)
+	n := fs.Int("n", 10, "number of keys created per session type")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if *n <= 0 {
+		return fmt.Errorf("-n must be positive, got %d", *n)
+	}
+
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	srk, err := newStorageKey(tpm)
+	if err != nil {
+		return err
+	}
+	c.addHandle("srk", srk)
+
+	benches := []struct {
+		name    string
+		session func() tpm2.Session
+	}{
+		{"password", func() tpm2.Session { return tpm2.PasswordAuth(nil) }},
+		{"unbound", func() tpm2.Session { return srk.factory.Unbound(nil) }},
+		{"bound", func() tpm2.Session { return srk.factory.Bound(srk.Handle(), srk.Name(), nil, nil) }},
+		{"salted", func() tpm2.Session { return srk.session(nil) }},
+	}
+
+	type benchResult struct {
+		Session  string        `json:"session"`
+		Keys     int           `json:"keys"`
+		PerKeyNS time.Duration `json:"per_key_ns"`
+	}
+	result := struct {
+		Cipher  string        `json:"cipher"`
+		Results []benchResult `json:"results"`
+	}{Cipher: srk.factory.String()}
+	c.rec.Result = &result
+
+	if !c.jsonOutput() {
+		fmt.Fprintf(c.stdout, "session cipher: %s\n", srk.factory)
+		fmt.Fprintf(c.stdout, "%-10s %8s %14s\n", "session", "keys", "time/key")
+	}
+	for _, b := range benches {
+		start := time.Now()
+		for range *n {
+			if err := createAndFlush(tpm, b.session()); err != nil {
+				return fmt.Errorf("%s session: %w", b.name, err)
+			}
+		}
+		perKey := time.Since(start) / time.Duration(*n)
+		result.Results = append(result.Results, benchResult{b.name, *n, perKey})
+		if c.jsonOutput() {
+			continue
+		}
+		fmt.Fprintf(c.stdout, "%-10s %8d %14s\n", b.name, *n, perKey.Round(time.Microsecond))
+	}
+	return nil
+}
+
+// createAndFlush creates a primary key in the owner hierarchy, authorized by
+// sess, and flushes it.
+func createAndFlush(tpm transport.TPM, sess tpm2.Session) error {
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMRHOwner,
+			Auth:   sess,
+		},
+		InPublic: tpm2.New2B(benchTemplate),
+	}.Execute(tpm)
+	if err != nil {
+		return err
+	}
+	_, err = tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm)
+	return err
+}
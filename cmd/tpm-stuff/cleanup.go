@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/cleanup"
+)
+
+// runCleanup removes the transient objects, sessions, persistent objects and
+// NV indexes left behind by crashed demos or tests (see cleanup.Clean).
+func runCleanup(c *cli, args []string) error {
+	fs := c.flagSet("cleanup")
+	tpmOpts := tpmFlags(fs)
+	ownerAuth := fs.String("owner-auth", "", "authorization value of the owner hierarchy")
+	dryRun := fs.Bool("dry-run", false, "list the handles to remove without removing them")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	report, err := cleanup.Clean(tpm, cleanup.Config{
+		OwnerAuth: tpm2.PasswordAuth([]byte(*ownerAuth)),
+		DryRun:    *dryRun,
+	})
+	if report == nil {
+		return err
+	}
+	if c.jsonOutput() {
+		c.rec.Result = report
+		return err
+	}
+	verb := "removed"
+	if *dryRun {
+		verb = "to remove"
+	}
+	for _, kind := range []struct {
+		name    string
+		handles []tpm2.TPMHandle
+	}{
+		{"transient", report.Transient},
+		{"session", report.Sessions},
+		{"persistent", report.Persistent},
+		{"nv", report.NVIndexes},
+	} {
+		for _, h := range kind.handles {
+			fmt.Fprintf(c.stdout, "%s %s 0x%08x\n", verb, kind.name, uint32(h))
+		}
+	}
+	for _, h := range report.Skipped {
+		fmt.Fprintf(c.stdout, "skipped nv 0x%08x: not removable with owner authorization\n", uint32(h))
+	}
+	return err
+}
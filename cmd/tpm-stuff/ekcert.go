@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+)
+
+func runEKCert(c *cli, args []string) error {
+	fs := c.flagSet("ek-cert")
+	tpmOpts := tpmFlags(fs)
+	keyType := fs.String("type", "rsa", `EK key type: "rsa" or "ecc"`)
+	rootsPath := fs.String("roots", "", "PEM file of the trusted manufacturer roots (default: don't verify the chain)")
+	out := fs.String("out", "-", `file receiving the PEM certificate, "-" for stdout`)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	var alg tpm2.TPMAlgID
+	switch strings.ToLower(*keyType) {
+	case "rsa":
+		alg = tpm2.TPMAlgRSA
+	case "ecc":
+		alg = tpm2.TPMAlgECC
+	default:
+		return fmt.Errorf("%w: %q", ekcert.ErrUnsupportedKeyType, *keyType)
+	}
+	var roots *x509.CertPool
+	if *rootsPath != "" {
+		data, err := c.readInput(*rootsPath)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate found in %s", *rootsPath)
+		}
+	}
+
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	cert, err := ekcert.Verify(tpm, alg, roots)
+	if err != nil {
+		return err
+	}
+	c.rec.Result = struct {
+		Subject       string `json:"subject"`
+		Issuer        string `json:"issuer"`
+		SerialNumber  string `json:"serial_number"`
+		ChainVerified bool   `json:"chain_verified"`
+	}{cert.Subject.String(), cert.Issuer.String(), cert.SerialNumber.String(), roots != nil}
+	return c.writeOutput(*out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/hmac"
+)
+
+func runHMAC(c *cli, args []string) error {
+	fs := c.flagSet("hmac")
+	tpmOpts := tpmFlags(fs)
+	keyPath := fs.String("key", "", "file holding the HMAC secret, imported into the TPM")
+	in := fs.String("in", "-", `file holding the data to authenticate, "-" for stdin`)
+	hash := fs.String("hash", "sha256", "hash algorithm of the HMAC")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if *keyPath == "" {
+		return required(fs, "key")
+	}
+
+	hashAlg, err := parseHash(*hash)
+	if err != nil {
+		return err
+	}
+	key, err := c.readInput(*keyPath)
+	if err != nil {
+		return err
+	}
+	data, err := c.readInput(*in)
+	if err != nil {
+		return err
+	}
+
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	srk, err := newStorageKey(tpm)
+	if err != nil {
+		return err
+	}
+
+	keyHandle, err := hmac.Import(tpm, hmac.ImportConfig{
+		ParentHandle: srk,
+		ParentAuth:   srk.session(nil),
+		HashAlg:      hashAlg,
+		Key:          key,
+	})
+	if err != nil {
+		return err
+	}
+	defer keyHandle.Close() //nolint:errcheck
+	c.addHandle("srk", srk)
+	c.addHandle("hmac", keyHandle)
+
+	mac, err := tpmutil.Hmac(tpm, tpmutil.HmacConfig{
+		KeyHandle: keyHandle,
+		HashAlg:   hashAlg,
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to compute HMAC: %w", err)
+	}
+	if c.jsonOutput() {
+		c.rec.Result = struct {
+			HMAC []byte `json:"hmac"`
+		}{mac}
+		return nil
+	}
+	fmt.Fprintf(c.stdout, "%x\n", mac)
+	return nil
+}
@@ -0,0 +1,264 @@
+// Command tpm-stuff exposes the packages of this repository as a single
+// command line tool.
+//
+// Usage:
+//
+//	tpm-stuff <command> [flags]
+//
+// Every command talking to a TPM accepts the -tpm flag, which selects the
+// TPM with the same syntax as the demos: "simulator", "/dev/tpmrm0",
+// "mssim:127.0.0.1:2321" or "127.0.0.1:2321" (see tpmopen.Open).
+//
+// With -interactive, each command sent to the TPM is decoded on stderr, with
+// the parameters travelling encrypted and in clear highlighted, and the tool
+// waits for Enter before sending it: a guided walkthrough of what session
+// encryption protects.
+//
+// With -output json, each command writes a single JSON record on stdout
+// holding the handles, names and public areas of the objects involved, the
+// command specific result and the elapsed time, so that runs can be scripted
+// and diffed.
+//
+// Note: the in-process simulator is created anew by each invocation, so
+// objects sealed or NV indexes written with "-tpm simulator" don't survive
+// the command.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/tpmopen"
+	"github.com/loicsikidi/tpm-stuff/tracing"
+)
+
+// errUsage is returned when the command line is invalid; the usage has
+// already been printed.
+var errUsage = errors.New("invalid usage")
+
+// command is a subcommand of the tool.
+type command struct {
+	name    string
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+var commands = []command{
+	{"seal", "seal data to the TPM", runSeal},
+	{"unseal", "unseal data sealed with the seal command", runUnseal},
+	{"quote", "quote PCRs with an attestation key", runQuote},
+	{"verify-quote", "verify a quote produced by the quote command", runVerifyQuote},
+	{"hmac", "compute an HMAC with an imported key", runHMAC},
+	{"nv", "read, write or list NV indexes (nv read|write|list)", runNV},
+	{"session-bench", "time key creation through each session type", runSessionBench},
+	{"ek-cert", "read and verify the EK certificate", runEKCert},
+	{"provision", "provision the SRK, EK, AK, NV indexes and hierarchy auths", runProvision},
+	{"cleanup", "remove the objects and NV indexes left behind by demos and tests", runCleanup},
+}
+
+// cli holds the I/O of the tool, so that commands can be run in tests.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	// open opens the TPM selected by the -tpm flag.
+	open func(path string) (transport.TPMCloser, error)
+	// stdinUsed is set once the input of the command is read from stdin.
+	stdinUsed bool
+	// output is the format selected by the -output flag.
+	output string
+	// rec is the record of the running command, written with -output json.
+	rec *record
+}
+
+func main() {
+	c := &cli{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		open:   tpmopen.Open,
+	}
+	if err := c.run(os.Args[1:]); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "tpm-stuff: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run dispatches args to the matching command.
+func (c *cli) run(args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		c.usage()
+		return errUsage
+	}
+	i := slices.IndexFunc(commands, func(cmd command) bool { return cmd.name == args[0] })
+	if i < 0 {
+		fmt.Fprintf(c.stderr, "unknown command %q\n\n", args[0])
+		c.usage()
+		return errUsage
+	}
+	c.output = outputText
+	c.rec = &record{Command: commands[i].name}
+	start := time.Now()
+	err := commands[i].run(c, args[1:])
+	if c.jsonOutput() && !errors.Is(err, errUsage) {
+		return c.emit(start, err)
+	}
+	return err
+}
+
+func (c *cli) usage() {
+	fmt.Fprintln(c.stderr, "Usage: tpm-stuff <command> [flags]")
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, `Run "tpm-stuff <command> -h" for the flags of a command.`)
+}
+
+// flagSet returns the flag set of a command.
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.StringVar(&c.output, "output", outputText, `output format: "text" or "json" (a single JSON record on stdout)`)
+	return fs
+}
+
+// tpmOptions holds the flags shared by the commands talking to a TPM.
+type tpmOptions struct {
+	path        string
+	interactive bool
+}
+
+// tpmFlags registers the shared -tpm and -interactive flags on fs.
+func tpmFlags(fs *flag.FlagSet) *tpmOptions {
+	opts := &tpmOptions{}
+	fs.StringVar(&opts.path, "tpm", tpmopen.Simulator, `TPM to use: "simulator", a device such as /dev/tpmrm0, "mssim:host:port" or "host:port"`)
+	fs.BoolVar(&opts.interactive, "interactive", false, "print each decoded command, highlighting encrypted parameters, and wait for Enter before sending it")
+	return opts
+}
+
+// openTPM opens the TPM selected by opts. In interactive mode, the commands
+// are traced to stderr and stepped through with stdin.
+func (c *cli) openTPM(opts *tpmOptions) (transport.TPMCloser, error) {
+	if opts.interactive && c.stdinUsed {
+		return nil, errors.New("-interactive reads stdin: pass the input with a file")
+	}
+	tpm, err := c.open(opts.path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.interactive {
+		return tracing.Wrap(tpm, c.stderr, tracing.Config{Pause: c.stdin}), nil
+	}
+	return tpm, nil
+}
+
+// parse parses args into fs; positional arguments are rejected.
+func (c *cli) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if c.output != outputText && c.output != outputJSON {
+		fmt.Fprintf(fs.Output(), "invalid -output %q\n", c.output)
+		fs.Usage()
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %v\n", fs.Args())
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// required reports a missing mandatory flag.
+func required(fs *flag.FlagSet, name string) error {
+	fmt.Fprintf(fs.Output(), "flag -%s is required\n", name)
+	fs.Usage()
+	return errUsage
+}
+
+// readInput reads path, or stdin when path is "-".
+func (c *cli) readInput(path string) ([]byte, error) {
+	if path == "-" {
+		c.stdinUsed = true
+		return io.ReadAll(c.stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// writeOutput writes data to path, or stdout when path is "-". With -output
+// json, data meant for stdout goes to the record instead.
+func (c *cli) writeOutput(path string, data []byte) error {
+	if path == "-" && c.jsonOutput() {
+		c.rec.Data = data
+		return nil
+	}
+	if path == "-" {
+		_, err := c.stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// parseHash parses a hash algorithm name such as "sha256".
+func parseHash(name string) (tpm2.TPMAlgID, error) {
+	switch strings.ToLower(name) {
+	case "sha1":
+		return tpm2.TPMAlgSHA1, nil
+	case "sha256":
+		return tpm2.TPMAlgSHA256, nil
+	case "sha384":
+		return tpm2.TPMAlgSHA384, nil
+	case "sha512":
+		return tpm2.TPMAlgSHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported hash algorithm %q", name)
+	}
+}
+
+// parsePCRs parses a comma separated list of PCR indexes such as "0,1,7".
+func parsePCRs(list string) ([]uint, error) {
+	var pcrs []uint
+	for _, s := range strings.Split(list, ",") {
+		idx, err := strconv.ParseUint(strings.TrimSpace(s), 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PCR index %q", s)
+		}
+		pcrs = append(pcrs, uint(idx))
+	}
+	slices.Sort(pcrs)
+	return slices.Compact(pcrs), nil
+}
+
+// parseHandle parses a handle written in hexadecimal, e.g. "0x1500016".
+func parseHandle(s string) (tpm2.TPMHandle, error) {
+	h, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid handle %q", s)
+	}
+	return tpm2.TPMHandle(h), nil
+}
+
+// parseHex decodes an optional hexadecimal flag value.
+func parseHex(name, s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -%s: %w", name, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/provision"
+	"github.com/stretchr/testify/require"
+)
+
+// nopCloser shares a single simulator between several commands, which would
+// otherwise each get a fresh TPM.
+type nopCloser struct {
+	transport.TPM
+}
+
+func (nopCloser) Close() error { return nil }
+
+// newTestCLI returns a cli whose commands all run on the same simulator.
+func newTestCLI(t *testing.T) *cli {
+	tpm := testutil.OpenSimulator(t)
+	return &cli{
+		stdin:  strings.NewReader(""),
+		stdout: &bytes.Buffer{},
+		stderr: &bytes.Buffer{},
+		open: func(string) (transport.TPMCloser, error) {
+			return nopCloser{tpm}, nil
+		},
+	}
+}
+
+// exec runs args with stdin and returns stdout.
+func (c *cli) exec(stdin string, args ...string) (string, error) {
+	c.stdin = strings.NewReader(stdin)
+	c.stdinUsed = false
+	out := c.stdout.(*bytes.Buffer)
+	out.Reset()
+	err := c.run(args)
+	return out.String(), err
+}
+
+func TestUsage(t *testing.T) {
+	c := newTestCLI(t)
+
+	_, err := c.exec("")
+	require.ErrorIs(t, err, errUsage)
+	_, err = c.exec("", "unknown")
+	require.ErrorIs(t, err, errUsage)
+	_, err = c.exec("", "unseal")
+	require.ErrorIs(t, err, errUsage, "-in is required")
+	_, err = c.exec("", "nv", "delete")
+	require.ErrorIs(t, err, errUsage)
+}
+
+func TestSealUnseal(t *testing.T) {
+	c := newTestCLI(t)
+	blob := filepath.Join(t.TempDir(), "sealed.json")
+
+	_, err := c.exec("secret", "seal", "-out", blob, "-auth", "pass")
+	require.NoError(t, err)
+
+	out, err := c.exec("", "unseal", "-in", blob, "-auth", "pass")
+	require.NoError(t, err)
+	require.Equal(t, "secret", out)
+
+	_, err = c.exec("", "unseal", "-in", blob, "-auth", "wrong")
+	require.Error(t, err)
+}
+
+func TestSealInteractive(t *testing.T) {
+	c := newTestCLI(t)
+	dir := t.TempDir()
+	data, blob := filepath.Join(dir, "data"), filepath.Join(dir, "sealed.json")
+	require.NoError(t, c.writeOutput(data, []byte("secret")))
+
+	_, err := c.exec("secret", "seal", "-interactive", "-out", blob)
+	require.Error(t, err, "stdin can't be both the input and the prompt")
+
+	_, err = c.exec(strings.Repeat("\n", 10), "seal", "-interactive", "-in", data, "-out", blob)
+	require.NoError(t, err)
+	trace := c.stderr.(*bytes.Buffer).String()
+	require.Contains(t, trace, "press Enter to send...")
+	require.Contains(t, trace, "[encrypted] inSensitive")
+	require.NotContains(t, trace, "secret")
+}
+
+func TestJSONOutput(t *testing.T) {
+	c := newTestCLI(t)
+	blob := filepath.Join(t.TempDir(), "sealed.json")
+
+	_, err := c.exec("", "seal", "-output", "yaml", "-out", blob)
+	require.ErrorIs(t, err, errUsage)
+
+	out, err := c.exec("secret", "seal", "-output", "json", "-out", blob)
+	require.NoError(t, err)
+	var rec record
+	require.NoError(t, json.Unmarshal([]byte(out), &rec))
+	require.Equal(t, "seal", rec.Command)
+	require.Len(t, rec.Objects, 2)
+	require.Equal(t, "srk", rec.Objects[0].Role)
+	require.Equal(t, "0x81000001", rec.Objects[0].Handle, "the SRK is provisioned")
+	require.Equal(t, "sealed", rec.Objects[1].Role)
+	require.Empty(t, rec.Objects[1].Handle, "the sealed object isn't loaded")
+	sealedPub, err := tpm2.Unmarshal[tpm2.TPMTPublic](rec.Objects[1].Public)
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMAlgKeyedHash, sealedPub.Type)
+	require.Positive(t, rec.ElapsedNS)
+
+	out, err = c.exec("", "unseal", "-output", "json", "-in", blob)
+	require.NoError(t, err)
+	rec = record{}
+	require.NoError(t, json.Unmarshal([]byte(out), &rec))
+	require.Equal(t, []byte("secret"), rec.Data)
+
+	out, err = c.exec("", "unseal", "-output", "json", "-in", blob, "-auth", "wrong")
+	require.Error(t, err)
+	rec = record{}
+	require.NoError(t, json.Unmarshal([]byte(out), &rec))
+	require.Contains(t, rec.Error, "TPM_RC_BAD_AUTH")
+}
+
+func TestQuote(t *testing.T) {
+	c := newTestCLI(t)
+	quote := filepath.Join(t.TempDir(), "quote.json")
+	nonce := "00112233445566778899aabbccddeeff"
+
+	_, err := c.exec("", "quote", "-pcrs", "7,0", "-nonce", nonce, "-out", quote)
+	require.NoError(t, err)
+
+	out, err := c.exec("", "verify-quote", "-in", quote, "-nonce", nonce)
+	require.NoError(t, err)
+	require.Contains(t, out, "quote OK")
+	require.Contains(t, out, "PCR[0]")
+	require.Contains(t, out, "PCR[7]")
+
+	_, err = c.exec("", "verify-quote", "-in", quote, "-nonce", "ff")
+	require.Error(t, err)
+	_, err = c.exec("", "verify-quote", "-in", quote, "-ak-name", "00")
+	require.Error(t, err)
+}
+
+func TestHMAC(t *testing.T) {
+	c := newTestCLI(t)
+	key := []byte("0123456789abcdef0123456789abcdef")
+	keyPath := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, c.writeOutput(keyPath, key))
+
+	out, err := c.exec("data", "hmac", "-key", keyPath)
+	require.NoError(t, err)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("data"))
+	require.Equal(t, hex.EncodeToString(mac.Sum(nil))+"\n", out)
+}
+
+func TestNV(t *testing.T) {
+	c := newTestCLI(t)
+
+	_, err := c.exec("hello", "nv", "write", "-index", "0x1500016", "-auth", "pass")
+	require.Error(t, err, "index is not defined")
+
+	_, err = c.exec("hello", "nv", "write", "-index", "0x1500016", "-auth", "pass", "-define")
+	require.NoError(t, err)
+
+	out, err := c.exec("", "nv", "read", "-index", "0x1500016", "-auth", "pass")
+	require.NoError(t, err)
+	require.Equal(t, "hello", out)
+}
+
+func TestSessionBench(t *testing.T) {
+	c := newTestCLI(t)
+
+	out, err := c.exec("", "session-bench", "-n", "2")
+	require.NoError(t, err)
+	for _, name := range []string{"password", "unbound", "bound", "salted"} {
+		require.Contains(t, out, name)
+	}
+}
+
+func TestEKCert(t *testing.T) {
+	c := newTestCLI(t)
+
+	// The simulator isn't provisioned with EK certificates.
+	_, err := c.exec("", "ek-cert", "-type", "ecc")
+	require.Error(t, err)
+	_, err = c.exec("", "ek-cert", "-type", "dsa")
+	require.Error(t, err)
+}
+
+func TestProvision(t *testing.T) {
+	c := newTestCLI(t)
+
+	out, err := c.exec("", "provision", "-owner-auth", "owner-password")
+	require.NoError(t, err)
+	var report provision.Report
+	require.NoError(t, json.Unmarshal([]byte(out), &report))
+	require.Equal(t, provision.AKHandle, report.AK.Handle)
+	require.Equal(t, []string{"owner"}, report.AuthSet)
+
+	// The owner authorization value is already set.
+	_, err = c.exec("", "provision", "-owner-auth", "owner-password")
+	require.Error(t, err)
+}
+
+func TestNVList(t *testing.T) {
+	c := newTestCLI(t)
+
+	_, err := c.exec("hello", "nv", "write", "-index", "0x1000016", "-auth", "pass", "-define")
+	require.NoError(t, err)
+
+	out, err := c.exec("", "nv", "list")
+	require.NoError(t, err)
+	require.Contains(t, out, "0x01000016 ordinary 5 bytes ownerwrite|authwrite|ownerread|authread|written (range of the TPM owner)")
+}
+
+func TestCleanup(t *testing.T) {
+	c := newTestCLI(t)
+
+	_, err := c.exec("hello", "nv", "write", "-index", "0x1500016", "-define")
+	require.NoError(t, err)
+
+	out, err := c.exec("", "cleanup", "-dry-run")
+	require.NoError(t, err)
+	require.Equal(t, "to remove nv 0x01500016\n", out)
+
+	out, err = c.exec("", "cleanup")
+	require.NoError(t, err)
+	require.Equal(t, "removed nv 0x01500016\n", out)
+
+	out, err = c.exec("", "cleanup")
+	require.NoError(t, err)
+	require.Empty(t, out)
+}
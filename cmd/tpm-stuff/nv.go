@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/capability"
+	"github.com/loicsikidi/tpm-stuff/nv"
+)
+
+func runNV(c *cli, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(c.stderr, "Usage: tpm-stuff nv read|write|list [flags]")
+		return errUsage
+	}
+	switch args[0] {
+	case "read":
+		return runNVRead(c, args[1:])
+	case "write":
+		return runNVWrite(c, args[1:])
+	case "list":
+		return runNVList(c, args[1:])
+	default:
+		fmt.Fprintf(c.stderr, "unknown nv command %q\n", args[0])
+		fmt.Fprintln(c.stderr, "Usage: tpm-stuff nv read|write|list [flags]")
+		return errUsage
+	}
+}
+
+// addIndex adds an NV index to the record.
+func (c *cli) addIndex(idx *nv.Index) {
+	c.rec.Objects = append(c.rec.Objects, object{
+		Role:   "nv",
+		Handle: fmt.Sprintf("0x%08x", uint32(idx.Handle)),
+		Name:   idx.Name.Buffer,
+	})
+}
+
+func runNVRead(c *cli, args []string) error {
+	c.rec.Command = "nv read"
+	fs := c.flagSet("nv read")
+	tpmOpts := tpmFlags(fs)
+	index := fs.String("index", "", "NV index handle, in hexadecimal (e.g. 0x1500016)")
+	auth := fs.String("auth", "", "authorization value of the index")
+	out := fs.String("out", "-", `file receiving the data, "-" for stdout`)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if *index == "" {
+		return required(fs, "index")
+	}
+	handle, err := parseHandle(*index)
+	if err != nil {
+		return err
+	}
+
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	idx, err := nv.Open(tpm, handle)
+	if err != nil {
+		return err
+	}
+	c.addIndex(idx)
+	data, err := nv.Read(tpm, idx, tpm2.PasswordAuth([]byte(*auth)))
+	if err != nil {
+		return err
+	}
+	return c.writeOutput(*out, data)
+}
+
+func runNVWrite(c *cli, args []string) error {
+	c.rec.Command = "nv write"
+	fs := c.flagSet("nv write")
+	tpmOpts := tpmFlags(fs)
+	index := fs.String("index", "", "NV index handle, in hexadecimal (e.g. 0x1500016)")
+	auth := fs.String("auth", "", "authorization value of the index")
+	in := fs.String("in", "-", `file holding the data, "-" for stdin`)
+	define := fs.Bool("define", false, "define the index, sized to the data, if it doesn't exist")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if *index == "" {
+		return required(fs, "index")
+	}
+	handle, err := parseHandle(*index)
+	if err != nil {
+		return err
+	}
+	data, err := c.readInput(*in)
+	if err != nil {
+		return err
+	}
+
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	idx, err := nv.Open(tpm, handle)
+	if errors.Is(err, tpm2.TPMRCHandle) && *define {
+		idx, err = nv.Define(tpm, nv.DefineConfig{
+			Index: handle,
+			Size:  uint16(len(data)),
+			Auth:  []byte(*auth),
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if err := nv.Write(tpm, idx, data, tpm2.PasswordAuth([]byte(*auth))); err != nil {
+		return err
+	}
+	// Name of the index after the write, which sets TPMA_NV_WRITTEN.
+	c.addIndex(idx)
+	return nil
+}
+
+func runNVList(c *cli, args []string) error {
+	c.rec.Command = "nv list"
+	fs := c.flagSet("nv list")
+	tpmOpts := tpmFlags(fs)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	handles, err := capability.NVIndices(tpm)
+	if err != nil {
+		return err
+	}
+	descriptions := []*nv.Description{}
+	for _, h := range handles {
+		d, err := nv.Describe(tpm, h)
+		if err != nil {
+			return err
+		}
+		descriptions = append(descriptions, d)
+	}
+	if c.jsonOutput() {
+		c.rec.Result = descriptions
+		return nil
+	}
+	for _, d := range descriptions {
+		fmt.Fprintln(c.stdout, d)
+	}
+	return nil
+}
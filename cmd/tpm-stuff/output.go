@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+)
+
+// Output formats selected by the -output flag.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// record is the machine-readable result of a command, written to stdout as a
+// single JSON object with -output json.
+//
+// Byte slices (names, public areas, data) are encoded in base64, as usual
+// with encoding/json.
+type record struct {
+	Command string `json:"command"`
+	// Objects are the TPM objects and NV indexes used by the command.
+	Objects []object `json:"objects,omitempty"`
+	// Result holds the command specific output.
+	Result any `json:"result,omitempty"`
+	// Data is the output written to stdout in text mode, e.g. unsealed data.
+	Data []byte `json:"data,omitempty"`
+	// Error is the error of a failed command.
+	Error string `json:"error,omitempty"`
+	// ElapsedNS is the duration of the command in nanoseconds, including
+	// opening the TPM.
+	ElapsedNS time.Duration `json:"elapsed_ns"`
+}
+
+// object describes an entity of the TPM.
+type object struct {
+	// Role is the part played by the object, e.g. "srk" or "sealed".
+	Role string `json:"role"`
+	// Handle is the handle of the object, unset when it isn't loaded.
+	Handle string `json:"handle,omitempty"`
+	Name   []byte `json:"name,omitempty"`
+	// Public is the marshaled TPMT_PUBLIC (or TPMS_NV_PUBLIC) of the object.
+	Public []byte `json:"public,omitempty"`
+}
+
+// jsonOutput reports whether the command must write a record rather than
+// text.
+func (c *cli) jsonOutput() bool {
+	return c.output == outputJSON
+}
+
+// addHandle adds a loaded object to the record.
+func (c *cli) addHandle(role string, h tpmutil.Handle) {
+	obj := object{
+		Role:   role,
+		Handle: fmt.Sprintf("0x%08x", uint32(h.Handle())),
+		Name:   h.Name().Buffer,
+	}
+	if h.HasPublic() {
+		obj.Public = tpm2.Marshal(h.Public())
+	}
+	c.rec.Objects = append(c.rec.Objects, obj)
+}
+
+// addPublic adds an object which isn't loaded to the record.
+func (c *cli) addPublic(role string, public *tpm2.TPMTPublic) error {
+	name, err := tpm2.ObjectName(public)
+	if err != nil {
+		return fmt.Errorf("failed to compute %s name: %w", role, err)
+	}
+	c.rec.Objects = append(c.rec.Objects, object{
+		Role:   role,
+		Name:   name.Buffer,
+		Public: tpm2.Marshal(public),
+	})
+	return nil
+}
+
+// emit writes the record of the command to stdout.
+func (c *cli) emit(start time.Time, err error) error {
+	if err != nil {
+		c.rec.Error = err.Error()
+	}
+	c.rec.ElapsedNS = time.Since(start)
+	data, marshalErr := json.Marshal(c.rec)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	_, writeErr := fmt.Fprintf(c.stdout, "%s\n", data)
+	if err != nil {
+		return err
+	}
+	return writeErr
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/provision"
+)
+
+// runProvision provisions a TPM with empty hierarchy authorization values in
+// one pass (see provision.Device) and writes the provisioning report.
+func runProvision(c *cli, args []string) error {
+	fs := c.flagSet("provision")
+	tpmOpts := tpmFlags(fs)
+	ownerAuth := fs.String("owner-auth", "", "authorization value set on the owner hierarchy")
+	endorsementAuth := fs.String("endorsement-auth", "", "authorization value set on the endorsement hierarchy")
+	lockoutAuth := fs.String("lockout-auth", "", "authorization value set on the lockout hierarchy")
+	out := fs.String("out", "-", `file receiving the JSON provisioning report, "-" for stdout`)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	report, err := provision.Device(tpm, provision.DeviceConfig{
+		OwnerAuth:       []byte(*ownerAuth),
+		EndorsementAuth: []byte(*endorsementAuth),
+		LockoutAuth:     []byte(*lockoutAuth),
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range []struct {
+		role   string
+		report provision.KeyReport
+	}{{"srk", report.SRK}, {"ek", report.EK}, {"ak", report.AK}} {
+		key, err := tpmutil.ToHandle(tpm, k.report.Handle)
+		if err != nil {
+			return err
+		}
+		c.addHandle(k.role, key)
+	}
+
+	if c.jsonOutput() {
+		c.rec.Result = report
+		if *out == "-" {
+			return nil
+		}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return c.writeOutput(*out, append(data, '\n'))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+)
+
+// quoteFile is the output of the quote command and the input of
+// verify-quote.
+type quoteFile struct {
+	Params *attestation.Params      `json:"params"`
+	Nonce  []byte                   `json:"nonce"`
+	Quote  *attestation.QuoteResult `json:"quote"`
+}
+
+func runQuote(c *cli, args []string) error {
+	fs := c.flagSet("quote")
+	tpmOpts := tpmFlags(fs)
+	pcrs := fs.String("pcrs", "0,1,2,3,4,5,6,7", "comma separated list of PCRs to quote")
+	bank := fs.String("bank", "sha256", "PCR bank to quote")
+	nonceHex := fs.String("nonce", "", "hex encoded nonce provided by the verifier (default: random)")
+	out := fs.String("out", "-", `file receiving the quote, "-" for stdout`)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	req := &attestation.QuoteRequest{}
+	var err error
+	if req.PCRs, err = parsePCRs(*pcrs); err != nil {
+		return err
+	}
+	alg, err := parseHash(*bank)
+	if err != nil {
+		return err
+	}
+	req.Bank = tpmjson.AlgID(alg)
+	if req.Nonce, err = parseHex("nonce", *nonceHex); err != nil {
+		return err
+	}
+	if len(req.Nonce) == 0 {
+		req.Nonce = make([]byte, 32)
+		if _, err := rand.Read(req.Nonce); err != nil {
+			return err
+		}
+	}
+
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	attester, err := attestation.NewAttester(tpm)
+	if err != nil {
+		return err
+	}
+	defer attester.Close() //nolint:errcheck
+
+	params, err := attester.Params()
+	if err != nil {
+		return err
+	}
+	quote, err := attester.Quote(req)
+	if err != nil {
+		return err
+	}
+	ek, ak, err := attestation.ParseParams(params)
+	if err != nil {
+		return err
+	}
+	if err := c.addPublic("ek", ek); err != nil {
+		return err
+	}
+	if err := c.addPublic("ak", ak); err != nil {
+		return err
+	}
+
+	qf := quoteFile{Params: params, Nonce: req.Nonce, Quote: quote}
+	if c.jsonOutput() {
+		c.rec.Result = qf
+		if *out == "-" {
+			return nil
+		}
+	}
+	data, err := json.MarshalIndent(qf, "", "  ")
+	if err != nil {
+		return err
+	}
+	return c.writeOutput(*out, append(data, '\n'))
+}
+
+// runVerifyQuote checks a quote offline: it doesn't need a TPM.
+//
+// The AK is read from the quote file, so its Name must be checked against a
+// trusted value (e.g. one attested through the EK, see attestation.Verify)
+// for the result to be meaningful.
+func runVerifyQuote(c *cli, args []string) error {
+	fs := c.flagSet("verify-quote")
+	in := fs.String("in", "-", `file holding the quote, "-" for stdin`)
+	nonceHex := fs.String("nonce", "", "hex encoded nonce expected in the quote (default: the nonce recorded in the file, which doesn't prove freshness)")
+	akName := fs.String("ak-name", "", "hex encoded Name of the trusted AK (default: trust the AK of the file)")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	data, err := c.readInput(*in)
+	if err != nil {
+		return err
+	}
+	var q quoteFile
+	if err := json.Unmarshal(data, &q); err != nil {
+		return fmt.Errorf("failed to parse quote file: %w", err)
+	}
+	if q.Params == nil || q.Quote == nil {
+		return fmt.Errorf("failed to parse quote file: missing params or quote")
+	}
+	nonce, err := parseHex("nonce", *nonceHex)
+	if err != nil {
+		return err
+	}
+	if len(nonce) == 0 {
+		nonce = q.Nonce
+	}
+
+	_, ak, err := attestation.ParseParams(q.Params)
+	if err != nil {
+		return err
+	}
+	if *akName != "" && *akName != hex.EncodeToString(q.Params.AKName) {
+		return fmt.Errorf("%w: AK name %x", attestation.ErrInvalidAK, q.Params.AKName)
+	}
+	if err := attestation.VerifyQuote(ak, nonce, q.Quote); err != nil {
+		return err
+	}
+
+	if err := c.addPublic("ak", ak); err != nil {
+		return err
+	}
+	if c.jsonOutput() {
+		c.rec.Result = q.Quote.Values
+		return nil
+	}
+	fmt.Fprintf(c.stdout, "quote OK (AK name %x)\n", q.Params.AKName)
+	for _, v := range q.Quote.Values {
+		fmt.Fprintf(c.stdout, "PCR[%d] = %x\n", v.Index, v.Digest)
+	}
+	return nil
+}
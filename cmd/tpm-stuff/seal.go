@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/provision"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sessions"
+	"github.com/loicsikidi/tpm-stuff/templates"
+)
+
+// sealTemplate is the template of sealed data objects.
+var sealTemplate = templates.Seal(templates.WithNoDA())
+
+// storageKey holds the SRK, provisioned at its well-known persistent handle
+// by the first command, and the session factory used to protect the
+// parameters sent under it.
+type storageKey struct {
+	persistentKey
+	factory sessions.Factory
+}
+
+// persistentKey lets storageKey embed a tpmutil.Handle: the field would
+// otherwise be named Handle, hiding the method.
+type persistentKey = tpmutil.Handle
+
+func newStorageKey(tpm transport.TPM) (*storageKey, error) {
+	factory, err := sessions.Negotiate(tpm)
+	if err != nil {
+		return nil, err
+	}
+	srk, err := provision.EnsureSRK(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision SRK: %w", err)
+	}
+	return &storageKey{persistentKey: srk, factory: factory}, nil
+}
+
+// session returns an inline session salted with the SRK, authorizing with
+// authValue and encrypting the first command and response parameters.
+func (k *storageKey) session(authValue []byte) tpm2.Session {
+	return k.factory.HMAC(tpm2.Salted(k.Handle(), *k.Public()), tpm2.Auth(authValue))
+}
+
+// unsealSession is like session but only encrypts the response, since
+// TPM2_Unseal has no command parameter to encrypt.
+func (k *storageKey) unsealSession(authValue []byte) tpm2.Session {
+	return tpm2.HMAC(k.factory.Hash, k.factory.NonceSize(),
+		tpm2.Salted(k.Handle(), *k.Public()),
+		tpm2.Auth(authValue),
+		tpm2.AESEncryption(k.factory.AESKeyBits, tpm2.EncryptOut))
+}
+
+func runSeal(c *cli, args []string) error {
+	fs := c.flagSet("seal")
+	tpmOpts := tpmFlags(fs)
+	in := fs.String("in", "-", `file holding the data to seal (at most 128 bytes), "-" for stdin`)
+	out := fs.String("out", "", "file receiving the sealed object")
+	auth := fs.String("auth", "", "authorization value required to unseal")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return required(fs, "out")
+	}
+
+	data, err := c.readInput(*in)
+	if err != nil {
+		return err
+	}
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	srk, err := newStorageKey(tpm)
+	if err != nil {
+		return err
+	}
+
+	result, err := tpmutil.CreateWithResult(tpm, tpmutil.CreateConfig{
+		ParentHandle: srk,
+		ParentAuth:   srk.session(nil),
+		InPublic:     sealTemplate,
+		UserAuth:     []byte(*auth),
+		SealingData:  data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to seal data: %w", err)
+	}
+	c.addHandle("srk", srk)
+	sealedPub, err := result.OutPublic.Contents()
+	if err != nil {
+		return err
+	}
+	if err := c.addPublic("sealed", sealedPub); err != nil {
+		return err
+	}
+	blob, err := result.Marshal()
+	if err != nil {
+		return err
+	}
+	return c.writeOutput(*out, blob)
+}
+
+func runUnseal(c *cli, args []string) error {
+	fs := c.flagSet("unseal")
+	tpmOpts := tpmFlags(fs)
+	in := fs.String("in", "", "file holding the sealed object")
+	out := fs.String("out", "-", `file receiving the unsealed data, "-" for stdout`)
+	auth := fs.String("auth", "", "authorization value given to seal")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return required(fs, "in")
+	}
+
+	sealed, err := tpmutil.LoadCreateResult(*in)
+	if err != nil {
+		return err
+	}
+	tpm, err := c.openTPM(tpmOpts)
+	if err != nil {
+		return fmt.Errorf("can't open TPM: %w", err)
+	}
+	defer tpm.Close() //nolint:errcheck
+
+	srk, err := newStorageKey(tpm)
+	if err != nil {
+		return err
+	}
+
+	item, err := tpmutil.Load(tpm, tpmutil.LoadConfig{
+		ParentHandle: srk,
+		InPrivate:    sealed.OutPrivate,
+		InPublic:     sealed.OutPublic,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load sealed object: %w", err)
+	}
+	defer item.Close() //nolint:errcheck
+	c.addHandle("srk", srk)
+	c.addHandle("sealed", item)
+
+	rsp, err := tpm2.Unseal{
+		ItemHandle: tpmutil.ToAuthHandle(item, srk.unsealSession([]byte(*auth))),
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to unseal data: %w", err)
+	}
+	return c.writeOutput(*out, rsp.OutData.Buffer)
+}
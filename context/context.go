@@ -0,0 +1,127 @@
+// Package context saves transient objects out of the TPM (TPM2_ContextSave)
+// and loads them back (TPM2_ContextLoad).
+//
+// A saved context is encrypted and integrity protected by the TPM: it can be
+// stored on disk, e.g. so a long-running demo survives a process restart
+// without recreating its primary keys, or swapped out of the TPM when its
+// object slots are exhausted. A context is only valid for the TPM which saved
+// it, until the next TPM Reset (or TPM Restart for objects with the stClear
+// attribute): [Load] then fails with [ErrInvalidContext].
+//
+// Note: this package name shadows the standard library's; import it under
+// another name (e.g. tpmcontext) when both are needed.
+package context
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+)
+
+// ErrInvalidContext is returned by [Load] when the TPM rejects a saved
+// context, typically because it was saved before a TPM Reset or by another
+// TPM.
+var ErrInvalidContext = errors.New("saved context is no longer valid")
+
+// Save saves the context of the transient object h. The object stays loaded
+// and must still be flushed by the caller.
+func Save(tpm transport.TPM, h tpmutil.Handle) (*tpm2.TPMSContext, error) {
+	if h == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+	rsp, err := tpm2.ContextSave{SaveHandle: h.Handle()}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save context of 0x%x: %w", h.Handle(), err)
+	}
+	return &rsp.Context, nil
+}
+
+// SwapOut saves the context of the transient object h then flushes it,
+// freeing its object slot until it is loaded back with [Load].
+func SwapOut(tpm transport.TPM, h tpmutil.Handle) (*tpm2.TPMSContext, error) {
+	saved, err := Save(tpm, h)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := (tpm2.FlushContext{FlushHandle: h.Handle()}).Execute(tpm); err != nil {
+		return nil, fmt.Errorf("failed to flush 0x%x: %w", h.Handle(), err)
+	}
+	return saved, nil
+}
+
+// Load loads a saved context back into the TPM. The returned handle,
+// usually different from the saved one, must be closed by the caller.
+func Load(tpm transport.TPM, saved *tpm2.TPMSContext) (tpmutil.HandleCloser, error) {
+	if saved == nil {
+		return nil, fmt.Errorf("missing saved context")
+	}
+	rsp, err := tpm2.ContextLoad{Context: *saved}.Execute(tpm)
+	if err != nil {
+		// The integrity check fails when the context was protected by a
+		// previous TPM Reset's keys.
+		if errors.Is(err, tpm2.TPMRCIntegrity) || errors.Is(err, tpm2.TPMRCHandle) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidContext, err)
+		}
+		return nil, fmt.Errorf("failed to load context: %w", err)
+	}
+	pub, err := tpm2.ReadPublic{ObjectHandle: rsp.LoadedHandle}.Execute(tpm)
+	if err != nil {
+		tpm2.FlushContext{FlushHandle: rsp.LoadedHandle}.Execute(tpm)
+		return nil, fmt.Errorf("failed to read public area of 0x%x: %w", rsp.LoadedHandle, err)
+	}
+	return tpmutil.NewHandleCloser(tpm, &tpm2.NamedHandle{Handle: rsp.LoadedHandle, Name: pub.Name}), nil
+}
+
+// Marshal encodes a saved context in its TPM wire format.
+func Marshal(saved *tpm2.TPMSContext) []byte {
+	return tpm2.Marshal(saved)
+}
+
+// Unmarshal decodes a saved context encoded by [Marshal].
+func Unmarshal(b []byte) (*tpm2.TPMSContext, error) {
+	saved, err := tpm2.Unmarshal[tpm2.TPMSContext](b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode saved context: %w", err)
+	}
+	return saved, nil
+}
+
+// SaveToFile saves the context of the transient object h to path, readable
+// by the current user only.
+func SaveToFile(tpm transport.TPM, h tpmutil.Handle, path string) error {
+	saved, err := Save(tpm, h)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, Marshal(saved), 0o600); err != nil {
+		return fmt.Errorf("failed to write saved context: %w", err)
+	}
+	return nil
+}
+
+// LoadFromFile loads back the context saved to path by [SaveToFile].
+//
+// Example:
+//
+//	srk, err := tpmcontext.LoadFromFile(tpm, "srk.ctx")
+//	if err != nil {
+//	    srk, err = tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+//	    ...
+//	    err = tpmcontext.SaveToFile(tpm, srk, "srk.ctx")
+//	}
+//	defer srk.Close()
+func LoadFromFile(tpm transport.TPM, path string) (tpmutil.HandleCloser, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved context: %w", err)
+	}
+	saved, err := Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return Load(tpm, saved)
+}
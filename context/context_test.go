@@ -0,0 +1,122 @@
+package context_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-tpm-tools/simulator"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	tpmcontext "github.com/loicsikidi/tpm-stuff/context"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func createSRK(t *testing.T, tpm transport.TPM) tpmutil.HandleCloser {
+	t.Helper()
+	srk, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	return srk
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	srk := createSRK(t, thetpm)
+	defer srk.Close()
+
+	saved, err := tpmcontext.Save(thetpm, srk)
+	require.NoError(t, err)
+
+	// The context survives its encoding.
+	decoded, err := tpmcontext.Unmarshal(tpmcontext.Marshal(saved))
+	require.NoError(t, err)
+
+	loaded, err := tpmcontext.Load(thetpm, decoded)
+	require.NoError(t, err)
+	defer loaded.Close()
+	require.NotEqual(t, srk.Handle(), loaded.Handle())
+	require.Equal(t, srk.Name(), loaded.Name())
+
+	_, err = tpmcontext.Unmarshal([]byte{0x01})
+	require.Error(t, err)
+	_, err = tpmcontext.Save(thetpm, nil)
+	require.ErrorIs(t, err, tpmutil.ErrMissingHandle)
+}
+
+func TestSaveToFile(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	path := filepath.Join(t.TempDir(), "srk.ctx")
+
+	srk := createSRK(t, thetpm)
+	require.NoError(t, tpmcontext.SaveToFile(thetpm, srk, path))
+	name := srk.Name()
+	// As after a process restart, the transient object is gone.
+	require.NoError(t, srk.Close())
+
+	loaded, err := tpmcontext.LoadFromFile(thetpm, path)
+	require.NoError(t, err)
+	defer loaded.Close()
+	require.Equal(t, name, loaded.Name())
+
+	// The loaded key is usable as a parent.
+	child, err := tpmutil.Create(thetpm, tpmutil.CreateConfig{
+		ParentHandle: loaded,
+		InPublic:     tpmutil.ECCSRKTemplate,
+	})
+	require.NoError(t, err)
+	require.NoError(t, child.Close())
+
+	_, err = tpmcontext.LoadFromFile(thetpm, filepath.Join(t.TempDir(), "missing.ctx"))
+	require.Error(t, err)
+}
+
+func TestSwapOut(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	// Fill the object slots.
+	var objects []tpmutil.HandleCloser
+	for {
+		srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+		if err != nil {
+			require.ErrorIs(t, err, tpm2.TPMRCObjectMemory)
+			break
+		}
+		objects = append(objects, srk)
+	}
+	require.NotEmpty(t, objects)
+	defer func() {
+		for _, o := range objects[1:] {
+			o.Close()
+		}
+	}()
+
+	swapped, err := tpmcontext.SwapOut(thetpm, objects[0])
+	require.NoError(t, err)
+
+	// A slot is free again.
+	extra := createSRK(t, thetpm)
+	require.NoError(t, extra.Close())
+
+	loaded, err := tpmcontext.Load(thetpm, swapped)
+	require.NoError(t, err)
+	require.Equal(t, objects[0].Name(), loaded.Name())
+	require.NoError(t, loaded.Close())
+}
+
+func TestLoad_AfterReset(t *testing.T) {
+	sim, err := simulator.Get()
+	require.NoError(t, err)
+	defer sim.Close()
+	thetpm := transport.FromReadWriter(sim)
+
+	srk := createSRK(t, thetpm)
+	saved, err := tpmcontext.Save(thetpm, srk)
+	require.NoError(t, err)
+
+	// TPM Reset: power cycle and TPM2_Startup(TPM_SU_CLEAR).
+	require.NoError(t, sim.Reset())
+
+	_, err = tpmcontext.Load(thetpm, saved)
+	require.ErrorIs(t, err, tpmcontext.ErrInvalidContext)
+}
@@ -0,0 +1,143 @@
+// Package credential delivers secrets to a TPM with the credential protection
+// of TPM2_MakeCredential and TPM2_ActivateCredential.
+//
+// The verifier encrypts a secret to the EK of the device and binds it to the
+// Name of a key (typically the AK) with [Make], in pure Go: no TPM is needed on
+// this side. The device recovers it with [Activate], which the TPM only
+// performs when both the EK and the named key are loaded in it.
+package credential
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+)
+
+// ErrSecretSize is returned by [Make] when the secret is empty or larger than
+// the digest size of the EK name algorithm, the limit of TPM2_ActivateCredential.
+var ErrSecretSize = errors.New("invalid secret size")
+
+// Challenge is a secret protected by TPM2_MakeCredential.
+type Challenge struct {
+	// CredentialBlob is the TPM2B_ID_OBJECT contents.
+	CredentialBlob []byte `json:"credential_blob"`
+	// EncryptedSecret is the TPM2B_ENCRYPTED_SECRET contents.
+	EncryptedSecret []byte `json:"encrypted_secret"`
+}
+
+// Make encrypts secret to the EK ekPub so that it can only be recovered by
+// the TPM holding it, along with an object named objectName. This is the
+// software equivalent of TPM2_MakeCredential.
+//
+// Example:
+//
+//	secret := make([]byte, 32)
+//	rand.Read(secret)
+//	ch, err := credential.Make(ekPub, akName, secret)
+func Make(ekPub *tpm2.TPMTPublic, objectName []byte, secret []byte) (*Challenge, error) {
+	if ekPub == nil {
+		return nil, errors.New("missing EK public area")
+	}
+	if len(objectName) == 0 {
+		return nil, errors.New("missing object name")
+	}
+	ha, err := ekPub.NameAlg.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported EK name algorithm: %w", err)
+	}
+	if len(secret) == 0 || len(secret) > ha.Size() {
+		return nil, fmt.Errorf("%w: %d bytes, expected 1 to %d", ErrSecretSize, len(secret), ha.Size())
+	}
+	key, err := tpm2.ImportEncapsulationKey(ekPub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import EK: %w", err)
+	}
+	idObject, encSecret, err := tpm2.CreateCredential(rand.Reader, key, objectName, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create credential: %w", err)
+	}
+	return &Challenge{
+		CredentialBlob:  idObject,
+		EncryptedSecret: encSecret,
+	}, nil
+}
+
+// ActivateConfig holds configuration for [Activate].
+type ActivateConfig struct {
+	// EndorsementAuth authorizes the endorsement hierarchy, as required by
+	// the policy of the EK templates of the TCG EK Credential Profile.
+	//
+	// Default: empty password.
+	EndorsementAuth []byte
+	// ObjectAuth is the authorization value of the object named by the
+	// challenge.
+	//
+	// Default: empty password.
+	ObjectAuth []byte
+	// EKSession returns the session authorizing the EK.
+	//
+	// Default: a policy session satisfying TPM2_PolicySecret on the
+	// endorsement hierarchy, the policy of the low range EK templates.
+	// High range EKs (PolicyOR) need their own session.
+	EKSession func() tpm2.Session
+}
+
+// CheckAndSetDefault validates and sets default values for ActivateConfig.
+func (c *ActivateConfig) CheckAndSetDefault() error {
+	return nil
+}
+
+// Activate recovers the secret of ch with the EK ek and the object it names.
+//
+// Example:
+//
+//	secret, err := credential.Activate(tpm, ek, ak, ch)
+func Activate(tpm transport.TPM, ek, object tpmutil.Handle, ch *Challenge, optionalCfg ...ActivateConfig) ([]byte, error) {
+	var cfg ActivateConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if ek == nil || object == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+	if ch == nil {
+		return nil, errors.New("missing challenge")
+	}
+	ekSession := cfg.EKSession
+	if ekSession == nil {
+		if !ek.HasPublic() {
+			var err error
+			if ek, err = tpmutil.ToHandle(tpm, ek.Handle()); err != nil {
+				return nil, err
+			}
+		}
+		nameAlg, auth := ek.Public().NameAlg, cfg.EndorsementAuth
+		ekSession = func() tpm2.Session {
+			return tpm2.Policy(nameAlg, 16, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+				_, err := tpm2.PolicySecret{
+					AuthHandle:    tpm2.AuthHandle{Handle: tpm2.TPMRHEndorsement, Auth: tpm2.PasswordAuth(auth)},
+					PolicySession: handle,
+				}.Execute(tpm)
+				return err
+			})
+		}
+	}
+
+	rsp, err := tpm2.ActivateCredential{
+		ActivateHandle: tpmutil.ToAuthHandle(object, tpm2.PasswordAuth(cfg.ObjectAuth)),
+		KeyHandle:      tpmutil.ToAuthHandle(ek, ekSession()),
+		CredentialBlob: tpm2.TPM2BIDObject{Buffer: ch.CredentialBlob},
+		Secret:         tpm2.TPM2BEncryptedSecret{Buffer: ch.EncryptedSecret},
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to activate credential: %w", err)
+	}
+	return rsp.CertInfo.Buffer, nil
+}
@@ -0,0 +1,75 @@
+package credential_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/credential"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeActivate(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	fixtures := testutil.NewFixtures(t, thetpm)
+	ak := fixtures.AK(t)
+
+	secret := bytes.Repeat([]byte{0x42}, 32)
+	for _, tt := range []struct {
+		name string
+		ek   func(testing.TB) tpmutil.Handle
+	}{
+		{"RSA EK", fixtures.EK},
+		{"ECC EK", fixtures.ECCEK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ek := tt.ek(t)
+
+			t.Run("software MakeCredential", func(t *testing.T) {
+				ch, err := credential.Make(ek.Public(), ak.Name().Buffer, secret)
+				require.NoError(t, err)
+				got, err := credential.Activate(thetpm, ek, ak, ch)
+				require.NoError(t, err)
+				require.Equal(t, secret, got)
+			})
+
+			t.Run("TPM MakeCredential", func(t *testing.T) {
+				// Cross-check: the blobs of the TPM and of Make are interchangeable.
+				rsp, err := tpm2.MakeCredential{
+					Handle:     ek.Handle(),
+					Credential: tpm2.TPM2BDigest{Buffer: secret},
+					ObjectName: ak.Name(),
+				}.Execute(thetpm)
+				require.NoError(t, err)
+				got, err := credential.Activate(thetpm, ek, ak, &credential.Challenge{
+					CredentialBlob:  rsp.CredentialBlob.Buffer,
+					EncryptedSecret: rsp.Secret.Buffer,
+				})
+				require.NoError(t, err)
+				require.Equal(t, secret, got)
+			})
+
+			t.Run("other object", func(t *testing.T) {
+				ch, err := credential.Make(ek.Public(), ek.Name().Buffer, secret)
+				require.NoError(t, err)
+				_, err = credential.Activate(thetpm, ek, ak, ch)
+				require.ErrorIs(t, err, tpm2.TPMRCIntegrity)
+			})
+		})
+	}
+}
+
+func TestMake_Errors(t *testing.T) {
+	name := bytes.Repeat([]byte{1}, 34)
+
+	_, err := credential.Make(&tpm2.RSAEKTemplate, name, make([]byte, 33))
+	require.ErrorIs(t, err, credential.ErrSecretSize)
+
+	_, err = credential.Make(&tpm2.RSAEKTemplate, name, nil)
+	require.ErrorIs(t, err, credential.ErrSecretSize)
+
+	_, err = credential.Make(&tpm2.RSAEKTemplate, nil, []byte("secret"))
+	require.Error(t, err)
+}
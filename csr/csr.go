@@ -0,0 +1,227 @@
+// Package csr creates X.509 certificate signing requests (PKCS #10) signed by
+// TPM-resident keys, so that a device can enroll its identity with a CA
+// without the private key ever leaving the TPM.
+package csr
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/keyattest"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+)
+
+// PEMType is the PEM block type of the CSRs returned by [Create].
+const PEMType = "CERTIFICATE REQUEST"
+
+// ErrAttestationMismatch is returned when the key attestation of a CSR
+// doesn't attest the key of the request.
+var ErrAttestationMismatch = errors.New("key attestation doesn't match the CSR key")
+
+// Config holds configuration for [Create].
+type Config struct {
+	// Auth is the authorization value of the key.
+	//
+	// Default: nil.
+	Auth []byte
+	// Session returns the session authorizing TPM2_Sign.
+	//
+	// Default: tpmsigner.EncryptedSession with Auth, which encrypts the
+	// digest of the request on the bus.
+	Session func() tpm2.Session
+	// DNSNames, EmailAddresses, IPAddresses and URIs are the subject
+	// alternative names of the request.
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	// SignatureAlgorithm is the algorithm signing the request.
+	//
+	// Default: the scheme and hash of the key when it has one, else ECDSA
+	// with the hash matching the curve size, or PKCS #1 v1.5 with SHA-256.
+	SignatureAlgorithm x509.SignatureAlgorithm
+	// Attestation proves to the CA that the key was generated by the TPM
+	// (see [keyattest.Certify]): it is appended to the CSR as a PEM block
+	// of type keyattest.PEMType, checked by the CA with [VerifyAttested].
+	// It must attest the key signing the request.
+	//
+	// Default: nil.
+	Attestation *keyattest.Bundle
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	return nil
+}
+
+// Create returns a PEM encoded CSR for subject, signed by the unrestricted
+// signing key keyHandle.
+//
+// Example:
+//
+//	pemCSR, err := csr.Create(tpm, key, pkix.Name{CommonName: "device-42"}, csr.Config{
+//	    DNSNames: []string{"device-42.example.com"},
+//	})
+func Create(tpm transport.TPM, keyHandle tpmutil.Handle, subject pkix.Name, optionalCfg ...Config) ([]byte, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	signer, err := tpmsigner.New(tpm, tpmsigner.Config{
+		KeyHandle: keyHandle,
+		Auth:      cfg.Auth,
+		Session:   cfg.Session,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Attestation != nil {
+		if err := sameKey(cfg.Attestation, signer.Public()); err != nil {
+			return nil, err
+		}
+	}
+	sigAlg := cfg.SignatureAlgorithm
+	if sigAlg == x509.UnknownSignatureAlgorithm {
+		if sigAlg, err = signatureAlgorithm(tpm, keyHandle, signer); err != nil {
+			return nil, err
+		}
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:            subject,
+		DNSNames:           cfg.DNSNames,
+		EmailAddresses:     cfg.EmailAddresses,
+		IPAddresses:        cfg.IPAddresses,
+		URIs:               cfg.URIs,
+		SignatureAlgorithm: sigAlg,
+	}, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CSR: %w", err)
+	}
+	out := pem.EncodeToMemory(&pem.Block{Type: PEMType, Bytes: der})
+	if cfg.Attestation != nil {
+		attestation, err := cfg.Attestation.PEM()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode key attestation: %w", err)
+		}
+		out = append(out, attestation...)
+	}
+	return out, nil
+}
+
+// VerifyAttested parses a CSR created by [Create] with an attestation, checks
+// its signature and that the attestation proves, per cfg, that its key was
+// generated by a TPM.
+func VerifyAttested(data []byte, cfg keyattest.VerifyConfig) (*x509.CertificateRequest, *keyattest.Result, error) {
+	var req *x509.CertificateRequest
+	var bundle *keyattest.Bundle
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		var err error
+		switch block.Type {
+		case PEMType:
+			if req, err = x509.ParseCertificateRequest(block.Bytes); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse CSR: %w", err)
+			}
+		case keyattest.PEMType:
+			if bundle, err = keyattest.Unmarshal(block.Bytes); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if req == nil {
+		return nil, nil, errors.New("no CSR found")
+	}
+	if bundle == nil {
+		return nil, nil, errors.New("no key attestation found")
+	}
+	if err := req.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("invalid CSR signature: %w", err)
+	}
+	res, err := keyattest.Verify(bundle, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := sameKey(bundle, req.PublicKey); err != nil {
+		return nil, nil, err
+	}
+	return req, res, nil
+}
+
+// sameKey checks that b attests key.
+func sameKey(b *keyattest.Bundle, key crypto.PublicKey) error {
+	pub, err := tpm2.Unmarshal[tpm2.TPMTPublic](b.KeyPublic)
+	if err != nil {
+		return fmt.Errorf("failed to parse attested key: %w", err)
+	}
+	attested, err := tpmcrypto.PublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("failed to parse attested key: %w", err)
+	}
+	if k, ok := key.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(attested) {
+		return ErrAttestationMismatch
+	}
+	return nil
+}
+
+// signatureAlgorithm returns the algorithm imposed by the scheme of the key,
+// or the usual one for its type.
+func signatureAlgorithm(tpm transport.TPM, keyHandle tpmutil.Handle, signer *tpmsigner.Signer) (x509.SignatureAlgorithm, error) {
+	h := keyHandle
+	if !h.HasPublic() {
+		var err error
+		if h, err = tpmutil.ToHandle(tpm, h.Handle()); err != nil {
+			return 0, err
+		}
+	}
+	scheme, hash, err := tpmcrypto.GetSigSchemeAndHashFromPublic(*h.Public())
+	if err != nil {
+		return 0, err
+	}
+	algs := map[[2]tpm2.TPMAlgID]x509.SignatureAlgorithm{
+		{tpm2.TPMAlgRSASSA, tpm2.TPMAlgSHA256}: x509.SHA256WithRSA,
+		{tpm2.TPMAlgRSASSA, tpm2.TPMAlgSHA384}: x509.SHA384WithRSA,
+		{tpm2.TPMAlgRSASSA, tpm2.TPMAlgSHA512}: x509.SHA512WithRSA,
+		{tpm2.TPMAlgRSAPSS, tpm2.TPMAlgSHA256}: x509.SHA256WithRSAPSS,
+		{tpm2.TPMAlgRSAPSS, tpm2.TPMAlgSHA384}: x509.SHA384WithRSAPSS,
+		{tpm2.TPMAlgRSAPSS, tpm2.TPMAlgSHA512}: x509.SHA512WithRSAPSS,
+		{tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256}:  x509.ECDSAWithSHA256,
+		{tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA384}:  x509.ECDSAWithSHA384,
+		{tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA512}:  x509.ECDSAWithSHA512,
+	}
+	if scheme != tpm2.TPMAlgNull {
+		alg, ok := algs[[2]tpm2.TPMAlgID{scheme, hash}]
+		if !ok {
+			return 0, fmt.Errorf("%w: no X.509 signature algorithm for scheme %v and hash %v", tpmsigner.ErrUnsupportedKey, scheme, hash)
+		}
+		return alg, nil
+	}
+
+	ecc, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return x509.SHA256WithRSA, nil
+	}
+	switch ecc.Curve {
+	case elliptic.P384():
+		return x509.ECDSAWithSHA384, nil
+	case elliptic.P521():
+		return x509.ECDSAWithSHA512, nil
+	default:
+		return x509.ECDSAWithSHA256, nil
+	}
+}
@@ -0,0 +1,133 @@
+package csr_test
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/csr"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/keyattest"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+	"github.com/stretchr/testify/require"
+)
+
+func keyTemplate(keyType, scheme tpm2.TPMAlgID) tpm2.TPMTPublic {
+	if keyType == tpm2.TPMAlgRSA {
+		return templates.RSASigner(templates.WithScheme(scheme, tpm2.TPMAlgSHA256))
+	}
+	return templates.ECCSigner(templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256))
+}
+
+func TestCreate(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("key-password")
+	subject := pkix.Name{CommonName: "device-42", Organization: []string{"tpm-stuff"}}
+
+	tests := []struct {
+		name     string
+		template tpm2.TPMTPublic
+		cfg      csr.Config
+		want     x509.SignatureAlgorithm
+	}{
+		{"ECDSA", keyTemplate(tpm2.TPMAlgECC, 0), csr.Config{}, x509.ECDSAWithSHA256},
+		{"RSA without scheme", keyTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgNull), csr.Config{}, x509.SHA256WithRSA},
+		{"RSA-PSS requested", keyTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgNull), csr.Config{SignatureAlgorithm: x509.SHA256WithRSAPSS}, x509.SHA256WithRSAPSS},
+		{"RSA-PSS key", keyTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgRSAPSS), csr.Config{}, x509.SHA256WithRSAPSS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tt.template, UserAuth: auth})
+			require.NoError(t, err)
+			defer key.Close()
+
+			cfg := tt.cfg
+			cfg.Auth = auth
+			cfg.DNSNames = []string{"device-42.example.com"}
+			wire := sniffer.New(thetpm)
+			pemCSR, err := csr.Create(wire, key, subject, cfg)
+			require.NoError(t, err)
+
+			block, _ := pem.Decode(pemCSR)
+			require.NotNil(t, block)
+			require.Equal(t, csr.PEMType, block.Type)
+			req, err := x509.ParseCertificateRequest(block.Bytes)
+			require.NoError(t, err)
+			require.NoError(t, req.CheckSignature())
+			require.Equal(t, tt.want, req.SignatureAlgorithm)
+			require.Equal(t, "device-42", req.Subject.CommonName)
+			require.Equal(t, []string{"device-42.example.com"}, req.DNSNames)
+
+			// The signed digest is encrypted by the default session.
+			digest := sha256.Sum256(req.RawTBSCertificateRequest)
+			require.False(t, wire.ContainsPlaintext(digest[:]))
+		})
+	}
+}
+
+func TestCreate_Errors(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	ak, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: attestation.AKTemplate})
+	require.NoError(t, err)
+	defer ak.Close()
+	_, err = csr.Create(thetpm, ak, pkix.Name{CommonName: "ak"})
+	require.ErrorIs(t, err, tpmsigner.ErrRestrictedKey)
+
+	key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: keyTemplate(tpm2.TPMAlgECC, 0)})
+	require.NoError(t, err)
+	defer key.Close()
+	_, err = csr.Create(thetpm, key, pkix.Name{CommonName: "key"}, csr.Config{Auth: []byte("wrong")})
+	require.ErrorIs(t, err, tpm2.TPMRCAuthFail)
+}
+
+func TestCreate_Attestation(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	ak := testutil.NewFixtures(t, thetpm).AK(t)
+	nonce := []byte("CA challenge")
+
+	newKey := func() (tpmutil.Handle, *keyattest.Creation) {
+		rsp, err := tpm2.CreatePrimary{
+			PrimaryHandle: tpm2.TPMRHOwner,
+			InPublic:      tpm2.New2B(keyTemplate(tpm2.TPMAlgECC, 0)),
+		}.Execute(thetpm)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, _ = tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm)
+		})
+		creation, err := keyattest.FromCreatePrimary(rsp)
+		require.NoError(t, err)
+		return tpmutil.NewHandle(&tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}), creation
+	}
+	key, creation := newKey()
+	bundle, err := keyattest.Certify(thetpm, ak, key, creation, keyattest.CertifyConfig{Nonce: nonce})
+	require.NoError(t, err)
+
+	pemCSR, err := csr.Create(thetpm, key, pkix.Name{CommonName: "device-42"}, csr.Config{Attestation: bundle})
+	require.NoError(t, err)
+	req, res, err := csr.VerifyAttested(pemCSR, keyattest.VerifyConfig{Nonce: nonce, AKPublic: ak.Public()})
+	require.NoError(t, err)
+	require.Equal(t, "device-42", req.Subject.CommonName)
+	require.Equal(t, req.PublicKey, res.Key)
+
+	// The attestation of another key can't be attached to the request.
+	other, _ := newKey()
+	_, err = csr.Create(thetpm, other, pkix.Name{CommonName: "device-42"}, csr.Config{Attestation: bundle})
+	require.ErrorIs(t, err, csr.ErrAttestationMismatch)
+	otherCSR, err := csr.Create(thetpm, other, pkix.Name{CommonName: "device-42"})
+	require.NoError(t, err)
+	bundlePEM, err := bundle.PEM()
+	require.NoError(t, err)
+	_, _, err = csr.VerifyAttested(append(otherCSR, bundlePEM...), keyattest.VerifyConfig{Nonce: nonce, AKPublic: ak.Public()})
+	require.ErrorIs(t, err, csr.ErrAttestationMismatch)
+
+	_, _, err = csr.VerifyAttested(otherCSR, keyattest.VerifyConfig{Nonce: nonce, AKPublic: ak.Public()})
+	require.Error(t, err, "a CSR without attestation is rejected")
+}
@@ -0,0 +1,203 @@
+package decode
+
+import "github.com/google/go-tpm/tpm2"
+
+// commandNames maps the command codes known to go-tpm to their name.
+var commandNames = map[tpm2.TPMCC]string{
+	tpm2.TPMCCNVUndefineSpaceSpecial:     "NVUndefineSpaceSpecial",
+	tpm2.TPMCCEvictControl:               "EvictControl",
+	tpm2.TPMCCHierarchyControl:           "HierarchyControl",
+	tpm2.TPMCCNVUndefineSpace:            "NVUndefineSpace",
+	tpm2.TPMCCChangeEPS:                  "ChangeEPS",
+	tpm2.TPMCCChangePPS:                  "ChangePPS",
+	tpm2.TPMCCClear:                      "Clear",
+	tpm2.TPMCCClearControl:               "ClearControl",
+	tpm2.TPMCCClockSet:                   "ClockSet",
+	tpm2.TPMCCHierarchyChanegAuth:        "HierarchyChangeAuth",
+	tpm2.TPMCCNVDefineSpace:              "NVDefineSpace",
+	tpm2.TPMCCPCRAllocate:                "PCRAllocate",
+	tpm2.TPMCCPCRSetAuthPolicy:           "PCRSetAuthPolicy",
+	tpm2.TPMCCPPCommands:                 "PPCommands",
+	tpm2.TPMCCSetPrimaryPolicy:           "SetPrimaryPolicy",
+	tpm2.TPMCCFieldUpgradeStart:          "FieldUpgradeStart",
+	tpm2.TPMCCClockRateAdjust:            "ClockRateAdjust",
+	tpm2.TPMCCCreatePrimary:              "CreatePrimary",
+	tpm2.TPMCCNVGlobalWriteLock:          "NVGlobalWriteLock",
+	tpm2.TPMCCGetCommandAuditDigest:      "GetCommandAuditDigest",
+	tpm2.TPMCCNVIncrement:                "NVIncrement",
+	tpm2.TPMCCNVSetBits:                  "NVSetBits",
+	tpm2.TPMCCNVExtend:                   "NVExtend",
+	tpm2.TPMCCNVWrite:                    "NVWrite",
+	tpm2.TPMCCNVWriteLock:                "NVWriteLock",
+	tpm2.TPMCCDictionaryAttackLockReset:  "DictionaryAttackLockReset",
+	tpm2.TPMCCDictionaryAttackParameters: "DictionaryAttackParameters",
+	tpm2.TPMCCNVChangeAuth:               "NVChangeAuth",
+	tpm2.TPMCCPCREvent:                   "PCREvent",
+	tpm2.TPMCCPCRReset:                   "PCRReset",
+	tpm2.TPMCCSequenceComplete:           "SequenceComplete",
+	tpm2.TPMCCSetAlgorithmSet:            "SetAlgorithmSet",
+	tpm2.TPMCCSetCommandCodeAuditStatus:  "SetCommandCodeAuditStatus",
+	tpm2.TPMCCFieldUpgradeData:           "FieldUpgradeData",
+	tpm2.TPMCCIncrementalSelfTest:        "IncrementalSelfTest",
+	tpm2.TPMCCSelfTest:                   "SelfTest",
+	tpm2.TPMCCStartup:                    "Startup",
+	tpm2.TPMCCShutdown:                   "Shutdown",
+	tpm2.TPMCCStirRandom:                 "StirRandom",
+	tpm2.TPMCCActivateCredential:         "ActivateCredential",
+	tpm2.TPMCCCertify:                    "Certify",
+	tpm2.TPMCCPolicyNV:                   "PolicyNV",
+	tpm2.TPMCCCertifyCreation:            "CertifyCreation",
+	tpm2.TPMCCDuplicate:                  "Duplicate",
+	tpm2.TPMCCGetTime:                    "GetTime",
+	tpm2.TPMCCGetSessionAuditDigest:      "GetSessionAuditDigest",
+	tpm2.TPMCCNVRead:                     "NVRead",
+	tpm2.TPMCCNVReadLock:                 "NVReadLock",
+	tpm2.TPMCCObjectChangeAuth:           "ObjectChangeAuth",
+	tpm2.TPMCCPolicySecret:               "PolicySecret",
+	tpm2.TPMCCRewrap:                     "Rewrap",
+	tpm2.TPMCCCreate:                     "Create",
+	tpm2.TPMCCECDHZGen:                   "ECDHZGen",
+	tpm2.TPMCCMAC:                        "MAC",
+	tpm2.TPMCCImport:                     "Import",
+	tpm2.TPMCCLoad:                       "Load",
+	tpm2.TPMCCQuote:                      "Quote",
+	tpm2.TPMCCRSADecrypt:                 "RSADecrypt",
+	tpm2.TPMCCMACStart:                   "MACStart",
+	tpm2.TPMCCSequenceUpdate:             "SequenceUpdate",
+	tpm2.TPMCCSign:                       "Sign",
+	tpm2.TPMCCUnseal:                     "Unseal",
+	tpm2.TPMCCPolicySigned:               "PolicySigned",
+	tpm2.TPMCCContextLoad:                "ContextLoad",
+	tpm2.TPMCCContextSave:                "ContextSave",
+	tpm2.TPMCCECDHKeyGen:                 "ECDHKeyGen",
+	tpm2.TPMCCEncryptDecrypt:             "EncryptDecrypt",
+	tpm2.TPMCCFlushContext:               "FlushContext",
+	tpm2.TPMCCLoadExternal:               "LoadExternal",
+	tpm2.TPMCCMakeCredential:             "MakeCredential",
+	tpm2.TPMCCNVReadPublic:               "NVReadPublic",
+	tpm2.TPMCCPolicyAuthorize:            "PolicyAuthorize",
+	tpm2.TPMCCPolicyAuthValue:            "PolicyAuthValue",
+	tpm2.TPMCCPolicyCommandCode:          "PolicyCommandCode",
+	tpm2.TPMCCPolicyCounterTimer:         "PolicyCounterTimer",
+	tpm2.TPMCCPolicyCpHash:               "PolicyCpHash",
+	tpm2.TPMCCPolicyLocality:             "PolicyLocality",
+	tpm2.TPMCCPolicyNameHash:             "PolicyNameHash",
+	tpm2.TPMCCPolicyOR:                   "PolicyOR",
+	tpm2.TPMCCPolicyTicket:               "PolicyTicket",
+	tpm2.TPMCCReadPublic:                 "ReadPublic",
+	tpm2.TPMCCRSAEncrypt:                 "RSAEncrypt",
+	tpm2.TPMCCStartAuthSession:           "StartAuthSession",
+	tpm2.TPMCCVerifySignature:            "VerifySignature",
+	tpm2.TPMCCECCParameters:              "ECCParameters",
+	tpm2.TPMCCFirmwareRead:               "FirmwareRead",
+	tpm2.TPMCCGetCapability:              "GetCapability",
+	tpm2.TPMCCGetRandom:                  "GetRandom",
+	tpm2.TPMCCGetTestResult:              "GetTestResult",
+	tpm2.TPMCCHash:                       "Hash",
+	tpm2.TPMCCPCRRead:                    "PCRRead",
+	tpm2.TPMCCPolicyPCR:                  "PolicyPCR",
+	tpm2.TPMCCPolicyRestart:              "PolicyRestart",
+	tpm2.TPMCCReadClock:                  "ReadClock",
+	tpm2.TPMCCPCRExtend:                  "PCRExtend",
+	tpm2.TPMCCPCRSetAuthValue:            "PCRSetAuthValue",
+	tpm2.TPMCCNVCertify:                  "NVCertify",
+	tpm2.TPMCCEventSequenceComplete:      "EventSequenceComplete",
+	tpm2.TPMCCHashSequenceStart:          "HashSequenceStart",
+	tpm2.TPMCCPolicyPhysicalPresence:     "PolicyPhysicalPresence",
+	tpm2.TPMCCPolicyDuplicationSelect:    "PolicyDuplicationSelect",
+	tpm2.TPMCCPolicyGetDigest:            "PolicyGetDigest",
+	tpm2.TPMCCTestParms:                  "TestParms",
+	tpm2.TPMCCCommit:                     "Commit",
+	tpm2.TPMCCPolicyPassword:             "PolicyPassword",
+	tpm2.TPMCCZGen2Phase:                 "ZGen2Phase",
+	tpm2.TPMCCECEphemeral:                "ECEphemeral",
+	tpm2.TPMCCPolicyNvWritten:            "PolicyNvWritten",
+	tpm2.TPMCCPolicyTemplate:             "PolicyTemplate",
+	tpm2.TPMCCCreateLoaded:               "CreateLoaded",
+	tpm2.TPMCCPolicyAuthorizeNV:          "PolicyAuthorizeNV",
+	tpm2.TPMCCEncryptDecrypt2:            "EncryptDecrypt2",
+	tpm2.TPMCCACGetCapability:            "ACGetCapability",
+	tpm2.TPMCCACSend:                     "ACSend",
+	tpm2.TPMCCPolicyACSendSelect:         "PolicyACSendSelect",
+	tpm2.TPMCCCertifyX509:                "CertifyX509",
+	tpm2.TPMCCACTSetTimeout:              "ACTSetTimeout",
+}
+
+// handleCounts holds the number of handles in the handle area of the
+// commands (first value) and of their responses (second value), for the
+// commands implemented by go-tpm and this module.
+var handleCounts = map[tpm2.TPMCC][2]int{
+	tpm2.TPMCCActivateCredential:        {2, 0},
+	tpm2.TPMCCCertify:                   {2, 0},
+	tpm2.TPMCCCertifyCreation:           {2, 0},
+	tpm2.TPMCCClear:                     {1, 0},
+	tpm2.TPMCCCommit:                    {1, 0},
+	tpm2.TPMCCContextLoad:               {0, 1},
+	tpm2.TPMCCContextSave:               {1, 0},
+	tpm2.TPMCCCreate:                    {1, 0},
+	tpm2.TPMCCCreateLoaded:              {1, 1},
+	tpm2.TPMCCCreatePrimary:             {1, 1},
+	tpm2.TPMCCDuplicate:                 {2, 0},
+	tpm2.TPMCCECDHZGen:                  {1, 0},
+	tpm2.TPMCCEncryptDecrypt2:           {1, 0},
+	tpm2.TPMCCEvictControl:              {2, 0},
+	tpm2.TPMCCFlushContext:              {1, 0},
+	tpm2.TPMCCGetCapability:             {0, 0},
+	tpm2.TPMCCGetCommandAuditDigest:     {2, 0},
+	tpm2.TPMCCGetRandom:                 {0, 0},
+	tpm2.TPMCCGetSessionAuditDigest:     {3, 0},
+	tpm2.TPMCCGetTime:                   {2, 0},
+	tpm2.TPMCCHash:                      {0, 0},
+	tpm2.TPMCCHashSequenceStart:         {0, 1},
+	tpm2.TPMCCHierarchyChanegAuth:       {1, 0},
+	tpm2.TPMCCHierarchyControl:          {1, 0},
+	tpm2.TPMCCHMAC:                      {1, 0},
+	tpm2.TPMCCHMACStart:                 {1, 1},
+	tpm2.TPMCCImport:                    {1, 0},
+	tpm2.TPMCCLoad:                      {1, 1},
+	tpm2.TPMCCLoadExternal:              {0, 1},
+	tpm2.TPMCCMakeCredential:            {1, 0},
+	tpm2.TPMCCNVCertify:                 {3, 0},
+	tpm2.TPMCCNVDefineSpace:             {1, 0},
+	tpm2.TPMCCNVIncrement:               {2, 0},
+	tpm2.TPMCCNVRead:                    {2, 0},
+	tpm2.TPMCCNVReadLock:                {2, 0},
+	tpm2.TPMCCNVReadPublic:              {1, 0},
+	tpm2.TPMCCNVUndefineSpace:           {2, 0},
+	tpm2.TPMCCNVUndefineSpaceSpecial:    {2, 0},
+	tpm2.TPMCCNVWrite:                   {2, 0},
+	tpm2.TPMCCNVWriteLock:               {2, 0},
+	tpm2.TPMCCObjectChangeAuth:          {2, 0},
+	tpm2.TPMCCPCREvent:                  {1, 0},
+	tpm2.TPMCCPCRExtend:                 {1, 0},
+	tpm2.TPMCCPCRRead:                   {0, 0},
+	tpm2.TPMCCPCRReset:                  {1, 0},
+	tpm2.TPMCCPolicyAuthValue:           {1, 0},
+	tpm2.TPMCCPolicyAuthorize:           {1, 0},
+	tpm2.TPMCCPolicyAuthorizeNV:         {3, 0},
+	tpm2.TPMCCPolicyCpHash:              {1, 0},
+	tpm2.TPMCCPolicyCommandCode:         {1, 0},
+	tpm2.TPMCCPolicyDuplicationSelect:   {1, 0},
+	tpm2.TPMCCPolicyGetDigest:           {1, 0},
+	tpm2.TPMCCPolicyNV:                  {3, 0},
+	tpm2.TPMCCPolicyNvWritten:           {1, 0},
+	tpm2.TPMCCPolicyOR:                  {1, 0},
+	tpm2.TPMCCPolicyPCR:                 {1, 0},
+	tpm2.TPMCCPolicySecret:              {2, 0},
+	tpm2.TPMCCPolicySigned:              {2, 0},
+	tpm2.TPMCCQuote:                     {1, 0},
+	tpm2.TPMCCRSADecrypt:                {1, 0},
+	tpm2.TPMCCRSAEncrypt:                {1, 0},
+	tpm2.TPMCCReadClock:                 {0, 0},
+	tpm2.TPMCCReadPublic:                {1, 0},
+	tpm2.TPMCCSequenceComplete:          {1, 0},
+	tpm2.TPMCCSetCommandCodeAuditStatus: {1, 0},
+	tpm2.TPMCCSequenceUpdate:            {1, 0},
+	tpm2.TPMCCShutdown:                  {0, 0},
+	tpm2.TPMCCSign:                      {1, 0},
+	tpm2.TPMCCStartAuthSession:          {2, 1},
+	tpm2.TPMCCStartup:                   {0, 0},
+	tpm2.TPMCCTestParms:                 {0, 0},
+	tpm2.TPMCCUnseal:                    {1, 0},
+	tpm2.TPMCCVerifySignature:           {1, 0},
+}
@@ -0,0 +1,455 @@
+// Package decode parses raw TPM commands and responses, as seen on the bus,
+// and renders them in a human readable form.
+//
+// Headers, handles and session areas are always decoded. Parameters are
+// decoded on a best-effort basis: only the fields of a few common commands
+// which may hold secrets (authorization values, sealed data...) are extracted.
+// It lets a program check what an observer of the bus would learn.
+package decode
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// headerSize is the size of the command and response headers:
+// tag (2 bytes), size (4 bytes) and command or response code (4 bytes).
+const headerSize = 10
+
+// ErrTruncated is returned when a message is shorter than its content requires.
+var ErrTruncated = errors.New("truncated TPM message")
+
+// Header is the header of a command or a response.
+type Header struct {
+	Tag  tpm2.TPMST
+	Size uint32
+	// Code is the command code for commands, the response code for responses.
+	Code uint32
+}
+
+// ParseHeader decodes the header of a command or a response.
+func ParseHeader(b []byte) (Header, error) {
+	if len(b) < headerSize {
+		return Header{}, fmt.Errorf("%w: %d bytes", ErrTruncated, len(b))
+	}
+	return Header{
+		Tag:  tpm2.TPMST(binary.BigEndian.Uint16(b[0:2])),
+		Size: binary.BigEndian.Uint32(b[2:6]),
+		Code: binary.BigEndian.Uint32(b[6:10]),
+	}, nil
+}
+
+// CommandName returns the name of a command code, such as "CreatePrimary".
+func CommandName(cc tpm2.TPMCC) string {
+	if name, ok := commandNames[cc]; ok {
+		return name
+	}
+	return fmt.Sprintf("TPM_CC(0x%x)", uint32(cc))
+}
+
+// HandleCounts returns the number of handles in the handle area of the
+// commands of code cc and of their responses. ok is false for the commands
+// unknown to this package, whose handles are decoded as parameters.
+func HandleCounts(cc tpm2.TPMCC) (command, response int, ok bool) {
+	counts, ok := handleCounts[cc]
+	return counts[0], counts[1], ok
+}
+
+// TagName returns the name of a command or response tag.
+func TagName(tag tpm2.TPMST) string {
+	switch tag {
+	case tpm2.TPMSTNoSessions:
+		return "TPM_ST_NO_SESSIONS"
+	case tpm2.TPMSTSessions:
+		return "TPM_ST_SESSIONS"
+	case tpm2.TPMSTRspCommand:
+		return "TPM_ST_RSP_COMMAND"
+	}
+	return fmt.Sprintf("TPM_ST(0x%x)", uint16(tag))
+}
+
+// Session is an entry of the session area of a command or a response.
+type Session struct {
+	// Handle of the session, only present in commands.
+	Handle tpm2.TPMHandle
+	Nonce  []byte
+	// Attributes are the TPMA_SESSION bits.
+	Attributes byte
+	// HMAC is the authorization HMAC, or the password for password sessions.
+	HMAC []byte
+}
+
+// TPMA_SESSION bits.
+const (
+	attrContinueSession = 1 << 0
+	attrAuditExclusive  = 1 << 1
+	attrAuditReset      = 1 << 2
+	attrDecrypt         = 1 << 5
+	attrEncrypt         = 1 << 6
+	attrAudit           = 1 << 7
+)
+
+// IsPassword reports whether the session is a password session, which sends
+// the authorization value in clear.
+func (s Session) IsPassword() bool {
+	return s.Handle == tpm2.TPMRSPW
+}
+
+// ContinueSession reports whether the session stays loaded after the command.
+// Otherwise the TPM flushes it once the command succeeds.
+func (s Session) ContinueSession() bool {
+	return s.Attributes&attrContinueSession != 0
+}
+
+// Decrypt reports whether the session encrypts the first command parameter.
+func (s Session) Decrypt() bool {
+	return s.Attributes&attrDecrypt != 0
+}
+
+// Encrypt reports whether the session encrypts the first response parameter.
+func (s Session) Encrypt() bool {
+	return s.Attributes&attrEncrypt != 0
+}
+
+// Field is a decoded parameter.
+type Field struct {
+	Name  string
+	Value []byte
+	// Encrypted is set when a session encrypts the parameter: Value is then
+	// the ciphertext.
+	Encrypted bool
+}
+
+// Command is a decoded command.
+type Command struct {
+	Header
+	Handles  []tpm2.TPMHandle
+	Sessions []Session
+	// Parameters is the raw parameter area.
+	Parameters []byte
+	// Fields are the parameters decoded for known commands.
+	Fields []Field
+}
+
+// CommandCode returns the command code of the command.
+func (c *Command) CommandCode() tpm2.TPMCC {
+	return tpm2.TPMCC(c.Code)
+}
+
+// Response is a decoded response.
+type Response struct {
+	Header
+	Handles  []tpm2.TPMHandle
+	Sessions []Session
+	// Parameters is the raw parameter area.
+	Parameters []byte
+	// Fields are the parameters decoded for known commands.
+	Fields []Field
+}
+
+// ResponseCode returns the response code of the response.
+func (r *Response) ResponseCode() tpm2.TPMRC {
+	return tpm2.TPMRC(r.Code)
+}
+
+// reader consumes a TPM message.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.b) {
+		r.err = ErrTruncated
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) u8() byte {
+	if v := r.next(1); v != nil {
+		return v[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if v := r.next(2); v != nil {
+		return binary.BigEndian.Uint16(v)
+	}
+	return 0
+}
+
+func (r *reader) u32() uint32 {
+	if v := r.next(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+// tpm2b reads a sized buffer.
+func (r *reader) tpm2b() []byte {
+	return r.next(int(r.u16()))
+}
+
+// body returns the message content after its header, limited to the size
+// announced by the header.
+func body(b []byte, h Header) ([]byte, error) {
+	if int(h.Size) > len(b) || h.Size < headerSize {
+		return nil, fmt.Errorf("%w: header announces %d bytes, got %d", ErrTruncated, h.Size, len(b))
+	}
+	return b[headerSize:h.Size], nil
+}
+
+// ParseCommand decodes a command.
+//
+// For commands unknown to this package, the handle area can't be told apart
+// from the parameters: they are all returned as parameters.
+func ParseCommand(b []byte) (*Command, error) {
+	h, err := ParseHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := body(b, h)
+	if err != nil {
+		return nil, err
+	}
+	cmd := &Command{Header: h}
+	r := &reader{b: rest}
+	for range handleCounts[cmd.CommandCode()][0] {
+		cmd.Handles = append(cmd.Handles, tpm2.TPMHandle(r.u32()))
+	}
+	if h.Tag == tpm2.TPMSTSessions {
+		area := &reader{b: r.next(int(r.u32()))}
+		for area.err == nil && len(area.b) > 0 {
+			cmd.Sessions = append(cmd.Sessions, Session{
+				Handle:     tpm2.TPMHandle(area.u32()),
+				Nonce:      area.tpm2b(),
+				Attributes: area.u8(),
+				HMAC:       area.tpm2b(),
+			})
+		}
+		if area.err != nil {
+			return nil, fmt.Errorf("invalid session area: %w", area.err)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	cmd.Parameters = r.b
+
+	encrypted := false
+	for _, s := range cmd.Sessions {
+		encrypted = encrypted || s.Decrypt()
+	}
+	cmd.Fields = commandFields(cmd.CommandCode(), cmd.Parameters, encrypted)
+	return cmd, nil
+}
+
+// ParseResponse decodes the response to a command of code cc, which tells
+// the size of its handle area.
+func ParseResponse(cc tpm2.TPMCC, b []byte) (*Response, error) {
+	h, err := ParseHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := body(b, h)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &Response{Header: h}
+	if rsp.ResponseCode() != tpm2.TPMRCSuccess {
+		return rsp, nil
+	}
+	r := &reader{b: rest}
+	for range handleCounts[cc][1] {
+		rsp.Handles = append(rsp.Handles, tpm2.TPMHandle(r.u32()))
+	}
+	if h.Tag == tpm2.TPMSTSessions {
+		rsp.Parameters = r.next(int(r.u32()))
+		for r.err == nil && len(r.b) > 0 {
+			rsp.Sessions = append(rsp.Sessions, Session{
+				Nonce:      r.tpm2b(),
+				Attributes: r.u8(),
+				HMAC:       r.tpm2b(),
+			})
+		}
+	} else {
+		rsp.Parameters = r.b
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	encrypted := false
+	for _, s := range rsp.Sessions {
+		encrypted = encrypted || s.Encrypt()
+	}
+	rsp.Fields = responseFields(cc, rsp.Parameters, encrypted)
+	return rsp, nil
+}
+
+// commandFields decodes the leading parameters of known commands. Only the
+// first parameter can be encrypted by a session.
+func commandFields(cc tpm2.TPMCC, params []byte, encrypted bool) []Field {
+	r := &reader{b: params}
+	var fields []Field
+	switch cc {
+	case tpm2.TPMCCCreatePrimary, tpm2.TPMCCCreate, tpm2.TPMCCCreateLoaded:
+		// TPM2B_SENSITIVE_CREATE: userAuth and data.
+		sensitive := &reader{b: r.tpm2b()}
+		if encrypted {
+			fields = append(fields, Field{Name: "inSensitive", Value: sensitive.b, Encrypted: true})
+			break
+		}
+		fields = append(fields,
+			Field{Name: "inSensitive.userAuth", Value: sensitive.tpm2b()},
+			Field{Name: "inSensitive.data", Value: sensitive.tpm2b()},
+		)
+		if sensitive.err != nil {
+			return nil
+		}
+	case tpm2.TPMCCHierarchyChanegAuth, tpm2.TPMCCObjectChangeAuth, tpm2.TPMCCNVChangeAuth:
+		fields = append(fields, Field{Name: "newAuth", Value: r.tpm2b(), Encrypted: encrypted})
+	case tpm2.TPMCCNVDefineSpace:
+		fields = append(fields, Field{Name: "auth", Value: r.tpm2b(), Encrypted: encrypted})
+	case tpm2.TPMCCNVWrite:
+		fields = append(fields, Field{Name: "data", Value: r.tpm2b(), Encrypted: encrypted})
+	case tpm2.TPMCCStartAuthSession:
+		fields = append(fields,
+			Field{Name: "nonceCaller", Value: r.tpm2b(), Encrypted: encrypted},
+			Field{Name: "encryptedSalt", Value: r.tpm2b()},
+		)
+	}
+	if r.err != nil {
+		return nil
+	}
+	return fields
+}
+
+// responseFields decodes the leading parameters of the responses to known
+// commands.
+func responseFields(cc tpm2.TPMCC, params []byte, encrypted bool) []Field {
+	r := &reader{b: params}
+	var fields []Field
+	switch cc {
+	case tpm2.TPMCCUnseal:
+		fields = append(fields, Field{Name: "outData", Value: r.tpm2b(), Encrypted: encrypted})
+	case tpm2.TPMCCNVRead:
+		fields = append(fields, Field{Name: "data", Value: r.tpm2b(), Encrypted: encrypted})
+	case tpm2.TPMCCGetRandom:
+		fields = append(fields, Field{Name: "randomBytes", Value: r.tpm2b(), Encrypted: encrypted})
+	case tpm2.TPMCCRSADecrypt:
+		fields = append(fields, Field{Name: "message", Value: r.tpm2b(), Encrypted: encrypted})
+	}
+	if r.err != nil {
+		return nil
+	}
+	return fields
+}
+
+// String renders the command on several lines.
+func (c *Command) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (%s, %d bytes)\n", CommandName(c.CommandCode()), TagName(c.Tag), c.Size)
+	for i, h := range c.Handles {
+		fmt.Fprintf(&sb, "  handle[%d]: 0x%08x\n", i, uint32(h))
+	}
+	for i, s := range c.Sessions {
+		fmt.Fprintf(&sb, "  session[%d]: %s\n", i, s.describe(true))
+	}
+	writeFields(&sb, c.Fields, c.Parameters)
+	return sb.String()
+}
+
+// String renders the response on several lines.
+func (r *Response) String() string {
+	var sb strings.Builder
+	rc := "TPM_RC_SUCCESS"
+	if r.ResponseCode() != tpm2.TPMRCSuccess {
+		rc = r.ResponseCode().Error()
+	}
+	fmt.Fprintf(&sb, "%s (%s, %d bytes)\n", rc, TagName(r.Tag), r.Size)
+	for i, h := range r.Handles {
+		fmt.Fprintf(&sb, "  handle[%d]: 0x%08x\n", i, uint32(h))
+	}
+	for i, s := range r.Sessions {
+		fmt.Fprintf(&sb, "  session[%d]: %s\n", i, s.describe(false))
+	}
+	writeFields(&sb, r.Fields, r.Parameters)
+	return sb.String()
+}
+
+func writeFields(sb *strings.Builder, fields []Field, params []byte) {
+	for _, f := range fields {
+		if f.Encrypted {
+			fmt.Fprintf(sb, "  %s: %x (encrypted)\n", f.Name, f.Value)
+		} else {
+			fmt.Fprintf(sb, "  %s: %s\n", f.Name, formatValue(f.Value))
+		}
+	}
+	if len(params) > 0 {
+		fmt.Fprintf(sb, "  parameters: %d bytes\n", len(params))
+	}
+}
+
+func (s Session) describe(command bool) string {
+	var sb strings.Builder
+	if command {
+		switch {
+		case s.IsPassword():
+			sb.WriteString("password ")
+		case s.Handle>>24 == tpm2.TPMHandle(tpm2.TPMHTHMACSession):
+			fmt.Fprintf(&sb, "hmac 0x%08x ", uint32(s.Handle))
+		case s.Handle>>24 == tpm2.TPMHandle(tpm2.TPMHTPolicySession):
+			fmt.Fprintf(&sb, "policy 0x%08x ", uint32(s.Handle))
+		default:
+			fmt.Fprintf(&sb, "0x%08x ", uint32(s.Handle))
+		}
+	}
+	var attrs []string
+	for _, a := range []struct {
+		bit  byte
+		name string
+	}{
+		{attrContinueSession, "continueSession"},
+		{attrAuditExclusive, "auditExclusive"},
+		{attrAuditReset, "auditReset"},
+		{attrDecrypt, "decrypt"},
+		{attrEncrypt, "encrypt"},
+		{attrAudit, "audit"},
+	} {
+		if s.Attributes&a.bit != 0 {
+			attrs = append(attrs, a.name)
+		}
+	}
+	fmt.Fprintf(&sb, "attrs=[%s] nonce=%x", strings.Join(attrs, ","), s.Nonce)
+	if command && s.IsPassword() {
+		fmt.Fprintf(&sb, " password=%s", formatValue(s.HMAC))
+	} else {
+		fmt.Fprintf(&sb, " hmac=%x", s.HMAC)
+	}
+	return sb.String()
+}
+
+// formatValue renders printable values as a quoted string, others in hex.
+func formatValue(v []byte) string {
+	if len(v) == 0 {
+		return `""`
+	}
+	for _, c := range v {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Sprintf("%x", v)
+		}
+	}
+	return fmt.Sprintf("%q", v)
+}
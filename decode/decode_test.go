@@ -0,0 +1,166 @@
+package decode_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/decode"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/unbound"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder keeps a copy of the last command and response.
+type recorder struct {
+	transport.TPM
+	cmd, rsp []byte
+}
+
+func (r *recorder) Send(cmd []byte) ([]byte, error) {
+	// The simulator decrypts parameters in place: copy the command first.
+	r.cmd = bytes.Clone(cmd)
+	rsp, err := r.TPM.Send(cmd)
+	r.rsp = bytes.Clone(rsp)
+	return rsp, err
+}
+
+func field(t *testing.T, fields []decode.Field, name string) decode.Field {
+	t.Helper()
+	for _, f := range fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	t.Fatalf("no field %q in %v", name, fields)
+	return decode.Field{}
+}
+
+func createPrimary(auth tpm2.Session, userAuth []byte) tpm2.CreatePrimary {
+	return tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.AuthHandle{Handle: tpm2.TPMRHOwner, Auth: auth},
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: userAuth},
+			},
+		},
+		InPublic: tpm2.New2B(tpmutil.ECCSRKTemplate),
+	}
+}
+
+func TestParseCommand_Plaintext(t *testing.T) {
+	rec := &recorder{TPM: testutil.OpenSimulator(t)}
+	ownerAuth := []byte("owner-password")
+	userAuth := []byte("user-password")
+
+	_, err := tpm2.HierarchyChangeAuth{
+		AuthHandle: tpm2.TPMRHOwner,
+		NewAuth:    tpm2.TPM2BAuth{Buffer: ownerAuth},
+	}.Execute(rec)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := tpm2.HierarchyChangeAuth{
+			AuthHandle: tpm2.AuthHandle{Handle: tpm2.TPMRHOwner, Auth: tpm2.PasswordAuth(ownerAuth)},
+		}.Execute(rec)
+		require.NoError(t, err)
+	})
+	cmd, err := decode.ParseCommand(rec.cmd)
+	require.NoError(t, err)
+	require.Equal(t, "HierarchyChangeAuth", decode.CommandName(cmd.CommandCode()))
+	require.Equal(t, ownerAuth, field(t, cmd.Fields, "newAuth").Value)
+
+	rsp, err := createPrimary(tpm2.PasswordAuth(ownerAuth), userAuth).Execute(rec)
+	require.NoError(t, err)
+	defer tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(rec) //nolint:errcheck
+
+	cmd, err = decode.ParseCommand(rec.cmd)
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMCCCreatePrimary, cmd.CommandCode())
+	require.Equal(t, []tpm2.TPMHandle{tpm2.TPMRHOwner}, cmd.Handles)
+
+	// Both passwords travel in clear.
+	require.Len(t, cmd.Sessions, 1)
+	require.True(t, cmd.Sessions[0].IsPassword())
+	require.Equal(t, ownerAuth, cmd.Sessions[0].HMAC)
+	f := field(t, cmd.Fields, "inSensitive.userAuth")
+	require.False(t, f.Encrypted)
+	require.Equal(t, userAuth, f.Value)
+	require.Contains(t, cmd.String(), `password="owner-password"`)
+	require.Contains(t, cmd.String(), `inSensitive.userAuth: "user-password"`)
+
+	out, err := decode.ParseResponse(cmd.CommandCode(), rec.rsp)
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMRCSuccess, out.ResponseCode())
+	require.Equal(t, []tpm2.TPMHandle{rsp.ObjectHandle}, out.Handles)
+	require.Len(t, out.Sessions, 1)
+}
+
+func TestParseCommand_Encrypted(t *testing.T) {
+	rec := &recorder{TPM: testutil.OpenSimulator(t)}
+	userAuth := []byte("user-password")
+
+	rsp, err := createPrimary(unbound.Unbound(nil), userAuth).Execute(rec)
+	require.NoError(t, err)
+	defer tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(rec) //nolint:errcheck
+
+	cmd, err := decode.ParseCommand(rec.cmd)
+	require.NoError(t, err)
+	require.Len(t, cmd.Sessions, 1)
+	require.False(t, cmd.Sessions[0].IsPassword())
+	require.True(t, cmd.Sessions[0].Decrypt())
+	require.True(t, cmd.Sessions[0].Encrypt())
+
+	f := field(t, cmd.Fields, "inSensitive")
+	require.True(t, f.Encrypted)
+	require.NotContains(t, string(f.Value), string(userAuth))
+	require.Contains(t, cmd.String(), "(encrypted)")
+}
+
+func TestParseResponse_Unseal(t *testing.T) {
+	rec := &recorder{TPM: testutil.OpenSimulator(t)}
+	secret := []byte("sealed-secret")
+
+	srk, err := tpmutil.CreatePrimary(rec, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	defer srk.Close()
+	sealed, err := tpmutil.Create(rec, tpmutil.CreateConfig{
+		ParentHandle: srk,
+		InPublic:     templates.Seal(),
+		SealingData:  secret,
+	})
+	require.NoError(t, err)
+	defer sealed.Close()
+
+	_, err = tpm2.Unseal{ItemHandle: tpmutil.ToAuthHandle(sealed)}.Execute(rec)
+	require.NoError(t, err)
+
+	out, err := decode.ParseResponse(tpm2.TPMCCUnseal, rec.rsp)
+	require.NoError(t, err)
+	require.Equal(t, secret, field(t, out.Fields, "outData").Value)
+}
+
+func TestParseResponse_Error(t *testing.T) {
+	rsp := []byte{0x80, 0x01, 0, 0, 0, 0x0a, 0, 0, 0x00, 0xa2}
+	out, err := decode.ParseResponse(tpm2.TPMCCCreatePrimary, rsp)
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMRCBadAuth, out.ResponseCode())
+	require.Contains(t, out.String(), "TPM_RC_BAD_AUTH")
+}
+
+func TestParseHeader(t *testing.T) {
+	h, err := decode.ParseHeader([]byte{0x80, 0x02, 0, 0, 0, 0x20, 0, 0, 0x01, 0x31})
+	require.NoError(t, err)
+	require.Equal(t, decode.Header{Tag: tpm2.TPMSTSessions, Size: 0x20, Code: uint32(tpm2.TPMCCCreatePrimary)}, h)
+	require.Equal(t, "CreatePrimary", decode.CommandName(tpm2.TPMCC(h.Code)))
+	require.Equal(t, "TPM_CC(0x1)", decode.CommandName(1))
+
+	_, err = decode.ParseHeader([]byte{0x80, 0x01})
+	require.ErrorIs(t, err, decode.ErrTruncated)
+
+	// The header announces more bytes than available.
+	_, err = decode.ParseCommand([]byte{0x80, 0x01, 0, 0, 0, 0x20, 0, 0, 0x01, 0x7b})
+	require.ErrorIs(t, err, decode.ErrTruncated)
+}
@@ -0,0 +1,51 @@
+package decode_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/decode"
+)
+
+// FuzzParseCommand checks that decoding untrusted commands, e.g. captured on
+// the bus, doesn't panic.
+func FuzzParseCommand(f *testing.F) {
+	for _, seed := range []string{
+		// TPM2_GetRandom(16).
+		"80010000000c0000017b0010",
+		// TPM2_Unseal of 0x80000001 with an empty password session.
+		"80020000001b0000015e8000000100000009400000090000010000",
+		// TPM2_Unseal with a truncated session area.
+		"8002000000150000015e8000000100000009400000",
+	} {
+		b, _ := hex.DecodeString(seed)
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		decode.ParseCommand(b) //nolint:errcheck
+	})
+}
+
+// FuzzParseResponse checks that decoding untrusted responses doesn't panic.
+func FuzzParseResponse(f *testing.F) {
+	for _, seed := range []struct {
+		cc  tpm2.TPMCC
+		rsp string
+	}{
+		// TPM2_GetRandom: 4 random bytes.
+		{tpm2.TPMCCGetRandom, "800100000010000000000004deadbeef"},
+		// TPM2_Unseal: "secret", with a password session.
+		{tpm2.TPMCCUnseal, "80020000001b000000000000000800067365637265740000010000"},
+		// TPM_RC_BAD_AUTH.
+		{tpm2.TPMCCUnseal, "80010000000a000009a2"},
+	} {
+		b, _ := hex.DecodeString(seed.rsp)
+		f.Add(uint32(seed.cc), b)
+	}
+
+	f.Fuzz(func(t *testing.T, cc uint32, b []byte) {
+		decode.ParseResponse(tpm2.TPMCC(cc), b) //nolint:errcheck
+	})
+}
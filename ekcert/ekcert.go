@@ -0,0 +1,165 @@
+// Package ekcert reads the Endorsement Key certificates provisioned by TPM
+// manufacturers and checks them against the TPM and a set of trusted roots.
+package ekcert
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+)
+
+// NV indexes of the EK certificates defined by the TCG EK Credential Profile.
+const (
+	// RSACertIndex holds the certificate of the RSA-2048 EK (low range template).
+	RSACertIndex tpm2.TPMHandle = 0x01C00002
+	// ECCCertIndex holds the certificate of the ECC NIST P-256 EK (low range template).
+	ECCCertIndex tpm2.TPMHandle = 0x01C0000A
+)
+
+var (
+	// ErrKeyMismatch is returned when a certificate doesn't certify the EK of the TPM.
+	ErrKeyMismatch = errors.New("EK certificate doesn't match the TPM EK")
+	// ErrUnsupportedKeyType is returned for key types without a standard EK certificate index.
+	ErrUnsupportedKeyType = errors.New("unsupported EK key type")
+)
+
+// oidSubjectAltName is the SAN extension, which holds the TPM manufacturer,
+// model and version as a directoryName in EK certificates.
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// certIndex returns the NV index and the EK template matching keyType.
+func certIndex(keyType tpm2.TPMAlgID) (tpm2.TPMHandle, tpm2.TPMTPublic, error) {
+	switch keyType {
+	case tpm2.TPMAlgRSA:
+		return RSACertIndex, tpm2.RSAEKTemplate, nil
+	case tpm2.TPMAlgECC:
+		return ECCCertIndex, tpm2.ECCEKTemplate, nil
+	default:
+		return 0, tpm2.TPMTPublic{}, fmt.Errorf("%w: %v", ErrUnsupportedKeyType, keyType)
+	}
+}
+
+// Read reads and parses the EK certificate of keyType (tpm2.TPMAlgRSA or
+// tpm2.TPMAlgECC) from its NV index.
+func Read(tpm transport.TPM, keyType tpm2.TPMAlgID) (*x509.Certificate, error) {
+	handle, _, err := certIndex(keyType)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := nv.Open(tpm, handle)
+	if err != nil {
+		return nil, fmt.Errorf("no EK certificate at 0x%x: %w", handle, err)
+	}
+	data, err := nv.Read(tpm, idx, tpm2.PasswordAuth(nil))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses a DER certificate read from NV. The NV index may be larger
+// than the certificate, so trailing bytes are ignored.
+func Parse(data []byte) (*x509.Certificate, error) {
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid EK certificate encoding: %w", err)
+	}
+	cert, err := x509.ParseCertificate(raw.FullBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse EK certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// VerifyEK creates the EK of keyType from its default template and checks
+// that cert certifies its public key.
+func VerifyEK(tpm transport.TPM, cert *x509.Certificate, keyType tpm2.TPMAlgID) error {
+	_, template, err := certIndex(keyType)
+	if err != nil {
+		return err
+	}
+	return verifyEK(tpm, cert, template)
+}
+
+// verifyEK creates the EK from template and checks that cert certifies its
+// public key.
+func verifyEK(tpm transport.TPM, cert *x509.Certificate, template tpm2.TPMTPublic) error {
+	ek, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: tpm2.TPMRHEndorsement,
+		InPublic:      template,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create EK: %w", err)
+	}
+	defer ek.Close() //nolint:errcheck
+	return VerifyPublic(cert, *ek.Public())
+}
+
+// VerifyPublic checks that cert certifies the key whose public area is pub,
+// e.g. an EK public area read from the TPM, without a TPM.
+func VerifyPublic(cert *x509.Certificate, pub tpm2.TPMTPublic) error {
+	key, err := tpmcrypto.PublicKey(&pub)
+	if err != nil {
+		return err
+	}
+	certPub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !certPub.Equal(key) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// VerifyChain validates cert up to one of roots, using intermediates if needed.
+//
+// EK certificates often mark their SAN extension critical while only holding
+// a directoryName, which crypto/x509 reports as unhandled: it is accepted here.
+// Any extended key usage is allowed since EK certificates carry the TCG
+// specific tcg-kp-EKCertificate usage.
+func VerifyChain(cert *x509.Certificate, roots, intermediates *x509.CertPool) ([][]*x509.Certificate, error) {
+	ekCert := *cert
+	ekCert.UnhandledCriticalExtensions = slices.DeleteFunc(slices.Clone(cert.UnhandledCriticalExtensions), func(oid asn1.ObjectIdentifier) bool {
+		return oid.Equal(oidSubjectAltName)
+	})
+	chains, err := ekCert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify EK certificate chain: %w", err)
+	}
+	return chains, nil
+}
+
+// Verify reads the EK certificate of keyType, checks that it certifies the EK
+// of the TPM and, when roots is not nil, validates its chain.
+//
+// Example:
+//
+//	roots := x509.NewCertPool()
+//	roots.AddCert(manufacturerCA)
+//	cert, err := ekcert.Verify(tpm, tpm2.TPMAlgRSA, roots)
+func Verify(tpm transport.TPM, keyType tpm2.TPMAlgID, roots *x509.CertPool) (*x509.Certificate, error) {
+	cert, err := Read(tpm, keyType)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyEK(tpm, cert, keyType); err != nil {
+		return nil, err
+	}
+	if roots != nil {
+		if _, err := VerifyChain(cert, roots, nil); err != nil {
+			return nil, err
+		}
+	}
+	return cert, nil
+}
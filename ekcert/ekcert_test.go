@@ -0,0 +1,229 @@
+package ekcert_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test TPM Manufacturer Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+// issueEKCert mimics a manufacturer EK certificate: empty subject and a
+// critical SAN holding the TPM identity as a directoryName.
+func (ca *testCA) issueEKCert(t *testing.T, pub crypto.PublicKey) []byte {
+	t.Helper()
+	tpmIdentity := pkix.Name{
+		ExtraNames: []pkix.AttributeTypeAndValue{
+			{Type: asn1.ObjectIdentifier{2, 23, 133, 2, 1}, Value: "id:53494D55"},
+			{Type: asn1.ObjectIdentifier{2, 23, 133, 2, 2}, Value: "SIMULATOR"},
+			{Type: asn1.ObjectIdentifier{2, 23, 133, 2, 3}, Value: "id:00020000"},
+		},
+	}
+	dirName, err := asn1.Marshal(tpmIdentity.ToRDNSequence())
+	require.NoError(t, err)
+	san, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: dirName}})
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment,
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Critical: true, Value: san},
+		},
+		UnknownExtKeyUsage: []asn1.ObjectIdentifier{{2, 23, 133, 8, 1}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, pub, ca.key)
+	require.NoError(t, err)
+	return der
+}
+
+func ekPublic(t *testing.T, thetpm transport.TPM, template tpm2.TPMTPublic) crypto.PublicKey {
+	t.Helper()
+	ek, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: tpm2.TPMRHEndorsement,
+		InPublic:      template,
+	})
+	require.NoError(t, err)
+	defer ek.Close()
+	pub, err := tpmcrypto.PublicKey(ek.Public())
+	require.NoError(t, err)
+	return pub
+}
+
+// provision stores der in the NV index of an EK certificate, padded with zeros
+// like some manufacturers do.
+func provision(t *testing.T, thetpm transport.TPM, handle tpm2.TPMHandle, der []byte) {
+	t.Helper()
+	data := append(der, make([]byte, 16)...)
+	idx, err := nv.Define(thetpm, nv.DefineConfig{
+		Index: handle,
+		Size:  uint16(len(data)),
+		Attributes: tpm2.TPMANV{
+			OwnerWrite: true,
+			OwnerRead:  true,
+			AuthRead:   true,
+			NoDA:       true,
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, nv.Undefine(thetpm, idx)) })
+
+	_, err = tpm2.NVWrite{
+		AuthHandle: tpm2.TPMRHOwner,
+		NVIndex:    idx.NamedHandle(),
+		Data:       tpm2.TPM2BMaxNVBuffer{Buffer: data[:min(len(data), 1024)]},
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	if len(data) > 1024 {
+		require.NoError(t, idx.Refresh(thetpm))
+		_, err = tpm2.NVWrite{
+			AuthHandle: tpm2.TPMRHOwner,
+			NVIndex:    idx.NamedHandle(),
+			Data:       tpm2.TPM2BMaxNVBuffer{Buffer: data[1024:]},
+			Offset:     1024,
+		}.Execute(thetpm)
+		require.NoError(t, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	ca := newCA(t)
+
+	tests := []struct {
+		name     string
+		keyType  tpm2.TPMAlgID
+		index    tpm2.TPMHandle
+		template tpm2.TPMTPublic
+	}{
+		{"RSA", tpm2.TPMAlgRSA, ekcert.RSACertIndex, tpm2.RSAEKTemplate},
+		{"ECC", tpm2.TPMAlgECC, ekcert.ECCCertIndex, tpm2.ECCEKTemplate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provision(t, thetpm, tt.index, ca.issueEKCert(t, ekPublic(t, thetpm, tt.template)))
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			cert, err := ekcert.Verify(thetpm, tt.keyType, roots)
+			require.NoError(t, err)
+			require.Equal(t, big.NewInt(2), cert.SerialNumber)
+
+			// Without roots only the key binding is checked.
+			_, err = ekcert.Verify(thetpm, tt.keyType, nil)
+			require.NoError(t, err)
+
+			// An unrelated CA isn't trusted.
+			otherRoots := x509.NewCertPool()
+			otherRoots.AddCert(newCA(t).cert)
+			_, err = ekcert.Verify(thetpm, tt.keyType, otherRoots)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestVerify_KeyMismatch(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	ca := newCA(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	provision(t, thetpm, ekcert.ECCCertIndex, ca.issueEKCert(t, key.Public()))
+
+	_, err = ekcert.Verify(thetpm, tpm2.TPMAlgECC, nil)
+	require.ErrorIs(t, err, ekcert.ErrKeyMismatch)
+}
+
+func TestRead_NotProvisioned(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	_, err := ekcert.Read(thetpm, tpm2.TPMAlgRSA)
+	require.Error(t, err)
+	_, err = ekcert.Read(thetpm, tpm2.TPMAlgKeyedHash)
+	require.ErrorIs(t, err, ekcert.ErrUnsupportedKeyType)
+}
+
+func TestDetect(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	ca := newCA(t)
+
+	// The simulator doesn't support RSA 3072 and 4096.
+	for _, name := range []string{"L-1", "L-2", "H-1", "H-2", "H-3", "H-4"} {
+		t.Run(name, func(t *testing.T) {
+			i := slices.IndexFunc(ekcert.Templates, func(tmpl ekcert.Template) bool { return tmpl.Name == name })
+			require.NotEqual(t, -1, i)
+			template := ekcert.Templates[i]
+
+			der := ca.issueEKCert(t, ekPublic(t, thetpm, template.Public))
+			cert, err := x509.ParseCertificate(der)
+			require.NoError(t, err)
+
+			got, err := ekcert.Detect(thetpm, cert)
+			require.NoError(t, err)
+			require.Equal(t, name, got.Name)
+
+			// The EK is usable as a parent with the session of its template.
+			ek, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+				PrimaryHandle: tpm2.TPMRHEndorsement,
+				InPublic:      got.Public,
+			})
+			require.NoError(t, err)
+			defer ek.Close()
+			_, err = tpm2.Create{
+				ParentHandle: tpm2.AuthHandle{Handle: ek.Handle(), Name: ek.Name(), Auth: got.Auth()},
+				InPublic:     tpm2.New2B(templates.ECCSigner()),
+			}.Execute(thetpm)
+			require.NoError(t, err)
+		})
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(ca.issueEKCert(t, key.Public()))
+	require.NoError(t, err)
+	_, err = ekcert.Detect(thetpm, cert)
+	require.ErrorIs(t, err, ekcert.ErrKeyMismatch)
+}
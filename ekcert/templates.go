@@ -0,0 +1,109 @@
+package ekcert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/policy"
+)
+
+// Template is an EK template of the TCG EK Credential Profile, along with
+// the NV index of the certificate of the EK created from it.
+type Template struct {
+	// Name is the name of the template in the profile, e.g. "L-1" or "H-2".
+	Name string
+	// Public is the template.
+	Public tpm2.TPMTPublic
+	// CertIndex is the NV index of the EK certificate.
+	CertIndex tpm2.TPMHandle
+}
+
+// Templates are the EK templates of the TCG EK Credential Profile, low range
+// first, as most devices only provision those.
+//
+// The low range EKs are only usable through their policy (PolicySecret of the
+// endorsement hierarchy). The high range EKs are usable with their empty
+// authorization value as well, their policy allowing the endorsement
+// hierarchy owner to change it through NV indexes.
+//
+// H-5 (ECC SM2 P-256) isn't supported: go-tpm can't marshal its SM4
+// symmetric algorithm.
+var Templates = []Template{
+	{Name: "L-1", Public: tpm2.RSAEKTemplate, CertIndex: RSACertIndex},
+	{Name: "L-2", Public: tpm2.ECCEKTemplate, CertIndex: ECCCertIndex},
+	{Name: "H-1", Public: tpmutil.RSA2048EKTemplate, CertIndex: 0x01C00012},
+	{Name: "H-2", Public: tpmutil.ECCP256EKTemplate, CertIndex: 0x01C00014},
+	{Name: "H-3", Public: tpmutil.ECCP384EKTemplate, CertIndex: 0x01C00016},
+	{Name: "H-4", Public: tpmutil.ECCP521EKTemplate, CertIndex: 0x01C00018},
+	{Name: "H-6", Public: tpmutil.RSA3072EKTemplate, CertIndex: 0x01C0001C},
+	{Name: "H-7", Public: tpmutil.RSA4096EKTemplate, CertIndex: 0x01C0001E},
+}
+
+// Auth returns the session authorizing the use of the EK created from t (e.g.
+// as a parent or in ActivateCredential): its empty authorization value for
+// the high range templates, [policy.Endorsement] for the low range ones.
+func (t Template) Auth(endorsementAuth ...tpm2.Session) tpm2.Session {
+	if t.Public.ObjectAttributes.UserWithAuth {
+		return tpm2.PasswordAuth(nil)
+	}
+	return policy.Endorsement(endorsementAuth...)
+}
+
+// Detect returns the template of the EK certified by cert: the EK of each
+// template of the key type of cert is created until one matches.
+//
+// Example:
+//
+//	template, err := ekcert.Detect(tpm, cert)
+//	if err != nil {
+//	    return err
+//	}
+//	ek, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+//	    PrimaryHandle: tpm2.TPMRHEndorsement,
+//	    InPublic:      template.Public,
+//	})
+func Detect(tpm transport.TPM, cert *x509.Certificate) (*Template, error) {
+	for _, t := range Templates {
+		if !sameKeyType(t.Public, cert) {
+			continue
+		}
+		err := verifyEK(tpm, cert, t.Public)
+		if err == nil {
+			return &t, nil
+		}
+		if !errors.Is(err, ErrKeyMismatch) {
+			return nil, fmt.Errorf("template %s: %w", t.Name, err)
+		}
+	}
+	return nil, ErrKeyMismatch
+}
+
+// sameKeyType reports whether the EK created from template has the type and
+// size of the key of cert.
+func sameKeyType(template tpm2.TPMTPublic, cert *x509.Certificate) bool {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		rsaParams, err := template.Parameters.RSADetail()
+		return err == nil && template.Type == tpm2.TPMAlgRSA && int(rsaParams.KeyBits) == pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		eccParams, err := template.Parameters.ECCDetail()
+		if err != nil || template.Type != tpm2.TPMAlgECC {
+			return false
+		}
+		curves := map[tpm2.TPMECCCurve]elliptic.Curve{
+			tpm2.TPMECCNistP256: elliptic.P256(),
+			tpm2.TPMECCNistP384: elliptic.P384(),
+			tpm2.TPMECCNistP521: elliptic.P521(),
+		}
+		return curves[eccParams.CurveID] == pub.Curve
+	default:
+		return false
+	}
+}
@@ -0,0 +1,130 @@
+// Package errors maps the TPM response codes callers commonly need to act on
+// to sentinel errors, so that they can branch on failures with errors.Is
+// without knowing the TPM_RC values, and adds a hint on how to recover.
+//
+// Note: this package name shadows the standard library's; import it under
+// another name (e.g. tpmerrors) when both are needed.
+package errors
+
+import (
+	"errors"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+var (
+	// ErrAuthFail is returned when an authorization fails: wrong
+	// authorization value or HMAC (TPM_RC_AUTH_FAIL, TPM_RC_BAD_AUTH).
+	ErrAuthFail = errors.New("authorization failed")
+	// ErrLockout is returned when the TPM refuses authorizations because of
+	// the dictionary attack protection (TPM_RC_LOCKOUT).
+	ErrLockout = errors.New("TPM in dictionary attack lockout")
+	// ErrNVSpaceOccupied is returned when defining an NV index which is
+	// already defined (TPM_RC_NV_DEFINED).
+	ErrNVSpaceOccupied = errors.New("NV index already defined")
+	// ErrObjectMemory is returned when no transient object slot is free
+	// (TPM_RC_OBJECT_MEMORY).
+	ErrObjectMemory = errors.New("out of object memory")
+	// ErrSessionMemory is returned when no session slot is free
+	// (TPM_RC_SESSION_MEMORY).
+	ErrSessionMemory = errors.New("out of session memory")
+)
+
+// kinds maps the response codes to their sentinel error and hint.
+var kinds = []struct {
+	sentinel error
+	codes    []tpm2.TPMRC
+	hint     string
+}{
+	{
+		ErrAuthFail,
+		[]tpm2.TPMRC{tpm2.TPMRCAuthFail, tpm2.TPMRCBadAuth},
+		"check the authorization value; repeated failures on objects without noDA lead to a lockout",
+	},
+	{
+		ErrLockout,
+		[]tpm2.TPMRC{tpm2.TPMRCLockout},
+		"wait for the DA recovery time or reset the DA counter with the lockout authorization (TPM2_DictionaryAttackLockReset)",
+	},
+	{
+		ErrNVSpaceOccupied,
+		[]tpm2.TPMRC{tpm2.TPMRCNVDefined},
+		"undefine the NV index first or use another index",
+	},
+	{
+		ErrObjectMemory,
+		[]tpm2.TPMRC{tpm2.TPMRCObjectMemory},
+		"flush transient objects (TPM2_FlushContext) or save their context",
+	},
+	{
+		ErrSessionMemory,
+		[]tpm2.TPMRC{tpm2.TPMRCSessionMemory},
+		"flush sessions (TPM2_FlushContext) or save their context",
+	},
+}
+
+// Error is a TPM error matching one of the sentinel errors of this package.
+type Error struct {
+	// Err is the wrapped error, e.g. the [tpm2.TPMRC] returned by go-tpm.
+	Err error
+	// Hint tells how to recover from the error.
+	Hint string
+
+	sentinel error
+}
+
+// Error returns the wrapped error followed by the hint.
+func (e *Error) Error() string {
+	return e.Err.Error() + " (hint: " + e.Hint + ")"
+}
+
+// Is reports whether target is the sentinel error matched by e.
+func (e *Error) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// Unwrap returns the wrapped error: errors.Is still matches the TPM_RC.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap returns err wrapped in an [*Error] when it carries one of the response
+// codes of the sentinel errors, and err unchanged otherwise (including nil).
+//
+// Example:
+//
+//	_, err := tpm2.Unseal{ItemHandle: item}.Execute(tpm)
+//	if err != nil {
+//	    return fmt.Errorf("failed to unseal data: %w", tpmerrors.Wrap(err))
+//	}
+//	...
+//	if errors.Is(err, tpmerrors.ErrAuthFail) {
+//	    // Prompt the password again.
+//	}
+func Wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	var tpmErr *Error
+	if errors.As(err, &tpmErr) {
+		return err
+	}
+	for _, k := range kinds {
+		for _, code := range k.codes {
+			if errors.Is(err, code) {
+				return &Error{Err: err, Hint: k.hint, sentinel: k.sentinel}
+			}
+		}
+	}
+	return err
+}
+
+// Hint returns the hint of the first [*Error] in the chain of err, or an
+// empty string.
+func Hint(err error) string {
+	var tpmErr *Error
+	if errors.As(err, &tpmErr) {
+		return tpmErr.Hint
+	}
+	return ""
+}
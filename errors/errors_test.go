@@ -0,0 +1,82 @@
+package errors_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sessions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrap(t *testing.T) {
+	require.NoError(t, tpmerrors.Wrap(nil))
+
+	other := errors.New("other")
+	require.Equal(t, other, tpmerrors.Wrap(other))
+	require.Equal(t, tpm2.TPMRCPolicyFail, tpmerrors.Wrap(tpm2.TPMRCPolicyFail))
+
+	for _, tt := range []struct {
+		rc       tpm2.TPMRC
+		sentinel error
+	}{
+		{tpm2.TPMRCAuthFail, tpmerrors.ErrAuthFail},
+		// TPM_RC_BAD_AUTH reported for the first session.
+		{tpm2.TPMRCBadAuth | 0x900, tpmerrors.ErrAuthFail},
+		{tpm2.TPMRCLockout, tpmerrors.ErrLockout},
+		{tpm2.TPMRCNVDefined, tpmerrors.ErrNVSpaceOccupied},
+		{tpm2.TPMRCObjectMemory, tpmerrors.ErrObjectMemory},
+		{tpm2.TPMRCSessionMemory, tpmerrors.ErrSessionMemory},
+	} {
+		t.Run(tt.sentinel.Error(), func(t *testing.T) {
+			err := tpmerrors.Wrap(fmt.Errorf("failed to do something: %w", tt.rc))
+			require.ErrorIs(t, err, tt.sentinel)
+			require.ErrorIs(t, err, tt.rc, "the response code still matches")
+			require.NotEmpty(t, tpmerrors.Hint(err))
+			require.Contains(t, err.Error(), tpmerrors.Hint(err))
+			require.Equal(t, err, tpmerrors.Wrap(err), "wrapping is idempotent")
+
+			wrapped := fmt.Errorf("outer: %w", err)
+			require.Equal(t, tpmerrors.Hint(err), tpmerrors.Hint(wrapped))
+		})
+	}
+	require.Empty(t, tpmerrors.Hint(other))
+}
+
+func TestWrap_Helpers(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	t.Run("NV space occupied", func(t *testing.T) {
+		idx, err := nv.Define(thetpm, nv.DefineConfig{Index: 0x01500120, Size: 8, Auth: []byte("pass")})
+		require.NoError(t, err)
+		defer nv.Undefine(thetpm, idx) //nolint:errcheck
+
+		_, err = nv.Define(thetpm, nv.DefineConfig{Index: 0x01500120, Size: 8})
+		require.ErrorIs(t, err, tpmerrors.ErrNVSpaceOccupied)
+
+		err = nv.Write(thetpm, idx, []byte("data"), tpm2.PasswordAuth([]byte("wrong")))
+		require.ErrorIs(t, err, tpmerrors.ErrAuthFail)
+	})
+
+	t.Run("session memory", func(t *testing.T) {
+		var started []*sessions.Resumable
+		defer func() {
+			for _, sess := range started {
+				sess.Close(thetpm) //nolint:errcheck
+			}
+		}()
+		var err error
+		for range 4 {
+			var sess *sessions.Resumable
+			if sess, err = sessions.Default.StartResumable(thetpm); err != nil {
+				break
+			}
+			started = append(started, sess)
+		}
+		require.ErrorIs(t, err, tpmerrors.ErrSessionMemory)
+	})
+}
@@ -0,0 +1,279 @@
+// Package escrow backs up secrets sealed on a device to a backup authority,
+// and restores them on another device, without the secret ever leaving a TPM
+// in the clear outside of the authority.
+//
+// The flow involves three parties:
+//
+//  1. Device A seals the secret with a policy only allowing its duplication
+//     to the storage key of the authority, and duplicates it ([Backup]). The
+//     resulting [Record] is stored anywhere: only the authority can open it.
+//  2. The authority checks that the record enforces this policy ([Verify]),
+//     and releases the secret for device B: the secret is unsealed in the TPM
+//     of the authority and wrapped for the EK of device B ([Release]).
+//  3. Device B imports the secret under its EK and seals it again under its
+//     SRK ([Restore]).
+//
+// The authority must check that the EK of device B is a genuine TPM EK (see
+// the ekcert package) before releasing a secret to it.
+package escrow
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+	"github.com/loicsikidi/tpm-stuff/keyimport"
+	"github.com/loicsikidi/tpm-stuff/names"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/unseal"
+)
+
+// ErrPolicyNotEnforced is returned by [Verify] when a record doesn't restrict
+// the duplication of its sealed object to the authority.
+var ErrPolicyNotEnforced = errors.New("escrow policy not enforced")
+
+// Record is an escrowed secret: the sealed object of the device, wrapped for
+// the storage key of the authority.
+type Record struct {
+	// Blob is the sealed object, as output by unseal.Migrate.
+	Blob *unseal.Blob `json:"blob"`
+}
+
+// BackupConfig holds configuration for [Backup].
+type BackupConfig struct {
+	// Parent is the storage key under which the secret is sealed before its
+	// duplication, authorized with an empty password.
+	//
+	// Default: the ECC SRK persisted at provision.SRKHandle, provisioned on
+	// first use (see provision.EnsureSRK).
+	Parent tpmutil.Handle
+}
+
+// CheckAndSetDefault validates and sets default values for BackupConfig.
+func (c *BackupConfig) CheckAndSetDefault() error {
+	return nil
+}
+
+// Backup seals secret, of up to [unseal.MaxDataSize] bytes, and wraps it for
+// the storage key of the authority whose public area is authorityPub.
+//
+// Example:
+//
+//	record, err := escrow.Backup(tpm, diskKey, authorityPub)
+//	if err != nil {
+//	    return err
+//	}
+//	data, err := json.Marshal(record)
+func Backup(tpm transport.TPM, secret []byte, authorityPub tpm2.TPMTPublic, optionalCfg ...BackupConfig) (*Record, error) {
+	var cfg BackupConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	blob, err := unseal.Seal(tpm, secret, unseal.SealConfig{Parent: cfg.Parent, DuplicateTo: &authorityPub})
+	if err != nil {
+		return nil, err
+	}
+	migrated, err := unseal.Migrate(tpm, blob, authorityPub, unseal.MigrateConfig{Parent: cfg.Parent})
+	if err != nil {
+		return nil, err
+	}
+	return &Record{Blob: migrated}, nil
+}
+
+// Verify checks that the sealed object of record is wrapped for the
+// authority whose public area is authorityPub, and that its policy only
+// allows its duplication to the authority: no other party got a copy it
+// could open.
+func Verify(record *Record, authorityPub tpm2.TPMTPublic) error {
+	if record == nil || record.Blob == nil {
+		return errors.New("missing record")
+	}
+	blob := record.Blob
+	if blob.Duplication == nil || blob.Duplicate == nil || blob.Seed == nil {
+		return fmt.Errorf("%w: blob isn't wrapped for the authority", ErrPolicyNotEnforced)
+	}
+	if err := names.Verify(blob.Duplication.ParentName, authorityPub); err != nil {
+		return fmt.Errorf("%w: duplication parent isn't the authority: %v", ErrPolicyNotEnforced, err)
+	}
+	public, err := tpm2.Unmarshal[tpm2.TPM2BPublic](blob.Public)
+	if err != nil {
+		return fmt.Errorf("failed to decode sealed object public area: %w", err)
+	}
+	pub, err := public.Contents()
+	if err != nil {
+		return fmt.Errorf("failed to decode sealed object public area: %w", err)
+	}
+	if err := names.Verify(blob.Name, *pub); err != nil {
+		return err
+	}
+
+	attrs := pub.ObjectAttributes
+	if pub.Type != tpm2.TPMAlgKeyedHash || attrs.SignEncrypt || attrs.Decrypt {
+		return fmt.Errorf("%w: not a sealed data object", ErrPolicyNotEnforced)
+	}
+	expected, err := duplicationPolicy(blob.Duplication.ParentName)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(expected, blob.Duplication.Digest) || !bytes.Equal(pub.AuthPolicy.Buffer, expected) {
+		return fmt.Errorf("%w: policy %x, expected %x", ErrPolicyNotEnforced, pub.AuthPolicy.Buffer, expected)
+	}
+	return nil
+}
+
+// Release unseals the secret of record with the storage key of the
+// authority, and wraps it for the EK whose public area is targetEK. The
+// output is only usable by [Restore] on the TPM of that EK.
+//
+// Release doesn't check targetEK: its certificate must be verified first.
+func Release(tpm transport.TPM, record *Record, authorityKey tpmutil.Handle, targetEK tpm2.TPMTPublic) (*keyimport.Blob, error) {
+	if authorityKey == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+	if authorityKey.Public() == nil {
+		return nil, errors.New("authority key has no public area")
+	}
+	if err := Verify(record, *authorityKey.Public()); err != nil {
+		return nil, err
+	}
+	secret, err := unseal.Unseal(tpm, record.Blob, unseal.UnsealConfig{Parent: authorityKey})
+	if err != nil {
+		return nil, err
+	}
+	return wrap(secret, targetEK)
+}
+
+// RestoreConfig holds configuration for [Restore].
+type RestoreConfig struct {
+	// EK is the template of the EK the secret was released to.
+	//
+	// Default: the RSA-2048 EK (ekcert.Templates[0], template L-1).
+	EK *ekcert.Template
+	// EndorsementAuth authorizes the endorsement hierarchy, for the EKs
+	// only usable through their policy.
+	//
+	// Default: an empty password.
+	EndorsementAuth tpm2.Session
+	// Seal configures the sealing of the restored secret.
+	//
+	// Default: sealed under the ECC SRK, see unseal.SealConfig.
+	Seal unseal.SealConfig
+}
+
+// CheckAndSetDefault validates and sets default values for RestoreConfig.
+func (c *RestoreConfig) CheckAndSetDefault() error {
+	if c.EK == nil {
+		c.EK = &ekcert.Templates[0]
+	}
+	return c.Seal.CheckAndSetDefault()
+}
+
+// Restore imports the secret released by the authority under the EK, and
+// seals it under the configured parent: the output is unsealed with
+// unseal.Unseal.
+func Restore(tpm transport.TPM, released *keyimport.Blob, optionalCfg ...RestoreConfig) (*unseal.Blob, error) {
+	var cfg RestoreConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	secret, err := importSecret(tpm, released, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return unseal.Seal(tpm, secret, cfg.Seal)
+}
+
+// importSecret imports the secret released by the authority under the EK and
+// unseals it. The EK and the imported object are flushed before returning,
+// freeing their slots for the sealing of the secret.
+func importSecret(tpm transport.TPM, released *keyimport.Blob, cfg RestoreConfig) ([]byte, error) {
+	ek, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: tpm2.TPMRHEndorsement,
+		InPublic:      cfg.EK.Public,
+		Auth:          cfg.EndorsementAuth,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create EK: %w", err)
+	}
+	defer ek.Close() //nolint:errcheck
+
+	var endorsementAuth []tpm2.Session
+	if cfg.EndorsementAuth != nil {
+		endorsementAuth = append(endorsementAuth, cfg.EndorsementAuth)
+	}
+	sealed, err := keyimport.Import(tpm, ek, released, cfg.EK.Auth(endorsementAuth...))
+	if err != nil {
+		return nil, err
+	}
+	defer sealed.Close() //nolint:errcheck
+
+	rsp, err := tpm2.Unseal{ItemHandle: tpmutil.ToAuthHandle(sealed)}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal released secret: %w", tpmerrors.Wrap(err))
+	}
+	return rsp.OutData.Buffer, nil
+}
+
+// wrap wraps secret in a sealed data object importable under the storage key
+// ekPub.
+func wrap(secret []byte, ekPub tpm2.TPMTPublic) (*keyimport.Blob, error) {
+	// Imported objects can't be fixedTPM nor fixedParent.
+	public := templates.Seal(templates.WithNoDA(), func(t *tpm2.TPMTPublic) {
+		t.ObjectAttributes.FixedTPM = false
+		t.ObjectAttributes.FixedParent = false
+	})
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	// The unique field binds the public area to the sensitive area.
+	h := sha256.New()
+	h.Write(seed)
+	h.Write(secret)
+	public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgKeyedHash, &tpm2.TPM2BDigest{Buffer: h.Sum(nil)})
+	sensitive := tpm2.TPMTSensitive{
+		SensitiveType: tpm2.TPMAlgKeyedHash,
+		SeedValue:     tpm2.TPM2BDigest{Buffer: seed},
+		Sensitive:     tpm2.NewTPMUSensitiveComposite(tpm2.TPMAlgKeyedHash, &tpm2.TPM2BSensitiveData{Buffer: secret}),
+	}
+
+	name, err := names.Compute(public)
+	if err != nil {
+		return nil, err
+	}
+	ek, err := tpm2.ImportEncapsulationKey(&ekPub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EK: %w", err)
+	}
+	duplicate, encSeed, err := tpm2.CreateDuplicate(rand.Reader, ek, name.Buffer, tpm2.Marshal(sensitive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap secret: %w", err)
+	}
+	return &keyimport.Blob{Public: public, Duplicate: duplicate, EncryptedSeed: encSeed}, nil
+}
+
+// duplicationPolicy computes the policy only allowing the duplication to the
+// storage key named parentName, as set by unseal.Seal.
+func duplicationPolicy(parentName []byte) ([]byte, error) {
+	calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+	if err != nil {
+		return nil, err
+	}
+	if err := (tpm2.PolicyDuplicationSelect{NewParentName: tpm2.TPM2BName{Buffer: parentName}}).Update(calc); err != nil {
+		return nil, fmt.Errorf("failed to compute duplication policy: %w", err)
+	}
+	return calc.Hash().Digest, nil
+}
@@ -0,0 +1,86 @@
+package escrow_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+	"github.com/loicsikidi/tpm-stuff/escrow"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/unseal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscrow(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	fixtures := testutil.NewFixtures(t, thetpm)
+	// A single TPM plays device A, the authority and device B: the RSA SRK
+	// stands for the storage key of the authority.
+	authority := fixtures.RSASRK(t)
+	secret := []byte("disk key")
+
+	record, err := escrow.Backup(thetpm, secret, *authority.Public())
+	require.NoError(t, err)
+	require.NoError(t, escrow.Verify(record, *authority.Public()))
+
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+	var decoded escrow.Record
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	for _, template := range []ekcert.Template{ekcert.Templates[0], ekcert.Templates[1], ekcert.Templates[2]} {
+		t.Run(template.Name, func(t *testing.T) {
+			ek, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+				PrimaryHandle: tpm2.TPMRHEndorsement,
+				InPublic:      template.Public,
+			})
+			require.NoError(t, err)
+			ekPub := *ek.Public()
+			require.NoError(t, ek.Close())
+
+			released, err := escrow.Release(thetpm, &decoded, authority, ekPub)
+			require.NoError(t, err)
+			restored, err := escrow.Restore(thetpm, released, escrow.RestoreConfig{EK: &template})
+			require.NoError(t, err)
+			got, err := unseal.Unseal(thetpm, restored)
+			require.NoError(t, err)
+			require.Equal(t, secret, got)
+		})
+	}
+}
+
+func TestVerify_PolicyNotEnforced(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	fixtures := testutil.NewFixtures(t, thetpm)
+	authority := fixtures.RSASRK(t)
+
+	record, err := escrow.Backup(thetpm, []byte("disk key"), *authority.Public())
+	require.NoError(t, err)
+
+	// Another authority.
+	require.ErrorIs(t, escrow.Verify(record, *fixtures.SRK(t).Public()), escrow.ErrPolicyNotEnforced)
+
+	// A blob which isn't wrapped for the authority.
+	blob, err := unseal.Seal(thetpm, []byte("disk key"))
+	require.NoError(t, err)
+	require.ErrorIs(t, escrow.Verify(&escrow.Record{Blob: blob}, *authority.Public()), escrow.ErrPolicyNotEnforced)
+
+	// A duplication digest which doesn't match the parent.
+	tampered := *record.Blob
+	duplication := *tampered.Duplication
+	duplication.Digest = append([]byte{}, duplication.Digest...)
+	duplication.Digest[0] ^= 1
+	tampered.Duplication = &duplication
+	require.ErrorIs(t, escrow.Verify(&escrow.Record{Blob: &tampered}, *authority.Public()), escrow.ErrPolicyNotEnforced)
+
+	// A sealed object whose name doesn't match its public area.
+	tampered = *record.Blob
+	tampered.Name = append([]byte{}, tampered.Name...)
+	tampered.Name[len(tampered.Name)-1] ^= 1
+	require.Error(t, escrow.Verify(&escrow.Record{Blob: &tampered}, *authority.Public()))
+
+	_, err = escrow.Release(thetpm, &escrow.Record{Blob: blob}, authority, tpm2.RSAEKTemplate)
+	require.ErrorIs(t, err, escrow.ErrPolicyNotEnforced)
+}
@@ -0,0 +1,167 @@
+// Package handles manages the lifecycle of the transient objects and
+// sessions created during a program run.
+package handles
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/capability"
+)
+
+// Config holds configuration for [NewTracker].
+type Config struct {
+	// Warnf reports the handles leaked: created after [NewTracker] and still
+	// loaded after [Tracker.Close].
+	//
+	// Default: [log.Printf].
+	Warnf func(format string, args ...any)
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	if c.Warnf == nil {
+		c.Warnf = log.Printf
+	}
+	return nil
+}
+
+// Tracker flushes the handles registered to it in reverse order on
+// [Tracker.Close], replacing a deferred FlushContext per object which is easy
+// to forget on error paths. It is safe for concurrent use.
+//
+// Example:
+//
+//	tracker := handles.NewTracker(tpm)
+//	defer tracker.Close()
+//
+//	rsp, err := tpm2.CreatePrimary{...}.Execute(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	tracker.Track(rsp.ObjectHandle)
+type Tracker struct {
+	tpm transport.TPM
+	cfg Config
+
+	mu      sync.Mutex
+	closers []closer
+	// before lists the handles loaded when the tracker was created.
+	before []tpm2.TPMHandle
+	closed bool
+}
+
+type closer struct {
+	handle tpm2.TPMHandle
+	close  func() error
+}
+
+// NewTracker returns a Tracker flushing handles from tpm.
+func NewTracker(tpm transport.TPM, optionalCfg ...Config) *Tracker {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	_ = cfg.CheckAndSetDefault()
+	t := &Tracker{tpm: tpm, cfg: cfg}
+	// Without the initial list, no leak can be reported.
+	t.before, _ = Loaded(tpm)
+	return t
+}
+
+// Track registers the transient object or session h, flushed with
+// TPM2_FlushContext.
+func (t *Tracker) Track(h tpm2.TPMHandle) {
+	t.add(h, func() error {
+		_, err := tpm2.FlushContext{FlushHandle: h}.Execute(t.tpm)
+		return err
+	})
+}
+
+// TrackHandle registers h, closed by the tracker, and returns it.
+func (t *Tracker) TrackHandle(h tpmutil.HandleCloser) tpmutil.HandleCloser {
+	t.add(h.Handle(), h.Close)
+	return h
+}
+
+// TrackSession registers a session created by [tpm2.HMACSession] or
+// [tpm2.PolicySession] with the closer returned along, and returns it.
+func (t *Tracker) TrackSession(sess tpm2.Session, closer func() error) tpm2.Session {
+	t.add(sess.Handle(), closer)
+	return sess
+}
+
+// Flush flushes the tracked handle h before the tracker is closed.
+func (t *Tracker) Flush(h tpm2.TPMHandle) error {
+	t.mu.Lock()
+	i := slices.IndexFunc(t.closers, func(c closer) bool { return c.handle == h })
+	if i < 0 {
+		t.mu.Unlock()
+		return fmt.Errorf("handle 0x%x not tracked", h)
+	}
+	c := t.closers[i]
+	t.closers = slices.Delete(t.closers, i, i+1)
+	t.mu.Unlock()
+
+	if err := c.close(); err != nil {
+		return fmt.Errorf("failed to flush 0x%x: %w", h, err)
+	}
+	return nil
+}
+
+// Close flushes the tracked handles, the last tracked first, then warns
+// about the handles loaded since the tracker creation which are still
+// loaded.
+func (t *Tracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	var errs []error
+	for _, c := range slices.Backward(t.closers) {
+		if err := c.close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to flush 0x%x: %w", c.handle, err))
+		}
+	}
+	t.closers = nil
+
+	if t.before != nil {
+		if loaded, err := Loaded(t.tpm); err == nil {
+			for _, h := range loaded {
+				if !slices.Contains(t.before, h) {
+					t.cfg.Warnf("handles: 0x%x leaked: loaded but not tracked", h)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Tracker) add(h tpm2.TPMHandle, close func() error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closers = append(t.closers, closer{handle: h, close: close})
+}
+
+// Loaded returns the transient objects and sessions loaded in the TPM.
+func Loaded(tpm transport.TPM) ([]tpm2.TPMHandle, error) {
+	// The list of loaded sessions holds both HMAC and policy sessions.
+	sessions, err := capability.Handles(tpm, tpm2.TPMHTHMACSession)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list loaded sessions: %w", err)
+	}
+	objects, err := capability.Handles(tpm, tpm2.TPMHTTransient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transient objects: %w", err)
+	}
+	return append(sessions, objects...), nil
+}
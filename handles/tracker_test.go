@@ -0,0 +1,105 @@
+package handles_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/handles"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// flushLog records the FlushContext commands.
+type flushLog struct {
+	transport.TPM
+	flushed []tpm2.TPMHandle
+}
+
+func (f *flushLog) Send(cmd []byte) ([]byte, error) {
+	// FlushContext: header then flushHandle.
+	if len(cmd) == 14 && tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:])) == tpm2.TPMCCFlushContext {
+		f.flushed = append(f.flushed, tpm2.TPMHandle(binary.BigEndian.Uint32(cmd[10:])))
+	}
+	return f.TPM.Send(cmd)
+}
+
+func TestTracker(t *testing.T) {
+	thetpm := &flushLog{TPM: testutil.OpenSimulator(t)}
+	var warnings []string
+	tracker := handles.NewTracker(thetpm, handles.Config{Warnf: func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}})
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	tracker.TrackHandle(srk)
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
+	sess, closer, err := tpm2.HMACSession(thetpm, tpm2.TPMAlgSHA256, 16)
+	require.NoError(t, err)
+	tracker.TrackSession(sess, closer)
+
+	loaded, err := handles.Loaded(thetpm)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []tpm2.TPMHandle{srk.Handle(), rsp.ObjectHandle, sess.Handle()}, loaded)
+
+	require.NoError(t, tracker.Close())
+	require.Empty(t, warnings)
+	// Flushed in LIFO order.
+	require.Equal(t, []tpm2.TPMHandle{sess.Handle(), rsp.ObjectHandle, srk.Handle()}, thetpm.flushed)
+
+	loaded, err = handles.Loaded(thetpm)
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+
+	// Closing twice is a no-op.
+	require.NoError(t, tracker.Close())
+}
+
+func TestTracker_Flush(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	tracker := handles.NewTracker(thetpm)
+	defer tracker.Close()
+
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
+
+	require.NoError(t, tracker.Flush(rsp.ObjectHandle))
+	require.ErrorContains(t, tracker.Flush(rsp.ObjectHandle), "not tracked")
+}
+
+func TestTracker_Leak(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	// Loaded before the tracker: not its concern.
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	var warnings []string
+	tracker := handles.NewTracker(thetpm, handles.Config{Warnf: func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}})
+
+	leaked, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	defer tpm2.FlushContext{FlushHandle: leaked.ObjectHandle}.Execute(thetpm)
+
+	require.NoError(t, tracker.Close())
+	require.Equal(t, []string{fmt.Sprintf("handles: 0x%x leaked: loaded but not tracked", leaked.ObjectHandle)}, warnings)
+}
@@ -0,0 +1,100 @@
+package hierarchy
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/capability"
+	"github.com/loicsikidi/tpm-stuff/internal/rawcmd"
+)
+
+// State is the enable state of the hierarchies, reported by the
+// TPM_PT_STARTUP_CLEAR property.
+type State struct {
+	Platform    bool
+	Owner       bool
+	Endorsement bool
+	PlatformNV  bool
+}
+
+// Enabled returns the hierarchy enabled for hierarchy in s.
+func (s State) Enabled(hierarchy tpm2.TPMHandle) bool {
+	switch hierarchy {
+	case tpm2.TPMRHPlatform:
+		return s.Platform
+	case tpm2.TPMRHOwner:
+		return s.Owner
+	case tpm2.TPMRHEndorsement:
+		return s.Endorsement
+	case tpm2.TPMRHPlatformNV:
+		return s.PlatformNV
+	}
+	return false
+}
+
+// ReadState returns the enable state of the hierarchies.
+func ReadState(tpm transport.TPM) (*State, error) {
+	v, err := capability.Property(tpm, tpm2.TPMPTStartupClear)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TPM_PT_STARTUP_CLEAR: %w", err)
+	}
+	// TPMA_STARTUP_CLEAR: phEnable, shEnable, ehEnable, phEnableNV.
+	return &State{
+		Platform:    v&(1<<0) != 0,
+		Owner:       v&(1<<1) != 0,
+		Endorsement: v&(1<<2) != 0,
+		PlatformNV:  v&(1<<3) != 0,
+	}, nil
+}
+
+// Disable disables hierarchy (owner, endorsement, platform or platform NV)
+// until the next TPM reset or a call to [Enable].
+//
+// The owner and endorsement hierarchies may disable themselves, while the
+// platform hierarchy may disable any of them: authHierarchy (hierarchy
+// itself or TPM_RH_PLATFORM) is authorized with auth, through a password
+// session.
+func Disable(tpm transport.TPM, hierarchy, authHierarchy tpm2.TPMHandle, auth []byte) error {
+	switch authHierarchy {
+	case tpm2.TPMRHPlatform:
+	case tpm2.TPMRHOwner, tpm2.TPMRHEndorsement:
+		if hierarchy != authHierarchy {
+			return fmt.Errorf("%w: 0x%x can't disable 0x%x", ErrUnsupportedHierarchy, authHierarchy, hierarchy)
+		}
+	default:
+		return fmt.Errorf("%w: 0x%x can't control hierarchies", ErrUnsupportedHierarchy, authHierarchy)
+	}
+	return hierarchyControl(tpm, authHierarchy, auth, hierarchy, false)
+}
+
+// Enable enables a hierarchy disabled by [Disable]. Only the platform
+// hierarchy, authorized with platformAuth through a password session, can do
+// so.
+func Enable(tpm transport.TPM, hierarchy tpm2.TPMHandle, platformAuth []byte) error {
+	return hierarchyControl(tpm, tpm2.TPMRHPlatform, platformAuth, hierarchy, true)
+}
+
+// hierarchyControl runs TPM2_HierarchyControl, which go-tpm doesn't
+// implement. Its parameters are not secret and can't be encrypted, so the
+// command is authorized with a password session: no HMAC or encrypted session
+// is supported (see rawcmd.Execute).
+func hierarchyControl(tpm transport.TPM, authHandle tpm2.TPMHandle, auth []byte, enable tpm2.TPMHandle, state bool) error {
+	switch enable {
+	case tpm2.TPMRHOwner, tpm2.TPMRHEndorsement, tpm2.TPMRHPlatform, tpm2.TPMRHPlatformNV:
+	default:
+		return fmt.Errorf("%w: 0x%x", ErrUnsupportedHierarchy, enable)
+	}
+
+	params := binary.BigEndian.AppendUint32(nil, uint32(enable))
+	if state {
+		params = append(params, 1)
+	} else {
+		params = append(params, 0)
+	}
+	if err := rawcmd.Execute(tpm, tpm2.TPMCCHierarchyControl, []tpm2.TPMHandle{authHandle}, auth, params); err != nil {
+		return fmt.Errorf("failed to set hierarchy 0x%x state: %w", enable, err)
+	}
+	return nil
+}
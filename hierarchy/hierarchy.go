@@ -0,0 +1,93 @@
+// Package hierarchy manages the TPM hierarchies: their authorization values,
+// TPM2_Clear and their enable state.
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+)
+
+// ErrUnsupportedHierarchy is returned for handles which are not a hierarchy
+// supported by the operation.
+var ErrUnsupportedHierarchy = errors.New("unsupported hierarchy")
+
+// authSession returns an HMAC session authorizing hierarchy with auth.
+//
+// The session is bound to the hierarchy: its HMAC key then doesn't include
+// the authorization value, which HierarchyChangeAuth and Clear change before
+// the TPM computes the response HMAC. Extra options, such as parameter
+// encryption, are applied to the session.
+func authSession(hierarchy tpm2.TPMHandle, auth []byte, opts ...tpm2.AuthOption) tpm2.Session {
+	opts = append([]tpm2.AuthOption{
+		tpm2.Auth(auth),
+		tpm2.Bound(hierarchy, tpm2.HandleName(hierarchy), auth),
+	}, opts...)
+	return tpm2.HMAC(tpm2.TPMAlgSHA256, 16, opts...)
+}
+
+// ChangeAuth replaces the authorization value of hierarchy (owner,
+// endorsement, lockout or platform), currently currentAuth, with newAuth.
+//
+// The command is authorized with an HMAC session which also encrypts newAuth
+// with a key derived from currentAuth. With an empty currentAuth, this key
+// only depends on values sent in clear: newAuth is then merely obfuscated.
+// An empty newAuth removes the authorization value.
+func ChangeAuth(tpm transport.TPM, hierarchy tpm2.TPMHandle, currentAuth, newAuth []byte) error {
+	return changeAuth(tpm, hierarchy, authSession(hierarchy, currentAuth, tpm2.AESEncryption(128, tpm2.EncryptIn)), newAuth)
+}
+
+// ChangeAuthSalted is like [ChangeAuth], but the session is also salted with
+// saltKey, a loaded decryption key such as the EK: the key encrypting newAuth
+// then derives from a secret only the TPM can recover, which protects newAuth
+// on the bus even when currentAuth is empty, e.g. on first provisioning.
+func ChangeAuthSalted(tpm transport.TPM, hierarchy tpm2.TPMHandle, currentAuth, newAuth []byte, saltKey tpmutil.Handle) error {
+	if !saltKey.HasPublic() {
+		return fmt.Errorf("salt key 0x%x has no public area", saltKey.Handle())
+	}
+	session := authSession(hierarchy, currentAuth,
+		tpm2.Salted(saltKey.Handle(), *saltKey.Public()),
+		tpm2.AESEncryption(128, tpm2.EncryptIn))
+	return changeAuth(tpm, hierarchy, session, newAuth)
+}
+
+// changeAuth runs HierarchyChangeAuth authorized by session.
+func changeAuth(tpm transport.TPM, hierarchy tpm2.TPMHandle, session tpm2.Session, newAuth []byte) error {
+	switch hierarchy {
+	case tpm2.TPMRHOwner, tpm2.TPMRHEndorsement, tpm2.TPMRHLockout, tpm2.TPMRHPlatform:
+	default:
+		return fmt.Errorf("%w: 0x%x", ErrUnsupportedHierarchy, hierarchy)
+	}
+	_, err := tpm2.HierarchyChangeAuth{
+		AuthHandle: tpm2.AuthHandle{
+			Handle: hierarchy,
+			Auth:   session,
+		},
+		NewAuth: tpm2.TPM2BAuth{Buffer: newAuth},
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to change hierarchy auth: %w", err)
+	}
+	return nil
+}
+
+// Clear runs TPM2_Clear authorized by the lockout hierarchy.
+//
+// It removes all the objects and NV indexes of the owner and endorsement
+// hierarchies, changes their seeds and resets the owner, endorsement and
+// lockout authorization values and policies.
+func Clear(tpm transport.TPM, lockoutAuth []byte) error {
+	_, err := tpm2.Clear{
+		AuthHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMRHLockout,
+			Auth:   authSession(tpm2.TPMRHLockout, lockoutAuth),
+		},
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to clear TPM: %w", err)
+	}
+	return nil
+}
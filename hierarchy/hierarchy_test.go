@@ -0,0 +1,148 @@
+package hierarchy_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/hierarchy"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/stretchr/testify/require"
+)
+
+func createPrimary(thetpm transport.TPM, hierarchy tpm2.TPMHandle, auth []byte) error {
+	key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: hierarchy,
+		Auth:          tpm2.PasswordAuth(auth),
+		InPublic:      tpmutil.ECCSRKTemplate,
+	})
+	if err != nil {
+		return err
+	}
+	return key.Close()
+}
+
+func TestChangeAuth(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	for name, h := range map[string]tpm2.TPMHandle{
+		"owner":       tpm2.TPMRHOwner,
+		"endorsement": tpm2.TPMRHEndorsement,
+		"lockout":     tpm2.TPMRHLockout,
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := sniffer.New(thetpm)
+			first := []byte(name + "-first-password")
+			second := []byte(name + "-second-password")
+
+			// Set, rotate, then remove the authorization value.
+			require.NoError(t, hierarchy.ChangeAuth(rec, h, nil, first))
+			require.NoError(t, hierarchy.ChangeAuth(rec, h, first, second))
+			require.NoError(t, hierarchy.ChangeAuth(rec, h, second, nil))
+
+			// The new values never travel in clear.
+			for _, cmd := range rec.Commands() {
+				require.False(t, bytes.Contains(cmd, first))
+				require.False(t, bytes.Contains(cmd, second))
+			}
+		})
+	}
+
+	require.ErrorIs(t, hierarchy.ChangeAuth(thetpm, tpm2.TPMRHNull, nil, nil), hierarchy.ErrUnsupportedHierarchy)
+}
+
+func TestChangeAuthSalted(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	fixtures := testutil.NewFixtures(t, thetpm)
+	ek := fixtures.EK(t)
+
+	rec := sniffer.New(thetpm)
+	ownerAuth := []byte("owner-password")
+	require.NoError(t, hierarchy.ChangeAuthSalted(rec, tpm2.TPMRHOwner, nil, ownerAuth, ek))
+	for _, cmd := range rec.Commands() {
+		require.False(t, bytes.Contains(cmd, ownerAuth))
+	}
+	require.NoError(t, createPrimary(thetpm, tpm2.TPMRHOwner, ownerAuth))
+	require.NoError(t, hierarchy.ChangeAuthSalted(thetpm, tpm2.TPMRHOwner, ownerAuth, nil, ek))
+	require.NoError(t, createPrimary(thetpm, tpm2.TPMRHOwner, nil))
+
+	require.ErrorIs(t, hierarchy.ChangeAuthSalted(thetpm, tpm2.TPMRHNull, nil, nil, ek), hierarchy.ErrUnsupportedHierarchy)
+}
+
+func TestChangeAuth_OwnerHierarchyUse(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	ownerAuth := []byte("owner-password")
+	require.NoError(t, hierarchy.ChangeAuth(thetpm, tpm2.TPMRHOwner, nil, ownerAuth))
+	t.Cleanup(func() {
+		require.NoError(t, hierarchy.ChangeAuth(thetpm, tpm2.TPMRHOwner, ownerAuth, nil))
+	})
+
+	require.Error(t, createPrimary(thetpm, tpm2.TPMRHOwner, nil))
+	require.NoError(t, createPrimary(thetpm, tpm2.TPMRHOwner, ownerAuth))
+	require.Error(t, hierarchy.ChangeAuth(thetpm, tpm2.TPMRHOwner, nil, []byte("other")))
+}
+
+func TestClear(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	ownerAuth := []byte("owner-password")
+	lockoutAuth := []byte("lockout-password")
+	require.NoError(t, hierarchy.ChangeAuth(thetpm, tpm2.TPMRHOwner, nil, ownerAuth))
+	require.NoError(t, hierarchy.ChangeAuth(thetpm, tpm2.TPMRHLockout, nil, lockoutAuth))
+
+	// A failed lockout authorization would put the TPM in lockout mode: only
+	// use the right value.
+	require.NoError(t, hierarchy.Clear(thetpm, lockoutAuth))
+
+	// The authorization values are reset.
+	require.NoError(t, createPrimary(thetpm, tpm2.TPMRHOwner, nil))
+	require.NoError(t, hierarchy.Clear(thetpm, nil))
+}
+
+func TestDisableAndEnable(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	state, err := hierarchy.ReadState(thetpm)
+	require.NoError(t, err)
+	require.Equal(t, hierarchy.State{Platform: true, Owner: true, Endorsement: true, PlatformNV: true}, *state)
+
+	for name, h := range map[string]tpm2.TPMHandle{
+		"owner":       tpm2.TPMRHOwner,
+		"endorsement": tpm2.TPMRHEndorsement,
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, hierarchy.Disable(thetpm, h, h, nil))
+			t.Cleanup(func() { _ = hierarchy.Enable(thetpm, h, nil) })
+
+			state, err := hierarchy.ReadState(thetpm)
+			require.NoError(t, err)
+			require.False(t, state.Enabled(h))
+			require.Error(t, createPrimary(thetpm, h, nil))
+
+			// Only the platform can enable a hierarchy again.
+			require.NoError(t, hierarchy.Enable(thetpm, h, nil))
+			state, err = hierarchy.ReadState(thetpm)
+			require.NoError(t, err)
+			require.True(t, state.Enabled(h))
+			require.NoError(t, createPrimary(thetpm, h, nil))
+		})
+	}
+
+	require.ErrorIs(t, hierarchy.Disable(thetpm, tpm2.TPMRHPlatform, tpm2.TPMRHOwner, nil), hierarchy.ErrUnsupportedHierarchy)
+	require.ErrorIs(t, hierarchy.Disable(thetpm, tpm2.TPMRHOwner, tpm2.TPMRHEndorsement, nil), hierarchy.ErrUnsupportedHierarchy)
+	require.ErrorIs(t, hierarchy.Disable(thetpm, tpm2.TPMRHOwner, tpm2.TPMRHLockout, nil), hierarchy.ErrUnsupportedHierarchy)
+}
+
+func TestDisable_WrongAuth(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	err := hierarchy.Disable(thetpm, tpm2.TPMRHEndorsement, tpm2.TPMRHEndorsement, []byte("wrong"))
+	require.Error(t, err)
+	state, err := hierarchy.ReadState(thetpm)
+	require.NoError(t, err)
+	require.True(t, state.Endorsement)
+}
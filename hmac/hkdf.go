@@ -0,0 +1,140 @@
+package hmac
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/unbound"
+)
+
+// ErrLength is returned by [Expand] when the requested length is not between
+// 1 and 255 times the digest size of the key.
+var ErrLength = errors.New("invalid derived key length")
+
+// ExpandConfig holds configuration for [Expand].
+type ExpandConfig struct {
+	// KeyHandle is the handle of the HMAC key used as the pseudorandom key.
+	//
+	// Required.
+	KeyHandle tpmutil.Handle
+	// Auth is the authorization value of the key.
+	//
+	// Default: nil.
+	Auth []byte
+	// Session returns the session authorizing each TPM2_HMAC.
+	//
+	// Default: unbound.Unbound with Auth, which encrypts the derived blocks
+	// on the bus.
+	Session func() tpm2.Session
+	// Label and Context form the HKDF info (see [Info]): the label names the
+	// purpose of the key, the context binds it to e.g. a user or a file.
+	Label   string
+	Context []byte
+	// Info is the raw HKDF info, for interoperability with other HKDF
+	// schemes. It overrides Label and Context when not nil.
+	Info []byte
+	// Length is the size of the derived key in bytes.
+	//
+	// Required.
+	Length int
+}
+
+// CheckAndSetDefault validates and sets default values for ExpandConfig.
+func (c *ExpandConfig) CheckAndSetDefault() error {
+	if c.KeyHandle == nil {
+		return tpmutil.ErrMissingHandle
+	}
+	if c.Length <= 0 {
+		return fmt.Errorf("%w: %d", ErrLength, c.Length)
+	}
+	if c.Session == nil {
+		auth := c.Auth
+		c.Session = func() tpm2.Session {
+			return unbound.Unbound(auth)
+		}
+	}
+	return nil
+}
+
+// Info returns the HKDF info of label and context: label || 0x00 || context.
+// The separator keeps ("ab", "c") and ("a", "bc") apart.
+func Info(label string, context []byte) []byte {
+	info := append([]byte(label), 0)
+	return append(info, context...)
+}
+
+// Expand derives a key of cfg.Length bytes with HKDF-Expand (RFC 5869), the
+// TPM HMAC key being the pseudorandom key: many sub-keys can be derived from a
+// single secret that never leaves the TPM. The result matches
+// hkdf.Expand(h, key, hmac.Info(label, context), length) for an imported key.
+//
+// Each block costs a TPM2_HMAC: Length should remain small (a few digests).
+//
+// Example:
+//
+//	encKey, err := hmac.Expand(tpm, hmac.ExpandConfig{
+//	    KeyHandle: keyHandle,
+//	    Label:     "disk encryption",
+//	    Context:   []byte(deviceID),
+//	    Length:    32,
+//	})
+func Expand(tpm transport.TPM, cfg ExpandConfig) ([]byte, error) {
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	h := cfg.KeyHandle
+	if !h.HasPublic() {
+		var err error
+		if h, err = tpmutil.ToHandle(tpm, h.Handle()); err != nil {
+			return nil, err
+		}
+	}
+	size, err := digestSize(h.Public())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Length > 255*size {
+		return nil, fmt.Errorf("%w: %d, at most %d", ErrLength, cfg.Length, 255*size)
+	}
+
+	info := cfg.Info
+	if info == nil {
+		info = Info(cfg.Label, cfg.Context)
+	}
+	var out, block []byte
+	for i := byte(1); len(out) < cfg.Length; i++ {
+		// T(i) = HMAC(PRK, T(i-1) || info || i)
+		data := append(append(block, info...), i)
+		rsp, err := tpm2.Hmac{
+			Handle:  tpmutil.ToAuthHandle(h, cfg.Session()),
+			Buffer:  tpm2.TPM2BMaxBuffer{Buffer: data},
+			HashAlg: tpm2.TPMAlgNull,
+		}.Execute(tpm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute HMAC: %w", err)
+		}
+		block = rsp.OutHMAC.Buffer
+		out = append(out, block...)
+	}
+	return out[:cfg.Length], nil
+}
+
+// digestSize returns the output size of the HMAC key public.
+func digestSize(public *tpm2.TPMTPublic) (int, error) {
+	params, err := public.Parameters.KeyedHashDetail()
+	if err != nil || params.Scheme.Scheme != tpm2.TPMAlgHMAC {
+		return 0, errors.New("not an HMAC key")
+	}
+	scheme, err := params.Scheme.Details.HMAC()
+	if err != nil {
+		return 0, errors.New("not an HMAC key")
+	}
+	ha, err := scheme.HashAlg.Hash()
+	if err != nil {
+		return 0, fmt.Errorf("unsupported HMAC hash: %w", err)
+	}
+	return ha.Size(), nil
+}
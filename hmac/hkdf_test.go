@@ -0,0 +1,151 @@
+package hmac
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex: %v", err)
+	}
+	return b
+}
+
+func TestExpand(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	srkHandle, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpmutil.ECCSRKTemplate,
+	})
+	if err != nil {
+		t.Fatalf("failed to create SRK: %v", err)
+	}
+	defer srkHandle.Close()
+
+	t.Run("RFC 5869 test case 1", func(t *testing.T) {
+		keyHandle, err := Import(thetpm, ImportConfig{
+			ParentHandle: srkHandle,
+			Key:          mustHex(t, "077709362c2e32df0ddc3f0dc47bba6390b6c73bb50f9c3122ec844ad7c2b3e5"),
+		})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		defer keyHandle.Close()
+
+		got, err := Expand(thetpm, ExpandConfig{
+			KeyHandle: keyHandle,
+			Info:      mustHex(t, "f0f1f2f3f4f5f6f7f8f9"),
+			Length:    42,
+		})
+		if err != nil {
+			t.Fatalf("Expand failed: %v", err)
+		}
+		want := mustHex(t, "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865")
+		if !bytes.Equal(got, want) {
+			t.Errorf("Expand = %x, want %x", got, want)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		hashAlg tpm2.TPMAlgID
+		length  int
+		soft    func(prk, info []byte, length int) ([]byte, error)
+	}{
+		{"sha256 single block", tpm2.TPMAlgSHA256, 16, func(prk, info []byte, length int) ([]byte, error) {
+			return hkdf.Expand(sha256.New, prk, string(info), length)
+		}},
+		{"sha256 several blocks", tpm2.TPMAlgSHA256, 100, func(prk, info []byte, length int) ([]byte, error) {
+			return hkdf.Expand(sha256.New, prk, string(info), length)
+		}},
+		{"sha384", tpm2.TPMAlgSHA384, 64, func(prk, info []byte, length int) ([]byte, error) {
+			return hkdf.Expand(sha512.New384, prk, string(info), length)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prk := tpmutil.MustGenerateRnd(32)
+			password := []byte("prk-password")
+			keyHandle, err := Import(thetpm, ImportConfig{
+				ParentHandle: srkHandle,
+				HashAlg:      tt.hashAlg,
+				Key:          prk,
+				UserAuth:     password,
+			})
+			if err != nil {
+				t.Fatalf("Import failed: %v", err)
+			}
+			defer keyHandle.Close()
+
+			cfg := ExpandConfig{
+				KeyHandle: keyHandle,
+				Auth:      password,
+				Label:     "disk encryption",
+				Context:   []byte("device-42"),
+				Length:    tt.length,
+			}
+			got, err := Expand(thetpm, cfg)
+			if err != nil {
+				t.Fatalf("Expand failed: %v", err)
+			}
+			want, err := tt.soft(prk, Info(cfg.Label, cfg.Context), tt.length)
+			if err != nil {
+				t.Fatalf("hkdf.Expand failed: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Expand = %x, crypto/hkdf = %x", got, want)
+			}
+
+			cfg.Context = []byte("device-43")
+			other, err := Expand(thetpm, cfg)
+			if err != nil {
+				t.Fatalf("Expand failed: %v", err)
+			}
+			if bytes.Equal(got, other) {
+				t.Errorf("distinct contexts derived the same key")
+			}
+		})
+	}
+}
+
+func TestExpand_Errors(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	template := hmacKeyTemplate
+	template.NameAlg = tpm2.TPMAlgSHA256
+	params, err := tpmcrypto.NewHMACParameters(tpm2.TPMAlgSHA256)
+	if err != nil {
+		t.Fatalf("failed to create HMAC parameters: %v", err)
+	}
+	template.Parameters = *params
+	keyHandle, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: template,
+		UserAuth: []byte("password"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create HMAC key: %v", err)
+	}
+	defer keyHandle.Close()
+
+	for _, length := range []int{0, 255*32 + 1} {
+		if _, err := Expand(thetpm, ExpandConfig{KeyHandle: keyHandle, Auth: []byte("password"), Length: length}); !errors.Is(err, ErrLength) {
+			t.Errorf("Expand(length=%d) error = %v, want %v", length, err, ErrLength)
+		}
+	}
+	if _, err := Expand(thetpm, ExpandConfig{KeyHandle: keyHandle, Auth: []byte("wrong"), Length: 32}); !errors.Is(err, tpm2.TPMRCAuthFail) {
+		t.Errorf("Expand with wrong auth error = %v, want %v", err, tpm2.TPMRCAuthFail)
+	}
+}
@@ -0,0 +1,114 @@
+// Package hmac contains helpers for HMAC keys held by the TPM.
+package hmac
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
+)
+
+// MaxKeySize is the largest key accepted by [Import].
+// Sensitive data of a keyedHash object is limited by MAX_SYM_DATA (128 bytes),
+// and the key of an HMAC key by the block size of its hash algorithm, e.g. 64
+// bytes for SHA-256: the TPM rejects longer keys with TPM_RC_SIZE.
+const MaxKeySize = 128
+
+// ErrKeySize is returned when the imported key is empty or larger than the
+// block size of its hash algorithm.
+var ErrKeySize = errors.New("invalid HMAC key size")
+
+// ImportTemplate returns the template of an HMAC key whose secret is provided
+// by the caller: SensitiveDataOrigin is cleared so the TPM accepts
+// the sensitive data supplied in TPM2_Create.
+func ImportTemplate(hashAlg tpm2.TPMAlgID) (tpm2.TPMTPublic, error) {
+	// tpmcrypto rejects the hash algorithms unsupported for HMAC keys.
+	if _, err := tpmcrypto.NewHMACParameters(hashAlg); err != nil {
+		return tpm2.TPMTPublic{}, err
+	}
+	return templates.HMACKey(hashAlg), nil
+}
+
+// ImportConfig holds configuration for [Import].
+type ImportConfig struct {
+	// ParentHandle is the handle of the storage key protecting the HMAC key.
+	//
+	// Required.
+	ParentHandle tpmutil.Handle
+	// ParentAuth is the authorization session for the parent key.
+	//
+	// Default: [tpmutil.NoAuth].
+	ParentAuth tpm2.Session
+	// HashAlg is the hash algorithm of the HMAC.
+	//
+	// Default: [tpm2.TPMAlgSHA256].
+	HashAlg tpm2.TPMAlgID
+	// Key is the externally generated HMAC secret, of up to the block size
+	// of HashAlg. Longer keys must be hashed first, as in RFC 2104.
+	//
+	// Required.
+	Key []byte
+	// UserAuth is the authorization value of the imported key.
+	//
+	// Default: nil.
+	UserAuth []byte
+}
+
+// CheckAndSetDefault validates and sets default values for ImportConfig.
+func (c *ImportConfig) CheckAndSetDefault() error {
+	if c.ParentHandle == nil {
+		return tpmutil.ErrMissingHandle
+	}
+	if c.ParentAuth == nil {
+		c.ParentAuth = tpmutil.NoAuth
+	}
+	if c.HashAlg == 0 {
+		c.HashAlg = tpm2.TPMAlgSHA256
+	}
+	h, err := tpm2.TPMIAlgHash(c.HashAlg).Hash()
+	if err != nil {
+		return fmt.Errorf("unsupported hash algorithm: %w", err)
+	}
+	maxSize := min(h.New().BlockSize(), MaxKeySize)
+	if len(c.Key) == 0 || len(c.Key) > maxSize {
+		return fmt.Errorf("%w: got %d bytes, want 1 to %d", ErrKeySize, len(c.Key), maxSize)
+	}
+	return nil
+}
+
+// Import brings an existing HMAC secret under the protection of the TPM and
+// loads it. The key travels in the sensitive area of TPM2_Create: use an
+// encrypted session as ParentAuth to keep it off the bus in plaintext.
+//
+// Example:
+//
+//	keyHandle, err := hmac.Import(tpm, hmac.ImportConfig{
+//	    ParentHandle: srkHandle,
+//	    Key:          secret,
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	defer keyHandle.Close()
+//
+//	mac, err := tpmutil.Hmac(tpm, tpmutil.HmacConfig{KeyHandle: keyHandle, Data: data})
+func Import(tpm transport.TPM, cfg ImportConfig) (tpmutil.HandleCloser, error) {
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	template, err := ImportTemplate(cfg.HashAlg)
+	if err != nil {
+		return nil, err
+	}
+	return tpmutil.Create(tpm, tpmutil.CreateConfig{
+		ParentHandle: cfg.ParentHandle,
+		ParentAuth:   cfg.ParentAuth,
+		InPublic:     template,
+		UserAuth:     cfg.UserAuth,
+		SealingData:  cfg.Key,
+	})
+}
@@ -2,12 +2,16 @@ package hmac
 
 import (
 	"bytes"
+	"crypto"
+	stdhmac "crypto/hmac"
+	"errors"
 	"testing"
 
 	"github.com/google/go-tpm/tpm2"
 	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
 	"github.com/loicsikidi/go-tpm-kit/tpmutil"
 	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
 )
 
 var hmacKeyTemplate = tpm2.TPMTPublic{
@@ -112,6 +116,10 @@ func TestHMAC(t *testing.T) {
 }
 
 func TestInvalidTemplate(t *testing.T) {
+	if err := templates.Validate(algNullTemplate); !errors.Is(err, templates.ErrInvalidTemplate) {
+		t.Fatalf("expected templates.Validate to reject the template, got %v", err)
+	}
+
 	thetpm := testutil.OpenSimulator(t)
 	if _, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
 		InPublic: algNullTemplate,
@@ -119,3 +127,81 @@ func TestInvalidTemplate(t *testing.T) {
 		t.Fatalf("expected error when creating primary key with invalid template, got nil")
 	}
 }
+
+func TestImport(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	srkHandle, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpmutil.ECCSRKTemplate,
+	})
+	if err != nil {
+		t.Fatalf("failed to create SRK: %v", err)
+	}
+	defer srkHandle.Close()
+
+	tests := []struct {
+		name    string
+		hashAlg tpm2.TPMAlgID
+		hash    crypto.Hash
+		keySize int
+	}{
+		{"sha256 short key", tpm2.TPMAlgSHA256, crypto.SHA256, 16},
+		{"sha256 block size key", tpm2.TPMAlgSHA256, crypto.SHA256, 64},
+		{"sha384", tpm2.TPMAlgSHA384, crypto.SHA384, 48},
+		{"sha512", tpm2.TPMAlgSHA512, crypto.SHA512, 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tpmutil.MustGenerateRnd(tt.keySize)
+			password := []byte("hmac-password")
+
+			keyHandle, err := Import(thetpm, ImportConfig{
+				ParentHandle: srkHandle,
+				HashAlg:      tt.hashAlg,
+				Key:          key,
+				UserAuth:     password,
+			})
+			if err != nil {
+				t.Fatalf("Import failed: %v", err)
+			}
+			defer keyHandle.Close()
+
+			data := []byte("hello world")
+			got, err := tpmutil.Hmac(thetpm, tpmutil.HmacConfig{
+				KeyHandle: keyHandle,
+				Auth:      tpm2.PasswordAuth(password),
+				Data:      data,
+			})
+			if err != nil {
+				t.Fatalf("HMAC failed: %v", err)
+			}
+
+			mac := stdhmac.New(tt.hash.New, key)
+			mac.Write(data)
+			if want := mac.Sum(nil); !bytes.Equal(got, want) {
+				t.Errorf("TPM HMAC = %x, crypto/hmac = %x", got, want)
+			}
+		})
+	}
+
+	t.Run("key over block size", func(t *testing.T) {
+		_, err := Import(thetpm, ImportConfig{
+			ParentHandle: srkHandle,
+			HashAlg:      tpm2.TPMAlgSHA256,
+			Key:          make([]byte, 65),
+		})
+		if !errors.Is(err, ErrKeySize) {
+			t.Fatalf("expected ErrKeySize when importing a 65-byte SHA-256 key, got %v", err)
+		}
+	})
+
+	t.Run("key too large", func(t *testing.T) {
+		if _, err := Import(thetpm, ImportConfig{
+			ParentHandle: srkHandle,
+			Key:          make([]byte, MaxKeySize+1),
+		}); err == nil {
+			t.Fatalf("expected error when importing a key larger than %d bytes", MaxKeySize)
+		}
+	})
+}
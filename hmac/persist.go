@@ -0,0 +1,132 @@
+package hmac
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/persist"
+)
+
+var (
+	// ErrNotHMACKey is returned when persisting an object which isn't an HMAC key.
+	ErrNotHMACKey = errors.New("not an HMAC key")
+	// ErrKeyNotFound is returned by [Find] when no persistent object has the
+	// searched name.
+	ErrKeyNotFound = errors.New("HMAC key not found")
+)
+
+// PersistConfig holds configuration for [Persist].
+type PersistConfig struct {
+	// Handle is the persistent handle of the key.
+	//
+	// Default: the lowest free handle of [persist.OwnerRange].
+	Handle tpm2.TPMHandle
+	// OwnerAuth is the authorization session for the owner hierarchy.
+	//
+	// Default: [tpmutil.NoAuth].
+	OwnerAuth tpm2.Session
+}
+
+// CheckAndSetDefault validates and sets default values for PersistConfig.
+func (c *PersistConfig) CheckAndSetDefault() error {
+	if c.OwnerAuth == nil {
+		c.OwnerAuth = tpmutil.NoAuth
+	}
+	return nil
+}
+
+// Persist makes a loaded HMAC key persistent, so that it survives reboots
+// without keeping its private blob: the key is found again from its name
+// with [Find]. The transient key stays loaded and must still be flushed by
+// the caller.
+//
+// Example:
+//
+//	keyHandle, err := hmac.Import(tpm, hmac.ImportConfig{ParentHandle: srkHandle, Key: secret})
+//	if err != nil {
+//	    return err
+//	}
+//	defer keyHandle.Close()
+//
+//	persistent, err := hmac.Persist(tpm, keyHandle)
+//	if err != nil {
+//	    return err
+//	}
+//	name := persistent.Name() // to store in the configuration
+func Persist(tpm transport.TPM, key tpmutil.Handle, optionalCfg ...PersistConfig) (tpmutil.Handle, error) {
+	var cfg PersistConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+
+	rsp, err := tpm2.ReadPublic{ObjectHandle: key.Handle()}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key public area: %w", err)
+	}
+	pub, err := rsp.OutPublic.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key public area: %w", err)
+	}
+	if !isHMACKey(pub) {
+		return nil, fmt.Errorf("%w: 0x%x", ErrNotHMACKey, key.Handle())
+	}
+
+	if cfg.Handle == 0 {
+		if cfg.Handle, err = persist.Allocate(tpm, persist.OwnerRange); err != nil {
+			return nil, err
+		}
+	}
+	return persist.Persist(tpm, key, cfg.Handle, cfg.OwnerAuth)
+}
+
+// Find returns the persistent HMAC key whose name is name, scanning every
+// persistent handle.
+//
+// Example:
+//
+//	keyHandle, err := hmac.Find(tpm, name)
+//	if err != nil {
+//	    return err
+//	}
+//	mac, err := tpmutil.Hmac(tpm, tpmutil.HmacConfig{KeyHandle: keyHandle, Data: data})
+func Find(tpm transport.TPM, name tpm2.TPM2BName) (tpmutil.Handle, error) {
+	handles, err := persist.ListPersistent(tpm)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range handles {
+		key, err := tpmutil.ToHandle(tpm, h)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(key.Name().Buffer, name.Buffer) {
+			if !isHMACKey(key.Public()) {
+				return nil, fmt.Errorf("%w: 0x%x", ErrNotHMACKey, h)
+			}
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: name %x", ErrKeyNotFound, name.Buffer)
+}
+
+// isHMACKey reports whether pub is a keyedHash signing key using HMAC.
+func isHMACKey(pub *tpm2.TPMTPublic) bool {
+	if pub.Type != tpm2.TPMAlgKeyedHash || !pub.ObjectAttributes.SignEncrypt {
+		return false
+	}
+	params, err := pub.Parameters.KeyedHashDetail()
+	if err != nil {
+		return false
+	}
+	return params.Scheme.Scheme == tpm2.TPMAlgHMAC
+}
@@ -0,0 +1,72 @@
+package hmac
+
+import (
+	"bytes"
+	"crypto"
+	stdhmac "crypto/hmac"
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/persist"
+)
+
+func TestPersistFind(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	srk := testutil.NewFixtures(t, thetpm).SRK(t)
+
+	key := tpmutil.MustGenerateRnd(32)
+	keyHandle, err := Import(thetpm, ImportConfig{ParentHandle: srk, Key: key})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	persistent, err := Persist(thetpm, keyHandle)
+	if err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	defer persist.Evict(thetpm, persistent.Handle())
+	if !persist.OwnerRange.Contains(persistent.Handle()) {
+		t.Errorf("Persist handle = 0x%x, want a handle of the owner range", persistent.Handle())
+	}
+	// Only the name is kept: the transient key and its blobs are gone.
+	name := keyHandle.Name()
+	keyHandle.Close()
+
+	found, err := Find(thetpm, name)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if found.Handle() != persistent.Handle() {
+		t.Errorf("Find handle = 0x%x, want 0x%x", found.Handle(), persistent.Handle())
+	}
+
+	data := []byte("hello world")
+	got, err := tpmutil.Hmac(thetpm, tpmutil.HmacConfig{KeyHandle: found, Data: data})
+	if err != nil {
+		t.Fatalf("HMAC failed: %v", err)
+	}
+	mac := stdhmac.New(crypto.SHA256.New, key)
+	mac.Write(data)
+	if want := mac.Sum(nil); !bytes.Equal(got, want) {
+		t.Errorf("TPM HMAC = %x, crypto/hmac = %x", got, want)
+	}
+
+	t.Run("unknown name", func(t *testing.T) {
+		other := append([]byte(nil), name.Buffer...)
+		other[len(other)-1] ^= 1
+		if _, err := Find(thetpm, tpm2.TPM2BName{Buffer: other}); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Find error = %v, want %v", err, ErrKeyNotFound)
+		}
+	})
+
+	t.Run("not an HMAC key", func(t *testing.T) {
+		if _, err := Persist(thetpm, srk); !errors.Is(err, ErrNotHMACKey) {
+			t.Errorf("Persist error = %v, want %v", err, ErrNotHMACKey)
+		}
+		if _, err := Find(thetpm, srk.Name()); !errors.Is(err, ErrNotHMACKey) {
+			t.Errorf("Find error = %v, want %v", err, ErrNotHMACKey)
+		}
+	})
+}
@@ -0,0 +1,243 @@
+// Package cbor encodes and decodes the subset of CBOR (RFC 8949) used by
+// WebAuthn attestation objects: integers, byte and text strings, arrays and
+// maps with text keys.
+//
+// Maps are encoded with the core deterministic encoding: keys sorted by their
+// encoding, shortest lengths first.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Major types.
+const (
+	majorUint  = 0
+	majorNeg   = 1
+	majorBytes = 2
+	majorText  = 3
+	majorArray = 4
+	majorMap   = 5
+)
+
+// maxDepth bounds the nesting of decoded arrays and maps.
+const maxDepth = 16
+
+// ErrUnsupported is returned for values outside of the supported subset.
+var ErrUnsupported = errors.New("unsupported CBOR value")
+
+// Marshal encodes v, made of int, int64, uint64, []byte, string, []any,
+// [][]byte and map[string]any values.
+func Marshal(v any) ([]byte, error) {
+	return appendValue(nil, v)
+}
+
+func appendValue(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case int:
+		return appendInt(b, int64(v)), nil
+	case int64:
+		return appendInt(b, v), nil
+	case uint64:
+		return appendHead(b, majorUint, v), nil
+	case []byte:
+		return append(appendHead(b, majorBytes, uint64(len(v))), v...), nil
+	case string:
+		return append(appendHead(b, majorText, uint64(len(v))), v...), nil
+	case [][]byte:
+		b = appendHead(b, majorArray, uint64(len(v)))
+		for _, e := range v {
+			b = append(appendHead(b, majorBytes, uint64(len(e))), e...)
+		}
+		return b, nil
+	case []any:
+		b = appendHead(b, majorArray, uint64(len(v)))
+		for _, e := range v {
+			var err error
+			if b, err = appendValue(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]any:
+		type entry struct{ key, value []byte }
+		entries := make([]entry, 0, len(v))
+		for k, e := range v {
+			value, err := appendValue(nil, e)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry{append(appendHead(nil, majorText, uint64(len(k))), k...), value})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+		b = appendHead(b, majorMap, uint64(len(v)))
+		for _, e := range entries {
+			b = append(append(b, e.key...), e.value...)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupported, v)
+}
+
+func appendInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return appendHead(b, majorNeg, uint64(-(v + 1)))
+	}
+	return appendHead(b, majorUint, uint64(v))
+}
+
+// appendHead appends the initial byte of major type major with argument n,
+// in its shortest form.
+func appendHead(b []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(b, m|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, m|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, m|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, m|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, m|27), n)
+	}
+}
+
+// Unmarshal decodes data into int64, []byte, string, []any and
+// map[string]any values. Trailing bytes are an error.
+func Unmarshal(data []byte) (any, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, errors.New("trailing bytes after CBOR value")
+	}
+	return v, nil
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+var errTruncated = errors.New("truncated CBOR value")
+
+func (d *decoder) head() (byte, uint64, error) {
+	if d.off >= len(d.data) {
+		return 0, 0, errTruncated
+	}
+	major, info := d.data[d.off]>>5, d.data[d.off]&0x1f
+	d.off++
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, fmt.Errorf("%w: additional information %d", ErrUnsupported, info)
+	}
+	if len(d.data)-d.off < size {
+		return 0, 0, errTruncated
+	}
+	var n uint64
+	for _, c := range d.data[d.off : d.off+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.off += size
+	return major, n, nil
+}
+
+func (d *decoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.off) {
+		return nil, errTruncated
+	}
+	b := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, errors.New("CBOR value nested too deeply")
+	}
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint, majorNeg:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", ErrUnsupported)
+		}
+		if major == majorNeg {
+			return -int64(n) - 1, nil
+		}
+		return int64(n), nil
+	case majorBytes:
+		b, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.Clone(b), nil
+	case majorText:
+		b, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case majorArray:
+		// Each element takes at least one byte.
+		if n > uint64(len(d.data)-d.off) {
+			return nil, errTruncated
+		}
+		a := make([]any, 0, n)
+		for range n {
+			e, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, e)
+		}
+		return a, nil
+	case majorMap:
+		if n > uint64(len(d.data)-d.off)/2 {
+			return nil, errTruncated
+		}
+		m := make(map[string]any, n)
+		for range n {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: map key %T", ErrUnsupported, k)
+			}
+			if _, ok := m[key]; ok {
+				return nil, fmt.Errorf("duplicate map key %q", key)
+			}
+			if m[key], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("%w: major type %d", ErrUnsupported, major)
+}
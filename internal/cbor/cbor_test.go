@@ -0,0 +1,85 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Examples from RFC 8949, Appendix A.
+func TestMarshal(t *testing.T) {
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{int64(1000000), "1a000f4240"},
+		{uint64(1000000000000), "1b000000e8d4a51000"},
+		{-1, "20"},
+		{-257, "390100"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{"IETF", "6449455446"},
+		{[]any{1, []any{2, 3}, []any{4, 5}}, "8301820203820405"},
+		{[][]byte{{1}, {}}, "82410140"},
+		// Keys are sorted by their encoding: shortest first.
+		{map[string]any{"bb": 2, "a": 1, "c": []byte{}}, "a3616101616340626262" + "02"},
+	} {
+		got, err := Marshal(tc.v)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %v", tc.v, err)
+		}
+		if hex.EncodeToString(got) != tc.want {
+			t.Fatalf("Marshal(%v) = %x, expected %s", tc.v, got, tc.want)
+		}
+	}
+	if _, err := Marshal(1.5); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported for a float, got %v", err)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	v := map[string]any{
+		"fmt": "tpm",
+		"attStmt": map[string]any{
+			"alg": int64(-257),
+			"x5c": []any{[]byte("leaf"), []byte("intermediate")},
+			"sig": bytes.Repeat([]byte{0xaa}, 300),
+		},
+	}
+	data, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("could not encode: %v", err)
+	}
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("could not decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Fatalf("decoded %v, expected %v", got, v)
+	}
+
+	for _, tc := range []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"truncated string", "6449"},
+		{"truncated head", "19"},
+		{"huge array", "9bffffffffffffffff"},
+		{"trailing bytes", "0000"},
+		{"integer key", "a10102"},
+		{"duplicate key", "a2616101616102"},
+		{"float", "f93c00"},
+		{"indefinite length", "5f"},
+	} {
+		data, _ := hex.DecodeString(tc.data)
+		if _, err := Unmarshal(data); err == nil {
+			t.Fatalf("%s: expected error", tc.name)
+		}
+	}
+}
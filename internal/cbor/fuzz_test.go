@@ -0,0 +1,42 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// FuzzUnmarshal checks that decoding untrusted attestation objects neither
+// panics nor allocates after attacker-controlled lengths, and that decoded
+// values encode back to the same values.
+func FuzzUnmarshal(f *testing.F) {
+	for _, seed := range []string{
+		"8301820203820405",
+		"a3616101616340626262" + "02",
+		"a263666d746374706d67617474537461746da163616c67390100",
+		"9bffffffffffffffff",
+		"bbffffffffffffffff",
+		"5bffffffffffffffff",
+	} {
+		data, _ := hex.DecodeString(seed)
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, err := Unmarshal(data)
+		if err != nil {
+			return
+		}
+		again, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("could not encode decoded value %v: %v", v, err)
+		}
+		got, err := Unmarshal(again)
+		if err != nil {
+			t.Fatalf("could not decode re-encoded value: %v", err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Fatalf("decoded %v, expected %v", got, v)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+// Package rawcmd sends the TPM commands go-tpm doesn't implement, marshaled
+// by hand.
+//
+// The commands are authorized with a password session only, or sent without
+// any session: no HMAC, policy or parameter encryption session can be
+// attached, so the authorization value travels in clear on the bus. Only
+// commands whose parameters aren't secret belong here.
+package rawcmd
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Execute sends the command cc with handles, the first one authorized by a
+// password session carrying auth, followed by params: the marshaled command
+// parameters.
+//
+// A response code other than TPM_RC_SUCCESS is returned as a [tpm2.TPMRC].
+func Execute(tpm transport.TPM, cc tpm2.TPMCC, handles []tpm2.TPMHandle, auth []byte, params []byte) error {
+	// TPMS_AUTH_COMMAND of a password session.
+	var authArea []byte
+	authArea = binary.BigEndian.AppendUint32(authArea, uint32(tpm2.TPMRSPW))
+	authArea = binary.BigEndian.AppendUint16(authArea, 0) // nonceCaller
+	authArea = append(authArea, 0)                        // sessionAttributes
+	authArea = binary.BigEndian.AppendUint16(authArea, uint16(len(auth)))
+	authArea = append(authArea, auth...)
+
+	var body []byte
+	for _, h := range handles {
+		body = binary.BigEndian.AppendUint32(body, uint32(h))
+	}
+	body = binary.BigEndian.AppendUint32(body, uint32(len(authArea)))
+	body = append(body, authArea...)
+	body = append(body, params...)
+	return send(tpm, tpm2.TPMSTSessions, cc, body)
+}
+
+// ExecuteNoSessions sends the command cc with handles, none of them
+// authorized, followed by params, e.g. the policy assertions operating on a
+// policy session handle.
+//
+// A response code other than TPM_RC_SUCCESS is returned as a [tpm2.TPMRC].
+func ExecuteNoSessions(tpm transport.TPM, cc tpm2.TPMCC, handles []tpm2.TPMHandle, params []byte) error {
+	var body []byte
+	for _, h := range handles {
+		body = binary.BigEndian.AppendUint32(body, uint32(h))
+	}
+	body = append(body, params...)
+	return send(tpm, tpm2.TPMSTNoSessions, cc, body)
+}
+
+// send sends the command cc of tag with body: its handles, authorization area
+// and parameters.
+func send(tpm transport.TPM, tag tpm2.TPMST, cc tpm2.TPMCC, body []byte) error {
+	var cmd []byte
+	cmd = binary.BigEndian.AppendUint16(cmd, uint16(tag))
+	cmd = binary.BigEndian.AppendUint32(cmd, uint32(10+len(body)))
+	cmd = binary.BigEndian.AppendUint32(cmd, uint32(cc))
+	cmd = append(cmd, body...)
+
+	rsp, err := tpm.Send(cmd)
+	if err != nil {
+		return err
+	}
+	if len(rsp) < 10 {
+		return fmt.Errorf("short response (%d bytes)", len(rsp))
+	}
+	if rc := tpm2.TPMRC(binary.BigEndian.Uint32(rsp[6:10])); rc != tpm2.TPMRCSuccess {
+		return rc
+	}
+	return nil
+}
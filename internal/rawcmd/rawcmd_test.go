@@ -0,0 +1,28 @@
+package rawcmd_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/rawcmd"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+)
+
+func TestExecute(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	// TPM2_HierarchyControl(TPM_RH_PLATFORM, enable = TPM_RH_OWNER,
+	// state = YES) is a no-op on an enabled owner hierarchy.
+	params := binary.BigEndian.AppendUint32(nil, uint32(tpm2.TPMRHOwner))
+	params = append(params, 1)
+	if err := rawcmd.Execute(thetpm, tpm2.TPMCCHierarchyControl, []tpm2.TPMHandle{tpm2.TPMRHPlatform}, nil, params); err != nil {
+		t.Fatalf("could not execute command: %v", err)
+	}
+
+	err := rawcmd.Execute(thetpm, tpm2.TPMCCHierarchyControl, []tpm2.TPMHandle{tpm2.TPMRHPlatform}, []byte("wrong password"), params)
+	if !errors.Is(err, tpm2.TPMRCBadAuth) {
+		t.Fatalf("expected TPM_RC_BAD_AUTH with a wrong password, got %v", err)
+	}
+}
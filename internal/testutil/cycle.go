@@ -0,0 +1,102 @@
+package testutil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Cycle is a shutdown and startup sequence of the TPM (TPM 2.0 Part 1,
+// 12.2.3).
+type Cycle int
+
+const (
+	// CycleResume shuts the TPM down and starts it up with TPM_SU_STATE, as
+	// a resume from hibernation does: PCRs and saved contexts survive, and
+	// restartCount is incremented.
+	CycleResume Cycle = iota
+	// CycleRestart shuts the TPM down with TPM_SU_STATE and starts it up
+	// with TPM_SU_CLEAR: PCRs are reset, saved contexts survive, except
+	// those of stClear objects, and restartCount is incremented.
+	CycleRestart
+	// CycleReset shuts the TPM down and starts it up with TPM_SU_CLEAR, as a
+	// reboot does: PCRs are reset, saved contexts are invalidated,
+	// resetCount is incremented and restartCount cleared.
+	CycleReset
+	// CycleUnorderly powers the TPM off without shutdown, as a crash or a
+	// power loss does, then starts it up with TPM_SU_CLEAR: it is a TPM
+	// Reset which also clears the Safe flag of the clock.
+	CycleUnorderly
+)
+
+// String returns the name of c, e.g. "resume".
+func (c Cycle) String() string {
+	switch c {
+	case CycleResume:
+		return "resume"
+	case CycleRestart:
+		return "restart"
+	case CycleReset:
+		return "reset"
+	case CycleUnorderly:
+		return "unorderly reset"
+	default:
+		return fmt.Sprintf("cycle(%d)", int(c))
+	}
+}
+
+// powerCycler is a TPM which can be powered off and on without being started
+// up: the swtpm of [StartSwtpm] and mssim.TPM.
+type powerCycler interface {
+	PowerCycle() error
+}
+
+// PowerCycle shuts tpm down, powers it off and on, and starts it up as c
+// defines, so that tests can check what survives each kind of restart. tpm
+// is the in-process simulator of [OpenSimulator], a swtpm of [StartSwtpm] or
+// an mssim.TPM.
+//
+// Example, to check that a saved session survives hibernation:
+//
+//	saved, err := tpm2.ContextSave{SaveHandle: sess.Handle()}.Execute(thetpm)
+//	require.NoError(t, err)
+//	testutil.PowerCycle(t, thetpm, testutil.CycleResume)
+//	_, err = tpm2.ContextLoad{Context: saved.Context}.Execute(thetpm)
+//	require.NoError(t, err)
+func PowerCycle(t *testing.T, tpm transport.TPM, c Cycle) {
+	t.Helper()
+	shutdown, startup := tpm2.TPMSUClear, tpm2.TPMSUClear
+	switch c {
+	case CycleResume:
+		shutdown, startup = tpm2.TPMSUState, tpm2.TPMSUState
+	case CycleRestart:
+		shutdown = tpm2.TPMSUState
+	case CycleReset, CycleUnorderly:
+	default:
+		t.Fatalf("invalid power cycle %v", c)
+	}
+
+	powerCycle := func() error {
+		simInit()
+		return nil
+	}
+	if pc, ok := tpm.(powerCycler); ok {
+		powerCycle = pc.PowerCycle
+	} else if !simLinked() {
+		t.Fatal("power cycling the TPM simulator requires the in-process simulator (cgo)")
+	}
+
+	if c != CycleUnorderly {
+		if _, err := (tpm2.Shutdown{ShutdownType: shutdown}).Execute(tpm); err != nil {
+			t.Fatalf("could not shut the TPM down: %v", err)
+		}
+	}
+	if err := powerCycle(); err != nil {
+		t.Fatalf("could not power cycle the TPM: %v", err)
+	}
+	if _, err := (tpm2.Startup{StartupType: startup}).Execute(tpm); err != nil {
+		t.Fatalf("could not start the TPM up after %v: %v", c, err)
+	}
+}
@@ -0,0 +1,107 @@
+package testutil_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// debugPCR is resettable from the locality of the tests.
+const debugPCR = 16
+
+func TestPowerCycle(t *testing.T) {
+	for _, tpm := range []struct {
+		name string
+		open func(t *testing.T) transport.TPM
+	}{
+		{"simulator", func(t *testing.T) transport.TPM { return testutil.OpenSimulator(t) }},
+		{"swtpm", func(t *testing.T) transport.TPM { return testutil.StartSwtpm(t) }},
+	} {
+		for _, tt := range []struct {
+			cycle testutil.Cycle
+			// reset reports that resetCount is incremented and restartCount
+			// cleared, rather than restartCount incremented.
+			reset bool
+			// pcrKept and contextKept report that the debug PCR and a saved
+			// session context survive the cycle.
+			pcrKept     bool
+			contextKept bool
+			safe        bool
+		}{
+			{cycle: testutil.CycleResume, pcrKept: true, contextKept: true, safe: true},
+			{cycle: testutil.CycleRestart, contextKept: true, safe: true},
+			{cycle: testutil.CycleReset, reset: true, safe: true},
+			{cycle: testutil.CycleUnorderly, reset: true},
+		} {
+			t.Run(tpm.name+"/"+tt.cycle.String(), func(t *testing.T) {
+				thetpm := tpm.open(t)
+
+				extendDebugPCR(t, thetpm)
+				extended := readDebugPCR(t, thetpm)
+				sess, err := tpm2.StartAuthSession{
+					TPMKey:      tpm2.TPMRHNull,
+					Bind:        tpm2.TPMRHNull,
+					NonceCaller: tpm2.TPM2BNonce{Buffer: make([]byte, 16)},
+					SessionType: tpm2.TPMSEHMAC,
+					Symmetric:   tpm2.TPMTSymDef{Algorithm: tpm2.TPMAlgNull},
+					AuthHash:    tpm2.TPMAlgSHA256,
+				}.Execute(thetpm)
+				require.NoError(t, err)
+				saved, err := tpm2.ContextSave{SaveHandle: sess.SessionHandle}.Execute(thetpm)
+				require.NoError(t, err)
+				before, err := tpm2.ReadClock{}.Execute(thetpm)
+				require.NoError(t, err)
+
+				testutil.PowerCycle(t, thetpm, tt.cycle)
+
+				after, err := tpm2.ReadClock{}.Execute(thetpm)
+				require.NoError(t, err)
+				got, want := after.CurrentTime.ClockInfo, before.CurrentTime.ClockInfo
+				if tt.reset {
+					require.Equal(t, want.ResetCount+1, got.ResetCount)
+					require.Zero(t, got.RestartCount)
+				} else {
+					require.Equal(t, want.ResetCount, got.ResetCount)
+					require.Equal(t, want.RestartCount+1, got.RestartCount)
+				}
+				require.Equal(t, tt.safe, got.Safe)
+
+				require.Equal(t, tt.pcrKept, bytes.Equal(extended, readDebugPCR(t, thetpm)))
+				loaded, err := tpm2.ContextLoad{Context: saved.Context}.Execute(thetpm)
+				if !tt.contextKept {
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+				_, err = tpm2.FlushContext{FlushHandle: loaded.LoadedHandle}.Execute(thetpm)
+				require.NoError(t, err)
+			})
+		}
+	}
+}
+
+func extendDebugPCR(t *testing.T, thetpm transport.TPM) {
+	_, err := tpm2.PCRExtend{
+		PCRHandle: tpm2.AuthHandle{Handle: tpm2.TPMHandle(debugPCR), Auth: tpm2.PasswordAuth(nil)},
+		Digests: tpm2.TPMLDigestValues{Digests: []tpm2.TPMTHA{{
+			HashAlg: tpm2.TPMAlgSHA256,
+			Digest:  make([]byte, 32),
+		}}},
+	}.Execute(thetpm)
+	require.NoError(t, err)
+}
+
+func readDebugPCR(t *testing.T, thetpm transport.TPM) []byte {
+	rsp, err := tpm2.PCRRead{PCRSelectionIn: tpm2.TPMLPCRSelection{
+		PCRSelections: []tpm2.TPMSPCRSelection{{
+			Hash:      tpm2.TPMAlgSHA256,
+			PCRSelect: tpm2.PCClientCompatible.PCRs(debugPCR),
+		}},
+	}}.Execute(thetpm)
+	require.NoError(t, err)
+	return rsp.PCRValues.Digests[0].Buffer
+}
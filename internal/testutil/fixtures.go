@@ -0,0 +1,124 @@
+package testutil
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
+)
+
+// AKTemplate is the template of the fixture Attestation Key: a restricted
+// RSA-2048 signing key using RSASSA with SHA-256.
+var AKTemplate = templates.AK()
+
+// fixture is a primary key shared by the tests through [Fixtures].
+type fixture struct {
+	hierarchy tpm2.TPMHandle
+	template  tpm2.TPMTPublic
+	// persistent is the handle the key is persisted at, outside of the
+	// ranges of the TCG provisioning guidance used by the tested packages.
+	persistent tpm2.TPMHandle
+}
+
+var (
+	rsaEK  = fixture{tpm2.TPMRHEndorsement, tpm2.RSAEKTemplate, 0x817F0001}
+	eccEK  = fixture{tpm2.TPMRHEndorsement, tpm2.ECCEKTemplate, 0x817F0002}
+	rsaSRK = fixture{tpm2.TPMRHOwner, tpm2.RSASRKTemplate, 0x817F0003}
+	eccSRK = fixture{tpm2.TPMRHOwner, tpm2.ECCSRKTemplate, 0x817F0004}
+	ak     = fixture{tpm2.TPMRHOwner, AKTemplate, 0x817F0005}
+)
+
+// Fixtures creates the primary keys commonly used by the tests once per
+// simulator instance. Keys are created on first use and persisted, so that
+// they don't take any transient object slot, then evicted when the test
+// which called [NewFixtures] ends.
+//
+// Handles must not be flushed by the caller. Hierarchies authorizations must
+// be empty when a key is first used.
+type Fixtures struct {
+	tpm transport.TPM
+
+	mu   sync.Mutex
+	keys map[tpm2.TPMHandle]tpmutil.Handle
+}
+
+// NewFixtures returns the fixtures of the simulator tpm.
+//
+// Example:
+//
+//	thetpm := testutil.OpenSimulator(t)
+//	fixtures := testutil.NewFixtures(t, thetpm)
+//	for _, tt := range tests {
+//	    t.Run(tt.name, func(t *testing.T) {
+//	        ek := fixtures.EK(t) // created by the first subtest only
+//	    })
+//	}
+func NewFixtures(t testing.TB, tpm transport.TPM) *Fixtures {
+	f := &Fixtures{tpm: tpm, keys: make(map[tpm2.TPMHandle]tpmutil.Handle)}
+	t.Cleanup(func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for handle, key := range f.keys {
+			_, err := tpm2.EvictControl{
+				Auth:             tpm2.TPMRHOwner,
+				ObjectHandle:     tpm2.NamedHandle{Handle: handle, Name: key.Name()},
+				PersistentHandle: handle,
+			}.Execute(tpm)
+			if err != nil {
+				t.Errorf("could not evict fixture 0x%x: %v", handle, err)
+			}
+		}
+	})
+	return f
+}
+
+// EK returns the RSA-2048 Endorsement Key (template L-1).
+func (f *Fixtures) EK(t testing.TB) tpmutil.Handle { return f.get(t, rsaEK) }
+
+// ECCEK returns the ECC P-256 Endorsement Key (template L-2).
+func (f *Fixtures) ECCEK(t testing.TB) tpmutil.Handle { return f.get(t, eccEK) }
+
+// SRK returns the ECC P-256 Storage Root Key.
+func (f *Fixtures) SRK(t testing.TB) tpmutil.Handle { return f.get(t, eccSRK) }
+
+// RSASRK returns the RSA-2048 Storage Root Key.
+func (f *Fixtures) RSASRK(t testing.TB) tpmutil.Handle { return f.get(t, rsaSRK) }
+
+// AK returns the Attestation Key, a primary key created from [AKTemplate] in
+// the owner hierarchy.
+func (f *Fixtures) AK(t testing.TB) tpmutil.Handle { return f.get(t, ak) }
+
+func (f *Fixtures) get(t testing.TB, fx fixture) tpmutil.Handle {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if key, ok := f.keys[fx.persistent]; ok {
+		return key
+	}
+
+	key, err := tpmutil.CreatePrimary(f.tpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: fx.hierarchy,
+		InPublic:      fx.template,
+	})
+	if err != nil {
+		t.Fatalf("could not create fixture: %v", err)
+	}
+	defer key.Close()
+	_, err = tpm2.EvictControl{
+		Auth:             tpm2.TPMRHOwner,
+		ObjectHandle:     tpm2.NamedHandle{Handle: key.Handle(), Name: key.Name()},
+		PersistentHandle: fx.persistent,
+	}.Execute(f.tpm)
+	if err != nil {
+		t.Fatalf("could not persist fixture: %v", err)
+	}
+	persisted, err := tpmutil.ToHandle(f.tpm, fx.persistent)
+	if err != nil {
+		t.Fatalf("could not read fixture: %v", err)
+	}
+	f.keys[fx.persistent] = persisted
+	return persisted
+}
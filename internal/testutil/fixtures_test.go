@@ -0,0 +1,58 @@
+package testutil_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixtures(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	t.Run("cached", func(t *testing.T) {
+		fixtures := testutil.NewFixtures(t, thetpm)
+		for _, tt := range []struct {
+			name     string
+			get      func(testing.TB) tpmutil.Handle
+			template tpm2.TPMTPublic
+		}{
+			{"EK", fixtures.EK, tpm2.RSAEKTemplate},
+			{"ECCEK", fixtures.ECCEK, tpm2.ECCEKTemplate},
+			{"SRK", fixtures.SRK, tpm2.ECCSRKTemplate},
+			{"RSASRK", fixtures.RSASRK, tpm2.RSASRKTemplate},
+			{"AK", fixtures.AK, testutil.AKTemplate},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				key := tt.get(t)
+				require.Same(t, key, tt.get(t))
+				require.Equal(t, tpmutil.PersistentHandle, key.Type())
+				require.Equal(t, tt.template.ObjectAttributes, key.Public().ObjectAttributes)
+			})
+		}
+
+		// Persistent keys leave every transient slot available.
+		rsp, err := tpm2.GetCapability{
+			Capability:    tpm2.TPMCapHandles,
+			Property:      uint32(tpm2.TPMHTTransient) << 24,
+			PropertyCount: 8,
+		}.Execute(thetpm)
+		require.NoError(t, err)
+		handles, err := rsp.CapabilityData.Data.Handles()
+		require.NoError(t, err)
+		require.Empty(t, handles.Handle)
+	})
+
+	// The fixtures are evicted when the test ends.
+	rsp, err := tpm2.GetCapability{
+		Capability:    tpm2.TPMCapHandles,
+		Property:      uint32(tpm2.TPMHTPersistent) << 24,
+		PropertyCount: 8,
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	handles, err := rsp.CapabilityData.Data.Handles()
+	require.NoError(t, err)
+	require.Empty(t, handles.Handle)
+}
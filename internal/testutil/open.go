@@ -3,12 +3,40 @@ package testutil
 import (
 	"testing"
 
+	"github.com/google/go-tpm-tools/simulator"
 	"github.com/google/go-tpm/tpm2/transport"
-	"github.com/google/go-tpm/tpm2/transport/simulator"
+	tpmsimulator "github.com/google/go-tpm/tpm2/transport/simulator"
 )
 
-func OpenSimulator(t *testing.T) transport.TPM {
-	thetpm, err := simulator.OpenSimulator()
+// SimulatorConfig holds configuration for [OpenSimulator].
+type SimulatorConfig struct {
+	// Seed derives the hierarchy seeds of the simulator, instead of random
+	// data: primary keys, hence their Names and the blobs wrapped by them,
+	// are the same on every run, e.g. for golden values. Such a simulator is
+	// insecure by design.
+	//
+	// Default: 0 (random seeds).
+	Seed int64
+}
+
+// OpenSimulator opens the in-process TPM simulator, closed when t ends.
+//
+// Example:
+//
+//	// The SRK has the same Name on every run.
+//	thetpm := testutil.OpenSimulator(t, testutil.SimulatorConfig{Seed: 1})
+func OpenSimulator(t *testing.T, optionalCfg ...SimulatorConfig) transport.TPM {
+	var cfg SimulatorConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	var thetpm transport.TPMCloser
+	var err error
+	if cfg.Seed != 0 {
+		thetpm, err = openSeeded(cfg.Seed)
+	} else {
+		thetpm, err = tpmsimulator.OpenSimulator()
+	}
 	if err != nil {
 		t.Fatalf("could not connect to TPM simulator: %v", err)
 	}
@@ -19,3 +47,12 @@ func OpenSimulator(t *testing.T) transport.TPM {
 	})
 	return thetpm
 }
+
+// openSeeded opens a simulator whose hierarchy seeds derive from seed.
+func openSeeded(seed int64) (transport.TPMCloser, error) {
+	sim, err := simulator.GetWithFixedSeedInsecure(seed)
+	if err != nil {
+		return nil, err
+	}
+	return transport.FromReadWriteCloser(sim), nil
+}
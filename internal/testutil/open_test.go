@@ -0,0 +1,34 @@
+package testutil_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenSimulator_Seed(t *testing.T) {
+	// srkName opens a simulator and returns the Name of its ECC SRK.
+	srkName := func(cfg testutil.SimulatorConfig) []byte {
+		var name []byte
+		t.Run("", func(t *testing.T) {
+			thetpm := testutil.OpenSimulator(t, cfg)
+			rsp, err := tpm2.CreatePrimary{
+				PrimaryHandle: tpm2.TPMRHOwner,
+				InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+			}.Execute(thetpm)
+			require.NoError(t, err)
+			_, err = tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm)
+			require.NoError(t, err)
+			name = rsp.Name.Buffer
+		})
+		return name
+	}
+
+	seeded := srkName(testutil.SimulatorConfig{Seed: 42})
+	require.NotEmpty(t, seeded)
+	require.Equal(t, seeded, srkName(testutil.SimulatorConfig{Seed: 42}))
+	require.NotEqual(t, seeded, srkName(testutil.SimulatorConfig{Seed: 43}))
+	require.NotEqual(t, srkName(testutil.SimulatorConfig{}), srkName(testutil.SimulatorConfig{}))
+}
@@ -0,0 +1,60 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// nvMemorySize is the size of the NV memory of the simulator (NV_MEMORY_SIZE
+// of the reference implementation profile).
+const nvMemorySize = 16384
+
+// Snapshot is a copy of the NV memory of the in-process simulator: hierarchy
+// seeds and authorizations, NV indexes, persistent objects, counters...
+type Snapshot struct {
+	tpm transport.TPM
+	nv  []byte
+}
+
+// TakeSnapshot copies the NV memory of the in-process simulator opened by
+// [OpenSimulator]. It doesn't support [StartSwtpm].
+func TakeSnapshot(t *testing.T, tpm transport.TPM) *Snapshot {
+	t.Helper()
+	if !simLinked() {
+		t.Fatal("TPM simulator snapshots require the in-process simulator (cgo)")
+	}
+	return &Snapshot{tpm: tpm, nv: nvRead()}
+}
+
+// Restore rolls the simulator NV memory back to the snapshot and performs a
+// TPM Reset: transient objects and sessions are flushed and PCRs are reset,
+// while primary keys derived from the restored seeds are the same.
+func (s *Snapshot) Restore(t *testing.T) {
+	t.Helper()
+	// Saves the orderly state, overwritten right after.
+	tpm2.Shutdown{ShutdownType: tpm2.TPMSUClear}.Execute(s.tpm) //nolint:errcheck
+	nvWrite(s.nv)
+	simInit()
+	if _, err := (tpm2.Startup{StartupType: tpm2.TPMSUClear}).Execute(s.tpm); err != nil {
+		t.Fatalf("could not start TPM simulator up after restoring snapshot: %v", err)
+	}
+}
+
+// Isolate takes a snapshot of the simulator and restores it when t ends, so
+// that destructive subtests don't affect each other.
+//
+// Example:
+//
+//	thetpm := testutil.OpenSimulator(t)
+//	// expensive setup shared by the subtests...
+//	t.Run("clear", func(t *testing.T) {
+//	    testutil.Isolate(t, thetpm)
+//	    // TPM2_Clear, TPM2_HierarchyChangeAuth...
+//	})
+func Isolate(t *testing.T, tpm transport.TPM) {
+	t.Helper()
+	s := TakeSnapshot(t, tpm)
+	t.Cleanup(func() { s.Restore(t) })
+}
@@ -0,0 +1,29 @@
+//go:build cgo
+
+package testutil
+
+// // Symbols of the reference simulator linked by go-tpm-tools. They are
+// // declared weak so that this package links without it.
+// #include <stdbool.h>
+// #include <string.h>
+// extern unsigned char s_NV[] __attribute__((weak));
+// extern void _plat__Reset(bool forceManufacture) __attribute__((weak));
+//
+// static int sim_linked() { return s_NV != 0 && _plat__Reset != 0; }
+// static void nv_read(void *dst, size_t n) { memcpy(dst, s_NV, n); }
+// static void nv_write(const void *src, size_t n) { memcpy(s_NV, src, n); }
+// static void sim_init() { _plat__Reset(false); }
+import "C"
+import "unsafe"
+
+func simLinked() bool { return C.sim_linked() != 0 }
+
+func nvRead() []byte {
+	nv := make([]byte, nvMemorySize)
+	C.nv_read(unsafe.Pointer(&nv[0]), nvMemorySize)
+	return nv
+}
+
+func nvWrite(nv []byte) { C.nv_write(unsafe.Pointer(&nv[0]), C.size_t(len(nv))) }
+
+func simInit() { C.sim_init() }
@@ -0,0 +1,11 @@
+//go:build !cgo
+
+package testutil
+
+func simLinked() bool { return false }
+
+func nvRead() []byte { return nil }
+
+func nvWrite([]byte) {}
+
+func simInit() {}
@@ -0,0 +1,90 @@
+package testutil_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	persistentSRK = tpm2.TPMHandle(0x81000100)
+	nvIndex       = tpm2.TPMHandle(0x01500100)
+)
+
+func TestIsolate(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	srk, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	_, err = tpm2.EvictControl{
+		Auth:             tpm2.TPMRHOwner,
+		ObjectHandle:     tpm2.NamedHandle{Handle: srk.ObjectHandle, Name: srk.Name},
+		PersistentHandle: persistentSRK,
+	}.Execute(thetpm)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name    string
+		destroy func(t *testing.T)
+	}{
+		{"HierarchyChangeAuth", func(t *testing.T) {
+			_, err := tpm2.HierarchyChangeAuth{
+				AuthHandle: tpm2.TPMRHOwner,
+				NewAuth:    tpm2.TPM2BAuth{Buffer: []byte("owner")},
+			}.Execute(thetpm)
+			require.NoError(t, err)
+		}},
+		{"Clear", func(t *testing.T) {
+			_, err := tpm2.Clear{
+				AuthHandle: tpm2.AuthHandle{Handle: tpm2.TPMRHPlatform, Auth: tpm2.PasswordAuth(nil)},
+			}.Execute(thetpm)
+			require.NoError(t, err)
+		}},
+		{"NVDefineSpace", func(t *testing.T) {
+			_, err := tpm2.NVDefineSpace{
+				AuthHandle: tpm2.TPMRHOwner,
+				PublicInfo: tpm2.New2B(tpm2.TPMSNVPublic{
+					NVIndex:    nvIndex,
+					NameAlg:    tpm2.TPMAlgSHA256,
+					Attributes: tpm2.TPMANV{OwnerWrite: true, OwnerRead: true, NT: tpm2.TPMNTOrdinary},
+					DataSize:   8,
+				}),
+			}.Execute(thetpm)
+			require.NoError(t, err)
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Isolate(t, thetpm)
+			tt.destroy(t)
+		})
+		// Each subtest starts from the same state.
+		t.Run(tt.name+"/restored", func(t *testing.T) {
+			requireInitialState(t, thetpm, srk.Name)
+		})
+	}
+}
+
+func requireInitialState(t *testing.T, thetpm transport.TPM, srkName tpm2.TPM2BName) {
+	t.Helper()
+	// The owner authorization is empty.
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	defer tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm) //nolint:errcheck
+	// The storage seed and the persistent SRK are unchanged.
+	require.Equal(t, srkName, rsp.Name)
+	pub, err := tpm2.ReadPublic{ObjectHandle: persistentSRK}.Execute(thetpm)
+	require.NoError(t, err)
+	require.Equal(t, srkName, pub.Name)
+	// The NV index isn't defined.
+	_, err = tpm2.NVReadPublic{NVIndex: nvIndex}.Execute(thetpm)
+	require.ErrorIs(t, err, tpm2.TPMRCHandle)
+}
@@ -0,0 +1,73 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/policy"
+)
+
+// SoftwareAK is a software ECDSA P-256 key standing for an Attestation Key
+// in the tests of verifiers, which don't need a TPM: fuzz targets sign their
+// inputs with it to get past the signature checks.
+type SoftwareAK struct {
+	// Public is the public area of the key, with the attributes of a
+	// restricted signing key bound to the TPM.
+	Public tpm2.TPMTPublic
+	key    *ecdsa.PrivateKey
+}
+
+// NewSoftwareAK generates a SoftwareAK.
+func NewSoftwareAK(t testing.TB) *SoftwareAK {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	public, err := policy.ExternalKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("could not build public area: %v", err)
+	}
+	public.ObjectAttributes = tpm2.TPMAObject{
+		FixedTPM:            true,
+		FixedParent:         true,
+		SensitiveDataOrigin: true,
+		UserWithAuth:        true,
+		Restricted:          true,
+		SignEncrypt:         true,
+	}
+	return &SoftwareAK{Public: public, key: key}
+}
+
+// Name returns the Name of the key.
+func (k *SoftwareAK) Name(t testing.TB) []byte {
+	t.Helper()
+	name, err := tpm2.ObjectName(&k.Public)
+	if err != nil {
+		t.Fatalf("could not compute name: %v", err)
+	}
+	return name.Buffer
+}
+
+// Sign returns the marshaled TPMT_SIGNATURE of data, as signed by the TPM
+// with TPM2_Quote or TPM2_Certify.
+func (k *SoftwareAK) Sign(t testing.TB, data []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, digest[:])
+	if err != nil {
+		t.Fatalf("could not sign: %v", err)
+	}
+	return tpm2.Marshal(tpm2.TPMTSignature{
+		SigAlg: tpm2.TPMAlgECDSA,
+		Signature: tpm2.NewTPMUSignature(tpm2.TPMAlgECDSA, &tpm2.TPMSSignatureECC{
+			Hash:       tpm2.TPMAlgSHA256,
+			SignatureR: tpm2.TPM2BECCParameter{Buffer: r.FillBytes(make([]byte, 32))},
+			SignatureS: tpm2.TPM2BECCParameter{Buffer: s.FillBytes(make([]byte, 32))},
+		}),
+	})
+}
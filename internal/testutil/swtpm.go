@@ -0,0 +1,190 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ctrlInit is the CMD_INIT command of the swtpm control channel, which
+// re-initializes the TPM as a power cycle does.
+const ctrlInit uint32 = 0x02
+
+// SwtpmConfig holds configuration for [StartSwtpm].
+type SwtpmConfig struct {
+	// Unix serves the TPM on a Unix socket instead of a TCP port.
+	//
+	// Default: false.
+	Unix bool
+	// Binary is the path of the swtpm executable.
+	//
+	// Default: $SWTPM, else swtpm from $PATH.
+	Binary string
+	// ReadyTimeout is the time swtpm has to accept connections.
+	//
+	// Default: 10s.
+	ReadyTimeout time.Duration
+}
+
+// CheckAndSetDefault validates and sets default values for SwtpmConfig.
+func (c *SwtpmConfig) CheckAndSetDefault() error {
+	if c.Binary == "" {
+		c.Binary = os.Getenv("SWTPM")
+	}
+	if c.Binary == "" {
+		c.Binary = "swtpm"
+	}
+	if c.ReadyTimeout == 0 {
+		c.ReadyTimeout = 10 * time.Second
+	}
+	return nil
+}
+
+// StartSwtpm spawns a swtpm process with a fresh state, started up with
+// TPM_SU_CLEAR, and returns a transport to it. The process is stopped and its
+// state deleted on test cleanup. The test is skipped when swtpm isn't
+// installed.
+//
+// Unlike [OpenSimulator], each call starts an independent TPM: tests using
+// swtpm may run in parallel. The TPM can be power cycled with [PowerCycle].
+func StartSwtpm(t *testing.T, optionalCfg ...SwtpmConfig) transport.TPM {
+	t.Helper()
+	var cfg SwtpmConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		t.Fatalf("invalid swtpm config: %v", err)
+	}
+	bin, err := exec.LookPath(cfg.Binary)
+	if err != nil {
+		t.Skipf("swtpm not available: %v", err)
+	}
+
+	dir := t.TempDir()
+	network, server, ctrl := "tcp", "", ""
+	var serverArg, ctrlArg string
+	if cfg.Unix {
+		network = "unix"
+		server, ctrl = filepath.Join(dir, "swtpm.sock"), filepath.Join(dir, "swtpm.ctrl")
+		serverArg, ctrlArg = "type=unixio,path="+server, "type=unixio,path="+ctrl
+	} else {
+		server, ctrl = freeAddress(t), freeAddress(t)
+		serverArg, ctrlArg = tcpArg(t, server), tcpArg(t, ctrl)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(bin, "socket", "--tpm2",
+		"--tpmstate", "dir="+dir,
+		"--server", serverArg,
+		"--ctrl", ctrlArg,
+		// The TPM is started up below rather than by swtpm, which could
+		// start it up again after a power cycle.
+		"--flags", "not-need-init",
+	)
+	cmd.Stdout, cmd.Stderr = &stderr, &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("could not start swtpm: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait() //nolint:errcheck
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill() //nolint:errcheck
+		<-exited
+	})
+
+	conn, err := waitReady(network, server, cfg.ReadyTimeout, exited)
+	if err != nil {
+		t.Fatalf("swtpm not ready: %v\n%s", err, stderr.String())
+	}
+	thetpm := &swtpm{TPMCloser: transport.FromReadWriteCloser(conn), ctrlNetwork: network, ctrlAddr: ctrl}
+	var once sync.Once
+	t.Cleanup(func() {
+		once.Do(func() { thetpm.Close() })
+	})
+	if _, err := (tpm2.Startup{StartupType: tpm2.TPMSUClear}).Execute(thetpm); err != nil {
+		t.Fatalf("could not start swtpm up: %v", err)
+	}
+	return thetpm
+}
+
+// swtpm is a transport to a swtpm process, along with the address of its
+// control channel.
+type swtpm struct {
+	transport.TPMCloser
+	ctrlNetwork, ctrlAddr string
+}
+
+// PowerCycle re-initializes the TPM through the control channel, without
+// starting it up. Commands and responses of the socket control channel are
+// big-endian: CMD_INIT takes flags, none here, and returns a TPM result.
+func (s *swtpm) PowerCycle() error {
+	conn, err := net.DialTimeout(s.ctrlNetwork, s.ctrlAddr, time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to dial swtpm control channel: %w", err)
+	}
+	defer conn.Close()
+	if err := binary.Write(conn, binary.BigEndian, [2]uint32{ctrlInit, 0}); err != nil {
+		return fmt.Errorf("failed to send CMD_INIT: %w", err)
+	}
+	var result uint32
+	if err := binary.Read(conn, binary.BigEndian, &result); err != nil {
+		return fmt.Errorf("failed to read CMD_INIT result: %w", err)
+	}
+	if result != 0 {
+		return fmt.Errorf("CMD_INIT failed: TPM result 0x%x", result)
+	}
+	return nil
+}
+
+// waitReady dials addr until swtpm accepts the connection, exits or timeout
+// elapses.
+func waitReady(network, addr string, timeout time.Duration, exited <-chan struct{}) (net.Conn, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout(network, addr, time.Second)
+		if err == nil {
+			return conn, nil
+		}
+		select {
+		case <-exited:
+			return nil, fmt.Errorf("swtpm exited")
+		case <-time.After(50 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout after %v: %w", timeout, err)
+		}
+	}
+}
+
+// freeAddress returns a local TCP address free at the time of the call.
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// tcpArg returns the swtpm --server/--ctrl argument listening on addr.
+func tcpArg(t *testing.T, addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("invalid address %q: %v", addr, err)
+	}
+	return "type=tcp,bindaddr=" + host + ",port=" + port
+}
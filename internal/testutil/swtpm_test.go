@@ -0,0 +1,28 @@
+package testutil_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartSwtpm(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  testutil.SwtpmConfig
+	}{
+		{"tcp", testutil.SwtpmConfig{}},
+		{"unix", testutil.SwtpmConfig{Unix: true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			thetpm := testutil.StartSwtpm(t, tt.cfg)
+
+			rsp, err := tpm2.GetRandom{BytesRequested: 16}.Execute(thetpm)
+			require.NoError(t, err)
+			require.Len(t, rsp.RandomBytes.Buffer, 16)
+		})
+	}
+}
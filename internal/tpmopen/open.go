@@ -0,0 +1,65 @@
+package tpmopen
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/linuxtpm"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	"github.com/loicsikidi/tpm-stuff/mssim"
+	"github.com/loicsikidi/tpm-stuff/transportutil"
+)
+
+// Simulator is the path selecting the in-process TPM simulator.
+const Simulator = "simulator"
+
+// MSSimPrefix prefixes the command port address (host:port) of a simulator
+// driven through both its command and platform ports, the latter being the
+// next port. E.g. "mssim:127.0.0.1:2321".
+const MSSimPrefix = "mssim:"
+
+// TPMDevices lists the Linux TPM character devices accepted by [Open].
+var TPMDevices = []string{"/dev/tpm0", "/dev/tpmrm0"}
+
+// Open opens a TPM using the appropriate transport based on the path.
+//
+// Supported paths:
+//   - "/dev/tpm0" or "/dev/tpmrm0": Linux TPM device (linuxtpm), retrying
+//     the commands answered with a transient warning (see
+//     [transportutil.NewRetrying])
+//   - "simulator": In-process TPM simulator (simulator)
+//   - "mssim:host:port" (e.g., "mssim:127.0.0.1:2321"): TPM simulator TCP
+//     protocol on the command and platform ports (see [mssim.Open])
+//   - "host:port" (e.g., "127.0.0.1:2321"): TCP connection to swtpm,
+//     restored if it drops (see [transportutil.NewReconnecting])
+func Open(path string) (transport.TPMCloser, error) {
+	if slices.Contains(TPMDevices, path) {
+		device, err := linuxtpm.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return transportutil.NewRetrying(device)
+	} else if path == Simulator {
+		return simulator.OpenSimulator()
+	} else if addr, ok := strings.CutPrefix(path, MSSimPrefix); ok {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		cmdPort, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid command port %q: %w", port, err)
+		}
+		return mssim.Open(mssim.Config{
+			CommandAddress:  addr,
+			PlatformAddress: net.JoinHostPort(host, strconv.Itoa(cmdPort+1)),
+		})
+	} else {
+		// Connect to swtpm over TCP (command port only)
+		return transportutil.NewReconnecting(path, transportutil.ReconnectConfig{Startup: true})
+	}
+}
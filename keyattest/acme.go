@@ -0,0 +1,140 @@
+package keyattest
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/cbor"
+)
+
+// COSE algorithm identifiers of the AK signature (RFC 9053, RFC 8812).
+var coseAlgs = map[[2]tpm2.TPMAlgID]int64{
+	{tpm2.TPMAlgRSASSA, tpm2.TPMAlgSHA256}: -257, // RS256
+	{tpm2.TPMAlgRSASSA, tpm2.TPMAlgSHA384}: -258, // RS384
+	{tpm2.TPMAlgRSASSA, tpm2.TPMAlgSHA512}: -259, // RS512
+	{tpm2.TPMAlgRSAPSS, tpm2.TPMAlgSHA256}: -37,  // PS256
+	{tpm2.TPMAlgRSAPSS, tpm2.TPMAlgSHA384}: -38,  // PS384
+	{tpm2.TPMAlgRSAPSS, tpm2.TPMAlgSHA512}: -39,  // PS512
+	{tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256}:  -7,   // ES256
+	{tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA384}:  -35,  // ES384
+	{tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA512}:  -36,  // ES512
+}
+
+// ACMENonce returns the qualifying data of an attestation answering an ACME
+// device-attest-01 challenge: the SHA-256 digest of its key authorization
+// (token || '.' || base64url(JWK thumbprint)).
+func ACMENonce(keyAuthorization string) []byte {
+	sum := sha256.Sum256([]byte(keyAuthorization))
+	return sum[:]
+}
+
+// DeviceAttest returns the attestation object answering the ACME
+// device-attest-01 challenge of keyAuthorization (see
+// draft-acme-device-attest) with the key, e.g. the key of the certificate
+// requested by the order.
+//
+// The AK certificate is required in cfg: it is the root of trust of the CA.
+// cfg.Nonce is replaced by [ACMENonce] of keyAuthorization.
+func DeviceAttest(tpm transport.TPM, ak, key tpmutil.Handle, creation *Creation, keyAuthorization string, cfg CertifyConfig) ([]byte, error) {
+	if cfg.AKCertificate == nil {
+		return nil, errors.New("missing AK certificate")
+	}
+	cfg.Nonce = ACMENonce(keyAuthorization)
+	b, err := Certify(tpm, ak, key, creation, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return b.AttestationObject()
+}
+
+// AttestationObject encodes b as a WebAuthn attestation object (CBOR) of
+// format "tpm", as sent in the attObj field of an ACME device-attest-01
+// challenge response:
+//
+//	{
+//	    "fmt": "tpm",
+//	    "attStmt": {
+//	        "ver": "2.0",
+//	        "alg": COSE algorithm of the AK signature,
+//	        "x5c": [AK certificate, intermediates...],
+//	        "sig": signature of certInfo by the AK,
+//	        "certInfo": TPMS_ATTEST of the key creation,
+//	        "pubArea": TPMT_PUBLIC of the key,
+//	    },
+//	}
+//
+// As for WebAuthn, sig is the raw signature checked with the certificate of
+// the AK: the PKCS #1 signature of RSA keys or the ASN.1 signature of ECDSA
+// keys. The authData field isn't used by ACME and is omitted.
+func (b *Bundle) AttestationObject(intermediates ...[]byte) ([]byte, error) {
+	if b.AKCertificate == nil {
+		return nil, errors.New("missing AK certificate")
+	}
+	akPub, err := tpm2.Unmarshal[tpm2.TPMTPublic](b.AKPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AK public area: %w", err)
+	}
+	scheme, hash, err := tpmcrypto.GetSigSchemeAndHashFromPublic(*akPub)
+	if err != nil {
+		return nil, err
+	}
+	alg, ok := coseAlgs[[2]tpm2.TPMAlgID{scheme, hash}]
+	if !ok {
+		return nil, fmt.Errorf("no COSE algorithm for scheme %v and hash %v", scheme, hash)
+	}
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](b.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %w", err)
+	}
+	raw, err := rawSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	return cbor.Marshal(map[string]any{
+		"fmt": "tpm",
+		"attStmt": map[string]any{
+			"ver":      "2.0",
+			"alg":      alg,
+			"x5c":      append([][]byte{b.AKCertificate}, intermediates...),
+			"sig":      raw,
+			"certInfo": b.Attest,
+			"pubArea":  b.KeyPublic,
+		},
+	})
+}
+
+// rawSignature returns sig as checked by crypto/x509.
+func rawSignature(sig *tpm2.TPMTSignature) ([]byte, error) {
+	switch sig.SigAlg {
+	case tpm2.TPMAlgRSASSA, tpm2.TPMAlgRSAPSS:
+		var rsa *tpm2.TPMSSignatureRSA
+		var err error
+		if sig.SigAlg == tpm2.TPMAlgRSASSA {
+			rsa, err = sig.Signature.RSASSA()
+		} else {
+			rsa, err = sig.Signature.RSAPSS()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA signature: %w", err)
+		}
+		return rsa.Sig.Buffer, nil
+	case tpm2.TPMAlgECDSA:
+		ecc, err := sig.Signature.ECDSA()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ECDSA signature: %w", err)
+		}
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			new(big.Int).SetBytes(ecc.SignatureR.Buffer),
+			new(big.Int).SetBytes(ecc.SignatureS.Buffer),
+		})
+	}
+	return nil, fmt.Errorf("unsupported signature algorithm %v", sig.SigAlg)
+}
@@ -0,0 +1,83 @@
+package keyattest_test
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/cbor"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/keyattest"
+	"github.com/loicsikidi/tpm-stuff/names"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceAttest(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	ak := testutil.NewFixtures(t, thetpm).AK(t)
+	_, akDER := issueAKCertificate(t, ak)
+	key, creation := createKey(t, thetpm, templates.ECCSigner())
+	keyAuthorization := "evaGxfADs6pSRb2LAv9IZf17Dt3juxGJ-PCt92wr-oA.nP1qzpXGymHBrUEepNY9HCsQk7K8KhOypzEt62jcerQ"
+
+	attObj, err := keyattest.DeviceAttest(thetpm, ak, key, creation, keyAuthorization, keyattest.CertifyConfig{AKCertificate: akDER})
+	require.NoError(t, err)
+
+	// What an ACME server checks.
+	v, err := cbor.Unmarshal(attObj)
+	require.NoError(t, err)
+	obj, ok := v.(map[string]any)
+	require.True(t, ok)
+	require.Equal(t, "tpm", obj["fmt"])
+	stmt, ok := obj["attStmt"].(map[string]any)
+	require.True(t, ok)
+	require.Equal(t, "2.0", stmt["ver"])
+	require.Equal(t, int64(-257), stmt["alg"], "RS256")
+	x5c, ok := stmt["x5c"].([]any)
+	require.True(t, ok)
+	require.Len(t, x5c, 1)
+	akCert, err := x509.ParseCertificate(x5c[0].([]byte))
+	require.NoError(t, err)
+
+	certInfo := stmt["certInfo"].([]byte)
+	require.NoError(t, akCert.CheckSignature(x509.SHA256WithRSA, certInfo, stmt["sig"].([]byte)))
+	attest, err := tpm2.Unmarshal[tpm2.TPMSAttest](certInfo)
+	require.NoError(t, err)
+	require.Equal(t, keyattest.ACMENonce(keyAuthorization), attest.ExtraData.Buffer)
+	info, err := attest.Attested.Creation()
+	require.NoError(t, err)
+	pubArea, err := tpm2.Unmarshal[tpm2.TPMTPublic](stmt["pubArea"].([]byte))
+	require.NoError(t, err)
+	require.NoError(t, names.Verify(info.ObjectName.Buffer, *pubArea))
+
+	_, err = keyattest.DeviceAttest(thetpm, ak, key, creation, keyAuthorization, keyattest.CertifyConfig{})
+	require.Error(t, err, "the AK certificate is required")
+}
+
+// eccAK returns the template of an ECC P-256 attestation key.
+func eccAK() tpm2.TPMTPublic {
+	t := templates.ECCSigner(templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256))
+	t.ObjectAttributes.Restricted = true
+	return t
+}
+
+func TestAttestationObject_ECDSA(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	ak, _ := createKey(t, thetpm, eccAK())
+	_, akDER := issueAKCertificate(t, ak)
+	key, creation := createKey(t, thetpm, templates.ECCSigner())
+
+	bundle, err := keyattest.Certify(thetpm, ak, key, creation, keyattest.CertifyConfig{AKCertificate: akDER})
+	require.NoError(t, err)
+	attObj, err := bundle.AttestationObject([]byte("intermediate"))
+	require.NoError(t, err)
+
+	v, err := cbor.Unmarshal(attObj)
+	require.NoError(t, err)
+	stmt := v.(map[string]any)["attStmt"].(map[string]any)
+	require.Equal(t, int64(-7), stmt["alg"], "ES256")
+	require.Len(t, stmt["x5c"], 2)
+	akCert, err := x509.ParseCertificate(akDER)
+	require.NoError(t, err)
+	require.NoError(t, akCert.CheckSignature(x509.ECDSAWithSHA256, stmt["certInfo"].([]byte), stmt["sig"].([]byte)))
+}
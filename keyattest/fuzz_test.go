@@ -0,0 +1,81 @@
+package keyattest_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/keyattest"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+)
+
+// seedBundle returns a valid bundle of a software key attested by ak.
+func seedBundle(f *testing.F, ak *testutil.SoftwareAK, nonce []byte) *keyattest.Bundle {
+	key := testutil.NewSoftwareAK(f)
+	creationData := tpm2.Marshal(tpm2.TPMSCreationData{
+		PCRSelect:     pcr.Selection(tpm2.TPMAlgSHA256, 7),
+		PCRDigest:     tpm2.TPM2BDigest{Buffer: make([]byte, sha256.Size)},
+		ParentNameAlg: tpm2.TPMAlgSHA256,
+	})
+	creationHash := sha256.Sum256(creationData)
+	attest := tpm2.Marshal(tpm2.TPMSAttest{
+		Magic:     tpm2.TPMGeneratedValue,
+		Type:      tpm2.TPMSTAttestCreation,
+		ExtraData: tpm2.TPM2BData{Buffer: nonce},
+		Attested: tpm2.NewTPMUAttest(tpm2.TPMSTAttestCreation, &tpm2.TPMSCreationInfo{
+			ObjectName:   tpm2.TPM2BName{Buffer: key.Name(f)},
+			CreationHash: tpm2.TPM2BDigest{Buffer: creationHash[:]},
+		}),
+	})
+	return &keyattest.Bundle{
+		AKPublic:     tpm2.Marshal(ak.Public),
+		KeyPublic:    tpm2.Marshal(key.Public),
+		CreationData: creationData,
+		Attest:       attest,
+		Signature:    ak.Sign(f, attest),
+	}
+}
+
+// FuzzUnmarshal checks that decoding and verifying an untrusted bundle
+// doesn't panic.
+func FuzzUnmarshal(f *testing.F) {
+	ak := testutil.NewSoftwareAK(f)
+	nonce := []byte("fuzzing nonce")
+	data, err := seedBundle(f, ak, nonce).Marshal()
+	if err != nil {
+		f.Fatalf("could not marshal bundle: %v", err)
+	}
+	f.Add(data)
+	f.Add([]byte(`{"ak_public":null,"attest":"AAA="}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		b, err := keyattest.Unmarshal(data)
+		if err != nil {
+			return
+		}
+		keyattest.Verify(b, keyattest.VerifyConfig{Nonce: nonce, AKPublic: &ak.Public}) //nolint:errcheck
+	})
+}
+
+// FuzzVerify checks that verifying an untrusted attestation doesn't panic.
+// The attestation is signed by the AK, so that the target reaches the parsing
+// of the attestation structure, the key and its creation data.
+func FuzzVerify(f *testing.F) {
+	ak := testutil.NewSoftwareAK(f)
+	nonce := []byte("fuzzing nonce")
+	b := seedBundle(f, ak, nonce)
+	f.Add(b.Attest, b.KeyPublic, b.CreationData)
+	f.Add(b.Attest[:len(b.Attest)/2], b.KeyPublic, []byte{})
+
+	f.Fuzz(func(t *testing.T, attest, keyPublic, creationData []byte) {
+		b := &keyattest.Bundle{
+			AKPublic:     tpm2.Marshal(ak.Public),
+			KeyPublic:    keyPublic,
+			CreationData: creationData,
+			Attest:       attest,
+			Signature:    ak.Sign(t, attest),
+		}
+		keyattest.Verify(b, keyattest.VerifyConfig{Nonce: nonce, AKPublic: &ak.Public}) //nolint:errcheck
+	})
+}
@@ -0,0 +1,382 @@
+// Package keyattest proves to a CA that a key, e.g. the key of a TLS or SSH
+// certificate request, was generated by a TPM and never leaves it.
+//
+// The device certifies the creation of the key with its AK
+// (TPM2_CertifyCreation) and sends a [Bundle] along with its request: the
+// public areas of the AK and of the key, the creation data of the key, the
+// signed attestation and the AK and EK certificates. The CA checks the bundle
+// with [Verify] before issuing the certificate.
+//
+// The bundle is only as trusted as its AK: the CA either enrolled the AK
+// beforehand (see the attestation package) and issued the AK certificate, or
+// knows the AK public area.
+package keyattest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+	"github.com/loicsikidi/tpm-stuff/names"
+	"github.com/loicsikidi/tpm-stuff/objects"
+)
+
+// PEMType is the PEM block type of a marshaled [Bundle].
+const PEMType = "TPM KEY ATTESTATION"
+
+var (
+	// ErrUntrustedAK is returned by [Verify] when the AK of the bundle isn't
+	// certified by the AK roots nor the expected AK.
+	ErrUntrustedAK = errors.New("untrusted attestation key")
+	// ErrInvalidAttestation is returned by [Verify] when the attestation
+	// doesn't certify the creation of the key of the bundle by the TPM.
+	ErrInvalidAttestation = errors.New("invalid key attestation")
+)
+
+// Bundle is a portable key attestation: the creation of Key certified by AK.
+//
+// Byte slices are encoded in base64 by encoding/json.
+type Bundle struct {
+	// AKCertificate is the DER certificate of the AK, if any.
+	AKCertificate []byte `json:"ak_certificate,omitempty"`
+	// AKPublic is the marshaled TPMT_PUBLIC of the AK.
+	AKPublic []byte `json:"ak_public"`
+	// EKCertificate is the DER certificate of the EK, if any.
+	EKCertificate []byte `json:"ek_certificate,omitempty"`
+	// KeyPublic is the marshaled TPMT_PUBLIC of the attested key.
+	KeyPublic []byte `json:"key_public"`
+	// CreationData is the marshaled TPMS_CREATION_DATA of the key.
+	CreationData []byte `json:"creation_data"`
+	// Attest is the marshaled TPMS_ATTEST of type TPM_ST_ATTEST_CREATION.
+	Attest []byte `json:"attest"`
+	// Signature is the marshaled TPMT_SIGNATURE over Attest by the AK.
+	Signature []byte `json:"signature"`
+}
+
+// Marshal returns the JSON encoding of b.
+func (b *Bundle) Marshal() ([]byte, error) {
+	return json.Marshal(b)
+}
+
+// PEM returns the JSON encoding of b in a PEM block of type [PEMType].
+func (b *Bundle) PEM() ([]byte, error) {
+	data, err := b.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMType, Bytes: data}), nil
+}
+
+// Unmarshal decodes a bundle encoded by [Bundle.Marshal].
+func Unmarshal(data []byte) (*Bundle, error) {
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to decode key attestation: %w", err)
+	}
+	return &b, nil
+}
+
+// Creation is the creation data of a key, returned by TPM2_Create or
+// TPM2_CreatePrimary along with the key.
+type Creation struct {
+	Data   tpm2.TPMSCreationData
+	Hash   tpm2.TPM2BDigest
+	Ticket tpm2.TPMTTKCreation
+}
+
+// FromCreatePrimary returns the creation data of the primary key of rsp.
+func FromCreatePrimary(rsp *tpm2.CreatePrimaryResponse) (*Creation, error) {
+	data, err := rsp.CreationData.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse creation data: %w", err)
+	}
+	return &Creation{Data: *data, Hash: rsp.CreationHash, Ticket: rsp.CreationTicket}, nil
+}
+
+// FromCreate returns the creation data of the key of rsp.
+func FromCreate(rsp *tpm2.CreateResponse) (*Creation, error) {
+	data, err := rsp.CreationData.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse creation data: %w", err)
+	}
+	return &Creation{Data: *data, Hash: rsp.CreationHash, Ticket: rsp.CreationTicket}, nil
+}
+
+// CertifyConfig holds configuration for [Certify].
+type CertifyConfig struct {
+	// Nonce is the qualifying data of the CA, proving the freshness of the
+	// attestation.
+	//
+	// Default: nil.
+	Nonce []byte
+	// AKAuth authorizes the AK.
+	//
+	// Default: [tpmutil.NoAuth].
+	AKAuth tpm2.Session
+	// AKCertificate is the DER certificate of the AK, attached to the bundle.
+	//
+	// Default: nil.
+	AKCertificate []byte
+	// EKCertificate is the DER certificate of the EK, attached to the bundle,
+	// e.g. as read by ekcert.Read.
+	//
+	// Default: nil.
+	EKCertificate []byte
+}
+
+// CheckAndSetDefault validates and sets default values for CertifyConfig.
+func (c *CertifyConfig) CheckAndSetDefault() error {
+	if c.AKAuth == nil {
+		c.AKAuth = tpmutil.NoAuth
+	}
+	return nil
+}
+
+// Certify returns the bundle attesting that key, whose creation data is
+// creation, was created by the TPM of ak.
+//
+// Example:
+//
+//	rsp, err := tpm2.CreatePrimary{
+//	    PrimaryHandle: tpm2.TPMRHOwner,
+//	    InPublic:      tpm2.New2B(templates.ECCSigner()),
+//	}.Execute(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	creation, err := keyattest.FromCreatePrimary(rsp)
+//	if err != nil {
+//	    return err
+//	}
+//	key := tpmutil.NewHandle(&tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name})
+//	bundle, err := keyattest.Certify(tpm, ak, key, creation, keyattest.CertifyConfig{Nonce: nonce})
+func Certify(tpm transport.TPM, ak, key tpmutil.Handle, creation *Creation, optionalCfg ...CertifyConfig) (*Bundle, error) {
+	var cfg CertifyConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if ak == nil || key == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+	if creation == nil {
+		return nil, errors.New("missing creation data")
+	}
+	akPub, _, err := public(tpm, ak)
+	if err != nil {
+		return nil, err
+	}
+	keyPub, keyName, err := public(tpm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := tpm2.CertifyCreation{
+		SignHandle:     tpmutil.ToAuthHandle(ak, cfg.AKAuth),
+		ObjectHandle:   tpm2.NamedHandle{Handle: key.Handle(), Name: keyName},
+		QualifyingData: tpm2.TPM2BData{Buffer: cfg.Nonce},
+		CreationHash:   creation.Hash,
+		InScheme:       tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		CreationTicket: creation.Ticket,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to certify key creation: %w", tpmerrors.Wrap(err))
+	}
+	attest, err := rsp.CertifyInfo.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attestation: %w", err)
+	}
+	return &Bundle{
+		AKCertificate: cfg.AKCertificate,
+		AKPublic:      tpm2.Marshal(akPub),
+		EKCertificate: cfg.EKCertificate,
+		KeyPublic:     tpm2.Marshal(keyPub),
+		CreationData:  tpm2.Marshal(creation.Data),
+		Attest:        tpm2.Marshal(attest),
+		Signature:     tpm2.Marshal(rsp.Signature),
+	}, nil
+}
+
+// public returns the public area and Name of h, read from the TPM with the
+// Name checked when h doesn't carry them.
+func public(tpm transport.TPM, h tpmutil.Handle) (*tpm2.TPMTPublic, tpm2.TPM2BName, error) {
+	if h.HasPublic() {
+		return h.Public(), h.Name(), nil
+	}
+	pub, err := objects.ReadPublicVerified(tpm, h.Handle())
+	if err != nil {
+		return nil, tpm2.TPM2BName{}, err
+	}
+	return &pub.Public, pub.Name, nil
+}
+
+// VerifyConfig holds configuration for [Verify].
+type VerifyConfig struct {
+	// Nonce is the qualifying data expected in the attestation.
+	//
+	// Default: nil.
+	Nonce []byte
+	// AKRoots are the roots certifying the AK certificate of the bundle.
+	//
+	// Required, unless AKPublic is set.
+	AKRoots *x509.CertPool
+	// AKPublic is the public area of the AK, known to the CA.
+	//
+	// Required, unless AKRoots is set.
+	AKPublic *tpm2.TPMTPublic
+	// EKRoots are the roots of the TPM manufacturers: when set, the EK
+	// certificate of the bundle is required and verified (see
+	// ekcert.VerifyChain). It identifies the TPM model, while the binding
+	// of the AK to the EK is proven when the AK is enrolled.
+	//
+	// Default: nil, the EK certificate isn't verified.
+	EKRoots *x509.CertPool
+}
+
+// CheckAndSetDefault validates and sets default values for VerifyConfig.
+func (c *VerifyConfig) CheckAndSetDefault() error {
+	if c.AKRoots == nil && c.AKPublic == nil {
+		return errors.New("no trust anchor for the AK: AKRoots or AKPublic is required")
+	}
+	return nil
+}
+
+// Result is the outcome of a successful [Verify].
+type Result struct {
+	// Key is the public key of the attested key.
+	Key crypto.PublicKey
+	// KeyPublic is the public area of the attested key.
+	KeyPublic *tpm2.TPMTPublic
+	// CreationData is the creation data of the attested key, e.g. its parent
+	// and the PCRs at creation.
+	CreationData *tpm2.TPMSCreationData
+	// EKCertificate is the verified EK certificate, if EKRoots is set.
+	EKCertificate *x509.Certificate
+}
+
+// Verify checks that b attests a key generated by a TPM, bound to it
+// (fixedTPM, sensitiveDataOrigin), with a trusted AK along with cfg.Nonce.
+func Verify(b *Bundle, cfg VerifyConfig) (*Result, error) {
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if b == nil {
+		return nil, errors.New("missing key attestation")
+	}
+	akPub, err := verifyAK(b, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](b.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %w", err)
+	}
+	if err := tpmcrypto.VerifySignatureFromPublic(*akPub, *sig, b.Attest); err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidAttestation, err)
+	}
+	attest, err := tpm2.Unmarshal[tpm2.TPMSAttest](b.Attest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attestation: %w", err)
+	}
+	if attest.Magic != tpm2.TPMGeneratedValue || attest.Type != tpm2.TPMSTAttestCreation {
+		return nil, fmt.Errorf("%w: not a TPM generated creation attestation", ErrInvalidAttestation)
+	}
+	if subtle.ConstantTimeCompare(attest.ExtraData.Buffer, cfg.Nonce) != 1 {
+		return nil, fmt.Errorf("%w: nonce", ErrInvalidAttestation)
+	}
+	info, err := attest.Attested.Creation()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse creation info: %w", err)
+	}
+
+	keyPub, err := tpm2.Unmarshal[tpm2.TPMTPublic](b.KeyPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key public area: %w", err)
+	}
+	if err := names.Verify(info.ObjectName.Buffer, *keyPub); err != nil {
+		return nil, fmt.Errorf("%w: key: %v", ErrInvalidAttestation, err)
+	}
+	// The creation hash is computed with the name algorithm of the key.
+	h, err := keyPub.NameAlg.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("invalid key name algorithm: %w", err)
+	}
+	digest := h.New()
+	digest.Write(b.CreationData)
+	if !bytes.Equal(digest.Sum(nil), info.CreationHash.Buffer) {
+		return nil, fmt.Errorf("%w: creation data", ErrInvalidAttestation)
+	}
+	creation, err := tpm2.Unmarshal[tpm2.TPMSCreationData](b.CreationData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse creation data: %w", err)
+	}
+	if attrs := keyPub.ObjectAttributes; !attrs.FixedTPM || !attrs.SensitiveDataOrigin {
+		return nil, fmt.Errorf("%w: key isn't generated by and bound to the TPM", ErrInvalidAttestation)
+	}
+	key, err := tpmcrypto.PublicKey(keyPub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+
+	res := &Result{Key: key, KeyPublic: keyPub, CreationData: creation}
+	if cfg.EKRoots != nil {
+		if b.EKCertificate == nil {
+			return nil, errors.New("missing EK certificate")
+		}
+		cert, err := ekcert.Parse(b.EKCertificate)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ekcert.VerifyChain(cert, cfg.EKRoots, nil); err != nil {
+			return nil, err
+		}
+		res.EKCertificate = cert
+	}
+	return res, nil
+}
+
+// verifyAK returns the public area of the AK of b, a restricted signing key
+// trusted by cfg.
+func verifyAK(b *Bundle, cfg VerifyConfig) (*tpm2.TPMTPublic, error) {
+	akPub, err := tpm2.Unmarshal[tpm2.TPMTPublic](b.AKPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AK public area: %w", err)
+	}
+	attrs := akPub.ObjectAttributes
+	if !attrs.Restricted || !attrs.SignEncrypt || attrs.Decrypt || !attrs.FixedTPM || !attrs.SensitiveDataOrigin {
+		return nil, fmt.Errorf("%w: must be a restricted signing key bound to the TPM", ErrUntrustedAK)
+	}
+	if cfg.AKPublic != nil && !bytes.Equal(tpm2.Marshal(cfg.AKPublic), b.AKPublic) {
+		return nil, fmt.Errorf("%w: not the expected AK", ErrUntrustedAK)
+	}
+	if cfg.AKRoots != nil {
+		if b.AKCertificate == nil {
+			return nil, fmt.Errorf("%w: missing AK certificate", ErrUntrustedAK)
+		}
+		cert, err := x509.ParseCertificate(b.AKCertificate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse AK certificate: %w", err)
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{Roots: cfg.AKRoots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUntrustedAK, err)
+		}
+		if err := ekcert.VerifyPublic(cert, *akPub); err != nil {
+			return nil, fmt.Errorf("%w: AK certificate: %v", ErrUntrustedAK, err)
+		}
+	}
+	return akPub, nil
+}
@@ -0,0 +1,228 @@
+package keyattest_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/keyattest"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+// createKey creates a primary signing key from template and returns it along
+// with its creation data.
+func createKey(t *testing.T, tpm transport.TPM, template tpm2.TPMTPublic) (tpmutil.Handle, *keyattest.Creation) {
+	t.Helper()
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(template),
+	}.Execute(tpm)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm)
+	})
+	creation, err := keyattest.FromCreatePrimary(rsp)
+	require.NoError(t, err)
+	return tpmutil.NewHandle(&tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}), creation
+}
+
+// issueAKCertificate returns a CA and the AK certificate it issued for ak.
+func issueAKCertificate(t *testing.T, ak tpmutil.Handle) (*x509.CertPool, []byte) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "AK CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	akKey, err := tpmcrypto.PublicKey(ak.Public())
+	require.NoError(t, err)
+	akDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "device-42 AK"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, ca, akKey, caKey)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	return roots, akDER
+}
+
+func TestCertifyAndVerify(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	ak := testutil.NewFixtures(t, thetpm).AK(t)
+	roots, akCert := issueAKCertificate(t, ak)
+	nonce := []byte("CA challenge")
+
+	for _, tt := range []struct {
+		name     string
+		template tpm2.TPMTPublic
+	}{
+		{"ECC", templates.ECCSigner()},
+		{"RSA", templates.RSASigner()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			key, creation := createKey(t, thetpm, tt.template)
+			bundle, err := keyattest.Certify(thetpm, ak, key, creation, keyattest.CertifyConfig{
+				Nonce:         nonce,
+				AKCertificate: akCert,
+			})
+			require.NoError(t, err)
+
+			// The bundle travels to the CA.
+			pemBundle, err := bundle.PEM()
+			require.NoError(t, err)
+			block, _ := pem.Decode(pemBundle)
+			require.NotNil(t, block)
+			require.Equal(t, keyattest.PEMType, block.Type)
+			received, err := keyattest.Unmarshal(block.Bytes)
+			require.NoError(t, err)
+
+			res, err := keyattest.Verify(received, keyattest.VerifyConfig{Nonce: nonce, AKRoots: roots})
+			require.NoError(t, err)
+			want, err := tpmcrypto.PublicKey(key.Public())
+			require.NoError(t, err)
+			require.Equal(t, want, res.Key)
+			require.Equal(t, tpm2.TPMRHOwner, res.CreationData.ParentName.Buffer, "primary keys have their hierarchy as parent")
+
+			res, err = keyattest.Verify(received, keyattest.VerifyConfig{Nonce: nonce, AKPublic: ak.Public()})
+			require.NoError(t, err)
+			require.Equal(t, want, res.Key)
+		})
+	}
+}
+
+func TestVerify_Errors(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	ak := testutil.NewFixtures(t, thetpm).AK(t)
+	roots, akCert := issueAKCertificate(t, ak)
+	nonce := []byte("CA challenge")
+
+	key, creation := createKey(t, thetpm, templates.ECCSigner())
+	bundle, err := keyattest.Certify(thetpm, ak, key, creation, keyattest.CertifyConfig{Nonce: nonce, AKCertificate: akCert})
+	require.NoError(t, err)
+	cfg := keyattest.VerifyConfig{Nonce: nonce, AKRoots: roots}
+
+	// A key created by the TPM but not attested by the bundle.
+	other, _ := createKey(t, thetpm, templates.ECCSigner(templates.WithCurve(tpm2.TPMECCNistP384)))
+	// A key imported in the TPM: its creation can be certified but it isn't
+	// bound to the TPM.
+	exportable := templates.ECCSigner()
+	exportable.ObjectAttributes.FixedTPM = false
+	exportable.ObjectAttributes.FixedParent = false
+	exportableKey, exportableCreation := createKey(t, thetpm, exportable)
+	exportableBundle, err := keyattest.Certify(thetpm, ak, exportableKey, exportableCreation, keyattest.CertifyConfig{Nonce: nonce, AKCertificate: akCert})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		bundle func() *keyattest.Bundle
+		cfg    keyattest.VerifyConfig
+		want   error
+	}{
+		{
+			name:   "wrong nonce",
+			bundle: func() *keyattest.Bundle { return bundle },
+			cfg:    keyattest.VerifyConfig{Nonce: []byte("replayed"), AKRoots: roots},
+			want:   keyattest.ErrInvalidAttestation,
+		},
+		{
+			name: "substituted key",
+			bundle: func() *keyattest.Bundle {
+				b := *bundle
+				b.KeyPublic = tpm2.Marshal(other.Public())
+				return &b
+			},
+			cfg:  cfg,
+			want: keyattest.ErrInvalidAttestation,
+		},
+		{
+			name: "tampered creation data",
+			bundle: func() *keyattest.Bundle {
+				b := *bundle
+				b.CreationData = append([]byte(nil), b.CreationData...)
+				b.CreationData[len(b.CreationData)-1] ^= 1
+				return &b
+			},
+			cfg:  cfg,
+			want: keyattest.ErrInvalidAttestation,
+		},
+		{
+			name: "tampered attestation",
+			bundle: func() *keyattest.Bundle {
+				b := *bundle
+				b.Attest = append([]byte(nil), b.Attest...)
+				b.Attest[len(b.Attest)-1] ^= 1
+				return &b
+			},
+			cfg:  cfg,
+			want: keyattest.ErrInvalidAttestation,
+		},
+		{
+			name:   "key not bound to the TPM",
+			bundle: func() *keyattest.Bundle { return exportableBundle },
+			cfg:    cfg,
+			want:   keyattest.ErrInvalidAttestation,
+		},
+		{
+			name: "missing AK certificate",
+			bundle: func() *keyattest.Bundle {
+				b := *bundle
+				b.AKCertificate = nil
+				return &b
+			},
+			cfg:  cfg,
+			want: keyattest.ErrUntrustedAK,
+		},
+		{
+			name:   "unknown AK",
+			bundle: func() *keyattest.Bundle { return bundle },
+			cfg:    keyattest.VerifyConfig{Nonce: nonce, AKPublic: other.Public()},
+			want:   keyattest.ErrUntrustedAK,
+		},
+		{
+			name: "AK not restricted",
+			bundle: func() *keyattest.Bundle {
+				b := *bundle
+				b.AKPublic = tpm2.Marshal(key.Public())
+				return &b
+			},
+			cfg:  cfg,
+			want: keyattest.ErrUntrustedAK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := keyattest.Verify(tt.bundle(), tt.cfg)
+			require.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	_, err = keyattest.Verify(bundle, keyattest.VerifyConfig{Nonce: nonce})
+	require.Error(t, err, "a trust anchor for the AK is required")
+}
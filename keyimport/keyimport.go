@@ -0,0 +1,212 @@
+// Package keyimport brings existing software RSA and ECC private keys under
+// the protection of a TPM storage key (TPM2_Import).
+//
+// The wrapping side ([Wrap]) only needs the public area of the parent key, so
+// it can run on a different machine than the TPM: the private key is never
+// sent in the clear to the TPM.
+package keyimport
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/sensitive"
+)
+
+// ErrUnsupportedKey is returned for private keys the TPM can't hold.
+var ErrUnsupportedKey = errors.New("unsupported private key")
+
+// defaultExponent is the RSA public exponent encoded as 0 in a TPM public area.
+const defaultExponent = 65537
+
+// Blob is a private key encrypted for a specific parent key.
+type Blob struct {
+	// Public is the public area of the wrapped key.
+	Public tpm2.TPMTPublic
+	// Duplicate is the private area protected by the outer duplication wrapper.
+	Duplicate []byte
+	// EncryptedSeed is the seed of the duplication wrapper, encrypted to the parent key.
+	EncryptedSeed []byte
+}
+
+// WrapConfig holds optional configuration for [Wrap].
+type WrapConfig struct {
+	// UserAuth is the authorization value of the imported key.
+	//
+	// Default: nil.
+	UserAuth []byte
+}
+
+// Wrap encrypts key so that it can only be imported under the storage key
+// described by parentPub.
+//
+// The imported key is unrestricted and can both sign and decrypt, with any
+// scheme. Since it existed outside of the TPM, it can't be FixedTPM.
+//
+// Example:
+//
+//	blob, err := keyimport.Wrap(srk.Public(), privateKey)
+//	if err != nil {
+//	    return err
+//	}
+//	keyHandle, err := keyimport.Import(tpm, srk, blob)
+func Wrap(parentPub *tpm2.TPMTPublic, key crypto.PrivateKey, optionalCfg ...WrapConfig) (*Blob, error) {
+	if parentPub == nil {
+		return nil, errors.New("parent public area is required")
+	}
+	var cfg WrapConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+
+	public, private, err := keyAreas(key)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(private)
+	private.AuthValue = tpm2.TPM2BAuth{Buffer: cfg.UserAuth}
+
+	name, err := tpm2.ObjectName(public)
+	if err != nil {
+		return nil, err
+	}
+	ek, err := tpm2.ImportEncapsulationKey(parentPub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parent key: %w", err)
+	}
+	encoded := tpm2.Marshal(private)
+	defer sensitive.Wipe(encoded)
+	duplicate, seed, err := tpm2.CreateDuplicate(rand.Reader, ek, name.Buffer, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap key: %w", err)
+	}
+	return &Blob{
+		Public:        *public,
+		Duplicate:     duplicate,
+		EncryptedSeed: seed,
+	}, nil
+}
+
+// wipe zeroizes the copy of the private key held by area. The auth value is
+// left alone: it belongs to the caller.
+func wipe(area *tpm2.TPMTSensitive) {
+	if k, err := area.Sensitive.RSA(); err == nil {
+		sensitive.Wipe(k.Buffer)
+	}
+	if k, err := area.Sensitive.ECC(); err == nil {
+		sensitive.Wipe(k.Buffer)
+	}
+}
+
+// keyAreas builds the public and sensitive areas of key.
+func keyAreas(key crypto.PrivateKey) (*tpm2.TPMTPublic, *tpm2.TPMTSensitive, error) {
+	public := &tpm2.TPMTPublic{
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			SignEncrypt:  true,
+			Decrypt:      true,
+			UserWithAuth: true,
+		},
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, nil, fmt.Errorf("%w: multi-prime RSA", ErrUnsupportedKey)
+		}
+		exponent := uint32(k.E)
+		if k.E == defaultExponent {
+			exponent = 0
+		}
+		public.Type = tpm2.TPMAlgRSA
+		public.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgRSA, &tpm2.TPMSRSAParms{
+			Scheme:   tpm2.TPMTRSAScheme{Scheme: tpm2.TPMAlgNull},
+			KeyBits:  tpm2.TPMKeyBits(k.N.BitLen()),
+			Exponent: exponent,
+		})
+		public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgRSA, &tpm2.TPM2BPublicKeyRSA{Buffer: k.N.Bytes()})
+		return public, &tpm2.TPMTSensitive{
+			SensitiveType: tpm2.TPMAlgRSA,
+			Sensitive:     tpm2.NewTPMUSensitiveComposite(tpm2.TPMAlgRSA, &tpm2.TPM2BPrivateKeyRSA{Buffer: k.Primes[0].Bytes()}),
+		}, nil
+	case *ecdsa.PrivateKey:
+		curve, err := curveID(k.Curve)
+		if err != nil {
+			return nil, nil, err
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		public.Type = tpm2.TPMAlgECC
+		public.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+			Scheme:  tpm2.TPMTECCScheme{Scheme: tpm2.TPMAlgNull},
+			CurveID: curve,
+			KDF:     tpm2.TPMTKDFScheme{Scheme: tpm2.TPMAlgNull},
+		})
+		public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+			X: tpm2.TPM2BECCParameter{Buffer: k.X.FillBytes(make([]byte, size))},
+			Y: tpm2.TPM2BECCParameter{Buffer: k.Y.FillBytes(make([]byte, size))},
+		})
+		return public, &tpm2.TPMTSensitive{
+			SensitiveType: tpm2.TPMAlgECC,
+			Sensitive:     tpm2.NewTPMUSensitiveComposite(tpm2.TPMAlgECC, &tpm2.TPM2BECCParameter{Buffer: k.D.FillBytes(make([]byte, size))}),
+		}, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+}
+
+func curveID(c elliptic.Curve) (tpm2.TPMECCCurve, error) {
+	switch c {
+	case elliptic.P256():
+		return tpm2.TPMECCNistP256, nil
+	case elliptic.P384():
+		return tpm2.TPMECCNistP384, nil
+	case elliptic.P521():
+		return tpm2.TPMECCNistP521, nil
+	default:
+		return 0, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, c.Params().Name)
+	}
+}
+
+// Import lands blob under parentHandle and loads the resulting key.
+// The caller must call Close() to flush it.
+//
+// The TPM2_Import private output is not kept: to make the key survive a
+// reboot, persist the loaded key (see the persist package).
+//
+// By default the parent is authorized with an empty password; parentAuth
+// overrides this session.
+func Import(tpm transport.TPM, parentHandle tpmutil.Handle, blob *Blob, parentAuth ...tpm2.Session) (tpmutil.HandleCloser, error) {
+	if parentHandle == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+	if blob == nil {
+		return nil, errors.New("blob is required")
+	}
+	rsp, err := tpm2.Import{
+		ParentHandle: tpmutil.ToAuthHandle(parentHandle, parentAuth...),
+		ObjectPublic: tpm2.New2B(blob.Public),
+		Duplicate:    tpm2.TPM2BPrivate{Buffer: blob.Duplicate},
+		InSymSeed:    tpm2.TPM2BEncryptedSecret{Buffer: blob.EncryptedSeed},
+		Symmetric:    tpm2.TPMTSymDef{Algorithm: tpm2.TPMAlgNull},
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import key: %w", err)
+	}
+
+	loadCfg := tpmutil.LoadConfig{
+		ParentHandle: parentHandle,
+		InPrivate:    rsp.OutPrivate,
+		InPublic:     tpm2.New2B(blob.Public),
+	}
+	if len(parentAuth) > 0 {
+		loadCfg.Auth = parentAuth[0]
+	}
+	return tpmutil.Load(tpm, loadCfg)
+}
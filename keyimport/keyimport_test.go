@@ -0,0 +1,101 @@
+package keyimport_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/keyimport"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImport(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	parents := map[string]tpm2.TPMTPublic{
+		"ECC SRK": tpmutil.ECCSRKTemplate,
+		"RSA SRK": tpm2.RSASRKTemplate,
+	}
+	keys := map[string]crypto.Signer{
+		"RSA":   rsaKey,
+		"ECDSA": ecdsaKey,
+	}
+	auth := []byte("imported-key-password")
+	digest := sha256.Sum256([]byte("message"))
+
+	for parentName, template := range parents {
+		srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: template})
+		require.NoError(t, err)
+		defer srk.Close()
+
+		for keyName, key := range keys {
+			t.Run(parentName+"/"+keyName, func(t *testing.T) {
+				blob, err := keyimport.Wrap(srk.Public(), key, keyimport.WrapConfig{UserAuth: auth})
+				require.NoError(t, err)
+
+				handle, err := keyimport.Import(thetpm, srk, blob)
+				require.NoError(t, err)
+				defer handle.Close()
+
+				// The TPM signs with the imported private key.
+				signer, err := tpmsigner.New(thetpm, tpmsigner.Config{KeyHandle: handle, Auth: auth})
+				require.NoError(t, err)
+				require.True(t, key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(signer.Public()))
+
+				sig, err := signer.Sign(nil, digest[:], crypto.SHA256)
+				require.NoError(t, err)
+				switch pub := key.Public().(type) {
+				case *rsa.PublicKey:
+					require.NoError(t, rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig))
+				case *ecdsa.PublicKey:
+					require.True(t, ecdsa.VerifyASN1(pub, digest[:], sig))
+				}
+			})
+		}
+	}
+}
+
+func TestImport_WrongParent(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	// Another storage key: same template, different unique field.
+	template := tpmutil.ECCSRKTemplate
+	template.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+		X: tpm2.TPM2BECCParameter{Buffer: []byte("other")},
+	})
+	other, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: template})
+	require.NoError(t, err)
+	defer other.Close()
+
+	blob, err := keyimport.Wrap(other.Public(), key)
+	require.NoError(t, err)
+	_, err = keyimport.Import(thetpm, srk, blob)
+	require.Error(t, err)
+}
+
+func TestWrap_UnsupportedKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err)
+	_, err = keyimport.Wrap(&tpmutil.ECCSRKTemplate, key)
+	require.ErrorIs(t, err, keyimport.ErrUnsupportedKey)
+}
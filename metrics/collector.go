@@ -0,0 +1,221 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// DefaultBuckets are the default upper bounds, in seconds, of the command
+// latency histogram: from a cached read (~1ms) to an RSA key generation
+// (several seconds) on hardware TPMs.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// CollectorConfig holds configuration for [NewCollector].
+type CollectorConfig struct {
+	// Namespace prefixes the name of the metrics.
+	//
+	// Default: "tpm".
+	Namespace string
+	// Buckets are the upper bounds, in seconds and in increasing order, of
+	// the command latency histogram.
+	//
+	// Default: [DefaultBuckets].
+	Buckets []float64
+}
+
+// CheckAndSetDefault validates and sets default values for CollectorConfig.
+func (c *CollectorConfig) CheckAndSetDefault() error {
+	if c.Namespace == "" {
+		c.Namespace = "tpm"
+	}
+	if len(c.Buckets) == 0 {
+		c.Buckets = DefaultBuckets
+	}
+	if !slices.IsSorted(c.Buckets) || len(slices.Compact(slices.Clone(c.Buckets))) != len(c.Buckets) {
+		return errors.New("invalid buckets: must be in increasing order")
+	}
+	return nil
+}
+
+// Collector is an [Observer] aggregating commands into metrics, which it
+// serves over HTTP in the Prometheus text exposition format, without
+// depending on the Prometheus client library:
+//
+//   - <namespace>_commands_total{command, rc}: commands answered by the TPM,
+//     by response code (e.g. "TPM_RC_SUCCESS", "TPM_RC_BAD_AUTH"),
+//   - <namespace>_transport_errors_total{command}: commands which failed in
+//     the transport,
+//   - <namespace>_command_duration_seconds{command}: latency histogram,
+//   - <namespace>_sessions_total{command, type}: sessions authorizing
+//     commands, by [SessionType].
+//
+// A Collector is safe for concurrent use.
+type Collector struct {
+	cfg CollectorConfig
+
+	mu        sync.Mutex
+	commands  map[[2]string]uint64
+	errors    map[string]uint64
+	sessions  map[[2]string]uint64
+	durations map[string]*histogram
+}
+
+// histogram holds the cumulative counts of a latency histogram.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewCollector returns an empty Collector.
+//
+// Example:
+//
+//	collector, err := metrics.NewCollector()
+//	if err != nil {
+//	    return err
+//	}
+//	thetpm = metrics.Wrap(thetpm, collector)
+//	http.Handle("/metrics", collector)
+func NewCollector(optionalCfg ...CollectorConfig) (*Collector, error) {
+	var cfg CollectorConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	return &Collector{
+		cfg:       cfg,
+		commands:  make(map[[2]string]uint64),
+		errors:    make(map[string]uint64),
+		sessions:  make(map[[2]string]uint64),
+		durations: make(map[string]*histogram),
+	}, nil
+}
+
+// ObserveCommand implements [Observer].
+func (c *Collector) ObserveCommand(cmd Command) {
+	name := cmd.Name()
+	seconds := cmd.Duration.Seconds()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cmd.Err != nil {
+		c.errors[name]++
+	} else {
+		c.commands[[2]string{name, rcLabel(cmd.RC)}]++
+	}
+	for _, s := range cmd.Sessions {
+		c.sessions[[2]string{name, string(s)}]++
+	}
+	h, ok := c.durations[name]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.cfg.Buckets))}
+		c.durations[name] = h
+	}
+	for i, le := range c.cfg.Buckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	ns := c.cfg.Namespace
+
+	c.mu.Lock()
+	cw.printf("# HELP %s_commands_total Commands answered by the TPM, by response code.\n", ns)
+	cw.printf("# TYPE %s_commands_total counter\n", ns)
+	for _, k := range slices.SortedFunc(maps.Keys(c.commands), compareKeys) {
+		cw.printf("%s_commands_total{command=%q,rc=%q} %d\n", ns, k[0], k[1], c.commands[k])
+	}
+	cw.printf("# HELP %s_transport_errors_total Commands which failed in the transport.\n", ns)
+	cw.printf("# TYPE %s_transport_errors_total counter\n", ns)
+	for _, k := range slices.Sorted(maps.Keys(c.errors)) {
+		cw.printf("%s_transport_errors_total{command=%q} %d\n", ns, k, c.errors[k])
+	}
+	cw.printf("# HELP %s_command_duration_seconds Latency of the commands.\n", ns)
+	cw.printf("# TYPE %s_command_duration_seconds histogram\n", ns)
+	for _, k := range slices.Sorted(maps.Keys(c.durations)) {
+		h := c.durations[k]
+		for i, le := range c.cfg.Buckets {
+			cw.printf("%s_command_duration_seconds_bucket{command=%q,le=\"%g\"} %d\n", ns, k, le, h.counts[i])
+		}
+		cw.printf("%s_command_duration_seconds_bucket{command=%q,le=\"+Inf\"} %d\n", ns, k, h.count)
+		cw.printf("%s_command_duration_seconds_sum{command=%q} %g\n", ns, k, h.sum)
+		cw.printf("%s_command_duration_seconds_count{command=%q} %d\n", ns, k, h.count)
+	}
+	cw.printf("# HELP %s_sessions_total Sessions authorizing the commands, by type.\n", ns)
+	cw.printf("# TYPE %s_sessions_total counter\n", ns)
+	for _, k := range slices.SortedFunc(maps.Keys(c.sessions), compareKeys) {
+		cw.printf("%s_sessions_total{command=%q,type=%q} %d\n", ns, k[0], k[1], c.sessions[k])
+	}
+	c.mu.Unlock()
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// ServeHTTP implements [http.Handler], serving the metrics.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// rcLabel returns the name of the response code rc, without the handle,
+// parameter or session number of format-1 errors to bound the number of
+// label values.
+func rcLabel(rc tpm2.TPMRC) string {
+	if rc == tpm2.TPMRCSuccess {
+		return "TPM_RC_SUCCESS"
+	}
+	// Format-1 errors: keep the format bit and the error number.
+	if rc&0x80 != 0 {
+		rc &= 0xbf
+	}
+	name, _, _ := strings.Cut(rc.Error(), ":")
+	name, _, _ = strings.Cut(name, " ")
+	if !strings.HasPrefix(name, "TPM_RC_") {
+		return fmt.Sprintf("0x%x", uint32(rc))
+	}
+	return name
+}
+
+func compareKeys(a, b [2]string) int {
+	if c := strings.Compare(a[0], b[0]); c != 0 {
+		return c
+	}
+	return strings.Compare(a[1], b[1])
+}
+
+// countingWriter keeps the first error and the number of bytes written.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) printf(format string, args ...any) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
@@ -0,0 +1,136 @@
+// Package metrics provides a transport middleware reporting every command sent
+// to the TPM, its latency, response code and the sessions it used, to an
+// [Observer], so that services built on this module can monitor the health
+// and performance of their TPM.
+//
+// [Collector] is an Observer aggregating the commands into metrics exposed in
+// the Prometheus text format, and [Logger] an Observer logging them with
+// log/slog.
+package metrics
+
+import (
+	"io"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/decode"
+)
+
+// SessionType is the type of a session authorizing a command.
+type SessionType string
+
+const (
+	// SessionPassword is a password session (TPM_RS_PW).
+	SessionPassword SessionType = "password"
+	// SessionHMAC is an HMAC session.
+	SessionHMAC SessionType = "hmac"
+	// SessionPolicy is a policy session.
+	SessionPolicy SessionType = "policy"
+)
+
+// Command is the record of a command sent to the TPM.
+type Command struct {
+	// Code is the command code.
+	Code tpm2.TPMCC
+	// Handles are the handles of the command, e.g. the object or NV index it
+	// applies to. It is empty for commands unknown to the decode package.
+	Handles []tpm2.TPMHandle
+	// Duration is the time the transport took to answer.
+	Duration time.Duration
+	// RC is the response code of the TPM, TPM_RC_SUCCESS when the command
+	// succeeded. It is TPM_RC_SUCCESS as well when Err is set.
+	RC tpm2.TPMRC
+	// Err is the error returned by the transport, when the command didn't
+	// reach the TPM or its response was lost.
+	Err error
+	// Sessions are the types of the sessions of the command, in order. It is
+	// empty for commands without sessions, or unknown to the decode package.
+	Sessions []SessionType
+}
+
+// Name returns the name of the command, e.g. "CreatePrimary".
+func (c Command) Name() string {
+	return decode.CommandName(c.Code)
+}
+
+// Observer is notified of every command sent through [Wrap].
+//
+// ObserveCommand is called synchronously once the response is received: it
+// must be fast and, when the transport is shared, safe for concurrent use.
+type Observer interface {
+	ObserveCommand(Command)
+}
+
+// ObserverFunc is an [Observer] calling itself.
+type ObserverFunc func(Command)
+
+// ObserveCommand implements [Observer].
+func (f ObserverFunc) ObserveCommand(c Command) {
+	f(c)
+}
+
+// instrumented is the transport returned by [Wrap].
+type instrumented struct {
+	tpm transport.TPM
+	obs Observer
+}
+
+// Wrap returns a transport forwarding commands to tpm and reporting each of
+// them to obs.
+//
+// Closing the returned transport closes tpm if it implements [io.Closer].
+//
+// Example:
+//
+//	thetpm = metrics.Wrap(thetpm, metrics.ObserverFunc(func(c metrics.Command) {
+//	    log.Printf("%s: rc=0x%x (%s)", c.Name(), uint32(c.RC), c.Duration)
+//	}))
+func Wrap(tpm transport.TPM, obs Observer) transport.TPMCloser {
+	return &instrumented{tpm: tpm, obs: obs}
+}
+
+// Send implements [transport.TPM].
+func (i *instrumented) Send(cmd []byte) ([]byte, error) {
+	start := time.Now()
+	rsp, err := i.tpm.Send(cmd)
+	c := Command{Duration: time.Since(start), Err: err}
+
+	if h, herr := decode.ParseHeader(cmd); herr == nil {
+		c.Code = tpm2.TPMCC(h.Code)
+	}
+	if parsed, perr := decode.ParseCommand(cmd); perr == nil {
+		c.Handles = parsed.Handles
+		for _, s := range parsed.Sessions {
+			c.Sessions = append(c.Sessions, sessionType(s.Handle))
+		}
+	}
+	if err == nil {
+		if h, herr := decode.ParseHeader(rsp); herr == nil {
+			c.RC = tpm2.TPMRC(h.Code)
+		}
+	}
+	i.obs.ObserveCommand(c)
+	return rsp, err
+}
+
+// Close implements [transport.TPMCloser].
+func (i *instrumented) Close() error {
+	if c, ok := i.tpm.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// sessionType returns the type of the session handle h, from its handle type
+// (TPM_HT_HMAC_SESSION or TPM_HT_POLICY_SESSION).
+func sessionType(h tpm2.TPMHandle) SessionType {
+	switch {
+	case h == tpm2.TPMRSPW:
+		return SessionPassword
+	case h>>24 == 0x03:
+		return SessionPolicy
+	default:
+		return SessionHMAC
+	}
+}
@@ -0,0 +1,153 @@
+package metrics_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+// getRandom is a TPM2_GetRandom command requesting 8 bytes.
+var getRandom = []byte{0x80, 0x01, 0, 0, 0, 0x0c, 0, 0, 0x01, 0x7b, 0, 0x08}
+
+// failing is a transport which can't reach the TPM.
+type failing struct{}
+
+func (failing) Send([]byte) ([]byte, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestWrap(t *testing.T) {
+	var commands []metrics.Command
+	thetpm := metrics.Wrap(testutil.OpenSimulator(t), metrics.ObserverFunc(func(c metrics.Command) {
+		commands = append(commands, c)
+	}))
+
+	_, err := tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm)
+	require.NoError(t, err)
+	_, err = tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpmutil.ECCSRKTemplate,
+		Auth:     tpm2.PasswordAuth([]byte("wrong")),
+	})
+	require.ErrorIs(t, err, tpm2.TPMRCBadAuth)
+	_, err = tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm, tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.AESEncryption(128, tpm2.EncryptOut)))
+	require.NoError(t, err)
+
+	require.GreaterOrEqual(t, len(commands), 4)
+	require.Equal(t, "GetRandom", commands[0].Name())
+	require.Equal(t, tpm2.TPMRCSuccess, commands[0].RC)
+	require.Empty(t, commands[0].Sessions)
+	require.Positive(t, commands[0].Duration)
+
+	require.Equal(t, tpm2.TPMCCCreatePrimary, commands[1].Code)
+	require.ErrorIs(t, commands[1].RC, tpm2.TPMRCBadAuth)
+	require.Equal(t, []metrics.SessionType{metrics.SessionPassword}, commands[1].Sessions)
+
+	require.Equal(t, tpm2.TPMCCStartAuthSession, commands[2].Code)
+	require.Equal(t, tpm2.TPMCCGetRandom, commands[3].Code)
+	require.Equal(t, []metrics.SessionType{metrics.SessionHMAC}, commands[3].Sessions)
+
+	_, err = metrics.Wrap(failing{}, metrics.ObserverFunc(func(c metrics.Command) {
+		commands = append(commands, c)
+	})).Send(getRandom)
+	require.Error(t, err)
+	require.Error(t, commands[len(commands)-1].Err)
+	require.Equal(t, tpm2.TPMCCGetRandom, commands[len(commands)-1].Code)
+}
+
+func TestCollector(t *testing.T) {
+	collector, err := metrics.NewCollector(metrics.CollectorConfig{Buckets: []float64{0.5, 60}})
+	require.NoError(t, err)
+	thetpm := metrics.Wrap(testutil.OpenSimulator(t), collector)
+
+	for range 2 {
+		_, err = tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm)
+		require.NoError(t, err)
+	}
+	_, err = tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpmutil.ECCSRKTemplate,
+		Auth:     tpm2.PasswordAuth([]byte("wrong")),
+	})
+	require.Error(t, err)
+	collector.ObserveCommand(metrics.Command{Code: tpm2.TPMCCGetRandom, Err: errors.New("connection reset")})
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	require.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+
+	require.Contains(t, body, "# TYPE tpm_commands_total counter\n")
+	require.Contains(t, body, `tpm_commands_total{command="GetRandom",rc="TPM_RC_SUCCESS"} 2`+"\n")
+	// The session number of the format-1 error is not part of the label.
+	require.Contains(t, body, `tpm_commands_total{command="CreatePrimary",rc="TPM_RC_BAD_AUTH"} 1`+"\n")
+	require.Contains(t, body, `tpm_transport_errors_total{command="GetRandom"} 1`+"\n")
+	require.Contains(t, body, `tpm_command_duration_seconds_bucket{command="GetRandom",le="60"} 3`+"\n")
+	require.Contains(t, body, `tpm_command_duration_seconds_bucket{command="GetRandom",le="+Inf"} 3`+"\n")
+	require.Contains(t, body, `tpm_command_duration_seconds_count{command="GetRandom"} 3`+"\n")
+	require.Contains(t, body, `tpm_sessions_total{command="CreatePrimary",type="password"} 1`+"\n")
+
+	_, err = metrics.NewCollector(metrics.CollectorConfig{Buckets: []float64{1, 0.5}})
+	require.Error(t, err)
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	thetpm := metrics.WithLogger(testutil.OpenSimulator(t), logger, "test")
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	_, err = tpm2.ReadPublic{ObjectHandle: srk.Handle()}.Execute(thetpm)
+	require.NoError(t, err)
+	require.NoError(t, srk.Close())
+	_, err = tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpmutil.ECCSRKTemplate,
+		Auth:     tpm2.PasswordAuth([]byte("wrong")),
+	})
+	require.Error(t, err)
+
+	type event struct {
+		Level    string   `json:"level"`
+		Msg      string   `json:"msg"`
+		Op       string   `json:"op"`
+		Command  string   `json:"command"`
+		Handles  []string `json:"handles"`
+		Duration int64    `json:"duration"`
+		RC       string   `json:"rc"`
+	}
+	var events []event
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e event
+		require.NoError(t, dec.Decode(&e))
+		events = append(events, e)
+	}
+	require.Len(t, events, 4)
+	require.Equal(t, event{
+		Level:    "DEBUG",
+		Msg:      "tpm command",
+		Op:       "test",
+		Command:  "ReadPublic",
+		Handles:  []string{fmt.Sprintf("0x%08x", uint32(srk.Handle()))},
+		Duration: events[1].Duration,
+		RC:       "TPM_RC_SUCCESS",
+	}, events[1])
+	require.Positive(t, events[1].Duration)
+	require.Equal(t, "WARN", events[3].Level)
+	require.Equal(t, "CreatePrimary", events[3].Command)
+	require.Equal(t, []string{"0x40000001"}, events[3].Handles)
+	require.Equal(t, "TPM_RC_BAD_AUTH", events[3].RC)
+
+	sim := testutil.OpenSimulator(t)
+	require.Equal(t, sim, metrics.WithLogger(sim, nil, "test"))
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Logger returns an [Observer] logging each command to logger as a "tpm
+// command" event with the attributes command, handles, duration and rc: at
+// debug level when the TPM succeeds, at warn level when it fails or the
+// transport returns an error, added as the attribute error.
+//
+// Example:
+//
+//	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+//	thetpm = metrics.Wrap(thetpm, metrics.Logger(logger))
+func Logger(logger *slog.Logger) Observer {
+	return ObserverFunc(func(c Command) {
+		handles := make([]string, len(c.Handles))
+		for i, h := range c.Handles {
+			handles[i] = fmt.Sprintf("0x%08x", uint32(h))
+		}
+		attrs := []slog.Attr{
+			slog.String("command", c.Name()),
+			slog.Any("handles", handles),
+			slog.Duration("duration", c.Duration),
+			slog.String("rc", rcLabel(c.RC)),
+		}
+		level := slog.LevelDebug
+		if c.RC != tpm2.TPMRCSuccess {
+			level = slog.LevelWarn
+		}
+		if c.Err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.String("error", c.Err.Error()))
+		}
+		logger.LogAttrs(context.Background(), level, "tpm command", attrs...)
+	})
+}
+
+// WithLogger returns tpm logging its commands to logger (see [Logger]), each
+// event carrying the attribute op, or tpm itself when logger is nil. The
+// packages of this module call it with the logger of their configuration,
+// e.g. with op "seal".
+//
+// Unlike [Wrap], closing the returned transport doesn't close tpm.
+func WithLogger(tpm transport.TPM, logger *slog.Logger, op string) transport.TPM {
+	if logger == nil {
+		return tpm
+	}
+	return &instrumented{tpm: noCloser{tpm}, obs: Logger(logger.With(slog.String("op", op)))}
+}
+
+// noCloser hides the Close method of a transport.
+type noCloser struct {
+	transport.TPM
+}
@@ -0,0 +1,243 @@
+// Package mssim is a client of the TPM simulator TCP protocol (TCG TPM 2.0
+// Part 4, "TpmTcpProtocol"), spoken by the Microsoft/IBM reference simulator
+// and by swtpm started with --tpm2 and a socket server and control channel.
+//
+// Unlike a plain connection to the command port, it also drives the platform
+// port, used to power the TPM on and off: tests can exercise power-cycle
+// scenarios, such as PCRs reset or contexts invalidated by a TPM Reset,
+// against a remote simulator.
+package mssim
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// Platform and command port signals, from TpmTcpProtocol.h.
+const (
+	signalPowerOn  uint32 = 1
+	signalPowerOff uint32 = 2
+	sendCommand    uint32 = 8
+	signalNVOn     uint32 = 11
+	sessionEnd     uint32 = 20
+)
+
+// ErrPlatform is returned when the simulator rejects a platform signal.
+var ErrPlatform = errors.New("platform signal rejected")
+
+// Config holds configuration for [Open].
+type Config struct {
+	// CommandAddress is the address (host:port) of the command port.
+	//
+	// Default: "127.0.0.1:2321".
+	CommandAddress string
+	// PlatformAddress is the address (host:port) of the platform port.
+	//
+	// Default: "127.0.0.1:2322".
+	PlatformAddress string
+	// Locality is the locality of the commands.
+	//
+	// Default: 0.
+	Locality uint8
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	if c.CommandAddress == "" {
+		c.CommandAddress = "127.0.0.1:2321"
+	}
+	if c.PlatformAddress == "" {
+		c.PlatformAddress = "127.0.0.1:2322"
+	}
+	if c.Locality > 4 {
+		return fmt.Errorf("invalid locality %d: must be 0 to 4", c.Locality)
+	}
+	return nil
+}
+
+// TPM is a [transport.TPMCloser] to a simulator, connected to both its
+// command and platform ports. It is safe for concurrent use.
+type TPM struct {
+	cfg Config
+
+	mu       sync.Mutex
+	cmd      net.Conn
+	cmdR     *bufio.Reader
+	platform net.Conn
+}
+
+// Open connects to the simulator, powers it on and starts it up if needed.
+//
+// Example:
+//
+//	thetpm, err := mssim.Open(mssim.Config{CommandAddress: "127.0.0.1:2321", PlatformAddress: "127.0.0.1:2322"})
+//	if err != nil {
+//	    return err
+//	}
+//	defer thetpm.Close()
+func Open(optionalCfg ...Config) (*TPM, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+
+	platform, err := net.Dial("tcp", cfg.PlatformAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial platform port: %w", err)
+	}
+	cmd, err := net.Dial("tcp", cfg.CommandAddress)
+	if err != nil {
+		platform.Close()
+		return nil, fmt.Errorf("failed to dial command port: %w", err)
+	}
+	t := &TPM{cfg: cfg, cmd: cmd, cmdR: bufio.NewReader(cmd), platform: platform}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// A simulator already powered on acknowledges the signals as well.
+	if err := t.powerOn(); err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Send implements [transport.TPM].
+func (t *TPM) Send(cmd []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.send(cmd)
+}
+
+// Reset performs a TPM Reset: the TPM is powered off without orderly
+// shutdown, powered on and started up with TPM_SU_CLEAR. PCRs are reset,
+// sessions and transient objects are flushed and saved contexts can't be
+// loaded anymore.
+func (t *TPM) Reset() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.signal(signalPowerOff); err != nil {
+		return err
+	}
+	return t.powerOn()
+}
+
+// PowerCycle powers the TPM off and on, without starting it up: the next
+// command must be TPM2_Startup. Unlike [TPM.Reset], the caller chooses the
+// shutdown before and the startup after, e.g. TPM_SU_STATE for both to
+// perform a TPM Resume.
+//
+// Example:
+//
+//	_, err := tpm2.Shutdown{ShutdownType: tpm2.TPMSUState}.Execute(thetpm)
+//	if err != nil {
+//	    return err
+//	}
+//	if err := thetpm.PowerCycle(); err != nil {
+//	    return err
+//	}
+//	_, err = tpm2.Startup{StartupType: tpm2.TPMSUState}.Execute(thetpm)
+func (t *TPM) PowerCycle() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range []uint32{signalPowerOff, signalPowerOn, signalNVOn} {
+		if err := t.signal(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements [transport.TPMCloser]. It ends the sessions on both
+// ports, leaving the simulator powered on.
+func (t *TPM) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.close()
+}
+
+// powerOn powers the TPM and its NV memory on, then starts it up. A TPM
+// already started answers TPM_RC_INITIALIZE, which is ignored.
+func (t *TPM) powerOn() error {
+	if err := t.signal(signalPowerOn); err != nil {
+		return err
+	}
+	if err := t.signal(signalNVOn); err != nil {
+		return err
+	}
+	_, err := tpm2.Startup{StartupType: tpm2.TPMSUClear}.Execute(sender(t.send))
+	if err != nil && !errors.Is(err, tpm2.TPMRCInitialize) {
+		return fmt.Errorf("failed to start the TPM up: %w", err)
+	}
+	return nil
+}
+
+// signal sends a signal to the platform port.
+func (t *TPM) signal(s uint32) error {
+	if err := binary.Write(t.platform, binary.BigEndian, s); err != nil {
+		return fmt.Errorf("failed to send platform signal %d: %w", s, err)
+	}
+	var rc uint32
+	if err := binary.Read(t.platform, binary.BigEndian, &rc); err != nil {
+		return fmt.Errorf("failed to read platform signal %d acknowledgment: %w", s, err)
+	}
+	if rc != 0 {
+		return fmt.Errorf("%w: signal %d, code 0x%x", ErrPlatform, s, rc)
+	}
+	return nil
+}
+
+// send sends a command to the command port: TPM_SEND_COMMAND, locality,
+// size and command, answered by size, response and an acknowledgment.
+func (t *TPM) send(cmd []byte) ([]byte, error) {
+	msg := make([]byte, 0, 9+len(cmd))
+	msg = binary.BigEndian.AppendUint32(msg, sendCommand)
+	msg = append(msg, t.cfg.Locality)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(cmd)))
+	msg = append(msg, cmd...)
+	if _, err := t.cmd.Write(msg); err != nil {
+		return nil, fmt.Errorf("failed to send command: %w", err)
+	}
+
+	var size uint32
+	if err := binary.Read(t.cmdR, binary.BigEndian, &size); err != nil {
+		return nil, fmt.Errorf("failed to read response size: %w", err)
+	}
+	rsp := make([]byte, size)
+	if _, err := io.ReadFull(t.cmdR, rsp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var ack uint32
+	if err := binary.Read(t.cmdR, binary.BigEndian, &ack); err != nil {
+		return nil, fmt.Errorf("failed to read response acknowledgment: %w", err)
+	}
+	if ack != 0 {
+		return nil, fmt.Errorf("command rejected by the simulator: code 0x%x", ack)
+	}
+	return rsp, nil
+}
+
+func (t *TPM) close() error {
+	var errs []error
+	for _, conn := range []net.Conn{t.cmd, t.platform} {
+		// The session end isn't acknowledged.
+		binary.Write(conn, binary.BigEndian, sessionEnd)
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// sender adapts a send function to [transport.TPM].
+type sender func([]byte) ([]byte, error)
+
+func (s sender) Send(cmd []byte) ([]byte, error) { return s(cmd) }
@@ -0,0 +1,208 @@
+package mssim_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/google/go-tpm-tools/simulator"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/mssim"
+	"github.com/stretchr/testify/require"
+)
+
+// server serves the in-process simulator over the command and platform ports
+// of the TPM simulator TCP protocol.
+type server struct {
+	sim      *simulator.Simulator
+	cmd      net.Listener
+	platform net.Listener
+
+	mu      sync.Mutex
+	on      bool
+	resets  int
+	signals []uint32
+}
+
+func newServer(t *testing.T) *server {
+	sim, err := simulator.Get()
+	require.NoError(t, err)
+	t.Cleanup(func() { sim.Close() })
+
+	cmd, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { cmd.Close() })
+	platform, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { platform.Close() })
+
+	s := &server{sim: sim, cmd: cmd, platform: platform, on: true}
+	go s.accept(cmd, s.handleCommands)
+	go s.accept(platform, s.handleSignals)
+	return s
+}
+
+func (s *server) config() mssim.Config {
+	return mssim.Config{
+		CommandAddress:  s.cmd.Addr().String(),
+		PlatformAddress: s.platform.Addr().String(),
+	}
+}
+
+func (s *server) accept(ln net.Listener, handle func(net.Conn)) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			handle(conn)
+		}()
+	}
+}
+
+func (s *server) handleSignals(conn net.Conn) {
+	for {
+		var signal uint32
+		if err := binary.Read(conn, binary.BigEndian, &signal); err != nil || signal == 20 {
+			return
+		}
+		s.mu.Lock()
+		s.signals = append(s.signals, signal)
+		switch signal {
+		case 1: // power on
+			if !s.on {
+				// Reset starts the simulator up with TPM_SU_CLEAR.
+				s.sim.Reset()
+				s.resets++
+			}
+			s.on = true
+		case 2: // power off
+			s.on = false
+		}
+		s.mu.Unlock()
+		binary.Write(conn, binary.BigEndian, uint32(0))
+	}
+}
+
+func (s *server) handleCommands(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		var header struct {
+			Signal   uint32
+			Locality uint8
+			Size     uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil || header.Signal != 8 {
+			return
+		}
+		cmd := make([]byte, header.Size)
+		if _, err := io.ReadFull(r, cmd); err != nil {
+			return
+		}
+		s.mu.Lock()
+		rsp, err := tpmutil.RunCommandRaw(s.sim, cmd)
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+		binary.Write(conn, binary.BigEndian, uint32(len(rsp)))
+		conn.Write(rsp)
+		binary.Write(conn, binary.BigEndian, uint32(0))
+	}
+}
+
+func TestOpen(t *testing.T) {
+	srv := newServer(t)
+
+	thetpm, err := mssim.Open(srv.config())
+	require.NoError(t, err)
+	defer thetpm.Close()
+
+	// Power on, NV on; the Startup answered TPM_RC_INITIALIZE.
+	srv.mu.Lock()
+	require.Equal(t, []uint32{1, 11}, srv.signals)
+	srv.mu.Unlock()
+
+	rsp, err := tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm)
+	require.NoError(t, err)
+	require.Len(t, rsp.RandomBytes.Buffer, 8)
+}
+
+func TestOpen_InvalidConfig(t *testing.T) {
+	_, err := mssim.Open(mssim.Config{Locality: 5})
+	require.ErrorContains(t, err, "invalid locality")
+}
+
+func TestReset(t *testing.T) {
+	srv := newServer(t)
+
+	thetpm, err := mssim.Open(srv.config())
+	require.NoError(t, err)
+	defer thetpm.Close()
+
+	const pcr = 16
+	pcrSelection := tpm2.TPMLPCRSelection{
+		PCRSelections: []tpm2.TPMSPCRSelection{{
+			Hash:      tpm2.TPMAlgSHA256,
+			PCRSelect: tpm2.PCClientCompatible.PCRs(pcr),
+		}},
+	}
+	readPCR := func() []byte {
+		rsp, err := tpm2.PCRRead{PCRSelectionIn: pcrSelection}.Execute(thetpm)
+		require.NoError(t, err)
+		return rsp.PCRValues.Digests[0].Buffer
+	}
+	initial := readPCR()
+
+	_, err = tpm2.PCRExtend{
+		PCRHandle: tpm2.AuthHandle{Handle: tpm2.TPMHandle(pcr), Auth: tpm2.PasswordAuth(nil)},
+		Digests: tpm2.TPMLDigestValues{Digests: []tpm2.TPMTHA{{
+			HashAlg: tpm2.TPMAlgSHA256,
+			Digest:  make([]byte, 32),
+		}}},
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	require.NotEqual(t, initial, readPCR())
+
+	srk, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	saved, err := tpm2.ContextSave{SaveHandle: srk.ObjectHandle}.Execute(thetpm)
+	require.NoError(t, err)
+
+	require.NoError(t, thetpm.Reset())
+	require.Equal(t, 1, srv.resets)
+
+	// PCRs are reset and the transient objects are gone, even from contexts.
+	require.Equal(t, initial, readPCR())
+	_, err = tpm2.ReadPublic{ObjectHandle: srk.ObjectHandle}.Execute(thetpm)
+	require.Error(t, err)
+	_, err = tpm2.ContextLoad{Context: saved.Context}.Execute(thetpm)
+	require.Error(t, err)
+}
+
+func TestPowerCycle(t *testing.T) {
+	srv := newServer(t)
+
+	thetpm, err := mssim.Open(srv.config())
+	require.NoError(t, err)
+	defer thetpm.Close()
+
+	_, err = tpm2.Shutdown{ShutdownType: tpm2.TPMSUState}.Execute(thetpm)
+	require.NoError(t, err)
+	require.NoError(t, thetpm.PowerCycle())
+
+	// Power off, power on and NV on, without startup.
+	srv.mu.Lock()
+	require.Equal(t, []uint32{1, 11, 2, 1, 11}, srv.signals)
+	srv.mu.Unlock()
+	require.Equal(t, 1, srv.resets)
+}
@@ -0,0 +1,85 @@
+// Package names computes and verifies TPM Names in software, so that
+// verifiers can check the name a TPM reports for an object or an NV index
+// against its public area without a TPM.
+//
+// The Name of an object or an NV index is its name algorithm followed by the
+// digest of its public area with that algorithm (TPM 2.0 Part 1, 16):
+//
+//	Name = nameAlg || H_nameAlg(TPMT_PUBLIC)
+//
+// Example:
+//
+//	if err := names.Verify(params.AKName, *akPub); err != nil {
+//	    return err
+//	}
+package names
+
+import (
+	"bytes"
+	// The hash algorithms a TPM may use as name algorithm.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// ErrMismatch is returned by [Verify] and [VerifyNV] when a name doesn't
+// match the public area.
+var ErrMismatch = errors.New("name doesn't match the public area")
+
+// Compute returns the Name of the object whose public area is pub.
+func Compute(pub tpm2.TPMTPublic) (tpm2.TPM2BName, error) {
+	return compute(pub.NameAlg, tpm2.Marshal(pub))
+}
+
+// ComputeNV returns the Name of the NV index whose public area is pub.
+//
+// The public area of an index covers its attributes, including
+// TPMA_NV_WRITTEN: its name changes after the first write.
+func ComputeNV(pub tpm2.TPMSNVPublic) (tpm2.TPM2BName, error) {
+	return compute(pub.NameAlg, tpm2.Marshal(pub))
+}
+
+// Verify checks that name is the Name of the object whose public area is pub.
+func Verify(name []byte, pub tpm2.TPMTPublic) error {
+	expected, err := Compute(pub)
+	if err != nil {
+		return err
+	}
+	return verify(name, expected)
+}
+
+// VerifyNV checks that name is the Name of the NV index whose public area is
+// pub.
+func VerifyNV(name []byte, pub tpm2.TPMSNVPublic) error {
+	expected, err := ComputeNV(pub)
+	if err != nil {
+		return err
+	}
+	return verify(name, expected)
+}
+
+func compute(nameAlg tpm2.TPMIAlgHash, public []byte) (tpm2.TPM2BName, error) {
+	h, err := nameAlg.Hash()
+	if err != nil {
+		return tpm2.TPM2BName{}, fmt.Errorf("invalid name algorithm: %w", err)
+	}
+	if !h.Available() {
+		return tpm2.TPM2BName{}, fmt.Errorf("name algorithm %v isn't available", h)
+	}
+	digest := h.New()
+	digest.Write(public)
+	name := binary.BigEndian.AppendUint16(nil, uint16(nameAlg))
+	return tpm2.TPM2BName{Buffer: digest.Sum(name)}, nil
+}
+
+func verify(name []byte, expected tpm2.TPM2BName) error {
+	if !bytes.Equal(name, expected.Buffer) {
+		return fmt.Errorf("%w: got %x, expected %x", ErrMismatch, name, expected.Buffer)
+	}
+	return nil
+}
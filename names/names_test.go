@@ -0,0 +1,74 @@
+package names_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/names"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompute(t *testing.T) {
+	tpm := testutil.OpenSimulator(t)
+
+	for _, tc := range []struct {
+		name     string
+		template tpm2.TPMTPublic
+	}{
+		{"ECC SRK", tpmutil.ECCSRKTemplate},
+		{"RSA signer", templates.RSASigner()},
+		{"ECC signer SHA-384", templates.ECCSigner(templates.WithNameAlg(tpm2.TPMAlgSHA384))},
+		{"ECC signer SHA-512", templates.ECCSigner(templates.WithNameAlg(tpm2.TPMAlgSHA512))},
+		{"ECC decrypter SHA-1", templates.ECCDecrypter(templates.WithNameAlg(tpm2.TPMAlgSHA1))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rsp, err := tpm2.CreatePrimary{
+				PrimaryHandle: tpm2.TPMRHOwner,
+				InPublic:      tpm2.New2B(tc.template),
+			}.Execute(tpm)
+			require.NoError(t, err)
+			defer tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm)
+
+			pub, err := rsp.OutPublic.Contents()
+			require.NoError(t, err)
+			name, err := names.Compute(*pub)
+			require.NoError(t, err)
+			require.Equal(t, rsp.Name.Buffer, name.Buffer)
+			require.NoError(t, names.Verify(rsp.Name.Buffer, *pub))
+		})
+	}
+}
+
+func TestComputeNV(t *testing.T) {
+	tpm := testutil.OpenSimulator(t)
+
+	idx, err := nv.Define(tpm, nv.DefineConfig{Index: 0x01500000, Size: 8})
+	require.NoError(t, err)
+	pub, err := nv.ReadPublic(tpm, idx.Handle)
+	require.NoError(t, err)
+	require.NoError(t, names.VerifyNV(idx.Name.Buffer, *pub))
+
+	// The first write sets TPMA_NV_WRITTEN, which changes the name.
+	require.NoError(t, nv.Write(tpm, idx, []byte("data"), tpm2.PasswordAuth(nil)))
+	require.ErrorIs(t, names.VerifyNV(idx.Name.Buffer, *pub), names.ErrMismatch)
+	pub.Attributes.Written = true
+	require.NoError(t, names.VerifyNV(idx.Name.Buffer, *pub))
+}
+
+func TestVerify(t *testing.T) {
+	pub := templates.AK()
+	name, err := names.Compute(pub)
+	require.NoError(t, err)
+	require.NoError(t, names.Verify(name.Buffer, pub))
+
+	other := templates.AK(templates.WithNoDA())
+	require.ErrorIs(t, names.Verify(name.Buffer, other), names.ErrMismatch)
+	require.ErrorIs(t, names.Verify(nil, pub), names.ErrMismatch)
+
+	_, err = names.Compute(templates.AK(templates.WithNameAlg(tpm2.TPMAlgNull)))
+	require.Error(t, err)
+}
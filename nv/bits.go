@@ -0,0 +1,97 @@
+package nv
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+)
+
+// BitsAttributes are the attributes used by [DefineBits]: a bit field set and
+// read with its own authorization value, also readable by the owner.
+var BitsAttributes = tpm2.TPMANV{
+	NT:        tpm2.TPMNTBits,
+	AuthWrite: true,
+	AuthRead:  true,
+	OwnerRead: true,
+	NoDA:      true,
+}
+
+// DefineBits creates a 64-bit field index protected by auth, e.g. to hold the
+// lifecycle state of a device (provisioned, debug enabled, decommissioned...).
+//
+// Bits can only be set: once written, a bit stays set until the index is
+// deleted. Like a counter, the field is unreadable until the first
+// [SetBits], which may set no bit.
+func DefineBits(tpm transport.TPM, index tpm2.TPMHandle, auth []byte) (*Index, error) {
+	return Define(tpm, DefineConfig{
+		Index:      index,
+		Attributes: BitsAttributes,
+		Auth:       auth,
+	})
+}
+
+// SetBits ORs bits into the field and refreshes the index name.
+//
+// go-tpm doesn't implement TPM2_NV_SetBits: it is marshaled here and
+// authorized with a password session carrying auth, the authorization value
+// of the index. HMAC and encrypted sessions aren't supported: auth travels in
+// clear on the bus.
+func SetBits(tpm transport.TPM, idx *Index, bits uint64, auth []byte) error {
+	tpm = idx.logged(tpm, "nv set bits")
+	params := binary.BigEndian.AppendUint64(nil, bits)
+	if err := execute(tpm, tpm2.TPMCCNVSetBits, idx, auth, params); err != nil {
+		return fmt.Errorf("failed to set bits: %w", tpmerrors.Wrap(err))
+	}
+	return idx.Refresh(tpm)
+}
+
+// ReadBits returns the current value of the bit field.
+func ReadBits(tpm transport.TPM, idx *Index, auth tpm2.Session) (uint64, error) {
+	tpm = idx.logged(tpm, "nv read")
+	rsp, err := tpm2.NVRead{
+		AuthHandle: idx.AuthHandle(auth),
+		NVIndex:    idx.NamedHandle(),
+		Size:       8,
+	}.Execute(tpm)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read bits: %w", tpmerrors.Wrap(err))
+	}
+	return binary.BigEndian.Uint64(rsp.Data.Buffer), nil
+}
+
+// BitsSetPolicy returns a PolicyNV assertion satisfied only while all the
+// bits of mask are set in the field.
+//
+// As for [CounterPolicy], the index name is captured now: call it after the
+// first [SetBits].
+//
+// Example:
+//
+//	// Secret usable once the device is provisioned, until it is decommissioned.
+//	calc, _ := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+//	nv.BitsSetPolicy(state, auth, provisioned).Update(calc)
+//	nv.BitsClearPolicy(state, auth, decommissioned).Update(calc)
+//	// seal with calc.Hash().Digest as AuthPolicy, then satisfy both
+//	// assertions, in the same order, in the policy session of TPM2_Unseal.
+func BitsSetPolicy(idx *Index, auth tpm2.Session, mask uint64) tpm2.PolicyNV {
+	return bitsPolicy(idx, auth, mask, tpm2.TPMEOBitSet)
+}
+
+// BitsClearPolicy returns a PolicyNV assertion satisfied only while all the
+// bits of mask are clear in the field. Setting one of them revokes the
+// objects bound to it for good.
+func BitsClearPolicy(idx *Index, auth tpm2.Session, mask uint64) tpm2.PolicyNV {
+	return bitsPolicy(idx, auth, mask, tpm2.TPMEOBitClear)
+}
+
+func bitsPolicy(idx *Index, auth tpm2.Session, mask uint64, op tpm2.TPMEO) tpm2.PolicyNV {
+	return tpm2.PolicyNV{
+		AuthHandle: idx.AuthHandle(auth),
+		NVIndex:    idx.NamedHandle(),
+		OperandB:   tpm2.TPM2BOperand{Buffer: binary.BigEndian.AppendUint64(nil, mask)},
+		Operation:  op,
+	}
+}
@@ -0,0 +1,125 @@
+package nv_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+const stateIndex = tpm2.TPMHandle(0x01500011)
+
+// Lifecycle bits of the state index.
+const (
+	stateProvisioned    uint64 = 1 << 0
+	stateDebug          uint64 = 1 << 1
+	stateDecommissioned uint64 = 1 << 63
+)
+
+func TestBits(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("state-password")
+
+	state, err := nv.DefineBits(thetpm, stateIndex, auth)
+	require.NoError(t, err)
+	defer nv.Undefine(thetpm, state)
+
+	// Like counters, bit fields are unreadable until their first write.
+	_, err = nv.ReadBits(thetpm, state, tpm2.PasswordAuth(auth))
+	require.Error(t, err)
+
+	require.NoError(t, nv.SetBits(thetpm, state, 0, auth))
+	bits, err := nv.ReadBits(thetpm, state, tpm2.PasswordAuth(auth))
+	require.NoError(t, err)
+	require.Zero(t, bits)
+
+	// Bits accumulate.
+	require.NoError(t, nv.SetBits(thetpm, state, stateProvisioned, auth))
+	require.NoError(t, nv.SetBits(thetpm, state, stateDebug, auth))
+	bits, err = nv.ReadBits(thetpm, state, tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Auth(auth)))
+	require.NoError(t, err)
+	require.Equal(t, stateProvisioned|stateDebug, bits)
+
+	require.ErrorIs(t, nv.SetBits(thetpm, state, stateDecommissioned, []byte("wrong")), tpm2.TPMRCBadAuth)
+}
+
+// TestLifecycleSealing seals a secret which can only be unsealed once the
+// device is provisioned and until it is decommissioned.
+func TestLifecycleSealing(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("state-password")
+
+	state, err := nv.DefineBits(thetpm, stateIndex, auth)
+	require.NoError(t, err)
+	defer nv.Undefine(thetpm, state)
+	require.NoError(t, nv.SetBits(thetpm, state, 0, auth))
+
+	assertions := func() []tpm2.PolicyNV {
+		return []tpm2.PolicyNV{
+			nv.BitsSetPolicy(state, tpm2.PasswordAuth(auth), stateProvisioned),
+			nv.BitsClearPolicy(state, tpm2.PasswordAuth(auth), stateDecommissioned),
+		}
+	}
+	calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+	require.NoError(t, err)
+	for _, cmd := range assertions() {
+		require.NoError(t, cmd.Update(calc))
+	}
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	secret := []byte("usable during the operational life of the device")
+	sealed, err := tpmutil.Create(thetpm, tpmutil.CreateConfig{
+		ParentHandle: srk,
+		InPublic:     templates.Seal(templates.WithPolicy(calc.Hash().Digest)),
+		SealingData:  secret,
+	})
+	require.NoError(t, err)
+	defer sealed.Close()
+
+	unseal := func() ([]byte, error) {
+		policy := func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+			for _, cmd := range assertions() {
+				cmd.PolicySession = handle
+				if _, err := cmd.Execute(tpm); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		rsp, err := tpm2.Unseal{
+			ItemHandle: tpmutil.ToAuthHandle(sealed, tpm2.Policy(tpm2.TPMAlgSHA256, 16, policy)),
+		}.Execute(thetpm)
+		if err != nil {
+			return nil, err
+		}
+		return rsp.OutData.Buffer, nil
+	}
+
+	// Not provisioned yet.
+	_, err = unseal()
+	require.ErrorIs(t, err, tpm2.TPMRCPolicy)
+
+	require.NoError(t, nv.SetBits(thetpm, state, stateProvisioned, auth))
+	got, err := unseal()
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+
+	// Unrelated bits don't matter.
+	require.NoError(t, nv.SetBits(thetpm, state, stateDebug, auth))
+	got, err = unseal()
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+
+	// Decommissioning revokes the secret for good.
+	require.NoError(t, nv.SetBits(thetpm, state, stateDecommissioned, auth))
+	_, err = unseal()
+	require.ErrorIs(t, err, tpm2.TPMRCPolicy)
+}
@@ -0,0 +1,202 @@
+package nv
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+)
+
+// WellKnown is an NV index, or a range of NV indexes, whose use is assigned
+// by the TCG: the EK Credential Profile, the PC Client Platform Certificate
+// Profile and the Registry of Reserved TPM 2.0 Handles and Localities.
+type WellKnown struct {
+	// Name identifies the entry, e.g. "ek-cert-rsa2048".
+	Name string `json:"name"`
+	// Description describes the content of the indexes.
+	Description string `json:"description"`
+	// First and Last are the first and last handles of the range, equal for
+	// a single index.
+	First tpm2.TPMHandle `json:"first"`
+	Last  tpm2.TPMHandle `json:"last"`
+}
+
+// Contains reports whether handle belongs to w.
+func (w WellKnown) Contains(handle tpm2.TPMHandle) bool {
+	return handle >= w.First && handle <= w.Last
+}
+
+// catalog lists the single indexes before the ranges holding them, so that
+// the first match is the most specific one.
+var catalog = []WellKnown{
+	single(0x01C00002, "ek-cert-rsa2048", "RSA 2048 EK certificate"),
+	single(0x01C00003, "ek-nonce-rsa2048", "RSA 2048 EK nonce"),
+	single(0x01C00004, "ek-template-rsa2048", "RSA 2048 EK template"),
+	single(0x01C0000A, "ek-cert-eccp256", "ECC NIST P-256 EK certificate"),
+	single(0x01C0000B, "ek-nonce-eccp256", "ECC NIST P-256 EK nonce"),
+	single(0x01C0000C, "ek-template-eccp256", "ECC NIST P-256 EK template"),
+	single(0x01C00012, "ek-cert-rsa2048-h", "RSA 2048 EK certificate, high range"),
+	single(0x01C00014, "ek-cert-eccp256-h", "ECC NIST P-256 EK certificate, high range"),
+	single(0x01C00016, "ek-cert-eccp384-h", "ECC NIST P-384 EK certificate, high range"),
+	single(0x01C00018, "ek-cert-eccp521-h", "ECC NIST P-521 EK certificate, high range"),
+	single(0x01C0001A, "ek-cert-sm2-h", "ECC SM2 P-256 EK certificate, high range"),
+	single(0x01C0001C, "ek-cert-rsa3072-h", "RSA 3072 EK certificate, high range"),
+	single(0x01C0001E, "ek-cert-rsa4096-h", "RSA 4096 EK certificate, high range"),
+	rng(0x01C00100, 0x01C001FF, "ek-cert-chain", "EK certificate chain"),
+	rng(0x01000000, 0x013FFFFF, "owner", "range of the TPM owner"),
+	rng(0x01400000, 0x017FFFFF, "platform", "range of the platform"),
+	rng(0x01800000, 0x01BFFFFF, "owner", "range of the TPM owner"),
+	rng(0x01C00000, 0x01C07FFF, "endorsement-cert", "range of the EK certificates of the TPM manufacturer"),
+	rng(0x01C08000, 0x01C0FFFF, "platform-cert", "range of the platform certificates of the platform manufacturer"),
+	rng(0x01C10000, 0x01C1FFFF, "component-oem", "range of the component OEMs"),
+	rng(0x01C20000, 0x01C2FFFF, "tpm-oem", "range of the TPM OEM"),
+	rng(0x01C30000, 0x01C3FFFF, "platform-oem", "range of the platform OEM"),
+	rng(0x01C40000, 0x01C4FFFF, "pc-client", "range of the TCG PC Client work group"),
+	rng(0x01C50000, 0x01C5FFFF, "server", "range of the TCG Server work group"),
+	rng(0x01C60000, 0x01C6FFFF, "virtualized-platform", "range of the TCG Virtualized Platform work group"),
+	rng(0x01C70000, 0x01C7FFFF, "mpwg", "range of the TCG Mobile Platform work group"),
+	rng(0x01C80000, 0x01C8FFFF, "embedded", "range of the TCG Embedded Systems work group"),
+}
+
+func single(handle tpm2.TPMHandle, name, description string) WellKnown {
+	return rng(handle, handle, name, description)
+}
+
+func rng(first, last tpm2.TPMHandle, name, description string) WellKnown {
+	return WellKnown{Name: name, Description: description, First: first, Last: last}
+}
+
+// Catalog returns the well-known indexes and ranges, the single indexes
+// first.
+func Catalog() []WellKnown {
+	return append([]WellKnown(nil), catalog...)
+}
+
+// Lookup returns the most specific well-known entry containing handle.
+func Lookup(handle tpm2.TPMHandle) (WellKnown, bool) {
+	for _, w := range catalog {
+		if w.Contains(handle) {
+			return w, true
+		}
+	}
+	return WellKnown{}, false
+}
+
+// Description is the decoded public area of an NV index (see [Describe]).
+type Description struct {
+	Handle tpm2.TPMHandle `json:"handle"`
+	Name   []byte         `json:"name"`
+	// Type is the index type: "ordinary", "counter", "bits", "extend",
+	// "pin-fail" or "pin-pass".
+	Type string `json:"type"`
+	// NameAlg is the name algorithm of the index.
+	NameAlg tpmjson.AlgID `json:"name_alg"`
+	// Size is the size of the data area in bytes.
+	Size uint16 `json:"size"`
+	// Attributes are the TPMA_NV attributes which are set (see
+	// [AttributeNames]).
+	Attributes []string `json:"attributes"`
+	// AuthPolicy is the policy digest of the index, if any.
+	AuthPolicy []byte `json:"auth_policy,omitempty"`
+	// WellKnown is the catalog entry of the index, if any (see [Lookup]).
+	WellKnown *WellKnown `json:"well_known,omitempty"`
+}
+
+// String returns d on a single line, e.g.
+// "0x01c00002 ordinary 1024 bytes ppwrite|ppread|... (RSA 2048 EK
+// certificate)".
+func (d *Description) String() string {
+	s := fmt.Sprintf("0x%08x %s %d bytes %s", uint32(d.Handle), d.Type, d.Size, strings.Join(d.Attributes, "|"))
+	if d.WellKnown != nil {
+		s += " (" + d.WellKnown.Description + ")"
+	}
+	return s
+}
+
+// Describe reads the public area of the index defined at handle and decodes
+// it, e.g. to list the indexes of a TPM or to check the attributes of an
+// index before trusting its content.
+func Describe(tpm transport.TPM, handle tpm2.TPMHandle) (*Description, error) {
+	rsp, err := tpm2.NVReadPublic{NVIndex: handle}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NV public: %w", err)
+	}
+	pub, err := rsp.NVPublic.Contents()
+	if err != nil {
+		return nil, err
+	}
+	d := &Description{
+		Handle:     handle,
+		Name:       rsp.NVName.Buffer,
+		Type:       TypeName(pub.Attributes.NT),
+		NameAlg:    tpmjson.AlgID(pub.NameAlg),
+		Size:       pub.DataSize,
+		Attributes: AttributeNames(pub.Attributes),
+		AuthPolicy: pub.AuthPolicy.Buffer,
+	}
+	if w, ok := Lookup(handle); ok {
+		d.WellKnown = &w
+	}
+	return d, nil
+}
+
+// TypeName returns the name of the index type nt.
+func TypeName(nt tpm2.TPMNT) string {
+	switch nt {
+	case tpm2.TPMNTOrdinary:
+		return "ordinary"
+	case tpm2.TPMNTCounter:
+		return "counter"
+	case tpm2.TPMNTBits:
+		return "bits"
+	case tpm2.TPMNTExtend:
+		return "extend"
+	case tpm2.TPMNTPinFail:
+		return "pin-fail"
+	case tpm2.TPMNTPinPass:
+		return "pin-pass"
+	default:
+		return fmt.Sprintf("unknown-0x%x", uint8(nt))
+	}
+}
+
+// AttributeNames returns the names of the attributes set in attrs, in the
+// order of their bits, named after the TPMA_NV_ constants of the
+// specification in lower case as tpm2-tools does, e.g. "ownerwrite" or
+// "no_da". The index type is left out (see [TypeName]).
+func AttributeNames(attrs tpm2.TPMANV) []string {
+	names := []string{}
+	for _, a := range []struct {
+		set  bool
+		name string
+	}{
+		{attrs.PPWrite, "ppwrite"},
+		{attrs.OwnerWrite, "ownerwrite"},
+		{attrs.AuthWrite, "authwrite"},
+		{attrs.PolicyWrite, "policywrite"},
+		{attrs.PolicyDelete, "policy_delete"},
+		{attrs.WriteLocked, "writelocked"},
+		{attrs.WriteAll, "writeall"},
+		{attrs.WriteDefine, "writedefine"},
+		{attrs.WriteSTClear, "write_stclear"},
+		{attrs.GlobalLock, "globallock"},
+		{attrs.PPRead, "ppread"},
+		{attrs.OwnerRead, "ownerread"},
+		{attrs.AuthRead, "authread"},
+		{attrs.PolicyRead, "policyread"},
+		{attrs.NoDA, "no_da"},
+		{attrs.Orderly, "orderly"},
+		{attrs.ClearSTClear, "clear_stclear"},
+		{attrs.ReadLocked, "readlocked"},
+		{attrs.Written, "written"},
+		{attrs.PlatformCreate, "platformcreate"},
+		{attrs.ReadSTClear, "read_stclear"},
+	} {
+		if a.set {
+			names = append(names, a.name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,84 @@
+package nv_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	for _, tc := range []struct {
+		handle tpm2.TPMHandle
+		name   string
+	}{
+		{0x01C00002, "ek-cert-rsa2048"},
+		{0x01C0000A, "ek-cert-eccp256"},
+		{0x01C0001E, "ek-cert-rsa4096-h"},
+		{0x01C00105, "ek-cert-chain"},
+		{0x01C00020, "endorsement-cert"},
+		{0x01C08000, "platform-cert"},
+		{0x01000001, "owner"},
+		{0x01500001, "platform"},
+		{0x01800000, "owner"},
+		{0x01C40001, "pc-client"},
+	} {
+		w, ok := nv.Lookup(tc.handle)
+		require.True(t, ok, "0x%x", tc.handle)
+		require.Equal(t, tc.name, w.Name, "0x%x", tc.handle)
+	}
+
+	_, ok := nv.Lookup(0x01C90000)
+	require.False(t, ok)
+}
+
+func TestCatalog(t *testing.T) {
+	for _, w := range nv.Catalog() {
+		require.LessOrEqual(t, w.First, w.Last, w.Name)
+		require.Equal(t, tpm2.TPMHandle(tpm2.TPMHTNVIndex), w.First>>24, w.Name)
+		require.Equal(t, tpm2.TPMHandle(tpm2.TPMHTNVIndex), w.Last>>24, w.Name)
+	}
+}
+
+func TestAttributeNames(t *testing.T) {
+	require.Empty(t, nv.AttributeNames(tpm2.TPMANV{}))
+	require.Equal(t,
+		[]string{"ppwrite", "writedefine", "ppread", "ownerread", "authread", "no_da", "written", "platformcreate"},
+		nv.AttributeNames(tpm2.TPMANV{
+			PPWrite:        true,
+			WriteDefine:    true,
+			PPRead:         true,
+			OwnerRead:      true,
+			AuthRead:       true,
+			NoDA:           true,
+			Written:        true,
+			PlatformCreate: true,
+			NT:             tpm2.TPMNTCounter,
+		}))
+}
+
+func TestDescribe(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	idx, err := nv.Define(thetpm, nv.DefineConfig{
+		Index:      0x01000010,
+		Attributes: nv.CounterAttributes,
+	})
+	require.NoError(t, err)
+
+	d, err := nv.Describe(thetpm, idx.Handle)
+	require.NoError(t, err)
+	require.Equal(t, idx.Handle, d.Handle)
+	require.Equal(t, idx.Name.Buffer, d.Name)
+	require.Equal(t, "counter", d.Type)
+	require.Equal(t, "sha256", d.NameAlg.String())
+	require.Equal(t, uint16(8), d.Size)
+	require.NotContains(t, d.Attributes, "written")
+	require.NotNil(t, d.WellKnown)
+	require.Equal(t, "owner", d.WellKnown.Name)
+
+	_, err = nv.Describe(thetpm, 0x01000011)
+	require.ErrorIs(t, err, tpm2.TPMRCHandle)
+}
@@ -0,0 +1,166 @@
+package nv
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+)
+
+// ErrCertificationMismatch is returned when a signed NV certification doesn't
+// match the expected index, nonce or contents.
+var ErrCertificationMismatch = errors.New("NV certification mismatch")
+
+// Certification is a signed TPMS_ATTEST of type TPM_ST_ATTEST_NV.
+type Certification struct {
+	// Attest is the marshaled TPMS_ATTEST.
+	Attest []byte `json:"attest"`
+	// Signature is the marshaled TPMT_SIGNATURE over Attest.
+	Signature []byte `json:"signature"`
+}
+
+// CertifyConfig holds configuration for [Certify] and [CertifyRegister].
+type CertifyConfig struct {
+	// Nonce is the qualifying data of the verifier, proving the freshness of
+	// the certification.
+	//
+	// Default: nil.
+	Nonce []byte
+	// IndexAuth authorizes the read of the index.
+	//
+	// Default: [tpmutil.NoAuth].
+	IndexAuth tpm2.Session
+	// SignerAuth authorizes the signing key.
+	//
+	// Default: [tpmutil.NoAuth].
+	SignerAuth tpm2.Session
+}
+
+// CheckAndSetDefault validates and sets default values for CertifyConfig.
+func (c *CertifyConfig) CheckAndSetDefault() error {
+	if c.IndexAuth == nil {
+		c.IndexAuth = tpmutil.NoAuth
+	}
+	if c.SignerAuth == nil {
+		c.SignerAuth = tpmutil.NoAuth
+	}
+	return nil
+}
+
+// Certify returns size bytes of idx from offset, signed by signer (e.g. an
+// AK) along with cfg.Nonce (TPM2_NV_Certify). Remote parties can then trust
+// data stored in NV, such as configuration or provisioning records, without
+// reading it over a trusted channel (see [Verify]).
+//
+// The size is limited by the maximum digest size of the TPM (TPM2B_DATA).
+//
+// Example:
+//
+//	c, err := nv.Certify(tpm, ak, idx, 0, 32, nv.CertifyConfig{
+//	    Nonce:     nonce,
+//	    IndexAuth: tpm2.PasswordAuth(auth),
+//	})
+//	// verifier side:
+//	info, err := nv.Verify(akPub, nonce, idxName, c)
+//	config := info.NVContents.Buffer
+func Certify(tpm transport.TPM, signer tpmutil.Handle, idx *Index, offset, size uint16, optionalCfg ...CertifyConfig) (*Certification, error) {
+	var cfg CertifyConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if signer == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+	tpm = idx.logged(tpm, "nv certify")
+	rsp, err := tpm2.NVCertify{
+		SignHandle:     tpmutil.ToAuthHandle(signer, cfg.SignerAuth),
+		AuthHandle:     idx.AuthHandle(cfg.IndexAuth),
+		NVIndex:        idx.NamedHandle(),
+		QualifyingData: tpm2.TPM2BData{Buffer: cfg.Nonce},
+		InScheme:       tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		Size:           size,
+		Offset:         offset,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to certify NV index: %w", tpmerrors.Wrap(err))
+	}
+	attest, err := rsp.CertifyInfo.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attestation: %w", err)
+	}
+	return &Certification{
+		Attest:    tpm2.Marshal(attest),
+		Signature: tpm2.Marshal(rsp.Signature),
+	}, nil
+}
+
+// Verify checks that c is a TPM generated certification of the index named
+// indexName, signed by signerPub along with nonce, and returns the certified
+// offset and contents.
+//
+// The Name of an index covers its attributes and policy: verifiers holding
+// its expected public area compute it with names.ComputeNV.
+func Verify(signerPub *tpm2.TPMTPublic, nonce []byte, indexName tpm2.TPM2BName, c *Certification) (*tpm2.TPMSNVCertifyInfo, error) {
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](c.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %w", err)
+	}
+	if err := tpmcrypto.VerifySignatureFromPublic(*signerPub, *sig, c.Attest); err != nil {
+		return nil, fmt.Errorf("invalid NV certification signature: %w", err)
+	}
+	attest, err := tpm2.Unmarshal[tpm2.TPMSAttest](c.Attest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attestation: %w", err)
+	}
+	if attest.Magic != tpm2.TPMGeneratedValue || attest.Type != tpm2.TPMSTAttestNV {
+		return nil, fmt.Errorf("%w: not a TPM generated NV certification", ErrCertificationMismatch)
+	}
+	if subtle.ConstantTimeCompare(attest.ExtraData.Buffer, nonce) != 1 {
+		return nil, fmt.Errorf("%w: nonce", ErrCertificationMismatch)
+	}
+	info, err := attest.Attested.NV()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NV certify info: %w", err)
+	}
+	if !bytes.Equal(info.IndexName.Buffer, indexName.Buffer) {
+		return nil, fmt.Errorf("%w: index name", ErrCertificationMismatch)
+	}
+	return info, nil
+}
+
+// CertifyRegister returns the value of a register created by [DefineExtend],
+// certified by signer (see [Certify]).
+//
+// Example:
+//
+//	c, err := nv.CertifyRegister(tpm, ak, register, nv.CertifyConfig{
+//	    Nonce:     nonce,
+//	    IndexAuth: tpm2.PasswordAuth(auth),
+//	})
+//	// verifier side:
+//	err = nv.VerifyRegister(akPub, nonce, registerName, c, nv.Replay(eventLog...))
+func CertifyRegister(tpm transport.TPM, signer tpmutil.Handle, idx *Index, optionalCfg ...CertifyConfig) (*Certification, error) {
+	return Certify(tpm, signer, idx, 0, RegisterSize, optionalCfg...)
+}
+
+// VerifyRegister checks that c is signed by signerPub, carries nonce and
+// reports the value expected for the register named indexName.
+func VerifyRegister(signerPub *tpm2.TPMTPublic, nonce []byte, indexName tpm2.TPM2BName, c *Certification, expected []byte) error {
+	info, err := Verify(signerPub, nonce, indexName, c)
+	if err != nil {
+		return err
+	}
+	if info.Offset != 0 || !bytes.Equal(info.NVContents.Buffer, expected) {
+		return fmt.Errorf("%w: register value %x, expected %x", ErrCertificationMismatch, info.NVContents.Buffer, expected)
+	}
+	return nil
+}
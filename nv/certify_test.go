@@ -0,0 +1,62 @@
+package nv_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertify(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("config-password")
+
+	idx, err := nv.Define(thetpm, nv.DefineConfig{Index: 0x01500013, Size: 64, Auth: auth})
+	require.NoError(t, err)
+	defer nv.Undefine(thetpm, idx)
+	config := []byte(`{"server":"https://updates.example.com","channel":"stable"}`)
+	require.NoError(t, nv.Write(thetpm, idx, config, tpm2.PasswordAuth(auth)))
+
+	ak, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: attestation.AKTemplate})
+	require.NoError(t, err)
+	defer ak.Close()
+
+	// The verifier derives the expected name from the public area it
+	// provisioned, rather than trusting the device.
+	pub, err := nv.ReadPublic(thetpm, idx.Handle)
+	require.NoError(t, err)
+	name, err := tpm2.NVName(pub)
+	require.NoError(t, err)
+
+	nonce := []byte("verifier nonce")
+	c, err := nv.Certify(thetpm, ak, idx, 10, 33, nv.CertifyConfig{
+		Nonce:     nonce,
+		IndexAuth: tpm2.PasswordAuth(auth),
+	})
+	require.NoError(t, err)
+
+	info, err := nv.Verify(ak.Public(), nonce, *name, c)
+	require.NoError(t, err)
+	require.Equal(t, uint16(10), info.Offset)
+	require.Equal(t, config[10:43], info.NVContents.Buffer)
+
+	_, err = nv.Verify(ak.Public(), []byte("other nonce"), *name, c)
+	require.ErrorIs(t, err, nv.ErrCertificationMismatch)
+
+	// The name changes with the attributes, e.g. when the index is rewritten
+	// with other attributes under the same handle.
+	other := *pub
+	other.Attributes.PolicyWrite = true
+	otherName, err := tpm2.NVName(&other)
+	require.NoError(t, err)
+	_, err = nv.Verify(ak.Public(), nonce, *otherName, c)
+	require.ErrorIs(t, err, nv.ErrCertificationMismatch)
+
+	// Outside of the data area.
+	_, err = nv.Certify(thetpm, ak, idx, 0, 64+1, nv.CertifyConfig{IndexAuth: tpm2.PasswordAuth(auth)})
+	require.Error(t, err)
+}
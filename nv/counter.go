@@ -0,0 +1,83 @@
+package nv
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+)
+
+// CounterAttributes are the attributes used by [DefineCounter]: a counter
+// incremented and read with its own authorization value, also readable by
+// the owner.
+var CounterAttributes = tpm2.TPMANV{
+	NT:        tpm2.TPMNTCounter,
+	AuthWrite: true,
+	AuthRead:  true,
+	OwnerRead: true,
+	NoDA:      true,
+}
+
+// DefineCounter creates a monotonic counter index protected by auth.
+//
+// A counter can't be read before it is incremented once. On creation the
+// TPM initializes it to the highest value any counter ever had, so a counter
+// can't be rolled back by deleting and redefining it.
+func DefineCounter(tpm transport.TPM, index tpm2.TPMHandle, auth []byte) (*Index, error) {
+	return Define(tpm, DefineConfig{
+		Index:      index,
+		Attributes: CounterAttributes,
+		Auth:       auth,
+	})
+}
+
+// Increment adds one to the counter and refreshes the index name.
+func Increment(tpm transport.TPM, idx *Index, auth tpm2.Session) error {
+	tpm = idx.logged(tpm, "nv increment")
+	_, err := tpm2.NVIncrement{
+		AuthHandle: idx.AuthHandle(auth),
+		NVIndex:    idx.NamedHandle(),
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to increment counter: %w", tpmerrors.Wrap(err))
+	}
+	return idx.Refresh(tpm)
+}
+
+// ReadCounter returns the current value of the counter.
+func ReadCounter(tpm transport.TPM, idx *Index, auth tpm2.Session) (uint64, error) {
+	tpm = idx.logged(tpm, "nv read")
+	rsp, err := tpm2.NVRead{
+		AuthHandle: idx.AuthHandle(auth),
+		NVIndex:    idx.NamedHandle(),
+		Size:       8,
+	}.Execute(tpm)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read counter: %w", tpmerrors.Wrap(err))
+	}
+	return binary.BigEndian.Uint64(rsp.Data.Buffer), nil
+}
+
+// CounterOperand encodes value as the operand of a PolicyNV comparison
+// against a counter.
+func CounterOperand(value uint64) tpm2.TPM2BOperand {
+	return tpm2.TPM2BOperand{Buffer: binary.BigEndian.AppendUint64(nil, value)}
+}
+
+// CounterPolicy returns a PolicyNV assertion satisfied only while the counter
+// equals value. Binding a sealed object to it makes the object unusable once
+// the counter is incremented, which protects against the replay of stale data.
+//
+// The index name is captured now: call it after the first [Increment].
+// The returned command is used either to compute a policy digest
+// (PolicyNV.Update) or, once PolicySession is set, to satisfy the policy.
+func CounterPolicy(idx *Index, auth tpm2.Session, value uint64) tpm2.PolicyNV {
+	return tpm2.PolicyNV{
+		AuthHandle: idx.AuthHandle(auth),
+		NVIndex:    idx.NamedHandle(),
+		OperandB:   CounterOperand(value),
+		Operation:  tpm2.TPMEOEq,
+	}
+}
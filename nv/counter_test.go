@@ -0,0 +1,96 @@
+package nv_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+const counterIndex = tpm2.TPMHandle(0x01500010)
+
+func TestCounter(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("counter-password")
+
+	counter, err := nv.DefineCounter(thetpm, counterIndex, auth)
+	require.NoError(t, err)
+	defer nv.Undefine(thetpm, counter)
+
+	// A counter is unreadable until its first increment.
+	_, err = nv.ReadCounter(thetpm, counter, tpm2.PasswordAuth(auth))
+	require.Error(t, err)
+
+	require.NoError(t, nv.Increment(thetpm, counter, tpm2.PasswordAuth(auth)))
+	first, err := nv.ReadCounter(thetpm, counter, tpm2.PasswordAuth(auth))
+	require.NoError(t, err)
+
+	// HMAC sessions depend on the refreshed index name.
+	require.NoError(t, nv.Increment(thetpm, counter, tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Auth(auth))))
+	second, err := nv.ReadCounter(thetpm, counter, tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Auth(auth)))
+	require.NoError(t, err)
+	require.Equal(t, first+1, second)
+
+	require.Error(t, nv.Increment(thetpm, counter, tpm2.PasswordAuth([]byte("wrong"))))
+}
+
+// TestRollbackProtection seals a secret which can only be unsealed while the
+// counter holds the value it had at sealing time.
+func TestRollbackProtection(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("counter-password")
+
+	counter, err := nv.DefineCounter(thetpm, counterIndex, auth)
+	require.NoError(t, err)
+	defer nv.Undefine(thetpm, counter)
+	require.NoError(t, nv.Increment(thetpm, counter, tpm2.PasswordAuth(auth)))
+	value, err := nv.ReadCounter(thetpm, counter, tpm2.PasswordAuth(auth))
+	require.NoError(t, err)
+
+	calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+	require.NoError(t, err)
+	require.NoError(t, nv.CounterPolicy(counter, tpm2.PasswordAuth(auth), value).Update(calc))
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	secret := []byte("data valid for this counter value only")
+	sealed, err := tpmutil.Create(thetpm, tpmutil.CreateConfig{
+		ParentHandle: srk,
+		InPublic:     templates.Seal(templates.WithPolicy(calc.Hash().Digest)),
+		SealingData:  secret,
+	})
+	require.NoError(t, err)
+	defer sealed.Close()
+
+	unseal := func() ([]byte, error) {
+		policy := func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+			cmd := nv.CounterPolicy(counter, tpm2.PasswordAuth(auth), value)
+			cmd.PolicySession = handle
+			_, err := cmd.Execute(tpm)
+			return err
+		}
+		rsp, err := tpm2.Unseal{
+			ItemHandle: tpmutil.ToAuthHandle(sealed, tpm2.Policy(tpm2.TPMAlgSHA256, 16, policy)),
+		}.Execute(thetpm)
+		if err != nil {
+			return nil, err
+		}
+		return rsp.OutData.Buffer, nil
+	}
+
+	got, err := unseal()
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+
+	// Moving the counter forward revokes the sealed data.
+	require.NoError(t, nv.Increment(thetpm, counter, tpm2.PasswordAuth(auth)))
+	_, err = unseal()
+	require.Error(t, err)
+}
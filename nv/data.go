@@ -0,0 +1,116 @@
+package nv
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/capability"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+)
+
+// MaxBufferSize returns the largest amount of data accepted by a single
+// TPM2_NV_Read or TPM2_NV_Write (TPM_PT_NV_BUFFER_MAX).
+func MaxBufferSize(tpm transport.TPM) (uint16, error) {
+	v, err := capability.Property(tpm, tpm2.TPMPTNVBufferMax)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get NV buffer size: %w", err)
+	}
+	return uint16(v), nil
+}
+
+// Write stores data at the beginning of an ordinary index, splitting it in
+// as many TPM2_NV_Write calls as required, and refreshes the index name.
+func Write(tpm transport.TPM, idx *Index, data []byte, auth tpm2.Session) error {
+	return WriteAt(tpm, idx, data, 0, auth)
+}
+
+// WriteAt stores data at offset in an ordinary index, splitting it in as many
+// TPM2_NV_Write calls as required, and refreshes the index name.
+//
+// Note: indexes with TPMA_NV_WRITEALL only accept a single write of their
+// whole size, which must fit in [MaxBufferSize].
+func WriteAt(tpm transport.TPM, idx *Index, data []byte, offset uint16, auth tpm2.Session) error {
+	tpm = idx.logged(tpm, "nv write")
+	if err := checkBounds(tpm, idx, offset, len(data)); err != nil {
+		return err
+	}
+	chunk, err := MaxBufferSize(tpm)
+	if err != nil {
+		return err
+	}
+	for written := 0; written < len(data); {
+		n := min(int(chunk), len(data)-written)
+		_, err := tpm2.NVWrite{
+			AuthHandle: idx.AuthHandle(auth),
+			NVIndex:    idx.NamedHandle(),
+			Data:       tpm2.TPM2BMaxNVBuffer{Buffer: data[written : written+n]},
+			Offset:     offset + uint16(written),
+		}.Execute(tpm)
+		if err != nil {
+			return fmt.Errorf("failed to write NV index at offset %d: %w", int(offset)+written, tpmerrors.Wrap(err))
+		}
+		if written == 0 {
+			// The first write sets TPMA_NV_WRITTEN, which changes the name.
+			if err := idx.Refresh(tpm); err != nil {
+				return err
+			}
+		}
+		written += n
+	}
+	return nil
+}
+
+// Read returns the whole data area of an index, splitting the read in as many
+// TPM2_NV_Read calls as required.
+func Read(tpm transport.TPM, idx *Index, auth tpm2.Session) ([]byte, error) {
+	tpm = idx.logged(tpm, "nv read")
+	pub, err := ReadPublic(tpm, idx.Handle)
+	if err != nil {
+		return nil, err
+	}
+	return readAt(tpm, idx, 0, pub.DataSize, auth)
+}
+
+// ReadAt returns size bytes of an index starting at offset, splitting the read
+// in as many TPM2_NV_Read calls as required.
+func ReadAt(tpm transport.TPM, idx *Index, offset, size uint16, auth tpm2.Session) ([]byte, error) {
+	return readAt(idx.logged(tpm, "nv read"), idx, offset, size, auth)
+}
+
+func readAt(tpm transport.TPM, idx *Index, offset, size uint16, auth tpm2.Session) ([]byte, error) {
+	if err := checkBounds(tpm, idx, offset, int(size)); err != nil {
+		return nil, err
+	}
+	chunk, err := MaxBufferSize(tpm)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, size)
+	for len(data) < int(size) {
+		n := min(chunk, size-uint16(len(data)))
+		rsp, err := tpm2.NVRead{
+			AuthHandle: idx.AuthHandle(auth),
+			NVIndex:    idx.NamedHandle(),
+			Size:       n,
+			Offset:     offset + uint16(len(data)),
+		}.Execute(tpm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read NV index at offset %d: %w", int(offset)+len(data), tpmerrors.Wrap(err))
+		}
+		data = append(data, rsp.Data.Buffer...)
+	}
+	return data, nil
+}
+
+// checkBounds ensures [offset, offset+size) fits in the data area of idx.
+func checkBounds(tpm transport.TPM, idx *Index, offset uint16, size int) error {
+	pub, err := ReadPublic(tpm, idx.Handle)
+	if err != nil {
+		return err
+	}
+	if int(offset)+size > int(pub.DataSize) {
+		return fmt.Errorf("%d bytes at offset %d exceed the %d bytes of NV index 0x%x", size, offset, pub.DataSize, idx.Handle)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package nv
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+)
+
+// ExtendAttributes are the attributes used by [DefineExtend]: an extend
+// index written and read with its own authorization value, also readable by
+// the owner.
+var ExtendAttributes = tpm2.TPMANV{
+	NT:        tpm2.TPMNTExtend,
+	AuthWrite: true,
+	AuthRead:  true,
+	OwnerRead: true,
+	NoDA:      true,
+}
+
+// RegisterSize is the size of the registers created by [DefineExtend]: the
+// digest size of their SHA-256 name algorithm.
+const RegisterSize = sha256.Size
+
+// DefineExtend creates an extend index protected by auth: a software-defined
+// measurement register behaving like a SHA-256 PCR. It starts at zero and can
+// only be extended (see [Extend]), so its value commits to the whole sequence
+// of measurements.
+//
+// Unlike a PCR, the register isn't reset on TPM2_Startup and survives until it
+// is undefined. Read it with [Read] (after the first [Extend]) and certify it
+// with [CertifyRegister].
+func DefineExtend(tpm transport.TPM, index tpm2.TPMHandle, auth []byte) (*Index, error) {
+	return Define(tpm, DefineConfig{
+		Index:      index,
+		Attributes: ExtendAttributes,
+		Size:       RegisterSize,
+		Auth:       auth,
+	})
+}
+
+// Extend measures data in the register: value = SHA-256(value || data). The
+// index name is refreshed.
+//
+// go-tpm doesn't implement TPM2_NV_Extend: it is marshaled here and authorized
+// with a password session carrying auth, the authorization value of the index.
+// HMAC and encrypted sessions aren't supported: auth and data travel in clear
+// on the bus.
+func Extend(tpm transport.TPM, idx *Index, data []byte, auth []byte) error {
+	tpm = idx.logged(tpm, "nv extend")
+	params := binary.BigEndian.AppendUint16(nil, uint16(len(data)))
+	params = append(params, data...)
+	if err := execute(tpm, tpm2.TPMCCNVExtend, idx, auth, params); err != nil {
+		return fmt.Errorf("failed to extend NV index: %w", tpmerrors.Wrap(err))
+	}
+	return idx.Refresh(tpm)
+}
+
+// Replay returns the value of a register created by [DefineExtend] after the
+// extension of measurements, in order, for verifiers checking an event log.
+func Replay(measurements ...[]byte) []byte {
+	value := make([]byte, RegisterSize)
+	for _, m := range measurements {
+		h := sha256.New()
+		h.Write(value)
+		h.Write(m)
+		value = h.Sum(nil)
+	}
+	return value
+}
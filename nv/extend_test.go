@@ -0,0 +1,71 @@
+package nv_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/attestation"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/stretchr/testify/require"
+)
+
+const registerIndex = tpm2.TPMHandle(0x01500012)
+
+func TestExtendRegister(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("register-password")
+
+	register, err := nv.DefineExtend(thetpm, registerIndex, auth)
+	require.NoError(t, err)
+	defer nv.Undefine(thetpm, register)
+
+	events := [][]byte{
+		[]byte("bootloader v1.2"),
+		[]byte("config: debug=off"),
+		make([]byte, 200), // longer than a digest
+	}
+	for _, e := range events {
+		require.NoError(t, nv.Extend(thetpm, register, e, auth))
+	}
+	value, err := nv.Read(thetpm, register, tpm2.PasswordAuth(auth))
+	require.NoError(t, err)
+	require.Equal(t, nv.Replay(events...), value)
+	require.NotEqual(t, nv.Replay(events[1], events[0], events[2]), value)
+
+	require.ErrorIs(t, nv.Extend(thetpm, register, []byte("evil"), []byte("wrong")), tpm2.TPMRCBadAuth)
+}
+
+func TestCertifyRegister(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("register-password")
+
+	register, err := nv.DefineExtend(thetpm, registerIndex, auth)
+	require.NoError(t, err)
+	defer nv.Undefine(thetpm, register)
+	events := [][]byte{[]byte("app v3"), []byte("policy v7")}
+	for _, e := range events {
+		require.NoError(t, nv.Extend(thetpm, register, e, auth))
+	}
+
+	ak, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: attestation.AKTemplate})
+	require.NoError(t, err)
+	defer ak.Close()
+
+	nonce := []byte("verifier nonce")
+	c, err := nv.CertifyRegister(thetpm, ak, register, nv.CertifyConfig{Nonce: nonce, IndexAuth: tpm2.PasswordAuth(auth)})
+	require.NoError(t, err)
+
+	require.NoError(t, nv.VerifyRegister(ak.Public(), nonce, register.Name, c, nv.Replay(events...)))
+
+	err = nv.VerifyRegister(ak.Public(), nonce, register.Name, c, nv.Replay(events[0]))
+	require.ErrorIs(t, err, nv.ErrCertificationMismatch)
+	err = nv.VerifyRegister(ak.Public(), []byte("stale nonce"), register.Name, c, nv.Replay(events...))
+	require.ErrorIs(t, err, nv.ErrCertificationMismatch)
+	err = nv.VerifyRegister(ak.Public(), nonce, tpm2.TPM2BName{Buffer: []byte("other index")}, c, nv.Replay(events...))
+	require.ErrorIs(t, err, nv.ErrCertificationMismatch)
+
+	c.Attest[len(c.Attest)-1] ^= 1
+	require.Error(t, nv.VerifyRegister(ak.Public(), nonce, register.Name, c, nv.Replay(events...)))
+}
@@ -0,0 +1,186 @@
+// Package nv provides helpers to define and use TPM Non-Volatile indexes.
+package nv
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+	"github.com/loicsikidi/tpm-stuff/internal/rawcmd"
+	"github.com/loicsikidi/tpm-stuff/metrics"
+)
+
+// Index identifies an NV index along with its current name.
+//
+// The name of an index covers its attributes, including TPMA_NV_WRITTEN: it
+// changes after the first write, so helpers that write to an index refresh it.
+type Index struct {
+	Handle tpm2.TPMHandle
+	Name   tpm2.TPM2BName
+	// Logger, when set, logs the commands sent by the helpers using the index
+	// (see [metrics.Logger]).
+	Logger *slog.Logger
+}
+
+// NamedHandle returns the index as a [tpm2.NamedHandle].
+func (i *Index) NamedHandle() tpm2.NamedHandle {
+	return tpm2.NamedHandle{Handle: i.Handle, Name: i.Name}
+}
+
+// AuthHandle returns the index as a [tpm2.AuthHandle] authorized by auth.
+func (i *Index) AuthHandle(auth tpm2.Session) tpm2.AuthHandle {
+	return tpm2.AuthHandle{Handle: i.Handle, Name: i.Name, Auth: auth}
+}
+
+// logged returns tpm logging its commands to the logger of the index, if any,
+// as part of op.
+func (i *Index) logged(tpm transport.TPM, op string) transport.TPM {
+	return metrics.WithLogger(tpm, i.Logger, op)
+}
+
+// Refresh reads back the public area of the index to update its name.
+func (i *Index) Refresh(tpm transport.TPM) error {
+	rsp, err := tpm2.NVReadPublic{NVIndex: i.Handle}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to read NV public: %w", err)
+	}
+	i.Name = rsp.NVName
+	return nil
+}
+
+// Open returns the Index defined at handle.
+func Open(tpm transport.TPM, handle tpm2.TPMHandle) (*Index, error) {
+	idx := &Index{Handle: handle}
+	if err := idx.Refresh(tpm); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// ReadPublic returns the public area of the index defined at handle.
+func ReadPublic(tpm transport.TPM, handle tpm2.TPMHandle) (*tpm2.TPMSNVPublic, error) {
+	rsp, err := tpm2.NVReadPublic{NVIndex: handle}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NV public: %w", err)
+	}
+	return rsp.NVPublic.Contents()
+}
+
+// DefineConfig holds configuration for [Define].
+type DefineConfig struct {
+	// Index is the handle of the NV index.
+	//
+	// Required.
+	Index tpm2.TPMHandle
+	// Attributes of the index. The index type is set in Attributes.NT.
+	//
+	// Default: an ordinary index readable and writable with its own
+	// authorization value or with owner authorization.
+	Attributes tpm2.TPMANV
+	// Size is the size of the data area in bytes.
+	//
+	// Required for ordinary indexes, ignored for counters.
+	Size uint16
+	// Auth is the authorization value of the index.
+	//
+	// Default: nil.
+	Auth []byte
+	// AuthPolicy is the policy digest of the index.
+	//
+	// Default: nil.
+	AuthPolicy []byte
+	// OwnerAuth is the authorization session for the owner hierarchy.
+	//
+	// Default: [tpmutil.NoAuth].
+	OwnerAuth tpm2.Session
+	// Logger logs the commands sent to define the index, and is set as the
+	// logger of the returned [Index].
+	//
+	// Default: nil, no logging.
+	Logger *slog.Logger
+}
+
+// CheckAndSetDefault validates and sets default values for DefineConfig.
+func (c *DefineConfig) CheckAndSetDefault() error {
+	if c.Index>>24 != tpm2.TPMHandle(tpm2.TPMHTNVIndex) {
+		return fmt.Errorf("invalid NV index handle 0x%x", c.Index)
+	}
+	if c.Attributes == (tpm2.TPMANV{}) {
+		c.Attributes = tpm2.TPMANV{
+			OwnerWrite: true,
+			OwnerRead:  true,
+			AuthWrite:  true,
+			AuthRead:   true,
+		}
+	}
+	switch c.Attributes.NT {
+	case tpm2.TPMNTCounter, tpm2.TPMNTBits:
+		c.Size = 8
+	case tpm2.TPMNTOrdinary, tpm2.TPMNTExtend:
+		if c.Size == 0 {
+			return fmt.Errorf("size is required for index type %v", c.Attributes.NT)
+		}
+	}
+	if c.OwnerAuth == nil {
+		c.OwnerAuth = tpmutil.NoAuth
+	}
+	return nil
+}
+
+// Define creates an NV index in the owner hierarchy.
+func Define(tpm transport.TPM, cfg DefineConfig) (*Index, error) {
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	tpm = metrics.WithLogger(tpm, cfg.Logger, "nv define")
+	_, err := tpm2.NVDefineSpace{
+		AuthHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMRHOwner,
+			Auth:   cfg.OwnerAuth,
+		},
+		Auth: tpm2.TPM2BAuth{Buffer: cfg.Auth},
+		PublicInfo: tpm2.New2B(tpm2.TPMSNVPublic{
+			NVIndex:    cfg.Index,
+			NameAlg:    tpm2.TPMAlgSHA256,
+			Attributes: cfg.Attributes,
+			AuthPolicy: tpm2.TPM2BDigest{Buffer: cfg.AuthPolicy},
+			DataSize:   cfg.Size,
+		}),
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to define NV space: %w", tpmerrors.Wrap(err))
+	}
+	idx, err := Open(tpm, cfg.Index)
+	if err != nil {
+		return nil, err
+	}
+	idx.Logger = cfg.Logger
+	return idx, nil
+}
+
+// Undefine removes an NV index from the owner hierarchy.
+//
+// By default the owner hierarchy is authorized with an empty password;
+// ownerAuth overrides this session.
+func Undefine(tpm transport.TPM, idx *Index, ownerAuth ...tpm2.Session) error {
+	tpm = idx.logged(tpm, "nv undefine")
+	_, err := tpm2.NVUndefineSpace{
+		AuthHandle: tpmutil.ToAuthHandle(tpmutil.NewHandle(tpm2.TPMRHOwner), ownerAuth...),
+		NVIndex:    idx.NamedHandle(),
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to undefine NV space: %w", tpmerrors.Wrap(err))
+	}
+	return nil
+}
+
+// execute sends a command whose handles are idx authorizing itself with
+// auth, through a password session, and idx, followed by params. It covers the
+// NV commands go-tpm doesn't implement, which therefore support neither HMAC
+// nor encrypted sessions.
+func execute(tpm transport.TPM, cc tpm2.TPMCC, idx *Index, auth []byte, params []byte) error {
+	return rawcmd.Execute(tpm, cc, []tpm2.TPMHandle{idx.Handle, idx.Handle}, auth, params)
+}
@@ -0,0 +1,122 @@
+package nv_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"log/slog"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefineAndUndefine(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	idx, err := nv.Define(thetpm, nv.DefineConfig{Index: 0x01500000, Size: 16, Auth: []byte("password")})
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMHandle(0x01500000), idx.Handle)
+
+	pub, err := nv.ReadPublic(thetpm, idx.Handle)
+	require.NoError(t, err)
+	require.Equal(t, uint16(16), pub.DataSize)
+	require.Equal(t, tpm2.TPMNTOrdinary, pub.Attributes.NT)
+
+	opened, err := nv.Open(thetpm, idx.Handle)
+	require.NoError(t, err)
+	require.Equal(t, idx.Name, opened.Name)
+
+	require.NoError(t, nv.Undefine(thetpm, idx))
+	_, err = nv.Open(thetpm, idx.Handle)
+	require.Error(t, err)
+}
+
+func TestDefine_InvalidConfig(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	_, err := nv.Define(thetpm, nv.DefineConfig{Index: 0x81000001, Size: 16})
+	require.Error(t, err)
+
+	_, err = nv.Define(thetpm, nv.DefineConfig{Index: 0x01500000})
+	require.Error(t, err)
+}
+
+// commandCounter counts the commands sent to the TPM by command code.
+type commandCounter struct {
+	transport.TPM
+	counts map[tpm2.TPMCC]int
+}
+
+func (c *commandCounter) Send(cmd []byte) ([]byte, error) {
+	c.counts[tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:10]))]++
+	return c.TPM.Send(cmd)
+}
+
+func TestWriteAndRead(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("password")
+
+	maxBuffer, err := nv.MaxBufferSize(thetpm)
+	require.NoError(t, err)
+	require.NotZero(t, maxBuffer)
+
+	size := maxBuffer + maxBuffer/2
+	idx, err := nv.Define(thetpm, nv.DefineConfig{Index: 0x01500000, Size: size, Auth: auth})
+	require.NoError(t, err)
+	defer nv.Undefine(thetpm, idx)
+
+	data := make([]byte, size)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	counter := &commandCounter{TPM: thetpm, counts: make(map[tpm2.TPMCC]int)}
+	require.NoError(t, nv.Write(counter, idx, data, tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Auth(auth))))
+	require.Equal(t, 2, counter.counts[tpm2.TPMCCNVWrite])
+
+	got, err := nv.Read(counter, idx, tpm2.PasswordAuth(auth))
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	require.Equal(t, 2, counter.counts[tpm2.TPMCCNVRead])
+
+	// Partial update in the middle of the index, across a chunk boundary.
+	patch := []byte("patched across chunks")
+	offset := maxBuffer - 5
+	require.NoError(t, nv.WriteAt(thetpm, idx, patch, offset, tpm2.PasswordAuth(auth)))
+	got, err = nv.ReadAt(thetpm, idx, offset, uint16(len(patch)), tpm2.PasswordAuth(auth))
+	require.NoError(t, err)
+	require.Equal(t, patch, got)
+
+	// Out of bounds.
+	require.Error(t, nv.WriteAt(thetpm, idx, patch, size-1, tpm2.PasswordAuth(auth)))
+	_, err = nv.ReadAt(thetpm, idx, 0, size+1, tpm2.PasswordAuth(auth))
+	require.Error(t, err)
+}
+
+func TestLogger(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	idx, err := nv.Define(thetpm, nv.DefineConfig{Index: 0x01500000, Size: 8, Logger: logger})
+	require.NoError(t, err)
+	require.Equal(t, logger, idx.Logger)
+	require.Contains(t, buf.String(), `op="nv define" command=NVDefineSpace handles=[0x40000001]`)
+
+	require.NoError(t, nv.Write(thetpm, idx, []byte("12345678"), tpm2.PasswordAuth(nil)))
+	require.Contains(t, buf.String(), `op="nv write" command=NVWrite handles="[0x01500000 0x01500000]"`)
+
+	_, err = nv.Read(thetpm, idx, tpm2.PasswordAuth([]byte("wrong")))
+	require.Error(t, err)
+	require.Contains(t, buf.String(), `level=WARN msg="tpm command" op="nv read" command=NVRead`)
+
+	// Without logger, nothing is logged.
+	buf.Reset()
+	idx.Logger = nil
+	_, err = nv.Read(thetpm, idx, tpm2.PasswordAuth(nil))
+	require.NoError(t, err)
+	require.Empty(t, buf.String())
+}
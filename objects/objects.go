@@ -0,0 +1,77 @@
+// Package objects reads the public area of loaded objects without trusting
+// the TPM, or the bus, blindly.
+//
+// TPM2_ReadPublic returns the public area of an object along with its Name,
+// but nothing binds the two on an unprotected bus. [ReadPublicVerified]
+// recomputes the Name in software (see the names package) and fails when it
+// isn't the one reported, so that a session salted with, or bound to, the
+// object uses the public area and Name of the same object.
+package objects
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+	"github.com/loicsikidi/tpm-stuff/names"
+)
+
+// Public is the public area of a loaded object, read by [ReadPublicVerified].
+type Public struct {
+	// Handle is the handle of the object.
+	Handle tpm2.TPMHandle
+	// Public is the public area of the object.
+	Public tpm2.TPMTPublic
+	// Name is the Name of the object, computed from Public.
+	Name tpm2.TPM2BName
+	// QualifiedName is the Qualified Name of the object, as reported by the
+	// TPM: it depends on the parents of the object, unknown here.
+	QualifiedName tpm2.TPM2BName
+}
+
+// NamedHandle returns the object as a [tpm2.NamedHandle].
+func (p *Public) NamedHandle() tpm2.NamedHandle {
+	return tpm2.NamedHandle{Handle: p.Handle, Name: p.Name}
+}
+
+// AuthHandle returns the object as a [tpm2.AuthHandle] authorized by auth.
+func (p *Public) AuthHandle(auth tpm2.Session) tpm2.AuthHandle {
+	return tpm2.AuthHandle{Handle: p.Handle, Name: p.Name, Auth: auth}
+}
+
+// ReadPublicVerified reads the public area of the object loaded at handle,
+// recomputes its Name and compares it with the Name returned by the TPM.
+// It returns an error wrapping [names.ErrMismatch] when they differ.
+//
+// Example:
+//
+//	srk, err := objects.ReadPublicVerified(tpm, provision.SRKHandle)
+//	if err != nil {
+//	    return err
+//	}
+//	encryptSess := salted.Salted(srk.Handle, srk.Public)
+func ReadPublicVerified(tpm transport.TPM, handle tpm2.TPMHandle) (*Public, error) {
+	rsp, err := tpm2.ReadPublic{ObjectHandle: handle}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public area of 0x%x: %w", handle, tpmerrors.Wrap(err))
+	}
+	pub, err := rsp.OutPublic.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public area of 0x%x: %w", handle, err)
+	}
+	name, err := names.Compute(*pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute name of 0x%x: %w", handle, err)
+	}
+	if !bytes.Equal(name.Buffer, rsp.Name.Buffer) {
+		return nil, fmt.Errorf("%w: TPM reported name %x for 0x%x, computed %x", names.ErrMismatch, rsp.Name.Buffer, handle, name.Buffer)
+	}
+	return &Public{
+		Handle:        handle,
+		Public:        *pub,
+		Name:          name,
+		QualifiedName: rsp.QualifiedName,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package objects_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/handles"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/names"
+	"github.com/loicsikidi/tpm-stuff/objects"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/mitm"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPublicVerified(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	tracker := handles.NewTracker(thetpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
+
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(templates.ECCDecrypter()),
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
+
+	pub, err := objects.ReadPublicVerified(thetpm, rsp.ObjectHandle)
+	require.NoError(t, err)
+	require.Equal(t, rsp.ObjectHandle, pub.Handle)
+	require.Equal(t, rsp.Name, pub.Name)
+	require.Equal(t, rsp.Name, pub.NamedHandle().Name)
+	outPublic, err := rsp.OutPublic.Contents()
+	require.NoError(t, err)
+	require.Equal(t, tpm2.Marshal(*outPublic), tpm2.Marshal(pub.Public))
+
+	// An attacker on the bus substitutes the public key, leaving the Name.
+	bus := mitm.New(thetpm)
+	last := len(tpm2.Marshal(rsp.OutPublic)) - 1
+	bus.TamperResponse(tpm2.TPMCCReadPublic, mitm.FlipResponseParameter(tpm2.TPMCCReadPublic, last))
+	_, err = objects.ReadPublicVerified(bus, rsp.ObjectHandle)
+	require.ErrorIs(t, err, names.ErrMismatch)
+	require.Equal(t, 1, bus.Tampered())
+
+	_, err = objects.ReadPublicVerified(thetpm, rsp.ObjectHandle+1)
+	require.ErrorIs(t, err, tpm2.TPMRCHandle)
+}
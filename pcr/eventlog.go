@@ -0,0 +1,204 @@
+package pcr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// ErrInvalidEventLog is returned for event logs which can't be parsed.
+var ErrInvalidEventLog = errors.New("invalid event log")
+
+const (
+	// evNoAction is the type of the events which aren't extended.
+	evNoAction = 0x3
+	// maxEventSize bounds the size of an event, ahead of its allocation.
+	maxEventSize = 1 << 24
+)
+
+var (
+	specIDSignature          = []byte("Spec ID Event03\x00")
+	startupLocalitySignature = []byte("StartupLocality\x00")
+)
+
+// ParseEventLog returns the measurements of the alg bank recorded in a binary
+// TCG event log, as exposed by Linux in
+// /sys/kernel/security/tpm0/binary_bios_measurements, in the order they were
+// extended. Replay them to compute the values of the PCRs (see [Replay] and
+// [Recipe.Digest]).
+//
+// Both the crypto agile format of the PC Client Platform Firmware Profile
+// and the legacy SHA-1 format are supported. Events of type EV_NO_ACTION
+// aren't extended and are skipped.
+//
+// Logs of a platform which started the TPM at locality 3 are rejected: the
+// reset value of PCR 0 isn't zero then, which [Replay] doesn't support.
+func ParseEventLog(data []byte, alg tpm2.TPMAlgID) ([]Measurement, error) {
+	r := bytes.NewReader(data)
+	// The first event is in the legacy format, and describes the digests of
+	// the next ones in the crypto agile format.
+	first, err := readLegacyEvent(r)
+	if err != nil {
+		return nil, err
+	}
+	if first.eventType != evNoAction || !bytes.HasPrefix(first.data, specIDSignature) {
+		return parseLegacyLog(data, alg)
+	}
+	sizes, err := parseSpecID(first.data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := sizes[alg]; !ok {
+		return nil, fmt.Errorf("no %v bank in the event log", alg)
+	}
+
+	var measurements []Measurement
+	for r.Len() > 0 {
+		var hdr struct {
+			Index, Type, Count uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+			return nil, fmt.Errorf("%w: truncated event header", ErrInvalidEventLog)
+		}
+		if int(hdr.Count) > len(sizes) {
+			return nil, fmt.Errorf("%w: %d digests per event, expected at most %d", ErrInvalidEventLog, hdr.Count, len(sizes))
+		}
+		var digest []byte
+		for range hdr.Count {
+			var digestAlg uint16
+			if err := binary.Read(r, binary.LittleEndian, &digestAlg); err != nil {
+				return nil, fmt.Errorf("%w: truncated digest", ErrInvalidEventLog)
+			}
+			size, ok := sizes[tpm2.TPMAlgID(digestAlg)]
+			if !ok {
+				return nil, fmt.Errorf("%w: digest of unknown algorithm 0x%x", ErrInvalidEventLog, digestAlg)
+			}
+			d := make([]byte, size)
+			if _, err := io.ReadFull(r, d); err != nil {
+				return nil, fmt.Errorf("%w: truncated digest", ErrInvalidEventLog)
+			}
+			if tpm2.TPMAlgID(digestAlg) == alg {
+				digest = d
+			}
+		}
+		eventData, err := readEventData(r)
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Type == evNoAction {
+			if err := checkNoAction(hdr.Index, eventData); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if digest == nil {
+			return nil, fmt.Errorf("%w: event without %v digest", ErrInvalidEventLog, alg)
+		}
+		measurements = append(measurements, Measurement{Index: uint(hdr.Index), Digest: digest})
+	}
+	return measurements, nil
+}
+
+// legacyEvent is an event of the legacy SHA-1 format (TCG_PCR_EVENT).
+type legacyEvent struct {
+	index, eventType uint32
+	digest           []byte
+	data             []byte
+}
+
+func readLegacyEvent(r *bytes.Reader) (*legacyEvent, error) {
+	var hdr struct {
+		Index, Type uint32
+		Digest      [20]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("%w: truncated event header", ErrInvalidEventLog)
+	}
+	data, err := readEventData(r)
+	if err != nil {
+		return nil, err
+	}
+	return &legacyEvent{index: hdr.Index, eventType: hdr.Type, digest: hdr.Digest[:], data: data}, nil
+}
+
+// readEventData reads the size prefixed data of an event.
+func readEventData(r *bytes.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, fmt.Errorf("%w: truncated event size", ErrInvalidEventLog)
+	}
+	if size > maxEventSize || int(size) > r.Len() {
+		return nil, fmt.Errorf("%w: event of %d bytes", ErrInvalidEventLog, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("%w: truncated event data", ErrInvalidEventLog)
+	}
+	return data, nil
+}
+
+// parseLegacyLog parses a log of the legacy format, which has SHA-1 digests
+// only.
+func parseLegacyLog(data []byte, alg tpm2.TPMAlgID) ([]Measurement, error) {
+	if alg != tpm2.TPMAlgSHA1 {
+		return nil, fmt.Errorf("no %v bank in the SHA-1 event log", alg)
+	}
+	var measurements []Measurement
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		e, err := readLegacyEvent(r)
+		if err != nil {
+			return nil, err
+		}
+		if e.eventType == evNoAction {
+			if err := checkNoAction(e.index, e.data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		measurements = append(measurements, Measurement{Index: uint(e.index), Digest: e.digest})
+	}
+	return measurements, nil
+}
+
+// parseSpecID returns the digest sizes declared by the data of the
+// TCG_EfiSpecIDEvent, the first event of crypto agile logs.
+func parseSpecID(data []byte) (map[tpm2.TPMAlgID]int, error) {
+	r := bytes.NewReader(data[len(specIDSignature):])
+	var hdr struct {
+		PlatformClass                         uint32
+		VersionMinor, VersionMajor, Errata, _ uint8
+		Count                                 uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("%w: truncated Spec ID event", ErrInvalidEventLog)
+	}
+	if hdr.Count == 0 || int(hdr.Count) > r.Len()/4 {
+		return nil, fmt.Errorf("%w: invalid number of algorithms %d", ErrInvalidEventLog, hdr.Count)
+	}
+	sizes := make(map[tpm2.TPMAlgID]int, hdr.Count)
+	for range hdr.Count {
+		var a struct{ Alg, Size uint16 }
+		if err := binary.Read(r, binary.LittleEndian, &a); err != nil {
+			return nil, fmt.Errorf("%w: truncated Spec ID event", ErrInvalidEventLog)
+		}
+		sizes[tpm2.TPMAlgID(a.Alg)] = int(a.Size)
+	}
+	return sizes, nil
+}
+
+// checkNoAction rejects the StartupLocality event of a TPM started at
+// locality 3, which changes the reset value of PCR 0.
+func checkNoAction(index uint32, data []byte) error {
+	if index != 0 || !bytes.HasPrefix(data, startupLocalitySignature) {
+		return nil
+	}
+	if locality := data[len(startupLocalitySignature):]; len(locality) != 1 || locality[0] != 0 {
+		return fmt.Errorf("%w: unsupported startup locality", ErrInvalidEventLog)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package pcr_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	evNoAction  = 0x3
+	evSeparator = 0x4
+)
+
+type event struct {
+	index, eventType uint32
+	data             []byte
+}
+
+func le(b *bytes.Buffer, v any) {
+	binary.Write(b, binary.LittleEndian, v) //nolint:errcheck
+}
+
+// eventLog encodes events in the crypto agile format, with SHA-1 and SHA-256
+// digests of their data.
+func eventLog(events ...event) []byte {
+	var spec bytes.Buffer
+	spec.WriteString("Spec ID Event03\x00")
+	le(&spec, uint32(0))           // platformClass
+	spec.Write([]byte{0, 2, 0, 2}) // version 2.0, errata 0, uintnSize
+	le(&spec, uint32(2))
+	le(&spec, []uint16{uint16(tpm2.TPMAlgSHA1), sha1.Size, uint16(tpm2.TPMAlgSHA256), sha256.Size})
+	spec.WriteByte(0) // vendorInfoSize
+
+	var log bytes.Buffer
+	le(&log, []uint32{0, evNoAction})
+	log.Write(make([]byte, sha1.Size))
+	le(&log, uint32(spec.Len()))
+	log.Write(spec.Bytes())
+	for _, e := range events {
+		le(&log, []uint32{e.index, e.eventType, 2})
+		sha1Digest, sha256Digest := sha1.Sum(e.data), sha256.Sum256(e.data)
+		le(&log, uint16(tpm2.TPMAlgSHA1))
+		log.Write(sha1Digest[:])
+		le(&log, uint16(tpm2.TPMAlgSHA256))
+		log.Write(sha256Digest[:])
+		le(&log, uint32(len(e.data)))
+		log.Write(e.data)
+	}
+	return log.Bytes()
+}
+
+// legacyLog encodes events in the legacy SHA-1 format.
+func legacyLog(events ...event) []byte {
+	var log bytes.Buffer
+	for _, e := range events {
+		le(&log, []uint32{e.index, e.eventType})
+		digest := sha1.Sum(e.data)
+		log.Write(digest[:])
+		le(&log, uint32(len(e.data)))
+		log.Write(e.data)
+	}
+	return log.Bytes()
+}
+
+var bootEvents = []event{
+	{index: 0, eventType: evNoAction, data: []byte("StartupLocality\x00\x00")},
+	{index: 0, eventType: 0x8, data: []byte("firmware")},
+	{index: 7, eventType: 0x80000001, data: []byte("SecureBoot=1")},
+	{index: 7, eventType: evSeparator, data: []byte{0, 0, 0, 0}},
+	{index: 8, eventType: 0xd, data: []byte("linux root=/dev/sda1")},
+	{index: 9, eventType: 0xd, data: []byte("vmlinuz")},
+}
+
+func TestParseEventLog(t *testing.T) {
+	for name, tc := range map[string]struct {
+		log []byte
+		alg tpm2.TPMAlgID
+	}{
+		"crypto agile SHA-256": {log: eventLog(bootEvents...), alg: tpm2.TPMAlgSHA256},
+		"crypto agile SHA-1":   {log: eventLog(bootEvents...), alg: tpm2.TPMAlgSHA1},
+		"legacy":               {log: legacyLog(bootEvents...), alg: tpm2.TPMAlgSHA1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			measurements, err := pcr.ParseEventLog(tc.log, tc.alg)
+			require.NoError(t, err)
+			h, err := tc.alg.Hash()
+			require.NoError(t, err)
+
+			// The EV_NO_ACTION event isn't extended.
+			require.Len(t, measurements, len(bootEvents)-1)
+			for i, e := range bootEvents[1:] {
+				digest := h.New()
+				digest.Write(e.data)
+				require.Equal(t, pcr.Measurement{Index: uint(e.index), Digest: digest.Sum(nil)}, measurements[i])
+			}
+		})
+	}
+}
+
+func TestParseEventLog_Invalid(t *testing.T) {
+	log := eventLog(bootEvents...)
+	for name, tc := range map[string]struct {
+		log []byte
+		alg tpm2.TPMAlgID
+	}{
+		"empty":           {log: nil, alg: tpm2.TPMAlgSHA256},
+		"truncated":       {log: log[:len(log)-1], alg: tpm2.TPMAlgSHA256},
+		"missing bank":    {log: log, alg: tpm2.TPMAlgSHA384},
+		"legacy SHA-256":  {log: legacyLog(bootEvents...), alg: tpm2.TPMAlgSHA256},
+		"locality 3":      {log: eventLog(event{index: 0, eventType: evNoAction, data: []byte("StartupLocality\x00\x03")}), alg: tpm2.TPMAlgSHA256},
+		"huge event size": {log: append(eventLog(), 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff), alg: tpm2.TPMAlgSHA256},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := pcr.ParseEventLog(tc.log, tc.alg)
+			require.Error(t, err)
+		})
+	}
+}
+
+func FuzzParseEventLog(f *testing.F) {
+	f.Add(eventLog(bootEvents...))
+	f.Add(legacyLog(bootEvents...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, alg := range []tpm2.TPMAlgID{tpm2.TPMAlgSHA1, tpm2.TPMAlgSHA256} {
+			measurements, err := pcr.ParseEventLog(data, alg)
+			if err == nil && measurements == nil && len(data) == 0 {
+				t.Fatal("empty log accepted")
+			}
+		}
+	})
+}
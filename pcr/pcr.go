@@ -0,0 +1,300 @@
+// Package pcr provides helpers to read, extend, reset and compare Platform
+// Configuration Registers.
+package pcr
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+)
+
+// Count is the number of PCRs per bank on a PC Client TPM.
+const Count = 24
+
+// All returns the indexes of every PCR of a bank.
+func All() []uint {
+	pcrs := make([]uint, Count)
+	for i := range pcrs {
+		pcrs[i] = uint(i)
+	}
+	return pcrs
+}
+
+// Selection builds a single-bank PCR selection.
+//
+// Example:
+//
+//	sel := pcr.Selection(tpm2.TPMAlgSHA256, 0, 7)
+func Selection(alg tpm2.TPMAlgID, pcrs ...uint) tpm2.TPMLPCRSelection {
+	return tpm2.TPMLPCRSelection{
+		PCRSelections: []tpm2.TPMSPCRSelection{
+			{
+				Hash:      alg,
+				PCRSelect: tpm2.PCClientCompatible.PCRs(pcrs...),
+			},
+		},
+	}
+}
+
+// Bank holds the values of PCRs of a single hash algorithm.
+type Bank struct {
+	Alg    tpm2.TPMAlgID
+	Values map[uint][]byte
+}
+
+// Indexes returns the PCR indexes present in the bank, in ascending order.
+func (b *Bank) Indexes() []uint {
+	idx := make([]uint, 0, len(b.Values))
+	for i := range b.Values {
+		idx = append(idx, i)
+	}
+	slices.Sort(idx)
+	return idx
+}
+
+// Digest returns the composite digest of pcrs, or of every PCR of the bank
+// when pcrs is empty: the hash with the bank algorithm of their values in
+// ascending index order, as checked by TPM2_PolicyPCR and signed in quotes.
+func (b *Bank) Digest(pcrs ...uint) ([]byte, error) {
+	h, err := b.Alg.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported PCR bank: %w", err)
+	}
+	if len(pcrs) == 0 {
+		pcrs = b.Indexes()
+	}
+	digest := h.New()
+	for _, idx := range slices.Compact(slices.Sorted(slices.Values(pcrs))) {
+		v, ok := b.Values[idx]
+		if !ok {
+			return nil, fmt.Errorf("missing value of PCR %d", idx)
+		}
+		digest.Write(v)
+	}
+	return digest.Sum(nil), nil
+}
+
+// Measurement is a digest extended into a PCR, e.g. the digest of an event of
+// the TCG event log for a bank.
+type Measurement struct {
+	Index  uint
+	Digest []byte
+}
+
+// Replay computes the values of the PCRs of the alg bank after measurements
+// are extended in order, from their reset value: zeros, as for the PCRs reset
+// at TPM2_Startup. The returned bank holds the measured PCRs only.
+//
+// Replaying an event log where the events of the updated components are
+// replaced with their new digests predicts the PCR values of the next boot,
+// e.g. to seal a secret before an update (see unseal.SealConfig.PCRDigest):
+//
+//	bank, err := pcr.Replay(tpm2.TPMAlgSHA256, predicted)
+//	if err != nil {
+//	    return err
+//	}
+//	digest, err := bank.Digest(4, 7)
+func Replay(alg tpm2.TPMAlgID, measurements []Measurement) (*Bank, error) {
+	h, err := alg.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported PCR bank: %w", err)
+	}
+	bank := &Bank{Alg: alg, Values: make(map[uint][]byte)}
+	for _, m := range measurements {
+		if m.Index >= Count {
+			return nil, fmt.Errorf("invalid PCR index %d", m.Index)
+		}
+		if len(m.Digest) != h.Size() {
+			return nil, fmt.Errorf("invalid digest size for PCR %d: %d bytes, expected %d", m.Index, len(m.Digest), h.Size())
+		}
+		current, ok := bank.Values[m.Index]
+		if !ok {
+			current = make([]byte, h.Size())
+		}
+		pcr := h.New()
+		pcr.Write(current)
+		pcr.Write(m.Digest)
+		bank.Values[m.Index] = pcr.Sum(nil)
+	}
+	return bank, nil
+}
+
+// Read reads the given PCRs of the alg bank.
+//
+// TPM2_PCRRead returns at most 8 digests per call, so the selection is
+// consumed until the TPM has nothing left to return.
+func Read(tpm transport.TPM, alg tpm2.TPMAlgID, pcrs ...uint) (*Bank, error) {
+	bank := &Bank{Alg: alg, Values: make(map[uint][]byte, len(pcrs))}
+	sel := Selection(alg, pcrs...)
+	for len(sel.PCRSelections) > 0 {
+		rsp, err := tpm2.PCRRead{PCRSelectionIn: sel}.Execute(tpm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PCRs: %w", err)
+		}
+		if len(rsp.PCRValues.Digests) == 0 {
+			// The bank is not allocated or the remaining PCRs don't exist.
+			break
+		}
+		i := 0
+		for _, s := range rsp.PCRSelectionOut.PCRSelections {
+			for _, idx := range tpmutil.PCRSelectToPCRs(s.PCRSelect) {
+				bank.Values[idx] = rsp.PCRValues.Digests[i].Buffer
+				i++
+			}
+		}
+		sel = removeSelected(sel, rsp.PCRSelectionOut)
+	}
+	return bank, nil
+}
+
+// ReadAll reads every PCR of the alg bank.
+func ReadAll(tpm transport.TPM, alg tpm2.TPMAlgID) (*Bank, error) {
+	return Read(tpm, alg, All()...)
+}
+
+// removeSelected clears from sel the PCRs present in done.
+func removeSelected(sel, done tpm2.TPMLPCRSelection) tpm2.TPMLPCRSelection {
+	var out tpm2.TPMLPCRSelection
+	for _, s := range sel.PCRSelections {
+		mask := slices.Clone(s.PCRSelect)
+		for _, d := range done.PCRSelections {
+			if d.Hash != s.Hash {
+				continue
+			}
+			for i := range mask {
+				if i < len(d.PCRSelect) {
+					mask[i] &^= d.PCRSelect[i]
+				}
+			}
+		}
+		if len(tpmutil.PCRSelectToPCRs(mask)) > 0 {
+			out.PCRSelections = append(out.PCRSelections, tpm2.TPMSPCRSelection{Hash: s.Hash, PCRSelect: mask})
+		}
+	}
+	return out
+}
+
+// Extend hashes data with alg and extends the result into PCR index of the alg bank.
+func Extend(tpm transport.TPM, index uint, alg tpm2.TPMAlgID, data []byte) error {
+	h, err := alg.Hash()
+	if err != nil {
+		return err
+	}
+	digest := h.New()
+	digest.Write(data)
+
+	_, err = tpm2.PCRExtend{
+		PCRHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMHandle(index),
+			Auth:   tpm2.PasswordAuth(nil),
+		},
+		Digests: tpm2.TPMLDigestValues{
+			Digests: []tpm2.TPMTHA{
+				{
+					HashAlg: alg,
+					Digest:  digest.Sum(nil),
+				},
+			},
+		},
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to extend PCR %d: %w", index, err)
+	}
+	return nil
+}
+
+// Reset resets PCR index in every bank.
+//
+// Note: at locality 0 only the debug (16) and application (23) PCRs can be reset.
+func Reset(tpm transport.TPM, index uint) error {
+	_, err := tpm2.PCRReset{
+		PCRHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMHandle(index),
+			Auth:   tpm2.PasswordAuth(nil),
+		},
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to reset PCR %d: %w", index, err)
+	}
+	return nil
+}
+
+// SimulateExtend computes in software the value of a PCR currently equal to
+// current after [Extend] is called with data: H(current || H(data)).
+func SimulateExtend(alg tpm2.TPMAlgID, current, data []byte) ([]byte, error) {
+	h, err := alg.Hash()
+	if err != nil {
+		return nil, err
+	}
+	digest := h.New()
+	digest.Write(data)
+	pcr := h.New()
+	pcr.Write(current)
+	pcr.Write(digest.Sum(nil))
+	return pcr.Sum(nil), nil
+}
+
+// Snapshot captures the values of every PCR of one or more banks.
+type Snapshot map[tpm2.TPMAlgID]*Bank
+
+// TakeSnapshot reads every PCR of the given banks.
+func TakeSnapshot(tpm transport.TPM, algs ...tpm2.TPMAlgID) (Snapshot, error) {
+	s := make(Snapshot, len(algs))
+	for _, alg := range algs {
+		bank, err := ReadAll(tpm, alg)
+		if err != nil {
+			return nil, err
+		}
+		s[alg] = bank
+	}
+	return s, nil
+}
+
+// Change describes a PCR whose value differs between two snapshots.
+type Change struct {
+	Alg   tpm2.TPMAlgID
+	Index uint
+	// Old is nil if the PCR was absent from the first snapshot.
+	Old []byte
+	// New is nil if the PCR is absent from the second snapshot.
+	New []byte
+}
+
+// Diff returns the PCRs whose value differs between before and after,
+// ordered by bank then by index.
+func Diff(before, after Snapshot) []Change {
+	algs := make(map[tpm2.TPMAlgID]struct{})
+	for alg := range before {
+		algs[alg] = struct{}{}
+	}
+	for alg := range after {
+		algs[alg] = struct{}{}
+	}
+	sortedAlgs := make([]tpm2.TPMAlgID, 0, len(algs))
+	for alg := range algs {
+		sortedAlgs = append(sortedAlgs, alg)
+	}
+	slices.Sort(sortedAlgs)
+
+	var changes []Change
+	for _, alg := range sortedAlgs {
+		oldBank, newBank := before[alg], after[alg]
+		for _, idx := range All() {
+			var oldValue, newValue []byte
+			if oldBank != nil {
+				oldValue = oldBank.Values[idx]
+			}
+			if newBank != nil {
+				newValue = newBank.Values[idx]
+			}
+			if !bytes.Equal(oldValue, newValue) || (oldValue == nil) != (newValue == nil) {
+				changes = append(changes, Change{Alg: alg, Index: idx, Old: oldValue, New: newValue})
+			}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,126 @@
+package pcr_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/stretchr/testify/require"
+)
+
+const debugPCR = 16
+
+func TestReadAll(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	for _, alg := range []tpm2.TPMAlgID{tpm2.TPMAlgSHA1, tpm2.TPMAlgSHA256} {
+		bank, err := pcr.ReadAll(thetpm, alg)
+		require.NoError(t, err)
+		require.Equal(t, pcr.All(), bank.Indexes())
+
+		h, err := alg.Hash()
+		require.NoError(t, err)
+		for _, v := range bank.Values {
+			require.Len(t, v, h.Size())
+		}
+	}
+}
+
+func TestExtendAndReset(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	alg := tpm2.TPMAlgSHA256
+
+	before, err := pcr.Read(thetpm, alg, debugPCR)
+	require.NoError(t, err)
+
+	data := []byte("measurement")
+	require.NoError(t, pcr.Extend(thetpm, debugPCR, alg, data))
+
+	after, err := pcr.Read(thetpm, alg, debugPCR)
+	require.NoError(t, err)
+	want, err := pcr.SimulateExtend(alg, before.Values[debugPCR], data)
+	require.NoError(t, err)
+	require.Equal(t, want, after.Values[debugPCR])
+
+	require.NoError(t, pcr.Reset(thetpm, debugPCR))
+	reset, err := pcr.Read(thetpm, alg, debugPCR)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(make([]byte, 32), reset.Values[debugPCR]))
+
+	// PCR 0 (firmware) can't be reset from locality 0.
+	require.Error(t, pcr.Reset(thetpm, 0))
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	before, err := pcr.TakeSnapshot(thetpm, tpm2.TPMAlgSHA1, tpm2.TPMAlgSHA256)
+	require.NoError(t, err)
+	require.Empty(t, pcr.Diff(before, before))
+
+	require.NoError(t, pcr.Extend(thetpm, debugPCR, tpm2.TPMAlgSHA256, []byte("event")))
+
+	after, err := pcr.TakeSnapshot(thetpm, tpm2.TPMAlgSHA1, tpm2.TPMAlgSHA256)
+	require.NoError(t, err)
+
+	changes := pcr.Diff(before, after)
+	require.Len(t, changes, 1)
+	require.Equal(t, tpm2.TPMAlgSHA256, changes[0].Alg)
+	require.Equal(t, uint(debugPCR), changes[0].Index)
+	require.Equal(t, before[tpm2.TPMAlgSHA256].Values[debugPCR], changes[0].Old)
+	require.Equal(t, after[tpm2.TPMAlgSHA256].Values[debugPCR], changes[0].New)
+}
+
+func TestSelection(t *testing.T) {
+	sel := pcr.Selection(tpm2.TPMAlgSHA256, 0, 7, 23)
+	require.Len(t, sel.PCRSelections, 1)
+	require.Equal(t, tpm2.TPMAlgSHA256, sel.PCRSelections[0].Hash)
+	require.Equal(t, []byte{0x81, 0x00, 0x80}, sel.PCRSelections[0].PCRSelect)
+}
+
+func TestReplay(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	alg := tpm2.TPMAlgSHA256
+	require.NoError(t, pcr.Reset(thetpm, debugPCR))
+	defer pcr.Reset(thetpm, debugPCR) //nolint:errcheck
+
+	var measurements []pcr.Measurement
+	for _, event := range []string{"bootloader", "kernel", "initrd"} {
+		require.NoError(t, pcr.Extend(thetpm, debugPCR, alg, []byte(event)))
+		digest := sha256.Sum256([]byte(event))
+		measurements = append(measurements, pcr.Measurement{Index: debugPCR, Digest: digest[:]})
+	}
+	predicted, err := pcr.Replay(alg, measurements)
+	require.NoError(t, err)
+	require.Equal(t, []uint{debugPCR}, predicted.Indexes())
+
+	current, err := pcr.Read(thetpm, alg, debugPCR)
+	require.NoError(t, err)
+	require.Equal(t, current.Values, predicted.Values)
+
+	_, err = pcr.Replay(alg, []pcr.Measurement{{Index: debugPCR, Digest: []byte("short")}})
+	require.Error(t, err)
+	_, err = pcr.Replay(alg, []pcr.Measurement{{Index: pcr.Count, Digest: make([]byte, 32)}})
+	require.Error(t, err)
+}
+
+func TestBankDigest(t *testing.T) {
+	bank := &pcr.Bank{Alg: tpm2.TPMAlgSHA256, Values: map[uint][]byte{
+		7: bytes.Repeat([]byte{7}, 32),
+		0: bytes.Repeat([]byte{0}, 32),
+	}}
+	want := sha256.Sum256(append(bytes.Repeat([]byte{0}, 32), bytes.Repeat([]byte{7}, 32)...))
+
+	got, err := bank.Digest()
+	require.NoError(t, err)
+	require.Equal(t, want[:], got)
+	got, err = bank.Digest(7, 0, 7)
+	require.NoError(t, err)
+	require.Equal(t, want[:], got)
+
+	_, err = bank.Digest(0, 4)
+	require.Error(t, err)
+}
@@ -0,0 +1,149 @@
+package pcr
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Recipe is a predefined selection of the PCRs measuring a platform state,
+// following the usage of the PCRs of the PC Client Platform Firmware Profile.
+// Sealing to a recipe binds a secret to that state only: e.g. [SecureBoot]
+// survives kernel updates, which [Kernel] doesn't.
+type Recipe struct {
+	// Name identifies the recipe (see [LookupRecipe]).
+	Name string
+	// Description describes the measured state.
+	Description string
+	// PCRs are the selected PCRs, in ascending order.
+	PCRs []uint
+}
+
+var (
+	// Firmware selects the PCRs of the platform firmware: its code (0) and
+	// configuration (1), and the code (2) and configuration (3) of the option
+	// ROMs. They change with firmware updates.
+	Firmware = Recipe{
+		Name:        "firmware",
+		Description: "platform firmware, option ROMs and their configuration",
+		PCRs:        []uint{0, 1, 2, 3},
+	}
+	// SecureBoot selects PCR 7: the Secure Boot state, its databases (PK,
+	// KEK, db, dbx) and the authorities which verified the boot components.
+	// It changes when Secure Boot is disabled or its databases are updated.
+	SecureBoot = Recipe{
+		Name:        "secure-boot",
+		Description: "Secure Boot state and databases",
+		PCRs:        []uint{7},
+	}
+	// Kernel selects the PCRs where GRUB measures the kernel command line
+	// and the commands it runs (8), and the files it loads, e.g. the kernel
+	// and the initrd (9). They change with kernel updates.
+	Kernel = Recipe{
+		Name:        "kernel",
+		Description: "kernel command line and files loaded by the boot loader",
+		PCRs:        []uint{8, 9},
+	}
+)
+
+// Recipes returns the predefined recipes.
+func Recipes() []Recipe {
+	return []Recipe{Firmware, SecureBoot, Kernel}
+}
+
+// LookupRecipe returns the predefined recipe name, or the combination of the
+// recipes of a name joined with "+" (see [Combine]), e.g.
+// "firmware+secure-boot".
+func LookupRecipe(name string) (Recipe, error) {
+	var recipes []Recipe
+	for _, n := range strings.Split(name, "+") {
+		i := slices.IndexFunc(Recipes(), func(r Recipe) bool { return r.Name == n })
+		if i < 0 {
+			return Recipe{}, fmt.Errorf("unknown PCR recipe %q", n)
+		}
+		recipes = append(recipes, Recipes()[i])
+	}
+	return Combine(recipes...), nil
+}
+
+// Combine returns the recipe selecting the PCRs of every recipe.
+func Combine(recipes ...Recipe) Recipe {
+	var (
+		names, descriptions []string
+		pcrs                []uint
+	)
+	for _, r := range recipes {
+		names = append(names, r.Name)
+		descriptions = append(descriptions, r.Description)
+		pcrs = append(pcrs, r.PCRs...)
+	}
+	return Recipe{
+		Name:        strings.Join(names, "+"),
+		Description: strings.Join(descriptions, "; "),
+		PCRs:        slices.Compact(slices.Sorted(slices.Values(pcrs))),
+	}
+}
+
+// Selection returns the selection of the PCRs of r in the alg bank.
+func (r Recipe) Selection(alg tpm2.TPMAlgID) tpm2.TPMLPCRSelection {
+	return Selection(alg, r.PCRs...)
+}
+
+// Read reads the PCRs of r in the alg bank.
+func (r Recipe) Read(tpm transport.TPM, alg tpm2.TPMAlgID) (*Bank, error) {
+	return Read(tpm, alg, r.PCRs...)
+}
+
+// Digest returns the composite digest of the PCRs of r in the alg bank after
+// measurements are extended (see [Replay]), as checked by TPM2_PolicyPCR: the
+// PCRs of r without measurement keep their reset value, zeros.
+func (r Recipe) Digest(alg tpm2.TPMAlgID, measurements []Measurement) ([]byte, error) {
+	var selected []Measurement
+	for _, m := range measurements {
+		if slices.Contains(r.PCRs, m.Index) {
+			selected = append(selected, m)
+		}
+	}
+	bank, err := Replay(alg, selected)
+	if err != nil {
+		return nil, err
+	}
+	h, err := alg.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported PCR bank: %w", err)
+	}
+	for _, idx := range r.PCRs {
+		if _, ok := bank.Values[idx]; !ok {
+			bank.Values[idx] = make([]byte, h.Size())
+		}
+	}
+	return bank.Digest(r.PCRs...)
+}
+
+// EventLogDigest returns the composite digest of the PCRs of r in the alg bank
+// from a binary TCG event log (see [ParseEventLog] and [Recipe.Digest]).
+//
+// Example, to seal to the Secure Boot state of the current boot:
+//
+//	log, err := os.ReadFile("/sys/kernel/security/tpm0/binary_bios_measurements")
+//	if err != nil {
+//	    return err
+//	}
+//	digest, err := pcr.SecureBoot.EventLogDigest(tpm2.TPMAlgSHA256, log)
+//	if err != nil {
+//	    return err
+//	}
+//	blob, err := unseal.Seal(tpm, secret, unseal.SealConfig{
+//	    PCRs:      pcr.SecureBoot.PCRs,
+//	    PCRDigest: digest,
+//	})
+func (r Recipe) EventLogDigest(alg tpm2.TPMAlgID, log []byte) ([]byte, error) {
+	measurements, err := ParseEventLog(log, alg)
+	if err != nil {
+		return nil, err
+	}
+	return r.Digest(alg, measurements)
+}
@@ -0,0 +1,67 @@
+package pcr_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupRecipe(t *testing.T) {
+	r, err := pcr.LookupRecipe("secure-boot")
+	require.NoError(t, err)
+	require.Equal(t, pcr.SecureBoot, r)
+
+	r, err = pcr.LookupRecipe("kernel+firmware+secure-boot")
+	require.NoError(t, err)
+	require.Equal(t, "kernel+firmware+secure-boot", r.Name)
+	require.Equal(t, []uint{0, 1, 2, 3, 7, 8, 9}, r.PCRs)
+
+	_, err = pcr.LookupRecipe("firmware+bootloader")
+	require.Error(t, err)
+}
+
+func TestRecipe_EventLogDigest(t *testing.T) {
+	// PCR 7 is extended twice from zeros.
+	pcr7 := make([]byte, sha256.Size)
+	for _, e := range bootEvents[2:4] {
+		digest := sha256.Sum256(e.data)
+		v := sha256.Sum256(append(pcr7, digest[:]...))
+		pcr7 = v[:]
+	}
+	want := sha256.Sum256(pcr7)
+
+	got, err := pcr.SecureBoot.EventLogDigest(tpm2.TPMAlgSHA256, eventLog(bootEvents...))
+	require.NoError(t, err)
+	require.Equal(t, want[:], got)
+
+	// The PCRs without event keep their reset value.
+	_, err = pcr.Firmware.EventLogDigest(tpm2.TPMAlgSHA256, eventLog(bootEvents...))
+	require.NoError(t, err)
+}
+
+func TestRecipe_Digest(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	alg := tpm2.TPMAlgSHA256
+
+	var measurements []pcr.Measurement
+	for _, e := range bootEvents {
+		if e.index != 8 && e.index != 9 {
+			continue
+		}
+		require.NoError(t, pcr.Extend(thetpm, uint(e.index), alg, e.data))
+		digest := sha256.Sum256(e.data)
+		measurements = append(measurements, pcr.Measurement{Index: uint(e.index), Digest: digest[:]})
+	}
+
+	predicted, err := pcr.Kernel.Digest(alg, measurements)
+	require.NoError(t, err)
+	bank, err := pcr.Kernel.Read(thetpm, alg)
+	require.NoError(t, err)
+	current, err := bank.Digest()
+	require.NoError(t, err)
+	require.Equal(t, current, predicted)
+}
@@ -0,0 +1,175 @@
+// Package persist provides helpers to make keys persistent in the TPM
+// (TPM2_EvictControl) and to manage the persistent handle space.
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/capability"
+)
+
+// Well-known persistent handles defined by the TCG TPM v2.0 Provisioning Guidance.
+const (
+	RSASRKHandle tpm2.TPMHandle = 0x81000001
+	ECCSRKHandle tpm2.TPMHandle = 0x81000002
+	RSAEKHandle  tpm2.TPMHandle = 0x81010001
+	ECCEKHandle  tpm2.TPMHandle = 0x81010002
+)
+
+// Range is an inclusive range of persistent handles, or of NV indexes.
+type Range struct {
+	First tpm2.TPMHandle
+	Last  tpm2.TPMHandle
+}
+
+// Contains reports whether h belongs to r.
+func (r Range) Contains(h tpm2.TPMHandle) bool {
+	return h >= r.First && h <= r.Last
+}
+
+// Persistent handle ranges reserved by the TCG Registry of Reserved TPM 2.0 Handles.
+var (
+	// StorageRange holds storage primary keys (SRKs).
+	StorageRange = Range{First: 0x81000000, Last: 0x8100FFFF}
+	// EndorsementRange holds endorsement primary keys (EKs).
+	EndorsementRange = Range{First: 0x81010000, Last: 0x8101FFFF}
+	// OwnerRange holds any other object persisted by the owner.
+	OwnerRange = Range{First: 0x81020000, Last: 0x817FFFFF}
+	// PlatformRange holds objects persisted by the platform hierarchy.
+	PlatformRange = Range{First: 0x81800000, Last: 0x81FFFFFF}
+)
+
+var (
+	// ErrHandleInUse is returned when the target persistent handle already holds an object.
+	ErrHandleInUse = errors.New("persistent handle already in use")
+	// ErrNotPersistent is returned when a handle is not in the persistent range.
+	ErrNotPersistent = errors.New("not a persistent handle")
+	// ErrRangeFull is returned by [Allocate] when every handle of the range is used.
+	ErrRangeFull = errors.New("no free persistent handle in range")
+)
+
+// Persist copies a loaded object to persistent memory at persistent.
+// The transient object stays loaded and must still be flushed by the caller.
+//
+// EvictControl is authorized by the hierarchy owning persistent: the
+// platform hierarchy for [PlatformRange], the owner hierarchy otherwise. By
+// default the hierarchy is authorized with an empty password; hierarchyAuth
+// overrides this session.
+//
+// Example:
+//
+//	srk, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+//	if err != nil {
+//	    return err
+//	}
+//	defer srk.Close()
+//
+//	persistent, err := persist.Persist(tpm, srk, persist.ECCSRKHandle)
+func Persist(tpm transport.TPM, transient tpmutil.Handle, persistent tpm2.TPMHandle, hierarchyAuth ...tpm2.Session) (tpmutil.Handle, error) {
+	if transient == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+	if !isPersistent(persistent) {
+		return nil, fmt.Errorf("%w: 0x%x", ErrNotPersistent, persistent)
+	}
+	used, err := IsUsed(tpm, persistent)
+	if err != nil {
+		return nil, err
+	}
+	if used {
+		return nil, fmt.Errorf("%w: 0x%x", ErrHandleInUse, persistent)
+	}
+
+	_, err = tpm2.EvictControl{
+		Auth:             tpmutil.ToAuthHandle(tpmutil.NewHandle(hierarchy(persistent)), hierarchyAuth...),
+		ObjectHandle:     &tpm2.NamedHandle{Handle: transient.Handle(), Name: transient.Name()},
+		PersistentHandle: persistent,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to persist object at 0x%x: %w", persistent, err)
+	}
+	return tpmutil.NewHandle(&tpm2.NamedHandle{Handle: persistent, Name: transient.Name()}), nil
+}
+
+// Evict removes a persistent object from the TPM.
+//
+// Like [Persist], EvictControl is authorized by the hierarchy owning
+// persistent, by default with an empty password; hierarchyAuth overrides this
+// session.
+func Evict(tpm transport.TPM, persistent tpm2.TPMHandle, hierarchyAuth ...tpm2.Session) error {
+	if !isPersistent(persistent) {
+		return fmt.Errorf("%w: 0x%x", ErrNotPersistent, persistent)
+	}
+	h, err := tpmutil.ToHandle(tpm, persistent)
+	if err != nil {
+		return err
+	}
+	_, err = tpm2.EvictControl{
+		Auth:             tpmutil.ToAuthHandle(tpmutil.NewHandle(hierarchy(persistent)), hierarchyAuth...),
+		ObjectHandle:     &tpm2.NamedHandle{Handle: persistent, Name: h.Name()},
+		PersistentHandle: persistent,
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to evict object at 0x%x: %w", persistent, err)
+	}
+	return nil
+}
+
+// ListPersistent returns every persistent handle currently used, in ascending order.
+func ListPersistent(tpm transport.TPM) ([]tpm2.TPMHandle, error) {
+	handles, err := capability.Handles(tpm, tpm2.TPMHTPersistent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent handles: %w", err)
+	}
+	return handles, nil
+}
+
+// IsUsed reports whether an object is persisted at h.
+func IsUsed(tpm transport.TPM, h tpm2.TPMHandle) (bool, error) {
+	handles, err := ListPersistent(tpm)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(handles, h), nil
+}
+
+// Allocate returns the lowest free handle of r.
+//
+// Note: the handle is not reserved, two concurrent callers may receive the same value.
+func Allocate(tpm transport.TPM, r Range) (tpm2.TPMHandle, error) {
+	handles, err := ListPersistent(tpm)
+	if err != nil {
+		return 0, err
+	}
+	candidate := r.First
+	for _, h := range handles {
+		if h < candidate {
+			continue
+		}
+		if h > candidate {
+			break
+		}
+		candidate++
+	}
+	if !r.Contains(candidate) {
+		return 0, fmt.Errorf("%w [0x%x, 0x%x]", ErrRangeFull, r.First, r.Last)
+	}
+	return candidate, nil
+}
+
+func isPersistent(h tpm2.TPMHandle) bool {
+	return uint32(h)>>24 == uint32(tpm2.TPMHTPersistent)
+}
+
+// hierarchy returns the hierarchy authorizing EvictControl for persistent.
+func hierarchy(persistent tpm2.TPMHandle) tpm2.TPMHandle {
+	if PlatformRange.Contains(persistent) {
+		return tpm2.TPMRHPlatform
+	}
+	return tpm2.TPMRHOwner
+}
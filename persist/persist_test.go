@@ -0,0 +1,105 @@
+package persist_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/persist"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersistAndEvict(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	persistent, err := persist.Persist(thetpm, srk, persist.ECCSRKHandle)
+	require.NoError(t, err)
+	require.Equal(t, persist.ECCSRKHandle, persistent.Handle())
+	require.Equal(t, srk.Name(), persistent.Name())
+
+	handles, err := persist.ListPersistent(thetpm)
+	require.NoError(t, err)
+	require.Contains(t, handles, persist.ECCSRKHandle)
+
+	// The persistent copy is usable as a parent.
+	rsp, err := tpm2.ReadPublic{ObjectHandle: persist.ECCSRKHandle}.Execute(thetpm)
+	require.NoError(t, err)
+	require.Equal(t, srk.Name(), rsp.Name)
+
+	// A second object can't take the same slot.
+	_, err = persist.Persist(thetpm, srk, persist.ECCSRKHandle)
+	require.ErrorIs(t, err, persist.ErrHandleInUse)
+
+	require.NoError(t, persist.Evict(thetpm, persist.ECCSRKHandle))
+	used, err := persist.IsUsed(thetpm, persist.ECCSRKHandle)
+	require.NoError(t, err)
+	require.False(t, used)
+}
+
+func TestPersistAndEvict_Platform(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: tpm2.TPMRHPlatform,
+		InPublic:      tpmutil.ECCSRKTemplate,
+	})
+	require.NoError(t, err)
+	defer key.Close()
+
+	// EvictControl is authorized by the platform hierarchy in its range.
+	h := persist.PlatformRange.First
+	persistent, err := persist.Persist(thetpm, key, h)
+	require.NoError(t, err)
+	require.Equal(t, h, persistent.Handle())
+
+	require.NoError(t, persist.Evict(thetpm, h))
+	used, err := persist.IsUsed(thetpm, h)
+	require.NoError(t, err)
+	require.False(t, used)
+}
+
+func TestPersist_NotPersistentHandle(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	_, err = persist.Persist(thetpm, srk, tpm2.TPMHandle(0x80000001))
+	require.ErrorIs(t, err, persist.ErrNotPersistent)
+	require.ErrorIs(t, persist.Evict(thetpm, tpm2.TPMRHOwner), persist.ErrNotPersistent)
+}
+
+func TestAllocate(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	r := persist.Range{First: persist.OwnerRange.First, Last: persist.OwnerRange.First + 1}
+
+	var allocated []tpm2.TPMHandle
+	for range 2 {
+		h, err := persist.Allocate(thetpm, r)
+		require.NoError(t, err)
+		require.True(t, r.Contains(h))
+		_, err = persist.Persist(thetpm, srk, h)
+		require.NoError(t, err)
+		allocated = append(allocated, h)
+	}
+	t.Cleanup(func() {
+		for _, h := range allocated {
+			require.NoError(t, persist.Evict(thetpm, h))
+		}
+	})
+	require.Equal(t, []tpm2.TPMHandle{r.First, r.Last}, allocated)
+
+	_, err = persist.Allocate(thetpm, r)
+	require.ErrorIs(t, err, persist.ErrRangeFull)
+}
@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"crypto"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Authorize extends calc with a PolicyAuthorize assertion: the resulting
+// digest delegates the policy of an object to authority, which can approve
+// new policies later on (see [Approve]) without the object being recreated.
+//
+// calc is expected to be empty: PolicyAuthorize resets the session digest.
+func Authorize(calc *tpm2.PolicyCalculator, authority crypto.PublicKey, policyRef []byte) error {
+	public, err := ExternalKey(authority)
+	if err != nil {
+		return err
+	}
+	name, err := tpm2.ObjectName(&public)
+	if err != nil {
+		return err
+	}
+	return tpm2.PolicyAuthorize{
+		KeySign:   *name,
+		PolicyRef: tpm2.TPM2BDigest{Buffer: policyRef},
+	}.Update(calc)
+}
+
+// ApprovedPolicy is a policy digest signed by an authority.
+type ApprovedPolicy struct {
+	// Digest is the approved policy digest.
+	Digest []byte
+	// PolicyRef qualifies the approval.
+	PolicyRef []byte
+	// Signature covers H(Digest || PolicyRef).
+	Signature tpm2.TPMTSignature
+}
+
+// Approve signs policyDigest with the authority key. This runs in software on
+// the side of the authority.
+func Approve(signer crypto.Signer, policyDigest, policyRef []byte) (*ApprovedPolicy, error) {
+	sig, err := sign(signer, policyDigest, policyRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to approve policy: %w", err)
+	}
+	return &ApprovedPolicy{
+		Digest:    policyDigest,
+		PolicyRef: policyRef,
+		Signature: sig,
+	}, nil
+}
+
+// SatisfyAuthorize runs PolicyAuthorize in the policy session, after the
+// TPM checked the approval signature with the public key of authority.
+//
+// The assertions of the approved policy must have been run in the session
+// beforehand: PolicyAuthorize only succeeds if the session digest equals
+// approved.Digest.
+func SatisfyAuthorize(tpm transport.TPM, session tpm2.TPMISHPolicy, authority crypto.PublicKey, approved *ApprovedPolicy) error {
+	public, err := ExternalKey(authority)
+	if err != nil {
+		return err
+	}
+	key, err := loadExternal(tpm, public)
+	if err != nil {
+		return err
+	}
+	defer key.Close() //nolint:errcheck
+
+	h := crypto.SHA256.New()
+	h.Write(approved.Digest)
+	h.Write(approved.PolicyRef)
+	verified, err := tpm2.VerifySignature{
+		KeyHandle: key,
+		Digest:    tpm2.TPM2BDigest{Buffer: h.Sum(nil)},
+		Signature: approved.Signature,
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("invalid policy approval: %w", err)
+	}
+
+	_, err = tpm2.PolicyAuthorize{
+		PolicySession:  session,
+		ApprovedPolicy: tpm2.TPM2BDigest{Buffer: approved.Digest},
+		PolicyRef:      tpm2.TPM2BDigest{Buffer: approved.PolicyRef},
+		KeySign:        key.Name(),
+		CheckTicket:    verified.Validation,
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("PolicyAuthorize failed: %w", err)
+	}
+	return nil
+}
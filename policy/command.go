@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// maxCommands is the maximum number of commands of [CommandsPolicy]: the
+// branches of a PolicyOR.
+const maxCommands = 8
+
+// CommandsPolicy returns the policy digest, computed with alg (the name
+// algorithm of the object), restricting an object to the commands ccs: for
+// each command, PolicyCommandCode followed by PolicyAuthValue, so that the
+// authorization value of the object is still required, and the PolicyOR of
+// these branches when there are several commands.
+//
+// Up to 8 commands are supported. The object is used through
+// [SatisfyCommand].
+func CommandsPolicy(alg tpm2.TPMIAlgHash, ccs ...tpm2.TPMCC) ([]byte, error) {
+	branches, err := commandBranches(alg, ccs)
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) == 1 {
+		return branches[0], nil
+	}
+	calc, err := tpm2.NewPolicyCalculator(alg)
+	if err != nil {
+		return nil, err
+	}
+	if err := orCommand(branches).Update(calc); err != nil {
+		return nil, fmt.Errorf("failed to compute policy: %w", err)
+	}
+	return calc.Hash().Digest, nil
+}
+
+// SatisfyCommand runs in the policy session the branch of
+// CommandsPolicy(alg, ccs...) allowing cc. The session must prove the
+// authorization value of the object (tpm2.Auth).
+//
+// Example:
+//
+//	sess := tpm2.Policy(tpm2.TPMAlgSHA256, 16, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+//	    return policy.SatisfyCommand(tpm, handle, tpm2.TPMAlgSHA256, tpm2.TPMCCSign, tpm2.TPMCCSign)
+//	}, tpm2.Auth(keyAuth))
+func SatisfyCommand(tpm transport.TPM, session tpm2.TPMISHPolicy, alg tpm2.TPMIAlgHash, cc tpm2.TPMCC, ccs ...tpm2.TPMCC) error {
+	branches, err := commandBranches(alg, ccs)
+	if err != nil {
+		return err
+	}
+	if _, err := (tpm2.PolicyCommandCode{PolicySession: session, Code: cc}).Execute(tpm); err != nil {
+		return fmt.Errorf("PolicyCommandCode failed: %w", err)
+	}
+	if _, err := (tpm2.PolicyAuthValue{PolicySession: session}).Execute(tpm); err != nil {
+		return fmt.Errorf("PolicyAuthValue failed: %w", err)
+	}
+	if len(branches) == 1 {
+		return nil
+	}
+	cmd := orCommand(branches)
+	cmd.PolicySession = session
+	if _, err := cmd.Execute(tpm); err != nil {
+		return fmt.Errorf("PolicyOR failed: %w", err)
+	}
+	return nil
+}
+
+// commandBranches returns the policy digests of the branches of
+// [CommandsPolicy].
+func commandBranches(alg tpm2.TPMIAlgHash, ccs []tpm2.TPMCC) ([][]byte, error) {
+	if len(ccs) == 0 {
+		return nil, errors.New("missing commands")
+	}
+	if len(ccs) > maxCommands {
+		return nil, fmt.Errorf("too many commands: %d, maximum is %d", len(ccs), maxCommands)
+	}
+	if len(slices.Compact(slices.Sorted(slices.Values(ccs)))) != len(ccs) {
+		return nil, errors.New("duplicate commands")
+	}
+	branches := make([][]byte, 0, len(ccs))
+	for _, cc := range ccs {
+		calc, err := tpm2.NewPolicyCalculator(alg)
+		if err != nil {
+			return nil, err
+		}
+		if err := (tpm2.PolicyCommandCode{Code: cc}).Update(calc); err != nil {
+			return nil, fmt.Errorf("failed to compute command policy: %w", err)
+		}
+		if err := (tpm2.PolicyAuthValue{}).Update(calc); err != nil {
+			return nil, fmt.Errorf("failed to compute password policy: %w", err)
+		}
+		branches = append(branches, calc.Hash().Digest)
+	}
+	return branches, nil
+}
+
+func orCommand(branches [][]byte) tpm2.PolicyOr {
+	var list tpm2.TPMLDigest
+	for _, b := range branches {
+		list.Digests = append(list.Digests, tpm2.TPM2BDigest{Buffer: b})
+	}
+	return tpm2.PolicyOr{PHashList: list}
+}
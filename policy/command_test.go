@@ -0,0 +1,113 @@
+package policy_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/policy"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandsPolicy(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	srk := testutil.NewFixtures(t, thetpm).SRK(t)
+	auth := []byte("key password")
+
+	// A duplicable signing key, which may only sign.
+	template := templates.ECCSigner(templates.WithCommands(tpm2.TPMCCSign))
+	template.ObjectAttributes.FixedTPM = false
+	template.ObjectAttributes.FixedParent = false
+	key, err := tpmutil.Create(thetpm, tpmutil.CreateConfig{
+		ParentHandle: srk,
+		InPublic:     template,
+		UserAuth:     auth,
+	})
+	require.NoError(t, err)
+	defer key.Close()
+
+	session := func(cc tpm2.TPMCC, ccs ...tpm2.TPMCC) tpm2.Session {
+		return tpm2.Policy(tpm2.TPMAlgSHA256, 16, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+			return policy.SatisfyCommand(tpm, handle, tpm2.TPMAlgSHA256, cc, ccs...)
+		}, tpm2.Auth(auth))
+	}
+	sign := func(auth tpm2.Session) error {
+		_, err := tpm2.Sign{
+			KeyHandle:  tpmutil.ToAuthHandle(key, auth),
+			Digest:     tpm2.TPM2BDigest{Buffer: make([]byte, 32)},
+			InScheme:   tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgECDSA, Details: tpm2.NewTPMUSigScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSchemeHash{HashAlg: tpm2.TPMAlgSHA256})},
+			Validation: tpmutil.NullTicket,
+		}.Execute(thetpm)
+		return err
+	}
+
+	require.NoError(t, sign(session(tpm2.TPMCCSign, tpm2.TPMCCSign)))
+	// The authorization value is still required.
+	require.Error(t, sign(tpm2.Policy(tpm2.TPMAlgSHA256, 16, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+		return policy.SatisfyCommand(tpm, handle, tpm2.TPMAlgSHA256, tpm2.TPMCCSign, tpm2.TPMCCSign)
+	}, tpm2.Auth([]byte("wrong password")))))
+	// The authorization value alone is no longer enough.
+	require.ErrorIs(t, sign(tpm2.PasswordAuth(auth)), tpm2.TPMRCAuthUnavailable)
+
+	// Certification (admin role) is denied.
+	_, err = tpm2.Certify{
+		ObjectHandle: tpmutil.ToAuthHandle(key, session(tpm2.TPMCCSign, tpm2.TPMCCSign)),
+		SignHandle:   tpm2.AuthHandle{Handle: tpm2.TPMRHNull, Auth: tpm2.PasswordAuth(nil)},
+		InScheme:     tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+	}.Execute(thetpm)
+	require.ErrorIs(t, err, tpm2.TPMRCPolicyCC)
+
+	// Duplication is denied: the Duplicate branch isn't in the policy.
+	_, err = tpm2.Duplicate{
+		ObjectHandle:    tpmutil.ToAuthHandle(key, session(tpm2.TPMCCDuplicate, tpm2.TPMCCDuplicate)),
+		NewParentHandle: tpm2.NamedHandle{Handle: tpm2.TPMRHNull, Name: tpm2.HandleName(tpm2.TPMRHNull)},
+		Symmetric:       tpm2.TPMTSymDef{Algorithm: tpm2.TPMAlgNull},
+	}.Execute(thetpm)
+	require.ErrorIs(t, err, tpm2.TPMRCPolicyFail)
+}
+
+func TestCommandsPolicy_Branches(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	srk := testutil.NewFixtures(t, thetpm).SRK(t)
+	auth := []byte("key password")
+	ccs := []tpm2.TPMCC{tpm2.TPMCCSign, tpm2.TPMCCCertify}
+
+	key, err := tpmutil.Create(thetpm, tpmutil.CreateConfig{
+		ParentHandle: srk,
+		InPublic:     templates.ECCSigner(templates.WithCommands(ccs...)),
+		UserAuth:     auth,
+	})
+	require.NoError(t, err)
+	defer key.Close()
+
+	// Each command is satisfied by its own branch.
+	for _, cc := range ccs {
+		sess := tpm2.Policy(tpm2.TPMAlgSHA256, 16, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+			return policy.SatisfyCommand(tpm, handle, tpm2.TPMAlgSHA256, cc, ccs...)
+		}, tpm2.Auth(auth))
+		if cc == tpm2.TPMCCSign {
+			_, err = tpm2.Sign{
+				KeyHandle:  tpmutil.ToAuthHandle(key, sess),
+				Digest:     tpm2.TPM2BDigest{Buffer: make([]byte, 32)},
+				InScheme:   tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgECDSA, Details: tpm2.NewTPMUSigScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSchemeHash{HashAlg: tpm2.TPMAlgSHA256})},
+				Validation: tpmutil.NullTicket,
+			}.Execute(thetpm)
+		} else {
+			_, err = tpm2.Certify{
+				ObjectHandle: tpmutil.ToAuthHandle(key, sess),
+				SignHandle:   tpm2.AuthHandle{Handle: tpm2.TPMRHNull, Auth: tpm2.PasswordAuth(nil)},
+				InScheme:     tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+			}.Execute(thetpm)
+		}
+		require.NoError(t, err, "command 0x%x", cc)
+	}
+
+	_, err = policy.CommandsPolicy(tpm2.TPMAlgSHA256)
+	require.Error(t, err)
+	_, err = policy.CommandsPolicy(tpm2.TPMAlgSHA256, tpm2.TPMCCSign, tpm2.TPMCCSign)
+	require.Error(t, err)
+	require.Panics(t, func() { templates.ECCSigner(templates.WithCommands()) })
+}
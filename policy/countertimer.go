@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/rawcmd"
+)
+
+// Offsets of the fields of TPMS_TIME_INFO compared by PolicyCounterTimer.
+const (
+	// OffsetTime is the offset of time, the milliseconds since the last TPM
+	// reset or restart.
+	OffsetTime uint16 = 0
+	// OffsetClock is the offset of clock, the milliseconds the TPM was
+	// powered since its last TPM2_Clear. It only moves forward.
+	OffsetClock uint16 = 8
+	// OffsetResetCount is the offset of resetCount, the number of TPM
+	// resets (reboots) since the last TPM2_Clear.
+	OffsetResetCount uint16 = 16
+	// OffsetRestartCount is the offset of restartCount, the number of TPM
+	// restarts (resume from hibernation) since the last TPM reset.
+	OffsetRestartCount uint16 = 20
+)
+
+// TimeCondition is the condition of a PolicyCounterTimer assertion: the
+// field of TPMS_TIME_INFO at Offset compared to OperandB with Operation.
+type TimeCondition struct {
+	// OperandB is the big-endian value compared to the field.
+	OperandB []byte
+	// Offset is the offset of the field in TPMS_TIME_INFO, e.g. [OffsetClock].
+	Offset uint16
+	// Operation is the comparison, e.g. tpm2.TPMEOUnsignedLT for field <
+	// OperandB.
+	Operation tpm2.TPMEO
+}
+
+// ClockBefore returns the condition satisfied while the TPM clock is below
+// clock, e.g. the clock read by clock.Read plus a validity period.
+//
+// The clock only advances while the TPM is powered: it measures the usage
+// time of the device rather than the wall-clock time.
+func ClockBefore(clock time.Duration) TimeCondition {
+	return TimeCondition{
+		OperandB:  binary.BigEndian.AppendUint64(nil, uint64(clock.Milliseconds())),
+		Offset:    OffsetClock,
+		Operation: tpm2.TPMEOUnsignedLT,
+	}
+}
+
+// ClockAfter returns the condition satisfied once the TPM clock reaches clock.
+func ClockAfter(clock time.Duration) TimeCondition {
+	return TimeCondition{
+		OperandB:  binary.BigEndian.AppendUint64(nil, uint64(clock.Milliseconds())),
+		Offset:    OffsetClock,
+		Operation: tpm2.TPMEOUnsignedGE,
+	}
+}
+
+// ResetCountBelow returns the condition satisfied while the reset count of
+// the TPM is below count. Sealing with the current reset count plus n limits
+// the use of an object to the next n-1 reboots:
+//
+//	now, err := clock.Read(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	cond := policy.ResetCountBelow(now.ResetCount + n)
+func ResetCountBelow(count uint32) TimeCondition {
+	return TimeCondition{
+		OperandB:  binary.BigEndian.AppendUint32(nil, count),
+		Offset:    OffsetResetCount,
+		Operation: tpm2.TPMEOUnsignedLT,
+	}
+}
+
+// CounterTimer extends calc with a PolicyCounterTimer assertion: the policy
+// is satisfied while cond holds (see [SatisfyCounterTimer]).
+func CounterTimer(calc *tpm2.PolicyCalculator, cond TimeCondition) error {
+	h, err := calc.Hash().HashAlg.Hash()
+	if err != nil {
+		return err
+	}
+	// args = H(operandB || offset || operation)
+	args := h.New()
+	args.Write(cond.OperandB)
+	args.Write(binary.BigEndian.AppendUint16(nil, cond.Offset))
+	args.Write(binary.BigEndian.AppendUint16(nil, uint16(cond.Operation)))
+	return calc.Update(tpm2.TPMCCPolicyCounterTimer, args.Sum(nil))
+}
+
+// SatisfyCounterTimer runs PolicyCounterTimer in the policy session: the TPM
+// compares its current TPMS_TIME_INFO with cond and returns TPM_RC_POLICY if
+// cond doesn't hold.
+//
+// go-tpm doesn't implement TPM2_PolicyCounterTimer, which is sent without
+// session: its parameters aren't secret.
+func SatisfyCounterTimer(tpm transport.TPM, session tpm2.TPMISHPolicy, cond TimeCondition) error {
+	// TPM2B_OPERAND operandB, UINT16 offset, TPM_EO operation.
+	params := binary.BigEndian.AppendUint16(nil, uint16(len(cond.OperandB)))
+	params = append(params, cond.OperandB...)
+	params = binary.BigEndian.AppendUint16(params, cond.Offset)
+	params = binary.BigEndian.AppendUint16(params, uint16(cond.Operation))
+	if err := rawcmd.ExecuteNoSessions(tpm, tpm2.TPMCCPolicyCounterTimer, []tpm2.TPMHandle{session}, params); err != nil {
+		return fmt.Errorf("PolicyCounterTimer failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package policy_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/clock"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/policy"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyCounterTimer(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	now, err := clock.Read(thetpm)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name string
+		cond policy.TimeCondition
+		// before and after report whether the policy is satisfied before and
+		// after the clock is advanced by an hour.
+		before, after bool
+	}{
+		{"before deadline", policy.ClockBefore(now.Clock + 30*time.Minute), true, false},
+		{"after embargo", policy.ClockAfter(now.Clock + 30*time.Minute), false, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+			require.NoError(t, err)
+			require.NoError(t, policy.CounterTimer(calc, tt.cond))
+			secret := []byte("time-limited secret")
+			sealed := seal(t, thetpm, calc.Hash().Digest, secret)
+
+			unsealed := func(want bool) {
+				t.Helper()
+				got, err := unseal(thetpm, sealed, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+					return policy.SatisfyCounterTimer(tpm, handle, tt.cond)
+				})
+				if want {
+					require.NoError(t, err)
+					require.Equal(t, secret, got)
+				} else {
+					require.ErrorIs(t, err, tpm2.TPMRCPolicy)
+				}
+			}
+			unsealed(tt.before)
+			_, err = clock.Advance(thetpm, time.Hour, nil)
+			require.NoError(t, err)
+			unsealed(tt.after)
+		})
+	}
+}
+
+func TestPolicyCounterTimer_ResetCount(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	now, err := clock.Read(thetpm)
+	require.NoError(t, err)
+	resets := now.ResetCount
+
+	calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+	require.NoError(t, err)
+	cond := policy.ResetCountBelow(resets + 1)
+	require.NoError(t, policy.CounterTimer(calc, cond))
+	secret := []byte("until next reboot")
+	sealed := seal(t, thetpm, calc.Hash().Digest, secret)
+
+	got, err := unseal(thetpm, sealed, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+		return policy.SatisfyCounterTimer(tpm, handle, cond)
+	})
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+
+	// A condition of another reset count doesn't match the policy digest.
+	_, err = unseal(thetpm, sealed, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+		return policy.SatisfyCounterTimer(tpm, handle, policy.ResetCountBelow(resets+2))
+	})
+	require.True(t, errors.Is(err, tpm2.TPMRCPolicyFail), "got %v", err)
+	err = policy.SatisfyCounterTimer(thetpm, tpm2.TPMHandle(0x03000000), policy.ResetCountBelow(resets))
+	require.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// endorsementSecret returns the PolicySecret(TPM_RH_ENDORSEMENT) assertion,
+// the authPolicy of the EKs created from the TCG default templates.
+func endorsementSecret(endorsementAuth []tpm2.Session) tpm2.PolicySecret {
+	auth := tpm2.PasswordAuth(nil)
+	if len(endorsementAuth) > 0 {
+		auth = endorsementAuth[0]
+	}
+	return tpm2.PolicySecret{
+		AuthHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMRHEndorsement,
+			Auth:   auth,
+		},
+	}
+}
+
+// Endorsement returns an inline policy session authorizing the use of an EK
+// created from a TCG default template (e.g. as a parent or in
+// ActivateCredential). The policy is satisfied again for every command.
+//
+// By default the endorsement hierarchy is authorized with an empty password;
+// endorsementAuth overrides this session.
+func Endorsement(endorsementAuth ...tpm2.Session) tpm2.Session {
+	return tpm2.Policy(tpm2.TPMAlgSHA256, 16, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, nonceTPM tpm2.TPM2BNonce) error {
+		cmd := endorsementSecret(endorsementAuth)
+		cmd.PolicySession = handle
+		cmd.NonceTPM = nonceTPM
+		_, err := cmd.Execute(tpm)
+		return err
+	})
+}
+
+// EndorsementSession starts a policy session and satisfies the default EK
+// policy in it. The caller must call the returned closer to flush the session.
+//
+// The TPM resets a policy session once it has authorized a command: the
+// session is good for a single use of the EK. Prefer [Endorsement] when the
+// EK is used several times.
+//
+// Example:
+//
+//	sess, closer, err := policy.EndorsementSession(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	defer closer()
+//
+//	rsp, err := tpm2.ActivateCredential{
+//	    ActivateHandle: tpm2.AuthHandle{Handle: akHandle, Name: akName, Auth: tpm2.PasswordAuth(nil)},
+//	    KeyHandle:      tpm2.AuthHandle{Handle: ekHandle, Name: ekName, Auth: sess},
+//	    // ...
+//	}.Execute(tpm)
+func EndorsementSession(tpm transport.TPM, endorsementAuth ...tpm2.Session) (tpm2.Session, func() error, error) {
+	sess, closer, err := tpm2.PolicySession(tpm, tpm2.TPMAlgSHA256, 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start policy session: %w", err)
+	}
+	cmd := endorsementSecret(endorsementAuth)
+	cmd.PolicySession = sess.Handle()
+	cmd.NonceTPM = sess.NonceTPM()
+	if _, err := cmd.Execute(tpm); err != nil {
+		_ = closer()
+		return nil, nil, fmt.Errorf("failed to satisfy endorsement policy: %w", err)
+	}
+	return sess, closer, nil
+}
@@ -0,0 +1,90 @@
+package policy_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/policy"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+var childTemplate = templates.ECCSigner()
+
+// createUnderEK creates a key under ek, which requires its user authorization.
+func createUnderEK(thetpm transport.TPM, ek tpmutil.Handle, auth tpm2.Session) error {
+	_, err := tpmutil.CreateWithResult(thetpm, tpmutil.CreateConfig{
+		ParentHandle: ek,
+		ParentAuth:   auth,
+		InPublic:     childTemplate,
+	})
+	return err
+}
+
+func TestEndorsementSession(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	ek, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: tpm2.TPMRHEndorsement,
+		InPublic:      tpm2.RSAEKTemplate,
+	})
+	require.NoError(t, err)
+	defer ek.Close()
+
+	// The EK has no userWithAuth: a password is rejected.
+	require.Error(t, createUnderEK(thetpm, ek, tpm2.PasswordAuth(nil)))
+
+	sess, closer, err := policy.EndorsementSession(thetpm)
+	require.NoError(t, err)
+	defer closer()
+	require.NoError(t, createUnderEK(thetpm, ek, sess))
+
+	// The policy session is reset after one use.
+	require.Error(t, createUnderEK(thetpm, ek, sess))
+
+	inline := policy.Endorsement()
+	require.NoError(t, createUnderEK(thetpm, ek, inline))
+	require.NoError(t, createUnderEK(thetpm, ek, inline))
+}
+
+func TestEndorsementSession_HierarchyAuth(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	endorsementAuth := []byte("endorsement-password")
+	_, err := tpm2.HierarchyChangeAuth{
+		AuthHandle: tpm2.TPMRHEndorsement,
+		NewAuth:    tpm2.TPM2BAuth{Buffer: endorsementAuth},
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := tpm2.HierarchyChangeAuth{
+			AuthHandle: tpm2.AuthHandle{
+				Handle: tpm2.TPMRHEndorsement,
+				Auth:   tpm2.PasswordAuth(endorsementAuth),
+			},
+		}.Execute(thetpm)
+		require.NoError(t, err)
+	})
+
+	ek, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: tpm2.TPMRHEndorsement,
+		Auth:          tpm2.PasswordAuth(endorsementAuth),
+		InPublic:      tpm2.RSAEKTemplate,
+	})
+	require.NoError(t, err)
+	defer ek.Close()
+
+	_, _, err = policy.EndorsementSession(thetpm)
+	require.Error(t, err)
+
+	sess, closer, err := policy.EndorsementSession(thetpm, tpm2.PasswordAuth(endorsementAuth))
+	require.NoError(t, err)
+	defer closer()
+	require.NoError(t, createUnderEK(thetpm, ek, sess))
+
+	require.Error(t, createUnderEK(thetpm, ek, policy.Endorsement()))
+	require.NoError(t, createUnderEK(thetpm, ek, policy.Endorsement(tpm2.PasswordAuth(endorsementAuth))))
+}
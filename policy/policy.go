@@ -0,0 +1,130 @@
+// Package policy contains helpers to build and satisfy TPM enhanced
+// authorization (EA) policies.
+//
+// Policies involving an external key (PolicySigned, PolicyAuthorize) use
+// SHA-256 both as name algorithm of the key and as signature hash.
+package policy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+)
+
+// ErrUnsupportedKey is returned for keys which can't authorize policies.
+var ErrUnsupportedKey = errors.New("unsupported authorization key")
+
+// ExternalKey returns the public area of a software signing key, as loaded
+// in the TPM to check its signatures. Its name identifies the key in policies.
+func ExternalKey(pub crypto.PublicKey) (tpm2.TPMTPublic, error) {
+	public := tpm2.TPMTPublic{
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			SignEncrypt:  true,
+			UserWithAuth: true,
+		},
+	}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		exponent := uint32(k.E)
+		if k.E == 65537 {
+			exponent = 0
+		}
+		public.Type = tpm2.TPMAlgRSA
+		public.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgRSA, &tpm2.TPMSRSAParms{
+			Scheme: tpm2.TPMTRSAScheme{
+				Scheme: tpm2.TPMAlgRSASSA,
+				Details: tpm2.NewTPMUAsymScheme(
+					tpm2.TPMAlgRSASSA,
+					&tpm2.TPMSSigSchemeRSASSA{HashAlg: tpm2.TPMAlgSHA256},
+				),
+			},
+			KeyBits:  tpm2.TPMKeyBits(k.N.BitLen()),
+			Exponent: exponent,
+		})
+		public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgRSA, &tpm2.TPM2BPublicKeyRSA{Buffer: k.N.Bytes()})
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return tpm2.TPMTPublic{}, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve.Params().Name)
+		}
+		public.Type = tpm2.TPMAlgECC
+		public.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+			Scheme: tpm2.TPMTECCScheme{
+				Scheme: tpm2.TPMAlgECDSA,
+				Details: tpm2.NewTPMUAsymScheme(
+					tpm2.TPMAlgECDSA,
+					&tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256},
+				),
+			},
+			CurveID: tpm2.TPMECCNistP256,
+		})
+		public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+			X: tpm2.TPM2BECCParameter{Buffer: k.X.FillBytes(make([]byte, 32))},
+			Y: tpm2.TPM2BECCParameter{Buffer: k.Y.FillBytes(make([]byte, 32))},
+		})
+	default:
+		return tpm2.TPMTPublic{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+	return public, nil
+}
+
+// loadExternal loads the public area of an authorization key in the owner
+// hierarchy, so that the tickets it produces are valid.
+func loadExternal(tpm transport.TPM, public tpm2.TPMTPublic) (tpmutil.HandleCloser, error) {
+	rsp, err := tpm2.LoadExternal{
+		InPublic:  tpm2.New2B(public),
+		Hierarchy: tpm2.TPMRHOwner,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load authorization key: %w", err)
+	}
+	return tpmutil.NewHandleCloser(tpm, &tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}), nil
+}
+
+// sign signs the SHA-256 digest of data with signer and converts the result
+// to a TPM signature.
+func sign(signer crypto.Signer, data ...[]byte) (tpm2.TPMTSignature, error) {
+	h := crypto.SHA256.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	sig, err := signer.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return tpm2.TPMTSignature{}, err
+	}
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		return tpm2.TPMTSignature{
+			SigAlg: tpm2.TPMAlgRSASSA,
+			Signature: tpm2.NewTPMUSignature(tpm2.TPMAlgRSASSA, &tpm2.TPMSSignatureRSA{
+				Hash: tpm2.TPMAlgSHA256,
+				Sig:  tpm2.TPM2BPublicKeyRSA{Buffer: sig},
+			}),
+		}, nil
+	case *ecdsa.PublicKey:
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+			return tpm2.TPMTSignature{}, fmt.Errorf("invalid ECDSA signature: %w", err)
+		}
+		return tpm2.TPMTSignature{
+			SigAlg: tpm2.TPMAlgECDSA,
+			Signature: tpm2.NewTPMUSignature(tpm2.TPMAlgECDSA, &tpm2.TPMSSignatureECC{
+				Hash:       tpm2.TPMAlgSHA256,
+				SignatureR: tpm2.TPM2BECCParameter{Buffer: rs.R.FillBytes(make([]byte, 32))},
+				SignatureS: tpm2.TPM2BECCParameter{Buffer: rs.S.FillBytes(make([]byte, 32))},
+			}),
+		}, nil
+	default:
+		return tpm2.TPMTSignature{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, signer.Public())
+	}
+}
@@ -0,0 +1,183 @@
+package policy_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/loicsikidi/tpm-stuff/policy"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+const debugPCR = 16
+
+// seal creates a sealed object under a fresh SRK, only usable through policyDigest.
+func seal(t *testing.T, thetpm transport.TPM, policyDigest, secret []byte) tpmutil.HandleCloser {
+	t.Helper()
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	t.Cleanup(func() { srk.Close() })
+
+	sealed, err := tpmutil.Create(thetpm, tpmutil.CreateConfig{
+		ParentHandle: srk,
+		InPublic:     templates.Seal(templates.WithPolicy(policyDigest)),
+		SealingData:  secret,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { sealed.Close() })
+	return sealed
+}
+
+func unseal(thetpm transport.TPM, sealed tpmutil.Handle, callback tpm2.PolicyCallback) ([]byte, error) {
+	rsp, err := tpm2.Unseal{
+		ItemHandle: tpmutil.ToAuthHandle(sealed, tpm2.Policy(tpm2.TPMAlgSHA256, 16, callback)),
+	}.Execute(thetpm)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.OutData.Buffer, nil
+}
+
+func TestPolicySigned(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	for name, authority := range map[string]crypto.Signer{"RSA": rsaKey, "ECDSA": ecdsaKey} {
+		t.Run(name, func(t *testing.T) {
+			policyRef := []byte("unseal-secret")
+			calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+			require.NoError(t, err)
+			require.NoError(t, policy.Signed(calc, authority.Public(), policyRef))
+
+			secret := []byte("released by the authority")
+			sealed := seal(t, thetpm, calc.Hash().Digest, secret)
+
+			// The authority signs the nonce of the session, with a 60s validity.
+			got, err := unseal(thetpm, sealed, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, nonceTPM tpm2.TPM2BNonce) error {
+				auth, err := policy.SignAuthorization(authority, nonceTPM.Buffer, 60, nil, policyRef)
+				if err != nil {
+					return err
+				}
+				_, err = policy.SatisfySigned(tpm, handle, authority.Public(), auth)
+				return err
+			})
+			require.NoError(t, err)
+			require.Equal(t, secret, got)
+
+			// An authorization for another session can't be replayed.
+			stale, err := policy.SignAuthorization(authority, []byte("another session nonce"), 60, nil, policyRef)
+			require.NoError(t, err)
+			_, err = unseal(thetpm, sealed, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+				_, err := policy.SatisfySigned(tpm, handle, authority.Public(), stale)
+				return err
+			})
+			require.Error(t, err)
+
+			// Another key can't authorize.
+			other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			require.NoError(t, err)
+			_, err = unseal(thetpm, sealed, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, nonceTPM tpm2.TPM2BNonce) error {
+				auth, err := policy.SignAuthorization(other, nonceTPM.Buffer, 60, nil, policyRef)
+				if err != nil {
+					return err
+				}
+				_, err = policy.SatisfySigned(tpm, handle, other.Public(), auth)
+				return err
+			})
+			require.Error(t, err)
+		})
+	}
+}
+
+// pcrPolicy returns PolicyPCR on the debug PCR with its current value.
+func pcrPolicy(t *testing.T, thetpm transport.TPM) tpm2.PolicyPCR {
+	t.Helper()
+	bank, err := pcr.Read(thetpm, tpm2.TPMAlgSHA256, debugPCR)
+	require.NoError(t, err)
+	digest := sha256.Sum256(bank.Values[debugPCR])
+	return tpm2.PolicyPCR{
+		PcrDigest: tpm2.TPM2BDigest{Buffer: digest[:]},
+		Pcrs:      pcr.Selection(tpm2.TPMAlgSHA256, debugPCR),
+	}
+}
+
+func TestPolicyAuthorize_Rotation(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	require.NoError(t, pcr.Reset(thetpm, debugPCR))
+	t.Cleanup(func() { pcr.Reset(thetpm, debugPCR) })
+
+	authority, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	policyRef := []byte("boot-policy")
+
+	calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+	require.NoError(t, err)
+	require.NoError(t, policy.Authorize(calc, authority.Public(), policyRef))
+
+	secret := []byte("sealed once, unsealed under rotating policies")
+	sealed := seal(t, thetpm, calc.Hash().Digest, secret)
+
+	// approve signs the PCR policy matching the current debug PCR value.
+	approve := func() (tpm2.PolicyPCR, *policy.ApprovedPolicy) {
+		pcrCmd := pcrPolicy(t, thetpm)
+		pcrCalc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+		require.NoError(t, err)
+		require.NoError(t, pcrCmd.Update(pcrCalc))
+		approved, err := policy.Approve(authority, pcrCalc.Hash().Digest, policyRef)
+		require.NoError(t, err)
+		return pcrCmd, approved
+	}
+	satisfy := func(pcrCmd tpm2.PolicyPCR, approved *policy.ApprovedPolicy) tpm2.PolicyCallback {
+		return func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+			pcrCmd.PolicySession = handle
+			if _, err := pcrCmd.Execute(tpm); err != nil {
+				return err
+			}
+			return policy.SatisfyAuthorize(tpm, handle, authority.Public(), approved)
+		}
+	}
+
+	pcrV1, approvedV1 := approve()
+	got, err := unseal(thetpm, sealed, satisfy(pcrV1, approvedV1))
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+
+	// A new measurement invalidates the first approved policy...
+	require.NoError(t, pcr.Extend(thetpm, debugPCR, tpm2.TPMAlgSHA256, []byte("update")))
+	_, err = unseal(thetpm, sealed, satisfy(pcrV1, approvedV1))
+	require.Error(t, err)
+
+	// ... until the authority approves the new state, without resealing.
+	pcrV2, approvedV2 := approve()
+	got, err = unseal(thetpm, sealed, satisfy(pcrV2, approvedV2))
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+
+	// A policy signed by someone else is rejected.
+	impostor, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	forged, err := policy.Approve(impostor, approvedV2.Digest, policyRef)
+	require.NoError(t, err)
+	_, err = unseal(thetpm, sealed, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+		pcrV2.PolicySession = handle
+		if _, err := pcrV2.Execute(tpm); err != nil {
+			return err
+		}
+		return policy.SatisfyAuthorize(tpm, handle, authority.Public(), forged)
+	})
+	require.Error(t, err)
+}
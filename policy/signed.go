@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"crypto"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Signed extends calc with a PolicySigned assertion: the policy is satisfied
+// by a signature of authority over the session nonce (see [SignAuthorization]).
+func Signed(calc *tpm2.PolicyCalculator, authority crypto.PublicKey, policyRef []byte) error {
+	public, err := ExternalKey(authority)
+	if err != nil {
+		return err
+	}
+	name, err := tpm2.ObjectName(&public)
+	if err != nil {
+		return err
+	}
+	return tpm2.PolicySigned{
+		AuthObject: tpm2.NamedHandle{Name: *name},
+		PolicyRef:  tpm2.TPM2BNonce{Buffer: policyRef},
+	}.Update(calc)
+}
+
+// SignedAuthorization is an authorization produced by the holder of an
+// external key to satisfy a PolicySigned assertion.
+type SignedAuthorization struct {
+	// NonceTPM binds the authorization to a single policy session.
+	// An empty nonce makes it valid for any session.
+	NonceTPM []byte
+	// Expiration limits the validity of the authorization, in seconds after
+	// the start of the session (only enforced when NonceTPM is set).
+	// A negative value also requests a ticket from the TPM.
+	Expiration int32
+	// CPHashA optionally restricts the authorization to a command and its parameters.
+	CPHashA []byte
+	// PolicyRef qualifies the authorization.
+	PolicyRef []byte
+	// Signature covers H(NonceTPM || Expiration || CPHashA || PolicyRef).
+	Signature tpm2.TPMTSignature
+}
+
+// SignAuthorization creates a [SignedAuthorization]. This runs in software on
+// the side of the authority, typically a remote server which received the
+// session nonce from the TPM user.
+func SignAuthorization(signer crypto.Signer, nonceTPM []byte, expiration int32, cpHashA, policyRef []byte) (*SignedAuthorization, error) {
+	sig, err := sign(signer, nonceTPM, binary.BigEndian.AppendUint32(nil, uint32(expiration)), cpHashA, policyRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign authorization: %w", err)
+	}
+	return &SignedAuthorization{
+		NonceTPM:   nonceTPM,
+		Expiration: expiration,
+		CPHashA:    cpHashA,
+		PolicyRef:  policyRef,
+		Signature:  sig,
+	}, nil
+}
+
+// SatisfySigned runs PolicySigned in the policy session, checking auth with
+// the public key of authority.
+//
+// Example:
+//
+//	sess := tpm2.Policy(tpm2.TPMAlgSHA256, 16, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, nonceTPM tpm2.TPM2BNonce) error {
+//	    auth, err := authorityServer.Authorize(nonceTPM.Buffer)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    _, err = policy.SatisfySigned(tpm, handle, authorityPub, auth)
+//	    return err
+//	})
+func SatisfySigned(tpm transport.TPM, session tpm2.TPMISHPolicy, authority crypto.PublicKey, auth *SignedAuthorization) (*tpm2.PolicySignedResponse, error) {
+	public, err := ExternalKey(authority)
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadExternal(tpm, public)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Close() //nolint:errcheck
+
+	rsp, err := tpm2.PolicySigned{
+		AuthObject:    key,
+		PolicySession: session,
+		NonceTPM:      tpm2.TPM2BNonce{Buffer: auth.NonceTPM},
+		CPHashA:       tpm2.TPM2BDigest{Buffer: auth.CPHashA},
+		PolicyRef:     tpm2.TPM2BNonce{Buffer: auth.PolicyRef},
+		Expiration:    auth.Expiration,
+		Auth:          auth.Signature,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("PolicySigned failed: %w", err)
+	}
+	return rsp, nil
+}
@@ -0,0 +1,236 @@
+package provision
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/hierarchy"
+	"github.com/loicsikidi/tpm-stuff/nv"
+)
+
+// Handles of the NV indexes defined by default by [Device], in the platform
+// range of NV indexes (see [nv.Lookup]).
+const (
+	// RollbackCounterIndex is a monotonic counter, e.g. the minimum version
+	// of the software allowed to run on the device.
+	RollbackCounterIndex tpm2.TPMHandle = 0x01500001
+	// LifecycleIndex is a bit field holding the lifecycle state of the
+	// device (provisioned, debug enabled, decommissioned...).
+	LifecycleIndex tpm2.TPMHandle = 0x01500002
+)
+
+// ErrIndexMismatch is returned when an NV index is already defined with
+// other attributes or size than requested.
+var ErrIndexMismatch = errors.New("NV index doesn't match its definition")
+
+// StandardIndexes are the NV indexes defined by default by [Device]: the
+// rollback counter and the lifecycle bit field, both without authorization
+// value.
+var StandardIndexes = []nv.DefineConfig{
+	{Index: RollbackCounterIndex, Attributes: nv.CounterAttributes},
+	{Index: LifecycleIndex, Attributes: nv.BitsAttributes},
+}
+
+// DeviceConfig holds configuration for [Device].
+type DeviceConfig struct {
+	// OwnerAuth is the authorization value set on the owner hierarchy.
+	//
+	// Default: nil, the hierarchy keeps an empty authorization value.
+	OwnerAuth []byte
+	// EndorsementAuth is the authorization value set on the endorsement
+	// hierarchy.
+	//
+	// Default: nil.
+	EndorsementAuth []byte
+	// LockoutAuth is the authorization value set on the lockout hierarchy.
+	//
+	// Default: nil.
+	LockoutAuth []byte
+	// NVIndexes are the NV indexes to define in the owner hierarchy. Their
+	// OwnerAuth is ignored.
+	//
+	// Default: [StandardIndexes].
+	NVIndexes []nv.DefineConfig
+}
+
+// CheckAndSetDefault validates and sets default values for DeviceConfig.
+func (c *DeviceConfig) CheckAndSetDefault() error {
+	if c.NVIndexes == nil {
+		c.NVIndexes = StandardIndexes
+	}
+	return nil
+}
+
+// Report describes a provisioned device, for the enrollment of its keys.
+//
+// Byte slices are encoded in base64 by encoding/json.
+type Report struct {
+	SRK KeyReport `json:"srk"`
+	EK  KeyReport `json:"ek"`
+	AK  KeyReport `json:"ak"`
+	// NVIndexes are the NV indexes defined on the device.
+	NVIndexes []IndexReport `json:"nv_indexes"`
+	// AuthSet lists the hierarchies ("owner", "endorsement", "lockout")
+	// given an authorization value.
+	AuthSet []string `json:"auth_set,omitempty"`
+}
+
+// KeyReport describes a persistent key.
+type KeyReport struct {
+	Handle tpm2.TPMHandle `json:"handle"`
+	Name   []byte         `json:"name"`
+	// Public is the marshaled TPMT_PUBLIC of the key.
+	Public []byte `json:"public"`
+	// PublicKey is the PKIX, ASN.1 DER encoded public key.
+	PublicKey []byte `json:"public_key"`
+}
+
+// IndexReport describes an NV index.
+type IndexReport struct {
+	Handle tpm2.TPMHandle `json:"handle"`
+	Name   []byte         `json:"name"`
+	// Public is the marshaled TPMS_NV_PUBLIC of the index.
+	Public []byte `json:"public"`
+}
+
+// Device provisions a TPM in one pass: it ensures the SRK, EK and AK at their
+// well-known handles, defines the NV indexes, then sets the authorization
+// values of the hierarchies and reports the public keys and names.
+//
+// The TPM must have empty hierarchy authorization values, as after
+// TPM2_Clear. The authorization values are set last, through sessions salted
+// with the EK so that they never travel in clear: when a step fails, the TPM
+// is left with empty authorization values and Device can be run again, the
+// keys and indexes already provisioned being reused.
+//
+// Example:
+//
+//	report, err := provision.Device(tpm, provision.DeviceConfig{
+//	    OwnerAuth:   ownerAuth,
+//	    LockoutAuth: lockoutAuth,
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	data, err := json.Marshal(report)
+func Device(tpm transport.TPM, cfg DeviceConfig) (*Report, error) {
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+
+	var report Report
+	for _, k := range []struct {
+		name   string
+		ensure func(transport.TPM, ...Config) (tpmutil.Handle, error)
+		out    *KeyReport
+	}{
+		{"SRK", EnsureSRK, &report.SRK},
+		{"EK", EnsureEK, &report.EK},
+		{"AK", EnsureAK, &report.AK},
+	} {
+		key, err := k.ensure(tpm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to provision %s: %w", k.name, err)
+		}
+		if *k.out, err = keyReport(key); err != nil {
+			return nil, fmt.Errorf("failed to provision %s: %w", k.name, err)
+		}
+	}
+
+	for _, idxCfg := range cfg.NVIndexes {
+		idx, err := ensureIndex(tpm, idxCfg)
+		if err != nil {
+			return nil, err
+		}
+		report.NVIndexes = append(report.NVIndexes, *idx)
+	}
+
+	ek, err := tpmutil.ToHandle(tpm, EKHandle)
+	if err != nil {
+		return nil, err
+	}
+	// The owner hierarchy comes after the endorsement one, and lockout last,
+	// since it would be needed to recover from a failure (TPM2_Clear).
+	for _, h := range []struct {
+		name   string
+		handle tpm2.TPMHandle
+		auth   []byte
+	}{
+		{"endorsement", tpm2.TPMRHEndorsement, cfg.EndorsementAuth},
+		{"owner", tpm2.TPMRHOwner, cfg.OwnerAuth},
+		{"lockout", tpm2.TPMRHLockout, cfg.LockoutAuth},
+	} {
+		if len(h.auth) == 0 {
+			continue
+		}
+		if err := hierarchy.ChangeAuthSalted(tpm, h.handle, nil, h.auth, ek); err != nil {
+			return nil, fmt.Errorf("failed to set %s auth: %w", h.name, err)
+		}
+		report.AuthSet = append(report.AuthSet, h.name)
+	}
+	return &report, nil
+}
+
+// keyReport describes key.
+func keyReport(key tpmutil.Handle) (KeyReport, error) {
+	pub, err := tpmcrypto.PublicKey(key.Public())
+	if err != nil {
+		return KeyReport{}, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return KeyReport{}, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return KeyReport{
+		Handle:    key.Handle(),
+		Name:      key.Name().Buffer,
+		Public:    tpm2.Marshal(key.Public()),
+		PublicKey: der,
+	}, nil
+}
+
+// ensureIndex defines the index of cfg, unless it is already defined with
+// the same attributes and size.
+func ensureIndex(tpm transport.TPM, cfg nv.DefineConfig) (*IndexReport, error) {
+	cfg.OwnerAuth = nil
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	public, err := nv.ReadPublic(tpm, cfg.Index)
+	switch {
+	case errors.Is(err, tpm2.TPMRCHandle):
+		if _, err := nv.Define(tpm, cfg); err != nil {
+			return nil, fmt.Errorf("failed to define NV index 0x%x: %w", cfg.Index, err)
+		}
+		if public, err = nv.ReadPublic(tpm, cfg.Index); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		// TPMA_NV_WRITTEN is set by the TPM.
+		attrs := public.Attributes
+		attrs.Written = false
+		if attrs != cfg.Attributes || public.DataSize != cfg.Size {
+			return nil, fmt.Errorf("%w: 0x%x is a %s index of %d bytes with %s, expected a %s index of %d bytes with %s",
+				ErrIndexMismatch, cfg.Index,
+				nv.TypeName(attrs.NT), public.DataSize, strings.Join(nv.AttributeNames(attrs), "|"),
+				nv.TypeName(cfg.Attributes.NT), cfg.Size, strings.Join(nv.AttributeNames(cfg.Attributes), "|"))
+		}
+	}
+	name, err := tpm2.NVName(public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute NV name: %w", err)
+	}
+	return &IndexReport{
+		Handle: cfg.Index,
+		Name:   name.Buffer,
+		Public: tpm2.Marshal(*public),
+	}, nil
+}
@@ -0,0 +1,91 @@
+package provision_test
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/hierarchy"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/provision"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevice(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	rec := sniffer.New(thetpm)
+	ownerAuth, lockoutAuth := []byte("owner-password"), []byte("lockout-password")
+
+	report, err := provision.Device(rec, provision.DeviceConfig{
+		OwnerAuth:   ownerAuth,
+		LockoutAuth: lockoutAuth,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"owner", "lockout"}, report.AuthSet)
+	for _, cmd := range rec.Commands() {
+		require.False(t, bytes.Contains(cmd, ownerAuth))
+		require.False(t, bytes.Contains(cmd, lockoutAuth))
+	}
+
+	for _, k := range []struct {
+		report provision.KeyReport
+		handle tpm2.TPMHandle
+	}{
+		{report.SRK, provision.SRKHandle},
+		{report.EK, provision.EKHandle},
+		{report.AK, provision.AKHandle},
+	} {
+		require.Equal(t, k.handle, k.report.Handle)
+		key, err := tpmutil.ToHandle(thetpm, k.handle)
+		require.NoError(t, err)
+		require.Equal(t, key.Name().Buffer, k.report.Name)
+		_, err = x509.ParsePKIXPublicKey(k.report.PublicKey)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, report.NVIndexes, 2)
+	for i, handle := range []tpm2.TPMHandle{provision.RollbackCounterIndex, provision.LifecycleIndex} {
+		idx, err := nv.Open(thetpm, handle)
+		require.NoError(t, err)
+		require.Equal(t, idx.Name.Buffer, report.NVIndexes[i].Name)
+	}
+
+	// The owner hierarchy now requires its authorization value.
+	_, err = tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.Error(t, err)
+	key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		Auth:     tpm2.PasswordAuth(ownerAuth),
+		InPublic: tpmutil.ECCSRKTemplate,
+	})
+	require.NoError(t, err)
+	require.NoError(t, key.Close())
+
+	// Once the authorization values are removed, provisioning again reuses
+	// the keys and indexes.
+	require.NoError(t, hierarchy.ChangeAuth(thetpm, tpm2.TPMRHOwner, ownerAuth, nil))
+	require.NoError(t, hierarchy.ChangeAuth(thetpm, tpm2.TPMRHLockout, lockoutAuth, nil))
+	again, err := provision.Device(thetpm, provision.DeviceConfig{})
+	require.NoError(t, err)
+	require.Equal(t, report.EK, again.EK)
+	require.Equal(t, report.NVIndexes, again.NVIndexes)
+	require.Empty(t, again.AuthSet)
+}
+
+func TestDevice_IndexMismatch(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	_, err := nv.DefineCounter(thetpm, provision.LifecycleIndex, nil)
+	require.NoError(t, err)
+
+	_, err = provision.Device(thetpm, provision.DeviceConfig{OwnerAuth: []byte("owner-password")})
+	require.ErrorIs(t, err, provision.ErrIndexMismatch)
+
+	// The owner authorization value wasn't set.
+	key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	require.NoError(t, key.Close())
+}
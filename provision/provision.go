@@ -0,0 +1,153 @@
+// Package provision finds or creates the primary keys defined by the TCG TPM
+// v2.0 Provisioning Guidance at their well-known persistent handles, so that
+// programs share them instead of recreating primaries on each run.
+package provision
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/persist"
+	"github.com/loicsikidi/tpm-stuff/templates"
+)
+
+// Well-known handles of the provisioned keys.
+const (
+	// SRKHandle is the handle of the Storage Root Key.
+	SRKHandle tpm2.TPMHandle = 0x81000001
+	// EKHandle is the handle of the RSA Endorsement Key.
+	EKHandle tpm2.TPMHandle = 0x81010001
+	// AKHandle is the handle of the Attestation Key, the first handle of the
+	// owner range: the guidance doesn't reserve one.
+	AKHandle tpm2.TPMHandle = 0x81020000
+)
+
+// AKTemplate is the template of the Attestation Key: a restricted RSA-2048
+// signing key using RSASSA with SHA-256.
+var AKTemplate = templates.AK()
+
+// ErrKeyMismatch is returned when the persistent handle holds a key which
+// wasn't created from the expected template.
+var ErrKeyMismatch = errors.New("persistent key doesn't match the template")
+
+// Config holds configuration for [EnsureSRK], [EnsureEK] and [EnsureAK].
+type Config struct {
+	// OwnerAuth is the authorization session for the owner hierarchy, which
+	// creates the SRK and persists both keys.
+	//
+	// Default: [tpmutil.NoAuth].
+	OwnerAuth tpm2.Session
+	// EndorsementAuth is the authorization session for the endorsement
+	// hierarchy, which creates the EK.
+	//
+	// Default: [tpmutil.NoAuth].
+	EndorsementAuth tpm2.Session
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	if c.OwnerAuth == nil {
+		c.OwnerAuth = tpmutil.NoAuth
+	}
+	if c.EndorsementAuth == nil {
+		c.EndorsementAuth = tpmutil.NoAuth
+	}
+	return nil
+}
+
+// EnsureSRK returns the ECC P-256 SRK (template [tpm2.ECCSRKTemplate])
+// persisted at [SRKHandle], creating and persisting it on first use.
+//
+// Example:
+//
+//	srk, err := provision.EnsureSRK(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	// srk is persistent: it must not be flushed.
+//	key, err := tpmutil.Create(tpm, tpmutil.CreateConfig{ParentHandle: srk, InPublic: template})
+func EnsureSRK(tpm transport.TPM, optionalCfg ...Config) (tpmutil.Handle, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	return ensure(tpm, tpm2.TPMRHOwner, cfg.OwnerAuth, tpm2.ECCSRKTemplate, SRKHandle, cfg.OwnerAuth)
+}
+
+// EnsureEK returns the RSA-2048 EK (template [tpm2.RSAEKTemplate]) persisted
+// at [EKHandle], creating and persisting it on first use.
+func EnsureEK(tpm transport.TPM, optionalCfg ...Config) (tpmutil.Handle, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	return ensure(tpm, tpm2.TPMRHEndorsement, cfg.EndorsementAuth, tpm2.RSAEKTemplate, EKHandle, cfg.OwnerAuth)
+}
+
+// EnsureAK returns the AK (template [AKTemplate]), a primary key of the
+// owner hierarchy persisted at [AKHandle], creating and persisting it on
+// first use.
+func EnsureAK(tpm transport.TPM, optionalCfg ...Config) (tpmutil.Handle, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	return ensure(tpm, tpm2.TPMRHOwner, cfg.OwnerAuth, AKTemplate, AKHandle, cfg.OwnerAuth)
+}
+
+// ensure returns the key persisted at handle after checking it matches
+// template, or else creates it in hierarchy and persists it.
+func ensure(tpm transport.TPM, hierarchy tpm2.TPMHandle, hierarchyAuth tpm2.Session, template tpm2.TPMTPublic, handle tpm2.TPMHandle, ownerAuth tpm2.Session) (tpmutil.Handle, error) {
+	used, err := persist.IsUsed(tpm, handle)
+	if err != nil {
+		return nil, err
+	}
+	if used {
+		key, err := tpmutil.ToHandle(tpm, handle)
+		if err != nil {
+			return nil, err
+		}
+		if !matches(key.Public(), &template) {
+			return nil, fmt.Errorf("%w: 0x%x", ErrKeyMismatch, handle)
+		}
+		return key, nil
+	}
+
+	key, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: hierarchy,
+		Auth:          hierarchyAuth,
+		InPublic:      template,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create primary key: %w", err)
+	}
+	defer key.Close() //nolint:errcheck
+	if _, err := persist.Persist(tpm, key, handle, ownerAuth); err != nil {
+		return nil, err
+	}
+	return tpmutil.ToHandle(tpm, handle)
+}
+
+// matches reports whether public was created from template: both are equal
+// but for the unique field, filled by the TPM.
+func matches(public, template *tpm2.TPMTPublic) bool {
+	if public.Type != template.Type {
+		return false
+	}
+	got := *public
+	got.Unique = template.Unique
+	return bytes.Equal(tpm2.Marshal(got), tpm2.Marshal(*template))
+}
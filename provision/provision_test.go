@@ -0,0 +1,64 @@
+package provision_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/persist"
+	"github.com/loicsikidi/tpm-stuff/provision"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsure(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	for _, tt := range []struct {
+		name     string
+		ensure   func() (tpmutil.Handle, error)
+		handle   tpm2.TPMHandle
+		template tpm2.TPMTPublic
+	}{
+		{"SRK", func() (tpmutil.Handle, error) { return provision.EnsureSRK(thetpm) }, provision.SRKHandle, tpm2.ECCSRKTemplate},
+		{"EK", func() (tpmutil.Handle, error) { return provision.EnsureEK(thetpm) }, provision.EKHandle, tpm2.RSAEKTemplate},
+		{"AK", func() (tpmutil.Handle, error) { return provision.EnsureAK(thetpm) }, provision.AKHandle, provision.AKTemplate},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			created, err := tt.ensure()
+			require.NoError(t, err)
+			require.Equal(t, tt.handle, created.Handle())
+			require.Equal(t, tt.template.ObjectAttributes, created.Public().ObjectAttributes)
+
+			// The second call finds the persisted key.
+			found, err := tt.ensure()
+			require.NoError(t, err)
+			require.Equal(t, created.Name(), found.Name())
+		})
+	}
+
+	// No transient object is left behind.
+	rsp, err := tpm2.GetCapability{
+		Capability:    tpm2.TPMCapHandles,
+		Property:      uint32(tpm2.TPMHTTransient) << 24,
+		PropertyCount: 8,
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	handles, err := rsp.CapabilityData.Data.Handles()
+	require.NoError(t, err)
+	require.Empty(t, handles.Handle)
+}
+
+func TestEnsure_Mismatch(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	// An RSA SRK provisioned by someone else.
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpm2.RSASRKTemplate})
+	require.NoError(t, err)
+	defer srk.Close()
+	_, err = persist.Persist(thetpm, srk, provision.SRKHandle)
+	require.NoError(t, err)
+
+	_, err = provision.EnsureSRK(thetpm)
+	require.ErrorIs(t, err, provision.ErrKeyMismatch)
+}
@@ -0,0 +1,415 @@
+// Package benchmarks measures the cost of parameter encryption for several
+// TPM commands, under each kind of session of the secure_connection packages.
+//
+// The benchmarks are defined here, rather than in test files, so that they can
+// be run programmatically with testing.Benchmark.
+package benchmarks
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sessions"
+	"github.com/loicsikidi/tpm-stuff/templates"
+)
+
+// Session is a kind of session authorizing and protecting a command.
+type Session string
+
+const (
+	// Password authorizes with a password session: nothing is encrypted.
+	Password Session = "password"
+	// Unbound authorizes with an unbound, unsalted HMAC session.
+	Unbound Session = "unbound"
+	// Bound authorizes with an HMAC session bound to a dedicated entity.
+	Bound Session = "bound"
+	// Salted authorizes with a password and encrypts with a session salted
+	// with an RSA-2048 key.
+	Salted Session = "salted"
+	// SaltedXOR is Salted, with XOR obfuscation using SHA-256 instead of
+	// AES-128-CFB (see sessions.ResumableConfig).
+	SaltedXOR Session = "salted-xor"
+)
+
+// Sessions lists the session kinds, the Password baseline first.
+var Sessions = []Session{Password, Unbound, Bound, Salted, SaltedXOR}
+
+// Command is a benchmarked TPM command.
+type Command string
+
+const (
+	// CreatePrimary creates (and flushes) an ECC P-256 key with a password.
+	CreatePrimary Command = "CreatePrimary"
+	// Sign signs a SHA-256 digest with an ECC P-256 key.
+	Sign Command = "Sign"
+	// Unseal unseals 32 bytes.
+	Unseal Command = "Unseal"
+	// NVWrite writes 64 bytes to an ordinary NV index.
+	NVWrite Command = "NVWrite"
+	// GetRandom draws 32 random bytes.
+	GetRandom Command = "GetRandom"
+)
+
+// Commands lists the benchmarked commands.
+var Commands = []Command{CreatePrimary, Sign, Unseal, NVWrite, GetRandom}
+
+// ParallelCommands lists the commands benchmarked by [Env.Parallel].
+var ParallelCommands = []Command{CreatePrimary, Sign, Unseal}
+
+// NVIndex is the NV index defined by the NVWrite benchmark.
+const NVIndex tpm2.TPMHandle = 0x01500100
+
+var (
+	authValue = []byte("testpassword")
+	bindAuth  = []byte("bindpassword")
+)
+
+// keyTemplate is the ECC P-256 key created by CreatePrimary and used by Sign.
+var keyTemplate = templates.ECCSigner(templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256))
+
+// sessionKeyTemplate is the RSA-2048 key salting the Salted sessions and
+// bound to by the Bound sessions.
+var sessionKeyTemplate = templates.RSADecrypter()
+
+var sealTemplate = templates.Seal(templates.WithNoDA())
+
+// Env holds the key used by the Bound and Salted sessions of the benchmarks.
+type Env struct {
+	tpm        transport.TPM
+	sessionKey tpmutil.HandleCloser
+}
+
+// NewEnv creates the session key of the benchmarks in the owner hierarchy.
+// The caller must call Close() to flush it.
+//
+// Example:
+//
+//	env, err := benchmarks.NewEnv(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	defer env.Close()
+//	result := testing.Benchmark(env.Benchmark(benchmarks.Sign, benchmarks.Salted))
+func NewEnv(tpm transport.TPM) (*Env, error) {
+	key, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		InPublic: sessionKeyTemplate,
+		UserAuth: bindAuth,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session key: %w", err)
+	}
+	return &Env{tpm: tpm, sessionKey: key}, nil
+}
+
+// Close flushes the session key.
+func (e *Env) Close() error {
+	return e.sessionKey.Close()
+}
+
+// target is a command ready to be benchmarked.
+type target struct {
+	// authorized is set when the command has a handle authorized by the
+	// session; otherwise sessions are only used for encryption.
+	authorized bool
+	// authValue is the authorization value of the handle.
+	authValue []byte
+	// encryptIn and encryptOut are set when the first command and response
+	// parameters can be encrypted, i.e. when they are sized buffers.
+	encryptIn, encryptOut bool
+	// exec executes the command once.
+	exec func(auth tpm2.Session, extra []tpm2.Session) error
+	// cleanup releases the objects created for the benchmark.
+	cleanup func() error
+}
+
+// Benchmark returns the benchmark of cmd under sess. Each iteration starts a
+// session, executes cmd and flushes the session, as an application using a
+// session per operation would. Setup happens outside of the timer.
+func (e *Env) Benchmark(cmd Command, sess Session) func(b *testing.B) {
+	return func(b *testing.B) {
+		t, err := e.target(cmd)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer func() {
+			if err := t.cleanup(); err != nil {
+				b.Error(err)
+			}
+		}()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			auth, extra, closer, err := e.session(sess, t)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := t.exec(auth, extra); err != nil {
+				b.Fatalf("%s with %s session: %v", cmd, sess, err)
+			}
+			if err := closer(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// Parallel returns the benchmark of cmd, one of [ParallelCommands], sent
+// concurrently by the goroutines of b.RunParallel: GOMAXPROCS of them, so
+// that the -cpu flag sets the contention. The TPM of e must be safe for
+// concurrent use: typically a transportutil.Locking over a
+// transportutil.SlotManager.
+//
+// Each goroutine authorizes its commands with a long-lived session of its
+// own, a [sessions.Resumable] encrypting the parameters: the TPM holds more
+// sessions than it has slots, which the SlotManager swaps in and out. Each
+// session checks the response HMACs, which catches a session whose nonces
+// were corrupted by interleaved commands.
+//
+// Example:
+//
+//	thetpm := transportutil.NewLocking(transportutil.NewSlotManager(device))
+//	env, err := benchmarks.NewEnv(thetpm)
+//	if err != nil {
+//	    return err
+//	}
+//	defer env.Close()
+//	result := testing.Benchmark(env.Parallel(benchmarks.Sign))
+func (e *Env) Parallel(cmd Command) func(b *testing.B) {
+	return func(b *testing.B) {
+		t, err := e.target(cmd)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer func() {
+			if err := t.cleanup(); err != nil {
+				b.Error(err)
+			}
+		}()
+
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			if err := e.loop(t, pb.Next); err != nil {
+				b.Errorf("%s: %v", cmd, err)
+			}
+		})
+	}
+}
+
+// loop executes t with a session of its own until next returns false.
+func (e *Env) loop(t *target, next func() bool) (err error) {
+	s, err := sessions.Default.StartResumable(e.tpm, sessions.ResumableConfig{Direction: t.direction()})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, s.Close(e.tpm))
+	}()
+	s.SetAuth(t.authValue)
+
+	auth, extra := tpm2.Session(s), []tpm2.Session(nil)
+	if !t.authorized {
+		auth, extra = tpm2.PasswordAuth(nil), []tpm2.Session{s}
+	}
+	for next() {
+		if err := t.exec(auth, extra); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// session starts a session of kind sess for t. It returns the authorization
+// of the command, extra sessions and a closer flushing the started session.
+func (e *Env) session(sess Session, t *target) (tpm2.Session, []tpm2.Session, func() error, error) {
+	noop := func() error { return nil }
+	switch sess {
+	case Password:
+		return tpm2.PasswordAuth(t.authValue), nil, noop, nil
+	case SaltedXOR:
+		// go-tpm only implements AES-CFB.
+		s, err := sessions.Default.StartResumable(e.tpm, sessions.ResumableConfig{
+			SaltKey:   e.sessionKey,
+			Direction: t.direction(),
+			XOR:       tpm2.TPMAlgSHA256,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return tpm2.PasswordAuth(t.authValue), []tpm2.Session{s}, func() error { return s.Close(e.tpm) }, nil
+	}
+
+	var opts []tpm2.AuthOption
+	switch sess {
+	case Unbound:
+		opts = append(opts, tpm2.Auth(t.authValue))
+	case Bound:
+		opts = append(opts, tpm2.Bound(e.sessionKey.Handle(), e.sessionKey.Name(), bindAuth), tpm2.Auth(t.authValue))
+	case Salted:
+		opts = append(opts, tpm2.Salted(e.sessionKey.Handle(), *e.sessionKey.Public()))
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown session %q", sess)
+	}
+	switch {
+	case t.encryptIn && t.encryptOut:
+		opts = append(opts, tpm2.AESEncryption(128, tpm2.EncryptInOut))
+	case t.encryptIn:
+		opts = append(opts, tpm2.AESEncryption(128, tpm2.EncryptIn))
+	case t.encryptOut:
+		opts = append(opts, tpm2.AESEncryption(128, tpm2.EncryptOut))
+	}
+	s, closer, err := tpm2.HMACSession(e.tpm, tpm2.TPMAlgSHA256, 16, opts...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if sess == Salted || !t.authorized {
+		return tpm2.PasswordAuth(t.authValue), []tpm2.Session{s}, closer, nil
+	}
+	return s, nil, closer, nil
+}
+
+// direction returns the parameters of t which can be encrypted.
+func (t *target) direction() sessions.Direction {
+	switch {
+	case !t.encryptIn:
+		return sessions.EncryptOut
+	case !t.encryptOut:
+		return sessions.EncryptIn
+	}
+	return sessions.EncryptInOut
+}
+
+// target prepares cmd.
+func (e *Env) target(cmd Command) (*target, error) {
+	noop := func() error { return nil }
+	switch cmd {
+	case CreatePrimary:
+		return &target{
+			// The owner hierarchy has an empty password.
+			authorized: true,
+			encryptIn:  true,
+			encryptOut: true,
+			exec:       e.createPrimary,
+			cleanup:    noop,
+		}, nil
+	case Sign:
+		key, err := tpmutil.CreatePrimary(e.tpm, tpmutil.CreatePrimaryConfig{
+			InPublic: keyTemplate,
+			UserAuth: authValue,
+		})
+		if err != nil {
+			return nil, err
+		}
+		digest := make([]byte, 32)
+		return &target{
+			authorized: true,
+			authValue:  authValue,
+			encryptIn:  true,
+			exec: func(auth tpm2.Session, extra []tpm2.Session) error {
+				_, err := tpm2.Sign{
+					KeyHandle:  tpmutil.ToAuthHandle(key, auth),
+					Digest:     tpm2.TPM2BDigest{Buffer: digest},
+					InScheme:   tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+					Validation: tpm2.TPMTTKHashCheck{Tag: tpm2.TPMSTHashCheck, Hierarchy: tpm2.TPMRHNull},
+				}.Execute(e.tpm, extra...)
+				return err
+			},
+			cleanup: key.Close,
+		}, nil
+	case Unseal:
+		item, err := tpmutil.CreatePrimary(e.tpm, tpmutil.CreatePrimaryConfig{
+			InPublic:    sealTemplate,
+			UserAuth:    authValue,
+			SealingData: make([]byte, 32),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &target{
+			authorized: true,
+			authValue:  authValue,
+			encryptOut: true,
+			exec: func(auth tpm2.Session, extra []tpm2.Session) error {
+				_, err := tpm2.Unseal{
+					ItemHandle: tpmutil.ToAuthHandle(item, auth),
+				}.Execute(e.tpm, extra...)
+				return err
+			},
+			cleanup: item.Close,
+		}, nil
+	case NVWrite:
+		idx, err := nv.Define(e.tpm, nv.DefineConfig{
+			Index: NVIndex,
+			Size:  64,
+			Auth:  authValue,
+		})
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, 64)
+		// The first write sets TPMA_NV_WRITTEN, changing the name of the
+		// index: do it now so that the name is stable.
+		if err := nv.Write(e.tpm, idx, data, tpm2.PasswordAuth(authValue)); err != nil {
+			return nil, errors.Join(err, nv.Undefine(e.tpm, idx))
+		}
+		return &target{
+			authorized: true,
+			authValue:  authValue,
+			encryptIn:  true,
+			exec: func(auth tpm2.Session, extra []tpm2.Session) error {
+				_, err := tpm2.NVWrite{
+					AuthHandle: idx.AuthHandle(auth),
+					NVIndex:    idx.NamedHandle(),
+					Data:       tpm2.TPM2BMaxNVBuffer{Buffer: data},
+				}.Execute(e.tpm, extra...)
+				return err
+			},
+			cleanup: func() error { return nv.Undefine(e.tpm, idx) },
+		}, nil
+	case GetRandom:
+		return &target{
+			encryptOut: true,
+			exec: func(_ tpm2.Session, extra []tpm2.Session) error {
+				_, err := tpm2.GetRandom{BytesRequested: 32}.Execute(e.tpm, extra...)
+				return err
+			},
+			cleanup: noop,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown command %q", cmd)
+}
+
+// createPrimary creates a key protected by authValue and flushes it.
+func (e *Env) createPrimary(ownerAuth tpm2.Session, extra []tpm2.Session) error {
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMRHOwner,
+			Auth:   ownerAuth,
+		},
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: authValue},
+			},
+		},
+		InPublic: tpm2.New2B(keyTemplate),
+	}.Execute(e.tpm, extra...)
+	if err != nil {
+		return err
+	}
+	_, err = tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(e.tpm)
+	return err
+}
+
+// Overhead returns how much slower perOp is than baseline, in percent.
+func Overhead(baseline, perOp time.Duration) float64 {
+	if baseline <= 0 {
+		return 0
+	}
+	return 100 * float64(perOp-baseline) / float64(baseline)
+}
@@ -0,0 +1,77 @@
+package benchmarks
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/transportutil"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBenchmarks runs each benchmarked command once under each session.
+func TestBenchmarks(t *testing.T) {
+	env, err := NewEnv(testutil.OpenSimulator(t))
+	require.NoError(t, err)
+	defer env.Close()
+
+	for _, cmd := range Commands {
+		t.Run(string(cmd), func(t *testing.T) {
+			target, err := env.target(cmd)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, target.cleanup())
+			}()
+
+			for _, sess := range Sessions {
+				auth, extra, closer, err := env.session(sess, target)
+				require.NoError(t, err)
+				require.NoError(t, target.exec(auth, extra), "%s session", sess)
+				require.NoError(t, closer())
+			}
+		})
+	}
+}
+
+// TestParallel runs each parallel command from several goroutines, more
+// than the session slots of the TPM.
+func TestParallel(t *testing.T) {
+	thetpm := transportutil.NewLocking(transportutil.NewSlotManager(testutil.OpenSimulator(t)))
+	env, err := NewEnv(thetpm)
+	require.NoError(t, err)
+	defer env.Close()
+
+	const goroutines, iterations = 6, 3
+	for _, cmd := range ParallelCommands {
+		t.Run(string(cmd), func(t *testing.T) {
+			target, err := env.target(cmd)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, target.cleanup())
+			}()
+
+			var wg sync.WaitGroup
+			errs := make([]error, goroutines)
+			for i := range goroutines {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					n := 0
+					errs[i] = env.loop(target, func() bool {
+						n++
+						return n <= iterations
+					})
+				}()
+			}
+			wg.Wait()
+			require.NoError(t, errors.Join(errs...))
+		})
+	}
+}
+
+func TestOverhead(t *testing.T) {
+	require.Equal(t, 50.0, Overhead(100, 150))
+	require.Equal(t, -10.0, Overhead(100, 90))
+	require.Zero(t, Overhead(0, 150))
+}
@@ -0,0 +1,48 @@
+package benchmarks_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/tpm-stuff/secure_connection/benchmarks"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+)
+
+// BenchmarkCommands measures each command under each session kind. Besides
+// ns/op, sessions report their overhead over the password baseline as
+// %overhead, e.g.:
+//
+//	go test -bench=Commands/Sign ./secure_connection/benchmarks
+func BenchmarkCommands(b *testing.B) {
+	tpm, err := common.OpenSimulator()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tpm.Close()
+
+	env, err := benchmarks.NewEnv(tpm)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer env.Close()
+
+	for _, cmd := range benchmarks.Commands {
+		b.Run(string(cmd), func(b *testing.B) {
+			// The last run of a benchmark is the one reported: the
+			// baseline is the password time per op of its last run.
+			var baseline time.Duration
+			for _, sess := range benchmarks.Sessions {
+				bench := env.Benchmark(cmd, sess)
+				b.Run(string(sess), func(b *testing.B) {
+					bench(b)
+					perOp := b.Elapsed() / time.Duration(b.N)
+					if sess == benchmarks.Password {
+						baseline = perOp
+						return
+					}
+					b.ReportMetric(benchmarks.Overhead(baseline, perOp), "%overhead")
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package benchmarks_test
+
+import (
+	"testing"
+
+	"github.com/loicsikidi/tpm-stuff/secure_connection/benchmarks"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/transportutil"
+)
+
+// BenchmarkParallel sends each command from GOMAXPROCS goroutines, each with
+// its own session, through a locking transport over a slot manager. Compare
+// ns/op across -cpu values to measure the contention, e.g.:
+//
+//	go test -bench=Parallel -cpu=1,2,4,8 ./secure_connection/benchmarks
+func BenchmarkParallel(b *testing.B) {
+	tpm, err := common.OpenSimulator()
+	if err != nil {
+		b.Fatal(err)
+	}
+	thetpm := transportutil.NewLocking(transportutil.NewSlotManager(tpm))
+	defer thetpm.Close()
+
+	env, err := benchmarks.NewEnv(thetpm)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer env.Close()
+
+	for _, cmd := range benchmarks.ParallelCommands {
+		b.Run(string(cmd), env.Parallel(cmd))
+	}
+}
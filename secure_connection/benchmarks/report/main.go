@@ -0,0 +1,170 @@
+// Command report runs the secure_connection benchmarks programmatically and
+// writes their results as a markdown table or CSV, e.g.:
+//
+//	go run ./secure_connection/benchmarks/report -format markdown > bench.md
+//
+// Each command is measured under each session kind; the overhead column is
+// relative to the password baseline of the same command.
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/tpm-stuff/internal/tpmopen"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/benchmarks"
+)
+
+var (
+	tpmPath   = flag.String("tpm-path", tpmopen.Simulator, "Path to the TPM device")
+	format    = flag.String("format", "markdown", `Output format: "markdown" or "csv"`)
+	commands  = flag.String("commands", "", "Comma-separated list of commands to benchmark (default: all)")
+	benchtime = flag.Duration("benchtime", time.Second, "Run time of each benchmark")
+)
+
+// result is the measure of a command under a session kind.
+type result struct {
+	Command     benchmarks.Command
+	Session     benchmarks.Session
+	N           int
+	NsPerOp     int64
+	AllocsPerOp int64
+	BytesPerOp  int64
+	// Overhead is the extra time over the password baseline, in percent.
+	Overhead float64
+}
+
+func main() {
+	testing.Init()
+	flag.Parse()
+	if err := flag.Set("test.benchtime", benchtime.String()); err != nil {
+		log.Fatal(err)
+	}
+
+	cmds, err := parseCommands(*commands)
+	if err != nil {
+		log.Fatal(err)
+	}
+	write, err := writer(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tpm, err := tpmopen.Open(*tpmPath)
+	if err != nil {
+		log.Fatalf("can't open TPM: %v", err)
+	}
+	defer tpm.Close()
+
+	env, err := benchmarks.NewEnv(tpm)
+	if err != nil {
+		log.Fatalf("can't prepare benchmarks: %v", err)
+	}
+	defer env.Close()
+
+	results, err := run(env, cmds)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := write(os.Stdout, results); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseCommands(list string) ([]benchmarks.Command, error) {
+	if list == "" {
+		return benchmarks.Commands, nil
+	}
+	var cmds []benchmarks.Command
+	for _, s := range strings.Split(list, ",") {
+		cmd := benchmarks.Command(strings.TrimSpace(s))
+		if !slices.Contains(benchmarks.Commands, cmd) {
+			return nil, fmt.Errorf("unknown command %q, expected one of %v", s, benchmarks.Commands)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+func writer(format string) (func(io.Writer, []result) error, error) {
+	switch format {
+	case "markdown":
+		return writeMarkdown, nil
+	case "csv":
+		return writeCSV, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// run benchmarks each command under each session kind, with the password
+// baseline first.
+func run(env *benchmarks.Env, cmds []benchmarks.Command) ([]result, error) {
+	var results []result
+	for _, cmd := range cmds {
+		var baseline time.Duration
+		for _, sess := range benchmarks.Sessions {
+			r := testing.Benchmark(env.Benchmark(cmd, sess))
+			if r.N == 0 {
+				return nil, fmt.Errorf("benchmark of %s with %s session failed", cmd, sess)
+			}
+			perOp := time.Duration(r.NsPerOp())
+			if sess == benchmarks.Password {
+				baseline = perOp
+			}
+			results = append(results, result{
+				Command:     cmd,
+				Session:     sess,
+				N:           r.N,
+				NsPerOp:     r.NsPerOp(),
+				AllocsPerOp: r.AllocsPerOp(),
+				BytesPerOp:  r.AllocedBytesPerOp(),
+				Overhead:    benchmarks.Overhead(baseline, perOp),
+			})
+		}
+	}
+	return results, nil
+}
+
+func writeMarkdown(w io.Writer, results []result) error {
+	var sb strings.Builder
+	sb.WriteString("| Command | Session | ns/op | Overhead | allocs/op | B/op |\n")
+	sb.WriteString("|---|---|--:|--:|--:|--:|\n")
+	for _, r := range results {
+		overhead := "baseline"
+		if r.Session != benchmarks.Password {
+			overhead = fmt.Sprintf("%+.1f%%", r.Overhead)
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %d | %s | %d | %d |\n",
+			r.Command, r.Session, r.NsPerOp, overhead, r.AllocsPerOp, r.BytesPerOp)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeCSV(w io.Writer, results []result) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"command", "session", "iterations", "ns_per_op", "overhead_percent", "allocs_per_op", "bytes_per_op"}) //nolint:errcheck
+	for _, r := range results {
+		cw.Write([]string{ //nolint:errcheck
+			string(r.Command),
+			string(r.Session),
+			strconv.Itoa(r.N),
+			strconv.FormatInt(r.NsPerOp, 10),
+			strconv.FormatFloat(r.Overhead, 'f', 1, 64),
+			strconv.FormatInt(r.AllocsPerOp, 10),
+			strconv.FormatInt(r.BytesPerOp, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
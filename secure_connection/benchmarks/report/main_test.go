@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/loicsikidi/tpm-stuff/secure_connection/benchmarks"
+	"github.com/stretchr/testify/require"
+)
+
+var results = []result{
+	{Command: benchmarks.Sign, Session: benchmarks.Password, N: 100, NsPerOp: 400, AllocsPerOp: 10, BytesPerOp: 1000},
+	{Command: benchmarks.Sign, Session: benchmarks.Salted, N: 40, NsPerOp: 1000, AllocsPerOp: 20, BytesPerOp: 2000, Overhead: 150},
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeMarkdown(&buf, results))
+	require.Equal(t, `| Command | Session | ns/op | Overhead | allocs/op | B/op |
+|---|---|--:|--:|--:|--:|
+| Sign | password | 400 | baseline | 10 | 1000 |
+| Sign | salted | 1000 | +150.0% | 20 | 2000 |
+`, buf.String())
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeCSV(&buf, results))
+	require.Equal(t, `command,session,iterations,ns_per_op,overhead_percent,allocs_per_op,bytes_per_op
+Sign,password,100,400,0.0,10,1000
+Sign,salted,40,1000,150.0,20,2000
+`, buf.String())
+}
+
+func TestParseCommands(t *testing.T) {
+	cmds, err := parseCommands("")
+	require.NoError(t, err)
+	require.Equal(t, benchmarks.Commands, cmds)
+
+	cmds, err = parseCommands("Sign, GetRandom")
+	require.NoError(t, err)
+	require.Equal(t, []benchmarks.Command{benchmarks.Sign, benchmarks.GetRandom}, cmds)
+
+	_, err = parseCommands("Quote")
+	require.Error(t, err)
+}
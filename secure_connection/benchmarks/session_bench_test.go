@@ -8,6 +8,7 @@ import (
 	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/salted"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/unbound"
+	"github.com/loicsikidi/tpm-stuff/templates"
 )
 
 // BenchmarkUnboundSession measures performance of unbound session for key creation
@@ -39,23 +40,7 @@ func BenchmarkUnboundSession(b *testing.B) {
 					},
 				},
 			},
-			InPublic: tpm2.New2B(tpm2.TPMTPublic{
-				Type:    tpm2.TPMAlgECC,
-				NameAlg: tpm2.TPMAlgSHA256,
-				ObjectAttributes: tpm2.TPMAObject{
-					SignEncrypt:         true,
-					FixedTPM:            true,
-					FixedParent:         true,
-					SensitiveDataOrigin: true,
-					UserWithAuth:        true,
-				},
-				Parameters: tpm2.NewTPMUPublicParms(
-					tpm2.TPMAlgECC,
-					&tpm2.TPMSECCParms{
-						CurveID: tpm2.TPMECCNistP256,
-					},
-				),
-			}),
+			InPublic: tpm2.New2B(templates.ECCSigner()),
 		}
 
 		rsp, err := createPrimary.Execute(tpm)
@@ -91,23 +76,7 @@ func BenchmarkBoundSession(b *testing.B) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				Decrypt:             true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCDecrypter()),
 	}
 
 	bindRsp, err := createBindEntity.Execute(tpm)
@@ -146,23 +115,7 @@ func BenchmarkBoundSession(b *testing.B) {
 					},
 				},
 			},
-			InPublic: tpm2.New2B(tpm2.TPMTPublic{
-				Type:    tpm2.TPMAlgECC,
-				NameAlg: tpm2.TPMAlgSHA256,
-				ObjectAttributes: tpm2.TPMAObject{
-					SignEncrypt:         true,
-					FixedTPM:            true,
-					FixedParent:         true,
-					SensitiveDataOrigin: true,
-					UserWithAuth:        true,
-				},
-				Parameters: tpm2.NewTPMUPublicParms(
-					tpm2.TPMAlgECC,
-					&tpm2.TPMSECCParms{
-						CurveID: tpm2.TPMECCNistP256,
-					},
-				),
-			}),
+			InPublic: tpm2.New2B(templates.ECCSigner()),
 		}
 
 		rsp, err := createPrimary.Execute(tpm)
@@ -190,26 +143,7 @@ func BenchmarkSaltedSession(b *testing.B) {
 			Handle: tpm2.TPMRHOwner,
 			Auth:   tpm2.PasswordAuth([]byte("")),
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgRSA,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				Decrypt:             true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgRSA,
-				&tpm2.TPMSRSAParms{
-					KeyBits: 2048,
-					Scheme: tpm2.TPMTRSAScheme{
-						Scheme: tpm2.TPMAlgNull,
-					},
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.RSADecrypter()),
 	}
 
 	saltKeyRsp, err := createSaltKey.Execute(tpm)
@@ -251,23 +185,7 @@ func BenchmarkSaltedSession(b *testing.B) {
 					},
 				},
 			},
-			InPublic: tpm2.New2B(tpm2.TPMTPublic{
-				Type:    tpm2.TPMAlgECC,
-				NameAlg: tpm2.TPMAlgSHA256,
-				ObjectAttributes: tpm2.TPMAObject{
-					SignEncrypt:         true,
-					FixedTPM:            true,
-					FixedParent:         true,
-					SensitiveDataOrigin: true,
-					UserWithAuth:        true,
-				},
-				Parameters: tpm2.NewTPMUPublicParms(
-					tpm2.TPMAlgECC,
-					&tpm2.TPMSECCParms{
-						CurveID: tpm2.TPMECCNistP256,
-					},
-				),
-			}),
+			InPublic: tpm2.New2B(templates.ECCSigner()),
 		}
 
 		rsp, err := createPrimary.Execute(tpm, encryptSess)
@@ -305,23 +223,7 @@ func BenchmarkPasswordAuth(b *testing.B) {
 					},
 				},
 			},
-			InPublic: tpm2.New2B(tpm2.TPMTPublic{
-				Type:    tpm2.TPMAlgECC,
-				NameAlg: tpm2.TPMAlgSHA256,
-				ObjectAttributes: tpm2.TPMAObject{
-					SignEncrypt:         true,
-					FixedTPM:            true,
-					FixedParent:         true,
-					SensitiveDataOrigin: true,
-					UserWithAuth:        true,
-				},
-				Parameters: tpm2.NewTPMUPublicParms(
-					tpm2.TPMAlgECC,
-					&tpm2.TPMSECCParms{
-						CurveID: tpm2.TPMECCNistP256,
-					},
-				),
-			}),
+			InPublic: tpm2.New2B(templates.ECCSigner()),
 		}
 
 		rsp, err := createPrimary.Execute(tpm)
@@ -0,0 +1,91 @@
+//go:build linux && localtest
+
+package benchmarks_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/linuxtpm"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+)
+
+// opsPerSession is the number of commands sent per benchmark iteration, i.e.
+// through one persistent session, or through as many inline sessions.
+var opsPerSession = []int{1, 10, 50}
+
+// BenchmarkSessionLifecycleRealTPM compares, on /dev/tpmrm0, inline sessions
+// (a StartAuthSession per command) with a persistent session started once and
+// reused for N commands. Simulator timings understate the cost of starting a
+// salted session, where the TPM decrypts the salt with its RSA key.
+//
+// Run with:
+//
+//	go test -tags localtest -bench=SessionLifecycleRealTPM ./secure_connection/benchmarks
+func BenchmarkSessionLifecycleRealTPM(b *testing.B) {
+	tpm, err := linuxtpm.Open("/dev/tpmrm0")
+	if err != nil {
+		b.Fatalf("could not open TPM: %v", err)
+	}
+	defer tpm.Close()
+
+	srk, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpm2.RSASRKTemplate,
+	})
+	if err != nil {
+		b.Fatalf("could not create SRK: %v", err)
+	}
+	defer srk.Close()
+
+	kinds := []struct {
+		name string
+		opts []tpm2.AuthOption
+	}{
+		{"unbound", nil},
+		{"salted", []tpm2.AuthOption{tpm2.Salted(srk.Handle(), *srk.Public())}},
+	}
+
+	for _, kind := range kinds {
+		opts := append(kind.opts[:len(kind.opts):len(kind.opts)], tpm2.AESEncryption(128, tpm2.EncryptOut))
+		for _, n := range opsPerSession {
+			b.Run(fmt.Sprintf("%s/inline/ops=%d", kind.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					for range n {
+						sess := tpm2.HMAC(tpm2.TPMAlgSHA256, 16, opts...)
+						getRandom(b, tpm, sess)
+					}
+				}
+				reportPerCommand(b, n)
+			})
+			b.Run(fmt.Sprintf("%s/persistent/ops=%d", kind.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					sess, closer, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16, opts...)
+					if err != nil {
+						b.Fatal(err)
+					}
+					for range n {
+						getRandom(b, tpm, sess)
+					}
+					if err := closer(); err != nil {
+						b.Fatal(err)
+					}
+				}
+				reportPerCommand(b, n)
+			})
+		}
+	}
+}
+
+// getRandom draws 32 random bytes, encrypted by sess.
+func getRandom(b *testing.B, tpm transport.TPM, sess tpm2.Session) {
+	if _, err := (tpm2.GetRandom{BytesRequested: 32}).Execute(tpm, sess); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// reportPerCommand reports the time per command, as each iteration sends n.
+func reportPerCommand(b *testing.B, n int) {
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/cmd")
+}
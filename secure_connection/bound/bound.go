@@ -3,6 +3,7 @@ package bound
 import (
 	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/objects"
 )
 
 // Bound creates an inline bound HMAC session for parameter encryption.
@@ -22,7 +23,8 @@ import (
 //   - Encryption: AES-128-CFB parameter encryption
 //
 // Best practice: The bind entity should ideally be different from the authorized
-// entity for maximum security.
+// entity for maximum security. Don't trust a bindName read from the TPM as is:
+// [BoundLoaded] checks it against the public area of the entity.
 //
 // Example usage:
 //
@@ -105,3 +107,27 @@ func BoundSession(
 		tpm2.AESEncryption(128, tpm2.EncryptInOut),
 	)
 }
+
+// BoundLoaded creates an inline bound HMAC session, like [Bound], bound to the
+// object loaded at bindHandle: its Name is read with
+// objects.ReadPublicVerified instead of being trusted from the caller. To
+// detect a handle now holding another object, use [BoundPinned].
+//
+// Example usage:
+//
+//	sess, err := bound.BoundLoaded(tpm, bindHandle, bindAuth, ownerAuth)
+//	if err != nil {
+//	    return err
+//	}
+func BoundLoaded(
+	tpm transport.TPM,
+	bindHandle tpm2.TPMHandle,
+	bindAuth []byte,
+	authValue []byte,
+) (tpm2.Session, error) {
+	pub, err := objects.ReadPublicVerified(tpm, bindHandle)
+	if err != nil {
+		return nil, err
+	}
+	return Bound(bindHandle, pub.Name, bindAuth, authValue), nil
+}
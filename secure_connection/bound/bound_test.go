@@ -4,8 +4,11 @@ import (
 	"testing"
 
 	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/handles"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/bound"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/loicsikidi/tpm-stuff/templates"
 	"github.com/stretchr/testify/require"
 )
 
@@ -13,6 +16,8 @@ func TestBound_KeyCreation(t *testing.T) {
 	tpm, err := common.OpenSimulator()
 	require.NoError(t, err)
 	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
 
 	// First, create a bind entity (a primary key to bind our session to)
 	bindPassword := []byte("bindpassword")
@@ -29,31 +34,12 @@ func TestBound_KeyCreation(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				Decrypt:             true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCDecrypter()),
 	}
 
 	bindRsp, err := createBindEntity.Execute(tpm)
 	require.NoError(t, err)
-	defer func() {
-		flush := tpm2.FlushContext{FlushHandle: bindRsp.ObjectHandle}
-		flush.Execute(tpm)
-	}()
+	tracker.Track(bindRsp.ObjectHandle)
 
 	// Now create an inline bound session (recommended default)
 	targetPassword := []byte("targetpassword")
@@ -80,44 +66,28 @@ func TestBound_KeyCreation(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				SignEncrypt:         true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCSigner()),
 	}
 
-	rsp, err := createPrimary.Execute(tpm)
+	wire := sniffer.New(tpm)
+	rsp, err := createPrimary.Execute(wire)
 	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
 	require.NotNil(t, rsp)
 	require.NotNil(t, rsp.OutPublic)
 
 	// The password was encrypted during transmission via the bound session
 	// The session secret is derived from both the bind entity's auth and the owner auth
 	// This provides stronger protection than an unbound session
-
-	// Clean up
-	flush := tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}
-	_, err = flush.Execute(tpm)
-	require.NoError(t, err)
+	require.False(t, wire.ContainsPlaintext(targetPassword))
 }
 
 func TestBoundSession_PersistentSession(t *testing.T) {
 	tpm, err := common.OpenSimulator()
 	require.NoError(t, err)
 	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
 
 	// First, create a bind entity (a primary key to bind our session to)
 	bindPassword := []byte("bindpassword")
@@ -134,36 +104,17 @@ func TestBoundSession_PersistentSession(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				Decrypt:             true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCDecrypter()),
 	}
 
 	bindRsp, err := createBindEntity.Execute(tpm)
 	require.NoError(t, err)
-	defer func() {
-		flush := tpm2.FlushContext{FlushHandle: bindRsp.ObjectHandle}
-		flush.Execute(tpm)
-	}()
+	tracker.Track(bindRsp.ObjectHandle)
 
 	// Create persistent bound session (for demonstration/performance)
 	sess, closer, err := bound.BoundSession(tpm, bindRsp.ObjectHandle, bindRsp.Name, bindPassword, []byte(""))
 	require.NoError(t, err)
-	defer closer() // Must call to release TPM slot
+	tracker.TrackSession(sess, closer)
 
 	targetPassword := []byte("targetpassword")
 
@@ -180,27 +131,12 @@ func TestBoundSession_PersistentSession(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				SignEncrypt:         true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCSigner()),
 	}
 
 	rsp, err := createPrimary.Execute(tpm)
 	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
 	require.NotNil(t, rsp)
 
 	// Reuse same session for second operation (demonstrates session reuse)
@@ -216,35 +152,11 @@ func TestBoundSession_PersistentSession(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				SignEncrypt:         true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCSigner()),
 	}
 
 	rsp2, err := createPrimary2.Execute(tpm)
 	require.NoError(t, err)
+	tracker.Track(rsp2.ObjectHandle)
 	require.NotNil(t, rsp2)
-
-	// Clean up both keys
-	flush := tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}
-	_, err = flush.Execute(tpm)
-	require.NoError(t, err)
-
-	flush2 := tpm2.FlushContext{FlushHandle: rsp2.ObjectHandle}
-	_, err = flush2.Execute(tpm)
-	require.NoError(t, err)
 }
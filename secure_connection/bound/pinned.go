@@ -0,0 +1,87 @@
+package bound
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/names"
+	"github.com/loicsikidi/tpm-stuff/objects"
+)
+
+// BoundPinned creates an inline bound HMAC session, like [Bound], after
+// checking that bindHandle still refers to the entity whose Name is
+// expectedName, e.g. a Name recorded at provisioning time.
+//
+// The public area of the bind entity is read from the TPM (TPM2_NV_ReadPublic
+// for NV indexes, TPM2_ReadPublic otherwise) and its Name is recomputed in
+// software: both the recomputed Name and the Name reported by the TPM must be
+// expectedName. The check fails closed, hardening against handle-swapping
+// attacks where another entity, e.g. one whose authValue is known to an
+// attacker, was loaded or defined at bindHandle.
+//
+// The Name of a permanent handle (e.g. TPM_RH_OWNER) is the handle itself: it
+// is checked without reading the TPM.
+//
+// Returns an error wrapping [names.ErrMismatch] on mismatch.
+//
+// Example usage:
+//
+//	// At provisioning time
+//	pinnedName := bindRsp.Name
+//
+//	// Later
+//	sess, err := bound.BoundPinned(tpm, bindHandle, pinnedName, bindAuth, ownerAuth)
+//	if err != nil {
+//	    return err
+//	}
+func BoundPinned(
+	tpm transport.TPM,
+	bindHandle tpm2.TPMHandle,
+	expectedName tpm2.TPM2BName,
+	bindAuth []byte,
+	authValue []byte,
+) (tpm2.Session, error) {
+	if err := verifyName(tpm, bindHandle, expectedName); err != nil {
+		return nil, err
+	}
+	return Bound(bindHandle, expectedName, bindAuth, authValue), nil
+}
+
+// verifyName checks that the entity at handle has the Name expected.
+func verifyName(tpm transport.TPM, handle tpm2.TPMHandle, expected tpm2.TPM2BName) error {
+	var reported, computed tpm2.TPM2BName
+	switch tpm2.TPMHT(handle >> 24) {
+	case tpm2.TPMHTPermanent, tpm2.TPMHTPCR:
+		reported = tpm2.HandleName(handle)
+		computed = reported
+	case tpm2.TPMHTNVIndex:
+		rsp, err := tpm2.NVReadPublic{NVIndex: handle}.Execute(tpm)
+		if err != nil {
+			return fmt.Errorf("failed to read public area of NV index 0x%x: %w", handle, err)
+		}
+		pub, err := rsp.NVPublic.Contents()
+		if err != nil {
+			return fmt.Errorf("failed to parse public area of NV index 0x%x: %w", handle, err)
+		}
+		reported = rsp.NVName
+		if computed, err = names.ComputeNV(*pub); err != nil {
+			return fmt.Errorf("failed to compute name of NV index 0x%x: %w", handle, err)
+		}
+	default:
+		// The reported Name is checked against the public area.
+		pub, err := objects.ReadPublicVerified(tpm, handle)
+		if err != nil {
+			return err
+		}
+		reported, computed = pub.Name, pub.Name
+	}
+	if !bytes.Equal(computed.Buffer, expected.Buffer) {
+		return fmt.Errorf("%w: bind entity 0x%x has name %x, expected %x", names.ErrMismatch, handle, computed.Buffer, expected.Buffer)
+	}
+	if !bytes.Equal(reported.Buffer, expected.Buffer) {
+		return fmt.Errorf("%w: TPM reported name %x for bind entity 0x%x, expected %x", names.ErrMismatch, reported.Buffer, handle, expected.Buffer)
+	}
+	return nil
+}
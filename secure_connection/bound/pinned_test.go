@@ -0,0 +1,118 @@
+package bound_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/handles"
+	"github.com/loicsikidi/tpm-stuff/names"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/bound"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+// createKey creates a primary decryption key protected by auth.
+func createKey(t *testing.T, tpm transport.TPM, tracker *handles.Tracker, auth []byte) *tpm2.CreatePrimaryResponse {
+	t.Helper()
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: auth},
+			},
+		},
+		InPublic: tpm2.New2B(templates.ECCDecrypter()),
+	}.Execute(tpm)
+	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
+	return rsp
+}
+
+// useSession runs an owner-authorized command in sess.
+func useSession(tpm transport.TPM, sess tpm2.Session) error {
+	_, err := tpm2.HierarchyChangeAuth{
+		AuthHandle: tpm2.AuthHandle{Handle: tpm2.TPMRHOwner, Auth: sess},
+		NewAuth:    tpm2.TPM2BAuth{},
+	}.Execute(tpm)
+	return err
+}
+
+func TestBoundPinned(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
+
+	bindPassword := []byte("bindpassword")
+	bindRsp := createKey(t, tpm, tracker, bindPassword)
+
+	sess, err := bound.BoundPinned(tpm, bindRsp.ObjectHandle, bindRsp.Name, bindPassword, nil)
+	require.NoError(t, err)
+	require.NoError(t, useSession(tpm, sess))
+
+	// The owner hierarchy is named after its handle.
+	sess, err = bound.BoundPinned(tpm, tpm2.TPMRHOwner, tpm2.HandleName(tpm2.TPMRHOwner), nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, useSession(tpm, sess))
+}
+
+// TestBoundPinned_HandleSwap flushes the bind entity and creates another key
+// in its place: the transient handle is reused by the TPM.
+func TestBoundPinned_HandleSwap(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
+
+	bindRsp := createKey(t, tpm, tracker, []byte("bindpassword"))
+	require.NoError(t, tracker.Flush(bindRsp.ObjectHandle))
+
+	swapped := createKey(t, tpm, tracker, []byte("attacker"))
+	require.Equal(t, bindRsp.ObjectHandle, swapped.ObjectHandle)
+
+	sess, err := bound.BoundPinned(tpm, swapped.ObjectHandle, bindRsp.Name, []byte("attacker"), nil)
+	require.ErrorIs(t, err, names.ErrMismatch)
+	require.Nil(t, sess)
+}
+
+func TestBoundPinned_NVIndex(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+
+	nvInfo, err := common.CreateNVIndex(tpm, 0x01500050, 8, "nvpassword")
+	require.NoError(t, err)
+	pinned := nvInfo.NamedHandle().Name
+
+	sess, err := bound.BoundPinned(tpm, nvInfo.NamedHandle().Handle, pinned, []byte("nvpassword"), nil)
+	require.NoError(t, err)
+	require.NoError(t, useSession(tpm, sess))
+
+	// The index is redefined with another password and size.
+	require.NoError(t, common.DeleteNVIndex(tpm, nvInfo))
+	swapped, err := common.CreateNVIndex(tpm, 0x01500050, 16, "attacker")
+	require.NoError(t, err)
+	defer common.DeleteNVIndex(tpm, swapped)
+
+	_, err = bound.BoundPinned(tpm, swapped.NamedHandle().Handle, pinned, []byte("attacker"), nil)
+	require.ErrorIs(t, err, names.ErrMismatch)
+}
+
+func TestBoundLoaded(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
+
+	bindPassword := []byte("bindpassword")
+	bindRsp := createKey(t, tpm, tracker, bindPassword)
+
+	sess, err := bound.BoundLoaded(tpm, bindRsp.ObjectHandle, bindPassword, nil)
+	require.NoError(t, err)
+	require.NoError(t, useSession(tpm, sess))
+}
@@ -3,7 +3,10 @@ package common_test
 import (
 	"testing"
 
+	"github.com/google/go-tpm/tpm2"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/salted"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
 	"github.com/stretchr/testify/require"
 )
 
@@ -41,3 +44,49 @@ func TestCreateAndDeleteNVIndex(t *testing.T) {
 	err = common.DeleteNVIndex(tpm, nvInfo)
 	require.NoError(t, err)
 }
+
+func TestNVIndex_Sniffed(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+	ek, err := salted.WithCachedEK(tpm)
+	require.NoError(t, err)
+
+	password := "nvpassword"
+	data := []byte("nv secret data")
+
+	t.Run("password", func(t *testing.T) {
+		wire := sniffer.New(tpm)
+		nvInfo, err := common.CreateNVIndex(wire, 0x01000001, 32, password)
+		require.NoError(t, err)
+		defer common.DeleteNVIndex(tpm, nvInfo) //nolint:errcheck
+		require.True(t, wire.SentPlaintext([]byte(password)))
+
+		wire.Reset()
+		require.NoError(t, common.WriteNVIndex(wire, nvInfo, data, tpm2.PasswordAuth([]byte(password))))
+		got, err := common.ReadNVIndex(wire, nvInfo, tpm2.PasswordAuth([]byte(password)))
+		require.NoError(t, err)
+		require.Equal(t, data, got[:len(data)])
+		require.True(t, wire.SentPlaintext([]byte(password)))
+		require.True(t, wire.SentPlaintext(data))
+		require.True(t, wire.ReceivedPlaintext(data))
+	})
+
+	t.Run("salted", func(t *testing.T) {
+		wire := sniffer.New(tpm)
+		nvInfo, err := common.CreateNVIndexSalted(wire, 0x01000002, 32, password)
+		require.NoError(t, err)
+		defer common.DeleteNVIndex(tpm, nvInfo) //nolint:errcheck
+
+		require.NoError(t, common.WriteNVIndex(wire, nvInfo, data, ek.SaltedAuthIn([]byte(password))))
+		got, err := common.ReadNVIndex(wire, nvInfo, ek.SaltedAuthOut([]byte(password)))
+		require.NoError(t, err)
+		require.Equal(t, data, got[:len(data)])
+		require.False(t, wire.ContainsPlaintext([]byte(password)))
+		require.False(t, wire.ContainsPlaintext(data))
+
+		// The session still proves the password.
+		_, err = common.ReadNVIndex(tpm, nvInfo, ek.SaltedAuthOut([]byte("wrong")))
+		require.ErrorIs(t, err, tpm2.TPMRCAuthFail)
+	})
+}
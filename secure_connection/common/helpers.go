@@ -6,6 +6,8 @@ import (
 
 	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/nv"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/salted"
 )
 
 // GenerateRandomData generates random bytes of the specified size.
@@ -18,80 +20,61 @@ func GenerateRandomData(size int) ([]byte, error) {
 }
 
 // NVIndexInfo contains information about a created NV index.
-type NVIndexInfo struct {
-	Handle tpm2.TPMHandle
-	Name   tpm2.TPM2BName
-}
+type NVIndexInfo = nv.Index
 
 // CreateNVIndex creates a test NV index with the specified attributes.
 // Returns NV index information including handle and name.
+//
+// The password travels in clear on the bus: see [CreateNVIndexSalted].
 func CreateNVIndex(tpm transport.TPM, index uint32, size uint16, password string) (*NVIndexInfo, error) {
-	nvHandle := tpm2.TPMHandle(index)
+	return CreateNVIndexWithSession(tpm, index, size, password, nil)
+}
 
-	publicInfo := tpm2.New2B(tpm2.TPMSNVPublic{
-		NVIndex: nvHandle,
-		NameAlg: tpm2.TPMAlgSHA256,
-		Attributes: tpm2.TPMANV{
-			OwnerWrite: true,
-			OwnerRead:  true,
-			AuthWrite:  true,
-			AuthRead:   true,
-		},
-		AuthPolicy: tpm2.TPM2BDigest{},
-		DataSize:   size,
+// CreateNVIndexWithSession is [CreateNVIndex] with the owner hierarchy
+// authorized by ownerAuth. When ownerAuth encrypts the command parameters
+// (e.g. salted.Salted), the password of the index, the first parameter of
+// TPM2_NV_DefineSpace, is protected on the bus. A nil ownerAuth authorizes
+// with an empty password.
+func CreateNVIndexWithSession(tpm transport.TPM, index uint32, size uint16, password string, ownerAuth tpm2.Session) (*NVIndexInfo, error) {
+	return nv.Define(tpm, nv.DefineConfig{
+		Index:     tpm2.TPMHandle(index),
+		Size:      size,
+		Auth:      []byte(password),
+		OwnerAuth: ownerAuth,
 	})
+}
 
-	defineSpace := tpm2.NVDefineSpace{
-		AuthHandle: tpm2.AuthHandle{
-			Handle: tpm2.TPMRHOwner,
-			Auth:   tpm2.PasswordAuth([]byte("")),
-		},
-		Auth: tpm2.TPM2BAuth{
-			Buffer: []byte(password),
-		},
-		PublicInfo: publicInfo,
-	}
-
-	_, err := defineSpace.Execute(tpm)
+// CreateNVIndexSalted is [CreateNVIndex] through a session salted with the EK
+// (see salted.WithCachedEK), which encrypts the password of the index. The
+// owner hierarchy must have an empty authorization value.
+func CreateNVIndexSalted(tpm transport.TPM, index uint32, size uint16, password string) (*NVIndexInfo, error) {
+	ek, err := salted.WithCachedEK(tpm)
 	if err != nil {
-		return nil, fmt.Errorf("failed to define NV space: %w", err)
-	}
-
-	// Read the public info to get the name
-	readPub := tpm2.NVReadPublic{
-		NVIndex: nvHandle,
+		return nil, err
 	}
+	// TPM2_NV_DefineSpace has no response parameter to encrypt.
+	return CreateNVIndexWithSession(tpm, index, size, password, ek.SaltedAuthIn(nil))
+}
 
-	readPubRsp, err := readPub.Execute(tpm)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read NV public: %w", err)
-	}
+// WriteNVIndex writes data at the beginning of the NV index, authorized by
+// auth. With a session authorizing with the password of the index and
+// encrypting the command (e.g. salted.SaltedAuthIn), neither the password
+// nor data travel in clear; with tpm2.PasswordAuth, both do.
+func WriteNVIndex(tpm transport.TPM, nvInfo *NVIndexInfo, data []byte, auth tpm2.Session) error {
+	return nv.Write(tpm, nvInfo, data, auth)
+}
 
-	return &NVIndexInfo{
-		Handle: nvHandle,
-		Name:   readPubRsp.NVName,
-	}, nil
+// ReadNVIndex reads the whole NV index, authorized by auth. As for
+// [WriteNVIndex], auth should encrypt the response to protect the data on the
+// bus (e.g. salted.SaltedAuthOut): the size read, the first command
+// parameter, can't be encrypted.
+func ReadNVIndex(tpm transport.TPM, nvInfo *NVIndexInfo, auth tpm2.Session) ([]byte, error) {
+	return nv.Read(tpm, nvInfo, auth)
 }
 
 // DeleteNVIndex removes an NV index.
 func DeleteNVIndex(tpm transport.TPM, nvInfo *NVIndexInfo) error {
-	undefineSpace := tpm2.NVUndefineSpace{
-		AuthHandle: tpm2.AuthHandle{
-			Handle: tpm2.TPMRHOwner,
-			Auth:   tpm2.PasswordAuth([]byte("")),
-		},
-		NVIndex: tpm2.NamedHandle{
-			Handle: nvInfo.Handle,
-			Name:   nvInfo.Name,
-		},
-	}
-
-	_, err := undefineSpace.Execute(tpm)
-	if err != nil {
-		return fmt.Errorf("failed to undefine NV space: %w", err)
-	}
-
-	return nil
+	return nv.Undefine(tpm, nvInfo)
 }
 
 // HMACAuth creates an inline HMAC session for authorization using an authValue.
@@ -119,10 +102,12 @@ func DeleteNVIndex(tpm transport.TPM, nvInfo *NVIndexInfo) error {
 //	rsp, err := tpm2.CreatePrimary{
 //	    PrimaryHandle: tpm2.AuthHandle{
 //	        Handle: tpm2.TPMRHOwner,
-//	        Auth:   tpm2.MultiSession(authSess, encryptSess),
+//	        Auth:   authSess,
 //	    },
 //	    // ...
-//	}.Execute(tpm)
+//	}.Execute(tpm, encryptSess)
+//
+// sessions.AuthAndEncrypt pairs both sessions in AuthHandle.Auth.
 func HMACAuth(authValue []byte) tpm2.Session {
 	return tpm2.HMAC(
 		tpm2.TPMAlgSHA256,
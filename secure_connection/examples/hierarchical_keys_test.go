@@ -4,8 +4,11 @@ import (
 	"testing"
 
 	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/handles"
+	"github.com/loicsikidi/tpm-stuff/policy"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/salted"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
 	"github.com/stretchr/testify/require"
 )
 
@@ -31,6 +34,8 @@ func TestHierarchicalKeyCreation(t *testing.T) {
 	tpm, err := common.OpenSimulator()
 	require.NoError(t, err)
 	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
 
 	// Step 1: Create EK for salted sessions (simulating production EK)
 	createEK := tpm2.CreatePrimary{
@@ -43,10 +48,7 @@ func TestHierarchicalKeyCreation(t *testing.T) {
 
 	ekRsp, err := createEK.Execute(tpm)
 	require.NoError(t, err)
-	defer func() {
-		flush := tpm2.FlushContext{FlushHandle: ekRsp.ObjectHandle}
-		flush.Execute(tpm)
-	}()
+	tracker.Track(ekRsp.ObjectHandle)
 
 	ekPub, err := ekRsp.OutPublic.Contents()
 	require.NoError(t, err)
@@ -55,6 +57,9 @@ func TestHierarchicalKeyCreation(t *testing.T) {
 	// Create the encryption session (reusable across all operations)
 	encryptSess := salted.Salted(ekRsp.ObjectHandle, *ekPub)
 
+	// Record what an eavesdropper on the bus sees from now on
+	wire := sniffer.New(tpm)
+
 	// Step 2: Create primary key A under Owner hierarchy
 	keyAPassword := []byte("passwordA")
 
@@ -77,12 +82,9 @@ func TestHierarchicalKeyCreation(t *testing.T) {
 	}
 
 	// Pass encryption session to Execute()
-	keyARsp, err := createPrimaryA.Execute(tpm, encryptSess)
+	keyARsp, err := createPrimaryA.Execute(wire, encryptSess)
 	require.NoError(t, err)
-	defer func() {
-		flush := tpm2.FlushContext{FlushHandle: keyARsp.ObjectHandle}
-		flush.Execute(tpm)
-	}()
+	tracker.Track(keyARsp.ObjectHandle)
 	t.Logf("✓ Step 2: Created primary key A (Owner → A)")
 
 	// Step 3: Create key B (child of A) with password "xoxo"
@@ -108,7 +110,7 @@ func TestHierarchicalKeyCreation(t *testing.T) {
 	}
 
 	// Pass encryption session to Execute()
-	keyBRsp, err := createKeyB.Execute(tpm, encryptSess)
+	keyBRsp, err := createKeyB.Execute(wire, encryptSess)
 	require.NoError(t, err)
 
 	// Load key B (reuse authSessKeyA since we still auth to key A)
@@ -123,14 +125,15 @@ func TestHierarchicalKeyCreation(t *testing.T) {
 	}
 
 	// Pass encryption session to Execute()
-	loadKeyBRsp, err := loadKeyB.Execute(tpm, encryptSess)
+	loadKeyBRsp, err := loadKeyB.Execute(wire, encryptSess)
 	require.NoError(t, err)
-	defer func() {
-		flush := tpm2.FlushContext{FlushHandle: loadKeyBRsp.ObjectHandle}
-		flush.Execute(tpm)
-	}()
+	tracker.Track(loadKeyBRsp.ObjectHandle)
 	t.Logf("✓ Step 3: Created and loaded key B (A → B)")
 
+	// Neither password ever travelled in clear
+	require.False(t, wire.ContainsPlaintext(keyAPassword))
+	require.False(t, wire.ContainsPlaintext(keyBPassword))
+
 	// Summary
 	t.Log("\n=== Summary ===")
 	t.Log("✓ All operations completed with BOTH authorization AND parameter encryption")
@@ -149,3 +152,140 @@ func TestHierarchicalKeyCreation(t *testing.T) {
 	t.Log("✅ Encryption session can be reused (no entity binding)")
 	t.Log("✅ All passwords were encrypted on the TPM bus")
 }
+
+// TestHierarchicalKeyCreation_Plaintext is the counterpart of
+// TestHierarchicalKeyCreation without any session: password authorizations
+// and unencrypted parameters expose both passwords on the bus.
+func TestHierarchicalKeyCreation_Plaintext(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
+
+	wire := sniffer.New(tpm)
+
+	// Step 1: Create primary key A under Owner hierarchy
+	keyAPassword := []byte("passwordA")
+
+	createPrimaryA := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMRHOwner,
+			Auth:   tpm2.PasswordAuth([]byte("")),
+		},
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{
+					Buffer: keyAPassword, // Sent in clear
+				},
+			},
+		},
+		InPublic: tpm2.New2B(tpm2.ECCSRKTemplate),
+	}
+
+	keyARsp, err := createPrimaryA.Execute(wire)
+	require.NoError(t, err)
+	tracker.Track(keyARsp.ObjectHandle)
+	require.True(t, wire.SentPlaintext(keyAPassword))
+
+	// Step 2: Create key B (child of A) with password "xoxo"
+	keyBPassword := []byte("xoxo")
+
+	wire.Reset()
+	createKeyB := tpm2.Create{
+		ParentHandle: tpm2.AuthHandle{
+			Handle: keyARsp.ObjectHandle,
+			Name:   keyARsp.Name,
+			Auth:   tpm2.PasswordAuth(keyAPassword), // Sent in clear
+		},
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{
+					Buffer: keyBPassword, // Sent in clear
+				},
+			},
+		},
+		InPublic: tpm2.New2B(tpm2.ECCSRKTemplate),
+	}
+
+	_, err = createKeyB.Execute(wire)
+	require.NoError(t, err)
+
+	// The authorization of key A and the password of key B
+	require.True(t, wire.SentPlaintext(keyAPassword))
+	require.True(t, wire.SentPlaintext(keyBPassword))
+}
+
+// TestEKParentedKeyCreation demonstrates using the EK itself, here as the
+// parent of a new key, on top of using it as salt key.
+//
+// The EK created from the TCG default template has no userWithAuth: its use
+// is only authorized by its policy, PolicySecret(TPM_RH_ENDORSEMENT). An
+// empty password is rejected, so the demos that skip this step fail on real
+// TPMs. policy.Endorsement satisfies the policy before each command.
+//
+// Scenario:
+// 1. Create EK (salt key) for salted encryption sessions
+// 2. Create key C (child of EK) with password "xoxo"
+func TestEKParentedKeyCreation(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
+
+	// Step 1: Create EK for salted sessions
+	createEK := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMRHEndorsement,
+			Auth:   tpm2.PasswordAuth([]byte("")),
+		},
+		InPublic: tpm2.New2B(tpm2.RSAEKTemplate),
+	}
+
+	ekRsp, err := createEK.Execute(tpm)
+	require.NoError(t, err)
+	tracker.Track(ekRsp.ObjectHandle)
+
+	ekPub, err := ekRsp.OutPublic.Contents()
+	require.NoError(t, err)
+	t.Logf("✓ Step 1: Created EK for salted sessions")
+
+	encryptSess := salted.Salted(ekRsp.ObjectHandle, *ekPub)
+
+	// Step 2: Create key C (child of EK) with password "xoxo"
+	keyCPassword := []byte("xoxo")
+
+	createKeyC := tpm2.Create{
+		ParentHandle: tpm2.AuthHandle{
+			Handle: ekRsp.ObjectHandle,
+			Name:   ekRsp.Name,
+			Auth:   tpm2.PasswordAuth(nil),
+		},
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{
+					Buffer: keyCPassword, // Password FOR key C (will be encrypted)
+				},
+			},
+		},
+		InPublic: tpm2.New2B(tpm2.ECCSRKTemplate),
+	}
+
+	// A password can't authorize the EK
+	_, err = createKeyC.Execute(tpm, encryptSess)
+	require.Error(t, err)
+
+	// Policy session authorizing the EK (empty endorsement password)
+	createKeyC.ParentHandle = tpm2.AuthHandle{
+		Handle: ekRsp.ObjectHandle,
+		Name:   ekRsp.Name,
+		Auth:   policy.Endorsement(), // Authorizes access to the EK
+	}
+
+	// Pass encryption session to Execute()
+	keyCRsp, err := createKeyC.Execute(tpm, encryptSess)
+	require.NoError(t, err)
+	require.NotNil(t, keyCRsp.OutPrivate)
+	t.Logf("✓ Step 2: Created key C (EK → C)")
+}
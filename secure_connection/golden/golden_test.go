@@ -0,0 +1,183 @@
+// Package golden_test pins the bytes put on the bus by the unbound, bound and
+// salted sessions, so that an upgrade of go-tpm silently changing how
+// sessions are built (nonces, salt encryption, session key derivation, HMAC,
+// parameter encryption) fails the tests.
+//
+// The command streams are made reproducible by fixing every input of the
+// sessions: the caller nonces and salts come from a fixed [io.Reader]
+// swapped for crypto/rand.Reader, and the TPM is a scripted transport
+// answering fixed TPM nonces. The authorized command is rejected by the
+// scripted TPM: only the commands are pinned, not the response processing.
+//
+// After reviewing a legitimate change, record the new streams with:
+//
+//	go test ./secure_connection/golden -update
+package golden_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/bound"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/salted"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/unbound"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "record the golden command streams")
+
+const (
+	// bindHandle and saltHandle are the handles of the bind and salt keys,
+	// which the scripted TPM doesn't need to hold.
+	bindHandle tpm2.TPMHandle = 0x80000001
+	saltHandle tpm2.TPMHandle = 0x80000002
+	// firstSession is the handle of the first session started by the
+	// scripted TPM.
+	firstSession tpm2.TPMHandle = 0x02000000
+)
+
+var (
+	ownerAuth = []byte("owner-password")
+	bindAuth  = []byte("bind-password")
+	newAuth   = []byte("new-owner-password")
+	// bindName is the Name of the bind key: a SHA-256 Name.
+	bindName = tpm2.TPM2BName{Buffer: append([]byte{0x00, 0x0b}, bytes.Repeat([]byte{0xb1}, 32)...)}
+)
+
+// counter is a reader returning 0x00, 0x01, ..., 0xff, 0x00...: a fixed
+// source of nonces and salts.
+type counter struct {
+	next byte
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = c.next
+		c.next++
+	}
+	return len(p), nil
+}
+
+// scripted is a TPM answering TPM2_StartAuthSession with a new session
+// handle and a fixed TPM nonce, TPM2_FlushContext with success and any other
+// command with TPM_RC_BAD_AUTH. It records the commands.
+type scripted struct {
+	commands [][]byte
+	sessions int
+}
+
+func (s *scripted) Send(cmd []byte) ([]byte, error) {
+	s.commands = append(s.commands, bytes.Clone(cmd))
+	switch tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:10])) {
+	case tpm2.TPMCCStartAuthSession:
+		handle := firstSession + tpm2.TPMHandle(s.sessions)
+		s.sessions++
+		nonce := bytes.Repeat([]byte{0xa0 + byte(s.sessions)}, 16)
+		rsp := binary.BigEndian.AppendUint16(nil, uint16(tpm2.TPMSTNoSessions))
+		rsp = binary.BigEndian.AppendUint32(rsp, uint32(10+4+2+len(nonce)))
+		rsp = binary.BigEndian.AppendUint32(rsp, uint32(tpm2.TPMRCSuccess))
+		rsp = binary.BigEndian.AppendUint32(rsp, uint32(handle))
+		rsp = binary.BigEndian.AppendUint16(rsp, uint16(len(nonce)))
+		return append(rsp, nonce...), nil
+	case tpm2.TPMCCFlushContext:
+		return response(tpm2.TPMRCSuccess), nil
+	}
+	return response(tpm2.TPMRCBadAuth), nil
+}
+
+// response returns a response without handles nor parameters.
+func response(rc tpm2.TPMRC) []byte {
+	rsp := binary.BigEndian.AppendUint16(nil, uint16(tpm2.TPMSTNoSessions))
+	rsp = binary.BigEndian.AppendUint32(rsp, 10)
+	return binary.BigEndian.AppendUint32(rsp, uint32(rc))
+}
+
+// record returns the commands sent by TPM2_HierarchyChangeAuth, whose new
+// authorization value is encrypted, authorized with sess.
+func record(t *testing.T, sess tpm2.Session) [][]byte {
+	t.Helper()
+	saved := rand.Reader
+	rand.Reader = &counter{}
+	t.Cleanup(func() { rand.Reader = saved })
+
+	tpm := &scripted{}
+	_, err := tpm2.HierarchyChangeAuth{
+		AuthHandle: tpm2.AuthHandle{Handle: tpm2.TPMRHOwner, Auth: sess},
+		NewAuth:    tpm2.TPM2BAuth{Buffer: newAuth},
+	}.Execute(tpm)
+	require.ErrorIs(t, err, tpm2.TPMRCBadAuth)
+	return tpm.commands
+}
+
+// golden compares commands with the stream recorded in testdata/name.hex,
+// one hex encoded command per line.
+func golden(t *testing.T, name string, commands [][]byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".hex")
+	var sb strings.Builder
+	for _, c := range commands {
+		sb.WriteString(hex.EncodeToString(c) + "\n")
+	}
+	if *update {
+		require.NoError(t, os.WriteFile(path, []byte(sb.String()), 0o644))
+		return
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(want), sb.String(), "command stream changed: review it, then run with -update")
+}
+
+// saltKey returns the RSA-2048 salt key of testdata/salt_key.hex.
+func saltKey(t *testing.T) tpm2.TPMTPublic {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "salt_key.hex"))
+	require.NoError(t, err)
+	b, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	require.NoError(t, err)
+	pub, err := tpm2.Unmarshal[tpm2.TPMTPublic](b)
+	require.NoError(t, err)
+	return *pub
+}
+
+func TestUnbound(t *testing.T) {
+	commands := record(t, unbound.Unbound(ownerAuth))
+	golden(t, "unbound", commands)
+
+	// The new authorization value never travels in clear.
+	for _, c := range commands {
+		require.False(t, bytes.Contains(c, newAuth))
+	}
+}
+
+func TestBound(t *testing.T) {
+	commands := record(t, bound.Bound(bindHandle, bindName, bindAuth, ownerAuth))
+	golden(t, "bound", commands)
+
+	for _, c := range commands {
+		require.False(t, bytes.Contains(c, newAuth))
+	}
+}
+
+func TestSalted(t *testing.T) {
+	commands := record(t, salted.Salted(saltHandle, saltKey(t)))
+	golden(t, "salted", commands)
+
+	for _, c := range commands {
+		require.False(t, bytes.Contains(c, newAuth))
+	}
+}
+
+// TestStability checks that the inputs of the sessions are all fixed: two
+// recordings are identical.
+func TestStability(t *testing.T) {
+	require.Equal(t, record(t, unbound.Unbound(ownerAuth)), record(t, unbound.Unbound(ownerAuth)))
+	require.Equal(t, record(t, salted.Salted(saltHandle, saltKey(t))), record(t, salted.Salted(saltHandle, saltKey(t))))
+}
@@ -0,0 +1,187 @@
+// Package misuse_test exercises sessions used the wrong way and asserts the
+// response code returned by the TPM, as a reference for expected failures.
+//
+// An authorization failure names the session at fault ("session 1" is the
+// first session of the command): errors.Is matches the response code
+// whatever the session, parameter or handle index.
+package misuse_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	bindAuth = []byte("bind-password")
+	keyAuth  = []byte("key-password")
+)
+
+// openSimulator opens a fresh simulator, closed at the end of the test.
+func openSimulator(t *testing.T) transport.TPM {
+	t.Helper()
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	t.Cleanup(func() { tpm.Close() })
+	return tpm
+}
+
+// createKey creates a storage primary key from template, protected by auth.
+func createKey(t *testing.T, tpm transport.TPM, template tpm2.TPMTPublic, auth []byte) tpmutil.Handle {
+	t.Helper()
+	key, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		InPublic: template,
+		UserAuth: auth,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { key.Close() })
+	return key
+}
+
+// createChild creates a child of parent, authorized with auth. Extra
+// sessions, e.g. for parameter encryption, are added to the command.
+func createChild(tpm transport.TPM, parent tpmutil.Handle, auth tpm2.Session, sessions ...tpm2.Session) error {
+	_, err := tpm2.Create{
+		ParentHandle: tpmutil.ToAuthHandle(parent, auth),
+		InPublic:     tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(tpm, sessions...)
+	return err
+}
+
+func TestWrongBindAuth(t *testing.T) {
+	tpm := openSimulator(t)
+	bindKey := createKey(t, tpm, tpm2.RSASRKTemplate, bindAuth)
+	key := createKey(t, tpm, tpm2.ECCSRKTemplate, keyAuth)
+
+	bound := func(bindAuth []byte) tpm2.Session {
+		return tpm2.HMAC(tpm2.TPMAlgSHA256, 16,
+			tpm2.Auth(keyAuth),
+			tpm2.Bound(bindKey.Handle(), bindKey.Name(), bindAuth))
+	}
+	require.NoError(t, createChild(tpm, key, bound(bindAuth)))
+
+	// The session key derives from the bind auth value: with a wrong value
+	// the HMAC doesn't match, although the auth value of key is right.
+	// Keys created with noDA fail without DA implications.
+	require.ErrorIs(t, createChild(tpm, key, bound([]byte("wrong"))), tpm2.TPMRCBadAuth)
+}
+
+func TestBindToSameName(t *testing.T) {
+	tpm := openSimulator(t)
+	// Primary keys created from the same template in the same hierarchy are
+	// the same key, with the same name, whatever their auth value.
+	bindKey := createKey(t, tpm, tpm2.ECCSRKTemplate, bindAuth)
+	key := createKey(t, tpm, tpm2.ECCSRKTemplate, keyAuth)
+	require.Equal(t, bindKey.Name(), key.Name())
+
+	// go-tpm recognizes the bind entity by its name and leaves keyAuth out
+	// of the HMAC, while the TPM also compares the auth values: the key
+	// isn't the bind entity for the TPM.
+	err := createChild(tpm, key, tpm2.HMAC(tpm2.TPMAlgSHA256, 16,
+		tpm2.Auth(keyAuth),
+		tpm2.Bound(bindKey.Handle(), bindKey.Name(), bindAuth)))
+	require.ErrorIs(t, err, tpm2.TPMRCBadAuth)
+}
+
+func TestWrongAuth_DA(t *testing.T) {
+	tpm := openSimulator(t)
+	template := tpm2.ECCSRKTemplate
+	template.ObjectAttributes.NoDA = false
+	key := createKey(t, tpm, template, keyAuth)
+
+	// Without noDA, a failed authorization increments the DA counter.
+	err := createChild(tpm, key, tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Auth([]byte("wrong"))))
+	require.ErrorIs(t, err, tpm2.TPMRCAuthFail)
+}
+
+func TestFlushedSession(t *testing.T) {
+	tpm := openSimulator(t)
+	key := createKey(t, tpm, tpm2.ECCSRKTemplate, keyAuth)
+
+	sess, closer, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16, tpm2.Auth(keyAuth))
+	require.NoError(t, err)
+	require.NoError(t, createChild(tpm, key, sess))
+	require.NoError(t, closer())
+
+	// The session handle no longer references a loaded session.
+	require.ErrorIs(t, createChild(tpm, key, sess), tpm2.TPMRCReferenceS0)
+}
+
+func TestSessionSlots(t *testing.T) {
+	tpm := openSimulator(t)
+
+	// The simulator holds 3 loaded sessions (TPM_PT_HR_LOADED_MIN).
+	var closers []func() error
+	t.Cleanup(func() {
+		for _, closer := range closers {
+			closer() //nolint:errcheck
+		}
+	})
+	for range 3 {
+		_, closer, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16)
+		require.NoError(t, err)
+		closers = append(closers, closer)
+	}
+	_, _, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16)
+	require.ErrorIs(t, err, tpm2.TPMRCSessionMemory)
+
+	// Flushing a session frees its slot.
+	require.NoError(t, closers[0]())
+	closers = closers[1:]
+	_, closer, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16)
+	require.NoError(t, err)
+	closers = append(closers, closer)
+
+	// A command carries at most 3 sessions: go-tpm rejects a fourth one
+	// before sending the command.
+	_, err = tpm2.GetRandom{BytesRequested: 8}.Execute(tpm,
+		tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.AESEncryption(128, tpm2.EncryptOut)),
+		tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Audit()),
+		tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Audit()),
+		tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Audit()))
+	require.ErrorContains(t, err, "too many sessions")
+}
+
+func TestEncryptionWithWrongHierarchyAuth(t *testing.T) {
+	tpm := openSimulator(t)
+	saltKey := createKey(t, tpm, tpm2.ECCSRKTemplate, nil)
+	ownerAuth := []byte("owner-password")
+	_, err := tpm2.HierarchyChangeAuth{
+		AuthHandle: tpm2.AuthHandle{Handle: tpm2.TPMRHOwner, Auth: tpm2.PasswordAuth(nil)},
+		NewAuth:    tpm2.TPM2BAuth{Buffer: ownerAuth},
+	}.Execute(tpm)
+	require.NoError(t, err)
+
+	createPrimary := func(auth tpm2.Session, sessions ...tpm2.Session) error {
+		rsp, err := tpm2.CreatePrimary{
+			PrimaryHandle: tpm2.AuthHandle{Handle: tpm2.TPMRHOwner, Auth: auth},
+			InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+		}.Execute(tpm, sessions...)
+		if err != nil {
+			return err
+		}
+		_, err = tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm)
+		return err
+	}
+	encrypt := func() tpm2.Session {
+		return tpm2.HMAC(tpm2.TPMAlgSHA256, 16,
+			tpm2.Salted(saltKey.Handle(), *saltKey.Public()),
+			tpm2.AESEncryption(128, tpm2.EncryptIn))
+	}
+
+	// A valid encryption session doesn't make up for a wrong password in
+	// the authorization session: the hierarchies are not DA protected.
+	require.ErrorIs(t, createPrimary(tpm2.PasswordAuth([]byte("wrong")), encrypt()), tpm2.TPMRCBadAuth)
+	require.NoError(t, createPrimary(tpm2.PasswordAuth(ownerAuth), encrypt()))
+
+	// Nor does it when the authorization session also encrypts.
+	wrong := tpm2.HMAC(tpm2.TPMAlgSHA256, 16,
+		tpm2.Auth([]byte("wrong")),
+		tpm2.Salted(saltKey.Handle(), *saltKey.Public()),
+		tpm2.AESEncryption(128, tpm2.EncryptIn))
+	require.ErrorIs(t, createPrimary(wrong), tpm2.TPMRCBadAuth)
+}
@@ -0,0 +1,206 @@
+// Package mitm simulates an attacker sitting on the TPM bus.
+//
+// Its transport forwards commands to a real TPM but can tamper with selected
+// commands and responses: flip parameter bytes, swap handles or replay an old
+// response. It shows which sessions detect such attacks: HMAC sessions cover
+// the command and response parameters, handle names and nonces, while a
+// password session only proves the knowledge of a secret sent in clear.
+package mitm
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/decode"
+)
+
+// Tamper modifies a command or a response. It receives a copy of the message
+// and returns the message to deliver.
+type Tamper func(msg []byte) ([]byte, error)
+
+// Transport is a [transport.TPM] which tampers with the commands and
+// responses matching its rules. It is safe for concurrent use.
+type Transport struct {
+	tpm transport.TPM
+
+	mu        sync.Mutex
+	commands  map[tpm2.TPMCC]Tamper
+	responses map[tpm2.TPMCC]Tamper
+	replays   map[tpm2.TPMCC][]byte
+	replaying map[tpm2.TPMCC]bool
+	tampered  int
+}
+
+// New returns a Transport forwarding commands to tpm, untouched until rules
+// are added.
+func New(tpm transport.TPM) *Transport {
+	return &Transport{
+		tpm:       tpm,
+		commands:  make(map[tpm2.TPMCC]Tamper),
+		responses: make(map[tpm2.TPMCC]Tamper),
+		replays:   make(map[tpm2.TPMCC][]byte),
+		replaying: make(map[tpm2.TPMCC]bool),
+	}
+}
+
+// TamperCommand applies fn to the next commands of code cc, before they reach
+// the TPM.
+func (t *Transport) TamperCommand(cc tpm2.TPMCC, fn Tamper) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.commands[cc] = fn
+}
+
+// TamperResponse applies fn to the responses to the next commands of code cc,
+// before they reach the caller.
+func (t *Transport) TamperResponse(cc tpm2.TPMCC, fn Tamper) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.responses[cc] = fn
+}
+
+// ReplayResponse records the response to the next command of code cc, then
+// answers the following commands of code cc with it, without forwarding them
+// to the TPM.
+func (t *Transport) ReplayResponse(cc tpm2.TPMCC) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.replaying[cc] = true
+	delete(t.replays, cc)
+}
+
+// Reset removes all the rules.
+func (t *Transport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.commands)
+	clear(t.responses)
+	clear(t.replays)
+	clear(t.replaying)
+}
+
+// Tampered returns the number of commands and responses modified so far,
+// replays included.
+func (t *Transport) Tampered() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tampered
+}
+
+// Send implements [transport.TPM].
+func (t *Transport) Send(cmd []byte) ([]byte, error) {
+	h, err := decode.ParseHeader(cmd)
+	if err != nil {
+		return t.tpm.Send(cmd)
+	}
+	cc := tpm2.TPMCC(h.Code)
+
+	t.mu.Lock()
+	tamperCmd, tamperRsp := t.commands[cc], t.responses[cc]
+	replay, replaying := t.replays[cc], t.replaying[cc]
+	if replay != nil {
+		t.tampered++
+	}
+	t.mu.Unlock()
+
+	if replay != nil {
+		return append([]byte(nil), replay...), nil
+	}
+	if tamperCmd != nil {
+		if cmd, err = tamperCmd(append([]byte(nil), cmd...)); err != nil {
+			return nil, fmt.Errorf("tampering with %s: %w", decode.CommandName(cc), err)
+		}
+		t.count()
+	}
+	rsp, err := t.tpm.Send(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if replaying {
+		t.mu.Lock()
+		t.replays[cc] = append([]byte(nil), rsp...)
+		t.mu.Unlock()
+	}
+	if tamperRsp != nil {
+		if rsp, err = tamperRsp(append([]byte(nil), rsp...)); err != nil {
+			return nil, fmt.Errorf("tampering with %s response: %w", decode.CommandName(cc), err)
+		}
+		t.count()
+	}
+	return rsp, nil
+}
+
+func (t *Transport) count() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tampered++
+}
+
+// Chain returns a Tamper applying each of tampers in order.
+func Chain(tampers ...Tamper) Tamper {
+	return func(msg []byte) ([]byte, error) {
+		var err error
+		for _, fn := range tampers {
+			if msg, err = fn(msg); err != nil {
+				return nil, err
+			}
+		}
+		return msg, nil
+	}
+}
+
+// FlipCommandParameter returns a Tamper inverting the bits of the i-th byte
+// of the command parameter area.
+func FlipCommandParameter(i int) Tamper {
+	return func(msg []byte) ([]byte, error) {
+		cmd, err := decode.ParseCommand(msg)
+		if err != nil {
+			return nil, err
+		}
+		if i >= len(cmd.Parameters) {
+			return nil, fmt.Errorf("parameter byte %d out of range (%d bytes)", i, len(cmd.Parameters))
+		}
+		// The parameters end the command.
+		msg[len(msg)-len(cmd.Parameters)+i] ^= 0xff
+		return msg, nil
+	}
+}
+
+// FlipResponseParameter returns a Tamper inverting the bits of the i-th byte
+// of the parameter area of the response to a command of code cc.
+func FlipResponseParameter(cc tpm2.TPMCC, i int) Tamper {
+	return func(msg []byte) ([]byte, error) {
+		rsp, err := decode.ParseResponse(cc, msg)
+		if err != nil {
+			return nil, err
+		}
+		if i >= len(rsp.Parameters) {
+			return nil, fmt.Errorf("parameter byte %d out of range (%d bytes)", i, len(rsp.Parameters))
+		}
+		// Header, handles, then the parameterSize field with sessions.
+		offset := 10 + 4*len(rsp.Handles)
+		if rsp.Tag == tpm2.TPMSTSessions {
+			offset += 4
+		}
+		msg[offset+i] ^= 0xff
+		return msg, nil
+	}
+}
+
+// SwapHandle returns a Tamper replacing the i-th handle of a command with h.
+func SwapHandle(i int, h tpm2.TPMHandle) Tamper {
+	return func(msg []byte) ([]byte, error) {
+		cmd, err := decode.ParseCommand(msg)
+		if err != nil {
+			return nil, err
+		}
+		if i >= len(cmd.Handles) {
+			return nil, fmt.Errorf("handle %d out of range (%d handles)", i, len(cmd.Handles))
+		}
+		offset := 10 + 4*i
+		msg[offset], msg[offset+1], msg[offset+2], msg[offset+3] = byte(h>>24), byte(h>>16), byte(h>>8), byte(h)
+		return msg, nil
+	}
+}
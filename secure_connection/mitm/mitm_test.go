@@ -0,0 +1,177 @@
+package mitm_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/mitm"
+	"github.com/stretchr/testify/require"
+)
+
+const nvPassword = "nvpassword"
+
+// sessions are the authorizations compared by each test: only the HMAC
+// session must detect the attack.
+var sessions = map[string]struct {
+	auth     func(t *testing.T, tpm transport.TPM) tpm2.Session
+	detected bool
+}{
+	"PasswordAuth": {
+		auth: func(*testing.T, transport.TPM) tpm2.Session {
+			return tpm2.PasswordAuth([]byte(nvPassword))
+		},
+	},
+	"HMAC": {
+		auth: func(t *testing.T, tpm transport.TPM) tpm2.Session {
+			// A persistent session, flushed even when the TPM never sees the
+			// command using it.
+			sess, closer, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16, tpm2.Auth([]byte(nvPassword)))
+			require.NoError(t, err)
+			t.Cleanup(func() { closer() })
+			return sess
+		},
+		detected: true,
+	},
+}
+
+func setup(t *testing.T, index uint32) (*mitm.Transport, *common.NVIndexInfo) {
+	t.Helper()
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	t.Cleanup(func() { tpm.Close() })
+
+	nvInfo, err := common.CreateNVIndex(tpm, index, 8, nvPassword)
+	require.NoError(t, err)
+	t.Cleanup(func() { common.DeleteNVIndex(tpm, nvInfo) })
+	return mitm.New(tpm), nvInfo
+}
+
+func write(tpm transport.TPM, nvInfo *common.NVIndexInfo, auth tpm2.Session, data []byte) error {
+	_, err := tpm2.NVWrite{
+		AuthHandle: nvInfo.AuthHandle(auth),
+		NVIndex:    nvInfo.NamedHandle(),
+		Data:       tpm2.TPM2BMaxNVBuffer{Buffer: data},
+	}.Execute(tpm)
+	if err == nil {
+		err = nvInfo.Refresh(tpm)
+	}
+	return err
+}
+
+func read(tpm transport.TPM, nvInfo *common.NVIndexInfo, auth tpm2.Session) ([]byte, error) {
+	rsp, err := tpm2.NVRead{
+		AuthHandle: nvInfo.AuthHandle(auth),
+		NVIndex:    nvInfo.NamedHandle(),
+		Size:       8,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Data.Buffer, nil
+}
+
+func TestTamperCommand(t *testing.T) {
+	for name, s := range sessions {
+		t.Run(name, func(t *testing.T) {
+			tpm, nvInfo := setup(t, 0x01000010)
+			auth := s.auth(t, tpm)
+			data := []byte("original")
+
+			// Flip the first data byte, after the TPM2B size.
+			tpm.TamperCommand(tpm2.TPMCCNVWrite, mitm.FlipCommandParameter(2))
+			err := write(tpm, nvInfo, auth, data)
+			require.Equal(t, 1, tpm.Tampered())
+			tpm.Reset()
+
+			if s.detected {
+				require.ErrorIs(t, err, tpm2.TPMRCAuthFail)
+				return
+			}
+			require.NoError(t, err)
+			got, err := read(tpm, nvInfo, auth)
+			require.NoError(t, err)
+			require.NotEqual(t, data, got)
+			require.Equal(t, data[1:], got[1:])
+		})
+	}
+}
+
+func TestTamperResponse(t *testing.T) {
+	for name, s := range sessions {
+		t.Run(name, func(t *testing.T) {
+			tpm, nvInfo := setup(t, 0x01000011)
+			auth := s.auth(t, tpm)
+			data := []byte("original")
+			require.NoError(t, write(tpm, nvInfo, auth, data))
+
+			tpm.TamperResponse(tpm2.TPMCCNVRead, mitm.FlipResponseParameter(tpm2.TPMCCNVRead, 2))
+			got, err := read(tpm, nvInfo, auth)
+			require.Equal(t, 1, tpm.Tampered())
+
+			if s.detected {
+				require.ErrorContains(t, err, "incorrect authorization HMAC")
+				return
+			}
+			require.NoError(t, err)
+			require.NotEqual(t, data, got)
+		})
+	}
+}
+
+func TestSwapHandle(t *testing.T) {
+	for name, s := range sessions {
+		t.Run(name, func(t *testing.T) {
+			tpm, nvInfo := setup(t, 0x01000012)
+			auth := s.auth(t, tpm)
+			other, err := common.CreateNVIndex(tpm, 0x01000013, 8, nvPassword)
+			require.NoError(t, err)
+			t.Cleanup(func() { common.DeleteNVIndex(tpm, other) })
+			require.NoError(t, write(tpm, nvInfo, auth, []byte("index A.")))
+			require.NoError(t, write(tpm, other, auth, []byte("index B.")))
+
+			// Redirect the read of A to B: authorization and index handles.
+			tpm.TamperCommand(tpm2.TPMCCNVRead, mitm.Chain(
+				mitm.SwapHandle(0, other.Handle),
+				mitm.SwapHandle(1, other.Handle),
+			))
+			got, err := read(tpm, nvInfo, auth)
+
+			if s.detected {
+				require.ErrorIs(t, err, tpm2.TPMRCAuthFail)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, []byte("index B."), got)
+		})
+	}
+}
+
+func TestReplayResponse(t *testing.T) {
+	for name, s := range sessions {
+		t.Run(name, func(t *testing.T) {
+			tpm, nvInfo := setup(t, 0x01000014)
+			auth := s.auth(t, tpm)
+			require.NoError(t, write(tpm, nvInfo, auth, []byte("stale...")))
+
+			tpm.ReplayResponse(tpm2.TPMCCNVRead)
+			got, err := read(tpm, nvInfo, auth)
+			require.NoError(t, err)
+			require.Equal(t, []byte("stale..."), got)
+			require.Equal(t, 0, tpm.Tampered())
+
+			// The value changes, but the attacker answers with the old one.
+			require.NoError(t, write(tpm, nvInfo, auth, []byte("fresh...")))
+			got, err = read(tpm, nvInfo, auth)
+			require.Equal(t, 1, tpm.Tampered())
+
+			if s.detected {
+				require.ErrorContains(t, err, "incorrect authorization HMAC")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, []byte("stale..."), got)
+		})
+	}
+}
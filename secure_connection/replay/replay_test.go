@@ -0,0 +1,161 @@
+// Package replay_test records authorized commands on the bus and sends them
+// again, as an attacker replaying a captured command would, and asserts the
+// anti-replay property of sessions: the TPM rolls its nonce at every use of a
+// session, so the HMAC of a captured command is stale once it was executed.
+//
+// A password session has no nonce: a captured command is accepted as many
+// times as it is replayed.
+package replay_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/decode"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	nvIndex    = 0x01500040
+	nvPassword = "nvpassword"
+)
+
+// setup opens a fresh simulator holding an NV index of 8 bytes protected by
+// nvPassword, and a recording transport in front of it.
+func setup(t *testing.T) (transport.TPM, *sniffer.Transport, *common.NVIndexInfo) {
+	t.Helper()
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	t.Cleanup(func() { tpm.Close() })
+
+	nvInfo, err := common.CreateNVIndex(tpm, nvIndex, 8, nvPassword)
+	require.NoError(t, err)
+	t.Cleanup(func() { common.DeleteNVIndex(tpm, nvInfo) })
+	return tpm, sniffer.New(tpm), nvInfo
+}
+
+func write(tpm transport.TPM, nvInfo *common.NVIndexInfo, auth tpm2.Session, data []byte) error {
+	_, err := tpm2.NVWrite{
+		AuthHandle: nvInfo.AuthHandle(auth),
+		NVIndex:    nvInfo.NamedHandle(),
+		Data:       tpm2.TPM2BMaxNVBuffer{Buffer: data},
+	}.Execute(tpm)
+	if err == nil {
+		err = nvInfo.Refresh(tpm)
+	}
+	return err
+}
+
+func read(t *testing.T, tpm transport.TPM, nvInfo *common.NVIndexInfo) []byte {
+	t.Helper()
+	rsp, err := tpm2.NVRead{
+		AuthHandle: nvInfo.AuthHandle(tpm2.PasswordAuth([]byte(nvPassword))),
+		NVIndex:    nvInfo.NamedHandle(),
+		Size:       8,
+	}.Execute(tpm)
+	require.NoError(t, err)
+	return rsp.Data.Buffer
+}
+
+// lastCommand returns the last recorded command of code cc.
+func lastCommand(t *testing.T, bus *sniffer.Transport, cc tpm2.TPMCC) []byte {
+	t.Helper()
+	commands := bus.Commands()
+	for i := len(commands) - 1; i >= 0; i-- {
+		cmd, err := decode.ParseCommand(commands[i])
+		require.NoError(t, err)
+		if cmd.CommandCode() == cc {
+			return commands[i]
+		}
+	}
+	t.Fatalf("no %s command recorded", decode.CommandName(cc))
+	return nil
+}
+
+// replay sends cmd to the TPM as is and returns the response code.
+func replay(t *testing.T, tpm transport.TPM, cmd []byte) tpm2.TPMRC {
+	t.Helper()
+	b, err := tpm.Send(cmd)
+	require.NoError(t, err)
+	rsp, err := decode.ParseResponse(tpm2.TPMCCNVWrite, b)
+	require.NoError(t, err)
+	return rsp.ResponseCode()
+}
+
+// TestReplay writes "first" then "second" to an NV index, then replays the
+// recorded write of "first": the index must still hold "second".
+func TestReplay(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		auth func(t *testing.T, tpm transport.TPM) tpm2.Session
+		// rc is the response code to the replayed command, zero if it is
+		// accepted.
+		rc tpm2.TPMRC
+	}{
+		{
+			name: "PasswordAuth",
+			auth: func(*testing.T, transport.TPM) tpm2.Session {
+				return tpm2.PasswordAuth([]byte(nvPassword))
+			},
+		},
+		{
+			// A persistent session: the replayed command uses a live session
+			// whose nonce has rolled since the command was captured.
+			name: "HMAC",
+			auth: func(t *testing.T, tpm transport.TPM) tpm2.Session {
+				sess, closer, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16, tpm2.Auth([]byte(nvPassword)))
+				require.NoError(t, err)
+				t.Cleanup(func() { closer() })
+				return sess
+			},
+			rc: tpm2.TPMRCAuthFail,
+		},
+		{
+			// A one-shot session, flushed by the TPM after the command: the
+			// replayed command references a session which isn't loaded.
+			name: "HMAC one-shot",
+			auth: func(*testing.T, transport.TPM) tpm2.Session {
+				return tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Auth([]byte(nvPassword)))
+			},
+			rc: tpm2.TPMRCReferenceS0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tpm, bus, nvInfo := setup(t)
+			auth := tc.auth(t, tpm)
+
+			require.NoError(t, write(bus, nvInfo, auth, []byte("first---")))
+			captured := lastCommand(t, bus, tpm2.TPMCCNVWrite)
+			require.NoError(t, write(tpm, nvInfo, auth, []byte("second--")))
+
+			rc := replay(t, tpm, captured)
+			if tc.rc == 0 {
+				require.Equal(t, tpm2.TPMRCSuccess, rc)
+				require.Equal(t, []byte("first---"), read(t, tpm, nvInfo))
+				return
+			}
+			require.ErrorIs(t, rc, tc.rc)
+			require.Equal(t, []byte("second--"), read(t, tpm, nvInfo))
+		})
+	}
+}
+
+// TestReplay_Immediate replays a command right after its execution, before
+// the session is used again: the nonce already rolled.
+func TestReplay_Immediate(t *testing.T) {
+	tpm, bus, nvInfo := setup(t)
+	sess, closer, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16, tpm2.Auth([]byte(nvPassword)))
+	require.NoError(t, err)
+	defer closer()
+
+	require.NoError(t, write(bus, nvInfo, sess, []byte("first---")))
+	rc := replay(t, tpm, lastCommand(t, bus, tpm2.TPMCCNVWrite))
+	require.ErrorIs(t, rc, tpm2.TPMRCAuthFail)
+
+	// The session is still usable by its owner, whose nonces are in sync.
+	require.NoError(t, write(tpm, nvInfo, sess, []byte("second--")))
+	require.Equal(t, []byte("second--"), read(t, tpm, nvInfo))
+}
@@ -0,0 +1,80 @@
+package salted
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/provision"
+)
+
+// CachedEK is a persistent EK whose public area is kept in memory, so that
+// salted sessions are created without reading nor creating the EK: salting
+// only costs the encryption of the salt to the EK.
+type CachedEK struct {
+	tpm    transport.TPM
+	handle tpm2.TPMHandle
+	public tpm2.TPMTPublic
+}
+
+// WithCachedEK returns the RSA-2048 EK persisted at provision.EKHandle,
+// creating and persisting it on first use (see provision.EnsureEK), with its
+// public area cached. Call it once, e.g. at startup, and create the sessions
+// of hot code paths from the returned CachedEK.
+//
+// The cache isn't refreshed: after the EK is evicted or the endorsement
+// hierarchy changes (TPM2_ChangeEPS), sessions fail and WithCachedEK must be
+// called again.
+//
+// Example:
+//
+//	ek, err := salted.WithCachedEK(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	// In the hot path.
+//	rsp, err := tpm2.Unseal{ItemHandle: item}.Execute(tpm, ek.Salted())
+func WithCachedEK(tpm transport.TPM, optionalCfg ...provision.Config) (*CachedEK, error) {
+	ek, err := provision.EnsureEK(tpm, optionalCfg...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision EK: %w", err)
+	}
+	if !ek.HasPublic() {
+		return nil, fmt.Errorf("EK 0x%x has no public area", ek.Handle())
+	}
+	return &CachedEK{tpm: tpm, handle: ek.Handle(), public: *ek.Public()}, nil
+}
+
+// Handle returns the persistent handle of the EK.
+func (c *CachedEK) Handle() tpm2.TPMHandle {
+	return c.handle
+}
+
+// Public returns the cached public area of the EK.
+func (c *CachedEK) Public() tpm2.TPMTPublic {
+	return c.public
+}
+
+// Salted creates an inline session salted with the EK, like [Salted].
+func (c *CachedEK) Salted() tpm2.Session {
+	return Salted(c.handle, c.public)
+}
+
+// SaltedAuthIn creates an inline session salted with the EK, authorizing
+// with authValue and encrypting the command, like [SaltedAuthIn].
+func (c *CachedEK) SaltedAuthIn(authValue []byte) tpm2.Session {
+	return SaltedAuthIn(c.handle, c.public, authValue)
+}
+
+// SaltedAuthOut creates an inline session salted with the EK, authorizing
+// with authValue and encrypting the response, like [SaltedAuthOut].
+func (c *CachedEK) SaltedAuthOut(authValue []byte) tpm2.Session {
+	return SaltedAuthOut(c.handle, c.public, authValue)
+}
+
+// SaltedSession creates a persistent session salted with the EK, like
+// [SaltedSession]. The caller must call the returned closer function to
+// release the TPM session slot.
+func (c *CachedEK) SaltedSession() (tpm2.Session, func() error, error) {
+	return SaltedSession(c.tpm, c.handle, c.public)
+}
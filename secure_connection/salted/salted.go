@@ -1,8 +1,14 @@
 package salted
 
 import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
 	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+	"github.com/loicsikidi/tpm-stuff/objects"
 )
 
 // Salted creates an inline salted HMAC session for parameter encryption only.
@@ -28,6 +34,9 @@ import (
 // This provides the strongest protection but has higher performance overhead due to
 // asymmetric cryptography (~67% slower than unbound/bound sessions).
 // Ideal for initial device provisioning or when no pre-shared secrets exist.
+// In hot code paths, [WithCachedEK] saves the creation of the EK. For a loaded
+// key whose public area isn't already known, [SaltedLoaded] reads it with its
+// Name checked, rather than trusting TPM2_ReadPublic.
 //
 // Example usage:
 //
@@ -39,6 +48,8 @@ import (
 //	ekPub, _ := ekRsp.OutPublic.Contents()
 //
 //	// Create salted encryption session
+//	// (salting needs no EK authorization; commands using the EK,
+//	// e.g. as a parent, are authorized with policy.Endorsement())
 //	encryptSess := salted.Salted(ekRsp.ObjectHandle, *ekPub)
 //
 //	// Create HMAC auth session
@@ -69,6 +80,104 @@ func Salted(
 	)
 }
 
+// SaltedAuthIn creates an inline salted HMAC session, like [Salted], which
+// also authorizes with authValue: a single session both proves the
+// authorization value of an entity and encrypts the parameters, for helpers
+// taking one session per command such as the nv package.
+//
+// Only the first command parameter is encrypted: commands without response
+// parameters, such as TPM2_NV_DefineSpace and TPM2_NV_Write, are rejected
+// with TPM_RC_ATTRIBUTES by a session which also encrypts the response. For
+// commands whose first command parameter isn't a sized buffer, such as
+// TPM2_NV_Read, use [SaltedAuthOut].
+//
+// Example:
+//
+//	err := nv.Write(tpm, idx, data, salted.SaltedAuthIn(ekHandle, ekPublic, indexAuth))
+func SaltedAuthIn(
+	saltKeyHandle tpm2.TPMHandle,
+	saltKeyPublic tpm2.TPMTPublic,
+	authValue []byte,
+) tpm2.Session {
+	return saltedAuth(saltKeyHandle, saltKeyPublic, authValue, tpm2.AESEncryption(128, tpm2.EncryptIn))
+}
+
+// SaltedAuthOut is [SaltedAuthIn], encrypting the first response parameter
+// only, e.g. the data returned by TPM2_NV_Read.
+//
+// Example:
+//
+//	data, err := nv.Read(tpm, idx, salted.SaltedAuthOut(ekHandle, ekPublic, indexAuth))
+func SaltedAuthOut(
+	saltKeyHandle tpm2.TPMHandle,
+	saltKeyPublic tpm2.TPMTPublic,
+	authValue []byte,
+) tpm2.Session {
+	return saltedAuth(saltKeyHandle, saltKeyPublic, authValue, tpm2.AESEncryption(128, tpm2.EncryptOut))
+}
+
+func saltedAuth(saltKeyHandle tpm2.TPMHandle, saltKeyPublic tpm2.TPMTPublic, authValue []byte, encryption tpm2.AuthOption) tpm2.Session {
+	return tpm2.HMAC(
+		tpm2.TPMAlgSHA256,
+		16, // nonceCaller size
+		tpm2.Auth(authValue),
+		tpm2.Salted(saltKeyHandle, saltKeyPublic),
+		encryption,
+	)
+}
+
+// SaltedLoaded creates an inline salted HMAC session, like [Salted], with the
+// key loaded at saltKeyHandle, e.g. a persistent SRK: its public area is read
+// with objects.ReadPublicVerified.
+//
+// The check only binds the public area to the Name reported along: to make
+// sure the key is the EK of the TPM, use [SaltedVerified].
+//
+// Example:
+//
+//	encryptSess, err := salted.SaltedLoaded(tpm, provision.SRKHandle)
+//	if err != nil {
+//	    return err
+//	}
+func SaltedLoaded(tpm transport.TPM, saltKeyHandle tpm2.TPMHandle) (tpm2.Session, error) {
+	pub, err := objects.ReadPublicVerified(tpm, saltKeyHandle)
+	if err != nil {
+		return nil, err
+	}
+	return Salted(saltKeyHandle, pub.Public), nil
+}
+
+// SaltedVerified is [Salted], after checking that cert certifies the salt key
+// pub: an active attacker on the bus, answering TPM2_ReadPublic with their
+// own key, would otherwise decrypt the salt and the session parameters. It
+// returns ekcert.ErrKeyMismatch when pub isn't the key of cert.
+//
+// cert must be verified first, e.g. with ekcert.VerifyChain.
+//
+// Example:
+//
+//	cert, err := ekcert.Verify(tpm, tpm2.TPMAlgRSA, roots)
+//	if err != nil {
+//	    return err
+//	}
+//	encryptSess, err := salted.SaltedVerified(cert, ekHandle, ekPublic)
+//	if err != nil {
+//	    return err // not the EK of the certificate
+//	}
+func SaltedVerified(
+	cert *x509.Certificate,
+	saltKeyHandle tpm2.TPMHandle,
+	saltKeyPublic tpm2.TPMTPublic,
+) (tpm2.Session, error) {
+	if cert == nil {
+		return nil, errors.New("missing EK certificate")
+	}
+	if err := ekcert.VerifyPublic(cert, saltKeyPublic); err != nil {
+		return nil, fmt.Errorf("untrusted salt key: %w", err)
+	}
+	return Salted(saltKeyHandle, saltKeyPublic), nil
+}
+
 // SaltedSession creates a persistent salted HMAC session for parameter encryption only.
 // This variant provides explicit lifecycle control and better performance
 // for multiple successive operations (amortizes StartAuthSession + RSA cost).
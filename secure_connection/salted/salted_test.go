@@ -1,11 +1,26 @@
 package salted_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/tpm-stuff/decode"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+	"github.com/loicsikidi/tpm-stuff/handles"
+	"github.com/loicsikidi/tpm-stuff/persist"
+	"github.com/loicsikidi/tpm-stuff/provision"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/salted"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/loicsikidi/tpm-stuff/templates"
 	"github.com/stretchr/testify/require"
 )
 
@@ -13,42 +28,23 @@ func TestSalted_KeyCreation(t *testing.T) {
 	tpm, err := common.OpenSimulator()
 	require.NoError(t, err)
 	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
 
-	// First, create an RSA key to use for salting (simulating an EK)
-	// In production, you'd typically use the actual EK
+	// First, create the EK to use for salting.
+	// The salt is encrypted to the EK public key: no EK authorization is
+	// needed, unlike commands using the EK (see policy.Endorsement).
 	createSaltKey := tpm2.CreatePrimary{
 		PrimaryHandle: tpm2.AuthHandle{
-			Handle: tpm2.TPMRHOwner,
+			Handle: tpm2.TPMRHEndorsement,
 			Auth:   tpm2.PasswordAuth([]byte("")),
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgRSA,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				Decrypt:             true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgRSA,
-				&tpm2.TPMSRSAParms{
-					KeyBits: 2048,
-					Scheme: tpm2.TPMTRSAScheme{
-						Scheme: tpm2.TPMAlgNull,
-					},
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(tpm2.RSAEKTemplate),
 	}
 
 	saltKeyRsp, err := createSaltKey.Execute(tpm)
 	require.NoError(t, err)
-	defer func() {
-		flush := tpm2.FlushContext{FlushHandle: saltKeyRsp.ObjectHandle}
-		flush.Execute(tpm)
-	}()
+	tracker.Track(saltKeyRsp.ObjectHandle)
 
 	// Extract the public key for the salted session
 	saltKeyPub, err := saltKeyRsp.OutPublic.Contents()
@@ -64,7 +60,7 @@ func TestSalted_KeyCreation(t *testing.T) {
 
 	// Create a new key with the salted session
 	// The password will be encrypted using a session secret derived from
-	// a salt value that was encrypted with the RSA key
+	// a salt value that was encrypted with the EK
 	createPrimary := tpm2.CreatePrimary{
 		PrimaryHandle: tpm2.AuthHandle{
 			Handle: tpm2.TPMRHOwner,
@@ -77,80 +73,43 @@ func TestSalted_KeyCreation(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				SignEncrypt:         true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCSigner()),
 	}
 
-	rsp, err := createPrimary.Execute(tpm, sess)
+	wire := sniffer.New(tpm)
+	rsp, err := createPrimary.Execute(wire, sess)
 	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
 	require.NotNil(t, rsp)
 	require.NotNil(t, rsp.OutPublic)
 
 	// The password was encrypted during transmission via the salted session
-	// The session secret is derived from a salt encrypted with the RSA key
+	// The session secret is derived from a salt encrypted with the EK
 	// This provides the strongest protection without requiring pre-shared secrets
-
-	// Clean up
-	flush := tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}
-	_, err = flush.Execute(tpm)
-	require.NoError(t, err)
+	require.False(t, wire.ContainsPlaintext(targetPassword))
 }
 
 func TestSaltedSession_PersistentSession(t *testing.T) {
 	tpm, err := common.OpenSimulator()
 	require.NoError(t, err)
 	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
 
-	// First, create an RSA key to use for salting (simulating an EK)
-	// In production, you'd typically use the actual EK
+	// First, create the EK to use for salting.
+	// The salt is encrypted to the EK public key: no EK authorization is
+	// needed, unlike commands using the EK (see policy.Endorsement).
 	createSaltKey := tpm2.CreatePrimary{
 		PrimaryHandle: tpm2.AuthHandle{
-			Handle: tpm2.TPMRHOwner,
+			Handle: tpm2.TPMRHEndorsement,
 			Auth:   tpm2.PasswordAuth([]byte("")),
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgRSA,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				Decrypt:             true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgRSA,
-				&tpm2.TPMSRSAParms{
-					KeyBits: 2048,
-					Scheme: tpm2.TPMTRSAScheme{
-						Scheme: tpm2.TPMAlgNull,
-					},
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(tpm2.RSAEKTemplate),
 	}
 
 	saltKeyRsp, err := createSaltKey.Execute(tpm)
 	require.NoError(t, err)
-	defer func() {
-		flush := tpm2.FlushContext{FlushHandle: saltKeyRsp.ObjectHandle}
-		flush.Execute(tpm)
-	}()
+	tracker.Track(saltKeyRsp.ObjectHandle)
 
 	// Extract the public key for the salted session
 	saltKeyPub, err := saltKeyRsp.OutPublic.Contents()
@@ -159,7 +118,7 @@ func TestSaltedSession_PersistentSession(t *testing.T) {
 	// Create persistent salted session (for demonstration/performance)
 	encryptSess, closer, err := salted.SaltedSession(tpm, saltKeyRsp.ObjectHandle, *saltKeyPub)
 	require.NoError(t, err)
-	defer closer() // Must call to release TPM slot
+	tracker.TrackSession(encryptSess, closer)
 
 	targetPassword := []byte("targetpassword")
 
@@ -176,27 +135,12 @@ func TestSaltedSession_PersistentSession(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				SignEncrypt:         true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCSigner()),
 	}
 
 	rsp, err := createPrimary.Execute(tpm, encryptSess)
 	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
 	require.NotNil(t, rsp)
 
 	// Reuse same session for second operation (demonstrates session reuse)
@@ -212,35 +156,176 @@ func TestSaltedSession_PersistentSession(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				SignEncrypt:         true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCSigner()),
 	}
 
 	rsp2, err := createPrimary2.Execute(tpm, encryptSess)
 	require.NoError(t, err)
+	tracker.Track(rsp2.ObjectHandle)
 	require.NotNil(t, rsp2)
+}
+
+func TestWithCachedEK(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+
+	ek, err := salted.WithCachedEK(tpm)
+	require.NoError(t, err)
+	defer persist.Evict(tpm, ek.Handle()) //nolint:errcheck
+	require.Equal(t, provision.EKHandle, ek.Handle())
+
+	// The EK is persisted: it isn't created again.
+	wire := sniffer.New(tpm)
+	again, err := salted.WithCachedEK(wire)
+	require.NoError(t, err)
+	require.Equal(t, ek.Public(), again.Public())
+	require.NotContains(t, commandCodes(t, wire), tpm2.TPMCCCreatePrimary)
+
+	// Sessions don't read the EK.
+	wire.Reset()
+	password := []byte("targetpassword")
+	createPrimary := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: password},
+			},
+		},
+		InPublic: tpm2.New2B(templates.ECCSigner()),
+	}
+	rsp, err := createPrimary.Execute(wire, ek.Salted())
+	require.NoError(t, err)
+	_, err = tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm)
+	require.NoError(t, err)
+
+	sess, closer, err := ek.SaltedSession()
+	require.NoError(t, err)
+	defer closer()
+	rsp, err = createPrimary.Execute(wire, sess)
+	require.NoError(t, err)
+	_, err = tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm)
+	require.NoError(t, err)
+
+	require.False(t, wire.ContainsPlaintext(password))
+	require.NotContains(t, commandCodes(t, wire), tpm2.TPMCCReadPublic)
+}
 
-	// Clean up both keys
-	flush := tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}
-	_, err = flush.Execute(tpm)
+// commandCodes returns the codes of the commands recorded by wire.
+func commandCodes(t *testing.T, wire *sniffer.Transport) []tpm2.TPMCC {
+	t.Helper()
+	var codes []tpm2.TPMCC
+	for _, b := range wire.Commands() {
+		cmd, err := decode.ParseCommand(b)
+		require.NoError(t, err)
+		codes = append(codes, cmd.CommandCode())
+	}
+	return codes
+}
+
+func TestSaltedLoaded(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
+
+	srk, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(tpm)
+	require.NoError(t, err)
+	tracker.Track(srk.ObjectHandle)
+
+	sess, err := salted.SaltedLoaded(tpm, srk.ObjectHandle)
+	require.NoError(t, err)
+	password := []byte("targetpassword")
+	wire := sniffer.New(tpm)
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: password},
+			},
+		},
+		InPublic: tpm2.New2B(templates.ECCSigner()),
+	}.Execute(wire, sess)
+	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
+	require.False(t, wire.ContainsPlaintext(password))
+}
+
+func TestSaltedVerified(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
+
+	ek, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHEndorsement,
+		InPublic:      tpm2.New2B(tpm2.RSAEKTemplate),
+	}.Execute(tpm)
+	require.NoError(t, err)
+	tracker.Track(ek.ObjectHandle)
+	ekPub, err := ek.OutPublic.Contents()
+	require.NoError(t, err)
+	cert := issueCert(t, ekPub)
+
+	// An attacker's decryption key, presented as the EK.
+	fake, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(templates.RSADecrypter()),
+	}.Execute(tpm)
 	require.NoError(t, err)
+	tracker.Track(fake.ObjectHandle)
+	fakePub, err := fake.OutPublic.Contents()
+	require.NoError(t, err)
+
+	_, err = salted.SaltedVerified(cert, fake.ObjectHandle, *fakePub)
+	require.ErrorIs(t, err, ekcert.ErrKeyMismatch)
+	_, err = salted.SaltedVerified(cert, ek.ObjectHandle, *fakePub)
+	require.ErrorIs(t, err, ekcert.ErrKeyMismatch)
+	_, err = salted.SaltedVerified(issueCert(t, fakePub), ek.ObjectHandle, *ekPub)
+	require.ErrorIs(t, err, ekcert.ErrKeyMismatch)
+	_, err = salted.SaltedVerified(nil, ek.ObjectHandle, *ekPub)
+	require.Error(t, err)
 
-	flush2 := tpm2.FlushContext{FlushHandle: rsp2.ObjectHandle}
-	_, err = flush2.Execute(tpm)
+	sess, err := salted.SaltedVerified(cert, ek.ObjectHandle, *ekPub)
+	require.NoError(t, err)
+	password := []byte("targetpassword")
+	wire := sniffer.New(tpm)
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: password},
+			},
+		},
+		InPublic: tpm2.New2B(templates.ECCSigner()),
+	}.Execute(wire, sess)
+	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
+	require.False(t, wire.ContainsPlaintext(password))
+}
+
+// issueCert returns a certificate of the key whose public area is pub,
+// issued by a throwaway CA.
+func issueCert(t *testing.T, pub *tpm2.TPMTPublic) *x509.Certificate {
+	t.Helper()
+	key, err := tpmcrypto.PublicKey(pub)
+	require.NoError(t, err)
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test EK"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key, caKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
 	require.NoError(t, err)
+	return cert
 }
@@ -0,0 +1,59 @@
+package sessions
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"encoding/binary"
+)
+
+// KDFa is the key derivation function of the TPM (Part 1, 11.4.10.2): the
+// SP800-108 KDF in counter mode with HMAC, returning bits bits of key.
+//
+// Each block is HMAC(key, counter || label || 0x00 || contextU || contextV ||
+// bits), with a 32-bit counter starting at 1. When bits isn't a multiple of
+// 8, the extra high-order bits of the first byte are cleared.
+//
+// Sessions use it with the label "ATH" to derive their session key (see
+// [SessionKey]) and "CFB" to derive the AES key and IV of parameter
+// encryption from the session key and the nonces.
+func KDFa(h crypto.Hash, key []byte, label string, contextU, contextV []byte, bits int) []byte {
+	n := (bits + 7) / 8
+	mac := hmac.New(h.New, key)
+	var out []byte
+	for counter := uint32(1); len(out) < n; counter++ {
+		mac.Reset()
+		binary.Write(mac, binary.BigEndian, counter) //nolint:errcheck
+		mac.Write([]byte(label))
+		mac.Write([]byte{0})
+		mac.Write(contextU)
+		mac.Write(contextV)
+		binary.Write(mac, binary.BigEndian, uint32(bits)) //nolint:errcheck
+		out = mac.Sum(out)
+	}
+	out = out[:n]
+	if bits%8 != 0 {
+		out[0] &= 1<<(bits%8) - 1
+	}
+	return out
+}
+
+// SessionKey returns the session key derived by the TPM when an HMAC or
+// policy session starts (Part 1, 19.6.8):
+//
+//	sessionKey = KDFa(authHash, bindAuth || salt, "ATH", nonceTPM, nonceCaller, digestSize)
+//
+// bindAuth is the auth value of the bind entity of a bound session, stripped
+// of its trailing zeros like every auth value used as an HMAC key, and salt
+// the secret sent encrypted to the salt key of a salted session. Both are
+// empty for an unbound and unsalted session, which then has no session key:
+// its HMACs are only keyed with the auth value of the authorized entity, and
+// its parameter encryption key derives from that value and the nonces, all
+// known to an observer of the bus when the auth value is empty.
+func SessionKey(h crypto.Hash, bindAuth, salt, nonceTPM, nonceCaller []byte) []byte {
+	secret := append(bytes.Clone(bytes.TrimRight(bindAuth, "\x00")), salt...)
+	if len(secret) == 0 {
+		return nil
+	}
+	return KDFa(h, secret, "ATH", nonceTPM, nonceCaller, h.Size()*8)
+}
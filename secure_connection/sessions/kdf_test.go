@@ -0,0 +1,219 @@
+package sessions_test
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sessions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKDFa(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	u, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+	v, _ := hex.DecodeString("ffeeddccbbaa99887766554433221100")
+
+	// Vectors computed with an independent implementation of SP800-108.
+	for _, tt := range []struct {
+		name     string
+		hash     crypto.Hash
+		label    string
+		u, v     []byte
+		bits     int
+		expected string
+	}{
+		{"session key", crypto.SHA256, "ATH", u, v, 256, "54d2a661a907242e4ad450045fac9991a9479f62798a183221aa51e83dc60303"},
+		{"AES-128 key and IV", crypto.SHA256, "CFB", u, v, 256, "f94a6be9aca896b5081760b559939afd289d4943200d4f72a2a5f2f9a24f06e6"},
+		{"SHA-384", crypto.SHA384, "ATH", u, v, 384, "11e8fb7ba41f317f5e4ce13e0c49a6c04af0db54e5549ab5778d88643102516db3d2d7a00479d755015c55dc0fcfe4a5"},
+		{"partial byte", crypto.SHA256, "KDF", u, v, 12, "08ff"},
+		{"several blocks", crypto.SHA256, "STORAGE", nil, nil, 520, "a2062573cfab68f26c5588d40f1e661b81b8ac213af874be688a05ac1ba25102236f4d4d8eee787bd55b25a5afbbf0af269318215e7e6326d306affc5f3098e0e8"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sessions.KDFa(tt.hash, key, tt.label, tt.u, tt.v, tt.bits)
+			require.Equal(t, tt.expected, hex.EncodeToString(got))
+			require.Equal(t, tpm2.KDFa(tt.hash, key, tt.label, tt.u, tt.v, tt.bits), got, "go-tpm agrees")
+		})
+	}
+}
+
+func TestSessionKey(t *testing.T) {
+	nonceTPM, nonceCaller := []byte("nonce-tpm"), []byte("nonce-caller")
+
+	require.Nil(t, sessions.SessionKey(crypto.SHA256, nil, nil, nonceTPM, nonceCaller), "unbound and unsalted")
+	require.Nil(t, sessions.SessionKey(crypto.SHA256, []byte{0, 0}, nil, nonceTPM, nonceCaller), "zeros are stripped")
+	require.Equal(t,
+		sessions.SessionKey(crypto.SHA256, []byte("auth"), nil, nonceTPM, nonceCaller),
+		sessions.SessionKey(crypto.SHA256, []byte("auth\x00\x00"), nil, nonceTPM, nonceCaller))
+	require.Equal(t,
+		sessions.KDFa(crypto.SHA256, []byte("authsalt"), "ATH", nonceTPM, nonceCaller, 256),
+		sessions.SessionKey(crypto.SHA256, []byte("auth"), []byte("salt"), nonceTPM, nonceCaller))
+}
+
+// modelSession is an encryption session whose HMACs and response decryption
+// only rely on a session key computed with [sessions.SessionKey]: the TPM
+// accepts its commands and its responses verify only when the model derives
+// the same key as the TPM.
+type modelSession struct {
+	handle      tpm2.TPMHandle
+	sessionKey  []byte
+	nonceCaller []byte
+	nonceTPM    []byte
+}
+
+var modelAttrs = tpm2.TPMASession{ContinueSession: true, Encrypt: true}
+
+func (s *modelSession) Init(transport.TPM) error           { return nil }
+func (s *modelSession) CleanupFailure(transport.TPM) error { return nil }
+func (s *modelSession) NonceTPM() tpm2.TPM2BNonce          { return tpm2.TPM2BNonce{Buffer: s.nonceTPM} }
+func (s *modelSession) IsEncryption() bool                 { return true }
+func (s *modelSession) IsDecryption() bool                 { return false }
+func (s *modelSession) Encrypt([]byte) error               { return nil }
+func (s *modelSession) Handle() tpm2.TPMHandle             { return s.handle }
+
+func (s *modelSession) NewNonceCaller() error {
+	_, err := rand.Read(s.nonceCaller)
+	return err
+}
+
+// hmac computes a command or response HMAC: the session doesn't authorize
+// any entity, so it is only keyed with the session key.
+func (s *modelSession) hmac(pHash, nonceNewer, nonceOlder []byte) []byte {
+	mac := hmac.New(crypto.SHA256.New, s.sessionKey)
+	mac.Write(pHash)
+	mac.Write(nonceNewer)
+	mac.Write(nonceOlder)
+	mac.Write([]byte{1<<0 | 1<<6}) // continueSession, encrypt
+	return mac.Sum(nil)
+}
+
+func (s *modelSession) Authorize(cc tpm2.TPMCC, parms, _ []byte, names []tpm2.TPM2BName, _ int) (*tpm2.TPMSAuthCommand, error) {
+	h := crypto.SHA256.New()
+	binary.Write(h, binary.BigEndian, cc) //nolint:errcheck
+	for _, name := range names {
+		h.Write(name.Buffer)
+	}
+	h.Write(parms)
+	return &tpm2.TPMSAuthCommand{
+		Handle:        s.handle,
+		Nonce:         tpm2.TPM2BNonce{Buffer: s.nonceCaller},
+		Attributes:    modelAttrs,
+		Authorization: tpm2.TPM2BData{Buffer: s.hmac(h.Sum(nil), s.nonceCaller, s.nonceTPM)},
+	}, nil
+}
+
+func (s *modelSession) Validate(rc tpm2.TPMRC, cc tpm2.TPMCC, parms []byte, _ []tpm2.TPM2BName, _ int, auth *tpm2.TPMSAuthResponse) error {
+	s.nonceTPM = auth.Nonce.Buffer
+	h := crypto.SHA256.New()
+	binary.Write(h, binary.BigEndian, rc) //nolint:errcheck
+	binary.Write(h, binary.BigEndian, cc) //nolint:errcheck
+	h.Write(parms)
+	if !hmac.Equal(s.hmac(h.Sum(nil), s.nonceTPM, s.nonceCaller), auth.Authorization.Buffer) {
+		return errors.New("incorrect response HMAC")
+	}
+	return nil
+}
+
+// Decrypt decrypts the first response parameter with AES-128-CFB, keyed
+// with KDFa(sessionKey, "CFB", nonceTPM, nonceCaller).
+func (s *modelSession) Decrypt(parameter []byte) error {
+	keyIV := sessions.KDFa(crypto.SHA256, s.sessionKey, "CFB", s.nonceTPM, s.nonceCaller, (16+aes.BlockSize)*8)
+	block, err := aes.NewCipher(keyIV[:16])
+	if err != nil {
+		return err
+	}
+	cipher.NewCFBDecrypter(block, keyIV[16:]).XORKeyStream(parameter, parameter) //nolint:staticcheck
+	return nil
+}
+
+func TestSessionKey_TPM(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+
+	// The TPM strips the trailing zeros of auth values.
+	bindAuth := []byte("bind-password\x00\x00")
+	key, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpm2.ECCSRKTemplate,
+		UserAuth: []byte("bind-password"),
+	})
+	require.NoError(t, err)
+	defer key.Close()
+	encapKey, err := tpm2.ImportEncapsulationKey(key.Public())
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name          string
+		bound, salted bool
+	}{
+		{"bound", true, false},
+		{"salted", false, true},
+		{"bound and salted", true, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			nonceCaller := make([]byte, 16)
+			_, err := rand.Read(nonceCaller)
+			require.NoError(t, err)
+			cmd := tpm2.StartAuthSession{
+				TPMKey:      tpm2.TPMRHNull,
+				Bind:        tpm2.TPMRHNull,
+				NonceCaller: tpm2.TPM2BNonce{Buffer: nonceCaller},
+				SessionType: tpm2.TPMSEHMAC,
+				Symmetric: tpm2.TPMTSymDef{
+					Algorithm: tpm2.TPMAlgAES,
+					KeyBits:   tpm2.NewTPMUSymKeyBits(tpm2.TPMAlgAES, tpm2.TPMKeyBits(128)),
+					Mode:      tpm2.NewTPMUSymMode(tpm2.TPMAlgAES, tpm2.TPMAlgCFB),
+				},
+				AuthHash: tpm2.TPMAlgSHA256,
+			}
+			var modelBindAuth, salt []byte
+			if tt.bound {
+				cmd.Bind = key.Handle()
+				modelBindAuth = bindAuth
+			}
+			if tt.salted {
+				var encSalt []byte
+				salt, encSalt, err = tpm2.CreateEncryptedSalt(rand.Reader, encapKey)
+				require.NoError(t, err)
+				cmd.TPMKey = key.Handle()
+				cmd.EncryptedSalt = tpm2.TPM2BEncryptedSecret{Buffer: encSalt}
+			}
+			rsp, err := cmd.Execute(tpm)
+			require.NoError(t, err)
+			handle := tpm2.TPMHandle(rsp.SessionHandle.HandleValue())
+			defer tpm2.FlushContext{FlushHandle: handle}.Execute(tpm) //nolint:errcheck
+
+			sess := &modelSession{
+				handle:      handle,
+				sessionKey:  sessions.SessionKey(crypto.SHA256, modelBindAuth, salt, rsp.NonceTPM.Buffer, nonceCaller),
+				nonceCaller: nonceCaller,
+				nonceTPM:    rsp.NonceTPM.Buffer,
+			}
+			// ReadPublic returns a known parameter, encrypted by the TPM.
+			pub, err := tpm2.ReadPublic{ObjectHandle: tpm2.NamedHandle{Handle: key.Handle(), Name: key.Name()}}.Execute(tpm, sess)
+			require.NoError(t, err)
+			got, err := pub.OutPublic.Contents()
+			require.NoError(t, err)
+			require.Equal(t, tpm2.Marshal(key.Public()), tpm2.Marshal(got))
+
+			// A model ignoring one of the inputs derives another key.
+			wrong := *sess
+			wrong.sessionKey = sessions.SessionKey(crypto.SHA256, nil, []byte("other salt"), sess.nonceTPM, nonceCaller)
+			_, err = tpm2.ReadPublic{ObjectHandle: tpm2.NamedHandle{Handle: key.Handle(), Name: key.Name()}}.Execute(tpm, &wrong)
+			require.Error(t, err)
+		})
+	}
+}
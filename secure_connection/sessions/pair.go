@@ -0,0 +1,88 @@
+package sessions
+
+import (
+	"reflect"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+)
+
+// Paired is an HMAC authorization session paired with an encryption session,
+// created by [AuthAndEncrypt]. It authorizes like the HMAC session when set
+// as tpm2.AuthHandle.Auth, and [Execute] appends its encryption session to
+// the command.
+type Paired struct {
+	tpm2.Session
+	encrypt tpm2.Session
+}
+
+// AuthAndEncrypt returns an unbound HMAC session authorizing with authValue,
+// paired with encSess (e.g. a salted session) which encrypts the parameters:
+// the two-session pattern of the complex demo without the wiring at each call
+// site. It uses the [Default] session hash, see [Factory.AuthAndEncrypt] for
+// the negotiated one.
+//
+// The encryption session is only sent when the command is run by [Execute]:
+// with the command's own Execute method, the parameters travel in clear.
+//
+// Example:
+//
+//	encSess := salted.Salted(srk.Handle(), *srk.Public())
+//	rsp, err := sessions.Execute(tpm, tpm2.Create{
+//	    ParentHandle: tpm2.AuthHandle{
+//	        Handle: srk.Handle(),
+//	        Name:   srk.Name(),
+//	        Auth:   sessions.AuthAndEncrypt(srkAuth, encSess),
+//	    },
+//	    // ...
+//	})
+func AuthAndEncrypt(authValue []byte, encSess tpm2.Session) *Paired {
+	return Default.AuthAndEncrypt(authValue, encSess)
+}
+
+// AuthAndEncrypt is like [AuthAndEncrypt] with the session hash of f.
+func (f Factory) AuthAndEncrypt(authValue []byte, encSess tpm2.Session) *Paired {
+	return &Paired{
+		Session: tpm2.HMAC(f.Hash, f.NonceSize(), tpm2.Auth(authValue)),
+		encrypt: encSess,
+	}
+}
+
+// Execute executes cmd with the extra sessions, preceded by the encryption
+// sessions of the [Paired] sessions authorizing its handles. TPM errors are
+// wrapped by [tpmerrors.Wrap].
+func Execute[R any, C tpm2.Command[R, *R]](tpm transport.TPM, cmd C, extra ...tpm2.Session) (*R, error) {
+	var sessions []tpm2.Session
+	v := reflect.ValueOf(cmd)
+	for i := 0; v.Kind() == reflect.Struct && i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Interface {
+			field = field.Elem()
+		}
+		if !field.IsValid() || !field.CanInterface() {
+			continue
+		}
+		ah, ok := field.Interface().(tpm2.AuthHandle)
+		if !ok {
+			continue
+		}
+		if p, ok := ah.Auth.(*Paired); ok && p.encrypt != nil && !containsSession(sessions, p.encrypt) {
+			sessions = append(sessions, p.encrypt)
+		}
+	}
+	rsp, err := cmd.Execute(tpm, append(sessions, extra...)...)
+	return rsp, tpmerrors.Wrap(err)
+}
+
+func containsSession(sessions []tpm2.Session, s tpm2.Session) bool {
+	if !reflect.TypeOf(s).Comparable() {
+		return false
+	}
+	for _, sess := range sessions {
+		if sess == s {
+			return true
+		}
+	}
+	return false
+}
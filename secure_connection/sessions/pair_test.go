@@ -0,0 +1,65 @@
+package sessions_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/salted"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sessions"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthAndEncrypt(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+
+	srkAuth := []byte("srkpassword")
+	srk, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpm2.ECCSRKTemplate,
+		UserAuth: srkAuth,
+	})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	secret := []byte("pairedsecret")
+	create := func(auth tpm2.Session) tpm2.Create {
+		return tpm2.Create{
+			ParentHandle: tpm2.AuthHandle{
+				Handle: srk.Handle(),
+				Name:   srk.Name(),
+				Auth:   auth,
+			},
+			InSensitive: tpm2.TPM2BSensitiveCreate{
+				Sensitive: &tpm2.TPMSSensitiveCreate{
+					Data: tpm2.NewTPMUSensitiveCreate(&tpm2.TPM2BSensitiveData{Buffer: secret}),
+				},
+			},
+			InPublic: tpm2.New2B(templates.Seal(templates.WithNoDA())),
+		}
+	}
+
+	wire := sniffer.New(tpm)
+	encSess := salted.Salted(srk.Handle(), *srk.Public())
+	_, err = sessions.Execute(wire, create(sessions.AuthAndEncrypt(srkAuth, encSess)))
+	require.NoError(t, err)
+	require.False(t, wire.ContainsPlaintext(secret))
+
+	// Without Execute, the paired session only authorizes.
+	wire = sniffer.New(tpm)
+	_, err = create(sessions.AuthAndEncrypt(srkAuth, encSess)).Execute(wire)
+	require.NoError(t, err)
+	require.True(t, wire.ContainsPlaintext(secret))
+
+	_, err = sessions.Execute(tpm, create(sessions.AuthAndEncrypt([]byte("wrong"), encSess)))
+	require.ErrorIs(t, err, tpm2.TPMRCBadAuth)
+
+	// Commands without paired sessions are executed as is.
+	rsp, err := sessions.Execute(tpm, tpm2.GetRandom{BytesRequested: 8})
+	require.NoError(t, err)
+	require.Len(t, rsp.RandomBytes.Buffer, 8)
+}
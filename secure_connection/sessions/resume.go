@@ -0,0 +1,579 @@
+package sessions
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	tpmcontext "github.com/loicsikidi/tpm-stuff/context"
+	"github.com/loicsikidi/tpm-stuff/decode"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+	"github.com/loicsikidi/tpm-stuff/metrics"
+	"github.com/loicsikidi/tpm-stuff/sensitive"
+)
+
+var (
+	// ErrInvalidState is returned by [Resume] when the saved session can't be
+	// decrypted, e.g. because of a wrong key or a corrupted file.
+	ErrInvalidState = errors.New("invalid saved session")
+	// ErrSessionClosed is returned when a [Resumable] session is used after
+	// [Save] or [Resumable.Close].
+	ErrSessionClosed = errors.New("session is closed")
+)
+
+// stateLabel is the additional data authenticated with a saved session, so
+// that the key can't be used to forge other kinds of files.
+var stateLabel = []byte("tpm-stuff resumable session")
+
+// Direction selects the parameters encrypted by a [Resumable] session.
+type Direction int
+
+const (
+	// EncryptInOut encrypts the first command and response parameters.
+	EncryptInOut Direction = iota
+	// EncryptIn encrypts the first command parameter only.
+	EncryptIn
+	// EncryptOut encrypts the first response parameter only.
+	EncryptOut
+)
+
+// ResumableConfig holds configuration for [Factory.StartResumable].
+type ResumableConfig struct {
+	// SaltKey is the loaded key salting the session, e.g. the SRK. Its public
+	// area must be known.
+	//
+	// Default: nil (unsalted session).
+	SaltKey tpmutil.Handle
+	// Direction selects the parameters encrypted by the session. Commands
+	// whose first parameter in a direction isn't a sized buffer (e.g.
+	// TPM2_Unseal, which has no command parameter) are rejected by the TPM
+	// with TPM_RC_ATTRIBUTES.
+	//
+	// Default: [EncryptInOut].
+	Direction Direction
+	// XOR obfuscates the parameters with a mask derived with this hash
+	// algorithm (Part 1, 21.2) instead of encrypting them with AES-CFB. XOR
+	// is cheaper on constrained TPMs and as confidential as long as the
+	// session key is secret.
+	//
+	// Default: 0 (AES-CFB, with the key size of the factory).
+	XOR tpm2.TPMIAlgHash
+	// Logger logs the commands starting, saving and flushing the session,
+	// and each command the session authorizes (see [Resumable.SetLogger]).
+	//
+	// Default: nil, no logging.
+	Logger *slog.Logger
+}
+
+// CheckAndSetDefault validates and sets default values for ResumableConfig.
+func (c *ResumableConfig) CheckAndSetDefault() error {
+	if c.SaltKey != nil && !c.SaltKey.HasPublic() {
+		return errors.New("salt key public area is unknown")
+	}
+	if c.Direction < EncryptInOut || c.Direction > EncryptOut {
+		return fmt.Errorf("invalid direction %d", c.Direction)
+	}
+	if c.XOR != 0 {
+		if _, err := c.XOR.Hash(); err != nil {
+			return fmt.Errorf("invalid XOR hash: %w", err)
+		}
+	}
+	return nil
+}
+
+// Resumable is a persistent HMAC session which can be saved with [Save] and
+// resumed with [Resume], possibly by another process, as long as the TPM
+// isn't reset in between.
+//
+// go-tpm keeps the nonces and session key of its sessions private, so
+// Resumable computes the HMACs and the parameter encryption itself. It is
+// also the only session supporting XOR obfuscation, which go-tpm lacks.
+// The session is never bound: it authorizes with the auth value set by
+// [Resumable.SetAuth], which isn't saved. The session key and the auth value
+// are zeroized once the session is closed or saved.
+type Resumable struct {
+	handle      tpm2.TPMHandle
+	hash        tpm2.TPMIAlgHash
+	aesKeyBits  tpm2.TPMKeyBits
+	xor         tpm2.TPMIAlgHash
+	direction   Direction
+	sessionKey  *sensitive.Buffer
+	nonceCaller []byte
+	nonceTPM    []byte
+	auth        *sensitive.Buffer
+	logger      *slog.Logger
+}
+
+// StartResumable starts a persistent HMAC session which can be saved and
+// resumed. The caller must call [Resumable.Close] to release the TPM session
+// slot, unless the session is saved.
+//
+// Example:
+//
+//	sess, err := factory.StartResumable(tpm, sessions.ResumableConfig{SaltKey: srk})
+//	if err != nil {
+//	    return err
+//	}
+//	rsp, err := tpm2.GetRandom{BytesRequested: 32}.Execute(tpm, sess)
+//	...
+//	err = sessions.Save(tpm, sess, "session.bin", key)
+func (f Factory) StartResumable(tpm transport.TPM, optionalCfg ...ResumableConfig) (*Resumable, error) {
+	var cfg ResumableConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	ha, err := f.Hash.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("invalid session hash: %w", err)
+	}
+
+	s := &Resumable{
+		hash:        f.Hash,
+		aesKeyBits:  f.AESKeyBits,
+		xor:         cfg.XOR,
+		direction:   cfg.Direction,
+		nonceCaller: make([]byte, f.NonceSize()),
+		logger:      cfg.Logger,
+	}
+	if _, err := rand.Read(s.nonceCaller); err != nil {
+		return nil, err
+	}
+	cmd := tpm2.StartAuthSession{
+		TPMKey:      tpm2.TPMRHNull,
+		Bind:        tpm2.TPMRHNull,
+		NonceCaller: tpm2.TPM2BNonce{Buffer: s.nonceCaller},
+		SessionType: tpm2.TPMSEHMAC,
+		Symmetric:   s.symmetric(),
+		AuthHash:    f.Hash,
+	}
+	var salt []byte
+	if cfg.SaltKey != nil {
+		key, err := tpm2.ImportEncapsulationKey(cfg.SaltKey.Public())
+		if err != nil {
+			return nil, fmt.Errorf("failed to import salt key: %w", err)
+		}
+		var encSalt []byte
+		salt, encSalt, err = tpm2.CreateEncryptedSalt(rand.Reader, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create salt: %w", err)
+		}
+		cmd.TPMKey = cfg.SaltKey.Handle()
+		cmd.EncryptedSalt = tpm2.TPM2BEncryptedSecret{Buffer: encSalt}
+	}
+	rsp, err := cmd.Execute(metrics.WithLogger(tpm, s.logger, "session start"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", tpmerrors.Wrap(err))
+	}
+	s.handle = tpm2.TPMHandle(rsp.SessionHandle.HandleValue())
+	s.nonceTPM = rsp.NonceTPM.Buffer
+	s.sessionKey = sensitive.New(SessionKey(ha, nil, salt, s.nonceTPM, s.nonceCaller))
+	sensitive.Wipe(salt)
+	return s, nil
+}
+
+// SetAuth sets the auth value of the entity authorized by the session. The
+// session keeps a copy of authValue: the caller may zeroize it.
+func (s *Resumable) SetAuth(authValue []byte) {
+	s.auth.Close() //nolint:errcheck
+	s.auth = sensitive.Clone(authValue)
+}
+
+// SetLogger sets the logger of the session (see [ResumableConfig.Logger]),
+// which isn't saved either: a resumed session doesn't log until it is set.
+func (s *Resumable) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// Close flushes the session and zeroizes its session key and auth value.
+func (s *Resumable) Close(tpm transport.TPM) error {
+	if s.handle != tpm2.TPMRHNull {
+		if _, err := (tpm2.FlushContext{FlushHandle: s.handle}).Execute(metrics.WithLogger(tpm, s.logger, "session close")); err != nil {
+			return fmt.Errorf("failed to flush session 0x%x: %w", s.handle, err)
+		}
+		s.handle = tpm2.TPMRHNull
+	}
+	s.wipe()
+	return nil
+}
+
+// wipe zeroizes the secrets of the session, which can no longer be used.
+func (s *Resumable) wipe() {
+	s.sessionKey.Close() //nolint:errcheck
+	s.auth.Close()       //nolint:errcheck
+}
+
+// Init implements tpm2.Session: the session is started by
+// [Factory.StartResumable] or [Resume].
+func (s *Resumable) Init(tpm transport.TPM) error {
+	if s.handle == tpm2.TPMRHNull {
+		return ErrSessionClosed
+	}
+	return nil
+}
+
+// CleanupFailure implements tpm2.Session: the session is kept on failure.
+func (s *Resumable) CleanupFailure(tpm transport.TPM) error {
+	return nil
+}
+
+// NonceTPM implements tpm2.Session.
+func (s *Resumable) NonceTPM() tpm2.TPM2BNonce {
+	return tpm2.TPM2BNonce{Buffer: s.nonceTPM}
+}
+
+// NewNonceCaller implements tpm2.Session.
+func (s *Resumable) NewNonceCaller() error {
+	_, err := rand.Read(s.nonceCaller)
+	return err
+}
+
+// Authorize implements tpm2.Session.
+func (s *Resumable) Authorize(cc tpm2.TPMCC, parms, addNonces []byte, names []tpm2.TPM2BName, authIndex int) (*tpm2.TPMSAuthCommand, error) {
+	if s.handle == tpm2.TPMRHNull {
+		return nil, ErrSessionClosed
+	}
+	ha, err := s.hash.Hash()
+	if err != nil {
+		return nil, err
+	}
+	h := ha.New()
+	binary.Write(h, binary.BigEndian, cc) //nolint:errcheck
+	for _, name := range names {
+		h.Write(name.Buffer)
+	}
+	h.Write(parms)
+
+	attrs := s.attributes()
+	return &tpm2.TPMSAuthCommand{
+		Handle:        s.handle,
+		Nonce:         tpm2.TPM2BNonce{Buffer: s.nonceCaller},
+		Attributes:    attrs,
+		Authorization: tpm2.TPM2BData{Buffer: s.hmac(h.Sum(nil), s.nonceCaller, s.nonceTPM, addNonces, attrs)},
+	}, nil
+}
+
+// Validate implements tpm2.Session: it checks the response HMAC and tracks
+// the new nonceTPM.
+func (s *Resumable) Validate(rc tpm2.TPMRC, cc tpm2.TPMCC, parms []byte, names []tpm2.TPM2BName, authIndex int, auth *tpm2.TPMSAuthResponse) error {
+	handle := s.handle
+	s.nonceTPM = auth.Nonce.Buffer
+	if !auth.Attributes.ContinueSession {
+		s.handle = tpm2.TPMRHNull
+	}
+	ha, err := s.hash.Hash()
+	if err != nil {
+		return err
+	}
+	h := ha.New()
+	binary.Write(h, binary.BigEndian, rc) //nolint:errcheck
+	binary.Write(h, binary.BigEndian, cc) //nolint:errcheck
+	h.Write(parms)
+
+	mac := s.hmac(h.Sum(nil), s.nonceTPM, s.nonceCaller, nil, auth.Attributes)
+	if !hmac.Equal(mac, auth.Authorization.Buffer) {
+		s.log(slog.LevelWarn, "session response HMAC mismatch", handle, cc)
+		return errors.New("incorrect authorization HMAC")
+	}
+	s.log(slog.LevelDebug, "session authorized command", handle, cc)
+	return nil
+}
+
+// log logs an event of the session about the command cc, if it has a logger.
+func (s *Resumable) log(level slog.Level, msg string, handle tpm2.TPMHandle, cc tpm2.TPMCC) {
+	if s.logger == nil {
+		return
+	}
+	s.logger.LogAttrs(context.Background(), level, msg,
+		slog.String("session", fmt.Sprintf("0x%08x", uint32(handle))),
+		slog.String("command", decode.CommandName(cc)))
+}
+
+// IsEncryption implements tpm2.Session.
+func (s *Resumable) IsEncryption() bool {
+	return s.direction != EncryptIn
+}
+
+// IsDecryption implements tpm2.Session.
+func (s *Resumable) IsDecryption() bool {
+	return s.direction != EncryptOut
+}
+
+// Encrypt implements tpm2.Session: it encrypts the first command parameter
+// in place.
+func (s *Resumable) Encrypt(parameter []byte) error {
+	if !s.IsDecryption() {
+		return nil
+	}
+	if s.xor != 0 {
+		return s.obfuscate(parameter, s.nonceCaller, s.nonceTPM)
+	}
+	stream, err := s.cfb(s.nonceCaller, s.nonceTPM, cipher.NewCFBEncrypter)
+	if err != nil {
+		return err
+	}
+	stream.XORKeyStream(parameter, parameter)
+	return nil
+}
+
+// Decrypt implements tpm2.Session: it decrypts the first response parameter
+// in place.
+func (s *Resumable) Decrypt(parameter []byte) error {
+	if !s.IsEncryption() {
+		return nil
+	}
+	if s.xor != 0 {
+		return s.obfuscate(parameter, s.nonceTPM, s.nonceCaller)
+	}
+	stream, err := s.cfb(s.nonceTPM, s.nonceCaller, cipher.NewCFBDecrypter)
+	if err != nil {
+		return err
+	}
+	stream.XORKeyStream(parameter, parameter)
+	return nil
+}
+
+// Handle implements tpm2.Session.
+func (s *Resumable) Handle() tpm2.TPMHandle {
+	return s.handle
+}
+
+func (s *Resumable) attributes() tpm2.TPMASession {
+	return tpm2.TPMASession{
+		ContinueSession: true,
+		Decrypt:         s.IsDecryption(),
+		Encrypt:         s.IsEncryption(),
+	}
+}
+
+// hmac computes the HMAC of a command or a response (Part 1, 19.6.5), keyed
+// with the session key and the auth value stripped of its trailing zeros.
+func (s *Resumable) hmac(pHash, nonceNewer, nonceOlder, addNonces []byte, attrs tpm2.TPMASession) []byte {
+	ha, _ := s.hash.Hash()
+	key := append(bytes.Clone(s.sessionKey.Bytes()), bytes.TrimRight(s.auth.Bytes(), "\x00")...)
+	defer sensitive.Wipe(key)
+	mac := hmac.New(ha.New, key)
+	mac.Write(pHash)
+	mac.Write(nonceNewer)
+	mac.Write(nonceOlder)
+	mac.Write(addNonces)
+	mac.Write([]byte{attributeBits(attrs)})
+	return mac.Sum(nil)
+}
+
+// cfb returns the AES-CFB stream of parameter encryption (Part 1, 21.3).
+func (s *Resumable) cfb(nonceNewer, nonceOlder []byte, mode func(cipher.Block, []byte) cipher.Stream) (cipher.Stream, error) {
+	ha, err := s.hash.Hash()
+	if err != nil {
+		return nil, err
+	}
+	keyBytes := int(s.aesKeyBits) / 8
+	sessionValue := append(bytes.Clone(s.sessionKey.Bytes()), s.auth.Bytes()...)
+	keyIV := KDFa(ha, sessionValue, "CFB", nonceNewer, nonceOlder, (keyBytes+aes.BlockSize)*8)
+	// The cipher and the stream keep their own copies of the key and IV.
+	defer sensitive.Wipe(sessionValue, keyIV)
+	block, err := aes.NewCipher(keyIV[:keyBytes])
+	if err != nil {
+		return nil, err
+	}
+	return mode(block, keyIV[keyBytes:]), nil
+}
+
+// obfuscate applies the XOR mask of parameter encryption (Part 1, 21.2) to
+// parameter in place: the same operation encrypts and decrypts.
+func (s *Resumable) obfuscate(parameter, nonceNewer, nonceOlder []byte) error {
+	ha, err := s.xor.Hash()
+	if err != nil {
+		return err
+	}
+	sessionValue := append(bytes.Clone(s.sessionKey.Bytes()), s.auth.Bytes()...)
+	mask := KDFa(ha, sessionValue, "XOR", nonceNewer, nonceOlder, len(parameter)*8)
+	defer sensitive.Wipe(sessionValue, mask)
+	for i := range parameter {
+		parameter[i] ^= mask[i]
+	}
+	return nil
+}
+
+// symmetric returns the parameter encryption algorithm of the session.
+func (s *Resumable) symmetric() tpm2.TPMTSymDef {
+	if s.xor != 0 {
+		return tpm2.TPMTSymDef{
+			Algorithm: tpm2.TPMAlgXOR,
+			KeyBits:   tpm2.NewTPMUSymKeyBits(tpm2.TPMAlgXOR, s.xor),
+			Mode:      tpm2.NewTPMUSymMode(tpm2.TPMAlgXOR, tpm2.TPMSEmpty{}),
+		}
+	}
+	return tpm2.TPMTSymDef{
+		Algorithm: tpm2.TPMAlgAES,
+		KeyBits:   tpm2.NewTPMUSymKeyBits(tpm2.TPMAlgAES, s.aesKeyBits),
+		Mode:      tpm2.NewTPMUSymMode(tpm2.TPMAlgAES, tpm2.TPMAlgCFB),
+	}
+}
+
+// attributeBits encodes the TPMA_SESSION attributes of a session.
+func attributeBits(attrs tpm2.TPMASession) byte {
+	var b byte
+	if attrs.ContinueSession {
+		b |= 1 << 0
+	}
+	if attrs.AuditExclusive {
+		b |= 1 << 1
+	}
+	if attrs.AuditReset {
+		b |= 1 << 2
+	}
+	if attrs.Decrypt {
+		b |= 1 << 5
+	}
+	if attrs.Encrypt {
+		b |= 1 << 6
+	}
+	if attrs.Audit {
+		b |= 1 << 7
+	}
+	return b
+}
+
+// savedSession is the state of a saved [Resumable] session, encrypted
+// before being written to disk.
+type savedSession struct {
+	// Context is the session context saved by the TPM, in its wire format.
+	Context     []byte           `json:"context"`
+	Hash        tpm2.TPMIAlgHash `json:"hash"`
+	AESKeyBits  tpm2.TPMKeyBits  `json:"aes_key_bits"`
+	XOR         tpm2.TPMIAlgHash `json:"xor,omitempty"`
+	Direction   Direction        `json:"direction"`
+	SessionKey  []byte           `json:"session_key"`
+	NonceCaller []byte           `json:"nonce_caller"`
+	NonceTPM    []byte           `json:"nonce_tpm"`
+}
+
+// Save saves the context of sess (TPM2_ContextSave) along with its session
+// key and nonces to path, encrypted with AES-GCM under key (16, 24 or 32
+// bytes). The session leaves the TPM session slots but keeps its handle
+// until it is resumed with [Resume]; sess can no longer be used.
+//
+// The auth value set by [Resumable.SetAuth] isn't saved. A saved session is
+// only valid for the TPM which saved it, until the next TPM Reset, and can be
+// resumed once: resuming it again requires saving it again. The secrets of
+// sess are zeroized once it is saved.
+func Save(tpm transport.TPM, sess *Resumable, path string, key []byte) error {
+	if sess.handle == tpm2.TPMRHNull {
+		return ErrSessionClosed
+	}
+	aead, err := stateCipher(key)
+	if err != nil {
+		return err
+	}
+	rsp, err := tpm2.ContextSave{SaveHandle: sess.handle}.Execute(metrics.WithLogger(tpm, sess.logger, "session save"))
+	if err != nil {
+		return fmt.Errorf("failed to save context of session 0x%x: %w", sess.handle, err)
+	}
+	state, err := json.Marshal(savedSession{
+		Context:     tpmcontext.Marshal(&rsp.Context),
+		Hash:        sess.hash,
+		AESKeyBits:  sess.aesKeyBits,
+		XOR:         sess.xor,
+		Direction:   sess.direction,
+		SessionKey:  sess.sessionKey.Bytes(),
+		NonceCaller: sess.nonceCaller,
+		NonceTPM:    sess.nonceTPM,
+	})
+	if err != nil {
+		return err
+	}
+	defer sensitive.Wipe(state)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, aead.Seal(nonce, nonce, state, stateLabel), 0o600); err != nil {
+		return fmt.Errorf("failed to write saved session: %w", err)
+	}
+	sess.handle = tpm2.TPMRHNull
+	sess.wipe()
+	return nil
+}
+
+// Resume loads back the session saved to path by [Save] (TPM2_ContextLoad),
+// decrypting it with key. The caller must call [Resumable.Close] to release
+// the TPM session slot, unless the session is saved again.
+//
+// It returns [ErrInvalidState] when the file can't be decrypted, and
+// [tpmcontext.ErrInvalidContext] when the TPM rejects the saved context, e.g.
+// after a TPM Reset or when the session was already resumed.
+//
+// Example:
+//
+//	sess, err := sessions.Resume(tpm, "session.bin", key)
+//	if err != nil {
+//	    return err
+//	}
+//	defer sess.Close(tpm)
+func Resume(tpm transport.TPM, path string, key []byte) (*Resumable, error) {
+	aead, err := stateCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved session: %w", err)
+	}
+	if len(b) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: file too short", ErrInvalidState)
+	}
+	state, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], stateLabel)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidState, err)
+	}
+	defer sensitive.Wipe(state)
+	var saved savedSession
+	if err := json.Unmarshal(state, &saved); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidState, err)
+	}
+	savedCtx, err := tpmcontext.Unmarshal(saved.Context)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidState, err)
+	}
+
+	rsp, err := tpm2.ContextLoad{Context: *savedCtx}.Execute(tpm)
+	if err != nil {
+		if errors.Is(err, tpm2.TPMRCIntegrity) || errors.Is(err, tpm2.TPMRCHandle) {
+			return nil, fmt.Errorf("%w: %w", tpmcontext.ErrInvalidContext, err)
+		}
+		return nil, fmt.Errorf("failed to load session context: %w", tpmerrors.Wrap(err))
+	}
+	return &Resumable{
+		handle:      rsp.LoadedHandle,
+		hash:        saved.Hash,
+		aesKeyBits:  saved.AESKeyBits,
+		xor:         saved.XOR,
+		direction:   saved.Direction,
+		sessionKey:  sensitive.New(saved.SessionKey),
+		nonceCaller: saved.NonceCaller,
+		nonceTPM:    saved.NonceTPM,
+	}, nil
+}
+
+func stateCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,165 @@
+package sessions_test
+
+import (
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	tpmcontext "github.com/loicsikidi/tpm-stuff/context"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sessions"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveResume(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+
+	factory, err := sessions.Negotiate(tpm)
+	require.NoError(t, err)
+	srk, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpm2.ECCSRKTemplate,
+	})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "session.bin")
+
+	sess, err := factory.StartResumable(tpm, sessions.ResumableConfig{SaltKey: srk})
+	require.NoError(t, err)
+	createPrimary(t, tpm, sess)
+	require.NoError(t, sessions.Save(tpm, sess, path, key))
+
+	// The saved session can't be used until it's resumed.
+	_, err = tpm2.GetRandom{BytesRequested: 16}.Execute(tpm, sess)
+	require.ErrorIs(t, err, sessions.ErrSessionClosed)
+
+	wrongKey := make([]byte, 32)
+	_, err = sessions.Resume(tpm, path, wrongKey)
+	require.ErrorIs(t, err, sessions.ErrInvalidState)
+
+	// The TPM checks the HMACs computed with the resumed nonces and session
+	// key, which also encrypt the parameters.
+	resumed, err := sessions.Resume(tpm, path, key)
+	require.NoError(t, err)
+	createPrimary(t, tpm, resumed)
+
+	// A saved session can't be replayed once it has been resumed.
+	_, err = sessions.Resume(tpm, path, key)
+	require.ErrorIs(t, err, tpmcontext.ErrInvalidContext)
+
+	// It can be saved and resumed again.
+	require.NoError(t, sessions.Save(tpm, resumed, path, key))
+	resumed, err = sessions.Resume(tpm, path, key)
+	require.NoError(t, err)
+	createPrimary(t, tpm, resumed)
+	require.NoError(t, resumed.Close(tpm))
+}
+
+func TestStartResumable_Direction(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+
+	sess, err := sessions.Default.StartResumable(tpm, sessions.ResumableConfig{Direction: sessions.EncryptOut})
+	require.NoError(t, err)
+	defer sess.Close(tpm)
+
+	// TPM2_GetRandom has no command parameter, so only its response can be
+	// encrypted.
+	_, err = tpm2.GetRandom{BytesRequested: 16}.Execute(tpm, sess)
+	require.NoError(t, err)
+
+	_, err = sessions.Default.StartResumable(tpm, sessions.ResumableConfig{Direction: 42})
+	require.Error(t, err)
+}
+
+func TestStartResumable_XOR(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+
+	srk, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpm2.ECCSRKTemplate,
+	})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	sess, err := sessions.Default.StartResumable(tpm, sessions.ResumableConfig{SaltKey: srk, XOR: tpm2.TPMAlgSHA256})
+	require.NoError(t, err)
+	defer sess.Close(tpm)
+
+	// The TPM only accepts the password and returns the secret if both sides
+	// compute the same mask.
+	password := []byte("xorpassword")
+	secret := []byte("xor-obfuscated secret")
+	wire := sniffer.New(tpm)
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: password},
+				Data:     tpm2.NewTPMUSensitiveCreate(&tpm2.TPM2BSensitiveData{Buffer: secret}),
+			},
+		},
+		InPublic: tpm2.New2B(templates.Seal()),
+	}.Execute(wire, sess)
+	require.NoError(t, err)
+	defer tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm) //nolint:errcheck
+
+	// The algorithm is saved along with the session.
+	path := filepath.Join(t.TempDir(), "session.bin")
+	key := make([]byte, 32)
+	require.NoError(t, sessions.Save(tpm, sess, path, key))
+	sess, err = sessions.Resume(tpm, path, key)
+	require.NoError(t, err)
+	createPrimary(t, tpm, sess)
+
+	// TPM2_Unseal has no command parameter.
+	out, err := sessions.Default.StartResumable(tpm, sessions.ResumableConfig{Direction: sessions.EncryptOut, XOR: tpm2.TPMAlgSHA256})
+	require.NoError(t, err)
+	defer out.Close(tpm)
+	unsealRsp, err := tpm2.Unseal{
+		ItemHandle: tpm2.AuthHandle{Handle: rsp.ObjectHandle, Name: rsp.Name, Auth: tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Auth(password))},
+	}.Execute(wire, out)
+	require.NoError(t, err)
+	require.Equal(t, secret, unsealRsp.OutData.Buffer)
+	require.False(t, wire.ContainsPlaintext(password))
+	require.False(t, wire.ContainsPlaintext(secret))
+
+	_, err = sessions.Default.StartResumable(tpm, sessions.ResumableConfig{XOR: tpm2.TPMAlgAES})
+	require.Error(t, err)
+}
+
+// createPrimary creates a primary key with a password, authorized and
+// encrypted by sess, and checks the password doesn't leak on the wire.
+func createPrimary(t *testing.T, tpm transport.TPM, sess *sessions.Resumable) {
+	t.Helper()
+	password := []byte("resumedpassword")
+	wire := sniffer.New(tpm)
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMRHOwner,
+			Auth:   sess,
+		},
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: password},
+			},
+		},
+		InPublic: tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(wire)
+	require.NoError(t, err)
+	require.False(t, wire.ContainsPlaintext(password))
+	_, err = tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm)
+	require.NoError(t, err)
+}
@@ -0,0 +1,118 @@
+// Package sessions creates encrypted sessions with the strongest parameter
+// encryption cipher and session hash supported by the TPM, rather than the
+// AES-128-CFB and SHA-256 assumed by the unbound, bound and salted packages.
+//
+// The sessions of [Factory], like those of the unbound, bound and salted
+// packages, are go-tpm sessions and only support AES-CFB parameter
+// encryption: go-tpm has no XOR obfuscation. XOR is only available through
+// [Resumable] (see [ResumableConfig.XOR]), which computes the parameter
+// encryption itself.
+package sessions
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/capability"
+)
+
+// Default is the suite supported by every TPM 2.0: AES-128-CFB and SHA-256.
+var Default = Factory{Hash: tpm2.TPMAlgSHA256, AESKeyBits: 128}
+
+// Factory creates sessions using a session hash and an AES key size for
+// parameter encryption.
+type Factory struct {
+	// Hash is the session hash algorithm, used to compute the HMACs and
+	// derive the session keys.
+	Hash tpm2.TPMIAlgHash
+	// AESKeyBits is the AES key size of parameter encryption, in CFB mode.
+	AESKeyBits tpm2.TPMKeyBits
+}
+
+// Negotiate returns a Factory using the strongest algorithms supported by
+// the TPM: AES-256, else AES-192, else AES-128, and SHA-384, else SHA-256.
+//
+// Example:
+//
+//	factory, err := sessions.Negotiate(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	rsp, err := tpm2.CreatePrimary{
+//	    PrimaryHandle: tpm2.AuthHandle{
+//	        Handle: tpm2.TPMRHOwner,
+//	        Auth:   factory.Unbound(ownerAuth),
+//	    },
+//	    // ...
+//	}.Execute(tpm)
+func Negotiate(tpm transport.TPM) (Factory, error) {
+	bits, err := capability.MaxAESKeyBits(tpm)
+	if err != nil {
+		return Factory{}, fmt.Errorf("failed to negotiate the session cipher: %w", err)
+	}
+	hash := tpm2.TPMAlgSHA256
+	sha384, err := capability.SupportsAlgorithm(tpm, tpm2.TPMAlgSHA384)
+	if err != nil {
+		return Factory{}, fmt.Errorf("failed to negotiate the session hash: %w", err)
+	}
+	if sha384 {
+		hash = tpm2.TPMAlgSHA384
+	}
+	return Factory{Hash: hash, AESKeyBits: tpm2.TPMKeyBits(bits)}, nil
+}
+
+// String returns the algorithms of f, e.g. "AES-256-CFB/SHA-384".
+func (f Factory) String() string {
+	hash := fmt.Sprintf("0x%x", uint16(f.Hash))
+	if h, err := f.Hash.Hash(); err == nil {
+		hash = h.String()
+	}
+	return fmt.Sprintf("AES-%d-CFB/%s", f.AESKeyBits, hash)
+}
+
+// NonceSize returns the size of the caller nonces, the digest size of the
+// session hash as recommended by the specification.
+func (f Factory) NonceSize() int {
+	h, err := f.Hash.Hash()
+	if err != nil {
+		return 16
+	}
+	return h.Size()
+}
+
+// HMAC creates an inline HMAC session encrypting the first command and
+// response parameters, with opts (e.g. tpm2.Auth, tpm2.Bound or
+// tpm2.Salted).
+func (f Factory) HMAC(opts ...tpm2.AuthOption) tpm2.Session {
+	return tpm2.HMAC(f.Hash, f.NonceSize(), f.options(opts)...)
+}
+
+// HMACSession creates a persistent HMAC session encrypting the first command
+// and response parameters, with opts. The caller must call the returned
+// closer function to release the TPM session slot.
+func (f Factory) HMACSession(tpm transport.TPM, opts ...tpm2.AuthOption) (tpm2.Session, func() error, error) {
+	return tpm2.HMACSession(tpm, f.Hash, f.NonceSize(), f.options(opts)...)
+}
+
+// Unbound creates an inline unbound session authorizing with authValue, like
+// unbound.Unbound.
+func (f Factory) Unbound(authValue []byte) tpm2.Session {
+	return f.HMAC(tpm2.Auth(authValue))
+}
+
+// Bound creates an inline session bound to bindHandle and authorizing with
+// authValue, like bound.Bound.
+func (f Factory) Bound(bindHandle tpm2.TPMHandle, bindName tpm2.TPM2BName, bindAuth, authValue []byte) tpm2.Session {
+	return f.HMAC(tpm2.Bound(bindHandle, bindName, bindAuth), tpm2.Auth(authValue))
+}
+
+// Salted creates an inline session salted with saltKeyHandle, for parameter
+// encryption only, like salted.Salted.
+func (f Factory) Salted(saltKeyHandle tpm2.TPMHandle, saltKeyPublic tpm2.TPMTPublic) tpm2.Session {
+	return f.HMAC(tpm2.Salted(saltKeyHandle, saltKeyPublic))
+}
+
+func (f Factory) options(opts []tpm2.AuthOption) []tpm2.AuthOption {
+	return append(opts[:len(opts):len(opts)], tpm2.AESEncryption(f.AESKeyBits, tpm2.EncryptInOut))
+}
@@ -0,0 +1,113 @@
+package sessions_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/handles"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sessions"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/stretchr/testify/require"
+)
+
+// noAES256 is a transport emulating a TPM without AES-256: it rejects the
+// TPM2_TestParms commands with a 256-bit key.
+type noAES256 struct {
+	transport.TPM
+}
+
+func (n noAES256) Send(cmd []byte) ([]byte, error) {
+	if tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:])) == tpm2.TPMCCTestParms && bytes.Contains(cmd[10:], []byte{0x01, 0x00}) {
+		rsp := binary.BigEndian.AppendUint16(nil, uint16(tpm2.TPMSTNoSessions))
+		rsp = binary.BigEndian.AppendUint32(rsp, 10)
+		return binary.BigEndian.AppendUint32(rsp, uint32(tpm2.TPMRCKeySize)), nil
+	}
+	return n.TPM.Send(cmd)
+}
+
+func TestNegotiate(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+
+	factory, err := sessions.Negotiate(tpm)
+	require.NoError(t, err)
+	// The reference simulator implements AES-256 and SHA-384.
+	require.Equal(t, sessions.Factory{Hash: tpm2.TPMAlgSHA384, AESKeyBits: 256}, factory)
+	require.Equal(t, "AES-256-CFB/SHA-384", factory.String())
+	require.Equal(t, 48, factory.NonceSize())
+
+	factory, err = sessions.Negotiate(noAES256{tpm})
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMKeyBits(128), factory.AESKeyBits)
+}
+
+func TestFactory(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
+
+	factory, err := sessions.Negotiate(tpm)
+	require.NoError(t, err)
+
+	ekRsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHEndorsement,
+		InPublic:      tpm2.New2B(tpm2.RSAEKTemplate),
+	}.Execute(tpm)
+	require.NoError(t, err)
+	tracker.Track(ekRsp.ObjectHandle)
+	ekPub, err := ekRsp.OutPublic.Contents()
+	require.NoError(t, err)
+
+	password := []byte("negotiatedpassword")
+	for name, tc := range map[string]struct {
+		// auth authorizes the owner hierarchy, encrypt is the additional
+		// encryption session if any.
+		auth, encrypt func() tpm2.Session
+	}{
+		"Unbound": {auth: func() tpm2.Session { return factory.Unbound(nil) }},
+		"Bound": {auth: func() tpm2.Session {
+			return factory.Bound(tpm2.TPMRHOwner, tpm2.HandleName(tpm2.TPMRHOwner), nil, nil)
+		}},
+		"Salted": {
+			auth:    func() tpm2.Session { return tpm2.PasswordAuth(nil) },
+			encrypt: func() tpm2.Session { return factory.Salted(ekRsp.ObjectHandle, *ekPub) },
+		},
+		"HMACSession": {auth: func() tpm2.Session {
+			sess, closer, err := factory.HMACSession(tpm, tpm2.Auth(nil))
+			require.NoError(t, err)
+			return tracker.TrackSession(sess, closer)
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var extra []tpm2.Session
+			if tc.encrypt != nil {
+				extra = append(extra, tc.encrypt())
+			}
+			wire := sniffer.New(tpm)
+			rsp, err := tpm2.CreatePrimary{
+				PrimaryHandle: tpm2.AuthHandle{
+					Handle: tpm2.TPMRHOwner,
+					Auth:   tc.auth(),
+				},
+				InSensitive: tpm2.TPM2BSensitiveCreate{
+					Sensitive: &tpm2.TPMSSensitiveCreate{
+						UserAuth: tpm2.TPM2BAuth{Buffer: password},
+					},
+				},
+				InPublic: tpm2.New2B(tpm2.ECCSRKTemplate),
+			}.Execute(wire, extra...)
+			require.NoError(t, err)
+			tracker.Track(rsp.ObjectHandle)
+			require.False(t, wire.ContainsPlaintext(password))
+			// Free the object slot for the next case.
+			require.NoError(t, tracker.Flush(rsp.ObjectHandle))
+		})
+	}
+}
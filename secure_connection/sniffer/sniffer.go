@@ -0,0 +1,107 @@
+// Package sniffer simulates a passive attacker on the TPM bus.
+//
+// Its transport forwards commands to a TPM untouched and keeps a copy of
+// every command and response, so tests can assert whether a secret travelled
+// in clear instead of inspecting a packet capture by hand.
+package sniffer
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Transport is a [transport.TPM] which records the commands and responses it
+// forwards. It is safe for concurrent use.
+type Transport struct {
+	tpm transport.TPM
+
+	mu        sync.Mutex
+	commands  [][]byte
+	responses [][]byte
+}
+
+// New returns a Transport forwarding commands to tpm.
+func New(tpm transport.TPM) *Transport {
+	return &Transport{tpm: tpm}
+}
+
+// Send implements [transport.TPM].
+func (t *Transport) Send(cmd []byte) ([]byte, error) {
+	// Copy the command before sending it: the simulator decrypts the
+	// parameters in place.
+	sent := bytes.Clone(cmd)
+	rsp, err := t.tpm.Send(cmd)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.commands = append(t.commands, sent)
+	if err == nil {
+		t.responses = append(t.responses, bytes.Clone(rsp))
+	}
+	return rsp, err
+}
+
+// Commands returns a copy of the commands sent so far.
+func (t *Transport) Commands() [][]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return cloneAll(t.commands)
+}
+
+// Responses returns a copy of the responses received so far.
+func (t *Transport) Responses() [][]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return cloneAll(t.responses)
+}
+
+// Reset forgets the recorded commands and responses.
+func (t *Transport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.commands, t.responses = nil, nil
+}
+
+// ContainsPlaintext reports whether secret appears in clear in any recorded
+// command or response. An empty secret is never reported.
+func (t *Transport) ContainsPlaintext(secret []byte) bool {
+	return t.SentPlaintext(secret) || t.ReceivedPlaintext(secret)
+}
+
+// SentPlaintext reports whether secret appears in clear in any recorded
+// command.
+func (t *Transport) SentPlaintext(secret []byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return containsAny(t.commands, secret)
+}
+
+// ReceivedPlaintext reports whether secret appears in clear in any recorded
+// response.
+func (t *Transport) ReceivedPlaintext(secret []byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return containsAny(t.responses, secret)
+}
+
+func containsAny(msgs [][]byte, secret []byte) bool {
+	if len(secret) == 0 {
+		return false
+	}
+	for _, m := range msgs {
+		if bytes.Contains(m, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneAll(msgs [][]byte) [][]byte {
+	out := make([][]byte, len(msgs))
+	for i, m := range msgs {
+		out[i] = bytes.Clone(m)
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package sniffer_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/unbound"
+	"github.com/stretchr/testify/require"
+)
+
+// TestContainsPlaintext reproduces the simple demo: the same primary key is
+// created with a password session, which leaves the new password readable on
+// the bus, and with an encrypted session, which hides it.
+func TestContainsPlaintext(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+
+	password := []byte("MySecretPassword123!")
+
+	for name, tc := range map[string]struct {
+		auth      tpm2.Session
+		plaintext bool
+	}{
+		"PasswordAuth": {auth: tpm2.PasswordAuth(nil), plaintext: true},
+		"Encrypted":    {auth: unbound.Unbound(nil)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			wire := sniffer.New(tpm)
+
+			rsp, err := tpm2.CreatePrimary{
+				PrimaryHandle: tpm2.AuthHandle{
+					Handle: tpm2.TPMRHOwner,
+					Auth:   tc.auth,
+				},
+				InSensitive: tpm2.TPM2BSensitiveCreate{
+					Sensitive: &tpm2.TPMSSensitiveCreate{
+						UserAuth: tpm2.TPM2BAuth{Buffer: password},
+					},
+				},
+				InPublic: tpm2.New2B(tpm2.ECCSRKTemplate),
+			}.Execute(wire)
+			require.NoError(t, err)
+			defer tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm)
+
+			// The inline encrypted session adds StartAuthSession and FlushContext.
+			require.Equal(t, len(wire.Commands()), len(wire.Responses()))
+			require.Equal(t, tc.plaintext, wire.ContainsPlaintext(password))
+			require.Equal(t, tc.plaintext, wire.SentPlaintext(password))
+			require.False(t, wire.ReceivedPlaintext(password))
+
+			wire.Reset()
+			require.Empty(t, wire.Commands())
+			require.False(t, wire.ContainsPlaintext(password))
+		})
+	}
+}
+
+// TestReceivedPlaintext checks responses are recorded as well: random bytes
+// returned by the TPM are visible on the bus.
+func TestReceivedPlaintext(t *testing.T) {
+	tpm, err := common.OpenSimulator()
+	require.NoError(t, err)
+	defer tpm.Close()
+
+	wire := sniffer.New(tpm)
+	rsp, err := tpm2.GetRandom{BytesRequested: 16}.Execute(wire)
+	require.NoError(t, err)
+
+	require.True(t, wire.ReceivedPlaintext(rsp.RandomBytes.Buffer))
+	require.False(t, wire.SentPlaintext(rsp.RandomBytes.Buffer))
+	require.False(t, wire.ContainsPlaintext(nil))
+}
@@ -4,8 +4,11 @@ import (
 	"testing"
 
 	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/handles"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/common"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
 	"github.com/loicsikidi/tpm-stuff/secure_connection/unbound"
+	"github.com/loicsikidi/tpm-stuff/templates"
 	"github.com/stretchr/testify/require"
 )
 
@@ -13,6 +16,8 @@ func TestUnbound_KeyCreation(t *testing.T) {
 	tpm, err := common.OpenSimulator()
 	require.NoError(t, err)
 	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
 
 	// Create a primary key with password protection using encrypted session
 	password := []byte("mysecretpassword")
@@ -32,48 +37,32 @@ func TestUnbound_KeyCreation(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				SignEncrypt:         true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCSigner()),
 	}
 
-	rsp, err := createPrimary.Execute(tpm)
+	wire := sniffer.New(tpm)
+	rsp, err := createPrimary.Execute(wire)
 	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
 	require.NotNil(t, rsp)
 	require.NotNil(t, rsp.OutPublic)
 
 	// The password was encrypted during transmission via the unbound session
 	// This protects the password from passive eavesdropping on the bus
-
-	// Clean up
-	flush := tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}
-	_, err = flush.Execute(tpm)
-	require.NoError(t, err)
+	require.False(t, wire.ContainsPlaintext(password))
 }
 
 func TestUnboundSession_PersistentSession(t *testing.T) {
 	tpm, err := common.OpenSimulator()
 	require.NoError(t, err)
 	defer tpm.Close()
+	tracker := handles.NewTracker(tpm, handles.Config{Warnf: t.Errorf})
+	defer tracker.Close()
 
 	// Create persistent unbound session (for demonstration/performance)
 	sess, closer, err := unbound.UnboundSession(tpm, []byte(""))
 	require.NoError(t, err)
-	defer closer() // Must call to release TPM slot
+	tracker.TrackSession(sess, closer)
 
 	password := []byte("mysecretpassword")
 
@@ -90,27 +79,12 @@ func TestUnboundSession_PersistentSession(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				SignEncrypt:         true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCSigner()),
 	}
 
 	rsp, err := createPrimary.Execute(tpm)
 	require.NoError(t, err)
+	tracker.Track(rsp.ObjectHandle)
 	require.NotNil(t, rsp)
 
 	// Reuse same session for second operation (demonstrates session reuse)
@@ -126,35 +100,11 @@ func TestUnboundSession_PersistentSession(t *testing.T) {
 				},
 			},
 		},
-		InPublic: tpm2.New2B(tpm2.TPMTPublic{
-			Type:    tpm2.TPMAlgECC,
-			NameAlg: tpm2.TPMAlgSHA256,
-			ObjectAttributes: tpm2.TPMAObject{
-				SignEncrypt:         true,
-				FixedTPM:            true,
-				FixedParent:         true,
-				SensitiveDataOrigin: true,
-				UserWithAuth:        true,
-			},
-			Parameters: tpm2.NewTPMUPublicParms(
-				tpm2.TPMAlgECC,
-				&tpm2.TPMSECCParms{
-					CurveID: tpm2.TPMECCNistP256,
-				},
-			),
-		}),
+		InPublic: tpm2.New2B(templates.ECCSigner()),
 	}
 
 	rsp2, err := createPrimary2.Execute(tpm)
 	require.NoError(t, err)
+	tracker.Track(rsp2.ObjectHandle)
 	require.NotNil(t, rsp2)
-
-	// Clean up both keys
-	flush := tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}
-	_, err = flush.Execute(tpm)
-	require.NoError(t, err)
-
-	flush2 := tpm2.FlushContext{FlushHandle: rsp2.ObjectHandle}
-	_, err = flush2.Execute(tpm)
-	require.NoError(t, err)
 }
@@ -0,0 +1,105 @@
+// Package sensitive holds secrets, such as passwords, unsealed data and
+// session keys, in buffers which are zeroized when closed and redacted when
+// printed, logged or encoded.
+//
+// Go doesn't guarantee that a secret leaves no copy in memory: a slice
+// grown by append, a string converted from bytes or a buffer marshaled by
+// go-tpm keep theirs until the garbage collector reuses their memory. A
+// [Buffer] shortens the life of the copy it owns instead, and keeps it out of
+// the logs, which is where secrets leak most often.
+package sensitive
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+)
+
+// redacted replaces the content of a [Buffer] wherever it is formatted.
+const redacted = "[REDACTED]"
+
+// Buffer is a secret which is zeroized by [Buffer.Close]. Its content is
+// only returned by [Buffer.Bytes]: fmt, log/slog and encoding/json print
+// "[REDACTED]" instead.
+//
+// The methods of a nil Buffer behave as those of a closed one.
+type Buffer struct {
+	b []byte
+}
+
+// New returns a Buffer taking ownership of b: b is zeroized when the buffer
+// is closed, and mustn't be used afterwards.
+//
+// Example:
+//
+//	secret := sensitive.New(rsp.OutData.Buffer)
+//	defer secret.Close()
+func New(b []byte) *Buffer {
+	return &Buffer{b: b}
+}
+
+// Clone returns a Buffer holding a copy of b, e.g. a password set by the
+// caller, which remains responsible for zeroizing b.
+func Clone(b []byte) *Buffer {
+	return &Buffer{b: append([]byte(nil), b...)}
+}
+
+// Bytes returns the content of b, nil once b is closed. The returned slice
+// is zeroized by [Buffer.Close]: it mustn't be retained.
+func (b *Buffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.b
+}
+
+// Len returns the length of the content of b.
+func (b *Buffer) Len() int {
+	return len(b.Bytes())
+}
+
+// Closed reports whether b was closed.
+func (b *Buffer) Closed() bool {
+	return b == nil || b.b == nil
+}
+
+// Close zeroizes the content of b. Closing b twice is a no-op.
+func (b *Buffer) Close() error {
+	if b == nil {
+		return nil
+	}
+	Wipe(b.b)
+	b.b = nil
+	return nil
+}
+
+// String implements fmt.Stringer: it returns "[REDACTED]".
+func (b *Buffer) String() string {
+	return redacted
+}
+
+// Format implements fmt.Formatter, so that no verb, e.g. %x or %#v, prints
+// the content of b.
+func (b *Buffer) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, redacted)
+}
+
+// LogValue implements slog.LogValuer.
+func (b *Buffer) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+// MarshalJSON implements json.Marshaler: b is encoded as "[REDACTED]".
+func (b *Buffer) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// Wipe zeroizes bufs, e.g. the temporary copies of a secret which don't
+// warrant a [Buffer].
+func Wipe(bufs ...[]byte) {
+	for _, b := range bufs {
+		clear(b)
+	}
+	// Keep the writes from being optimized away as dead stores.
+	runtime.KeepAlive(bufs)
+}
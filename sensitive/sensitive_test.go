@@ -0,0 +1,67 @@
+package sensitive_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/loicsikidi/tpm-stuff/sensitive"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuffer_Close(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	buf := sensitive.New(secret)
+	require.Equal(t, secret, buf.Bytes())
+	require.Equal(t, len(secret), buf.Len())
+	require.False(t, buf.Closed())
+
+	require.NoError(t, buf.Close())
+	require.Equal(t, make([]byte, len(secret)), secret)
+	require.Nil(t, buf.Bytes())
+	require.Zero(t, buf.Len())
+	require.True(t, buf.Closed())
+	require.NoError(t, buf.Close())
+
+	var nilBuf *sensitive.Buffer
+	require.Nil(t, nilBuf.Bytes())
+	require.True(t, nilBuf.Closed())
+	require.NoError(t, nilBuf.Close())
+}
+
+func TestClone(t *testing.T) {
+	password := []byte("password")
+	buf := sensitive.Clone(password)
+	require.NoError(t, buf.Close())
+	require.Equal(t, []byte("password"), password)
+}
+
+func TestBuffer_Redacted(t *testing.T) {
+	buf := sensitive.New([]byte("secret"))
+	defer buf.Close()
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x", "%X", "%d"} {
+		require.Equal(t, "[REDACTED]", fmt.Sprintf(format, buf), format)
+	}
+	require.Equal(t, "[REDACTED]", buf.String())
+
+	b, err := json.Marshal(struct {
+		Password *sensitive.Buffer `json:"password"`
+	}{buf})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"password":"[REDACTED]"}`, string(b))
+
+	var logs bytes.Buffer
+	slog.New(slog.NewTextHandler(&logs, nil)).Info("login", "password", buf)
+	require.Contains(t, logs.String(), "password=[REDACTED]")
+	require.NotContains(t, logs.String(), "secret")
+}
+
+func TestWipe(t *testing.T) {
+	a, b := []byte{1, 2, 3}, []byte{4, 5}
+	sensitive.Wipe(a, b, nil)
+	require.Equal(t, []byte{0, 0, 0}, a)
+	require.Equal(t, []byte{0, 0}, b)
+}
@@ -0,0 +1,155 @@
+// Package sign signs data with any TPM signing key, hiding the difference
+// between restricted keys, which only sign digests computed by the TPM along
+// with a hash check ticket, and unrestricted keys, which sign any digest.
+package sign
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/tpmhash"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+)
+
+// Options holds configuration for [Sign].
+type Options struct {
+	// Auth is the authorization session for the key.
+	//
+	// Default: [tpmutil.NoAuth].
+	Auth tpm2.Session
+	// Hash is the hash algorithm. It must match the scheme of the key, if the
+	// key has one.
+	//
+	// Default: the hash of the key scheme, else [crypto.SHA256].
+	Hash crypto.Hash
+	// PSS selects RSASSA-PSS for RSA keys without a scheme.
+	//
+	// Default: false (RSASSA-PKCS1-v1_5).
+	PSS bool
+	// Hierarchy is the hierarchy of the hash check ticket of restricted keys.
+	//
+	// Default: [tpm2.TPMRHOwner].
+	Hierarchy tpm2.TPMIRHHierarchy
+}
+
+// CheckAndSetDefault validates and sets default values for Options.
+func (o *Options) CheckAndSetDefault() error {
+	if o.Auth == nil {
+		o.Auth = tpmutil.NoAuth
+	}
+	if o.Hierarchy == 0 {
+		o.Hierarchy = tpm2.TPMRHOwner
+	}
+	return nil
+}
+
+// Sign signs data with the key at keyHandle and returns the signature in the
+// encoding of the Go standard library (see [tpmsigner.EncodeSignature]).
+//
+// Data of restricted keys, such as the AK used for quotes, is hashed by the
+// TPM (TPM2_Hash) to obtain the TPMT_TK_HASHCHECK ticket they require; data
+// starting with TPM_GENERATED_VALUE is refused with [tpmhash.ErrNoTicket].
+// Data of unrestricted keys is hashed locally.
+//
+// Example:
+//
+//	sig, err := sign.Sign(tpm, akHandle, data)
+//	if err != nil {
+//	    return err
+//	}
+//	err = rsa.VerifyPKCS1v15(akPub, crypto.SHA256, sha256Digest, sig)
+func Sign(tpm transport.TPM, keyHandle tpmutil.Handle, data []byte, opts ...Options) ([]byte, error) {
+	var o Options
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if err := o.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	if keyHandle == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+	if !keyHandle.HasPublic() {
+		var err error
+		if keyHandle, err = tpmutil.ToHandle(tpm, keyHandle.Handle()); err != nil {
+			return nil, err
+		}
+	}
+	public := keyHandle.Public()
+	if !public.ObjectAttributes.SignEncrypt {
+		return nil, fmt.Errorf("%w: not a signing key", tpmsigner.ErrUnsupportedKey)
+	}
+	scheme, hash, err := signatureScheme(public, &o)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig *tpm2.TPMTSignature
+	if public.ObjectAttributes.Restricted {
+		sig, err = tpmhash.Sign(tpm, data, tpmhash.SignConfig{
+			KeyHandle: keyHandle,
+			Auth:      o.Auth,
+			Scheme:    scheme,
+			Hierarchy: o.Hierarchy,
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		h := hash.New()
+		h.Write(data)
+		rsp, err := tpm2.Sign{
+			KeyHandle:  tpmutil.ToAuthHandle(keyHandle, o.Auth),
+			Digest:     tpm2.TPM2BDigest{Buffer: h.Sum(nil)},
+			InScheme:   scheme,
+			Validation: tpmutil.NullTicket,
+		}.Execute(tpm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign: %w", err)
+		}
+		sig = &rsp.Signature
+	}
+	return tpmsigner.EncodeSignature(*sig)
+}
+
+// signatureScheme returns the scheme and hash signing with the key: the key
+// scheme when it has one, else the scheme selected by o.
+func signatureScheme(public *tpm2.TPMTPublic, o *Options) (tpm2.TPMTSigScheme, crypto.Hash, error) {
+	keyScheme, keyHash, err := tpmcrypto.GetSigSchemeAndHashFromPublic(*public)
+	if err != nil {
+		return tpm2.TPMTSigScheme{}, 0, err
+	}
+	if keyScheme != tpm2.TPMAlgNull {
+		hash, err := keyHash.Hash()
+		if err != nil {
+			return tpm2.TPMTSigScheme{}, 0, err
+		}
+		if o.Hash != 0 && o.Hash != hash {
+			return tpm2.TPMTSigScheme{}, 0, fmt.Errorf("%w: key only signs with hash %v", tpmsigner.ErrUnsupportedKey, hash)
+		}
+		return tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull}, hash, nil
+	}
+
+	hash := o.Hash
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+	pub, err := tpmcrypto.PublicKey(public)
+	if err != nil {
+		return tpm2.TPMTSigScheme{}, 0, fmt.Errorf("%w: %v", tpmsigner.ErrUnsupportedKey, err)
+	}
+	var signerOpts crypto.SignerOpts = hash
+	if o.PSS {
+		signerOpts = &rsa.PSSOptions{Hash: hash}
+	}
+	scheme, err := tpmcrypto.GetSigSchemeFromPublicKey(pub, signerOpts)
+	if err != nil {
+		return tpm2.TPMTSigScheme{}, 0, err
+	}
+	return scheme, hash, nil
+}
@@ -0,0 +1,102 @@
+package sign_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/sign"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/tpmhash"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+	"github.com/stretchr/testify/require"
+)
+
+func signingTemplate(keyType tpm2.TPMAlgID) tpm2.TPMTPublic {
+	if keyType == tpm2.TPMAlgRSA {
+		return templates.RSASigner()
+	}
+	return templates.ECCSigner(templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256))
+}
+
+func TestSign(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	ak := testutil.NewFixtures(t, thetpm).AK(t)
+	auth := []byte("key-password")
+	rsaKey, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: signingTemplate(tpm2.TPMAlgRSA),
+		UserAuth: auth,
+	})
+	require.NoError(t, err)
+	defer rsaKey.Close()
+	eccKey, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: signingTemplate(tpm2.TPMAlgECC),
+	})
+	require.NoError(t, err)
+	defer eccKey.Close()
+
+	data := []byte("data to sign")
+	digest256 := sha256.Sum256(data)
+	digest384 := sha512.Sum384(data)
+
+	for _, tt := range []struct {
+		name   string
+		key    tpmutil.Handle
+		opts   sign.Options
+		verify func(pub crypto.PublicKey, sig []byte) error
+	}{
+		{"restricted AK", ak, sign.Options{}, func(pub crypto.PublicKey, sig []byte) error {
+			return rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, digest256[:], sig)
+		}},
+		{"RSASSA SHA384", rsaKey, sign.Options{Auth: tpm2.PasswordAuth(auth), Hash: crypto.SHA384}, func(pub crypto.PublicKey, sig []byte) error {
+			return rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA384, digest384[:], sig)
+		}},
+		{"RSAPSS", rsaKey, sign.Options{Auth: tpm2.PasswordAuth(auth), PSS: true}, func(pub crypto.PublicKey, sig []byte) error {
+			return rsa.VerifyPSS(pub.(*rsa.PublicKey), crypto.SHA256, digest256[:], sig, nil)
+		}},
+		{"ECDSA", eccKey, sign.Options{}, func(pub crypto.PublicKey, sig []byte) error {
+			if !ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest256[:], sig) {
+				return rsa.ErrVerification
+			}
+			return nil
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := sign.Sign(thetpm, tt.key, data, tt.opts)
+			require.NoError(t, err)
+			pub, err := tpmcrypto.PublicKey(tt.key.Public())
+			require.NoError(t, err)
+			require.NoError(t, tt.verify(pub, sig))
+		})
+	}
+
+	t.Run("TPM_GENERATED_VALUE", func(t *testing.T) {
+		generated := []byte{0xff, 'T', 'C', 'G', 'f', 'o', 'r', 'g', 'e', 'd'}
+		_, err := sign.Sign(thetpm, ak, generated)
+		require.ErrorIs(t, err, tpmhash.ErrNoTicket)
+		// Unrestricted keys sign anything.
+		_, err = sign.Sign(thetpm, eccKey, generated)
+		require.NoError(t, err)
+	})
+
+	t.Run("hash of the key scheme", func(t *testing.T) {
+		_, err := sign.Sign(thetpm, ak, data, sign.Options{Hash: crypto.SHA384})
+		require.ErrorIs(t, err, tpmsigner.ErrUnsupportedKey)
+	})
+
+	t.Run("persistent handle", func(t *testing.T) {
+		// The public area is read from the TPM.
+		sig, err := sign.Sign(thetpm, tpmutil.NewHandle(ak.Handle()), data)
+		require.NoError(t, err)
+		pub, err := tpmcrypto.PublicKey(ak.Public())
+		require.NoError(t, err)
+		require.NoError(t, rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, digest256[:], sig))
+	})
+}
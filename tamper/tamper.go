@@ -0,0 +1,288 @@
+// Package tamper detects a swapped TPM or an upgraded TPM firmware: [Take]
+// records the identity of the TPM, its fixed properties and its EK, in a
+// record signed by the caller and kept locally, e.g. at provisioning, and
+// [Check] compares the TPM with the record on the next startups.
+//
+// The record is signed with a key of the caller, e.g. a TPM key through the
+// tpmsigner package, so that an attacker swapping the TPM can't replace the
+// record as well: its public key must be kept apart from the record.
+package tamper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/capability"
+	"github.com/loicsikidi/tpm-stuff/ekcert"
+	"github.com/loicsikidi/tpm-stuff/nv"
+)
+
+var (
+	// ErrInvalidSignature is returned by [Signed.Verify] for records whose
+	// signature doesn't verify with the expected key.
+	ErrInvalidSignature = errors.New("invalid record signature")
+	// ErrUnsupportedKey is returned for keys other than RSA and ECDSA.
+	ErrUnsupportedKey = errors.New("unsupported key")
+)
+
+// Config holds configuration for [Take] and [Check].
+type Config struct {
+	// EKTemplate is the template of the EK whose Name is recorded.
+	//
+	// Default: the RSA EK template of the TCG EK Credential Profile (L-1),
+	// whose certificate is recorded as well.
+	EKTemplate *ekcert.Template
+	// EndorsementAuth authorizes the creation of the EK in the endorsement
+	// hierarchy.
+	//
+	// Default: nil, an empty authorization value.
+	EndorsementAuth []byte
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	if c.EKTemplate == nil {
+		c.EKTemplate = &ekcert.Templates[0]
+	}
+	return nil
+}
+
+// Record is the identity of a TPM.
+type Record struct {
+	// Manufacturer is the vendor ID of the TPM, e.g. "IFX".
+	Manufacturer string `json:"manufacturer"`
+	// VendorString is the vendor-defined description of the TPM.
+	VendorString string `json:"vendor_string"`
+	// FirmwareVersion is the firmware version in dotted form.
+	FirmwareVersion string `json:"firmware_version"`
+	// Family and Revision are the version of the specification implemented
+	// by the TPM, e.g. "2.0" and 159.
+	Family   string `json:"family"`
+	Revision uint32 `json:"revision"`
+	// EKName is the Name of the EK, unique to the TPM.
+	EKName []byte `json:"ek_name"`
+	// EKCertificate is the hex encoded SHA-256 digest of the EK certificate,
+	// if the TPM holds one.
+	EKCertificate string `json:"ek_certificate,omitempty"`
+	// TakenAt is the time the record was taken.
+	TakenAt time.Time `json:"taken_at"`
+}
+
+// Take records the identity of the TPM. The EK is created from its template
+// and flushed, and its certificate read from its NV index if it is defined.
+//
+// Example, at provisioning:
+//
+//	record, err := tamper.Take(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	signed, err := tamper.Sign(record, signer)
+//	if err != nil {
+//	    return err
+//	}
+//	data, err := json.Marshal(signed)
+func Take(tpm transport.TPM, optionalCfg ...Config) (*Record, error) {
+	cfg := Config{}
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+
+	fixed, err := capability.FixedProperties(tpm)
+	if err != nil {
+		return nil, err
+	}
+	ek, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: tpm2.TPMRHEndorsement,
+		InPublic:      cfg.EKTemplate.Public,
+		Auth:          tpm2.PasswordAuth(cfg.EndorsementAuth),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create EK: %w", err)
+	}
+	defer ek.Close() //nolint:errcheck
+
+	r := &Record{
+		Manufacturer:    fixed.Manufacturer,
+		VendorString:    fixed.VendorString,
+		FirmwareVersion: fixed.FirmwareVersionString(),
+		Family:          fixed.Family,
+		Revision:        fixed.Revision,
+		EKName:          ek.Name().Buffer,
+		TakenAt:         time.Now().UTC(),
+	}
+	data, err := readEKCertificate(tpm, cfg.EKTemplate.CertIndex)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		sum := sha256.Sum256(data)
+		r.EKCertificate = hex.EncodeToString(sum[:])
+	}
+	return r, nil
+}
+
+// readEKCertificate returns the EK certificate at index, or nil if the index
+// isn't defined.
+func readEKCertificate(tpm transport.TPM, index tpm2.TPMHandle) ([]byte, error) {
+	idx, err := nv.Open(tpm, index)
+	if errors.Is(err, tpm2.TPMRCHandle) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := nv.Read(tpm, idx, tpm2.PasswordAuth(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EK certificate: %w", err)
+	}
+	cert, err := ekcert.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return cert.Raw, nil
+}
+
+// Change is a property of the TPM which differs from the record.
+type Change struct {
+	// Property is the name of the property, e.g. "firmware_version".
+	Property string `json:"property"`
+	// Recorded and Current are the values of the property in the record and
+	// on the TPM.
+	Recorded string `json:"recorded"`
+	Current  string `json:"current"`
+}
+
+// Report is the result of the comparison of a TPM with its record.
+type Report struct {
+	// Swapped reports that the TPM isn't the recorded one: its EK or its
+	// manufacturer changed.
+	Swapped bool `json:"swapped"`
+	// FirmwareUpgraded reports that the firmware version of the TPM changed.
+	FirmwareUpgraded bool `json:"firmware_upgraded"`
+	// Changes are the properties which differ from the record.
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Changed reports whether the TPM differs from the record.
+func (r *Report) Changed() bool {
+	return len(r.Changes) > 0
+}
+
+// Compare compares current, the identity of the TPM, with recorded.
+func Compare(recorded, current *Record) *Report {
+	report := &Report{}
+	diff := func(property, old, cur string) bool {
+		if old == cur {
+			return false
+		}
+		report.Changes = append(report.Changes, Change{Property: property, Recorded: old, Current: cur})
+		return true
+	}
+	if diff("manufacturer", recorded.Manufacturer, current.Manufacturer) {
+		report.Swapped = true
+	}
+	diff("vendor_string", recorded.VendorString, current.VendorString)
+	if diff("firmware_version", recorded.FirmwareVersion, current.FirmwareVersion) {
+		report.FirmwareUpgraded = true
+	}
+	diff("family", recorded.Family, current.Family)
+	diff("revision", fmt.Sprint(recorded.Revision), fmt.Sprint(current.Revision))
+	if diff("ek_name", hex.EncodeToString(recorded.EKName), hex.EncodeToString(current.EKName)) {
+		report.Swapped = true
+	}
+	// A new EK certificate for the same EK may be a renewal by the
+	// manufacturer: the change is reported without more.
+	diff("ek_certificate", recorded.EKCertificate, current.EKCertificate)
+	return report
+}
+
+// Check verifies the signature of signed with pub, then compares the TPM with
+// the record.
+//
+// Example, on startup:
+//
+//	report, err := tamper.Check(tpm, signed, signer.Public())
+//	if err != nil {
+//	    return err
+//	}
+//	if report.Swapped {
+//	    return errors.New("the TPM was swapped")
+//	}
+func Check(tpm transport.TPM, signed *Signed, pub crypto.PublicKey, optionalCfg ...Config) (*Report, error) {
+	recorded, err := signed.Verify(pub)
+	if err != nil {
+		return nil, err
+	}
+	current, err := Take(tpm, optionalCfg...)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(recorded, current), nil
+}
+
+// Signed is a signed [Record].
+//
+// Byte slices are encoded in base64 by encoding/json.
+type Signed struct {
+	// Record is the JSON encoding of the record.
+	Record []byte `json:"record"`
+	// Signature is the signature of the SHA-256 digest of Record: ASN.1
+	// encoded for ECDSA keys, RSASSA-PKCS1-v1_5 for RSA keys.
+	Signature []byte `json:"signature"`
+}
+
+// Sign signs r with signer, an RSA or ECDSA key.
+func Sign(r *Record, signer crypto.Signer) (*Signed, error) {
+	switch signer.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, signer.Public())
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign record: %w", err)
+	}
+	return &Signed{Record: data, Signature: sig}, nil
+}
+
+// Verify checks the signature of s with pub and returns its record.
+func (s *Signed) Verify(pub crypto.PublicKey) (*Record, error) {
+	digest := sha256.Sum256(s.Record)
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], s.Signature) != nil {
+			return nil, ErrInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], s.Signature) {
+			return nil, ErrInvalidSignature
+		}
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+	var r Record
+	if err := json.Unmarshal(s.Record, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode record: %w", err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,112 @@
+package tamper_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"testing"
+
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/tamper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t, testutil.SimulatorConfig{Seed: 1})
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	record, err := tamper.Take(thetpm)
+	require.NoError(t, err)
+	require.NotEmpty(t, record.Manufacturer)
+	require.NotEmpty(t, record.EKName)
+	signed, err := tamper.Sign(record, key)
+	require.NoError(t, err)
+
+	report, err := tamper.Check(thetpm, signed, &key.PublicKey)
+	require.NoError(t, err)
+	require.False(t, report.Changed())
+
+	// Another TPM has another EK.
+	other := testutil.OpenSimulator(t, testutil.SimulatorConfig{Seed: 2})
+	report, err = tamper.Check(other, signed, &key.PublicKey)
+	require.NoError(t, err)
+	require.True(t, report.Swapped)
+	require.False(t, report.FirmwareUpgraded)
+	require.Len(t, report.Changes, 1)
+	require.Equal(t, "ek_name", report.Changes[0].Property)
+	require.Equal(t, hex.EncodeToString(record.EKName), report.Changes[0].Recorded)
+}
+
+func TestCompare(t *testing.T) {
+	recorded := &tamper.Record{
+		Manufacturer:    "IFX",
+		VendorString:    "SLB9670",
+		FirmwareVersion: "7.85.0.0",
+		Family:          "2.0",
+		Revision:        138,
+		EKName:          []byte{0, 0xb, 1},
+	}
+
+	current := *recorded
+	current.FirmwareVersion = "7.86.0.0"
+	current.Revision = 159
+	report := tamper.Compare(recorded, &current)
+	require.False(t, report.Swapped)
+	require.True(t, report.FirmwareUpgraded)
+	require.Equal(t, []tamper.Change{
+		{Property: "firmware_version", Recorded: "7.85.0.0", Current: "7.86.0.0"},
+		{Property: "revision", Recorded: "138", Current: "159"},
+	}, report.Changes)
+
+	current = *recorded
+	current.Manufacturer = "STM"
+	report = tamper.Compare(recorded, &current)
+	require.True(t, report.Swapped)
+
+	current = *recorded
+	current.EKCertificate = "0102"
+	report = tamper.Compare(recorded, &current)
+	require.True(t, report.Changed())
+	require.False(t, report.Swapped)
+}
+
+func TestSign(t *testing.T) {
+	record := &tamper.Record{Manufacturer: "IFX", EKName: []byte{0, 0xb, 1}}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for name, key := range map[string]crypto.Signer{
+		"ecdsa": ecKey,
+		"rsa":   rsaKey,
+	} {
+		t.Run(name, func(t *testing.T) {
+			signed, err := tamper.Sign(record, key)
+			require.NoError(t, err)
+			got, err := signed.Verify(key.Public())
+			require.NoError(t, err)
+			require.Equal(t, record, got)
+
+			tampered := *signed
+			tampered.Record = []byte(`{"manufacturer":"STM"}`)
+			_, err = tampered.Verify(key.Public())
+			require.ErrorIs(t, err, tamper.ErrInvalidSignature)
+		})
+	}
+
+	signed, err := tamper.Sign(record, ecKey)
+	require.NoError(t, err)
+	_, err = signed.Verify(&rsaKey.PublicKey)
+	require.ErrorIs(t, err, tamper.ErrInvalidSignature)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = tamper.Sign(record, edKey)
+	require.ErrorIs(t, err, tamper.ErrUnsupportedKey)
+}
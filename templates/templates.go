@@ -0,0 +1,270 @@
+// Package templates provides named templates for the keys and sealed objects
+// created by this module, instead of TPMT_PUBLIC literals repeated across
+// packages, tests and demos.
+//
+// Every template describes an object generated by the TPM (sensitiveDataOrigin,
+// except for sealed data which is provided by the caller), bound to the TPM and
+// to its parent (fixedTPM, fixedParent) and usable with its authorization
+// value (userWithAuth). Options adjust the defaults:
+//
+//	template := templates.ECCSigner(templates.WithCurve(tpm2.TPMECCNistP384), templates.WithNoDA())
+package templates
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/policy"
+)
+
+// Option modifies a template.
+type Option func(*tpm2.TPMTPublic)
+
+// WithCurve sets the curve of an ECC key.
+//
+// Default: NIST P-256.
+func WithCurve(curve tpm2.TPMECCCurve) Option {
+	return func(t *tpm2.TPMTPublic) {
+		withECC(t, func(ecc *tpm2.TPMSECCParms) {
+			ecc.CurveID = curve
+		})
+	}
+}
+
+// WithKeyBits sets the size of an RSA key.
+//
+// Default: 2048.
+func WithKeyBits(bits tpm2.TPMKeyBits) Option {
+	return func(t *tpm2.TPMTPublic) {
+		withRSA(t, func(rsa *tpm2.TPMSRSAParms) {
+			rsa.KeyBits = bits
+		})
+	}
+}
+
+// WithScheme restricts an asymmetric key to a signing (RSASSA, RSAPSS, ECDSA)
+// or decryption (OAEP, RSAES, ECDH) scheme, with the hash algorithm hash,
+// ignored by RSAES. The TPM rejects a scheme which doesn't match the type or
+// usage of the key.
+//
+// Default: TPM_ALG_NULL, the scheme is chosen at each use, except for [AK].
+func WithScheme(scheme tpm2.TPMAlgID, hash tpm2.TPMIAlgHash) Option {
+	return func(t *tpm2.TPMTPublic) {
+		details := asymScheme(scheme, hash)
+		withRSA(t, func(rsa *tpm2.TPMSRSAParms) {
+			rsa.Scheme = tpm2.TPMTRSAScheme{Scheme: scheme, Details: details}
+		})
+		withECC(t, func(ecc *tpm2.TPMSECCParms) {
+			ecc.Scheme = tpm2.TPMTECCScheme{Scheme: scheme, Details: details}
+		})
+	}
+}
+
+// WithNameAlg sets the hash algorithm computing the name of the object.
+//
+// Default: SHA-256.
+func WithNameAlg(alg tpm2.TPMIAlgHash) Option {
+	return func(t *tpm2.TPMTPublic) {
+		t.NameAlg = alg
+	}
+}
+
+// WithNoDA exempts the object from the dictionary attack protection: failed
+// authorizations don't count towards the lockout. Only suitable for high
+// entropy authorization values.
+func WithNoDA() Option {
+	return func(t *tpm2.TPMTPublic) {
+		t.ObjectAttributes.NoDA = true
+	}
+}
+
+// WithPolicy sets the authorization policy of the object, which is then only
+// usable through a policy session satisfying digest: the authorization value
+// alone is no longer enough (userWithAuth is cleared).
+func WithPolicy(digest []byte) Option {
+	return func(t *tpm2.TPMTPublic) {
+		t.AuthPolicy = tpm2.TPM2BDigest{Buffer: digest}
+		t.ObjectAttributes.UserWithAuth = false
+	}
+}
+
+// WithCommands restricts the object to the commands ccs, up to 8, e.g. a key
+// which can only TPM2_Sign: its policy is policy.CommandsPolicy, which also
+// requires the authorization value, and both the user and admin roles
+// require it (userWithAuth is cleared, adminWithPolicy is set). Other
+// commands, including TPM2_Duplicate for a duplicable object, are denied.
+//
+// The object is used through a policy session satisfying
+// policy.SatisfyCommand. The policy is computed with the name algorithm of
+// the template: WithNameAlg must be applied first.
+//
+// It panics if ccs is empty, holds more than 8 commands or duplicates.
+func WithCommands(ccs ...tpm2.TPMCC) Option {
+	return func(t *tpm2.TPMTPublic) {
+		digest, err := policy.CommandsPolicy(t.NameAlg, ccs...)
+		if err != nil {
+			panic(fmt.Sprintf("templates: invalid commands: %v", err))
+		}
+		t.AuthPolicy = tpm2.TPM2BDigest{Buffer: digest}
+		t.ObjectAttributes.UserWithAuth = false
+		t.ObjectAttributes.AdminWithPolicy = true
+	}
+}
+
+// ECCSigner is an unrestricted ECC P-256 signing key, e.g. for
+// [crypto.Signer] implementations.
+func ECCSigner(opts ...Option) tpm2.TPMTPublic {
+	return apply(eccKey(tpm2.TPMAObject{SignEncrypt: true}), opts)
+}
+
+// ECCDecrypter is an unrestricted ECC P-256 decryption key, usable for ECDH
+// (TPM2_ECDH_ZGen) and as the salt key of sessions.
+func ECCDecrypter(opts ...Option) tpm2.TPMTPublic {
+	return apply(eccKey(tpm2.TPMAObject{Decrypt: true}), opts)
+}
+
+// RSASigner is an unrestricted RSA-2048 signing key.
+func RSASigner(opts ...Option) tpm2.TPMTPublic {
+	return apply(rsaKey(tpm2.TPMAObject{SignEncrypt: true}), opts)
+}
+
+// RSADecrypter is an unrestricted RSA-2048 decryption key, usable as the
+// salt key of sessions.
+func RSADecrypter(opts ...Option) tpm2.TPMTPublic {
+	return apply(rsaKey(tpm2.TPMAObject{Decrypt: true}), opts)
+}
+
+// AK is the Attestation Key: a restricted RSA-2048 signing key using RSASSA
+// with SHA-256, which only signs digests computed by the TPM (quotes,
+// certifications).
+func AK(opts ...Option) tpm2.TPMTPublic {
+	t := rsaKey(tpm2.TPMAObject{SignEncrypt: true, Restricted: true})
+	WithScheme(tpm2.TPMAlgRSASSA, tpm2.TPMAlgSHA256)(&t)
+	return apply(t, opts)
+}
+
+// Seal is a sealed data object: the data, up to 128 bytes, is provided in the
+// sensitive area at creation and read back with TPM2_Unseal.
+func Seal(opts ...Option) tpm2.TPMTPublic {
+	return apply(tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgKeyedHash,
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			FixedTPM:     true,
+			FixedParent:  true,
+			UserWithAuth: true,
+		},
+		Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgKeyedHash, &tpm2.TPMSKeyedHashParms{
+			Scheme: tpm2.TPMTKeyedHashScheme{Scheme: tpm2.TPMAlgNull},
+		}),
+	}, opts)
+}
+
+// HMACKey is an HMAC key using hash, also the name algorithm of the key. The
+// key is imported or provided at creation (sensitiveDataOrigin is cleared),
+// so that the same HMAC can be computed outside of the TPM.
+func HMACKey(hash tpm2.TPMIAlgHash, opts ...Option) tpm2.TPMTPublic {
+	return apply(tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgKeyedHash,
+		NameAlg: hash,
+		ObjectAttributes: tpm2.TPMAObject{
+			SignEncrypt:  true,
+			FixedTPM:     true,
+			FixedParent:  true,
+			UserWithAuth: true,
+		},
+		Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgKeyedHash, &tpm2.TPMSKeyedHashParms{
+			Scheme: tpm2.TPMTKeyedHashScheme{
+				Scheme:  tpm2.TPMAlgHMAC,
+				Details: tpm2.NewTPMUSchemeKeyedHash(tpm2.TPMAlgHMAC, &tpm2.TPMSSchemeHMAC{HashAlg: hash}),
+			},
+		}),
+	}, opts)
+}
+
+// eccKey is an ECC P-256 key generated by the TPM, with usage attrs.
+func eccKey(attrs tpm2.TPMAObject) tpm2.TPMTPublic {
+	attrs.FixedTPM = true
+	attrs.FixedParent = true
+	attrs.SensitiveDataOrigin = true
+	attrs.UserWithAuth = true
+	return tpm2.TPMTPublic{
+		Type:             tpm2.TPMAlgECC,
+		NameAlg:          tpm2.TPMAlgSHA256,
+		ObjectAttributes: attrs,
+		Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+			Symmetric: tpm2.TPMTSymDefObject{Algorithm: tpm2.TPMAlgNull},
+			Scheme:    tpm2.TPMTECCScheme{Scheme: tpm2.TPMAlgNull},
+			CurveID:   tpm2.TPMECCNistP256,
+			KDF:       tpm2.TPMTKDFScheme{Scheme: tpm2.TPMAlgNull},
+		}),
+	}
+}
+
+// rsaKey is an RSA-2048 key generated by the TPM, with usage attrs.
+func rsaKey(attrs tpm2.TPMAObject) tpm2.TPMTPublic {
+	attrs.FixedTPM = true
+	attrs.FixedParent = true
+	attrs.SensitiveDataOrigin = true
+	attrs.UserWithAuth = true
+	return tpm2.TPMTPublic{
+		Type:             tpm2.TPMAlgRSA,
+		NameAlg:          tpm2.TPMAlgSHA256,
+		ObjectAttributes: attrs,
+		Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgRSA, &tpm2.TPMSRSAParms{
+			Symmetric: tpm2.TPMTSymDefObject{Algorithm: tpm2.TPMAlgNull},
+			Scheme:    tpm2.TPMTRSAScheme{Scheme: tpm2.TPMAlgNull},
+			KeyBits:   2048,
+		}),
+	}
+}
+
+// asymScheme returns the details of an asymmetric scheme.
+func asymScheme(scheme tpm2.TPMAlgID, hash tpm2.TPMIAlgHash) tpm2.TPMUAsymScheme {
+	switch scheme {
+	case tpm2.TPMAlgRSASSA:
+		return tpm2.NewTPMUAsymScheme(scheme, &tpm2.TPMSSigSchemeRSASSA{HashAlg: hash})
+	case tpm2.TPMAlgRSAPSS:
+		return tpm2.NewTPMUAsymScheme(scheme, &tpm2.TPMSSigSchemeRSAPSS{HashAlg: hash})
+	case tpm2.TPMAlgECDSA:
+		return tpm2.NewTPMUAsymScheme(scheme, &tpm2.TPMSSigSchemeECDSA{HashAlg: hash})
+	case tpm2.TPMAlgOAEP:
+		return tpm2.NewTPMUAsymScheme(scheme, &tpm2.TPMSEncSchemeOAEP{HashAlg: hash})
+	case tpm2.TPMAlgRSAES:
+		return tpm2.NewTPMUAsymScheme(scheme, &tpm2.TPMSEncSchemeRSAES{})
+	case tpm2.TPMAlgECDH:
+		return tpm2.NewTPMUAsymScheme(scheme, &tpm2.TPMSKeySchemeECDH{HashAlg: hash})
+	}
+	return tpm2.TPMUAsymScheme{}
+}
+
+// withECC applies f to a copy of the ECC parameters of t, if any. The union
+// holds the parameters by pointer, shared by the copies of t: they are never
+// modified in place.
+func withECC(t *tpm2.TPMTPublic, f func(*tpm2.TPMSECCParms)) {
+	ecc, err := t.Parameters.ECCDetail()
+	if err != nil {
+		return
+	}
+	clone := *ecc
+	f(&clone)
+	t.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &clone)
+}
+
+// withRSA is [withECC] for the RSA parameters of t.
+func withRSA(t *tpm2.TPMTPublic, f func(*tpm2.TPMSRSAParms)) {
+	rsa, err := t.Parameters.RSADetail()
+	if err != nil {
+		return
+	}
+	clone := *rsa
+	f(&clone)
+	t.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgRSA, &clone)
+}
+
+func apply(t tpm2.TPMTPublic, opts []Option) tpm2.TPMTPublic {
+	for _, opt := range opts {
+		opt(&t)
+	}
+	return t
+}
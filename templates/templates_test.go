@@ -0,0 +1,99 @@
+package templates_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplates(t *testing.T) {
+	tpm := testutil.OpenSimulator(t)
+	srk := testutil.NewFixtures(t, tpm).SRK(t)
+
+	for _, tc := range []struct {
+		name     string
+		template tpm2.TPMTPublic
+		data     []byte
+	}{
+		{"ECCSigner", templates.ECCSigner(), nil},
+		{"ECCDecrypter", templates.ECCDecrypter(), nil},
+		{"RSASigner", templates.RSASigner(), nil},
+		{"RSADecrypter", templates.RSADecrypter(), nil},
+		{"AK", templates.AK(), nil},
+		{"Seal", templates.Seal(), []byte("secret")},
+		{"HMACKey", templates.HMACKey(tpm2.TPMAlgSHA256), []byte("hmac-key")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tpm2.Create{
+				ParentHandle: tpmutil.ToAuthHandle(srk),
+				InSensitive: tpm2.TPM2BSensitiveCreate{
+					Sensitive: &tpm2.TPMSSensitiveCreate{
+						Data: tpm2.NewTPMUSensitiveCreate(&tpm2.TPM2BSensitiveData{Buffer: tc.data}),
+					},
+				},
+				InPublic: tpm2.New2B(tc.template),
+			}.Execute(tpm)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAK(t *testing.T) {
+	// The AK is persisted by the provisioning: a change of its template
+	// changes its name, and the provisioned AKs no longer match.
+	ak := templates.AK()
+	name, err := tpm2.ObjectName(&ak)
+	require.NoError(t, err)
+	require.Equal(t, "000b1e60188db7ff1d3ba644a29a79da5f3ed3c4ced03a0b768b277fb922d8887719", hex.EncodeToString(name.Buffer))
+}
+
+func TestOptions(t *testing.T) {
+	template := templates.ECCSigner(
+		templates.WithCurve(tpm2.TPMECCNistP384),
+		templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA384),
+		templates.WithNameAlg(tpm2.TPMAlgSHA384),
+		templates.WithNoDA(),
+	)
+	ecc, err := template.Parameters.ECCDetail()
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMECCNistP384, ecc.CurveID)
+	ecdsa, err := ecc.Scheme.Details.ECDSA()
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMAlgSHA384, ecdsa.HashAlg)
+	require.Equal(t, tpm2.TPMAlgSHA384, template.NameAlg)
+	require.True(t, template.ObjectAttributes.NoDA)
+
+	decrypter := templates.RSADecrypter(templates.WithKeyBits(3072))
+	rsa, err := decrypter.Parameters.RSADetail()
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMKeyBits(3072), rsa.KeyBits)
+
+	// Options don't leak from one template to the next.
+	template = templates.ECCSigner()
+	ecc, err = template.Parameters.ECCDetail()
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMECCNistP256, ecc.CurveID)
+
+	// Options don't leak to the copies of a template either.
+	p384 := template
+	templates.WithCurve(tpm2.TPMECCNistP384)(&p384)
+	templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA384)(&p384)
+	ecc, err = template.Parameters.ECCDetail()
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMECCNistP256, ecc.CurveID)
+	require.Equal(t, tpm2.TPMAlgNull, ecc.Scheme.Scheme)
+	rsa4096 := decrypter
+	templates.WithKeyBits(4096)(&rsa4096)
+	rsa, err = decrypter.Parameters.RSADetail()
+	require.NoError(t, err)
+	require.Equal(t, tpm2.TPMKeyBits(3072), rsa.KeyBits)
+
+	sealed := templates.Seal(templates.WithPolicy([]byte("digest")))
+	require.Equal(t, []byte("digest"), sealed.AuthPolicy.Buffer)
+	require.False(t, sealed.ObjectAttributes.UserWithAuth)
+}
@@ -0,0 +1,206 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+)
+
+// ErrInvalidTemplate is returned by [Validate] for a template which the TPM
+// would reject.
+var ErrInvalidTemplate = errors.New("invalid template")
+
+// Validate checks pub for the mistakes the TPM only reports as a bare
+// response code (TPM_RC_ATTRIBUTES, TPM_RC_SCHEME, TPM_RC_HASH...) when the
+// object is created, and returns a descriptive error for each of them.
+//
+// Validate doesn't check what depends on the TPM, such as the supported
+// curves and algorithms: a valid template can still be rejected.
+//
+// Example:
+//
+//	if err := templates.Validate(pub); err != nil {
+//	    return err // e.g. "invalid template: HMAC scheme without a hash algorithm"
+//	}
+func Validate(pub tpm2.TPMTPublic) error {
+	var errs []error
+	if isNull(pub.NameAlg) {
+		errs = append(errs, invalidf("missing name algorithm"))
+	} else if h, err := pub.NameAlg.Hash(); err != nil {
+		errs = append(errs, invalidf("name algorithm %v isn't a hash algorithm", tpmjson.AlgID(pub.NameAlg)))
+	} else if n := len(pub.AuthPolicy.Buffer); n != 0 && n != h.Size() {
+		errs = append(errs, invalidf("policy digest of %d bytes, expected %d bytes for name algorithm %v", n, h.Size(), tpmjson.AlgID(pub.NameAlg)))
+	}
+
+	attrs := pub.ObjectAttributes
+	if attrs.FixedTPM && !attrs.FixedParent {
+		errs = append(errs, invalidf("fixedTPM requires fixedParent"))
+	}
+	if attrs.Restricted && attrs.SignEncrypt && attrs.Decrypt {
+		errs = append(errs, invalidf("restricted key can't both sign and decrypt"))
+	}
+
+	switch pub.Type {
+	case tpm2.TPMAlgKeyedHash:
+		errs = append(errs, validateKeyedHash(pub)...)
+	case tpm2.TPMAlgRSA, tpm2.TPMAlgECC:
+		errs = append(errs, validateAsym(pub)...)
+	case tpm2.TPMAlgSymCipher:
+		if _, err := pub.Parameters.SymDetail(); err != nil {
+			errs = append(errs, invalidf("parameters don't match type %v", tpmjson.AlgID(pub.Type)))
+		}
+	default:
+		errs = append(errs, invalidf("unsupported type %v", tpmjson.AlgID(pub.Type)))
+	}
+	return errors.Join(errs...)
+}
+
+// validateKeyedHash checks the scheme of a keyedhash object against its
+// usage: sealed data, HMAC key or XOR key.
+func validateKeyedHash(pub tpm2.TPMTPublic) []error {
+	params, err := pub.Parameters.KeyedHashDetail()
+	if err != nil {
+		return []error{invalidf("parameters don't match type %v", tpmjson.AlgID(pub.Type))}
+	}
+	attrs := pub.ObjectAttributes
+	scheme := params.Scheme
+	var errs []error
+	switch {
+	case !attrs.SignEncrypt && !attrs.Decrypt:
+		if !isNull(scheme.Scheme) {
+			errs = append(errs, invalidf("sealed data (neither sign nor decrypt) with scheme %v, expected null", tpmjson.AlgID(scheme.Scheme)))
+		}
+		if attrs.SensitiveDataOrigin {
+			errs = append(errs, invalidf("sealed data is provided by the caller: sensitiveDataOrigin must be clear"))
+		}
+	case scheme.Scheme == tpm2.TPMAlgHMAC:
+		if attrs.Decrypt {
+			errs = append(errs, invalidf("HMAC scheme on a decryption key"))
+		}
+		if hmac, err := scheme.Details.HMAC(); err != nil || !isHash(hmac.HashAlg) {
+			errs = append(errs, invalidf("HMAC scheme without a hash algorithm"))
+		}
+	case scheme.Scheme == tpm2.TPMAlgXOR:
+		if attrs.SignEncrypt {
+			errs = append(errs, invalidf("XOR scheme on a signing key"))
+		}
+		if xor, err := scheme.Details.XOR(); err != nil || !isHash(xor.HashAlg) {
+			errs = append(errs, invalidf("XOR scheme without a hash algorithm"))
+		}
+	case !isNull(scheme.Scheme):
+		errs = append(errs, invalidf("unsupported keyedhash scheme %v", tpmjson.AlgID(scheme.Scheme)))
+	case attrs.Restricted:
+		errs = append(errs, invalidf("restricted keyedhash key without a scheme"))
+	}
+	return errs
+}
+
+// validateAsym checks the symmetric algorithm, the scheme and the size of an
+// RSA or ECC key against its usage.
+func validateAsym(pub tpm2.TPMTPublic) []error {
+	var (
+		symmetric tpm2.TPMTSymDefObject
+		scheme    tpm2.TPMAlgID
+		details   tpm2.TPMUAsymScheme
+		signing   []tpm2.TPMAlgID
+		decrypt   []tpm2.TPMAlgID
+		errs      []error
+	)
+
+	if rsa, err := pub.Parameters.RSADetail(); err == nil && pub.Type == tpm2.TPMAlgRSA {
+		symmetric, scheme, details = rsa.Symmetric, rsa.Scheme.Scheme, rsa.Scheme.Details
+		signing = []tpm2.TPMAlgID{tpm2.TPMAlgRSASSA, tpm2.TPMAlgRSAPSS}
+		decrypt = []tpm2.TPMAlgID{tpm2.TPMAlgOAEP, tpm2.TPMAlgRSAES}
+		switch rsa.KeyBits {
+		case 1024, 2048, 3072, 4096:
+		default:
+			errs = append(errs, invalidf("RSA key of %d bits", rsa.KeyBits))
+		}
+	} else if ecc, err := pub.Parameters.ECCDetail(); err == nil && pub.Type == tpm2.TPMAlgECC {
+		symmetric, scheme, details = ecc.Symmetric, ecc.Scheme.Scheme, ecc.Scheme.Details
+		signing = []tpm2.TPMAlgID{tpm2.TPMAlgECDSA, tpm2.TPMAlgECDAA, tpm2.TPMAlgSM2, tpm2.TPMAlgECSchnorr}
+		decrypt = []tpm2.TPMAlgID{tpm2.TPMAlgECDH, tpm2.TPMAlgECMQV}
+	}
+	if signing == nil {
+		return []error{invalidf("parameters don't match type %v", tpmjson.AlgID(pub.Type))}
+	}
+
+	attrs := pub.ObjectAttributes
+	storage := attrs.Restricted && attrs.Decrypt
+	switch {
+	case !attrs.SignEncrypt && !attrs.Decrypt:
+		errs = append(errs, invalidf("%v key must sign or decrypt", tpmjson.AlgID(pub.Type)))
+	case storage && isNull(symmetric.Algorithm):
+		errs = append(errs, invalidf("restricted decryption key (storage key) without a symmetric algorithm"))
+	case !storage && !isNull(symmetric.Algorithm):
+		errs = append(errs, invalidf("symmetric algorithm %v on a key which isn't a storage key", tpmjson.AlgID(symmetric.Algorithm)))
+	}
+
+	if isNull(scheme) {
+		if attrs.Restricted && attrs.SignEncrypt {
+			errs = append(errs, invalidf("restricted signing key without a scheme"))
+		}
+		return errs
+	}
+	switch {
+	case storage:
+		errs = append(errs, invalidf("scheme %v on a storage key, expected null", tpmjson.AlgID(scheme)))
+	case attrs.SignEncrypt && attrs.Decrypt:
+		errs = append(errs, invalidf("scheme %v on a key which both signs and decrypts, expected null", tpmjson.AlgID(scheme)))
+	case attrs.SignEncrypt && !slices.Contains(signing, scheme):
+		errs = append(errs, invalidf("scheme %v isn't a %v signing scheme", tpmjson.AlgID(scheme), tpmjson.AlgID(pub.Type)))
+	case attrs.Decrypt && !slices.Contains(decrypt, scheme):
+		errs = append(errs, invalidf("scheme %v isn't a %v decryption scheme", tpmjson.AlgID(scheme), tpmjson.AlgID(pub.Type)))
+	}
+	if hash, ok := schemeHash(scheme, details); ok && !isHash(hash) {
+		errs = append(errs, invalidf("scheme %v without a hash algorithm", tpmjson.AlgID(scheme)))
+	}
+	return errs
+}
+
+// schemeHash returns the hash algorithm of an asymmetric scheme, if it has
+// one: zero when the details don't match the scheme.
+func schemeHash(scheme tpm2.TPMAlgID, details tpm2.TPMUAsymScheme) (tpm2.TPMIAlgHash, bool) {
+	switch scheme {
+	case tpm2.TPMAlgRSASSA:
+		if s, err := details.RSASSA(); err == nil {
+			return s.HashAlg, true
+		}
+	case tpm2.TPMAlgRSAPSS:
+		if s, err := details.RSAPSS(); err == nil {
+			return s.HashAlg, true
+		}
+	case tpm2.TPMAlgOAEP:
+		if s, err := details.OAEP(); err == nil {
+			return s.HashAlg, true
+		}
+	case tpm2.TPMAlgECDSA:
+		if s, err := details.ECDSA(); err == nil {
+			return s.HashAlg, true
+		}
+	default:
+		// The ECDH accessor of go-tpm checks the wrong selector: the hash
+		// algorithm of ECDH isn't checked.
+		return 0, false
+	}
+	return 0, true
+}
+
+// isNull reports whether alg is TPM_ALG_NULL, which go-tpm also marshals
+// for zero values.
+func isNull(alg tpm2.TPMAlgID) bool {
+	return alg == 0 || alg == tpm2.TPMAlgNull
+}
+
+func isHash(alg tpm2.TPMIAlgHash) bool {
+	_, err := alg.Hash()
+	return err == nil
+}
+
+// invalidf returns an [ErrInvalidTemplate] error.
+func invalidf(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrInvalidTemplate}, args...)...)
+}
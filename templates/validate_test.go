@@ -0,0 +1,118 @@
+package templates_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	for _, pub := range []tpm2.TPMTPublic{
+		templates.ECCSigner(),
+		templates.ECCDecrypter(templates.WithScheme(tpm2.TPMAlgECDH, tpm2.TPMAlgSHA256)),
+		templates.RSASigner(templates.WithScheme(tpm2.TPMAlgRSAPSS, tpm2.TPMAlgSHA384)),
+		templates.RSADecrypter(templates.WithScheme(tpm2.TPMAlgRSAES, tpm2.TPMAlgNull)),
+		templates.AK(),
+		templates.Seal(templates.WithPolicy(make([]byte, 32))),
+		templates.HMACKey(tpm2.TPMAlgSHA384),
+		tpmutil.ECCSRKTemplate,
+		tpmutil.RSASRKTemplate,
+	} {
+		require.NoError(t, templates.Validate(pub))
+	}
+}
+
+func TestValidate_Invalid(t *testing.T) {
+	tpm := testutil.OpenSimulator(t)
+
+	for _, tc := range []struct {
+		name string
+		pub  tpm2.TPMTPublic
+		want string
+	}{
+		{
+			name: "missing name algorithm",
+			pub:  templates.ECCSigner(templates.WithNameAlg(tpm2.TPMAlgNull)),
+			want: "missing name algorithm",
+		},
+		{
+			name: "policy size",
+			pub:  templates.ECCSigner(templates.WithPolicy([]byte("digest"))),
+			want: "policy digest of 6 bytes, expected 32 bytes",
+		},
+		{
+			name: "fixedTPM without fixedParent",
+			pub:  templates.ECCSigner(func(p *tpm2.TPMTPublic) { p.ObjectAttributes.FixedParent = false }),
+			want: "fixedTPM requires fixedParent",
+		},
+		{
+			name: "restricted sign and decrypt",
+			pub:  templates.AK(func(p *tpm2.TPMTPublic) { p.ObjectAttributes.Decrypt = true }),
+			want: "restricted key can't both sign and decrypt",
+		},
+		{
+			// The algNullTemplate of the hmac tests.
+			name: "HMAC without hash",
+			pub: templates.HMACKey(tpm2.TPMAlgNull, templates.WithNameAlg(tpm2.TPMAlgSHA256), func(p *tpm2.TPMTPublic) {
+				p.ObjectAttributes.SensitiveDataOrigin = true
+			}),
+			want: "HMAC scheme without a hash algorithm",
+		},
+		{
+			name: "sealed data generated by the TPM",
+			pub:  templates.Seal(func(p *tpm2.TPMTPublic) { p.ObjectAttributes.SensitiveDataOrigin = true }),
+			want: "sensitiveDataOrigin must be clear",
+		},
+		{
+			name: "neither sign nor decrypt",
+			pub:  templates.RSASigner(func(p *tpm2.TPMTPublic) { p.ObjectAttributes.SignEncrypt = false }),
+			want: "key must sign or decrypt",
+		},
+		{
+			name: "restricted signing key without scheme",
+			pub:  templates.RSASigner(func(p *tpm2.TPMTPublic) { p.ObjectAttributes.Restricted = true }),
+			want: "restricted signing key without a scheme",
+		},
+		{
+			name: "storage key without symmetric",
+			pub:  templates.ECCDecrypter(func(p *tpm2.TPMTPublic) { p.ObjectAttributes.Restricted = true }),
+			want: "storage key) without a symmetric algorithm",
+		},
+		{
+			name: "signing scheme on decryption key",
+			pub:  templates.RSADecrypter(templates.WithScheme(tpm2.TPMAlgRSASSA, tpm2.TPMAlgSHA256)),
+			want: "isn't a rsa decryption scheme",
+		},
+		{
+			name: "scheme on sign and decrypt key",
+			pub: templates.RSASigner(templates.WithScheme(tpm2.TPMAlgRSASSA, tpm2.TPMAlgSHA256), func(p *tpm2.TPMTPublic) {
+				p.ObjectAttributes.Decrypt = true
+			}),
+			want: "both signs and decrypts",
+		},
+		{
+			name: "scheme without hash",
+			pub:  templates.ECCSigner(templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgNull)),
+			want: "scheme ecdsa without a hash algorithm",
+		},
+		{
+			name: "RSA key size",
+			pub:  templates.RSASigner(templates.WithKeyBits(1000)),
+			want: "RSA key of 1000 bits",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := templates.Validate(tc.pub)
+			require.ErrorIs(t, err, templates.ErrInvalidTemplate)
+			require.ErrorContains(t, err, tc.want)
+
+			// Validate only reports what the TPM rejects.
+			_, err = tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{InPublic: tc.pub})
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,303 @@
+// Package tpmecdh performs ECDH key agreements with TPM-resident keys: the
+// TPM computes the shared secret (TPM2_ECDH_ZGen) from the public point of a
+// peer, so the private key never leaves it.
+package tpmecdh
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/unbound"
+	"github.com/loicsikidi/tpm-stuff/templates"
+)
+
+// ErrCurveMismatch is returned when the peer public key isn't on the curve of
+// the TPM key.
+var ErrCurveMismatch = errors.New("peer key is on another curve")
+
+// curves maps the TPM curves to their crypto/ecdh implementation.
+var curves = map[tpm2.TPMECCCurve]ecdh.Curve{
+	tpm2.TPMECCNistP256: ecdh.P256(),
+	tpm2.TPMECCNistP384: ecdh.P384(),
+	tpm2.TPMECCNistP521: ecdh.P521(),
+}
+
+// KeyTemplate returns the template of an unrestricted ECC decryption key on
+// curve, usable with TPM2_ECDH_ZGen but not for signing.
+func KeyTemplate(curve tpm2.TPMECCCurve) (tpm2.TPMTPublic, error) {
+	if _, ok := curves[curve]; !ok {
+		return tpm2.TPMTPublic{}, fmt.Errorf("unsupported curve %v", curve)
+	}
+	unique, err := tpmcrypto.NewECCKeyUnique(curve)
+	if err != nil {
+		return tpm2.TPMTPublic{}, err
+	}
+	template := templates.ECCDecrypter(
+		templates.WithCurve(curve),
+		templates.WithScheme(tpm2.TPMAlgECDH, tpm2.TPMAlgSHA256),
+		templates.WithNoDA(),
+	)
+	template.Unique = *unique
+	return template, nil
+}
+
+// KeyConfig holds configuration for [CreateKey].
+type KeyConfig struct {
+	// Curve is the curve of the key.
+	//
+	// Default: tpm2.TPMECCNistP256.
+	Curve tpm2.TPMECCCurve
+	// Auth is the authorization value of the key.
+	//
+	// Default: nil.
+	Auth []byte
+	// Hierarchy is the hierarchy of the key.
+	//
+	// Default: tpm2.TPMRHOwner.
+	Hierarchy tpm2.TPMHandle
+}
+
+// CheckAndSetDefault validates and sets default values for KeyConfig.
+func (c *KeyConfig) CheckAndSetDefault() error {
+	if c.Curve == 0 {
+		c.Curve = tpm2.TPMECCNistP256
+	}
+	if c.Hierarchy == 0 {
+		c.Hierarchy = tpm2.TPMRHOwner
+	}
+	return nil
+}
+
+// CreateKey creates an ECDH key (see [KeyTemplate]) as a primary key of the
+// hierarchy of cfg. The caller must close the returned handle.
+//
+// Example:
+//
+//	key, err := tpmecdh.CreateKey(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	defer key.Close()
+func CreateKey(tpm transport.TPM, optionalCfg ...KeyConfig) (tpmutil.HandleCloser, error) {
+	var cfg KeyConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	template, err := KeyTemplate(cfg.Curve)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	key, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: cfg.Hierarchy,
+		InPublic:      template,
+		UserAuth:      cfg.Auth,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ECDH key: %w", err)
+	}
+	return key, nil
+}
+
+// PublicKey returns the crypto/ecdh public key of the TPM public area public,
+// to be sent to the peer.
+func PublicKey(public *tpm2.TPMTPublic) (*ecdh.PublicKey, error) {
+	params, err := public.Parameters.ECCDetail()
+	if err != nil {
+		return nil, fmt.Errorf("not an ECC key: %w", err)
+	}
+	curve, ok := curves[params.CurveID]
+	if !ok {
+		return nil, fmt.Errorf("unsupported curve %v", params.CurveID)
+	}
+	point, err := public.Unique.ECC()
+	if err != nil {
+		return nil, fmt.Errorf("not an ECC key: %w", err)
+	}
+	raw, err := encodePoint(curve, point)
+	if err != nil {
+		return nil, err
+	}
+	return curve.NewPublicKey(raw)
+}
+
+// KDF holds the parameters of the KDFe derivation (NIST SP 800-56A
+// concatenation KDF, as specified by the TPM) of the shared key.
+type KDF struct {
+	// Hash is the hash of the KDF.
+	//
+	// Default: crypto.SHA256.
+	Hash crypto.Hash
+	// Use is the label of the derived key.
+	//
+	// Default: "ECDH".
+	Use string
+	// PartyUInfo and PartyVInfo identify the parties, e.g. the X coordinates
+	// of their public keys.
+	PartyUInfo, PartyVInfo []byte
+	// Size is the size of the derived key in bytes.
+	//
+	// Default: 32.
+	Size int
+}
+
+// CheckAndSetDefault validates and sets default values for KDF.
+func (k *KDF) CheckAndSetDefault() error {
+	if k.Hash == 0 {
+		k.Hash = crypto.SHA256
+	}
+	if !k.Hash.Available() {
+		return fmt.Errorf("unavailable hash %v", k.Hash)
+	}
+	if k.Use == "" {
+		k.Use = "ECDH"
+	}
+	if k.Size == 0 {
+		k.Size = 32
+	}
+	if k.Size < 0 {
+		return fmt.Errorf("invalid key size %d", k.Size)
+	}
+	return nil
+}
+
+// Derive derives the shared key from the shared secret z. The software peer
+// calls it with the output of (*ecdh.PrivateKey).ECDH and the same KDF.
+func (k KDF) Derive(z []byte) ([]byte, error) {
+	if err := k.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid KDF: %w", err)
+	}
+	return tpm2.KDFe(k.Hash, z, k.Use, k.PartyUInfo, k.PartyVInfo, 8*k.Size), nil
+}
+
+// Config holds configuration for [ZGen] and [SharedKey].
+type Config struct {
+	// Auth is the authorization value of the key.
+	//
+	// Default: nil.
+	Auth []byte
+	// Session returns the session authorizing TPM2_ECDH_ZGen.
+	//
+	// Default: unbound.Unbound with Auth, which encrypts the shared secret
+	// on the bus.
+	Session func() tpm2.Session
+	// KDF derives the shared key of [SharedKey].
+	KDF KDF
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	if c.Session == nil {
+		auth := c.Auth
+		c.Session = func() tpm2.Session {
+			return unbound.Unbound(auth)
+		}
+	}
+	return c.KDF.CheckAndSetDefault()
+}
+
+// ZGen returns the ECDH shared secret of the TPM key keyHandle and peer: the X
+// coordinate of the shared point, as returned by (*ecdh.PrivateKey).ECDH.
+//
+// Example:
+//
+//	z, err := tpmecdh.ZGen(tpm, key, peerPub)
+func ZGen(tpm transport.TPM, keyHandle tpmutil.Handle, peer *ecdh.PublicKey, optionalCfg ...Config) ([]byte, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if keyHandle == nil {
+		return nil, tpmutil.ErrMissingHandle
+	}
+	if peer == nil {
+		return nil, errors.New("missing peer public key")
+	}
+	if !keyHandle.HasPublic() {
+		var err error
+		if keyHandle, err = tpmutil.ToHandle(tpm, keyHandle.Handle()); err != nil {
+			return nil, err
+		}
+	}
+	pub, err := PublicKey(keyHandle.Public())
+	if err != nil {
+		return nil, err
+	}
+	if pub.Curve() != peer.Curve() {
+		return nil, ErrCurveMismatch
+	}
+
+	// Uncompressed point: 0x04 || X || Y.
+	raw := peer.Bytes()
+	size := (len(raw) - 1) / 2
+	rsp, err := tpm2.ECDHZGen{
+		KeyHandle: tpmutil.ToAuthHandle(keyHandle, cfg.Session()),
+		InPoint: tpm2.New2B(tpm2.TPMSECCPoint{
+			X: tpm2.TPM2BECCParameter{Buffer: raw[1 : 1+size]},
+			Y: tpm2.TPM2BECCParameter{Buffer: raw[1+size:]},
+		}),
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute ECDH shared secret: %w", err)
+	}
+	point, err := rsp.OutPoint.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse shared point: %w", err)
+	}
+	if len(point.X.Buffer) > size {
+		return nil, errors.New("invalid shared point")
+	}
+	z := make([]byte, size)
+	copy(z[size-len(point.X.Buffer):], point.X.Buffer)
+	return z, nil
+}
+
+// SharedKey returns the key derived with the KDF of cfg from the ECDH shared
+// secret of keyHandle and peer (see [ZGen]).
+//
+// Example:
+//
+//	kdf := tpmecdh.KDF{Use: "file encryption", Size: 32}
+//	key, err := tpmecdh.SharedKey(tpm, keyHandle, peerPub, tpmecdh.Config{KDF: kdf})
+//	// peer side:
+//	z, err := peerPriv.ECDH(tpmPub)
+//	key, err := kdf.Derive(z)
+func SharedKey(tpm transport.TPM, keyHandle tpmutil.Handle, peer *ecdh.PublicKey, optionalCfg ...Config) ([]byte, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	z, err := ZGen(tpm, keyHandle, peer, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.KDF.Derive(z)
+}
+
+// encodePoint returns the uncompressed encoding of point on curve, padding
+// the coordinates to the size of the curve.
+func encodePoint(curve ecdh.Curve, point *tpm2.TPMSECCPoint) ([]byte, error) {
+	size := map[ecdh.Curve]int{ecdh.P256(): 32, ecdh.P384(): 48, ecdh.P521(): 66}[curve]
+	if len(point.X.Buffer) > size || len(point.Y.Buffer) > size {
+		return nil, errors.New("invalid ECC point")
+	}
+	raw := make([]byte, 1+2*size)
+	raw[0] = 4
+	copy(raw[1+size-len(point.X.Buffer):1+size], point.X.Buffer)
+	copy(raw[1+2*size-len(point.Y.Buffer):], point.Y.Buffer)
+	return raw, nil
+}
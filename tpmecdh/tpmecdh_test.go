@@ -0,0 +1,80 @@
+package tpmecdh_test
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/tpmecdh"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedKey(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	for _, tt := range []struct {
+		name  string
+		curve tpm2.TPMECCCurve
+		peer  ecdh.Curve
+	}{
+		{"P-256", tpm2.TPMECCNistP256, ecdh.P256()},
+		{"P-384", tpm2.TPMECCNistP384, ecdh.P384()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := []byte("ecdh-key")
+			key, err := tpmecdh.CreateKey(thetpm, tpmecdh.KeyConfig{Curve: tt.curve, Auth: auth})
+			require.NoError(t, err)
+			defer key.Close()
+			tpmPub, err := tpmecdh.PublicKey(key.Public())
+			require.NoError(t, err)
+
+			peer, err := tt.peer.GenerateKey(rand.Reader)
+			require.NoError(t, err)
+
+			// Both sides compute the same shared secret...
+			z, err := tpmecdh.ZGen(thetpm, key, peer.PublicKey(), tpmecdh.Config{Auth: auth})
+			require.NoError(t, err)
+			peerZ, err := peer.ECDH(tpmPub)
+			require.NoError(t, err)
+			require.Equal(t, peerZ, z)
+
+			// ... and derive the same key.
+			kdf := tpmecdh.KDF{
+				Use:        "test",
+				PartyUInfo: tpmPub.Bytes(),
+				PartyVInfo: peer.PublicKey().Bytes(),
+				Size:       16,
+			}
+			shared, err := tpmecdh.SharedKey(thetpm, key, peer.PublicKey(), tpmecdh.Config{Auth: auth, KDF: kdf})
+			require.NoError(t, err)
+			peerShared, err := kdf.Derive(peerZ)
+			require.NoError(t, err)
+			require.Len(t, shared, 16)
+			require.Equal(t, peerShared, shared)
+
+			other, err := kdf.Derive(append([]byte{1}, peerZ[1:]...))
+			require.NoError(t, err)
+			require.NotEqual(t, shared, other)
+		})
+	}
+}
+
+func TestZGen_Errors(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	key, err := tpmecdh.CreateKey(thetpm)
+	require.NoError(t, err)
+	defer key.Close()
+
+	peer, err := ecdh.P384().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = tpmecdh.ZGen(thetpm, key, peer.PublicKey())
+	require.ErrorIs(t, err, tpmecdh.ErrCurveMismatch)
+
+	peer, err = ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = tpmecdh.ZGen(thetpm, key, peer.PublicKey(), tpmecdh.Config{Auth: []byte("wrong")})
+	require.ErrorIs(t, err, tpm2.TPMRCBadAuth)
+}
@@ -0,0 +1,333 @@
+// Package tpmhash hashes data with the TPM (TPM2_Hash and hash sequences),
+// returning along with the digest the TPMT_TK_HASHCHECK ticket restricted
+// signing keys require to sign it.
+//
+// The TPM only issues a ticket when the data doesn't start with
+// TPM_GENERATED_VALUE: a restricted key can't be tricked into signing a
+// forged TPM structure, such as a quote.
+package tpmhash
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/capability"
+)
+
+var (
+	// ErrNoTicket is returned by [Sign] when the TPM issued a NULL ticket:
+	// the data starts with TPM_GENERATED_VALUE and restricted keys refuse it.
+	ErrNoTicket = errors.New("TPM issued no hash check ticket")
+	// ErrSequenceDone is returned when using a sequence already completed or closed.
+	ErrSequenceDone = errors.New("hash sequence already completed")
+)
+
+// Config holds configuration for [Hash] and [Start].
+type Config struct {
+	// HashAlg is the hash algorithm.
+	//
+	// Default: [tpm2.TPMAlgSHA256].
+	HashAlg tpm2.TPMIAlgHash
+	// Hierarchy is the hierarchy whose proof authenticates the ticket.
+	// [tpm2.TPMRHNull] produces a NULL ticket.
+	//
+	// Default: [tpm2.TPMRHOwner].
+	Hierarchy tpm2.TPMIRHHierarchy
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	if c.HashAlg == 0 {
+		c.HashAlg = tpm2.TPMAlgSHA256
+	}
+	if c.Hierarchy == 0 {
+		c.Hierarchy = tpm2.TPMRHOwner
+	}
+	return nil
+}
+
+// Result is a digest computed by the TPM.
+type Result struct {
+	// Digest is the hash of the data.
+	Digest []byte
+	// Validation is the ticket proving the TPM computed Digest from data not
+	// starting with TPM_GENERATED_VALUE.
+	Validation tpm2.TPMTTKHashCheck
+}
+
+// HasTicket reports whether the TPM issued a ticket, rather than a NULL one.
+func (r *Result) HasTicket() bool {
+	return r.Validation.Hierarchy != tpm2.TPMRHNull
+}
+
+// Hash hashes data with the TPM: a single TPM2_Hash when data fits in the
+// TPM input buffer, a hash sequence otherwise.
+//
+// Example:
+//
+//	res, err := tpmhash.Hash(tpm, data)
+//	if err != nil {
+//	    return err
+//	}
+//	fmt.Printf("digest: %x\n", res.Digest)
+func Hash(tpm transport.TPM, data []byte, optionalCfg ...Config) (*Result, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	chunk, err := inputBufferSize(tpm)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > chunk {
+		seq, err := Start(tpm, cfg)
+		if err != nil {
+			return nil, err
+		}
+		defer seq.Close()
+		if _, err := seq.Write(data); err != nil {
+			return nil, err
+		}
+		return seq.Finish()
+	}
+
+	rsp, err := tpm2.Hash{
+		Data:      tpm2.TPM2BMaxBuffer{Buffer: data},
+		HashAlg:   cfg.HashAlg,
+		Hierarchy: cfg.Hierarchy,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash: %w", err)
+	}
+	return &Result{Digest: rsp.OutHash.Buffer, Validation: rsp.Validation}, nil
+}
+
+// Sequence is a TPM hash sequence, fed through [Sequence.Write] in as many
+// TPM2_SequenceUpdate calls as required. It occupies a transient object slot
+// until [Sequence.Finish] or [Sequence.Close].
+type Sequence struct {
+	tpm   transport.TPM
+	cfg   Config
+	seq   tpm2.AuthHandle
+	chunk int
+	done  bool
+}
+
+// Start starts a hash sequence.
+//
+// Example:
+//
+//	seq, err := tpmhash.Start(tpm)
+//	if err != nil {
+//	    return err
+//	}
+//	defer seq.Close()
+//	if _, err := io.Copy(seq, file); err != nil {
+//	    return err
+//	}
+//	res, err := seq.Finish()
+func Start(tpm transport.TPM, optionalCfg ...Config) (*Sequence, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	chunk, err := inputBufferSize(tpm)
+	if err != nil {
+		return nil, err
+	}
+	auth := tpmutil.MustGenerateRnd(16)
+	rsp, err := tpm2.HashSequenceStart{
+		Auth:    tpm2.TPM2BAuth{Buffer: auth},
+		HashAlg: cfg.HashAlg,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start hash sequence: %w", err)
+	}
+	return &Sequence{
+		tpm: tpm,
+		cfg: cfg,
+		seq: tpm2.AuthHandle{
+			Handle: rsp.SequenceHandle,
+			Auth:   tpm2.PasswordAuth(auth),
+		},
+		chunk: chunk,
+	}, nil
+}
+
+// Write implements [io.Writer].
+func (s *Sequence) Write(p []byte) (int, error) {
+	if s.done {
+		return 0, ErrSequenceDone
+	}
+	for written := 0; written < len(p); {
+		n := min(s.chunk, len(p)-written)
+		_, err := tpm2.SequenceUpdate{
+			SequenceHandle: s.seq,
+			Buffer:         tpm2.TPM2BMaxBuffer{Buffer: p[written : written+n]},
+		}.Execute(s.tpm)
+		if err != nil {
+			return written, fmt.Errorf("failed to update hash sequence: %w", err)
+		}
+		written += n
+	}
+	return len(p), nil
+}
+
+// Finish completes the sequence, which the TPM flushes, and returns the
+// digest of the written data with its ticket.
+func (s *Sequence) Finish() (*Result, error) {
+	if s.done {
+		return nil, ErrSequenceDone
+	}
+	rsp, err := tpm2.SequenceComplete{
+		SequenceHandle: s.seq,
+		Hierarchy:      s.cfg.Hierarchy,
+	}.Execute(s.tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete hash sequence: %w", err)
+	}
+	s.done = true
+	return &Result{Digest: rsp.Result.Buffer, Validation: rsp.Validation}, nil
+}
+
+// Close flushes the sequence if it wasn't completed.
+func (s *Sequence) Close() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	if _, err := (tpm2.FlushContext{FlushHandle: s.seq.Handle}).Execute(s.tpm); err != nil {
+		return fmt.Errorf("failed to flush hash sequence: %w", err)
+	}
+	return nil
+}
+
+// SignConfig holds configuration for [Sign].
+type SignConfig struct {
+	// KeyHandle is the handle of the signing key.
+	//
+	// Required.
+	KeyHandle tpmutil.Handle
+	// Auth is the authorization session for the key.
+	//
+	// Default: [tpmutil.NoAuth].
+	Auth tpm2.Session
+	// Scheme is the signature scheme. It must match the scheme of the key
+	// unless the key has none.
+	//
+	// Default: the scheme of the key.
+	Scheme tpm2.TPMTSigScheme
+	// Hierarchy is the hierarchy of the ticket.
+	//
+	// Default: [tpm2.TPMRHOwner].
+	Hierarchy tpm2.TPMIRHHierarchy
+}
+
+// CheckAndSetDefault validates and sets default values for SignConfig.
+func (c *SignConfig) CheckAndSetDefault() error {
+	if c.KeyHandle == nil {
+		return tpmutil.ErrMissingHandle
+	}
+	if c.Auth == nil {
+		c.Auth = tpmutil.NoAuth
+	}
+	if c.Scheme.Scheme == 0 {
+		c.Scheme.Scheme = tpm2.TPMAlgNull
+	}
+	if c.Hierarchy == 0 {
+		c.Hierarchy = tpm2.TPMRHOwner
+	}
+	return nil
+}
+
+// Sign hashes data with the TPM, using the hash algorithm of the signature
+// scheme, and signs the digest along with its ticket: unlike a digest hashed
+// outside the TPM, it is accepted by restricted signing keys such as AKs.
+//
+// Example:
+//
+//	sig, err := tpmhash.Sign(tpm, data, tpmhash.SignConfig{KeyHandle: akHandle})
+func Sign(tpm transport.TPM, data []byte, cfg SignConfig) (*tpm2.TPMTSignature, error) {
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	hashAlg, err := schemeHash(tpm, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	res, err := Hash(tpm, data, Config{HashAlg: hashAlg, Hierarchy: cfg.Hierarchy})
+	if err != nil {
+		return nil, err
+	}
+	if !res.HasTicket() {
+		return nil, ErrNoTicket
+	}
+	rsp, err := tpm2.Sign{
+		KeyHandle:  tpmutil.ToAuthHandle(cfg.KeyHandle, cfg.Auth),
+		Digest:     tpm2.TPM2BDigest{Buffer: res.Digest},
+		InScheme:   cfg.Scheme,
+		Validation: res.Validation,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return &rsp.Signature, nil
+}
+
+// schemeHash returns the hash algorithm of the requested scheme, or else of
+// the scheme of the key.
+func schemeHash(tpm transport.TPM, cfg *SignConfig) (tpm2.TPMIAlgHash, error) {
+	if cfg.Scheme.Scheme != tpm2.TPMAlgNull {
+		var details *tpm2.TPMSSchemeHash
+		var err error
+		switch cfg.Scheme.Scheme {
+		case tpm2.TPMAlgRSASSA:
+			details, err = cfg.Scheme.Details.RSASSA()
+		case tpm2.TPMAlgRSAPSS:
+			details, err = cfg.Scheme.Details.RSAPSS()
+		case tpm2.TPMAlgECDSA:
+			details, err = cfg.Scheme.Details.ECDSA()
+		default:
+			return 0, fmt.Errorf("unsupported signature scheme %v", cfg.Scheme.Scheme)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid signature scheme: %w", err)
+		}
+		return details.HashAlg, nil
+	}
+	key := cfg.KeyHandle
+	if !key.HasPublic() {
+		var err error
+		if key, err = tpmutil.ToHandle(tpm, key.Handle()); err != nil {
+			return 0, err
+		}
+	}
+	scheme, hashAlg, err := tpmcrypto.GetSigSchemeAndHashFromPublic(*key.Public())
+	if err != nil {
+		return 0, err
+	}
+	if scheme == tpm2.TPMAlgNull {
+		return 0, errors.New("the key has no signature scheme: a scheme is required")
+	}
+	return hashAlg, nil
+}
+
+// inputBufferSize returns the largest buffer accepted by TPM2_Hash and
+// TPM2_SequenceUpdate (TPM_PT_INPUT_BUFFER).
+func inputBufferSize(tpm transport.TPM) (int, error) {
+	v, err := capability.Property(tpm, tpm2.TPMPTInputBuffer)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get TPM input buffer size: %w", err)
+	}
+	return int(v), nil
+}
@@ -0,0 +1,127 @@
+package tpmhash_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/tpmhash"
+	"github.com/stretchr/testify/require"
+)
+
+// generated starts with TPM_GENERATED_VALUE, as TPM-produced structures do.
+var generated = []byte{0xff, 'T', 'C', 'G', 'f', 'o', 'r', 'g', 'e', 'd'}
+
+func TestHash(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	small := []byte("hello world")
+	large := bytes.Repeat([]byte("0123456789"), 500) // several sequence updates
+	sha384 := func(b []byte) []byte { h := sha512.Sum384(b); return h[:] }
+	sha256 := func(b []byte) []byte { h := sha256.Sum256(b); return h[:] }
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		cfg  tpmhash.Config
+		want []byte
+	}{
+		{"TPM2_Hash", small, tpmhash.Config{}, sha256(small)},
+		{"sequence", large, tpmhash.Config{}, sha256(large)},
+		{"SHA-384", small, tpmhash.Config{HashAlg: tpm2.TPMAlgSHA384}, sha384(small)},
+		{"SHA-384 sequence", large, tpmhash.Config{HashAlg: tpm2.TPMAlgSHA384}, sha384(large)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tpmhash.Hash(thetpm, tt.data, tt.cfg)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, res.Digest)
+			require.True(t, res.HasTicket())
+			require.Equal(t, tpm2.TPMRHOwner, res.Validation.Hierarchy)
+		})
+	}
+
+	t.Run("no ticket", func(t *testing.T) {
+		res, err := tpmhash.Hash(thetpm, generated)
+		require.NoError(t, err)
+		require.Equal(t, sha256(generated), res.Digest)
+		require.False(t, res.HasTicket())
+
+		res, err = tpmhash.Hash(thetpm, small, tpmhash.Config{Hierarchy: tpm2.TPMRHNull})
+		require.NoError(t, err)
+		require.False(t, res.HasTicket())
+	})
+}
+
+func TestSequence(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	seq, err := tpmhash.Start(thetpm)
+	require.NoError(t, err)
+	defer seq.Close()
+
+	h := sha256.New()
+	for range 3 {
+		chunk := bytes.Repeat([]byte{0x42}, 1500)
+		_, err := seq.Write(chunk)
+		require.NoError(t, err)
+		h.Write(chunk)
+	}
+	res, err := seq.Finish()
+	require.NoError(t, err)
+	require.Equal(t, h.Sum(nil), res.Digest)
+	require.True(t, res.HasTicket())
+
+	_, err = seq.Write([]byte("late"))
+	require.ErrorIs(t, err, tpmhash.ErrSequenceDone)
+	_, err = seq.Finish()
+	require.ErrorIs(t, err, tpmhash.ErrSequenceDone)
+	require.NoError(t, seq.Close())
+
+	t.Run("abandoned", func(t *testing.T) {
+		seq, err := tpmhash.Start(thetpm)
+		require.NoError(t, err)
+		_, err = seq.Write([]byte("data"))
+		require.NoError(t, err)
+		require.NoError(t, seq.Close())
+		_, err = seq.Finish()
+		require.ErrorIs(t, err, tpmhash.ErrSequenceDone)
+	})
+}
+
+func TestSign(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	ak := testutil.NewFixtures(t, thetpm).AK(t)
+	pub, err := tpmcrypto.PublicKey(ak.Public())
+	require.NoError(t, err)
+
+	data := []byte("data to sign")
+	digest := sha256.Sum256(data)
+
+	// A digest computed outside the TPM is refused by the restricted key.
+	_, err = tpm2.Sign{
+		KeyHandle:  tpmutil.ToAuthHandle(ak),
+		Digest:     tpm2.TPM2BDigest{Buffer: digest[:]},
+		InScheme:   tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		Validation: tpmutil.NullTicket,
+	}.Execute(thetpm)
+	require.ErrorIs(t, err, tpm2.TPMRCTicket)
+
+	sig, err := tpmhash.Sign(thetpm, data, tpmhash.SignConfig{KeyHandle: ak})
+	require.NoError(t, err)
+	rsassa, err := sig.Signature.RSASSA()
+	require.NoError(t, err)
+	require.NoError(t, rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, digest[:], rsassa.Sig.Buffer))
+
+	t.Run("TPM_GENERATED_VALUE", func(t *testing.T) {
+		_, err := tpmhash.Sign(thetpm, generated, tpmhash.SignConfig{KeyHandle: ak})
+		require.ErrorIs(t, err, tpmhash.ErrNoTicket)
+	})
+
+}
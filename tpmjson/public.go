@@ -0,0 +1,159 @@
+package tpmjson
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/names"
+)
+
+// ErrNameMismatch is returned when decoding a [Public] whose name doesn't
+// match its public area.
+var ErrNameMismatch = names.ErrMismatch
+
+// Public is a [tpm2.TPMTPublic] encoded in JSON as its wire format, along
+// with its type, name algorithm, attributes and name for readability.
+type Public tpm2.TPMTPublic
+
+// publicJSON is the JSON encoding of a [Public].
+type publicJSON struct {
+	Type       AlgID    `json:"type"`
+	NameAlg    AlgID    `json:"name_alg"`
+	Attributes []string `json:"attributes"`
+	Name       []byte   `json:"name,omitempty"`
+	// Public is the marshaled TPMT_PUBLIC.
+	Public []byte `json:"public"`
+}
+
+// MarshalJSON implements [json.Marshaler].
+func (p Public) MarshalJSON() ([]byte, error) {
+	pub := tpm2.TPMTPublic(p)
+	name, err := names.Compute(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute name: %w", err)
+	}
+	return json.Marshal(publicJSON{
+		Type:       AlgID(pub.Type),
+		NameAlg:    AlgID(pub.NameAlg),
+		Attributes: objectAttributes(pub.ObjectAttributes),
+		Name:       name.Buffer,
+		Public:     tpm2.Marshal(pub),
+	})
+}
+
+// UnmarshalJSON implements [json.Unmarshaler]. The name, when present, must
+// match the public area: it is typically compared to a trusted value.
+func (p *Public) UnmarshalJSON(data []byte) error {
+	var v publicJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid public area: %w", err)
+	}
+	pub, err := tpm2.Unmarshal[tpm2.TPMTPublic](v.Public)
+	if err != nil {
+		return fmt.Errorf("failed to decode public area: %w", err)
+	}
+	if len(v.Name) > 0 {
+		if err := names.Verify(v.Name, *pub); err != nil {
+			return err
+		}
+	}
+	*p = Public(*pub)
+	return nil
+}
+
+// objectAttributes returns the names of the attributes set in attrs, as in
+// the TPMA_OBJECT definition.
+func objectAttributes(attrs tpm2.TPMAObject) []string {
+	names := []string{}
+	for _, a := range []struct {
+		set  bool
+		name string
+	}{
+		{attrs.FixedTPM, "fixedTPM"},
+		{attrs.STClear, "stClear"},
+		{attrs.FixedParent, "fixedParent"},
+		{attrs.SensitiveDataOrigin, "sensitiveDataOrigin"},
+		{attrs.UserWithAuth, "userWithAuth"},
+		{attrs.AdminWithPolicy, "adminWithPolicy"},
+		{attrs.FirmwareLimited, "firmwareLimited"},
+		{attrs.NoDA, "noDA"},
+		{attrs.EncryptedDuplication, "encryptedDuplication"},
+		{attrs.Restricted, "restricted"},
+		{attrs.Decrypt, "decrypt"},
+		{attrs.SignEncrypt, "sign"},
+		{attrs.X509Sign, "x509sign"},
+	} {
+		if a.set {
+			names = append(names, a.name)
+		}
+	}
+	return names
+}
+
+// Quote is the output of TPM2_Quote, encoded in JSON as the wire formats of
+// the signed TPMS_ATTEST and of its signature, along with the nonce, the PCR
+// selection and the PCR digest it covers.
+type Quote struct {
+	Quoted    tpm2.TPM2BAttest
+	Signature tpm2.TPMTSignature
+}
+
+// quoteJSON is the JSON encoding of a [Quote].
+type quoteJSON struct {
+	Nonce        []byte       `json:"nonce"`
+	PCRSelection PCRSelection `json:"pcr_selection"`
+	PCRDigest    []byte       `json:"pcr_digest"`
+	SignatureAlg AlgID        `json:"signature_alg"`
+	// Quoted is the marshaled TPMS_ATTEST, as signed.
+	Quoted []byte `json:"quoted"`
+	// Signature is the marshaled TPMT_SIGNATURE.
+	Signature []byte `json:"signature"`
+}
+
+// MarshalJSON implements [json.Marshaler].
+func (q Quote) MarshalJSON() ([]byte, error) {
+	attest, info, err := quoteInfo(q.Quoted)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(quoteJSON{
+		Nonce:        attest.ExtraData.Buffer,
+		PCRSelection: PCRSelection(info.PCRSelect),
+		PCRDigest:    info.PCRDigest.Buffer,
+		SignatureAlg: AlgID(q.Signature.SigAlg),
+		Quoted:       q.Quoted.Bytes(),
+		Signature:    tpm2.Marshal(q.Signature),
+	})
+}
+
+// UnmarshalJSON implements [json.Unmarshaler]. The signature isn't verified.
+func (q *Quote) UnmarshalJSON(data []byte) error {
+	var v quoteJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid quote: %w", err)
+	}
+	quoted := tpm2.BytesAs2B[tpm2.TPMSAttest](v.Quoted)
+	if _, _, err := quoteInfo(quoted); err != nil {
+		return err
+	}
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](v.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	*q = Quote{Quoted: quoted, Signature: *sig}
+	return nil
+}
+
+// quoteInfo decodes quoted, which must hold a quote.
+func quoteInfo(quoted tpm2.TPM2BAttest) (*tpm2.TPMSAttest, *tpm2.TPMSQuoteInfo, error) {
+	attest, err := quoted.Contents()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode attestation: %w", err)
+	}
+	info, err := attest.Attested.Quote()
+	if err != nil {
+		return nil, nil, fmt.Errorf("attestation isn't a quote: %w", err)
+	}
+	return attest, info, nil
+}
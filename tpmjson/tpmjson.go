@@ -0,0 +1,196 @@
+// Package tpmjson provides stable JSON representations of TPM structures,
+// shared by the CLI, the attestation protocol and the sealed blob formats.
+//
+// Buffers are encoded in base64, as encoding/json does for byte slices, and
+// algorithms by their TCG name, lower-cased and without the TPM_ALG_ prefix
+// (e.g. "sha256", "ecc"). The structures whose bytes are signed or hashed,
+// [Public] and [Quote], also carry their TPM wire format: only this part is
+// decoded, the other fields being informative.
+//
+// Example:
+//
+//	type Enrollment struct {
+//	    AK     tpmjson.Public       `json:"ak"`
+//	    Bank   tpmjson.AlgID        `json:"bank"`
+//	    PCRs   tpmjson.PCRSelection `json:"pcrs"`
+//	}
+package tpmjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// algNames are the names of the algorithms, per the TCG Algorithm Registry.
+var algNames = map[tpm2.TPMAlgID]string{
+	tpm2.TPMAlgRSA:          "rsa",
+	tpm2.TPMAlgTDES:         "tdes",
+	tpm2.TPMAlgSHA1:         "sha1",
+	tpm2.TPMAlgHMAC:         "hmac",
+	tpm2.TPMAlgAES:          "aes",
+	tpm2.TPMAlgMGF1:         "mgf1",
+	tpm2.TPMAlgKeyedHash:    "keyedhash",
+	tpm2.TPMAlgXOR:          "xor",
+	tpm2.TPMAlgSHA256:       "sha256",
+	tpm2.TPMAlgSHA384:       "sha384",
+	tpm2.TPMAlgSHA512:       "sha512",
+	tpm2.TPMAlgSHA256192:    "sha256_192",
+	tpm2.TPMAlgNull:         "null",
+	tpm2.TPMAlgSM3256:       "sm3_256",
+	tpm2.TPMAlgSM4:          "sm4",
+	tpm2.TPMAlgRSASSA:       "rsassa",
+	tpm2.TPMAlgRSAES:        "rsaes",
+	tpm2.TPMAlgRSAPSS:       "rsapss",
+	tpm2.TPMAlgOAEP:         "oaep",
+	tpm2.TPMAlgECDSA:        "ecdsa",
+	tpm2.TPMAlgECDH:         "ecdh",
+	tpm2.TPMAlgECDAA:        "ecdaa",
+	tpm2.TPMAlgSM2:          "sm2",
+	tpm2.TPMAlgECSchnorr:    "ecschnorr",
+	tpm2.TPMAlgECMQV:        "ecmqv",
+	tpm2.TPMAlgKDF1SP80056A: "kdf1_sp800_56a",
+	tpm2.TPMAlgKDF2:         "kdf2",
+	tpm2.TPMAlgKDF1SP800108: "kdf1_sp800_108",
+	tpm2.TPMAlgECC:          "ecc",
+	tpm2.TPMAlgSymCipher:    "symcipher",
+	tpm2.TPMAlgCamellia:     "camellia",
+	tpm2.TPMAlgSHA3256:      "sha3_256",
+	tpm2.TPMAlgSHA3384:      "sha3_384",
+	tpm2.TPMAlgSHA3512:      "sha3_512",
+	tpm2.TPMAlgCMAC:         "cmac",
+	tpm2.TPMAlgCTR:          "ctr",
+	tpm2.TPMAlgOFB:          "ofb",
+	tpm2.TPMAlgCBC:          "cbc",
+	tpm2.TPMAlgCFB:          "cfb",
+	tpm2.TPMAlgECB:          "ecb",
+}
+
+// algIDs are the algorithms indexed by name.
+var algIDs = func() map[string]tpm2.TPMAlgID {
+	ids := make(map[string]tpm2.TPMAlgID, len(algNames))
+	for id, name := range algNames {
+		ids[name] = id
+	}
+	return ids
+}()
+
+// AlgID is a [tpm2.TPMAlgID] encoded in JSON by its name, e.g. "sha256".
+// Algorithms without a name are encoded in hexadecimal, e.g. "0x0054".
+//
+// The numeric encoding of [tpm2.TPMAlgID] is accepted when decoding, so that
+// the documents written before this package can still be read.
+type AlgID tpm2.TPMAlgID
+
+// ParseAlgID parses an algorithm name, such as "sha256" or "TPM_ALG_SHA256",
+// or its hexadecimal value, such as "0x000b".
+func ParseAlgID(s string) (AlgID, error) {
+	name := strings.TrimPrefix(strings.ToLower(s), "tpm_alg_")
+	if id, ok := algIDs[name]; ok {
+		return AlgID(id), nil
+	}
+	if hexValue, ok := strings.CutPrefix(name, "0x"); ok {
+		v, err := strconv.ParseUint(hexValue, 16, 16)
+		if err == nil {
+			return AlgID(v), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown algorithm %q", s)
+}
+
+// String returns the name of the algorithm.
+func (a AlgID) String() string {
+	if name, ok := algNames[tpm2.TPMAlgID(a)]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", uint16(a))
+}
+
+// MarshalJSON implements [json.Marshaler].
+func (a AlgID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON implements [json.Unmarshaler].
+func (a *AlgID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var v uint16
+		if json.Unmarshal(data, &v) != nil {
+			return fmt.Errorf("invalid algorithm %s", data)
+		}
+		*a = AlgID(v)
+		return nil
+	}
+	id, err := ParseAlgID(s)
+	if err != nil {
+		return err
+	}
+	*a = id
+	return nil
+}
+
+// Name is a [tpm2.TPM2BName] encoded in JSON as a base64 string.
+type Name tpm2.TPM2BName
+
+// MarshalJSON implements [json.Marshaler].
+func (n Name) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.Buffer)
+}
+
+// UnmarshalJSON implements [json.Unmarshaler].
+func (n *Name) UnmarshalJSON(data []byte) error {
+	var b []byte
+	if err := json.Unmarshal(data, &b); err != nil {
+		return fmt.Errorf("invalid name: %w", err)
+	}
+	*n = Name{Buffer: b}
+	return nil
+}
+
+// PCRSelection is a [tpm2.TPMLPCRSelection] encoded in JSON as a list of
+// banks, e.g. [{"bank":"sha256","pcrs":[0,7]}].
+type PCRSelection tpm2.TPMLPCRSelection
+
+// pcrBank is the JSON encoding of a [tpm2.TPMSPCRSelection].
+type pcrBank struct {
+	Bank AlgID  `json:"bank"`
+	PCRs []uint `json:"pcrs"`
+}
+
+// MarshalJSON implements [json.Marshaler].
+func (s PCRSelection) MarshalJSON() ([]byte, error) {
+	banks := make([]pcrBank, 0, len(s.PCRSelections))
+	for _, sel := range s.PCRSelections {
+		pcrs := []uint{}
+		for i, b := range sel.PCRSelect {
+			for bit := range 8 {
+				if b&(1<<bit) != 0 {
+					pcrs = append(pcrs, uint(8*i+bit))
+				}
+			}
+		}
+		banks = append(banks, pcrBank{Bank: AlgID(sel.Hash), PCRs: pcrs})
+	}
+	return json.Marshal(banks)
+}
+
+// UnmarshalJSON implements [json.Unmarshaler].
+func (s *PCRSelection) UnmarshalJSON(data []byte) error {
+	var banks []pcrBank
+	if err := json.Unmarshal(data, &banks); err != nil {
+		return fmt.Errorf("invalid PCR selection: %w", err)
+	}
+	sel := PCRSelection{}
+	for _, bank := range banks {
+		sel.PCRSelections = append(sel.PCRSelections, tpm2.TPMSPCRSelection{
+			Hash:      tpm2.TPMAlgID(bank.Bank),
+			PCRSelect: tpm2.PCClientCompatible.PCRs(bank.PCRs...),
+		})
+	}
+	*s = sel
+	return nil
+}
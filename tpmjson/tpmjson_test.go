@@ -0,0 +1,103 @@
+package tpmjson_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip encodes v then decodes it into out, and returns the encoding.
+func roundTrip(t *testing.T, v, out any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, out))
+	return string(data)
+}
+
+func TestAlgID(t *testing.T) {
+	var got tpmjson.AlgID
+	require.Equal(t, `"sha256"`, roundTrip(t, tpmjson.AlgID(tpm2.TPMAlgSHA256), &got))
+	require.Equal(t, tpmjson.AlgID(tpm2.TPMAlgSHA256), got)
+	require.Equal(t, `"0x0054"`, roundTrip(t, tpmjson.AlgID(tpm2.TPMAlgEAX), &got))
+	require.Equal(t, tpmjson.AlgID(tpm2.TPMAlgEAX), got)
+
+	for _, s := range []string{"sha384", "SHA384", "TPM_ALG_SHA384", "0x000c"} {
+		id, err := tpmjson.ParseAlgID(s)
+		require.NoError(t, err, s)
+		require.Equal(t, tpmjson.AlgID(tpm2.TPMAlgSHA384), id, s)
+	}
+	_, err := tpmjson.ParseAlgID("md5")
+	require.Error(t, err)
+
+	// The numeric encoding of tpm2.TPMAlgID is still accepted.
+	require.NoError(t, json.Unmarshal([]byte(`11`), &got))
+	require.Equal(t, tpmjson.AlgID(tpm2.TPMAlgSHA256), got)
+	require.Error(t, json.Unmarshal([]byte(`"md5"`), &got))
+}
+
+func TestPCRSelection(t *testing.T) {
+	sel := pcr.Selection(tpm2.TPMAlgSHA256, 0, 7, 16)
+	sel.PCRSelections = append(sel.PCRSelections, pcr.Selection(tpm2.TPMAlgSHA1).PCRSelections...)
+
+	var got tpmjson.PCRSelection
+	data := roundTrip(t, tpmjson.PCRSelection(sel), &got)
+	require.JSONEq(t, `[{"bank":"sha256","pcrs":[0,7,16]},{"bank":"sha1","pcrs":[]}]`, data)
+	require.Equal(t, tpm2.Marshal(sel), tpm2.Marshal(tpm2.TPMLPCRSelection(got)))
+}
+
+func TestPublic(t *testing.T) {
+	tpm := testutil.OpenSimulator(t)
+	ak := testutil.NewFixtures(t, tpm).AK(t)
+
+	var got tpmjson.Public
+	data := roundTrip(t, tpmjson.Public(*ak.Public()), &got)
+	require.Equal(t, tpm2.Marshal(ak.Public()), tpm2.Marshal(tpm2.TPMTPublic(got)))
+
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal([]byte(data), &fields))
+	require.Equal(t, "rsa", fields["type"])
+	require.Equal(t, "sha256", fields["name_alg"])
+	require.Contains(t, fields["attributes"], "restricted")
+
+	// A name which doesn't match the public area is rejected.
+	fields["name"] = []byte("not the name")
+	data2, err := json.Marshal(fields)
+	require.NoError(t, err)
+	require.ErrorIs(t, json.Unmarshal(data2, &got), tpmjson.ErrNameMismatch)
+}
+
+func TestQuote(t *testing.T) {
+	tpm := testutil.OpenSimulator(t)
+	ak := testutil.NewFixtures(t, tpm).AK(t)
+
+	nonce := []byte("nonce")
+	sel := pcr.Selection(tpm2.TPMAlgSHA256, 0, 7)
+	rsp, err := tpm2.Quote{
+		SignHandle:     tpm2.NamedHandle{Handle: ak.Handle(), Name: ak.Name()},
+		QualifyingData: tpm2.TPM2BData{Buffer: nonce},
+		InScheme:       tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		PCRSelect:      sel,
+	}.Execute(tpm)
+	require.NoError(t, err)
+
+	var got tpmjson.Quote
+	data := roundTrip(t, tpmjson.Quote{Quoted: rsp.Quoted, Signature: rsp.Signature}, &got)
+	require.Equal(t, rsp.Quoted.Bytes(), got.Quoted.Bytes())
+	require.Equal(t, tpm2.Marshal(rsp.Signature), tpm2.Marshal(got.Signature))
+
+	var fields struct {
+		Nonce        []byte               `json:"nonce"`
+		PCRSelection tpmjson.PCRSelection `json:"pcr_selection"`
+		SignatureAlg tpmjson.AlgID        `json:"signature_alg"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(data), &fields))
+	require.Equal(t, nonce, fields.Nonce)
+	require.Equal(t, tpm2.Marshal(sel), tpm2.Marshal(tpm2.TPMLPCRSelection(fields.PCRSelection)))
+	require.Equal(t, tpmjson.AlgID(tpm2.TPMAlgRSASSA), fields.SignatureAlg)
+}
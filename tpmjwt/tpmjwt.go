@@ -0,0 +1,281 @@
+// Package tpmjwt signs JSON Web Tokens (RFC 7519) with TPM-resident keys, e.g.
+// workload identity tokens whose signing key is bound to the hardware.
+package tpmjwt
+
+import (
+	"cmp"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+)
+
+// Signature algorithms (RFC 7518, section 3.1).
+const (
+	RS256 = "RS256"
+	PS256 = "PS256"
+	ES256 = "ES256"
+)
+
+// ErrInvalidToken is returned by [Verify] for malformed tokens or invalid
+// signatures.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Config holds configuration for [New].
+type Config struct {
+	// Auth is the authorization value of the key.
+	//
+	// Default: nil.
+	Auth []byte
+	// Session returns the session authorizing each TPM2_Sign.
+	//
+	// Default: tpmsigner.EncryptedSession with Auth.
+	Session func() tpm2.Session
+	// Algorithm is the JWS algorithm: RS256, PS256 or ES256.
+	//
+	// Default: ES256 for ECC keys, PS256 for RSA keys with the RSAPSS
+	// scheme, RS256 for other RSA keys.
+	Algorithm string
+	// KeyID is the "kid" header of the tokens.
+	//
+	// Default: [KeyID] of the key.
+	KeyID string
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	switch c.Algorithm {
+	case "", RS256, PS256, ES256:
+	default:
+		return fmt.Errorf("unsupported algorithm %q", c.Algorithm)
+	}
+	return nil
+}
+
+// Signer signs JWTs with a TPM key.
+//
+// Signer is not safe for concurrent use unless the underlying transport is.
+type Signer struct {
+	signer *tpmsigner.Signer
+	alg    string
+	kid    string
+}
+
+// New returns a [Signer] for the unrestricted signing key keyHandle.
+//
+// Example:
+//
+//	signer, err := tpmjwt.New(tpm, key)
+//	if err != nil {
+//	    return err
+//	}
+//	token, err := signer.Sign(map[string]any{
+//	    "iss": "spiffe://example.org",
+//	    "sub": "spiffe://example.org/workload",
+//	    "exp": time.Now().Add(5 * time.Minute).Unix(),
+//	})
+func New(tpm transport.TPM, keyHandle tpmutil.Handle, optionalCfg ...Config) (*Signer, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if keyHandle != nil && !keyHandle.HasPublic() {
+		var err error
+		if keyHandle, err = tpmutil.ToHandle(tpm, keyHandle.Handle()); err != nil {
+			return nil, err
+		}
+	}
+	signer, err := tpmsigner.New(tpm, tpmsigner.Config{
+		KeyHandle: keyHandle,
+		Auth:      cfg.Auth,
+		Session:   cfg.Session,
+	})
+	if err != nil {
+		return nil, err
+	}
+	public := keyHandle.Public()
+	alg, err := algorithm(*public, signer.Public(), cfg.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	kid := cfg.KeyID
+	if kid == "" {
+		if kid, err = KeyID(public); err != nil {
+			return nil, err
+		}
+	}
+	return &Signer{signer: signer, alg: alg, kid: kid}, nil
+}
+
+// KeyID returns the key ID of the TPM public area public: its Name, base64url
+// encoded. The Name commits to the whole public area (key, attributes and
+// policy), so verifiers can pin the exact TPM key.
+func KeyID(public *tpm2.TPMTPublic) (string, error) {
+	name, err := tpm2.ObjectName(public)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute key name: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(name.Buffer), nil
+}
+
+// Algorithm returns the JWS algorithm of the tokens.
+func (s *Signer) Algorithm() string {
+	return s.alg
+}
+
+// KeyID returns the "kid" header of the tokens.
+func (s *Signer) KeyID() string {
+	return s.kid
+}
+
+// Public returns the public key verifying the tokens.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+// Sign returns the compact serialization of a JWT carrying claims, which are
+// JSON encoded.
+func (s *Signer) Sign(claims any) (string, error) {
+	header, err := json.Marshal(struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+		Kid string `json:"kid,omitempty"`
+	}{s.alg, "JWT", s.kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode claims: %w", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var opts crypto.SignerOpts = crypto.SHA256
+	if s.alg == PS256 {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	}
+	sig, err := s.signer.Sign(nil, digest[:], opts)
+	if err != nil {
+		return "", err
+	}
+	if s.alg == ES256 {
+		// JWS uses R || S, not the ASN.1 encoding.
+		if sig, err = rawECDSA(sig, 32); err != nil {
+			return "", err
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Verify checks the signature of token with pub and decodes its claims into
+// claims. Only RS256, PS256 and ES256 are accepted; the claims themselves
+// (expiration, audience...) are left to the caller.
+func Verify(token string, pub crypto.PublicKey, claims any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("%w: not a compact JWS", ErrInvalidToken)
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	valid := false
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		switch header.Alg {
+		case RS256:
+			valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+		case PS256:
+			valid = rsa.VerifyPSS(key, crypto.SHA256, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg == ES256 && key.Curve == elliptic.P256() && len(sig) == 64 {
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			valid = ecdsa.Verify(key, digest[:], r, s)
+		}
+	}
+	if !valid {
+		return fmt.Errorf("%w: bad %q signature", ErrInvalidToken, header.Alg)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("%w: payload: %v", ErrInvalidToken, err)
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	return nil
+}
+
+// algorithm returns the JWS algorithm of the key, checking that requested is
+// compatible with its type and scheme.
+func algorithm(public tpm2.TPMTPublic, pub crypto.PublicKey, requested string) (string, error) {
+	scheme, hash, err := tpmcrypto.GetSigSchemeAndHashFromPublic(public)
+	if err != nil {
+		return "", err
+	}
+	var alg string
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if key.Curve == elliptic.P256() {
+			alg = ES256
+		}
+	case *rsa.PublicKey:
+		alg = RS256
+		if scheme == tpm2.TPMAlgRSAPSS || (scheme == tpm2.TPMAlgNull && requested == PS256) {
+			alg = PS256
+		}
+	}
+	if alg == "" {
+		return "", fmt.Errorf("%w: no JWS algorithm for the key", tpmsigner.ErrUnsupportedKey)
+	}
+	if (requested != "" && requested != alg) || (scheme != tpm2.TPMAlgNull && hash != tpm2.TPMAlgSHA256) {
+		return "", fmt.Errorf("%w: key can't sign %s tokens", tpmsigner.ErrUnsupportedKey, cmp.Or(requested, alg))
+	}
+	return alg, nil
+}
+
+// rawECDSA converts an ASN.1 ECDSA signature to the fixed size R || S form.
+func rawECDSA(der []byte, size int) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("failed to parse ECDSA signature: %w", err)
+	}
+	raw := make([]byte, 2*size)
+	sig.R.FillBytes(raw[:size])
+	sig.S.FillBytes(raw[size:])
+	return raw, nil
+}
@@ -0,0 +1,93 @@
+package tpmjwt_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/tpmjwt"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+	"github.com/stretchr/testify/require"
+)
+
+func signingTemplate(keyType, scheme tpm2.TPMAlgID) tpm2.TPMTPublic {
+	if keyType == tpm2.TPMAlgRSA {
+		return templates.RSASigner(templates.WithScheme(scheme, tpm2.TPMAlgSHA256))
+	}
+	return templates.ECCSigner(templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256))
+}
+
+type claims struct {
+	Issuer  string `json:"iss"`
+	Subject string `json:"sub"`
+}
+
+func TestSign(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	tests := []struct {
+		name     string
+		template tpm2.TPMTPublic
+		cfg      tpmjwt.Config
+		alg      string
+	}{
+		{"ES256", signingTemplate(tpm2.TPMAlgECC, 0), tpmjwt.Config{}, tpmjwt.ES256},
+		{"RS256", signingTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgNull), tpmjwt.Config{}, tpmjwt.RS256},
+		{"PS256 requested", signingTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgNull), tpmjwt.Config{Algorithm: tpmjwt.PS256}, tpmjwt.PS256},
+		{"PS256 key", signingTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgRSAPSS), tpmjwt.Config{}, tpmjwt.PS256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := []byte("jwt-key")
+			key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tt.template, UserAuth: auth})
+			require.NoError(t, err)
+			defer key.Close()
+
+			cfg := tt.cfg
+			cfg.Auth = auth
+			signer, err := tpmjwt.New(thetpm, key, cfg)
+			require.NoError(t, err)
+			require.Equal(t, tt.alg, signer.Algorithm())
+			require.Equal(t, base64.RawURLEncoding.EncodeToString(key.Name().Buffer), signer.KeyID())
+
+			want := claims{Issuer: "tpm-stuff", Subject: "workload-1"}
+			token, err := signer.Sign(want)
+			require.NoError(t, err)
+
+			header, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+			require.NoError(t, err)
+			require.JSONEq(t, `{"alg":"`+tt.alg+`","typ":"JWT","kid":"`+signer.KeyID()+`"}`, string(header))
+
+			var got claims
+			require.NoError(t, tpmjwt.Verify(token, signer.Public(), &got))
+			require.Equal(t, want, got)
+
+			// Tampering with the claims breaks the signature.
+			parts := strings.Split(token, ".")
+			parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"tpm-stuff","sub":"admin"}`))
+			require.ErrorIs(t, tpmjwt.Verify(strings.Join(parts, "."), signer.Public(), &got), tpmjwt.ErrInvalidToken)
+		})
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: signingTemplate(tpm2.TPMAlgECC, 0)})
+	require.NoError(t, err)
+	defer key.Close()
+
+	_, err = tpmjwt.New(thetpm, key, tpmjwt.Config{Algorithm: tpmjwt.RS256})
+	require.ErrorIs(t, err, tpmsigner.ErrUnsupportedKey)
+
+	_, err = tpmjwt.New(thetpm, key, tpmjwt.Config{Algorithm: "HS256"})
+	require.ErrorContains(t, err, "unsupported algorithm")
+
+	signer, err := tpmjwt.New(thetpm, key, tpmjwt.Config{KeyID: "device-42"})
+	require.NoError(t, err)
+	require.Equal(t, "device-42", signer.KeyID())
+}
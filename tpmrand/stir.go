@@ -0,0 +1,52 @@
+package tpmrand
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// MaxStirSize is the largest input of one TPM2_StirRandom, a
+// TPM2B_SENSITIVE_DATA limited by MAX_SYM_DATA.
+const MaxStirSize = 128
+
+// Stir mixes entropy into the state of the TPM random number generator
+// (TPM2_StirRandom), split in as many commands as required. The TPM adds it
+// to its own entropy: it can't make the generator weaker.
+//
+// go-tpm doesn't implement TPM2_StirRandom, so the command is sent without
+// session: entropy travels in clear on the bus and must not be secret.
+func Stir(tpm transport.TPM, entropy []byte) error {
+	for len(entropy) > 0 {
+		chunk := entropy[:min(len(entropy), MaxStirSize)]
+		entropy = entropy[len(chunk):]
+		if err := stirRandom(tpm, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stirRandom marshals and sends one TPM2_StirRandom.
+func stirRandom(tpm transport.TPM, data []byte) error {
+	var cmd []byte
+	cmd = binary.BigEndian.AppendUint16(cmd, uint16(tpm2.TPMSTNoSessions))
+	cmd = binary.BigEndian.AppendUint32(cmd, uint32(12+len(data)))
+	cmd = binary.BigEndian.AppendUint32(cmd, uint32(tpm2.TPMCCStirRandom))
+	cmd = binary.BigEndian.AppendUint16(cmd, uint16(len(data)))
+	cmd = append(cmd, data...)
+
+	rsp, err := tpm.Send(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to send StirRandom: %w", err)
+	}
+	if len(rsp) < 10 {
+		return fmt.Errorf("StirRandom: short response (%d bytes)", len(rsp))
+	}
+	if rc := tpm2.TPMRC(binary.BigEndian.Uint32(rsp[6:10])); rc != tpm2.TPMRCSuccess {
+		return fmt.Errorf("failed to stir random: %w", rc)
+	}
+	return nil
+}
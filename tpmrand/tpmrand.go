@@ -0,0 +1,107 @@
+// Package tpmrand provides an [io.Reader] of random bytes drawn from the TPM
+// random number generator (TPM2_GetRandom).
+package tpmrand
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/capability"
+)
+
+// Config holds configuration for [New].
+type Config struct {
+	// Session encrypts the random bytes in the GetRandom responses, so they
+	// don't travel in clear on the bus. It must be created with
+	// tpm2.AESEncryption(..., tpm2.EncryptOut) or EncryptInOut, and salted:
+	// the key of an unsalted session without authValue is derived from the
+	// nonces only, which an eavesdropper sees as well.
+	//
+	// Default: nil (random bytes sent in clear).
+	Session tpm2.Session
+	// Mix XORs the TPM random bytes with the operating system ones
+	// (crypto/rand), so the output is as unpredictable as the best of both
+	// sources.
+	//
+	// Default: false.
+	Mix bool
+}
+
+// Reader reads random bytes from a TPM. It is safe for concurrent use.
+type Reader struct {
+	tpm transport.TPM
+	cfg Config
+
+	mu sync.Mutex
+	// chunk is the largest number of bytes returned by one GetRandom, the
+	// size of the largest digest (TPM_PT_MAX_DIGEST). Zero until queried.
+	chunk int
+}
+
+// New returns a Reader drawing random bytes from tpm.
+//
+// Example:
+//
+//	ekHandle, ekPub := ... // see salted.Salted
+//	r := tpmrand.New(tpm, tpmrand.Config{
+//	    Session: tpm2.HMAC(tpm2.TPMAlgSHA256, 16,
+//	        tpm2.Salted(ekHandle, ekPub),
+//	        tpm2.AESEncryption(128, tpm2.EncryptOut)),
+//	})
+//	key := make([]byte, 32)
+//	if _, err := io.ReadFull(r, key); err != nil {
+//	    return err
+//	}
+func New(tpm transport.TPM, optionalCfg ...Config) *Reader {
+	r := &Reader{tpm: tpm}
+	if len(optionalCfg) > 0 {
+		r.cfg = optionalCfg[0]
+	}
+	return r
+}
+
+// Read fills p with random bytes. It returns len(p) unless an error occurs.
+func (r *Reader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.chunk == 0 {
+		v, err := capability.Property(r.tpm, tpm2.TPMPTMaxDigest)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get the maximum random size: %w", err)
+		}
+		r.chunk = int(v)
+	}
+
+	n := 0
+	for n < len(p) {
+		var sessions []tpm2.Session
+		if r.cfg.Session != nil {
+			sessions = append(sessions, r.cfg.Session)
+		}
+		rsp, err := tpm2.GetRandom{BytesRequested: uint16(min(len(p)-n, r.chunk))}.Execute(r.tpm, sessions...)
+		if err != nil {
+			return n, fmt.Errorf("failed to get random bytes: %w", err)
+		}
+		if len(rsp.RandomBytes.Buffer) == 0 {
+			return n, fmt.Errorf("failed to get random bytes: empty response")
+		}
+		// The TPM may return fewer bytes than requested.
+		n += copy(p[n:], rsp.RandomBytes.Buffer)
+	}
+
+	if r.cfg.Mix {
+		os := make([]byte, len(p))
+		if _, err := io.ReadFull(rand.Reader, os); err != nil {
+			return 0, fmt.Errorf("failed to get OS random bytes: %w", err)
+		}
+		for i := range p {
+			p[i] ^= os[i]
+		}
+	}
+	return n, nil
+}
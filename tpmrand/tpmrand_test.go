@@ -0,0 +1,108 @@
+package tpmrand_test
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+	"github.com/loicsikidi/tpm-stuff/tpmrand"
+	"github.com/stretchr/testify/require"
+)
+
+// getRandomCount returns the number of GetRandom commands recorded by wire.
+func getRandomCount(wire *sniffer.Transport) int {
+	n := 0
+	for _, cmd := range wire.Commands() {
+		if tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:])) == tpm2.TPMCCGetRandom {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReader(t *testing.T) {
+	wire := sniffer.New(testutil.OpenSimulator(t))
+	r := tpmrand.New(wire)
+
+	buf := make([]byte, 200)
+	n, err := io.ReadFull(r, buf)
+	require.NoError(t, err)
+	require.Equal(t, len(buf), n)
+	require.NotEqual(t, make([]byte, len(buf)), buf)
+
+	// The simulator returns at most TPM_PT_MAX_DIGEST (64) bytes at once.
+	require.Equal(t, 4, getRandomCount(wire))
+	// Without session, the random bytes are visible on the bus.
+	require.True(t, wire.ReceivedPlaintext(buf[:16]))
+
+	n, err = r.Read(nil)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func TestReader_Session(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	ekRsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHEndorsement,
+		InPublic:      tpm2.New2B(tpm2.RSAEKTemplate),
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	defer tpm2.FlushContext{FlushHandle: ekRsp.ObjectHandle}.Execute(thetpm)
+	ekPub, err := ekRsp.OutPublic.Contents()
+	require.NoError(t, err)
+
+	wire := sniffer.New(thetpm)
+	r := tpmrand.New(wire, tpmrand.Config{
+		Session: tpm2.HMAC(tpm2.TPMAlgSHA256, 16,
+			tpm2.Salted(ekRsp.ObjectHandle, *ekPub),
+			tpm2.AESEncryption(128, tpm2.EncryptOut)),
+	})
+
+	buf := make([]byte, 100)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+	require.Equal(t, 2, getRandomCount(wire))
+	require.False(t, wire.ReceivedPlaintext(buf[:16]))
+	require.False(t, wire.ReceivedPlaintext(buf[64:80]))
+}
+
+func TestReader_Mix(t *testing.T) {
+	wire := sniffer.New(testutil.OpenSimulator(t))
+	r := tpmrand.New(wire, tpmrand.Config{Mix: true})
+
+	buf := make([]byte, 32)
+	_, err := io.ReadFull(r, buf)
+	require.NoError(t, err)
+	require.Equal(t, 1, getRandomCount(wire))
+	// The output differs from the TPM random bytes.
+	require.False(t, wire.ReceivedPlaintext(buf[:16]))
+}
+
+func TestStir(t *testing.T) {
+	wire := sniffer.New(testutil.OpenSimulator(t))
+
+	entropy := make([]byte, 2*tpmrand.MaxStirSize+10)
+	for i := range entropy {
+		entropy[i] = byte(i)
+	}
+	require.NoError(t, tpmrand.Stir(wire, entropy))
+
+	cmds := wire.Commands()
+	require.Len(t, cmds, 3)
+	for i, size := range []int{tpmrand.MaxStirSize, tpmrand.MaxStirSize, 10} {
+		require.Equal(t, tpm2.TPMCCStirRandom, tpm2.TPMCC(binary.BigEndian.Uint32(cmds[i][6:])))
+		require.Len(t, cmds[i], 12+size)
+	}
+
+	// The generator still works.
+	_, err := io.ReadFull(tpmrand.New(wire), make([]byte, 16))
+	require.NoError(t, err)
+
+	wire.Reset()
+	require.NoError(t, tpmrand.Stir(wire, nil))
+	require.Empty(t, wire.Commands())
+}
@@ -0,0 +1,145 @@
+package tpmsigner
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/unbound"
+)
+
+// Decrypter is a [crypto.Decrypter] backed by a TPM RSA key.
+//
+// Decrypter is not safe for concurrent use unless the underlying transport is.
+type Decrypter struct {
+	tpm     transport.TPM
+	handle  tpmutil.Handle
+	public  tpm2.TPMTPublic
+	pub     *rsa.PublicKey
+	session func() tpm2.Session
+}
+
+var _ crypto.Decrypter = (*Decrypter)(nil)
+
+// NewDecrypter returns a [Decrypter] for an unrestricted RSA decryption key.
+//
+// By default the ciphertext and the recovered plaintext are both encrypted
+// on the bus (see unbound.Unbound); a custom Session should keep response
+// encryption enabled for the same reason.
+//
+// Example:
+//
+//	dec, err := tpmsigner.NewDecrypter(tpm, tpmsigner.Config{KeyHandle: keyHandle})
+//	if err != nil {
+//	    return err
+//	}
+//	plaintext, err := dec.Decrypt(nil, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+func NewDecrypter(tpm transport.TPM, cfg Config) (*Decrypter, error) {
+	if cfg.Session == nil {
+		auth := cfg.Auth
+		cfg.Session = func() tpm2.Session {
+			return unbound.Unbound(auth)
+		}
+	}
+	h, public, pub, err := loadKey(tpm, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an RSA key", ErrUnsupportedKey)
+	}
+	if !public.ObjectAttributes.Decrypt {
+		return nil, fmt.Errorf("%w: not a decryption key", ErrUnsupportedKey)
+	}
+	if public.ObjectAttributes.Restricted {
+		return nil, fmt.Errorf("%w: restricted decryption keys are storage keys", ErrUnsupportedKey)
+	}
+	return &Decrypter{
+		tpm:     tpm,
+		handle:  h,
+		public:  *public,
+		pub:     rsaPub,
+		session: cfg.Session,
+	}, nil
+}
+
+// Public returns the public key of the TPM key.
+func (d *Decrypter) Public() crypto.PublicKey {
+	return d.pub
+}
+
+// Decrypt decrypts an RSA-OAEP ciphertext with the TPM key.
+// rand is ignored and opts must be an [*rsa.OAEPOptions].
+//
+// Note: the TPM uses the same hash for OAEP and MGF1, and always terminates a
+// non-empty label with a zero byte. The label must therefore end with 0x00,
+// and be encrypted as such, to interoperate with [rsa.EncryptOAEP].
+func (d *Decrypter) Decrypt(_ io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	oaep, ok := opts.(*rsa.OAEPOptions)
+	if !ok {
+		return nil, fmt.Errorf("unsupported decrypter options %T: only RSA-OAEP is supported", opts)
+	}
+	if oaep.MGFHash != 0 && oaep.MGFHash != oaep.Hash {
+		return nil, errors.New("OAEP MGF1 hash must match the OAEP hash")
+	}
+	if len(oaep.Label) > 0 && !bytes.HasSuffix(oaep.Label, []byte{0}) {
+		return nil, errors.New("OAEP label must be terminated by a zero byte")
+	}
+	hashAlg, err := tpmcrypto.HashToAlgorithm(oaep.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.checkScheme(hashAlg); err != nil {
+		return nil, err
+	}
+
+	rsp, err := tpm2.RSADecrypt{
+		KeyHandle:  tpmutil.ToAuthHandle(d.handle, d.session()),
+		CipherText: tpm2.TPM2BPublicKeyRSA{Buffer: msg},
+		InScheme: tpm2.TPMTRSADecrypt{
+			Scheme: tpm2.TPMAlgOAEP,
+			Details: tpm2.NewTPMUAsymScheme(
+				tpm2.TPMAlgOAEP,
+				&tpm2.TPMSEncSchemeOAEP{
+					HashAlg: hashAlg,
+				},
+			),
+		},
+		Label: tpm2.TPM2BData{Buffer: oaep.Label},
+	}.Execute(d.tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return rsp.Message.Buffer, nil
+}
+
+// checkScheme ensures OAEP with hashAlg is compatible with the scheme fixed by the key, if any.
+func (d *Decrypter) checkScheme(hashAlg tpm2.TPMAlgID) error {
+	rsaDetail, err := d.public.Parameters.RSADetail()
+	if err != nil {
+		return err
+	}
+	switch rsaDetail.Scheme.Scheme {
+	case tpm2.TPMAlgNull:
+		return nil
+	case tpm2.TPMAlgOAEP:
+		oaep, err := rsaDetail.Scheme.Details.OAEP()
+		if err != nil {
+			return err
+		}
+		if oaep.HashAlg != hashAlg {
+			return fmt.Errorf("%w: key only decrypts OAEP with hash %v", ErrUnsupportedKey, oaep.HashAlg)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: key only decrypts with scheme %v", ErrUnsupportedKey, rsaDetail.Scheme.Scheme)
+	}
+}
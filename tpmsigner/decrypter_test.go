@@ -0,0 +1,110 @@
+package tpmsigner_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder keeps a copy of every command and response exchanged with the TPM.
+type recorder struct {
+	transport.TPM
+	traffic [][]byte
+}
+
+func (r *recorder) Send(cmd []byte) ([]byte, error) {
+	rsp, err := r.TPM.Send(cmd)
+	r.traffic = append(r.traffic, bytes.Clone(cmd), bytes.Clone(rsp))
+	return rsp, err
+}
+
+func TestDecrypt(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("key-password")
+	key := createKey(t, thetpm, templates.RSADecrypter(), auth)
+
+	rec := &recorder{TPM: thetpm}
+	dec, err := tpmsigner.NewDecrypter(rec, tpmsigner.Config{KeyHandle: key, Auth: auth})
+	require.NoError(t, err)
+	pub := dec.Public().(*rsa.PublicKey)
+
+	plaintext := []byte("a secret recovered by the TPM")
+	tests := []struct {
+		name string
+		opts *rsa.OAEPOptions
+	}{
+		{"SHA256", &rsa.OAEPOptions{Hash: crypto.SHA256}},
+		{"SHA1", &rsa.OAEPOptions{Hash: crypto.SHA1}},
+		{"SHA256 with label", &rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte("label\x00")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ciphertext, err := rsa.EncryptOAEP(tt.opts.Hash.New(), rand.Reader, pub, plaintext, tt.opts.Label)
+			require.NoError(t, err)
+
+			rec.traffic = nil
+			got, err := dec.Decrypt(nil, ciphertext, tt.opts)
+			require.NoError(t, err)
+			require.Equal(t, plaintext, got)
+
+			// The plaintext never crosses the bus in the clear.
+			for _, b := range rec.traffic {
+				require.False(t, bytes.Contains(b, plaintext))
+			}
+		})
+	}
+}
+
+func TestDecrypt_Errors(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	key := createKey(t, thetpm, templates.RSADecrypter(), nil)
+	dec, err := tpmsigner.NewDecrypter(thetpm, tpmsigner.Config{KeyHandle: key})
+	require.NoError(t, err)
+	pub := dec.Public().(*rsa.PublicKey)
+
+	t.Run("label without terminating zero", func(t *testing.T) {
+		opts := &rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte("label")}
+		ciphertext, err := rsa.EncryptOAEP(opts.Hash.New(), rand.Reader, pub, []byte("secret"), opts.Label)
+		require.NoError(t, err)
+		_, err = dec.Decrypt(nil, ciphertext, opts)
+		require.Error(t, err)
+	})
+
+	t.Run("PKCS#1 v1.5", func(t *testing.T) {
+		_, err := dec.Decrypt(nil, make([]byte, 256), &rsa.PKCS1v15DecryptOptions{})
+		require.Error(t, err)
+	})
+
+	t.Run("tampered ciphertext", func(t *testing.T) {
+		opts := &rsa.OAEPOptions{Hash: crypto.SHA256}
+		ciphertext, err := rsa.EncryptOAEP(opts.Hash.New(), rand.Reader, pub, []byte("secret"), nil)
+		require.NoError(t, err)
+		ciphertext[len(ciphertext)-1] ^= 0xff
+		_, err = dec.Decrypt(nil, ciphertext, opts)
+		require.Error(t, err)
+	})
+
+	t.Run("hash fixed by the key", func(t *testing.T) {
+		template := templates.RSADecrypter(templates.WithScheme(tpm2.TPMAlgOAEP, tpm2.TPMAlgSHA256))
+		key := createKey(t, thetpm, template, nil)
+		dec, err := tpmsigner.NewDecrypter(thetpm, tpmsigner.Config{KeyHandle: key})
+		require.NoError(t, err)
+		_, err = dec.Decrypt(nil, make([]byte, 256), &rsa.OAEPOptions{Hash: crypto.SHA1})
+		require.ErrorIs(t, err, tpmsigner.ErrUnsupportedKey)
+	})
+
+	t.Run("signing key", func(t *testing.T) {
+		key := createKey(t, thetpm, signingTemplate(tpm2.TPMAlgRSA), nil)
+		_, err := tpmsigner.NewDecrypter(thetpm, tpmsigner.Config{KeyHandle: key})
+		require.ErrorIs(t, err, tpmsigner.ErrUnsupportedKey)
+	})
+}
@@ -0,0 +1,358 @@
+// Command demo runs a challenge/response assertion flow modeled on WebAuthn,
+// with a TPM key as authenticator: the relying party (the server) sends a
+// challenge, and the device signs it with a key which can only TPM2_Sign
+// through a policy requiring its authorization value, the PIN of the user.
+//
+// The key is created with templates.WithCommands, used through a policy
+// session satisfying policy.SatisfyCommand, and signs as a crypto.Signer
+// (tpmsigner). The server checks the assertions as a WebAuthn relying party
+// would: challenge, origin, relying party ID hash, flags and signature.
+//
+// Usage:
+//
+//	demo [-tpm-path simulator] [-pin 1234] [-rp-id example.com]
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/handles"
+	"github.com/loicsikidi/tpm-stuff/internal/tpmopen"
+	"github.com/loicsikidi/tpm-stuff/policy"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+)
+
+var (
+	tpmPath = flag.String("tpm-path", tpmopen.Simulator, "Path to the TPM device")
+	pin     = flag.String("pin", "1234", "PIN of the user, the authorization value of the key")
+	rpID    = flag.String("rp-id", "example.com", "ID of the relying party")
+)
+
+// Flags of the authenticator data.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+)
+
+// challengeTTL is how long a challenge can be answered.
+const challengeTTL = time.Minute
+
+func main() {
+	flag.Parse()
+	origin := "https://" + *rpID
+
+	log.Println("======= Assertion Demo: TPM key as authenticator ========")
+
+	tpm, err := tpmopen.Open(*tpmPath)
+	if err != nil {
+		log.Fatalf("can't open TPM: %v", err)
+	}
+	defer tpm.Close()
+	tracker := handles.NewTracker(tpm)
+	defer tracker.Close()
+
+	log.Println("Step 1: Creating the credential key in the TPM...")
+	key, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		InPublic: templates.ECCSigner(
+			templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256),
+			templates.WithCommands(tpm2.TPMCCSign),
+		),
+		UserAuth: []byte(*pin),
+	})
+	if err != nil {
+		log.Fatalf("can't create credential key: %v", err)
+	}
+	tracker.TrackHandle(key)
+	log.Println("✓ Credential key created: it only signs through PolicyCommandCode(Sign) + PolicyAuthValue")
+
+	device, err := newAuthenticator(tpm, key, *rpID, []byte(*pin))
+	if err != nil {
+		log.Fatalf("can't create authenticator: %v", err)
+	}
+
+	log.Println("Step 2: Registering the credential with the relying party...")
+	rp := newRelyingParty(*rpID, origin)
+	rp.register(device.credentialID, device.signer.Public().(*ecdsa.PublicKey))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("can't listen: %v", err)
+	}
+	server := &http.Server{Handler: rp.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(l) //nolint:errcheck
+	defer server.Close()
+	url := "http://" + l.Addr().String()
+	log.Printf("✓ Credential %s registered, relying party listening on %s", device.credentialID, l.Addr())
+
+	log.Println("Step 3: Authenticating with the right PIN...")
+	a, err := authenticate(url, device, origin)
+	if err != nil {
+		log.Fatalf("authentication failed: %v", err)
+	}
+	log.Println("✓ Assertion accepted")
+
+	log.Println("Step 4: Replaying the assertion...")
+	if err := post(url+"/assert", a, nil); err == nil {
+		log.Fatalf("replayed assertion accepted")
+	} else {
+		log.Printf("✓ Replay rejected: %v", err)
+	}
+
+	log.Println("Step 5: Authenticating with a wrong PIN...")
+	wrong, err := newAuthenticator(tpm, key, *rpID, []byte("0000"))
+	if err != nil {
+		log.Fatalf("can't create authenticator: %v", err)
+	}
+	if _, err := authenticate(url, wrong, origin); err == nil {
+		log.Fatalf("authentication succeeded with a wrong PIN")
+	} else {
+		log.Printf("✓ The TPM refused to sign: %v", err)
+	}
+}
+
+// assertion is the answer of the authenticator to a challenge, shaped after
+// the AuthenticatorAssertionResponse of WebAuthn.
+type assertion struct {
+	CredentialID string `json:"credential_id"`
+	// ClientDataJSON holds the challenge and the origin, as seen by the
+	// client.
+	ClientDataJSON []byte `json:"client_data_json"`
+	// AuthenticatorData holds the SHA-256 digest of the relying party ID,
+	// the flags and the signature counter.
+	AuthenticatorData []byte `json:"authenticator_data"`
+	// Signature is the ASN.1 ECDSA signature of AuthenticatorData followed by
+	// the SHA-256 digest of ClientDataJSON.
+	Signature []byte `json:"signature"`
+}
+
+// clientData is the content of ClientDataJSON.
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// authenticator signs assertions with a TPM key.
+type authenticator struct {
+	credentialID string
+	rpID         string
+	signer       *tpmsigner.Signer
+}
+
+// newAuthenticator returns the authenticator of key, proving pin in the
+// policy session of each signature.
+func newAuthenticator(tpm transport.TPM, key tpmutil.Handle, rpID string, pin []byte) (*authenticator, error) {
+	signer, err := tpmsigner.New(tpm, tpmsigner.Config{
+		KeyHandle: key,
+		Session: func() tpm2.Session {
+			return tpm2.Policy(tpm2.TPMAlgSHA256, 16, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+				return policy.SatisfyCommand(tpm, handle, tpm2.TPMAlgSHA256, tpm2.TPMCCSign, tpm2.TPMCCSign)
+			}, tpm2.Auth(pin))
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &authenticator{
+		credentialID: hex.EncodeToString(key.Name().Buffer),
+		rpID:         rpID,
+		signer:       signer,
+	}, nil
+}
+
+// assert answers challenge for origin. The user is verified by the TPM,
+// which checks the PIN.
+func (a *authenticator) assert(challenge []byte, origin string) (*assertion, error) {
+	clientDataJSON, err := json.Marshal(clientData{
+		Type:      "webauthn.get",
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    origin,
+	})
+	if err != nil {
+		return nil, err
+	}
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	// TPM keys have no signature counter: it stays at zero, as WebAuthn
+	// allows for authenticators without one.
+	authData := append(rpIDHash[:], flagUserPresent|flagUserVerified, 0, 0, 0, 0)
+	sig, err := a.signer.Sign(rand.Reader, signedDigest(authData, clientDataJSON), crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return &assertion{
+		CredentialID:      a.credentialID,
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         sig,
+	}, nil
+}
+
+// signedDigest returns the digest signed by assertions.
+func signedDigest(authData, clientDataJSON []byte) []byte {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(bytes.Clone(authData), clientDataHash[:]...))
+	return digest[:]
+}
+
+// authenticate runs the assertion flow against the relying party at url.
+func authenticate(url string, a *authenticator, origin string) (*assertion, error) {
+	var challenge struct {
+		Challenge []byte `json:"challenge"`
+	}
+	if err := post(url+"/challenge", struct{}{}, &challenge); err != nil {
+		return nil, err
+	}
+	asrt, err := a.assert(challenge.Challenge, origin)
+	if err != nil {
+		return nil, err
+	}
+	return asrt, post(url+"/assert", asrt, nil)
+}
+
+// post sends req as JSON to url and decodes the response into rsp, if not
+// nil.
+func post(url string, req, rsp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(r.Body).Decode(&e) //nolint:errcheck
+		return fmt.Errorf("%s: %s", r.Status, e.Error)
+	}
+	if rsp == nil {
+		return nil
+	}
+	return json.NewDecoder(r.Body).Decode(rsp)
+}
+
+// relyingParty is the server side: it registers credentials, issues
+// challenges and verifies assertions.
+type relyingParty struct {
+	rpID, origin string
+
+	mu          sync.Mutex
+	credentials map[string]*ecdsa.PublicKey
+	challenges  map[string]time.Time
+}
+
+func newRelyingParty(rpID, origin string) *relyingParty {
+	return &relyingParty{
+		rpID:        rpID,
+		origin:      origin,
+		credentials: make(map[string]*ecdsa.PublicKey),
+		challenges:  make(map[string]time.Time),
+	}
+}
+
+// register records the public key of a credential. A real relying party
+// would check an attestation of the key, e.g. with the keyattest package.
+func (rp *relyingParty) register(id string, pub *ecdsa.PublicKey) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.credentials[id] = pub
+}
+
+// challenge issues a random challenge.
+func (rp *relyingParty) challenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.challenges[base64.RawURLEncoding.EncodeToString(challenge)] = time.Now().Add(challengeTTL)
+	return challenge, nil
+}
+
+// verify checks a: each challenge is accepted once, before it expires.
+func (rp *relyingParty) verify(a *assertion) error {
+	var cd clientData
+	if err := json.Unmarshal(a.ClientDataJSON, &cd); err != nil {
+		return fmt.Errorf("invalid client data: %w", err)
+	}
+	rp.mu.Lock()
+	pub, ok := rp.credentials[a.CredentialID]
+	expires, issued := rp.challenges[cd.Challenge]
+	delete(rp.challenges, cd.Challenge)
+	rp.mu.Unlock()
+
+	switch {
+	case !ok:
+		return errors.New("unknown credential")
+	case cd.Type != "webauthn.get":
+		return fmt.Errorf("unexpected type %q", cd.Type)
+	case !issued || time.Now().After(expires):
+		return errors.New("unknown or expired challenge")
+	case cd.Origin != rp.origin:
+		return fmt.Errorf("unexpected origin %q", cd.Origin)
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.rpID))
+	if len(a.AuthenticatorData) < 37 || !bytes.Equal(a.AuthenticatorData[:32], rpIDHash[:]) {
+		return errors.New("authenticator data of another relying party")
+	}
+	if flags := a.AuthenticatorData[32]; flags&flagUserPresent == 0 || flags&flagUserVerified == 0 {
+		return errors.New("user not verified")
+	}
+	if !ecdsa.VerifyASN1(pub, signedDigest(a.AuthenticatorData, a.ClientDataJSON), a.Signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func (rp *relyingParty) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /challenge", func(w http.ResponseWriter, _ *http.Request) {
+		challenge, err := rp.challenge()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string][]byte{"challenge": challenge})
+	})
+	mux.HandleFunc("POST /assert", func(w http.ResponseWriter, r *http.Request) {
+		var a assertion
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&a); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := rp.verify(&a); err != nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"credential_id": a.CredentialID})
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v) //nolint:errcheck
+}
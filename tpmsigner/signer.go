@@ -0,0 +1,236 @@
+// Package tpmsigner exposes TPM keys through the standard [crypto] interfaces
+// so they can be plugged into TLS, x509 or JWT libraries.
+package tpmsigner
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+)
+
+var (
+	// ErrRestrictedKey is returned for restricted signing keys: TPM2_Sign only
+	// accepts external digests for them along with a ticket from TPM2_Hash.
+	// The sign package signs data with them.
+	ErrRestrictedKey = errors.New("restricted keys can't sign external digests")
+	// ErrUnsupportedKey is returned when the key can't perform the requested operation.
+	ErrUnsupportedKey = errors.New("unsupported key")
+)
+
+// Config holds configuration for [New].
+type Config struct {
+	// KeyHandle is the handle of a loaded or persistent key.
+	//
+	// Required.
+	KeyHandle tpmutil.Handle
+	// Auth is the authorization value of the key.
+	//
+	// Default: nil.
+	Auth []byte
+	// Session returns the session authorizing a single TPM command. It is called
+	// for every operation so that policy sessions, which are consumed by each
+	// use, can be rebuilt.
+	//
+	// Default: [EncryptedSession] with Auth for [New], unbound.Unbound with
+	// Auth for [NewDecrypter].
+	Session func() tpm2.Session
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	if c.KeyHandle == nil {
+		return tpmutil.ErrMissingHandle
+	}
+	if c.Session == nil {
+		auth := c.Auth
+		c.Session = func() tpm2.Session {
+			return EncryptedSession(auth)
+		}
+	}
+	return nil
+}
+
+// EncryptedSession creates an inline unbound HMAC session authorizing the key
+// with authValue and encrypting the first command parameter (the digest to
+// sign or the ciphertext to decrypt).
+//
+// Note: unlike unbound.Unbound, response encryption is not requested because
+// TPM2_Sign returns a TPMT_SIGNATURE, which can't be encrypted.
+func EncryptedSession(authValue []byte) tpm2.Session {
+	return tpm2.HMAC(
+		tpm2.TPMAlgSHA256,
+		16, // nonceCaller size
+		tpm2.Auth(authValue),
+		tpm2.AESEncryption(128, tpm2.EncryptIn),
+	)
+}
+
+// Signer is a [crypto.Signer] backed by a TPM key.
+//
+// Signer is not safe for concurrent use unless the underlying transport is.
+type Signer struct {
+	tpm     transport.TPM
+	handle  tpmutil.Handle
+	public  tpm2.TPMTPublic
+	pub     crypto.PublicKey
+	session func() tpm2.Session
+}
+
+var _ crypto.Signer = (*Signer)(nil)
+
+// New returns a [Signer] for an unrestricted RSA or ECC signing key.
+// The public area is read from the TPM when KeyHandle doesn't carry it.
+//
+// Example:
+//
+//	signer, err := tpmsigner.New(tpm, tpmsigner.Config{KeyHandle: keyHandle, Auth: password})
+//	if err != nil {
+//	    return err
+//	}
+//	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+func New(tpm transport.TPM, cfg Config) (*Signer, error) {
+	h, public, pub, err := loadKey(tpm, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !public.ObjectAttributes.SignEncrypt {
+		return nil, fmt.Errorf("%w: not a signing key", ErrUnsupportedKey)
+	}
+	if public.ObjectAttributes.Restricted {
+		return nil, ErrRestrictedKey
+	}
+	return &Signer{
+		tpm:     tpm,
+		handle:  h,
+		public:  *public,
+		pub:     pub,
+		session: cfg.Session,
+	}, nil
+}
+
+// loadKey validates cfg and returns the key handle along with its public area.
+func loadKey(tpm transport.TPM, cfg *Config) (tpmutil.Handle, *tpm2.TPMTPublic, crypto.PublicKey, error) {
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, nil, nil, err
+	}
+	h := cfg.KeyHandle
+	if !h.HasPublic() {
+		var err error
+		h, err = tpmutil.ToHandle(tpm, h.Handle())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	public := h.Public()
+	pub, err := tpmcrypto.PublicKey(public)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrUnsupportedKey, err)
+	}
+	return h, public, pub, nil
+}
+
+// Public returns the public key of the TPM key.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest with the TPM key. rand is ignored: the TPM uses its own RNG.
+//
+// The scheme is derived from the key type and opts: ECDSA for ECC keys,
+// RSASSA-PKCS1-v1_5 for RSA keys unless opts is a [*rsa.PSSOptions].
+// ECDSA signatures are returned ASN.1 encoded, as [crypto/ecdsa] does.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts == nil || opts.HashFunc() == 0 {
+		return nil, errors.New("a hash function is required")
+	}
+	hash := opts.HashFunc()
+	if len(digest) != hash.Size() {
+		return nil, fmt.Errorf("digest length %d doesn't match %v", len(digest), hash)
+	}
+	if pss, ok := opts.(*rsa.PSSOptions); ok {
+		// TPMs salt PSS signatures with as many bytes as the digest.
+		switch pss.SaltLength {
+		case rsa.PSSSaltLengthAuto, rsa.PSSSaltLengthEqualsHash, hash.Size():
+		default:
+			return nil, fmt.Errorf("unsupported PSS salt length %d", pss.SaltLength)
+		}
+	}
+	scheme, err := tpmcrypto.GetSigSchemeFromPublicKey(s.pub, opts)
+	if err != nil {
+		return nil, err
+	}
+	hashAlg, err := tpmcrypto.HashToAlgorithm(hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkScheme(scheme.Scheme, hashAlg); err != nil {
+		return nil, err
+	}
+
+	rsp, err := tpm2.Sign{
+		KeyHandle:  tpmutil.ToAuthHandle(s.handle, s.session()),
+		Digest:     tpm2.TPM2BDigest{Buffer: digest},
+		InScheme:   scheme,
+		Validation: tpmutil.NullTicket,
+	}.Execute(s.tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return EncodeSignature(rsp.Signature)
+}
+
+// EncodeSignature converts a TPM signature to the encoding used by the Go
+// standard library: PKCS #1 v1.5 or PSS bytes for RSA, ASN.1 for ECDSA.
+func EncodeSignature(sig tpm2.TPMTSignature) ([]byte, error) {
+	switch sig.SigAlg {
+	case tpm2.TPMAlgRSASSA:
+		rsaSig, err := sig.Signature.RSASSA()
+		if err != nil {
+			return nil, err
+		}
+		return rsaSig.Sig.Buffer, nil
+	case tpm2.TPMAlgRSAPSS:
+		rsaSig, err := sig.Signature.RSAPSS()
+		if err != nil {
+			return nil, err
+		}
+		return rsaSig.Sig.Buffer, nil
+	case tpm2.TPMAlgECDSA:
+		eccSig, err := sig.Signature.ECDSA()
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(struct {
+			R, S *big.Int
+		}{
+			new(big.Int).SetBytes(eccSig.SignatureR.Buffer),
+			new(big.Int).SetBytes(eccSig.SignatureS.Buffer),
+		})
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %v", sig.SigAlg)
+	}
+}
+
+// checkScheme ensures the requested scheme is compatible with the scheme fixed by the key, if any.
+func (s *Signer) checkScheme(scheme, hashAlg tpm2.TPMAlgID) error {
+	keyScheme, keyHash, err := tpmcrypto.GetSigSchemeAndHashFromPublic(s.public)
+	if err != nil {
+		return err
+	}
+	if keyScheme == tpm2.TPMAlgNull {
+		return nil
+	}
+	if scheme != keyScheme || hashAlg != keyHash {
+		return fmt.Errorf("%w: key only signs with scheme %v and hash %v", ErrUnsupportedKey, keyScheme, keyHash)
+	}
+	return nil
+}
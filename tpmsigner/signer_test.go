@@ -0,0 +1,198 @@
+package tpmsigner_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+	"github.com/stretchr/testify/require"
+)
+
+func signingTemplate(keyType tpm2.TPMAlgID) tpm2.TPMTPublic {
+	if keyType == tpm2.TPMAlgRSA {
+		return templates.RSASigner()
+	}
+	return templates.ECCSigner(templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256))
+}
+
+func createKey(t *testing.T, thetpm transport.TPM, template tpm2.TPMTPublic, auth []byte) tpmutil.HandleCloser {
+	t.Helper()
+	key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: template,
+		UserAuth: auth,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { key.Close() })
+	return key
+}
+
+func TestSign(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	auth := []byte("key-password")
+	msg := []byte("message to sign")
+
+	rsaKey := createKey(t, thetpm, signingTemplate(tpm2.TPMAlgRSA), auth)
+	eccKey := createKey(t, thetpm, signingTemplate(tpm2.TPMAlgECC), auth)
+
+	tests := []struct {
+		name string
+		key  tpmutil.Handle
+		opts crypto.SignerOpts
+	}{
+		{"RSASSA SHA256", rsaKey, crypto.SHA256},
+		{"RSASSA SHA384", rsaKey, crypto.SHA384},
+		{"RSAPSS SHA256", rsaKey, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}},
+		{"ECDSA SHA256", eccKey, crypto.SHA256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := tpmsigner.New(thetpm, tpmsigner.Config{KeyHandle: tt.key, Auth: auth})
+			require.NoError(t, err)
+
+			h := tt.opts.HashFunc().New()
+			h.Write(msg)
+			digest := h.Sum(nil)
+
+			sig, err := signer.Sign(rand.Reader, digest, tt.opts)
+			require.NoError(t, err)
+
+			switch pub := signer.Public().(type) {
+			case *rsa.PublicKey:
+				if pss, ok := tt.opts.(*rsa.PSSOptions); ok {
+					require.NoError(t, rsa.VerifyPSS(pub, pss.Hash, digest, sig, pss))
+				} else {
+					require.NoError(t, rsa.VerifyPKCS1v15(pub, tt.opts.HashFunc(), digest, sig))
+				}
+			case *ecdsa.PublicKey:
+				require.True(t, ecdsa.VerifyASN1(pub, digest, sig))
+			default:
+				t.Fatalf("unexpected public key type %T", pub)
+			}
+		})
+	}
+}
+
+func TestSign_PersistentHandle(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	key := createKey(t, thetpm, signingTemplate(tpm2.TPMAlgECC), nil)
+
+	const persistent = tpm2.TPMHandle(0x81000100)
+	_, err := tpm2.EvictControl{
+		Auth:             tpm2.TPMRHOwner,
+		ObjectHandle:     tpm2.NamedHandle{Handle: key.Handle(), Name: key.Name()},
+		PersistentHandle: persistent,
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = tpm2.EvictControl{
+			Auth:             tpm2.TPMRHOwner,
+			ObjectHandle:     tpm2.NamedHandle{Handle: persistent, Name: key.Name()},
+			PersistentHandle: persistent,
+		}.Execute(thetpm)
+	})
+
+	// The public area is read back from the TPM.
+	signer, err := tpmsigner.New(thetpm, tpmsigner.Config{KeyHandle: tpmutil.NewHandle(persistent)})
+	require.NoError(t, err)
+
+	digest := sha256.Sum256([]byte("message"))
+	sig, err := signer.Sign(nil, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	require.True(t, ecdsa.VerifyASN1(signer.Public().(*ecdsa.PublicKey), digest[:], sig))
+}
+
+func TestSign_PolicySession(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	// The key can only be used by TPM2_Sign, without password.
+	calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+	require.NoError(t, err)
+	require.NoError(t, tpm2.PolicyCommandCode{Code: tpm2.TPMCCSign}.Update(calc))
+
+	template := signingTemplate(tpm2.TPMAlgRSA)
+	template.ObjectAttributes.UserWithAuth = false
+	template.AuthPolicy = tpm2.TPM2BDigest{Buffer: calc.Hash().Digest}
+	key := createKey(t, thetpm, template, nil)
+
+	signer, err := tpmsigner.New(thetpm, tpmsigner.Config{
+		KeyHandle: key,
+		Session: func() tpm2.Session {
+			return tpm2.Policy(tpm2.TPMAlgSHA256, 16, func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+				_, err := tpm2.PolicyCommandCode{PolicySession: handle, Code: tpm2.TPMCCSign}.Execute(tpm)
+				return err
+			})
+		},
+	})
+	require.NoError(t, err)
+
+	digest := sha256.Sum256([]byte("message"))
+	for range 2 {
+		sig, err := signer.Sign(nil, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+		require.NoError(t, rsa.VerifyPKCS1v15(signer.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], sig))
+	}
+
+	// A password session doesn't satisfy the policy.
+	pwSigner, err := tpmsigner.New(thetpm, tpmsigner.Config{KeyHandle: key})
+	require.NoError(t, err)
+	_, err = pwSigner.Sign(nil, digest[:], crypto.SHA256)
+	require.Error(t, err)
+}
+
+func TestSign_Errors(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	digest := sha256.Sum256([]byte("message"))
+
+	t.Run("wrong password", func(t *testing.T) {
+		key := createKey(t, thetpm, signingTemplate(tpm2.TPMAlgECC), []byte("password"))
+		signer, err := tpmsigner.New(thetpm, tpmsigner.Config{KeyHandle: key, Auth: []byte("wrong")})
+		require.NoError(t, err)
+		_, err = signer.Sign(nil, digest[:], crypto.SHA256)
+		require.Error(t, err)
+	})
+
+	t.Run("digest size mismatch", func(t *testing.T) {
+		key := createKey(t, thetpm, signingTemplate(tpm2.TPMAlgECC), nil)
+		signer, err := tpmsigner.New(thetpm, tpmsigner.Config{KeyHandle: key})
+		require.NoError(t, err)
+		_, err = signer.Sign(nil, digest[:], crypto.SHA512)
+		require.Error(t, err)
+	})
+
+	t.Run("scheme fixed by the key", func(t *testing.T) {
+		params, err := tpmcrypto.NewRSASigKeyParameters(2048, tpm2.TPMAlgRSASSA)
+		require.NoError(t, err)
+		template := signingTemplate(tpm2.TPMAlgRSA)
+		template.Parameters = *params
+		key := createKey(t, thetpm, template, nil)
+
+		signer, err := tpmsigner.New(thetpm, tpmsigner.Config{KeyHandle: key})
+		require.NoError(t, err)
+		pss := &rsa.PSSOptions{Hash: crypto.SHA256}
+		_, err = signer.Sign(nil, digest[:], pss)
+		require.ErrorIs(t, err, tpmsigner.ErrUnsupportedKey)
+
+		sha512Digest := sha512.Sum512([]byte("message"))
+		_, err = signer.Sign(nil, sha512Digest[:], crypto.SHA512)
+		require.ErrorIs(t, err, tpmsigner.ErrUnsupportedKey)
+	})
+
+	t.Run("restricted key", func(t *testing.T) {
+		template := signingTemplate(tpm2.TPMAlgECC)
+		template.ObjectAttributes.Restricted = true
+		key := createKey(t, thetpm, template, nil)
+		_, err := tpmsigner.New(thetpm, tpmsigner.Config{KeyHandle: key})
+		require.ErrorIs(t, err, tpmsigner.ErrRestrictedKey)
+	})
+}
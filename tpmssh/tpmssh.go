@@ -0,0 +1,154 @@
+// Package tpmssh exposes TPM keys as SSH signers ([ssh.Signer]), for SSH
+// client authentication where the private key never leaves the TPM.
+package tpmssh
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+	"golang.org/x/crypto/ssh"
+)
+
+// Config holds configuration for [NewSigner].
+type Config struct {
+	// Auth is the authorization value of the key.
+	//
+	// Default: nil.
+	Auth []byte
+	// Session returns the session authorizing each TPM2_Sign.
+	//
+	// Default: tpmsigner.EncryptedSession with Auth.
+	Session func() tpm2.Session
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	return nil
+}
+
+// NewSigner returns an [ssh.Signer] for the unrestricted ECDSA or RSA signing
+// key keyHandle.
+//
+// The SSH algorithms are limited to the scheme of the key, if it has one:
+// RSASSA keys sign with rsa-sha2-256 or rsa-sha2-512 (or ssh-rsa for SHA-1)
+// and ECDSA keys must use the hash matching their curve. RSA-PSS keys are
+// rejected, as SSH has no PSS algorithm.
+//
+// The signer is not safe for concurrent use unless the transport is.
+//
+// Example:
+//
+//	signer, err := tpmssh.NewSigner(tpm, key)
+//	if err != nil {
+//	    return err
+//	}
+//	client, err := ssh.Dial("tcp", "host:22", &ssh.ClientConfig{
+//	    User: "alice",
+//	    Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+//	    HostKeyCallback: hostKeyCallback,
+//	})
+func NewSigner(tpm transport.TPM, keyHandle tpmutil.Handle, optionalCfg ...Config) (ssh.Signer, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if keyHandle != nil && !keyHandle.HasPublic() {
+		var err error
+		if keyHandle, err = tpmutil.ToHandle(tpm, keyHandle.Handle()); err != nil {
+			return nil, err
+		}
+	}
+	signer, err := tpmsigner.New(tpm, tpmsigner.Config{
+		KeyHandle: keyHandle,
+		Auth:      cfg.Auth,
+		Session:   cfg.Session,
+	})
+	if err != nil {
+		return nil, err
+	}
+	algs, err := algorithms(*keyHandle.Public(), signer)
+	if err != nil {
+		return nil, err
+	}
+	sshSigner, err := ssh.NewSignerFromSigner(signer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", tpmsigner.ErrUnsupportedKey, err)
+	}
+	if algs == nil {
+		return sshSigner, nil
+	}
+	return ssh.NewSignerWithAlgorithms(sshSigner.(ssh.AlgorithmSigner), algs)
+}
+
+// AuthorizedKey returns the authorized_keys line of the TPM public area
+// public, followed by comment when not empty.
+//
+// Example:
+//
+//	line, err := tpmssh.AuthorizedKey(key.Public(), "alice@laptop")
+//	// ecdsa-sha2-nistp256 AAAAE2VjZHNh... alice@laptop
+func AuthorizedKey(public *tpm2.TPMTPublic, comment string) ([]byte, error) {
+	if public == nil {
+		return nil, fmt.Errorf("missing public area")
+	}
+	pub, err := tpmcrypto.PublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", tpmsigner.ErrUnsupportedKey, err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", tpmsigner.ErrUnsupportedKey, err)
+	}
+	line := bytes.TrimSuffix(ssh.MarshalAuthorizedKey(sshPub), []byte("\n"))
+	if comment != "" {
+		line = append(append(line, ' '), comment...)
+	}
+	return append(line, '\n'), nil
+}
+
+// algorithms returns the SSH algorithms the key can sign with, nil meaning
+// any algorithm matching the key type.
+func algorithms(public tpm2.TPMTPublic, signer *tpmsigner.Signer) ([]string, error) {
+	scheme, hash, err := tpmcrypto.GetSigSchemeAndHashFromPublic(public)
+	if err != nil {
+		return nil, err
+	}
+	switch scheme {
+	case tpm2.TPMAlgNull:
+		return nil, nil
+	case tpm2.TPMAlgRSASSA:
+		algs := map[tpm2.TPMAlgID]string{
+			tpm2.TPMAlgSHA1:   ssh.KeyAlgoRSA,
+			tpm2.TPMAlgSHA256: ssh.KeyAlgoRSASHA256,
+			tpm2.TPMAlgSHA512: ssh.KeyAlgoRSASHA512,
+		}
+		if alg, ok := algs[hash]; ok {
+			return []string{alg}, nil
+		}
+	case tpm2.TPMAlgECDSA:
+		ecc, ok := signer.Public().(*ecdsa.PublicKey)
+		if !ok {
+			break
+		}
+		// SSH ties the hash to the curve (RFC 5656, section 6.2.1).
+		curves := map[elliptic.Curve]tpm2.TPMAlgID{
+			elliptic.P256(): tpm2.TPMAlgSHA256,
+			elliptic.P384(): tpm2.TPMAlgSHA384,
+			elliptic.P521(): tpm2.TPMAlgSHA512,
+		}
+		if curves[ecc.Curve] == hash {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no SSH algorithm for scheme %v and hash %v", tpmsigner.ErrUnsupportedKey, scheme, hash)
+}
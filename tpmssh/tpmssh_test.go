@@ -0,0 +1,166 @@
+package tpmssh_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+	"github.com/loicsikidi/tpm-stuff/tpmssh"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func signingTemplate(keyType, scheme tpm2.TPMAlgID) tpm2.TPMTPublic {
+	if keyType == tpm2.TPMAlgRSA {
+		return templates.RSASigner(templates.WithScheme(scheme, tpm2.TPMAlgSHA256))
+	}
+	return templates.ECCSigner(templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256))
+}
+
+// handshake authenticates signer against an in-process SSH server accepting
+// the keys of authorizedKeys, and returns the user it logged in.
+func handshake(t *testing.T, signer ssh.Signer, authorizedKeys []byte) (string, error) {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+
+	var authorized []ssh.PublicKey
+	for rest := authorizedKeys; len(bytes.TrimSpace(rest)) > 0; {
+		pub, _, _, r, err := ssh.ParseAuthorizedKey(rest)
+		require.NoError(t, err)
+		authorized, rest = append(authorized, pub), r
+	}
+	serverCfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, pub := range authorized {
+				if bytes.Equal(pub.Marshal(), key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	serverCfg.AddHostKey(hostSigner)
+
+	// net.Pipe is unbuffered: both sides would block sending their version.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	type result struct {
+		user string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		serverConn, err := l.Accept()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer serverConn.Close()
+		conn, _, _, err := ssh.NewServerConn(serverConn, serverCfg)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer conn.Close()
+		done <- result{user: conn.User()}
+	}()
+
+	clientConn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	conn, _, _, err := ssh.NewClientConn(clientConn, "tpm-host", &ssh.ClientConfig{
+		User:            "alice",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostSigner.PublicKey()),
+	})
+	if err == nil {
+		conn.Close()
+	} else {
+		clientConn.Close()
+	}
+	res := <-done
+	if err != nil {
+		return "", err
+	}
+	return res.user, res.err
+}
+
+func TestNewSigner(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	tests := []struct {
+		name     string
+		template tpm2.TPMTPublic
+		keyAlgo  string
+	}{
+		{"ECDSA", signingTemplate(tpm2.TPMAlgECC, 0), ssh.KeyAlgoECDSA256},
+		{"RSA", signingTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgNull), ssh.KeyAlgoRSA},
+		{"RSASSA-SHA256", signingTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgRSASSA), ssh.KeyAlgoRSA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := []byte("ssh-key")
+			key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tt.template, UserAuth: auth})
+			require.NoError(t, err)
+			defer key.Close()
+
+			signer, err := tpmssh.NewSigner(thetpm, key, tpmssh.Config{Auth: auth})
+			require.NoError(t, err)
+			require.Equal(t, tt.keyAlgo, signer.PublicKey().Type())
+
+			line, err := tpmssh.AuthorizedKey(key.Public(), "alice@tpm")
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(string(line), tt.keyAlgo+" "))
+			require.True(t, strings.HasSuffix(string(line), " alice@tpm\n"))
+
+			user, err := handshake(t, signer, line)
+			require.NoError(t, err)
+			require.Equal(t, "alice", user)
+		})
+	}
+}
+
+func TestNewSigner_Errors(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	t.Run("RSA-PSS key", func(t *testing.T) {
+		key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: signingTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgRSAPSS)})
+		require.NoError(t, err)
+		defer key.Close()
+
+		_, err = tpmssh.NewSigner(thetpm, key)
+		require.ErrorIs(t, err, tpmsigner.ErrUnsupportedKey)
+	})
+
+	t.Run("not authorized", func(t *testing.T) {
+		key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: signingTemplate(tpm2.TPMAlgECC, 0)})
+		require.NoError(t, err)
+		defer key.Close()
+		otherTemplate := signingTemplate(tpm2.TPMAlgECC, 0)
+		otherTemplate.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+			X: tpm2.TPM2BECCParameter{Buffer: []byte("other")},
+		})
+		other, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: otherTemplate})
+		require.NoError(t, err)
+		defer other.Close()
+
+		signer, err := tpmssh.NewSigner(thetpm, key)
+		require.NoError(t, err)
+		line, err := tpmssh.AuthorizedKey(other.Public(), "")
+		require.NoError(t, err)
+		_, err = handshake(t, signer, line)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/csr"
+	"github.com/loicsikidi/tpm-stuff/handles"
+	"github.com/loicsikidi/tpm-stuff/internal/tpmopen"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/tpmtls"
+)
+
+var (
+	tpmPath = flag.String("tpm-path", tpmopen.Simulator, "Path to the TPM device")
+	cn      = flag.String("cn", "device-42", "Common name of the client certificate")
+)
+
+func main() {
+	flag.Parse()
+
+	log.Println("======= mTLS Demo: TPM-backed client certificate ========")
+
+	tpm, err := tpmopen.Open(*tpmPath)
+	if err != nil {
+		log.Fatalf("can't open TPM: %v", err)
+	}
+	defer tpm.Close()
+	tracker := handles.NewTracker(tpm)
+	defer tracker.Close()
+
+	log.Println("Step 1: Creating the CA (software key)...")
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalf("can't generate CA key: %v", err)
+	}
+	caCert, err := issue(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "tpm-stuff demo CA"},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, caKey.Public(), caKey)
+	if err != nil {
+		log.Fatalf("can't create CA certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	log.Println("✓ CA created")
+
+	log.Println("Step 2: Creating the client key in the TPM...")
+	key, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		InPublic: templates.ECCSigner(templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256)),
+	})
+	if err != nil {
+		log.Fatalf("can't create client key: %v", err)
+	}
+	tracker.TrackHandle(key)
+	log.Println("✓ Client key created (the private key never leaves the TPM)")
+
+	log.Println("Step 3: Enrolling the client key (CSR signed by the TPM)...")
+	pemCSR, err := csr.Create(tpm, key, pkix.Name{CommonName: *cn})
+	if err != nil {
+		log.Fatalf("can't create CSR: %v", err)
+	}
+	block, _ := pem.Decode(pemCSR)
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		log.Fatalf("can't parse CSR: %v", err)
+	}
+	if err := req.CheckSignature(); err != nil {
+		log.Fatalf("invalid CSR signature: %v", err)
+	}
+	leaf, err := issue(&x509.Certificate{
+		Subject:     req.Subject,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, req.PublicKey, caKey)
+	if err != nil {
+		log.Fatalf("can't issue client certificate: %v", err)
+	}
+	clientCert, err := tpmtls.Certificate(tpm, key, leaf)
+	if err != nil {
+		log.Fatalf("can't build TLS certificate: %v", err)
+	}
+	log.Printf("✓ Client certificate issued for %q", leaf.Subject.CommonName)
+
+	log.Println("Step 4: Starting an mTLS server requiring client certificates...")
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalf("can't generate server key: %v", err)
+	}
+	serverLeaf, err := issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, caCert, serverKey.Public(), caKey)
+	if err != nil {
+		log.Fatalf("can't issue server certificate: %v", err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverLeaf.Raw}, PrivateKey: serverKey}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    roots,
+		MinVersion:   tls.VersionTLS13,
+	})
+	if err != nil {
+		log.Fatalf("can't listen: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello %s", r.TLS.PeerCertificates[0].Subject.CommonName)
+	})}
+	go server.Serve(l) //nolint:errcheck
+	defer server.Close()
+	log.Printf("✓ Server listening on %s", l.Addr())
+
+	log.Println("Step 5: Calling the server with the TPM-backed certificate...")
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      roots,
+			MinVersion:   tls.VersionTLS13,
+		},
+	}}
+	rsp, err := client.Get("https://" + l.Addr().String())
+	if err != nil {
+		log.Fatalf("request failed: %v", err)
+	}
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		log.Fatalf("can't read response: %v", err)
+	}
+	log.Printf("✓ Server answered: %q", body)
+}
+
+// issue signs template with the CA key, self-signed when parent is nil.
+func issue(template, parent *x509.Certificate, pub any, caKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
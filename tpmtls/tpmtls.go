@@ -0,0 +1,173 @@
+// Package tpmtls plugs TPM keys into [crypto/tls], for TLS client or server
+// authentication where the private key never leaves the TPM.
+package tpmtls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+)
+
+// ErrKeyMismatch is returned by [Certificate] when the certificate doesn't
+// certify the TPM key.
+var ErrKeyMismatch = errors.New("certificate doesn't match the TPM key")
+
+// Config holds configuration for [Certificate].
+type Config struct {
+	// Auth is the authorization value of the key.
+	//
+	// Default: nil.
+	Auth []byte
+	// Session returns the session authorizing each TPM2_Sign.
+	//
+	// Default: tpmsigner.EncryptedSession with Auth.
+	Session func() tpm2.Session
+	// Intermediates are sent after the leaf certificate, up to (excluding)
+	// the root.
+	Intermediates []*x509.Certificate
+}
+
+// CheckAndSetDefault validates and sets default values for Config.
+func (c *Config) CheckAndSetDefault() error {
+	return nil
+}
+
+// Certificate returns a [tls.Certificate] for cert whose private key is the
+// TPM key keyHandle, to be added to tls.Config.Certificates.
+//
+// The handshakes of a tls.Config may run concurrently: the TPM signatures
+// are serialized, as transports aren't safe for concurrent use. The signature
+// algorithms are limited to the scheme of the key, if it has one: note that
+// TLS 1.3 requires RSA-PSS for RSA keys.
+//
+// Example:
+//
+//	cert, err := tpmtls.Certificate(tpm, key, leaf)
+//	if err != nil {
+//	    return err
+//	}
+//	client := &http.Client{Transport: &http.Transport{
+//	    TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: roots},
+//	}}
+func Certificate(tpm transport.TPM, keyHandle tpmutil.Handle, cert *x509.Certificate, optionalCfg ...Config) (tls.Certificate, error) {
+	var cfg Config
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return tls.Certificate{}, fmt.Errorf("invalid config: %w", err)
+	}
+	if cert == nil {
+		return tls.Certificate{}, errors.New("missing certificate")
+	}
+	signer, err := tpmsigner.New(tpm, tpmsigner.Config{
+		KeyHandle: keyHandle,
+		Auth:      cfg.Auth,
+		Session:   cfg.Session,
+	})
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(cert.PublicKey) {
+		return tls.Certificate{}, ErrKeyMismatch
+	}
+	schemes, err := signatureSchemes(tpm, keyHandle, signer.Public())
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	chain := [][]byte{cert.Raw}
+	for _, c := range cfg.Intermediates {
+		chain = append(chain, c.Raw)
+	}
+	return tls.Certificate{
+		Certificate:                  chain,
+		PrivateKey:                   &lockedSigner{signer: signer},
+		SupportedSignatureAlgorithms: schemes,
+		Leaf:                         cert,
+	}, nil
+}
+
+// lockedSigner serializes the signatures of a signer.
+type lockedSigner struct {
+	mu     sync.Mutex
+	signer crypto.Signer
+}
+
+func (s *lockedSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s *lockedSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signer.Sign(rand, digest, opts)
+}
+
+// signatureSchemes returns the TLS signature schemes the key can produce, nil
+// meaning any scheme matching the key type.
+func signatureSchemes(tpm transport.TPM, keyHandle tpmutil.Handle, pub crypto.PublicKey) ([]tls.SignatureScheme, error) {
+	h := keyHandle
+	if !h.HasPublic() {
+		var err error
+		if h, err = tpmutil.ToHandle(tpm, h.Handle()); err != nil {
+			return nil, err
+		}
+	}
+	scheme, hash, err := tpmcrypto.GetSigSchemeAndHashFromPublic(*h.Public())
+	if err != nil {
+		return nil, err
+	}
+	switch scheme {
+	case tpm2.TPMAlgNull:
+		return nil, nil
+	case tpm2.TPMAlgRSASSA, tpm2.TPMAlgRSAPSS:
+		if _, ok := pub.(*rsa.PublicKey); !ok {
+			break
+		}
+		schemes := map[tpm2.TPMAlgID]tls.SignatureScheme{
+			tpm2.TPMAlgSHA256: tls.PKCS1WithSHA256,
+			tpm2.TPMAlgSHA384: tls.PKCS1WithSHA384,
+			tpm2.TPMAlgSHA512: tls.PKCS1WithSHA512,
+		}
+		if scheme == tpm2.TPMAlgRSAPSS {
+			schemes = map[tpm2.TPMAlgID]tls.SignatureScheme{
+				tpm2.TPMAlgSHA256: tls.PSSWithSHA256,
+				tpm2.TPMAlgSHA384: tls.PSSWithSHA384,
+				tpm2.TPMAlgSHA512: tls.PSSWithSHA512,
+			}
+		}
+		if s, ok := schemes[hash]; ok {
+			return []tls.SignatureScheme{s}, nil
+		}
+	case tpm2.TPMAlgECDSA:
+		ecc, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			break
+		}
+		// TLS 1.3 ties the hash to the curve.
+		curves := map[elliptic.Curve]tpm2.TPMAlgID{
+			elliptic.P256(): tpm2.TPMAlgSHA256,
+			elliptic.P384(): tpm2.TPMAlgSHA384,
+			elliptic.P521(): tpm2.TPMAlgSHA512,
+		}
+		if curves[ecc.Curve] == hash {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no TLS signature scheme for scheme %v and hash %v", tpmsigner.ErrUnsupportedKey, scheme, hash)
+}
@@ -0,0 +1,155 @@
+package tpmtls_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/tpmsigner"
+	"github.com/loicsikidi/tpm-stuff/tpmtls"
+	"github.com/stretchr/testify/require"
+)
+
+// ca is a software CA issuing the certificates of the tests.
+type ca struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newCA(t *testing.T) *ca {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &ca{key: key, cert: cert}
+}
+
+func (c *ca) issue(t *testing.T, cn string, pub crypto.PublicKey, usage x509.ExtKeyUsage) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, pub, c.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func signingTemplate(keyType, scheme tpm2.TPMAlgID) tpm2.TPMTPublic {
+	if keyType == tpm2.TPMAlgRSA {
+		return templates.RSASigner(templates.WithScheme(scheme, tpm2.TPMAlgSHA256))
+	}
+	return templates.ECCSigner(templates.WithScheme(tpm2.TPMAlgECDSA, tpm2.TPMAlgSHA256))
+}
+
+func TestCertificate_MutualTLS(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	authority := newCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.cert)
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serverCert := tls.Certificate{
+		Certificate: [][]byte{authority.issue(t, "server.test", serverKey.Public(), x509.ExtKeyUsageServerAuth).Raw},
+		PrivateKey:  serverKey,
+	}
+
+	tests := []struct {
+		name     string
+		template tpm2.TPMTPublic
+		version  uint16
+	}{
+		{"ECDSA TLS 1.3", signingTemplate(tpm2.TPMAlgECC, 0), tls.VersionTLS13},
+		{"RSA TLS 1.3", signingTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgNull), tls.VersionTLS13},
+		{"RSASSA key TLS 1.2", signingTemplate(tpm2.TPMAlgRSA, tpm2.TPMAlgRSASSA), tls.VersionTLS12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := []byte("client-key")
+			key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tt.template, UserAuth: auth})
+			require.NoError(t, err)
+			defer key.Close()
+			signer, err := tpmsigner.New(thetpm, tpmsigner.Config{KeyHandle: key, Auth: auth})
+			require.NoError(t, err)
+			leaf := authority.issue(t, "device-42", signer.Public(), x509.ExtKeyUsageClientAuth)
+
+			clientCert, err := tpmtls.Certificate(thetpm, key, leaf, tpmtls.Config{Auth: auth})
+			require.NoError(t, err)
+
+			clientConn, serverConn := net.Pipe()
+			server := tls.Server(serverConn, &tls.Config{
+				Certificates: []tls.Certificate{serverCert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    roots,
+				MinVersion:   tt.version,
+				MaxVersion:   tt.version,
+			})
+			done := make(chan error, 1)
+			go func() {
+				defer server.Close()
+				done <- server.Handshake()
+			}()
+
+			client := tls.Client(clientConn, &tls.Config{
+				Certificates: []tls.Certificate{clientCert},
+				RootCAs:      roots,
+				ServerName:   "server.test",
+				MinVersion:   tt.version,
+				MaxVersion:   tt.version,
+			})
+			defer client.Close()
+			require.NoError(t, client.Handshake())
+			require.NoError(t, <-done)
+
+			peers := server.ConnectionState().PeerCertificates
+			require.Len(t, peers, 1)
+			require.Equal(t, "device-42", peers[0].Subject.CommonName)
+		})
+	}
+}
+
+func TestCertificate_KeyMismatch(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	authority := newCA(t)
+
+	key, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: signingTemplate(tpm2.TPMAlgECC, 0)})
+	require.NoError(t, err)
+	defer key.Close()
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = tpmtls.Certificate(thetpm, key, authority.issue(t, "other", other.Public(), x509.ExtKeyUsageClientAuth))
+	require.ErrorIs(t, err, tpmtls.ErrKeyMismatch)
+}
@@ -0,0 +1,215 @@
+// Package tracing provides a transport middleware which logs every command
+// sent to the TPM and its response.
+//
+// It shows in-process what a bus capture would show: the command headers and,
+// with [Config.Decode] and [Config.Hex], the decoded content and the raw
+// bytes, e.g. to check whether a secret travels in clear.
+package tracing
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/decode"
+)
+
+// Config holds configuration for [Wrap].
+type Config struct {
+	// Hex adds a hex dump of each command and response to the trace.
+	//
+	// Default: false.
+	Hex bool
+	// Decode adds the handles, sessions and known parameters of each
+	// command and response to the trace, as rendered by the decode package.
+	//
+	// Default: false.
+	Decode bool
+	// Pause makes the trace a step-by-step walkthrough: each command is
+	// decoded along with a summary of the parameters sent in clear and
+	// encrypted, then a line is read from Pause (e.g. os.Stdin) before the
+	// command is sent. Pausing stops when Pause reaches EOF.
+	//
+	// Default: nil.
+	Pause io.Reader
+}
+
+// tracer is the transport returned by [Wrap].
+type tracer struct {
+	tpm transport.TPM
+	cfg Config
+
+	mu    sync.Mutex
+	w     io.Writer
+	seq   int
+	pause *bufio.Reader
+}
+
+// Wrap returns a transport forwarding commands to tpm and writing a trace of
+// each command and response to w.
+//
+// Closing the returned transport closes tpm if it implements [io.Closer].
+//
+// Example:
+//
+//	thetpm = tracing.Wrap(thetpm, os.Stderr, tracing.Config{Hex: true})
+//
+// produces for each command:
+//
+//	#1 -> CreatePrimary tag=TPM_ST_SESSIONS size=67
+//	#1 <- TPM_RC_SUCCESS tag=TPM_ST_SESSIONS size=533 (1.2ms)
+func Wrap(tpm transport.TPM, w io.Writer, optionalCfg ...Config) transport.TPMCloser {
+	t := &tracer{tpm: tpm, w: w}
+	if len(optionalCfg) > 0 {
+		t.cfg = optionalCfg[0]
+	}
+	if t.cfg.Pause != nil {
+		t.cfg.Decode = true
+		t.pause = bufio.NewReader(t.cfg.Pause)
+	}
+	return t
+}
+
+// Send implements [transport.TPM].
+func (t *tracer) Send(cmd []byte) ([]byte, error) {
+	t.mu.Lock()
+	t.seq++
+	seq := t.seq
+	t.mu.Unlock()
+
+	t.traceCommand(seq, cmd)
+	if t.cfg.Pause != nil {
+		t.step(cmd)
+	}
+	start := time.Now()
+	rsp, err := t.tpm.Send(cmd)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.trace(fmt.Sprintf("#%d <- error: %v (%s)", seq, err, elapsed), nil, nil)
+		return nil, err
+	}
+	t.traceResponse(seq, cmd, rsp, elapsed)
+	return rsp, nil
+}
+
+// Close implements [transport.TPMCloser].
+func (t *tracer) Close() error {
+	if c, ok := t.tpm.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// trace writes a line, the decoded view and, if enabled, the hex dump of data.
+func (t *tracer) trace(line string, decoded fmt.Stringer, data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintln(t.w, line)
+	if t.cfg.Decode && decoded != nil {
+		fmt.Fprint(t.w, indent(decoded.String()))
+	}
+	if t.cfg.Hex && len(data) > 0 {
+		fmt.Fprint(t.w, hex.Dump(data))
+	}
+}
+
+func (t *tracer) traceCommand(seq int, cmd []byte) {
+	h, err := decode.ParseHeader(cmd)
+	if err != nil {
+		t.trace(fmt.Sprintf("#%d -> %v", seq, err), nil, cmd)
+		return
+	}
+	line := fmt.Sprintf("#%d -> %s tag=%s size=%d", seq, decode.CommandName(tpm2.TPMCC(h.Code)), decode.TagName(h.Tag), h.Size)
+	var decoded fmt.Stringer
+	if t.cfg.Decode {
+		if c, err := decode.ParseCommand(cmd); err == nil {
+			decoded = c
+		}
+	}
+	t.trace(line, decoded, cmd)
+}
+
+func (t *tracer) traceResponse(seq int, cmd, rsp []byte, elapsed time.Duration) {
+	h, err := decode.ParseHeader(rsp)
+	if err != nil {
+		t.trace(fmt.Sprintf("#%d <- %v (%s)", seq, err, elapsed), nil, rsp)
+		return
+	}
+	rc := "TPM_RC_SUCCESS"
+	if h.Code != uint32(tpm2.TPMRCSuccess) {
+		rc = tpm2.TPMRC(h.Code).Error()
+	}
+	line := fmt.Sprintf("#%d <- %s tag=%s size=%d (%s)", seq, rc, decode.TagName(h.Tag), h.Size, elapsed)
+	var decoded fmt.Stringer
+	if cmdHeader, err := decode.ParseHeader(cmd); t.cfg.Decode && err == nil {
+		if r, err := decode.ParseResponse(tpm2.TPMCC(cmdHeader.Code), rsp); err == nil {
+			decoded = r
+		}
+	}
+	t.trace(line, decoded, rsp)
+	if r, ok := decoded.(*decode.Response); ok && t.cfg.Pause != nil {
+		t.summarize(r.Fields, nil)
+	}
+}
+
+// step summarizes what cmd exposes on the bus and waits for the user, until
+// Pause reaches EOF.
+func (t *tracer) step(cmd []byte) {
+	if c, err := decode.ParseCommand(cmd); err == nil {
+		t.summarize(c.Fields, c.Sessions)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pause == nil {
+		return
+	}
+	fmt.Fprint(t.w, "   press Enter to send...")
+	if _, err := t.pause.ReadString('\n'); err != nil {
+		fmt.Fprintln(t.w)
+		t.pause = nil
+	}
+}
+
+// summarize writes which of the decoded parameters and authorizations travel
+// encrypted and which travel in clear.
+func (t *tracer) summarize(fields []decode.Field, sessions []decode.Session) {
+	var plaintext, encrypted []string
+	for _, s := range sessions {
+		if s.IsPassword() && len(s.HMAC) > 0 {
+			plaintext = append(plaintext, "password authorization")
+		}
+	}
+	for _, f := range fields {
+		if f.Encrypted {
+			encrypted = append(encrypted, f.Name)
+		} else if len(f.Value) > 0 {
+			plaintext = append(plaintext, f.Name)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(encrypted) > 0 {
+		fmt.Fprintf(t.w, "   [encrypted] %s\n", strings.Join(encrypted, ", "))
+	}
+	if len(plaintext) > 0 {
+		fmt.Fprintf(t.w, "   [in clear]  %s\n", strings.Join(plaintext, ", "))
+	}
+}
+
+// indent indents the lines of s, skipping the first one which repeats the
+// header already traced.
+func indent(s string) string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	var sb strings.Builder
+	for _, l := range lines[1:] {
+		sb.WriteString("   " + l + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,99 @@
+package tracing_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/tracing"
+	"github.com/stretchr/testify/require"
+)
+
+// nonCloser hides the Close method of a transport.
+type nonCloser struct {
+	transport.TPM
+}
+
+func TestWrap(t *testing.T) {
+	var buf bytes.Buffer
+	thetpm := tracing.Wrap(nonCloser{testutil.OpenSimulator(t)}, &buf)
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{InPublic: tpmutil.ECCSRKTemplate})
+	require.NoError(t, err)
+	require.NoError(t, srk.Close())
+
+	_, err = tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpmutil.ECCSRKTemplate,
+		Auth:     tpm2.PasswordAuth([]byte("wrong")),
+	})
+	require.Error(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 6)
+	require.Regexp(t, `^#1 -> CreatePrimary tag=TPM_ST_SESSIONS size=\d+$`, lines[0])
+	require.Regexp(t, `^#1 <- TPM_RC_SUCCESS tag=TPM_ST_SESSIONS size=\d+ \(.+\)$`, lines[1])
+	require.Regexp(t, `^#2 -> FlushContext tag=TPM_ST_NO_SESSIONS size=14$`, lines[2])
+	require.Regexp(t, `^#3 -> CreatePrimary `, lines[4])
+	require.Regexp(t, `^#3 <- TPM_RC_BAD_AUTH.* tag=TPM_ST_NO_SESSIONS size=10 `, lines[5])
+
+	require.NoError(t, thetpm.Close())
+}
+
+func TestWrap_Hex(t *testing.T) {
+	var buf bytes.Buffer
+	thetpm := tracing.Wrap(nonCloser{testutil.OpenSimulator(t)}, &buf, tracing.Config{Hex: true})
+
+	_, err := tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm)
+	require.NoError(t, err)
+
+	// GetRandom: tag, size (12) and command code 0x17b, then bytesRequested.
+	require.Contains(t, buf.String(), "-> GetRandom tag=TPM_ST_NO_SESSIONS size=12\n")
+	require.Contains(t, buf.String(), "00000000  80 01 00 00 00 0c 00 00  01 7b 00 08")
+}
+
+func TestWrap_Decode(t *testing.T) {
+	var buf bytes.Buffer
+	thetpm := tracing.Wrap(nonCloser{testutil.OpenSimulator(t)}, &buf, tracing.Config{Decode: true})
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpmutil.ECCSRKTemplate,
+		UserAuth: []byte("srk-password"),
+	})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	require.Contains(t, buf.String(), "     handle[0]: 0x40000001\n")
+	require.Contains(t, buf.String(), "     inSensitive.userAuth: \"srk-password\"\n")
+	require.Regexp(t, `#1 <- TPM_RC_SUCCESS .*\n     handle\[0\]: 0x80`, buf.String())
+}
+
+func TestWrap_Pause(t *testing.T) {
+	var buf bytes.Buffer
+	thetpm := tracing.Wrap(nonCloser{testutil.OpenSimulator(t)}, &buf, tracing.Config{
+		// Only the first command waits: the second one hits EOF and stops pausing.
+		Pause: strings.NewReader("\n"),
+	})
+
+	srk, err := tpmutil.CreatePrimary(thetpm, tpmutil.CreatePrimaryConfig{
+		InPublic: tpmutil.ECCSRKTemplate,
+		UserAuth: []byte("srk-password"),
+	})
+	require.NoError(t, err)
+	defer srk.Close()
+
+	_, err = tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm, tpm2.HMAC(tpm2.TPMAlgSHA256, 16,
+		tpm2.AESEncryption(128, tpm2.EncryptOut),
+		tpm2.Salted(srk.Handle(), *srk.Public()),
+	))
+	require.NoError(t, err)
+
+	out := buf.String()
+	require.Contains(t, out, "     inSensitive.userAuth: \"srk-password\"\n")
+	require.Contains(t, out, "   [in clear]  inSensitive.userAuth")
+	require.Contains(t, out, "   [encrypted] randomBytes\n")
+	require.Equal(t, 2, strings.Count(out, "press Enter to send..."))
+}
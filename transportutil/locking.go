@@ -0,0 +1,208 @@
+// Package transportutil provides helpers around [transport.TPM].
+package transportutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrTimeout is returned when a command doesn't complete, or can't be sent,
+// within [LockingConfig.Timeout].
+var ErrTimeout = errors.New("TPM command timed out")
+
+// LockingConfig holds configuration for [NewLocking].
+type LockingConfig struct {
+	// Timeout bounds the time a [Locking.Send] call waits for the TPM,
+	// including the time spent waiting for other callers. Zero means no
+	// timeout.
+	//
+	// A TPM can't abort a command: on timeout, the command keeps running and
+	// holds the transport until it completes, its response being discarded.
+	//
+	// Default: 0.
+	Timeout time.Duration
+}
+
+// Locking is a [transport.TPMCloser] serializing the commands sent to a TPM,
+// so that several goroutines can share one connection. go-tpm transports are
+// not safe for concurrent use.
+type Locking struct {
+	tpm transport.TPM
+	cfg LockingConfig
+	// sem is a mutex which can be acquired with a timeout.
+	sem chan struct{}
+}
+
+// NewLocking returns a Locking transport forwarding commands to tpm.
+//
+// Each command is sent atomically, but a command using inline sessions
+// (e.g. [tpm2.HMAC]) runs several commands which may interleave with other
+// goroutines' ones. Use [Locking.Do] to run a sequence of commands without
+// interruption.
+//
+// Example:
+//
+//	thetpm = transportutil.NewLocking(thetpm, transportutil.LockingConfig{Timeout: 10 * time.Second})
+func NewLocking(tpm transport.TPM, optionalCfg ...LockingConfig) *Locking {
+	l := &Locking{tpm: tpm, sem: make(chan struct{}, 1)}
+	if len(optionalCfg) > 0 {
+		l.cfg = optionalCfg[0]
+	}
+	return l
+}
+
+// Send implements [transport.TPM].
+func (l *Locking) Send(cmd []byte) ([]byte, error) {
+	ctx, cancel := l.context(context.Background())
+	defer cancel()
+	return l.send(ctx, cmd)
+}
+
+// WithContext returns a transport sending commands through l, which gives up
+// waiting for the TPM once ctx is done, e.g. to bound a slow RSA key
+// generation by the deadline of a request. [LockingConfig.Timeout] still
+// applies to each command.
+//
+// As with the timeout, the TPM can't abort a command: a cancelled command
+// keeps running and holds the transport until it completes, its response
+// being discarded. The error returned on cancellation wraps
+// [context.Cause](ctx), e.g. [context.DeadlineExceeded].
+//
+// Example:
+//
+//	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+//	defer cancel()
+//	srk, err := tpmutil.CreatePrimary(locking.WithContext(ctx), tpmutil.CreatePrimaryConfig{
+//	    InPublic: tpmutil.RSASRKTemplate,
+//	})
+func (l *Locking) WithContext(ctx context.Context) transport.TPM {
+	return &contextTPM{l: l, ctx: ctx}
+}
+
+// contextTPM is the transport returned by [Locking.WithContext].
+type contextTPM struct {
+	l   *Locking
+	ctx context.Context
+}
+
+// Send implements [transport.TPM].
+func (c *contextTPM) Send(cmd []byte) ([]byte, error) {
+	ctx, cancel := c.l.context(c.ctx)
+	defer cancel()
+	return c.l.send(ctx, cmd)
+}
+
+// send sends cmd once the transport is acquired, giving up when ctx is done.
+func (l *Locking) send(ctx context.Context, cmd []byte) ([]byte, error) {
+	if err := l.lock(ctx); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil {
+		defer l.unlock()
+		return l.tpm.Send(cmd)
+	}
+
+	type result struct {
+		rsp []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// Unlock once the TPM is done, even if the caller gave up.
+		defer l.unlock()
+		rsp, err := l.tpm.Send(cmd)
+		done <- result{rsp, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.rsp, r.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("TPM command abandoned: %w", context.Cause(ctx))
+	}
+}
+
+// Do runs fn with exclusive access to the TPM: commands sent by other
+// goroutines wait until fn returns. fn must send its commands to the tpm it
+// receives, not to l, which would deadlock; they are not subject to
+// [LockingConfig.Timeout].
+//
+// Example:
+//
+//	err := locking.Do(func(tpm transport.TPM) error {
+//		_, err := tpm2.Unseal{ItemHandle: item}.Execute(tpm, tpm2.HMAC(...))
+//		return err
+//	})
+func (l *Locking) Do(fn func(tpm transport.TPM) error) error {
+	return l.DoContext(context.Background(), fn)
+}
+
+// DoContext is like [Locking.Do], but gives up waiting for the transport
+// once ctx is done. Once fn runs, the commands it sends fail without being
+// sent after ctx is done, but a running command is never abandoned: fn keeps
+// exclusive access to the TPM until it returns, so that its commands can't
+// interleave with other goroutines' ones.
+func (l *Locking) DoContext(ctx context.Context, fn func(tpm transport.TPM) error) error {
+	lockCtx, cancel := l.context(ctx)
+	defer cancel()
+	if err := l.lock(lockCtx); err != nil {
+		return err
+	}
+	defer l.unlock()
+	return fn(checkedTPM{tpm: l.tpm, ctx: ctx})
+}
+
+// checkedTPM is a transport refusing to send commands once ctx is done.
+type checkedTPM struct {
+	tpm transport.TPM
+	ctx context.Context
+}
+
+// Send implements [transport.TPM].
+func (c checkedTPM) Send(cmd []byte) ([]byte, error) {
+	if c.ctx.Err() != nil {
+		return nil, fmt.Errorf("TPM command not sent: %w", context.Cause(c.ctx))
+	}
+	return c.tpm.Send(cmd)
+}
+
+// Close implements [transport.TPMCloser]. It waits for the running command,
+// then closes the wrapped TPM if it implements [io.Closer].
+func (l *Locking) Close() error {
+	l.sem <- struct{}{}
+	defer l.unlock()
+	if c, ok := l.tpm.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// context returns parent bounded by [LockingConfig.Timeout], if any.
+func (l *Locking) context(parent context.Context) (context.Context, context.CancelFunc) {
+	if l.cfg.Timeout <= 0 {
+		return parent, func() {}
+	}
+	return context.WithTimeoutCause(parent, l.cfg.Timeout, fmt.Errorf("%w after %s", ErrTimeout, l.cfg.Timeout))
+}
+
+// lock acquires the transport, giving up when ctx is done.
+func (l *Locking) lock(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w waiting for the TPM", context.Cause(ctx))
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w waiting for the TPM", context.Cause(ctx))
+	}
+}
+
+func (l *Locking) unlock() {
+	<-l.sem
+}
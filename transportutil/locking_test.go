@@ -0,0 +1,157 @@
+package transportutil_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/transportutil"
+	"github.com/stretchr/testify/require"
+)
+
+// exclusive is a transport failing the test when two commands overlap.
+type exclusive struct {
+	t       *testing.T
+	tpm     transport.TPM
+	running atomic.Int32
+	sent    atomic.Int32
+}
+
+func (e *exclusive) Send(cmd []byte) ([]byte, error) {
+	if e.running.Add(1) != 1 {
+		e.t.Error("concurrent commands")
+	}
+	defer e.running.Add(-1)
+	e.sent.Add(1)
+	time.Sleep(time.Millisecond)
+	return e.tpm.Send(cmd)
+}
+
+// blocking is a transport whose commands wait for release.
+type blocking struct {
+	release chan struct{}
+}
+
+func (b *blocking) Send([]byte) ([]byte, error) {
+	<-b.release
+	return nil, nil
+}
+
+func TestNewLocking(t *testing.T) {
+	wire := &exclusive{t: t, tpm: testutil.OpenSimulator(t)}
+	thetpm := transportutil.NewLocking(wire)
+
+	const goroutines, commands = 8, 5
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range commands {
+				_, err := tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm)
+				if !assertNoError(t, err) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, goroutines*commands, wire.sent.Load())
+}
+
+func TestLocking_Do(t *testing.T) {
+	wire := &exclusive{t: t, tpm: testutil.OpenSimulator(t)}
+	thetpm := transportutil.NewLocking(wire)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The inline session adds a StartAuthSession, which must not
+			// interleave with the other goroutines' commands.
+			err := thetpm.Do(func(tpm transport.TPM) error {
+				_, err := tpm2.GetRandom{BytesRequested: 8}.Execute(tpm, tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.AESEncryption(128, tpm2.EncryptOut)))
+				return err
+			})
+			assertNoError(t, err)
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 4*2, wire.sent.Load())
+}
+
+func TestLocking_Timeout(t *testing.T) {
+	wire := &blocking{release: make(chan struct{})}
+	thetpm := transportutil.NewLocking(wire, transportutil.LockingConfig{Timeout: 20 * time.Millisecond})
+
+	_, err := thetpm.Send([]byte{0})
+	require.ErrorIs(t, err, transportutil.ErrTimeout)
+
+	// The first command still holds the transport.
+	_, err = thetpm.Send([]byte{0})
+	require.ErrorIs(t, err, transportutil.ErrTimeout)
+	require.ErrorIs(t, thetpm.Do(func(transport.TPM) error { return nil }), transportutil.ErrTimeout)
+
+	close(wire.release)
+	_, err = thetpm.Send([]byte{0})
+	require.NoError(t, err)
+	require.NoError(t, thetpm.Close())
+}
+
+func TestLocking_WithContext(t *testing.T) {
+	wire := &blocking{release: make(chan struct{})}
+	thetpm := transportutil.NewLocking(wire)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := thetpm.WithContext(ctx).Send([]byte{0})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The abandoned command still holds the transport.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = thetpm.WithContext(ctx).Send([]byte{0})
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, thetpm.DoContext(ctx, func(transport.TPM) error { return nil }), context.Canceled)
+
+	close(wire.release)
+	_, err = thetpm.WithContext(context.Background()).Send([]byte{0})
+	require.NoError(t, err)
+	require.NoError(t, thetpm.Close())
+}
+
+func TestLocking_DoContext(t *testing.T) {
+	thetpm := transportutil.NewLocking(testutil.OpenSimulator(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := thetpm.DoContext(ctx, func(tpm transport.TPM) error {
+		if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); err != nil {
+			return err
+		}
+		cancel()
+		// Once ctx is done, commands are no longer sent.
+		_, err := tpm2.GetRandom{BytesRequested: 8}.Execute(tpm)
+		return err
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	// The transport is released.
+	_, err = tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm)
+	require.NoError(t, err)
+}
+
+// assertNoError reports err from a goroutine other than the test one, where
+// require can't be used.
+func assertNoError(t *testing.T, err error) bool {
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,218 @@
+package transportutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/decode"
+)
+
+// ErrReconnected is returned when the connection broke while sending a
+// command which can't be safely replayed: the connection is restored, but
+// the caller must check the TPM state before retrying.
+var ErrReconnected = errors.New("connection to the TPM lost and restored, command not replayed")
+
+// idempotentCommands are the commands replayed after a reconnection: sending
+// them twice has no effect on the TPM state.
+var idempotentCommands = map[tpm2.TPMCC]bool{
+	tpm2.TPMCCGetCapability:   true,
+	tpm2.TPMCCGetRandom:       true,
+	tpm2.TPMCCGetTestResult:   true,
+	tpm2.TPMCCReadClock:       true,
+	tpm2.TPMCCPCRRead:         true,
+	tpm2.TPMCCReadPublic:      true,
+	tpm2.TPMCCNVReadPublic:    true,
+	tpm2.TPMCCHash:            true,
+	tpm2.TPMCCTestParms:       true,
+	tpm2.TPMCCVerifySignature: true,
+}
+
+// ReconnectConfig holds configuration for [NewReconnecting].
+type ReconnectConfig struct {
+	// Dial opens a new connection to the TPM command port.
+	//
+	// Default: a TCP connection to the address given to [NewReconnecting].
+	Dial func() (io.ReadWriteCloser, error)
+	// MaxAttempts is the number of dials attempted after a connection
+	// broke, before giving up.
+	//
+	// Default: 5.
+	MaxAttempts int
+	// Backoff is the wait before the first dial attempt, doubled after each
+	// failed attempt.
+	//
+	// Default: 100ms.
+	Backoff time.Duration
+	// MaxBackoff caps the wait between two dial attempts.
+	//
+	// Default: 2s.
+	MaxBackoff time.Duration
+	// Startup issues TPM2_Startup(TPM_SU_CLEAR) after reconnecting, for
+	// simulators restarted without --flags startup-clear. A TPM already
+	// started answers TPM_RC_INITIALIZE, which is ignored.
+	//
+	// Default: false.
+	Startup bool
+}
+
+// CheckAndSetDefault validates and sets default values for ReconnectConfig.
+func (c *ReconnectConfig) CheckAndSetDefault() error {
+	if c.MaxAttempts < 0 || c.Backoff < 0 || c.MaxBackoff < 0 {
+		return fmt.Errorf("invalid reconnect configuration: negative value")
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = 5
+	}
+	if c.Backoff == 0 {
+		c.Backoff = 100 * time.Millisecond
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = 2 * time.Second
+	}
+	return nil
+}
+
+// Reconnecting is a [transport.TPMCloser] to a TPM reached over a stream
+// connection, typically the command port of swtpm, which survives the loss
+// of the connection.
+//
+// When sending a command fails with a connection error, it dials again with
+// an exponential backoff, then replays the command if it is idempotent and
+// authorized by no session, or else returns [ErrReconnected]. Handles of
+// sessions and transient objects may not survive a TPM restart.
+//
+// It is safe for concurrent use.
+type Reconnecting struct {
+	cfg ReconnectConfig
+
+	mu   sync.Mutex
+	conn io.ReadWriteCloser
+	tpm  transport.TPM
+}
+
+// NewReconnecting connects to the TPM listening at addr (host:port) and
+// returns a transport reconnecting to it when the connection breaks.
+//
+// Example:
+//
+//	thetpm, err := transportutil.NewReconnecting("127.0.0.1:2321", transportutil.ReconnectConfig{Startup: true})
+func NewReconnecting(addr string, optionalCfg ...ReconnectConfig) (*Reconnecting, error) {
+	var cfg ReconnectConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if cfg.Dial == nil {
+		cfg.Dial = func() (io.ReadWriteCloser, error) {
+			return net.DialTimeout("tcp", addr, 5*time.Second)
+		}
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	r := &Reconnecting{cfg: cfg}
+	if err := r.connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to the TPM: %w", err)
+	}
+	return r, nil
+}
+
+// Send implements [transport.TPM].
+func (r *Reconnecting) Send(cmd []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tpm == nil {
+		if err := r.reconnect(); err != nil {
+			return nil, err
+		}
+	}
+	rsp, err := r.tpm.Send(cmd)
+	if err == nil || !isConnError(err) {
+		return rsp, err
+	}
+	if err := r.reconnect(); err != nil {
+		return nil, err
+	}
+	if !replayable(cmd) {
+		return nil, ErrReconnected
+	}
+	return r.tpm.Send(cmd)
+}
+
+// Close implements [transport.TPMCloser].
+func (r *Reconnecting) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn, r.tpm = nil, nil
+	return err
+}
+
+// connect dials the TPM once.
+func (r *Reconnecting) connect() error {
+	conn, err := r.cfg.Dial()
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	r.tpm = transport.FromReadWriteCloser(conn)
+	return nil
+}
+
+// reconnect replaces the broken connection, retrying with backoff.
+func (r *Reconnecting) reconnect() error {
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn, r.tpm = nil, nil
+	}
+	backoff := r.cfg.Backoff
+	var err error
+	for range r.cfg.MaxAttempts {
+		time.Sleep(backoff)
+		if err = r.connect(); err == nil {
+			break
+		}
+		backoff = min(2*backoff, r.cfg.MaxBackoff)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reconnect to the TPM after %d attempts: %w", r.cfg.MaxAttempts, err)
+	}
+	if r.cfg.Startup {
+		_, err := tpm2.Startup{StartupType: tpm2.TPMSUClear}.Execute(r.tpm)
+		if err != nil && !errors.Is(err, tpm2.TPMRCInitialize) {
+			return fmt.Errorf("failed to start the TPM up: %w", err)
+		}
+	}
+	return nil
+}
+
+// isConnError reports whether err means the connection is broken.
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.As(err, &netErr)
+}
+
+// replayable reports whether cmd is an idempotent command without sessions.
+func replayable(cmd []byte) bool {
+	h, err := decode.ParseHeader(cmd)
+	if err != nil || h.Tag != tpm2.TPMSTNoSessions {
+		return false
+	}
+	return idempotentCommands[tpm2.TPMCC(h.Code)]
+}
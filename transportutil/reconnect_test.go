@@ -0,0 +1,161 @@
+package transportutil_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/transportutil"
+	"github.com/stretchr/testify/require"
+)
+
+// server exposes a TPM on a TCP port, like the swtpm command port, and can
+// drop the connections to simulate a network failure.
+type server struct {
+	ln  net.Listener
+	tpm transport.TPM
+
+	mu      sync.Mutex
+	conns   []net.Conn
+	accepts int
+	// dropNext closes the connection instead of answering the next command.
+	dropNext bool
+}
+
+func newServer(t *testing.T) *server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &server{ln: ln, tpm: testutil.OpenSimulator(t)}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *server) addr() string { return s.ln.Addr().String() }
+
+func (s *server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.accepts++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		header := make([]byte, 10)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		cmd := make([]byte, binary.BigEndian.Uint32(header[2:6]))
+		copy(cmd, header)
+		if _, err := io.ReadFull(conn, cmd[10:]); err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		drop := s.dropNext
+		s.dropNext = false
+		s.mu.Unlock()
+		if drop {
+			return
+		}
+
+		rsp, err := s.tpm.Send(cmd)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(rsp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *server) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropNext = true
+}
+
+func (s *server) acceptCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepts
+}
+
+func TestNewReconnecting(t *testing.T) {
+	srv := newServer(t)
+	thetpm, err := transportutil.NewReconnecting(srv.addr(), transportutil.ReconnectConfig{
+		Backoff: time.Millisecond,
+		Startup: true,
+	})
+	require.NoError(t, err)
+	defer thetpm.Close()
+
+	_, err = tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm)
+	require.NoError(t, err)
+	require.Equal(t, 1, srv.acceptCount())
+
+	t.Run("IdempotentCommandReplayed", func(t *testing.T) {
+		srv.drop()
+		rsp, err := tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm)
+		require.NoError(t, err)
+		require.Len(t, rsp.RandomBytes.Buffer, 8)
+	})
+
+	t.Run("OtherCommandNotReplayed", func(t *testing.T) {
+		srv.drop()
+		_, err := tpm2.CreatePrimary{
+			PrimaryHandle: tpm2.TPMRHOwner,
+			InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+		}.Execute(thetpm)
+		require.ErrorIs(t, err, transportutil.ErrReconnected)
+
+		// The connection is usable again.
+		_, err = tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm)
+		require.NoError(t, err)
+	})
+
+	require.Equal(t, 3, srv.acceptCount())
+}
+
+func TestNewReconnecting_GiveUp(t *testing.T) {
+	srv := newServer(t)
+	thetpm, err := transportutil.NewReconnecting(srv.addr(), transportutil.ReconnectConfig{
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer thetpm.Close()
+
+	require.NoError(t, srv.ln.Close())
+	srv.drop()
+	_, err = tpm2.GetRandom{BytesRequested: 8}.Execute(thetpm)
+	require.ErrorContains(t, err, "after 2 attempts")
+}
+
+func TestNewReconnecting_Unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	_, err = transportutil.NewReconnecting(addr)
+	require.Error(t, err)
+
+	_, err = transportutil.NewReconnecting(addr, transportutil.ReconnectConfig{MaxAttempts: -1})
+	require.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package transportutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// retryCodes are the warnings after which a command is sent again unchanged.
+// The TPM didn't run the command, so its sessions are left untouched and the
+// same authorization HMACs remain valid.
+var retryCodes = map[tpm2.TPMRC]bool{
+	// The TPM was busy with another task, e.g. a write to its NV memory.
+	tpm2.TPMRCRetry: true,
+	// The TPM is running its self-test on the algorithms the command needs.
+	tpm2.TPMRCTesting: true,
+	// The TPM suspended the command to run a higher priority one.
+	tpm2.TPMRCYielded: true,
+}
+
+// RetryConfig holds configuration for [NewRetrying].
+type RetryConfig struct {
+	// MaxRetries is the number of times a command is sent again after a
+	// transient warning, before the warning is returned to the caller.
+	//
+	// Default: 5.
+	MaxRetries int
+	// Backoff is the wait before the first retry, doubled after each retry.
+	//
+	// Default: 20ms.
+	Backoff time.Duration
+	// MaxBackoff caps the wait between two retries.
+	//
+	// Default: 1s.
+	MaxBackoff time.Duration
+}
+
+// CheckAndSetDefault validates and sets default values for RetryConfig.
+func (c *RetryConfig) CheckAndSetDefault() error {
+	if c.MaxRetries < 0 || c.Backoff < 0 || c.MaxBackoff < 0 {
+		return fmt.Errorf("invalid retry configuration: negative value")
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 5
+	}
+	if c.Backoff == 0 {
+		c.Backoff = 20 * time.Millisecond
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = time.Second
+	}
+	return nil
+}
+
+// Retrying is a [transport.TPMCloser] sending a command again, with an
+// exponential backoff, when the TPM answers with a transient warning:
+// TPM_RC_RETRY, TPM_RC_TESTING or TPM_RC_YIELDED. Hardware TPMs return them
+// under load or right after startup, while simulators never do.
+//
+// Once the retries are exhausted, the last warning is returned as the
+// response of the command. Retrying isn't safe for concurrent use: wrap it
+// in a [Locking] transport to share it.
+type Retrying struct {
+	tpm transport.TPM
+	cfg RetryConfig
+}
+
+// NewRetrying returns a Retrying transport forwarding commands to tpm.
+//
+// Example:
+//
+//	device, err := linuxtpm.Open("/dev/tpmrm0")
+//	if err != nil {
+//	    return err
+//	}
+//	thetpm, err := transportutil.NewRetrying(device, transportutil.RetryConfig{MaxRetries: 10})
+func NewRetrying(tpm transport.TPM, optionalCfg ...RetryConfig) (*Retrying, error) {
+	var cfg RetryConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, err
+	}
+	return &Retrying{tpm: tpm, cfg: cfg}, nil
+}
+
+// Send implements [transport.TPM].
+func (r *Retrying) Send(cmd []byte) ([]byte, error) {
+	backoff := r.cfg.Backoff
+	for retry := 0; ; retry++ {
+		rsp, err := r.tpm.Send(cmd)
+		if err != nil || retry == r.cfg.MaxRetries || !retryCodes[responseCode(rsp)] {
+			return rsp, err
+		}
+		time.Sleep(backoff)
+		backoff = min(2*backoff, r.cfg.MaxBackoff)
+	}
+}
+
+// Close implements [transport.TPMCloser]. It closes the wrapped TPM if it
+// implements [io.Closer].
+func (r *Retrying) Close() error {
+	if c, ok := r.tpm.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// responseCode returns the response code of rsp, or TPM_RC_SUCCESS when rsp
+// is too short to hold one.
+func responseCode(rsp []byte) tpm2.TPMRC {
+	if len(rsp) < 10 {
+		return tpm2.TPMRCSuccess
+	}
+	return tpm2.TPMRC(binary.BigEndian.Uint32(rsp[6:10]))
+}
@@ -0,0 +1,96 @@
+package transportutil_test
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/transportutil"
+	"github.com/stretchr/testify/require"
+)
+
+// flaky answers the commands with code with the queued warnings, then
+// forwards them to the TPM.
+type flaky struct {
+	tpm      transport.TPM
+	code     tpm2.TPMCC
+	warnings []tpm2.TPMRC
+	sent     int
+}
+
+func (f *flaky) Send(cmd []byte) ([]byte, error) {
+	if tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:10])) != f.code {
+		return f.tpm.Send(cmd)
+	}
+	f.sent++
+	if len(f.warnings) == 0 {
+		return f.tpm.Send(cmd)
+	}
+	rc := f.warnings[0]
+	f.warnings = f.warnings[1:]
+	rsp := binary.BigEndian.AppendUint16(nil, uint16(tpm2.TPMSTNoSessions))
+	rsp = binary.BigEndian.AppendUint32(rsp, 10)
+	return binary.BigEndian.AppendUint32(rsp, uint32(rc)), nil
+}
+
+func newRetrying(t *testing.T, tpm transport.TPM, maxRetries int) *transportutil.Retrying {
+	r, err := transportutil.NewRetrying(tpm, transportutil.RetryConfig{
+		MaxRetries: maxRetries,
+		Backoff:    time.Millisecond,
+	})
+	require.NoError(t, err)
+	return r
+}
+
+func TestRetrying(t *testing.T) {
+	simulator := testutil.OpenSimulator(t)
+
+	for _, rc := range []tpm2.TPMRC{tpm2.TPMRCRetry, tpm2.TPMRCTesting, tpm2.TPMRCYielded} {
+		t.Run(rc.Error(), func(t *testing.T) {
+			wire := &flaky{tpm: simulator, code: tpm2.TPMCCGetRandom, warnings: []tpm2.TPMRC{rc, rc}}
+			rsp, err := tpm2.GetRandom{BytesRequested: 8}.Execute(newRetrying(t, wire, 5))
+			require.NoError(t, err)
+			require.Len(t, rsp.RandomBytes.Buffer, 8)
+			require.Equal(t, 3, wire.sent)
+		})
+	}
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		wire := &flaky{tpm: simulator, code: tpm2.TPMCCGetRandom, warnings: make([]tpm2.TPMRC, 5)}
+		for i := range wire.warnings {
+			wire.warnings[i] = tpm2.TPMRCRetry
+		}
+		_, err := tpm2.GetRandom{BytesRequested: 8}.Execute(newRetrying(t, wire, 2))
+		require.ErrorIs(t, err, tpm2.TPMRCRetry)
+		require.Equal(t, 3, wire.sent)
+	})
+
+	t.Run("other warning", func(t *testing.T) {
+		wire := &flaky{tpm: simulator, code: tpm2.TPMCCGetRandom, warnings: []tpm2.TPMRC{tpm2.TPMRCLockout}}
+		_, err := tpm2.GetRandom{BytesRequested: 8}.Execute(newRetrying(t, wire, 5))
+		require.ErrorIs(t, err, tpm2.TPMRCLockout)
+		require.Equal(t, 1, wire.sent)
+	})
+
+	t.Run("command with session", func(t *testing.T) {
+		// The TPM didn't process the warned commands: the HMAC computed for
+		// the first attempt is still valid.
+		wire := &flaky{tpm: simulator, code: tpm2.TPMCCCreatePrimary, warnings: []tpm2.TPMRC{tpm2.TPMRCRetry}}
+		key, err := tpmutil.CreatePrimary(newRetrying(t, wire, 5), tpmutil.CreatePrimaryConfig{
+			Auth:     tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.AESEncryption(128, tpm2.EncryptOut)),
+			InPublic: tpm2.ECCSRKTemplate,
+		})
+		require.NoError(t, err)
+		require.NoError(t, key.Close())
+		require.Equal(t, 2, wire.sent)
+	})
+}
+
+func TestNewRetrying_InvalidConfig(t *testing.T) {
+	_, err := transportutil.NewRetrying(testutil.OpenSimulator(t), transportutil.RetryConfig{MaxRetries: -1})
+	require.Error(t, err)
+}
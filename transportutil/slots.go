@@ -0,0 +1,296 @@
+package transportutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/decode"
+)
+
+// virtualHandleBase is the first virtual handle given to the transient
+// objects by [SlotManager], high in the transient range while TPMs allocate
+// their handles from its bottom.
+const virtualHandleBase tpm2.TPMHandle = 0x80ff0000
+
+// slot is a transient object or a session managed by [SlotManager].
+type slot struct {
+	// handle is the handle of the loaded object or session, 0 while swapped
+	// out. Session handles don't change when they are loaded back.
+	handle tpm2.TPMHandle
+	// saved is the context of the swapped out object or session.
+	saved *tpm2.TPMSContext
+	// used orders the slots by last use.
+	used uint64
+}
+
+// SlotManager is a [transport.TPMCloser] working around the few transient
+// object and session slots of a TPM (usually 3), for the users of a raw TPM
+// device such as /dev/tpm0 who can't rely on the kernel resource manager.
+//
+// When a command fails with TPM_RC_OBJECT_MEMORY or TPM_RC_SESSION_MEMORY, the
+// least recently used object or session the command doesn't reference is
+// swapped out (TPM2_ContextSave) and the command sent again. A swapped out
+// object or session is loaded back (TPM2_ContextLoad) when a command
+// references it.
+//
+// Objects get a new handle each time they are loaded: the manager hands out
+// virtual handles instead, translated in the handle areas of commands and
+// responses. Sessions keep their handle. Only the objects and sessions
+// created through the manager are managed: the others are passed through,
+// as are the handles listed by TPM2_GetCapability, which are the TPM ones.
+//
+// SlotManager isn't safe for concurrent use: wrap it in a [Locking]
+// transport to share it.
+type SlotManager struct {
+	tpm transport.TPM
+
+	mu sync.Mutex
+	// objects are indexed by virtual handle, sessions by handle.
+	objects  map[tpm2.TPMHandle]*slot
+	sessions map[tpm2.TPMHandle]*slot
+	next     tpm2.TPMHandle
+	clock    uint64
+}
+
+// NewSlotManager returns a SlotManager forwarding commands to tpm.
+//
+// Example:
+//
+//	device, err := linuxtpm.Open("/dev/tpm0")
+//	if err != nil {
+//	    return err
+//	}
+//	thetpm := transportutil.NewSlotManager(device)
+//	defer thetpm.Close()
+func NewSlotManager(tpm transport.TPM) *SlotManager {
+	return &SlotManager{
+		tpm:      tpm,
+		objects:  make(map[tpm2.TPMHandle]*slot),
+		sessions: make(map[tpm2.TPMHandle]*slot),
+		next:     virtualHandleBase,
+	}
+}
+
+// Send implements [transport.TPM].
+func (m *SlotManager) Send(cmd []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, err := decode.ParseCommand(cmd)
+	if err != nil {
+		return m.tpm.Send(cmd)
+	}
+	cc := c.CommandCode()
+	if _, _, ok := decode.HandleCounts(cc); !ok {
+		// The handles can't be told apart from the parameters.
+		return m.tpm.Send(cmd)
+	}
+	if cc == tpm2.TPMCCFlushContext && len(c.Handles) == 1 {
+		return m.flush(cmd, c.Handles[0])
+	}
+
+	// The slots referenced by the command must stay loaded while making
+	// room for each other.
+	var inUse []tpm2.TPMHandle
+	inUse = append(inUse, c.Handles...)
+	for _, s := range c.Sessions {
+		inUse = append(inUse, s.Handle)
+	}
+	out := slices.Clone(cmd)
+	for i, h := range c.Handles {
+		loaded, err := m.load(h, inUse)
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint32(out[10+4*i:], uint32(loaded))
+	}
+	for _, s := range c.Sessions {
+		if _, err := m.load(s.Handle, inUse); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		rsp, err := m.tpm.Send(out)
+		if err != nil {
+			return nil, err
+		}
+		switch responseCode(rsp) {
+		case tpm2.TPMRCSuccess:
+			return m.track(c, rsp)
+		case tpm2.TPMRCObjectMemory, tpm2.TPMRCSessionMemory:
+			// The TPM didn't run the command: it can be sent again unchanged
+			// once a slot is free.
+			swapped, err := m.swapOut(responseCode(rsp), inUse)
+			if err != nil {
+				return nil, err
+			}
+			if !swapped {
+				return rsp, nil
+			}
+		default:
+			return rsp, nil
+		}
+	}
+}
+
+// Close implements [transport.TPMCloser]. Like the kernel resource manager
+// when a file descriptor is closed, it flushes the objects and sessions it
+// manages, then closes the wrapped TPM if it implements [io.Closer].
+func (m *SlotManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, s := range m.objects {
+		if s.handle != 0 {
+			errs = append(errs, m.flushHandle(s.handle))
+		}
+	}
+	// Swapped out sessions are flushed by handle too.
+	for h := range m.sessions {
+		errs = append(errs, m.flushHandle(h))
+	}
+	clear(m.objects)
+	clear(m.sessions)
+	if c, ok := m.tpm.(io.Closer); ok {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// load makes sure the object or session h is loaded, swapping out another
+// slot not listed in inUse if needed, and returns its TPM handle. Unmanaged
+// handles are returned unchanged.
+func (m *SlotManager) load(h tpm2.TPMHandle, inUse []tpm2.TPMHandle) (tpm2.TPMHandle, error) {
+	s, ok := m.objects[h]
+	if !ok {
+		if s, ok = m.sessions[h]; !ok {
+			return h, nil
+		}
+	}
+	m.clock++
+	s.used = m.clock
+	for s.handle == 0 {
+		rsp, err := tpm2.ContextLoad{Context: *s.saved}.Execute(m.tpm)
+		if err == nil {
+			s.handle, s.saved = rsp.LoadedHandle, nil
+			break
+		}
+		var rc tpm2.TPMRC
+		if !errors.As(err, &rc) || (rc != tpm2.TPMRCObjectMemory && rc != tpm2.TPMRCSessionMemory) {
+			return 0, fmt.Errorf("failed to load context of 0x%x: %w", h, err)
+		}
+		swapped, err := m.swapOut(rc, inUse)
+		if err != nil {
+			return 0, err
+		}
+		if !swapped {
+			return 0, fmt.Errorf("failed to load context of 0x%x: %w", h, rc)
+		}
+	}
+	return s.handle, nil
+}
+
+// swapOut saves the context of the least recently used object, for
+// TPM_RC_OBJECT_MEMORY, or session, for TPM_RC_SESSION_MEMORY, not listed in
+// inUse. It reports false when there is no such slot.
+func (m *SlotManager) swapOut(rc tpm2.TPMRC, inUse []tpm2.TPMHandle) (bool, error) {
+	slots := m.objects
+	if rc == tpm2.TPMRCSessionMemory {
+		slots = m.sessions
+	}
+	var lru *slot
+	for h, s := range slots {
+		if s.handle == 0 || slices.Contains(inUse, h) {
+			continue
+		}
+		if lru == nil || s.used < lru.used {
+			lru = s
+		}
+	}
+	if lru == nil {
+		return false, nil
+	}
+
+	rsp, err := tpm2.ContextSave{SaveHandle: lru.handle}.Execute(m.tpm)
+	if err != nil {
+		return false, fmt.Errorf("failed to save context of 0x%x: %w", lru.handle, err)
+	}
+	// Saving a session frees its slot, while an object must be flushed.
+	if rc == tpm2.TPMRCObjectMemory {
+		if err := m.flushHandle(lru.handle); err != nil {
+			return false, err
+		}
+	}
+	lru.handle, lru.saved = 0, &rsp.Context
+	return true, nil
+}
+
+// track updates the managed slots after the command c succeeded, and
+// returns its response rsp with the virtual handles of the new objects.
+func (m *SlotManager) track(c *decode.Command, rsp []byte) ([]byte, error) {
+	// A session without continueSession is flushed by the TPM once used.
+	for _, s := range c.Sessions {
+		if !s.ContinueSession() {
+			delete(m.sessions, s.Handle)
+		}
+	}
+	// A session saved by the caller is no longer loaded: the caller loads it
+	// back itself.
+	if c.CommandCode() == tpm2.TPMCCContextSave && len(c.Handles) == 1 {
+		delete(m.sessions, c.Handles[0])
+	}
+
+	_, n, _ := decode.HandleCounts(c.CommandCode())
+	if len(rsp) < 10+4*n {
+		return rsp, nil
+	}
+	rsp = slices.Clone(rsp)
+	for i := range n {
+		h := tpm2.TPMHandle(binary.BigEndian.Uint32(rsp[10+4*i:]))
+		m.clock++
+		switch tpm2.TPMHT(h >> 24) {
+		case tpm2.TPMHTTransient:
+			virtual := m.next
+			m.next++
+			m.objects[virtual] = &slot{handle: h, used: m.clock}
+			binary.BigEndian.PutUint32(rsp[10+4*i:], uint32(virtual))
+		case tpm2.TPMHTHMACSession, tpm2.TPMHTPolicySession:
+			m.sessions[h] = &slot{handle: h, used: m.clock}
+		}
+	}
+	return rsp, nil
+}
+
+// flush runs TPM2_FlushContext for h. A swapped out object is only
+// forgotten.
+func (m *SlotManager) flush(cmd []byte, h tpm2.TPMHandle) ([]byte, error) {
+	if s, ok := m.objects[h]; ok {
+		delete(m.objects, h)
+		if s.handle == 0 {
+			rsp := binary.BigEndian.AppendUint16(nil, uint16(tpm2.TPMSTNoSessions))
+			rsp = binary.BigEndian.AppendUint32(rsp, 10)
+			return binary.BigEndian.AppendUint32(rsp, uint32(tpm2.TPMRCSuccess)), nil
+		}
+		cmd = slices.Clone(cmd)
+		binary.BigEndian.PutUint32(cmd[10:], uint32(s.handle))
+	}
+	// The TPM flushes a session by handle whether it is loaded or saved.
+	delete(m.sessions, h)
+	return m.tpm.Send(cmd)
+}
+
+// flushHandle flushes the loaded object or the session h.
+func (m *SlotManager) flushHandle(h tpm2.TPMHandle) error {
+	if _, err := (tpm2.FlushContext{FlushHandle: h}).Execute(m.tpm); err != nil {
+		return fmt.Errorf("failed to flush 0x%x: %w", h, err)
+	}
+	return nil
+}
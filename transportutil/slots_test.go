@@ -0,0 +1,133 @@
+package transportutil_test
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/handles"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/transportutil"
+	"github.com/stretchr/testify/require"
+)
+
+// The simulator holds 3 transient objects and 3 loaded sessions: the tests
+// use more.
+const slotCount = 5
+
+func TestSlotManager_Objects(t *testing.T) {
+	simulator := testutil.OpenSimulator(t)
+	tpm := transportutil.NewSlotManager(simulator)
+
+	var keys []*tpm2.CreatePrimaryResponse
+	for i := range slotCount {
+		// A distinct unique field gives a distinct primary key.
+		template := tpm2.ECCSRKTemplate
+		template.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+			X: tpm2.TPM2BECCParameter{Buffer: []byte{byte(i)}},
+		})
+		rsp, err := tpm2.CreatePrimary{
+			PrimaryHandle: tpm2.TPMRHOwner,
+			InPublic:      tpm2.New2B(template),
+		}.Execute(tpm)
+		require.NoError(t, err)
+		keys = append(keys, rsp)
+	}
+
+	// Each key is loaded back on demand, under its virtual handle.
+	for _, key := range keys {
+		pub, err := tpm2.ReadPublic{ObjectHandle: key.ObjectHandle}.Execute(tpm)
+		require.NoError(t, err)
+		require.Equal(t, key.Name, pub.Name)
+	}
+
+	// A command referencing a swapped out parent and creating an object.
+	parent := tpm2.AuthHandle{Handle: keys[0].ObjectHandle, Name: keys[0].Name, Auth: tpm2.PasswordAuth(nil)}
+	child, err := tpm2.Create{
+		ParentHandle: parent,
+		InPublic:     tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(tpm)
+	require.NoError(t, err)
+	loaded, err := tpm2.Load{
+		ParentHandle: parent,
+		InPrivate:    child.OutPrivate,
+		InPublic:     child.OutPublic,
+	}.Execute(tpm)
+	require.NoError(t, err)
+
+	// Flushing a swapped out object only forgets it.
+	for _, key := range keys {
+		_, err := tpm2.FlushContext{FlushHandle: key.ObjectHandle}.Execute(tpm)
+		require.NoError(t, err)
+	}
+	_, err = tpm2.FlushContext{FlushHandle: loaded.ObjectHandle}.Execute(tpm)
+	require.NoError(t, err)
+	left, err := handles.Loaded(simulator)
+	require.NoError(t, err)
+	require.Empty(t, left)
+}
+
+func TestSlotManager_Sessions(t *testing.T) {
+	simulator := testutil.OpenSimulator(t)
+	tpm := transportutil.NewSlotManager(simulator)
+
+	var sessions []tpm2.Session
+	for range slotCount {
+		sess, closer, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16, tpm2.Audit())
+		require.NoError(t, err)
+		t.Cleanup(func() { closer() }) //nolint:errcheck
+		sessions = append(sessions, sess)
+	}
+
+	// Sessions are used twice, swapped out in between.
+	for range 2 {
+		for _, sess := range sessions {
+			_, err := tpm2.GetRandom{BytesRequested: 8}.Execute(tpm, sess)
+			require.NoError(t, err)
+		}
+	}
+
+	// Inline sessions, flushed by the TPM after the command, take a slot too.
+	_, err := tpm2.GetRandom{BytesRequested: 8}.Execute(tpm, tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Audit()))
+	require.NoError(t, err)
+}
+
+func TestSlotManager_Close(t *testing.T) {
+	simulator := testutil.OpenSimulator(t)
+	// Hiding the Close method of the simulator keeps it open after the
+	// manager is closed.
+	tpm := transportutil.NewSlotManager(struct{ transport.TPM }{simulator})
+
+	for range slotCount {
+		_, _, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16)
+		require.NoError(t, err)
+	}
+	_, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(tpm)
+	require.NoError(t, err)
+
+	require.NoError(t, tpm.Close())
+	left, err := handles.Loaded(simulator)
+	require.NoError(t, err)
+	require.Empty(t, left)
+}
+
+func TestSlotManager_Unmanaged(t *testing.T) {
+	simulator := testutil.OpenSimulator(t)
+
+	// Objects loaded without the manager can't be swapped out.
+	for range 3 {
+		_, err := tpm2.CreatePrimary{
+			PrimaryHandle: tpm2.TPMRHOwner,
+			InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+		}.Execute(simulator)
+		require.NoError(t, err)
+	}
+	_, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(transportutil.NewSlotManager(simulator))
+	require.ErrorIs(t, err, tpm2.TPMRCObjectMemory)
+}
@@ -0,0 +1,213 @@
+package unseal
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+	"github.com/loicsikidi/tpm-stuff/metrics"
+	"github.com/loicsikidi/tpm-stuff/names"
+)
+
+// MigrateConfig holds configuration for [Migrate].
+type MigrateConfig struct {
+	// Parent is the storage key under which the secret is sealed. It is
+	// unused when the sealed object is persistent.
+	//
+	// Default: the ECC SRK persisted at provision.SRKHandle, provisioned on
+	// first use (see provision.EnsureSRK).
+	Parent tpmutil.Handle
+	// Logger logs the commands sent to the TPM (see metrics.Logger).
+	//
+	// Default: nil, no logging.
+	Logger *slog.Logger
+}
+
+// CheckAndSetDefault validates and sets default values for MigrateConfig.
+func (c *MigrateConfig) CheckAndSetDefault() error {
+	return nil
+}
+
+// Migrate duplicates the sealed object of blob, sealed with
+// [SealConfig.DuplicateTo], to the storage key whose public area is
+// newParentPub, and returns a blob unsealed under that key, on this TPM or
+// on the TPM holding it. The PCR policy of blob, if any, still applies.
+//
+// The sealed object is wrapped with the seed of the new parent only (no inner
+// wrapper): the duplication policy of the object ensures that only the
+// new parent can import it.
+//
+// Example:
+//
+//	// On the device: seal to the escrow key.
+//	blob, err := unseal.Seal(tpm, diskKey, unseal.SealConfig{DuplicateTo: escrowPub})
+//	escrowed, err := unseal.Migrate(tpm, blob, *escrowPub)
+//
+//	// On the escrow TPM.
+//	diskKey, err := unseal.Unseal(escrowTPM, escrowed, unseal.UnsealConfig{Parent: escrowKey})
+func Migrate(tpm transport.TPM, blob *Blob, newParentPub tpm2.TPMTPublic, optionalCfg ...MigrateConfig) (*Blob, error) {
+	var cfg MigrateConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if blob == nil {
+		return nil, errors.New("missing blob")
+	}
+	if err := blob.check(); err != nil {
+		return nil, err
+	}
+	tpm = metrics.WithLogger(tpm, cfg.Logger, "migrate")
+	if blob.Duplication == nil {
+		return nil, ErrNotDuplicable
+	}
+	if err := names.Verify(blob.Duplication.ParentName, newParentPub); err != nil {
+		return nil, fmt.Errorf("new parent isn't the duplication parent of the blob: %w", err)
+	}
+
+	var sealed tpmutil.Handle
+	if blob.IsPersistent() {
+		h, err := persistentObject(tpm, blob)
+		if err != nil {
+			return nil, err
+		}
+		sealed = h
+	} else {
+		parent, err := parentOrSRK(tpm, cfg.Parent)
+		if err != nil {
+			return nil, err
+		}
+		loaded, err := load(tpm, parent, blob)
+		if err != nil {
+			return nil, err
+		}
+		defer loaded.Close()
+		sealed = loaded
+	}
+	public, err := tpm2.ReadPublic{ObjectHandle: sealed.Handle()}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sealed object public area: %w", tpmerrors.Wrap(err))
+	}
+
+	newParent, err := tpm2.LoadExternal{
+		InPublic:  tpm2.New2B(newParentPub),
+		Hierarchy: tpm2.TPMRHNull,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load new parent: %w", tpmerrors.Wrap(err))
+	}
+	defer tpm2.FlushContext{FlushHandle: newParent.ObjectHandle}.Execute(tpm) //nolint:errcheck
+
+	sess, cleanup, err := tpm2.PolicySession(tpm, tpm2.TPMAlgSHA256, 16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start policy session: %w", tpmerrors.Wrap(err))
+	}
+	defer cleanup() //nolint:errcheck
+	if _, err := (tpm2.PolicyDuplicationSelect{
+		PolicySession: sess.Handle(),
+		ObjectName:    sealed.Name(),
+		NewParentName: newParent.Name,
+	}).Execute(tpm); err != nil {
+		return nil, fmt.Errorf("failed to satisfy duplication policy: %w", tpmerrors.Wrap(err))
+	}
+	if blob.Policy != nil {
+		if err := policyOr(tpm, sess, blob.Policy.Digest, blob.Duplication.Digest); err != nil {
+			return nil, err
+		}
+	}
+
+	rsp, err := tpm2.Duplicate{
+		ObjectHandle:    tpmutil.ToAuthHandle(sealed, sess),
+		NewParentHandle: tpm2.NamedHandle{Handle: newParent.ObjectHandle, Name: newParent.Name},
+		Symmetric:       tpm2.TPMTSymDef{Algorithm: tpm2.TPMAlgNull},
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to duplicate sealed object: %w", tpmerrors.Wrap(err))
+	}
+	return &Blob{
+		Public:      tpm2.Marshal(public.OutPublic),
+		Duplicate:   tpm2.Marshal(rsp.Duplicate),
+		Seed:        tpm2.Marshal(rsp.OutSymSeed),
+		Name:        blob.Name,
+		Policy:      blob.Policy,
+		Duplication: blob.Duplication,
+	}, nil
+}
+
+// importDuplicate imports the sealed object of a blob output by [Migrate]
+// under parent, and returns its private area.
+func importDuplicate(tpm transport.TPM, parent tpmutil.Handle, public tpm2.TPM2BPublic, blob *Blob) (*tpm2.TPM2BPrivate, error) {
+	duplicate, err := tpm2.Unmarshal[tpm2.TPM2BPrivate](blob.Duplicate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode duplicated object: %w", err)
+	}
+	seed, err := tpm2.Unmarshal[tpm2.TPM2BEncryptedSecret](blob.Seed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode duplication seed: %w", err)
+	}
+	rsp, err := tpm2.Import{
+		ParentHandle: tpmutil.ToAuthHandle(parent),
+		ObjectPublic: public,
+		Duplicate:    *duplicate,
+		InSymSeed:    *seed,
+		Symmetric:    tpm2.TPMTSymDef{Algorithm: tpm2.TPMAlgNull},
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import sealed object: %w", tpmerrors.Wrap(err))
+	}
+	return &rsp.OutPrivate, nil
+}
+
+// duplicationPolicy computes the policy allowing the duplication to the
+// storage key whose public area is newParentPub.
+func duplicationPolicy(newParentPub tpm2.TPMTPublic) (*Duplication, error) {
+	name, err := names.Compute(newParentPub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute new parent name: %w", err)
+	}
+	calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+	if err != nil {
+		return nil, err
+	}
+	// The object isn't included: its name depends on this policy.
+	if err := (tpm2.PolicyDuplicationSelect{NewParentName: name}).Update(calc); err != nil {
+		return nil, fmt.Errorf("failed to compute duplication policy: %w", err)
+	}
+	return &Duplication{ParentName: name.Buffer, Digest: calc.Hash().Digest}, nil
+}
+
+// orPolicy computes the PolicyOR of branches.
+func orPolicy(branches ...[]byte) ([]byte, error) {
+	calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+	if err != nil {
+		return nil, err
+	}
+	if err := orCommand(branches).Update(calc); err != nil {
+		return nil, fmt.Errorf("failed to compute policy: %w", err)
+	}
+	return calc.Hash().Digest, nil
+}
+
+// policyOr runs TPM2_PolicyOR with branches in sess.
+func policyOr(tpm transport.TPM, sess tpm2.Session, branches ...[]byte) error {
+	cmd := orCommand(branches)
+	cmd.PolicySession = sess.Handle()
+	if _, err := cmd.Execute(tpm); err != nil {
+		return fmt.Errorf("failed to satisfy policy: %w", tpmerrors.Wrap(err))
+	}
+	return nil
+}
+
+func orCommand(branches [][]byte) tpm2.PolicyOr {
+	var list tpm2.TPMLDigest
+	for _, b := range branches {
+		list.Digests = append(list.Digests, tpm2.TPM2BDigest{Buffer: b})
+	}
+	return tpm2.PolicyOr{PHashList: list}
+}
@@ -0,0 +1,100 @@
+package unseal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/names"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+)
+
+func TestMigrate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pcrs []uint
+	}{
+		{"without PCRs", nil},
+		{"with PCRs", []uint{debugPCR}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			thetpm := testutil.OpenSimulator(t)
+			fixtures := testutil.NewFixtures(t, thetpm)
+			// The RSA SRK stands for the storage key of another device.
+			newParent := fixtures.RSASRK(t)
+
+			secret := []byte("disk key")
+			blob, err := Seal(thetpm, secret, SealConfig{PCRs: tc.pcrs, DuplicateTo: newParent.Public()})
+			if err != nil {
+				t.Fatalf("could not seal data: %v", err)
+			}
+			if got, err := Unseal(thetpm, blob); err != nil || !bytes.Equal(secret, got) {
+				t.Fatalf("could not unseal data before migration: %q, %v", got, err)
+			}
+
+			migrated, err := Migrate(thetpm, blob, *newParent.Public())
+			if err != nil {
+				t.Fatalf("could not migrate blob: %v", err)
+			}
+			data, err := json.Marshal(migrated)
+			if err != nil {
+				t.Fatalf("could not encode blob: %v", err)
+			}
+			var decoded Blob
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("could not decode blob: %v", err)
+			}
+			got, err := Unseal(thetpm, &decoded, UnsealConfig{Parent: newParent})
+			if err != nil {
+				t.Fatalf("could not unseal migrated blob: %v", err)
+			}
+			if !bytes.Equal(secret, got) {
+				t.Fatalf("unsealed data does not match got %s, expected %s", got, secret)
+			}
+
+			// The migrated blob is only usable under the new parent.
+			if _, err := Unseal(thetpm, migrated); err == nil {
+				t.Fatalf("expected unseal of migrated blob under the SRK to fail")
+			}
+
+			if len(tc.pcrs) > 0 {
+				if err := pcr.Extend(thetpm, debugPCR, tpm2.TPMAlgSHA256, []byte("tampered")); err != nil {
+					t.Fatalf("could not extend PCR: %v", err)
+				}
+				if _, err := Unseal(thetpm, migrated, UnsealConfig{Parent: newParent}); err == nil {
+					t.Fatalf("expected unseal of migrated blob to fail after PCR change")
+				}
+			}
+		})
+	}
+}
+
+func TestMigrate_Errors(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	fixtures := testutil.NewFixtures(t, thetpm)
+
+	blob, err := Seal(thetpm, []byte("secret"))
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	if _, err := Migrate(thetpm, blob, *fixtures.RSASRK(t).Public()); !errors.Is(err, ErrNotDuplicable) {
+		t.Fatalf("expected ErrNotDuplicable, got %v", err)
+	}
+
+	blob, err = Seal(thetpm, []byte("secret"), SealConfig{DuplicateTo: fixtures.RSASRK(t).Public()})
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	if _, err := Migrate(thetpm, blob, *fixtures.SRK(t).Public()); !errors.Is(err, names.ErrMismatch) {
+		t.Fatalf("expected names.ErrMismatch for another parent, got %v", err)
+	}
+
+	// The TPM enforces the duplication policy by itself.
+	blob.Duplication.ParentName = fixtures.SRK(t).Name().Buffer
+	if _, err := Migrate(thetpm, blob, *fixtures.SRK(t).Public()); !errors.Is(err, tpm2.TPMRCPolicyFail) {
+		t.Fatalf("expected TPM_RC_POLICY_FAIL for another parent, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package unseal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+)
+
+// seedBlobs returns blobs shaped like the outputs of Seal and Migrate,
+// without a TPM.
+func seedBlobs() []*Blob {
+	public := tpm2.Marshal(tpm2.New2B(sealTemplate))
+	private := tpm2.Marshal(tpm2.TPM2BPrivate{Buffer: bytes.Repeat([]byte{0x42}, 64)})
+	name := append([]byte{0x00, 0x0b}, bytes.Repeat([]byte{0x01}, 32)...)
+	digest := bytes.Repeat([]byte{0x02}, 32)
+	pcrPolicy := Policy{Bank: tpmjson.AlgID(tpm2.TPMAlgSHA256), PCRs: []uint{0, 7}, PCRDigest: digest, Digest: digest}
+
+	return []*Blob{
+		{Public: public, Private: private, Name: name},
+		{Public: public, Private: private, Name: name, Policy: &pcrPolicy},
+		{Handle: 0x81000100, Name: name, Policy: &Policy{
+			Branches: []Policy{pcrPolicy, {AuthValue: true, Digest: digest}},
+			Digest:   digest,
+		}},
+		{
+			Public:      public,
+			Duplicate:   private,
+			Seed:        tpm2.Marshal(tpm2.TPM2BEncryptedSecret{Buffer: digest}),
+			Name:        name,
+			Duplication: &Duplication{ParentName: name, Digest: digest},
+		},
+	}
+}
+
+func TestUnmarshal_Invalid(t *testing.T) {
+	public := tpm2.Marshal(tpm2.New2B(sealTemplate))
+	for name, blob := range map[string]*Blob{
+		"no sealed object": {Name: []byte{0x00}},
+		"PCR out of range": {Public: public, Policy: &Policy{PCRs: []uint{pcr.Count}}},
+		"huge PCR index":   {Public: public, Policy: &Policy{PCRs: []uint{1 << 40}}},
+		"too many branches": {Public: public, Policy: &Policy{
+			Branches: make([]Policy, MaxBranches+1),
+		}},
+		"nested branches": {Public: public, Policy: &Policy{
+			Branches: []Policy{{Branches: []Policy{{}, {}}}, {}},
+		}},
+		"PCR out of range in a branch": {Public: public, Policy: &Policy{
+			Branches: []Policy{{PCRs: []uint{pcr.Count}}, {}},
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := blob.Marshal()
+			if err != nil {
+				t.Fatalf("could not marshal blob: %v", err)
+			}
+			if _, err := Unmarshal(data); !errors.Is(err, ErrInvalidBlob) {
+				t.Fatalf("Unmarshal() error = %v, want %v", err, ErrInvalidBlob)
+			}
+		})
+	}
+}
+
+// FuzzUnmarshal checks that decoding an untrusted blob, and the TPM-free
+// steps of unsealing it, neither panic nor allocate after attacker-controlled
+// sizes.
+func FuzzUnmarshal(f *testing.F) {
+	for _, blob := range seedBlobs() {
+		data, err := blob.Marshal()
+		if err != nil {
+			f.Fatalf("could not marshal blob: %v", err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte(`{"public":"AAA=","policy":{"bank":"sha256","pcrs":[23],"branches":null}}`))
+	f.Add([]byte(`{"handle":1,"policy":{"pcrs":[4294967295]}}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		blob, err := Unmarshal(data)
+		if err != nil {
+			return
+		}
+		if len(blob.Public) > 0 {
+			tpm2.Unmarshal[tpm2.TPM2BPublic](blob.Public)   //nolint:errcheck
+			tpm2.Unmarshal[tpm2.TPM2BPrivate](blob.Private) //nolint:errcheck
+		}
+		if blob.Policy != nil {
+			blob.Policy.hasAuthValue()
+			blob.Policy.branchDigests()
+			for _, p := range append([]Policy{*blob.Policy}, blob.Policy.Branches...) {
+				pcr.Selection(tpm2.TPMAlgID(p.Bank), p.PCRs...)
+			}
+		}
+
+		again, err := blob.Marshal()
+		if err != nil {
+			t.Fatalf("could not marshal decoded blob: %v", err)
+		}
+		if _, err := Unmarshal(again); err != nil {
+			t.Fatalf("could not decode re-encoded blob: %v", err)
+		}
+	})
+}
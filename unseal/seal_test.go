@@ -0,0 +1,454 @@
+package unseal
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/tpm-stuff/internal/testutil"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/loicsikidi/tpm-stuff/persist"
+	"github.com/loicsikidi/tpm-stuff/policy"
+	"github.com/loicsikidi/tpm-stuff/provision"
+	"github.com/loicsikidi/tpm-stuff/secure_connection/sniffer"
+)
+
+// debugPCR is resettable from the locality of the tests.
+const debugPCR = 16
+
+func TestSeal(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	secret := []byte("disk key")
+	blob, err := Seal(thetpm, secret, SealConfig{PCRs: []uint{debugPCR}})
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	if blob.IsPersistent() || len(blob.Public) == 0 || len(blob.Private) == 0 {
+		t.Fatalf("expected a blob holding the sealed object, got %+v", blob)
+	}
+
+	got, err := Unseal(thetpm, blob)
+	if err != nil {
+		t.Fatalf("could not unseal data: %v", err)
+	}
+	if !bytes.Equal(secret, got) {
+		t.Fatalf("unsealed data does not match got %s, expected %s", got, secret)
+	}
+
+	if err := pcr.Extend(thetpm, debugPCR, tpm2.TPMAlgSHA256, []byte("tampered")); err != nil {
+		t.Fatalf("could not extend PCR: %v", err)
+	}
+	defer pcr.Reset(thetpm, debugPCR) //nolint:errcheck
+	if _, err := Unseal(thetpm, blob); !errors.Is(err, tpm2.TPMRCPolicyFail) {
+		t.Fatalf("expected TPM_RC_POLICY_FAIL after a PCR change, got %v", err)
+	}
+
+	if _, err := Seal(thetpm, make([]byte, MaxDataSize+1)); err == nil {
+		t.Fatalf("expected error when sealing data over max size")
+	}
+}
+
+func TestSealPersistent(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	handle, err := persist.Allocate(thetpm, persist.OwnerRange)
+	if err != nil {
+		t.Fatalf("could not allocate persistent handle: %v", err)
+	}
+	secret := []byte("boot secret")
+	blob, err := Seal(thetpm, secret, SealConfig{PCRs: []uint{debugPCR}, Persistent: handle})
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	if blob.Handle != handle || len(blob.Public) != 0 || len(blob.Private) != 0 {
+		t.Fatalf("expected a blob holding the persistent handle only, got %+v", blob)
+	}
+
+	// Early-boot consumers only read the blob back.
+	data, err := json.Marshal(blob)
+	if err != nil {
+		t.Fatalf("could not encode blob: %v", err)
+	}
+	var stored Blob
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("could not decode blob: %v", err)
+	}
+	got, err := Unseal(thetpm, &stored)
+	if err != nil {
+		t.Fatalf("could not unseal data: %v", err)
+	}
+	if !bytes.Equal(secret, got) {
+		t.Fatalf("unsealed data does not match got %s, expected %s", got, secret)
+	}
+
+	if err := Evict(thetpm, blob); err != nil {
+		t.Fatalf("could not evict sealed object: %v", err)
+	}
+	if _, err := Unseal(thetpm, blob); !errors.Is(err, ErrObjectMissing) {
+		t.Fatalf("expected ErrObjectMissing, got %v", err)
+	}
+
+	// Another object taking the handle isn't mistaken for the sealed one.
+	other, err := Seal(thetpm, []byte("other"), SealConfig{Persistent: handle})
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	defer Evict(thetpm, other) //nolint:errcheck
+	if _, err := Unseal(thetpm, blob); !errors.Is(err, ErrObjectMismatch) {
+		t.Fatalf("expected ErrObjectMismatch, got %v", err)
+	}
+}
+
+func TestSealAuth(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pcrs []uint
+	}{
+		{"without PCRs", nil},
+		{"with PCRs", []uint{debugPCR}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			thetpm := testutil.OpenSimulator(t)
+			// Provision the SRK before sniffing: its creation isn't under test.
+			if _, err := Seal(thetpm, []byte("warm up")); err != nil {
+				t.Fatalf("could not seal data: %v", err)
+			}
+			bus := sniffer.New(thetpm)
+
+			secret := []byte("disk key")
+			password := []byte("correct horse battery staple")
+			blob, err := Seal(bus, secret, SealConfig{PCRs: tc.pcrs, Auth: password})
+			if err != nil {
+				t.Fatalf("could not seal data: %v", err)
+			}
+			if blob.Policy == nil || !blob.Policy.AuthValue {
+				t.Fatalf("expected a password policy, got %+v", blob.Policy)
+			}
+			got, err := Unseal(bus, blob, UnsealConfig{Auth: password})
+			if err != nil {
+				t.Fatalf("could not unseal data: %v", err)
+			}
+			if !bytes.Equal(secret, got) {
+				t.Fatalf("unsealed data does not match got %s, expected %s", got, secret)
+			}
+			if bus.ContainsPlaintext(password) {
+				t.Fatalf("password was sent in clear")
+			}
+			if bus.ContainsPlaintext(secret) {
+				t.Fatalf("secret was sent in clear")
+			}
+
+			if _, err := Unseal(thetpm, blob, UnsealConfig{Auth: []byte("wrong password")}); !errors.Is(err, tpm2.TPMRCBadAuth) {
+				t.Fatalf("expected TPM_RC_BAD_AUTH with a wrong password, got %v", err)
+			}
+			if _, err := Unseal(thetpm, blob); !errors.Is(err, tpm2.TPMRCBadAuth) {
+				t.Fatalf("expected TPM_RC_BAD_AUTH without a password, got %v", err)
+			}
+			// The password isn't usable as a plain password.
+			if _, err := Unseal(thetpm, &Blob{Public: blob.Public, Private: blob.Private, Name: blob.Name}); err == nil {
+				t.Fatalf("expected unseal without the policy to fail")
+			}
+		})
+	}
+
+	thetpm := testutil.OpenSimulator(t)
+	blob, err := Seal(thetpm, []byte("disk key"))
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	if _, err := Unseal(thetpm, blob, UnsealConfig{Auth: []byte("password")}); err == nil {
+		t.Fatalf("expected error when unsealing a blob sealed without password with a password")
+	}
+	if _, err := Seal(thetpm, []byte("disk key"), SealConfig{Auth: make([]byte, 33)}); err == nil {
+		t.Fatalf("expected error when sealing with a password over 32 bytes")
+	}
+	// An empty password is no password.
+	blob, err = Seal(thetpm, []byte("disk key"), SealConfig{Auth: []byte{}})
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	if blob.Policy != nil {
+		t.Fatalf("expected no password policy with an empty password, got %+v", blob.Policy)
+	}
+	if _, err := Unseal(thetpm, blob, UnsealConfig{Auth: []byte{}}); err != nil {
+		t.Fatalf("could not unseal data with an empty password: %v", err)
+	}
+}
+
+func TestUnsealEncrypted(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	handle, err := persist.Allocate(thetpm, persist.OwnerRange)
+	if err != nil {
+		t.Fatalf("could not allocate persistent handle: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		cfg  SealConfig
+	}{
+		{"default", SealConfig{}},
+		{"with PCRs", SealConfig{PCRs: []uint{debugPCR}}},
+		{"persistent", SealConfig{Persistent: handle}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := sniffer.New(thetpm)
+			secret := []byte("disk key")
+			blob, err := Seal(bus, secret, tc.cfg)
+			if err != nil {
+				t.Fatalf("could not seal data: %v", err)
+			}
+			if blob.IsPersistent() {
+				defer Evict(thetpm, blob) //nolint:errcheck
+			}
+			if bus.ContainsPlaintext(secret) {
+				t.Fatalf("secret was sent in clear at seal time")
+			}
+
+			bus.Reset()
+			got, err := Unseal(bus, blob)
+			if err != nil || !bytes.Equal(secret, got) {
+				t.Fatalf("could not unseal data: %q, %v", got, err)
+			}
+			if !bus.ReceivedPlaintext(secret) {
+				t.Fatalf("expected the secret in clear without response encryption")
+			}
+
+			bus.Reset()
+			got, err = UnsealEncrypted(bus, blob)
+			if err != nil {
+				t.Fatalf("could not unseal data: %v", err)
+			}
+			if !bytes.Equal(secret, got) {
+				t.Fatalf("unsealed data does not match got %s, expected %s", got, secret)
+			}
+			if bus.ContainsPlaintext(secret) {
+				t.Fatalf("secret was sent in clear with response encryption")
+			}
+		})
+	}
+}
+
+func TestUnsealBuffer(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	bus := sniffer.New(thetpm)
+
+	secret := []byte("disk key")
+	blob, err := Seal(bus, secret)
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	bus.Reset()
+	got, err := UnsealBuffer(bus, blob)
+	if err != nil {
+		t.Fatalf("could not unseal data: %v", err)
+	}
+	if !bytes.Equal(secret, got.Bytes()) {
+		t.Fatalf("unsealed data does not match got %s, expected %s", got.Bytes(), secret)
+	}
+	if bus.ContainsPlaintext(secret) {
+		t.Fatalf("secret was sent in clear with response encryption")
+	}
+	if s := fmt.Sprintf("%s %x", got, got); bytes.Contains([]byte(s), secret) {
+		t.Fatalf("formatted buffer leaks the secret: %s", s)
+	}
+
+	data := got.Bytes()
+	got.Close() //nolint:errcheck
+	if !bytes.Equal(make([]byte, len(secret)), data) || got.Bytes() != nil {
+		t.Fatalf("expected the secret to be zeroized on close, got %q", data)
+	}
+}
+
+func TestUnsealTransientSRK(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+
+	secret := []byte("disk key")
+	blob, err := Seal(thetpm, secret)
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	if err := persist.Evict(thetpm, provision.SRKHandle); err != nil {
+		t.Fatalf("could not evict SRK: %v", err)
+	}
+
+	for _, fn := range []func(transport.TPM, *Blob, ...UnsealConfig) ([]byte, error){Unseal, UnsealEncrypted} {
+		got, err := fn(thetpm, blob)
+		if err != nil {
+			t.Fatalf("could not unseal data: %v", err)
+		}
+		if !bytes.Equal(secret, got) {
+			t.Fatalf("unsealed data does not match got %s, expected %s", got, secret)
+		}
+	}
+	if _, err := (tpm2.ReadPublic{ObjectHandle: provision.SRKHandle}).Execute(thetpm); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Fatalf("expected unseal not to persist the SRK, got %v", err)
+	}
+}
+
+func TestSealPredicted(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	if err := pcr.Reset(thetpm, debugPCR); err != nil {
+		t.Fatalf("could not reset PCR: %v", err)
+	}
+	defer pcr.Reset(thetpm, debugPCR) //nolint:errcheck
+
+	// The next boot measures the updated kernel.
+	next := sha256.Sum256([]byte("kernel v2"))
+	predicted, err := pcr.Replay(tpm2.TPMAlgSHA256, []pcr.Measurement{{Index: debugPCR, Digest: next[:]}})
+	if err != nil {
+		t.Fatalf("could not replay measurements: %v", err)
+	}
+	digest, err := predicted.Digest(debugPCR)
+	if err != nil {
+		t.Fatalf("could not compute PCR digest: %v", err)
+	}
+
+	secret := []byte("disk key")
+	blob, err := Seal(thetpm, secret, SealConfig{PCRs: []uint{debugPCR}, PCRDigest: digest})
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	if _, err := Unseal(thetpm, blob); !errors.Is(err, tpm2.TPMRCPolicyFail) {
+		t.Fatalf("expected TPM_RC_POLICY_FAIL before the PCR reaches its predicted value, got %v", err)
+	}
+
+	if err := pcr.Extend(thetpm, debugPCR, tpm2.TPMAlgSHA256, []byte("kernel v2")); err != nil {
+		t.Fatalf("could not extend PCR: %v", err)
+	}
+	got, err := Unseal(thetpm, blob)
+	if err != nil {
+		t.Fatalf("could not unseal data: %v", err)
+	}
+	if !bytes.Equal(secret, got) {
+		t.Fatalf("unsealed data does not match got %s, expected %s", got, secret)
+	}
+
+	if _, err := Seal(thetpm, secret, SealConfig{PCRDigest: digest}); err == nil {
+		t.Fatalf("expected error when sealing to a PCR digest without PCRs")
+	}
+	if _, err := Seal(thetpm, secret, SealConfig{PCRs: []uint{debugPCR}, PCRDigest: digest[:20]}); err == nil {
+		t.Fatalf("expected error when sealing to a PCR digest of the wrong size")
+	}
+}
+
+func TestSealBranches(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	if err := pcr.Reset(thetpm, debugPCR); err != nil {
+		t.Fatalf("could not reset PCR: %v", err)
+	}
+	defer pcr.Reset(thetpm, debugPCR) //nolint:errcheck
+	authority, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate authority key: %v", err)
+	}
+	policyRef := []byte("unseal")
+
+	secret := []byte("disk key")
+	recovery := []byte("recovery password")
+	sealed, err := Seal(thetpm, secret, SealConfig{
+		Auth: recovery,
+		Branches: []Branch{
+			{PCRs: []uint{debugPCR}},
+			{AuthValue: true},
+			{Authority: authority.Public(), PolicyRef: policyRef},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not seal data: %v", err)
+	}
+	// The branches are recorded in the stored blob.
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		t.Fatalf("could not encode blob: %v", err)
+	}
+	var blob Blob
+	if err := json.Unmarshal(data, &blob); err != nil {
+		t.Fatalf("could not decode blob: %v", err)
+	}
+	if len(blob.Policy.Branches) != 3 {
+		t.Fatalf("expected 3 branches, got %+v", blob.Policy)
+	}
+
+	unsealed := func(cfg UnsealConfig) {
+		t.Helper()
+		got, err := Unseal(thetpm, &blob, cfg)
+		if err != nil {
+			t.Fatalf("could not unseal data: %v", err)
+		}
+		if !bytes.Equal(secret, got) {
+			t.Fatalf("unsealed data does not match got %s, expected %s", got, secret)
+		}
+	}
+	signed := func(signer crypto.Signer) func([]byte) (*policy.SignedAuthorization, error) {
+		return func(nonceTPM []byte) (*policy.SignedAuthorization, error) {
+			return policy.SignAuthorization(signer, nonceTPM, 0, nil, policyRef)
+		}
+	}
+
+	// The PCR branch is picked while the PCR is unchanged.
+	unsealed(UnsealConfig{})
+
+	if err := pcr.Extend(thetpm, debugPCR, tpm2.TPMAlgSHA256, []byte("tampered")); err != nil {
+		t.Fatalf("could not extend PCR: %v", err)
+	}
+	if _, err := Unseal(thetpm, &blob); !errors.Is(err, ErrNoBranch) {
+		t.Fatalf("expected ErrNoBranch after a PCR change, got %v", err)
+	}
+
+	// The recovery password doesn't travel in clear.
+	bus := sniffer.New(thetpm)
+	got, err := UnsealEncrypted(bus, &blob, UnsealConfig{Auth: recovery})
+	if err != nil || !bytes.Equal(secret, got) {
+		t.Fatalf("could not unseal data with the recovery password: %q, %v", got, err)
+	}
+	if bus.ContainsPlaintext(recovery) || bus.ContainsPlaintext(secret) {
+		t.Fatalf("recovery password or secret was sent in clear")
+	}
+	if _, err := Unseal(thetpm, &blob, UnsealConfig{Auth: []byte("wrong password")}); !errors.Is(err, tpm2.TPMRCBadAuth) {
+		t.Fatalf("expected TPM_RC_BAD_AUTH with a wrong password, got %v", err)
+	}
+
+	unsealed(UnsealConfig{Authorize: signed(authority)})
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	if _, err := Unseal(thetpm, &blob, UnsealConfig{Authorize: signed(other)}); err == nil {
+		t.Fatalf("expected error with a signature of another key")
+	}
+}
+
+func TestSealBranches_Config(t *testing.T) {
+	thetpm := testutil.OpenSimulator(t)
+	pcrBranch := Branch{PCRs: []uint{debugPCR}}
+	passwordBranch := Branch{AuthValue: true}
+
+	for _, tc := range []struct {
+		name string
+		cfg  SealConfig
+	}{
+		{"single branch", SealConfig{Branches: []Branch{pcrBranch}}},
+		{"too many branches", SealConfig{Branches: make([]Branch, MaxBranches+1)}},
+		{"PCRs along with branches", SealConfig{PCRs: []uint{debugPCR}, Branches: []Branch{pcrBranch, pcrBranch}}},
+		{"empty branch", SealConfig{Branches: []Branch{pcrBranch, {}}}},
+		{"password branch without password", SealConfig{Branches: []Branch{pcrBranch, passwordBranch}}},
+		{"password without password branch", SealConfig{Auth: []byte("password"), Branches: []Branch{pcrBranch, pcrBranch}}},
+		{"invalid PCR digest", SealConfig{Branches: []Branch{pcrBranch, {PCRs: []uint{debugPCR}, PCRDigest: []byte("short")}}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Seal(thetpm, []byte("disk key"), tc.cfg); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,904 @@
+// Package unseal seals secrets of up to 128 bytes (MAX_SYM_DATA) to the TPM,
+// optionally to the current or predicted values of a set of PCRs, and unseals
+// them.
+//
+// By default the sealed object is kept in the [Blob] and loaded under its
+// parent at each unseal, which means recreating the SRK first. With
+// [SealConfig.Persistent], the sealed object is made persistent instead
+// (TPM2_EvictControl) and the blob only records its handle, Name and policy:
+// early-boot consumers unseal it without any parent chain.
+//
+// With [SealConfig.Auth], unsealing also requires a password, proven through
+// PolicyAuthValue in a session bound to the sealed object: the password never
+// travels to the TPM, and the secret is returned encrypted. Without password,
+// [UnsealEncrypted] returns the secret encrypted on the bus as well, and
+// [UnsealBuffer] in a sensitive.Buffer, zeroized once closed. The secret is
+// always sent to the TPM in a session salted with the parent.
+//
+// With [SealConfig.DuplicateTo], the sealed object isn't bound to the TPM:
+// [Migrate] wraps it for another storage key, e.g. an escrow key or the SRK
+// of another device, where the migrated blob is unsealed.
+//
+// With [SealConfig.Branches], the secret is unsealed by satisfying any of up
+// to 8 policies (PolicyOR), e.g. the PCRs of a known-good boot or a recovery
+// password: [Unseal] picks the first branch it can satisfy.
+package unseal
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/loicsikidi/go-tpm-kit/tpmcrypto"
+	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	tpmerrors "github.com/loicsikidi/tpm-stuff/errors"
+	"github.com/loicsikidi/tpm-stuff/metrics"
+	"github.com/loicsikidi/tpm-stuff/pcr"
+	"github.com/loicsikidi/tpm-stuff/persist"
+	"github.com/loicsikidi/tpm-stuff/policy"
+	"github.com/loicsikidi/tpm-stuff/provision"
+	"github.com/loicsikidi/tpm-stuff/sensitive"
+	"github.com/loicsikidi/tpm-stuff/templates"
+	"github.com/loicsikidi/tpm-stuff/tpmjson"
+)
+
+// MaxDataSize is the maximum size of sealed data (MAX_SYM_DATA).
+const MaxDataSize = 128
+
+// MaxBranches is the maximum number of branches of a PolicyOR.
+const MaxBranches = 8
+
+var (
+	// ErrObjectMissing is returned by [Unseal] when the persistent sealed
+	// object of the blob doesn't exist anymore, e.g. after a TPM2_Clear: the
+	// secret must be sealed again.
+	ErrObjectMissing = errors.New("persistent sealed object is missing")
+	// ErrObjectMismatch is returned by [Unseal] when the object found at the
+	// persistent handle of the blob isn't the sealed object, i.e. it was
+	// evicted and the handle reused.
+	ErrObjectMismatch = errors.New("persistent object doesn't match the blob")
+	// ErrNotDuplicable is returned by [Migrate] for a blob sealed without
+	// [SealConfig.DuplicateTo].
+	ErrNotDuplicable = errors.New("sealed object isn't duplicable")
+	// ErrNoBranch is returned by [Unseal] when none of the branches of the
+	// blob can be satisfied: the PCRs don't match and the password or the
+	// authority of the other branches isn't provided.
+	ErrNoBranch = errors.New("no satisfiable unseal policy branch")
+	// ErrInvalidBlob is returned for blobs which can't be the output of
+	// [Seal] or [Migrate].
+	ErrInvalidBlob = errors.New("invalid blob")
+)
+
+// Policy is the unseal policy of a sealed object: PolicyPCR, followed by
+// PolicyAuthValue with AuthValue and PolicySigned with Authority, or the
+// PolicyOR of Branches.
+type Policy struct {
+	// Bank is the PCR bank of PCRs.
+	Bank tpmjson.AlgID `json:"bank"`
+	// PCRs are the PCR indexes whose values at seal time are required to
+	// unseal.
+	PCRs []uint `json:"pcrs"`
+	// PCRDigest is the composite digest of the values of PCRs required to
+	// unseal.
+	PCRDigest []byte `json:"pcr_digest,omitempty"`
+	// AuthValue reports whether the password of the sealed object is
+	// required to unseal (see [SealConfig.Auth]).
+	AuthValue bool `json:"auth_value,omitempty"`
+	// Authority is the marshaled TPMT_PUBLIC of the key whose signature is
+	// required to unseal (see [Branch.Authority]).
+	Authority []byte `json:"authority,omitempty"`
+	// PolicyRef qualifies the signatures of Authority.
+	PolicyRef []byte `json:"policy_ref,omitempty"`
+	// Branches are the alternative policies of the sealed object, when
+	// sealed with [SealConfig.Branches]: the other fields are then unset.
+	Branches []Policy `json:"branches,omitempty"`
+	// Digest is the digest of the unseal policy: the policy digest of the
+	// sealed object, unless it is duplicable.
+	Digest []byte `json:"digest"`
+}
+
+// Duplication is the duplication policy of a sealed object: TPM2_Duplicate
+// is only allowed to a single new parent. The policy digest of the sealed
+// object is Digest, or PolicyOR(PCR policy, Digest) along with a PCR policy.
+type Duplication struct {
+	// ParentName is the Name of the new parent.
+	ParentName []byte `json:"parent_name"`
+	// Digest is the digest of the duplication policy.
+	Digest []byte `json:"digest"`
+}
+
+// Blob is the output of [Seal], stored by the caller to unseal later.
+type Blob struct {
+	// Public and Private are the sealed object, loaded under the parent at
+	// each unseal. They are unset when the object is persistent.
+	Public  []byte `json:"public,omitempty"`
+	Private []byte `json:"private,omitempty"`
+	// Duplicate and Seed replace Private in the blobs output by [Migrate]:
+	// the sealed object wrapped for the new parent, imported at each unseal.
+	Duplicate []byte `json:"duplicate,omitempty"`
+	Seed      []byte `json:"seed,omitempty"`
+	// Handle is the persistent handle of the sealed object, if any.
+	Handle tpm2.TPMHandle `json:"handle,omitempty"`
+	// Name is the Name of the sealed object.
+	Name []byte `json:"name"`
+	// Policy is the unseal policy of the sealed object, if any.
+	Policy *Policy `json:"policy,omitempty"`
+	// Duplication is the duplication policy of the sealed object, if any.
+	Duplication *Duplication `json:"duplication,omitempty"`
+}
+
+// IsPersistent reports whether the sealed object of b is persistent.
+func (b *Blob) IsPersistent() bool {
+	return b.Handle != 0
+}
+
+// Marshal returns the JSON encoding of b.
+func (b *Blob) Marshal() ([]byte, error) {
+	return json.Marshal(b)
+}
+
+// Unmarshal decodes a blob encoded by [Blob.Marshal] and returns
+// [ErrInvalidBlob] if it isn't well-formed. Blobs are usually read from
+// storage that an attacker may control: beyond this check, their content is
+// only trusted as far as the TPM verifies it when unsealing.
+func Unmarshal(data []byte) (*Blob, error) {
+	var b Blob
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to decode blob: %w", err)
+	}
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// check returns [ErrInvalidBlob] if b doesn't hold a sealed object or its
+// policy can't be the output of [Seal].
+func (b *Blob) check() error {
+	if !b.IsPersistent() && len(b.Public) == 0 {
+		return fmt.Errorf("%w: no sealed object", ErrInvalidBlob)
+	}
+	if b.Policy == nil {
+		return nil
+	}
+	if len(b.Policy.Branches) > MaxBranches {
+		return fmt.Errorf("%w: %d policy branches, at most %d", ErrInvalidBlob, len(b.Policy.Branches), MaxBranches)
+	}
+	if err := b.Policy.check(); err != nil {
+		return err
+	}
+	for i := range b.Policy.Branches {
+		if len(b.Policy.Branches[i].Branches) > 0 {
+			return fmt.Errorf("%w: nested policy branches", ErrInvalidBlob)
+		}
+		if err := b.Policy.Branches[i].check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check returns [ErrInvalidBlob] if p selects PCRs which don't exist: their
+// selection bitmap is sized after the highest index.
+func (p *Policy) check() error {
+	for _, i := range p.PCRs {
+		if i >= pcr.Count {
+			return fmt.Errorf("%w: PCR index %d", ErrInvalidBlob, i)
+		}
+	}
+	return nil
+}
+
+// SealConfig holds configuration for [Seal].
+type SealConfig struct {
+	// Parent is the storage key under which the secret is sealed, authorized
+	// with an empty password.
+	//
+	// Default: the ECC SRK persisted at provision.SRKHandle, provisioned on
+	// first use (see provision.EnsureSRK).
+	Parent tpmutil.Handle
+	// PCRs seals the secret to the current values of these PCRs.
+	//
+	// Default: none, the secret is unsealed with an empty password.
+	PCRs []uint
+	// Bank is the PCR bank of PCRs.
+	//
+	// Default: tpm2.TPMAlgSHA256.
+	Bank tpm2.TPMAlgID
+	// PCRDigest seals the secret to future values of PCRs instead of their
+	// current values: it is their composite digest (see pcr.Bank.Digest),
+	// e.g. predicted for the next boot with pcr.Replay. The secret can't be
+	// unsealed until the PCRs reach these values.
+	//
+	// Default: nil, the current values of PCRs are read from the TPM.
+	PCRDigest []byte
+	// Persistent makes the sealed object persistent at this handle, which
+	// must be free (see persist.Allocate).
+	//
+	// Default: 0, the sealed object is kept in the blob.
+	Persistent tpm2.TPMHandle
+	// DuplicateTo allows the sealed object to be duplicated with [Migrate]
+	// to the storage key with this public area, and to no other: the object
+	// is created without fixedTPM and fixedParent, so the secret leaves the
+	// TPM wrapped for that key.
+	//
+	// Default: nil, the sealed object is bound to the TPM.
+	DuplicateTo *tpm2.TPMTPublic
+	// Auth is the password of the sealed object, of up to 32 bytes, required
+	// to unseal (see [UnsealConfig.Auth]). It is only usable through
+	// PolicyAuthValue, never as a plain password. An empty password is the
+	// same as nil.
+	//
+	// Default: nil, no password is required.
+	Auth []byte
+	// Branches seals the secret to the PolicyOR of up to [MaxBranches]
+	// policies instead of PCRs and Auth: satisfying any of them unseals the
+	// secret. PCRs, PCRDigest and Bank must be unset, while Auth is the
+	// password of the branches with [Branch.AuthValue].
+	//
+	// Example, a PCR policy with a recovery password:
+	//
+	//	unseal.SealConfig{
+	//	    Auth: recoveryPassword,
+	//	    Branches: []unseal.Branch{
+	//	        {PCRs: []uint{7}},
+	//	        {AuthValue: true},
+	//	    },
+	//	}
+	//
+	// Default: nil.
+	Branches []Branch
+	// Logger logs the commands sent to the TPM (see metrics.Logger).
+	//
+	// Default: nil, no logging.
+	Logger *slog.Logger
+}
+
+// Branch is one of the policies of a secret sealed with
+// [SealConfig.Branches], made of the assertions set.
+type Branch struct {
+	// PCRs requires the current values of these PCRs, or the values of
+	// PCRDigest.
+	PCRs []uint
+	// Bank is the PCR bank of PCRs.
+	//
+	// Default: tpm2.TPMAlgSHA256.
+	Bank tpm2.TPMAlgID
+	// PCRDigest is the composite digest of the required values of PCRs, as
+	// for [SealConfig.PCRDigest].
+	//
+	// Default: nil, the current values of PCRs are read from the TPM.
+	PCRDigest []byte
+	// AuthValue requires the password of the sealed object,
+	// [SealConfig.Auth].
+	AuthValue bool
+	// Authority requires a signature by this key over the nonce of the
+	// unseal session, returned by [UnsealConfig.Authorize] (PolicySigned).
+	Authority crypto.PublicKey
+	// PolicyRef qualifies the signatures of Authority.
+	PolicyRef []byte
+}
+
+// checkAndSetDefault validates and sets default values for Branch.
+func (b *Branch) checkAndSetDefault() error {
+	if b.Bank == 0 {
+		b.Bank = tpm2.TPMAlgSHA256
+	}
+	if b.PCRDigest != nil {
+		if len(b.PCRs) == 0 {
+			return errors.New("PCR digest requires PCRs")
+		}
+		h, err := b.Bank.Hash()
+		if err != nil {
+			return fmt.Errorf("unsupported PCR bank: %w", err)
+		}
+		if len(b.PCRDigest) != h.Size() {
+			return fmt.Errorf("invalid PCR digest size: %d bytes, expected %d", len(b.PCRDigest), h.Size())
+		}
+	}
+	return nil
+}
+
+// CheckAndSetDefault validates and sets default values for SealConfig.
+func (c *SealConfig) CheckAndSetDefault() error {
+	if len(c.Auth) == 0 {
+		c.Auth = nil
+	}
+	if c.Persistent != 0 && !persist.OwnerRange.Contains(c.Persistent) {
+		return fmt.Errorf("%w: 0x%x is outside the owner range", persist.ErrNotPersistent, c.Persistent)
+	}
+	if c.Branches == nil {
+		b := Branch{PCRs: c.PCRs, Bank: c.Bank, PCRDigest: c.PCRDigest}
+		if err := b.checkAndSetDefault(); err != nil {
+			return err
+		}
+		c.Bank = b.Bank
+	} else {
+		if c.PCRs != nil || c.PCRDigest != nil || c.Bank != 0 {
+			return errors.New("PCRs are set per branch along with branches")
+		}
+		if len(c.Branches) < 2 || len(c.Branches) > MaxBranches {
+			return fmt.Errorf("invalid number of branches: %d, expected 2 to %d", len(c.Branches), MaxBranches)
+		}
+		c.Branches = slices.Clone(c.Branches)
+		authValue := false
+		for i := range c.Branches {
+			if err := c.Branches[i].checkAndSetDefault(); err != nil {
+				return fmt.Errorf("branch %d: %w", i, err)
+			}
+			if len(c.Branches[i].PCRs) == 0 && !c.Branches[i].AuthValue && c.Branches[i].Authority == nil {
+				return fmt.Errorf("branch %d: no assertion", i)
+			}
+			if c.Branches[i].AuthValue && c.Auth == nil {
+				return fmt.Errorf("branch %d: password policy requires Auth", i)
+			}
+			authValue = authValue || c.Branches[i].AuthValue
+		}
+		if c.Auth != nil && !authValue {
+			return errors.New("password requires a branch with a password policy")
+		}
+	}
+	if len(c.Auth) > sha256.Size {
+		return fmt.Errorf("password is too large: %d bytes, maximum is %d", len(c.Auth), sha256.Size)
+	}
+	return nil
+}
+
+// Seal seals data under the parent of cfg.
+//
+// Example:
+//
+//	h, err := persist.Allocate(tpm, persist.OwnerRange)
+//	if err != nil {
+//	    return err
+//	}
+//	blob, err := unseal.Seal(tpm, diskKey, unseal.SealConfig{PCRs: []uint{7}, Persistent: h})
+func Seal(tpm transport.TPM, data []byte, optionalCfg ...SealConfig) (*Blob, error) {
+	var cfg SealConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if len(data) > MaxDataSize {
+		return nil, fmt.Errorf("data is too large: %d bytes, maximum is %d", len(data), MaxDataSize)
+	}
+	tpm = metrics.WithLogger(tpm, cfg.Logger, "seal")
+	parent, err := parentOrSRK(tpm, cfg.Parent)
+	if err != nil {
+		return nil, err
+	}
+
+	template := templates.Seal(templates.WithNoDA())
+	blob := &Blob{}
+	if cfg.Branches != nil {
+		blob.Policy, err = branchesPolicy(tpm, cfg.Branches)
+		if err != nil {
+			return nil, err
+		}
+		template.ObjectAttributes.UserWithAuth = false
+		template.AuthPolicy = tpm2.TPM2BDigest{Buffer: blob.Policy.Digest}
+	} else if len(cfg.PCRs) > 0 || cfg.Auth != nil {
+		blob.Policy, err = unsealPolicy(tpm, Branch{
+			PCRs:      cfg.PCRs,
+			Bank:      cfg.Bank,
+			PCRDigest: cfg.PCRDigest,
+			AuthValue: cfg.Auth != nil,
+		})
+		if err != nil {
+			return nil, err
+		}
+		template.ObjectAttributes.UserWithAuth = false
+		template.AuthPolicy = tpm2.TPM2BDigest{Buffer: blob.Policy.Digest}
+	}
+	if cfg.DuplicateTo != nil {
+		blob.Duplication, err = duplicationPolicy(*cfg.DuplicateTo)
+		if err != nil {
+			return nil, err
+		}
+		template.ObjectAttributes.FixedTPM = false
+		template.ObjectAttributes.FixedParent = false
+		template.AuthPolicy = tpm2.TPM2BDigest{Buffer: blob.Duplication.Digest}
+		if blob.Policy != nil {
+			digest, err := orPolicy(blob.Policy.Digest, blob.Duplication.Digest)
+			if err != nil {
+				return nil, err
+			}
+			template.AuthPolicy = tpm2.TPM2BDigest{Buffer: digest}
+		}
+	}
+
+	// The secret, and the password if any, are encrypted on the bus.
+	sess, cleanup, err := encryptSession(tpm, parent, tpm2.AESEncryption(128, tpm2.EncryptIn))
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup() //nolint:errcheck
+	rsp, err := tpm2.Create{
+		ParentHandle: tpmutil.ToAuthHandle(parent),
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: cfg.Auth},
+				Data:     tpm2.NewTPMUSensitiveCreate(&tpm2.TPM2BSensitiveData{Buffer: data}),
+			},
+		},
+		InPublic: tpm2.New2B(template),
+	}.Execute(tpm, sess)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal data: %w", tpmerrors.Wrap(err))
+	}
+	blob.Public = tpm2.Marshal(rsp.OutPublic)
+	blob.Private = tpm2.Marshal(rsp.OutPrivate)
+	if cfg.Persistent == 0 {
+		public, err := rsp.OutPublic.Contents()
+		if err != nil {
+			return nil, err
+		}
+		name, err := tpm2.ObjectName(public)
+		if err != nil {
+			return nil, err
+		}
+		blob.Name = name.Buffer
+		return blob, nil
+	}
+
+	loaded, err := load(tpm, parent, blob)
+	if err != nil {
+		return nil, err
+	}
+	defer loaded.Close()
+	persistent, err := persist.Persist(tpm, loaded, cfg.Persistent)
+	if err != nil {
+		return nil, err
+	}
+	blob.Public, blob.Private = nil, nil
+	blob.Handle = persistent.Handle()
+	blob.Name = persistent.Name().Buffer
+	return blob, nil
+}
+
+// UnsealConfig holds configuration for [Unseal].
+type UnsealConfig struct {
+	// Parent is the storage key under which the secret was sealed. It is
+	// unused when the sealed object is persistent, except to salt the session
+	// of [UnsealEncrypted].
+	//
+	// Default: the ECC SRK of provision.EnsureSRK, created as a transient
+	// object and flushed afterwards: unsealing persists nothing in the TPM.
+	Parent tpmutil.Handle
+	// Auth is the password of the sealed object, for the blobs sealed with
+	// [SealConfig.Auth]. An empty password is the same as nil.
+	//
+	// Default: nil.
+	Auth []byte
+	// Authorize returns the signature of the authority of a branch with
+	// [Branch.Authority] over nonceTPM, the nonce of the unseal session, e.g.
+	// requested from a remote server holding the key (see
+	// policy.SignAuthorization).
+	//
+	// Default: nil, the branches with an authority aren't satisfiable.
+	Authorize func(nonceTPM []byte) (*policy.SignedAuthorization, error)
+	// Logger logs the commands sent to the TPM (see metrics.Logger).
+	//
+	// Default: nil, no logging.
+	Logger *slog.Logger
+}
+
+// CheckAndSetDefault validates and sets default values for UnsealConfig.
+func (c *UnsealConfig) CheckAndSetDefault() error {
+	if len(c.Auth) == 0 {
+		c.Auth = nil
+	}
+	return nil
+}
+
+// Unseal unseals the secret of blob. When the sealed object is persistent,
+// it returns [ErrObjectMissing] if the object was evicted and
+// [ErrObjectMismatch] if another object took its handle.
+//
+// A blob output by [Migrate] is unsealed under its new parent.
+//
+// The secret is returned in clear on the bus, unless the blob was sealed with
+// a password: see [UnsealEncrypted].
+func Unseal(tpm transport.TPM, blob *Blob, optionalCfg ...UnsealConfig) ([]byte, error) {
+	var cfg UnsealConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return unseal(tpm, blob, cfg, false)
+}
+
+// UnsealEncrypted is [Unseal], with the secret encrypted on the bus: the
+// response is encrypted in a session salted with the parent (the SRK for
+// persistent objects), only known to the caller and the TPM.
+//
+// Example:
+//
+//	diskKey, err := unseal.UnsealEncrypted(tpm, blob)
+func UnsealEncrypted(tpm transport.TPM, blob *Blob, optionalCfg ...UnsealConfig) ([]byte, error) {
+	var cfg UnsealConfig
+	if len(optionalCfg) > 0 {
+		cfg = optionalCfg[0]
+	}
+	if err := cfg.CheckAndSetDefault(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return unseal(tpm, blob, cfg, true)
+}
+
+// UnsealBuffer is [UnsealEncrypted], returning the secret in a buffer which
+// owns the only copy made by this package: it is zeroized when the buffer is
+// closed, and redacted if the buffer is logged.
+//
+// Example:
+//
+//	diskKey, err := unseal.UnsealBuffer(tpm, blob)
+//	if err != nil {
+//	    return err
+//	}
+//	defer diskKey.Close()
+func UnsealBuffer(tpm transport.TPM, blob *Blob, optionalCfg ...UnsealConfig) (*sensitive.Buffer, error) {
+	secret, err := UnsealEncrypted(tpm, blob, optionalCfg...)
+	if err != nil {
+		return nil, err
+	}
+	return sensitive.New(secret), nil
+}
+
+func unseal(tpm transport.TPM, blob *Blob, cfg UnsealConfig, encrypt bool) ([]byte, error) {
+	if blob == nil {
+		return nil, errors.New("missing blob")
+	}
+	tpm = metrics.WithLogger(tpm, cfg.Logger, "unseal")
+	if err := blob.check(); err != nil {
+		return nil, err
+	}
+	var branch *Policy
+	if blob.Policy != nil {
+		if cfg.Auth != nil && !blob.Policy.hasAuthValue() {
+			return nil, errors.New("blob wasn't sealed with a password")
+		}
+		var err error
+		if branch, err = pickBranch(tpm, blob.Policy, cfg); err != nil {
+			return nil, err
+		}
+	} else if cfg.Auth != nil {
+		return nil, errors.New("blob wasn't sealed with a password")
+	}
+
+	// The session of a password policy already encrypts the response.
+	encryptOut := encrypt && (branch == nil || !branch.AuthValue)
+	parent := cfg.Parent
+	if parent == nil && (!blob.IsPersistent() || encryptOut) {
+		srk, err := transientSRK(tpm)
+		if err != nil {
+			return nil, err
+		}
+		defer srk.Close()
+		parent = srk
+	}
+
+	var sealed tpmutil.Handle
+	if blob.IsPersistent() {
+		h, err := persistentObject(tpm, blob)
+		if err != nil {
+			return nil, err
+		}
+		sealed = h
+	} else {
+		loaded, err := load(tpm, parent, blob)
+		if err != nil {
+			return nil, err
+		}
+		defer loaded.Close()
+		sealed = loaded
+	}
+
+	auth := tpm2.PasswordAuth(nil)
+	if branch != nil {
+		var opts []tpm2.AuthOption
+		if branch.AuthValue {
+			// The session key depends on the password: an observer of the
+			// bus can neither compute the HMAC nor decrypt the secret.
+			opts = append(opts,
+				tpm2.Auth(cfg.Auth),
+				tpm2.Bound(sealed.Handle(), sealed.Name(), cfg.Auth),
+				tpm2.AESEncryption(128, tpm2.EncryptOut),
+			)
+		}
+		sess, cleanup, err := tpm2.PolicySession(tpm, tpm2.TPMAlgSHA256, 16, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start policy session: %w", tpmerrors.Wrap(err))
+		}
+		defer cleanup() //nolint:errcheck
+		if err := satisfy(tpm, sess, branch, cfg); err != nil {
+			return nil, err
+		}
+		if len(blob.Policy.Branches) > 0 {
+			if err := policyOr(tpm, sess, blob.Policy.branchDigests()...); err != nil {
+				return nil, err
+			}
+		}
+		if blob.Duplication != nil {
+			if err := policyOr(tpm, sess, blob.Policy.Digest, blob.Duplication.Digest); err != nil {
+				return nil, err
+			}
+		}
+		auth = sess
+	}
+
+	var sessions []tpm2.Session
+	if encryptOut {
+		sess, cleanup, err := encryptSession(tpm, parent, tpm2.AESEncryption(128, tpm2.EncryptOut))
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup() //nolint:errcheck
+		sessions = append(sessions, sess)
+	}
+	rsp, err := tpm2.Unseal{ItemHandle: tpmutil.ToAuthHandle(sealed, auth)}.Execute(tpm, sessions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal data: %w", tpmerrors.Wrap(err))
+	}
+	return rsp.OutData.Buffer, nil
+}
+
+// Evict removes the persistent sealed object of blob from the TPM.
+func Evict(tpm transport.TPM, blob *Blob) error {
+	if blob == nil || !blob.IsPersistent() {
+		return errors.New("blob has no persistent sealed object")
+	}
+	if _, err := persistentObject(tpm, blob); err != nil {
+		return err
+	}
+	return persist.Evict(tpm, blob.Handle)
+}
+
+// persistentObject returns the persistent sealed object of blob, after
+// checking it is still the one recorded in the blob.
+func persistentObject(tpm transport.TPM, blob *Blob) (tpmutil.Handle, error) {
+	rsp, err := tpm2.ReadPublic{ObjectHandle: blob.Handle}.Execute(tpm)
+	if err != nil {
+		if errors.Is(err, tpm2.TPMRCHandle) {
+			return nil, fmt.Errorf("%w: 0x%x", ErrObjectMissing, blob.Handle)
+		}
+		return nil, fmt.Errorf("failed to read public area of 0x%x: %w", blob.Handle, err)
+	}
+	if !bytes.Equal(rsp.Name.Buffer, blob.Name) {
+		return nil, fmt.Errorf("%w: 0x%x has name %x", ErrObjectMismatch, blob.Handle, rsp.Name.Buffer)
+	}
+	return tpmutil.NewHandle(&tpm2.NamedHandle{Handle: blob.Handle, Name: rsp.Name}), nil
+}
+
+// parentOrSRK returns parent, or the provisioned ECC SRK when parent is nil.
+func parentOrSRK(tpm transport.TPM, parent tpmutil.Handle) (tpmutil.Handle, error) {
+	if parent != nil {
+		return parent, nil
+	}
+	srk, err := provision.EnsureSRK(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision SRK: %w", err)
+	}
+	return srk, nil
+}
+
+// transientSRK creates the ECC SRK of provision.EnsureSRK as a transient
+// object, flushed by the caller.
+func transientSRK(tpm transport.TPM) (tpmutil.HandleCloser, error) {
+	srk, err := tpmutil.CreatePrimary(tpm, tpmutil.CreatePrimaryConfig{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.ECCSRKTemplate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SRK: %w", err)
+	}
+	return srk, nil
+}
+
+// load loads the sealed object of blob under parent, importing it first if
+// blob is the output of [Migrate].
+func load(tpm transport.TPM, parent tpmutil.Handle, blob *Blob) (tpmutil.HandleCloser, error) {
+	public, err := tpm2.Unmarshal[tpm2.TPM2BPublic](blob.Public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sealed object public area: %w", err)
+	}
+	var private *tpm2.TPM2BPrivate
+	if blob.Duplicate != nil {
+		if private, err = importDuplicate(tpm, parent, *public, blob); err != nil {
+			return nil, err
+		}
+	} else if private, err = tpm2.Unmarshal[tpm2.TPM2BPrivate](blob.Private); err != nil {
+		return nil, fmt.Errorf("failed to decode sealed object private area: %w", err)
+	}
+	rsp, err := tpm2.Load{
+		ParentHandle: tpmutil.ToAuthHandle(parent),
+		InPublic:     *public,
+		InPrivate:    *private,
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sealed object: %w", tpmerrors.Wrap(err))
+	}
+	return tpmutil.NewHandleCloser(tpm, &tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}), nil
+}
+
+// unsealPolicy computes the policy of b: PolicyPCR with the values of
+// b.PCRs, whose composite digest is b.PCRDigest or, when nil, their current
+// values, then PolicyAuthValue and PolicySigned.
+func unsealPolicy(tpm transport.TPM, b Branch) (*Policy, error) {
+	calc, err := tpm2.NewPolicyCalculator(tpm2.TPMAlgSHA256)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{Bank: tpmjson.AlgID(b.Bank), AuthValue: b.AuthValue}
+	if len(b.PCRs) > 0 {
+		p.PCRs = slices.Compact(slices.Sorted(slices.Values(b.PCRs)))
+		p.PCRDigest = b.PCRDigest
+		if p.PCRDigest == nil {
+			if p.PCRDigest, err = currentPCRDigest(tpm, b.Bank, p.PCRs); err != nil {
+				return nil, err
+			}
+		}
+		if err := (tpm2.PolicyPCR{
+			PcrDigest: tpm2.TPM2BDigest{Buffer: p.PCRDigest},
+			Pcrs:      pcr.Selection(b.Bank, p.PCRs...),
+		}).Update(calc); err != nil {
+			return nil, fmt.Errorf("failed to compute PCR policy: %w", err)
+		}
+	}
+	if b.AuthValue {
+		if err := (tpm2.PolicyAuthValue{}).Update(calc); err != nil {
+			return nil, fmt.Errorf("failed to compute password policy: %w", err)
+		}
+	}
+	if b.Authority != nil {
+		public, err := policy.ExternalKey(b.Authority)
+		if err != nil {
+			return nil, err
+		}
+		if err := policy.Signed(calc, b.Authority, b.PolicyRef); err != nil {
+			return nil, fmt.Errorf("failed to compute signed policy: %w", err)
+		}
+		p.Authority = tpm2.Marshal(public)
+		p.PolicyRef = b.PolicyRef
+	}
+	p.Digest = calc.Hash().Digest
+	return p, nil
+}
+
+// branchesPolicy computes the PolicyOR of the policies of branches.
+func branchesPolicy(tpm transport.TPM, branches []Branch) (*Policy, error) {
+	p := &Policy{}
+	for i, b := range branches {
+		branch, err := unsealPolicy(tpm, b)
+		if err != nil {
+			return nil, fmt.Errorf("branch %d: %w", i, err)
+		}
+		p.Branches = append(p.Branches, *branch)
+	}
+	digest, err := orPolicy(p.branchDigests()...)
+	if err != nil {
+		return nil, err
+	}
+	p.Digest = digest
+	return p, nil
+}
+
+// currentPCRDigest returns the composite digest of the current values of
+// pcrs, sorted without duplicates.
+func currentPCRDigest(tpm transport.TPM, bank tpm2.TPMAlgID, pcrs []uint) ([]byte, error) {
+	values, err := pcr.Read(tpm, bank, pcrs...)
+	if err != nil {
+		return nil, err
+	}
+	if indexes := values.Indexes(); len(indexes) != len(pcrs) {
+		return nil, fmt.Errorf("failed to read PCRs %v of bank 0x%x: got %v", pcrs, bank, indexes)
+	}
+	return values.Digest()
+}
+
+// hasAuthValue reports whether p, or one of its branches, requires the
+// password of the sealed object.
+func (p *Policy) hasAuthValue() bool {
+	return p.AuthValue || slices.ContainsFunc(p.Branches, func(b Policy) bool { return b.AuthValue })
+}
+
+func (p *Policy) branchDigests() [][]byte {
+	digests := make([][]byte, 0, len(p.Branches))
+	for _, b := range p.Branches {
+		digests = append(digests, b.Digest)
+	}
+	return digests
+}
+
+// pickBranch returns p, or the first of its branches satisfiable with cfg
+// and the current PCR values.
+func pickBranch(tpm transport.TPM, p *Policy, cfg UnsealConfig) (*Policy, error) {
+	if len(p.Branches) == 0 {
+		return p, nil
+	}
+	for i := range p.Branches {
+		b := &p.Branches[i]
+		if (b.AuthValue && cfg.Auth == nil) || (b.Authority != nil && cfg.Authorize == nil) {
+			continue
+		}
+		if len(b.PCRs) > 0 {
+			digest, err := currentPCRDigest(tpm, tpm2.TPMAlgID(b.Bank), b.PCRs)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(digest, b.PCRDigest) {
+				continue
+			}
+		}
+		return b, nil
+	}
+	return nil, ErrNoBranch
+}
+
+// satisfy runs the assertions of the policy p in sess.
+func satisfy(tpm transport.TPM, sess tpm2.Session, p *Policy, cfg UnsealConfig) error {
+	if len(p.PCRs) > 0 {
+		if _, err := (tpm2.PolicyPCR{
+			PolicySession: sess.Handle(),
+			Pcrs:          pcr.Selection(tpm2.TPMAlgID(p.Bank), p.PCRs...),
+		}).Execute(tpm); err != nil {
+			return fmt.Errorf("failed to satisfy PCR policy: %w", tpmerrors.Wrap(err))
+		}
+	}
+	if p.AuthValue {
+		if _, err := (tpm2.PolicyAuthValue{PolicySession: sess.Handle()}).Execute(tpm); err != nil {
+			return fmt.Errorf("failed to satisfy password policy: %w", tpmerrors.Wrap(err))
+		}
+	}
+	if p.Authority != nil {
+		public, err := tpm2.Unmarshal[tpm2.TPMTPublic](p.Authority)
+		if err != nil {
+			return fmt.Errorf("failed to decode authority public area: %w", err)
+		}
+		authority, err := tpmcrypto.PublicKey(public)
+		if err != nil {
+			return fmt.Errorf("failed to decode authority public area: %w", err)
+		}
+		auth, err := cfg.Authorize(sess.NonceTPM().Buffer)
+		if err != nil {
+			return fmt.Errorf("failed to get authorization: %w", err)
+		}
+		if _, err := policy.SatisfySigned(tpm, sess.Handle(), authority, auth); err != nil {
+			return fmt.Errorf("failed to satisfy signed policy: %w", tpmerrors.Wrap(err))
+		}
+	}
+	return nil
+}
+
+// encryptSession starts a session salted with parent, with the parameter
+// encryption set by encryption: the salt is only known to the caller and the
+// TPM.
+func encryptSession(tpm transport.TPM, parent tpmutil.Handle, encryption tpm2.AuthOption) (tpm2.Session, func() error, error) {
+	pub := parent.Public()
+	if pub == nil {
+		h, err := tpmutil.ToHandle(tpm, parent.Handle())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read parent public area: %w", err)
+		}
+		pub = h.Public()
+	}
+	sess, cleanup, err := tpm2.HMACSession(tpm, tpm2.TPMAlgSHA256, 16,
+		tpm2.Salted(parent.Handle(), *pub),
+		encryption,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start encrypted session: %w", tpmerrors.Wrap(err))
+	}
+	return sess, cleanup, nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpm2/transport/linuxtpm"
 	"github.com/loicsikidi/go-tpm-kit/tpmutil"
+	"github.com/loicsikidi/tpm-stuff/templates"
 )
 
 // TestSealDataSizeLimitsRealTPM tests the size limits for sealed data on a real TPM.
@@ -41,16 +42,7 @@ func TestSealDataSizeLimitsRealTPM(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.description, func(t *testing.T) {
-			template := tpm2.TPMTPublic{
-				Type:    tpm2.TPMAlgKeyedHash,
-				NameAlg: tc.nameAlg,
-				ObjectAttributes: tpm2.TPMAObject{
-					FixedTPM:     true,
-					FixedParent:  true,
-					UserWithAuth: true,
-					NoDA:         true,
-				},
-			}
+			template := templates.Seal(templates.WithNameAlg(tc.nameAlg), templates.WithNoDA())
 
 			// Test with data at maximum size - should succeed
 			dataAtMax := make([]byte, tc.maxSize)